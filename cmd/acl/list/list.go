@@ -35,6 +35,10 @@ func run(cliCtx *cli.Context) error {
 
 	content, _ := txpool.ListContentAtACL(cliCtx.Context, aclDB)
 	log.Info(content)
+	sponsorships, _ := txpool.ListSponsorships(cliCtx.Context, aclDB)
+	for _, s := range sponsorships {
+		log.Info("Sponsorship - ", "kind:", s.Kind.String(), "address:", s.Address.Hex(), "dailyGas:", s.DailyGasBudget, "contracts:", s.Contracts)
+	}
 	pts, _ := txpool.LastPolicyTransactions(cliCtx.Context, aclDB, logCountOutput)
 	if len(pts) == 0 {
 		log.Info("No policy transactions found")
@@ -9,6 +9,7 @@ import (
 
 	"github.com/ledgerwatch/erigon/cmd/acl/list"
 	"github.com/ledgerwatch/erigon/cmd/acl/mode"
+	"github.com/ledgerwatch/erigon/cmd/acl/sponsor"
 	"github.com/ledgerwatch/erigon/cmd/acl/update"
 	"github.com/ledgerwatch/erigon/params"
 	"github.com/ledgerwatch/erigon/turbo/logging"
@@ -31,6 +32,8 @@ func main() {
 		&update.UpdateCommand,
 		&update.RemoveCommand,
 		&update.AddCommand,
+		&sponsor.SetCommand,
+		&sponsor.RemoveCommand,
 	}
 
 	app.Flags = []cli.Flag{}
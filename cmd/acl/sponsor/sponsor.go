@@ -0,0 +1,148 @@
+package sponsor
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/ledgerwatch/erigon-lib/common"
+	"github.com/ledgerwatch/erigon/cmd/utils"
+	"github.com/ledgerwatch/erigon/zk/txpool"
+	"github.com/ledgerwatch/erigon/zkevm/log"
+	"github.com/urfave/cli/v2"
+)
+
+const failedToOpenDB = "Failed to open ACL database"
+
+var errDataDirNotSet = errors.New("data directory is not set")
+
+var (
+	address   string
+	kind      string
+	dailyGas  uint64
+	contracts string
+)
+
+var kindFlag = &cli.StringFlag{
+	Name:        "kind",
+	Usage:       "Kind of the sponsorship (sender or contract)",
+	Required:    true,
+	Destination: &kind,
+}
+
+var SetCommand = cli.Command{
+	Action: setRun,
+	Name:   "sponsor",
+	Usage:  "Sponsor the free transactions of a sender or to a contract",
+	Flags: []cli.Flag{
+		&utils.DataDirFlag,
+		&cli.StringFlag{
+			Name:        "address",
+			Usage:       "Address of the sender or contract to sponsor",
+			Required:    true,
+			Destination: &address,
+		},
+		kindFlag,
+		&cli.Uint64Flag{
+			Name:        "daily-gas",
+			Usage:       "Total gas limit of the free transactions sponsored per UTC day",
+			Required:    true,
+			Destination: &dailyGas,
+		},
+		&cli.StringFlag{
+			Name:        "contracts",
+			Usage:       "Comma separated contracts a sender sponsorship is limited to, any if empty",
+			Destination: &contracts,
+		},
+	},
+}
+
+var RemoveCommand = cli.Command{
+	Action: removeRun,
+	Name:   "unsponsor",
+	Usage:  "Remove the sponsorship of a sender or contract",
+	Flags: []cli.Flag{
+		&utils.DataDirFlag,
+		&cli.StringFlag{
+			Name:        "address",
+			Usage:       "Address of the sponsored sender or contract",
+			Required:    true,
+			Destination: &address,
+		},
+		kindFlag,
+	},
+}
+
+// setRun is the entry point for the sponsor command that adds or replaces the sponsorship of the given address
+func setRun(cliCtx *cli.Context) error {
+	if !cliCtx.IsSet(utils.DataDirFlag.Name) {
+		return errDataDirNotSet
+	}
+
+	dataDir := cliCtx.String(utils.DataDirFlag.Name)
+
+	log.Info("Setting sponsorship", "dataDir", dataDir, "address", address, "kind", kind, "dailyGas", dailyGas)
+
+	sponsorKind, err := txpool.ResolveSponsorKind(kind)
+	if err != nil {
+		log.Error("Failed to resolve sponsor kind", "err", err)
+		return err
+	}
+
+	sponsorship := txpool.Sponsorship{
+		Kind:           sponsorKind,
+		Address:        common.HexToAddress(address),
+		DailyGasBudget: dailyGas,
+	}
+	for _, contract := range strings.Split(contracts, ",") {
+		if contract = strings.TrimSpace(contract); contract != "" {
+			sponsorship.Contracts = append(sponsorship.Contracts, common.HexToAddress(contract))
+		}
+	}
+
+	aclDB, err := txpool.OpenACLDB(cliCtx.Context, dataDir)
+	if err != nil {
+		log.Error(failedToOpenDB, "err", err)
+		return err
+	}
+
+	if err := txpool.SetSponsorship(cliCtx.Context, aclDB, sponsorship); err != nil {
+		log.Error("Failed to set sponsorship", "err", err)
+		return err
+	}
+
+	log.Info("Sponsorship set", "address", address, "kind", kind)
+
+	return nil
+}
+
+// removeRun is the entry point for the unsponsor command that removes the sponsorship of the given address
+func removeRun(cliCtx *cli.Context) error {
+	if !cliCtx.IsSet(utils.DataDirFlag.Name) {
+		return errDataDirNotSet
+	}
+
+	dataDir := cliCtx.String(utils.DataDirFlag.Name)
+
+	log.Info("Removing sponsorship", "dataDir", dataDir, "address", address, "kind", kind)
+
+	sponsorKind, err := txpool.ResolveSponsorKind(kind)
+	if err != nil {
+		log.Error("Failed to resolve sponsor kind", "err", err)
+		return err
+	}
+
+	aclDB, err := txpool.OpenACLDB(cliCtx.Context, dataDir)
+	if err != nil {
+		log.Error(failedToOpenDB, "err", err)
+		return err
+	}
+
+	if err := txpool.RemoveSponsorship(cliCtx.Context, aclDB, sponsorKind, common.HexToAddress(address)); err != nil {
+		log.Error("Failed to remove sponsorship", "err", err)
+		return err
+	}
+
+	log.Info("Sponsorship removed", "address", address, "kind", kind)
+
+	return nil
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/ledgerwatch/erigon-lib/kv"
+	"github.com/ledgerwatch/erigon-lib/kv/mdbx"
+	"github.com/ledgerwatch/log/v3"
+	"github.com/urfave/cli/v2"
+
+	"github.com/ledgerwatch/erigon/cmd/utils"
+	"github.com/ledgerwatch/erigon/ethclient"
+	"github.com/ledgerwatch/erigon/turbo/logging"
+	"github.com/ledgerwatch/erigon/turbo/node"
+	"github.com/ledgerwatch/erigon/zk/forkcheck"
+	"github.com/ledgerwatch/erigon/zk/syncer"
+)
+
+var (
+	checkForksNoDbFlag = cli.BoolFlag{
+		Name:  "no-db",
+		Usage: "Don't cross check against the database in the datadir",
+	}
+	checkForksNoL1Flag = cli.BoolFlag{
+		Name:  "no-l1",
+		Usage: "Don't cross check against the rollup manager on the L1",
+	}
+	checkForksOutputFlag = cli.StringFlag{
+		Name:  "output",
+		Usage: "File to write the JSON report to, stdout by default",
+	}
+)
+
+var checkForksCommand = cli.Command{
+	Action:    checkForks,
+	Name:      "check-forks",
+	Usage:     "Cross check the fork schedule of the config against the database and the rollup manager on the L1",
+	ArgsUsage: "--config=<node config file> [--no-db] [--no-l1] [--output=<report file>]",
+	Flags: []cli.Flag{
+		&utils.ConfigFlag,
+		&checkForksNoDbFlag,
+		&checkForksNoL1Flag,
+		&checkForksOutputFlag,
+	},
+	Description: `
+The config is loaded the same as the node loads it, including the dynamic config files
+of a dynamic chain.  Every mismatch is logged and the command fails if there is any, so
+it can gate a deployment.  The database is opened read only and can be in use by the node.`,
+}
+
+func checkForks(cliCtx *cli.Context) error {
+	configFilePath := cliCtx.String(utils.ConfigFlag.Name)
+	if configFilePath != "" {
+		if err := setFlagsFromConfigFile(cliCtx, configFilePath); err != nil {
+			return fmt.Errorf("failed setting config flags from yaml/toml file: %v", err)
+		}
+	}
+
+	logging.SetupLoggerCtx("cdk-erigon", cliCtx, log.LvlInfo, log.LvlInfo, true)
+	logger := log.New()
+	ctx := cliCtx.Context
+
+	nodeCfg := node.NewNodConfigUrfave(cliCtx, logger)
+	ethCfg := node.NewEthConfigUrfave(cliCtx, nodeCfg, logger)
+	if ethCfg.Genesis == nil || ethCfg.Genesis.Config == nil {
+		return errors.New("the config has no chain config")
+	}
+
+	var tx kv.Tx
+	if !cliCtx.Bool(checkForksNoDbFlag.Name) {
+		if _, err := os.Stat(filepath.Join(nodeCfg.Dirs.Chaindata, "mdbx.dat")); err != nil {
+			return fmt.Errorf("no database in %s, use --%s to check without it: %w", nodeCfg.Dirs.Chaindata, checkForksNoDbFlag.Name, err)
+		}
+		db, err := mdbx.NewMDBX(logger).Path(nodeCfg.Dirs.Chaindata).Label(kv.ChainDB).Readonly().Open(ctx)
+		if err != nil {
+			return err
+		}
+		defer db.Close()
+		if tx, err = db.BeginRo(ctx); err != nil {
+			return err
+		}
+		defer tx.Rollback()
+	}
+
+	var l1 forkcheck.L1
+	if !cliCtx.Bool(checkForksNoL1Flag.Name) {
+		client, err := ethclient.Dial(ethCfg.L1RpcUrl)
+		if err != nil {
+			return fmt.Errorf("failed to dial the L1 at %s: %w", ethCfg.L1RpcUrl, err)
+		}
+		defer client.Close()
+		l1 = syncer.NewL1Syncer(ctx, []syncer.IEtherman{client}, nil, nil, ethCfg.L1BlockRange, ethCfg.L1QueryDelay, ethCfg.L1HighestBlockType)
+	}
+
+	report, err := forkcheck.Check(ctx, ethCfg.Genesis.Config, ethCfg.Zk, tx, l1)
+	if err != nil {
+		return err
+	}
+
+	out := os.Stdout
+	if outputFile := cliCtx.String(checkForksOutputFlag.Name); outputFile != "" {
+		if out, err = os.Create(outputFile); err != nil {
+			return err
+		}
+		defer out.Close()
+	}
+	encoder := json.NewEncoder(out)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(report); err != nil {
+		return err
+	}
+
+	for _, m := range report.Mismatches {
+		log.Warn("Fork schedule mismatch", "check", m.Check, "detail", m.Detail)
+	}
+	if len(report.Mismatches) > 0 {
+		return fmt.Errorf("the fork schedule has %d mismatches", len(report.Mismatches))
+	}
+	log.Info("Fork schedule checks out", "chain", report.ChainName, "forks", len(report.Forks))
+	return nil
+}
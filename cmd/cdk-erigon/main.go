@@ -36,6 +36,7 @@ func main() {
 	}()
 
 	app := erigonapp.MakeApp("cdk-erigon", runErigon, erigoncli.DefaultFlags)
+	app.Commands = append(app.Commands, &checkForksCommand)
 	if err := app.Run(os.Args); err != nil {
 		_, printErr := fmt.Fprintln(os.Stderr, err)
 		if printErr != nil {
@@ -0,0 +1,68 @@
+package commands
+
+import (
+	"context"
+	"errors"
+
+	"github.com/ledgerwatch/erigon-lib/common"
+	"github.com/ledgerwatch/erigon-lib/kv"
+	"github.com/ledgerwatch/erigon/turbo/debug"
+	"github.com/ledgerwatch/erigon/zk/consistency"
+	"github.com/ledgerwatch/log/v3"
+	"github.com/spf13/cobra"
+)
+
+var cmdCheckHermezDbZk = &cobra.Command{
+	Use: "check_hermez_db_zkevm",
+	Short: `Check the hermez tables against the chain data and optionally repair what can be derived from it.
+Examples:
+check_hermez_db_zkevm --datadir=/datadirs/hermez-mainnet --from-block=1000 --to-block=2000
+check_hermez_db_zkevm --datadir=/datadirs/hermez-mainnet --repair
+		`,
+	Run: func(cmd *cobra.Command, args []string) {
+		ctx, _ := common.RootContext()
+		logger := debug.SetupCobra(cmd, "integration")
+		db, err := openDB(dbCfg(kv.ChainDB, chaindata), false, logger)
+		if err != nil {
+			logger.Error("Opening DB", "error", err)
+			return
+		}
+		defer db.Close()
+
+		var violations []*consistency.Violation
+		repaired := 0
+		check := func(tx kv.Tx) error {
+			violations, err = consistency.Check(ctx, tx, fromBlock, toBlock)
+			return err
+		}
+		if repair {
+			err = db.Update(ctx, func(tx kv.RwTx) error {
+				if err := check(tx); err != nil {
+					return err
+				}
+				repaired, err = consistency.Repair(tx, violations)
+				return err
+			})
+		} else {
+			err = db.View(ctx, check)
+		}
+		if err != nil {
+			if !errors.Is(err, context.Canceled) {
+				log.Error(err.Error())
+			}
+			return
+		}
+
+		for _, v := range violations {
+			log.Warn("Hermez db violation", "check", v.Check, "block", v.Block, "batch", v.Batch, "repairable", v.Repairable(), "detail", v.Detail)
+		}
+		log.Info("Hermez db checked", "violations", len(violations), "repaired", repaired)
+	},
+}
+
+func init() {
+	withDataDir(cmdCheckHermezDbZk)
+	withBlockRange(cmdCheckHermezDbZk)
+	withRepair(cmdCheckHermezDbZk)
+	rootCmd.AddCommand(cmdCheckHermezDbZk)
+}
@@ -0,0 +1,127 @@
+package commands
+
+import (
+	"context"
+	"errors"
+
+	"github.com/ledgerwatch/erigon-lib/common"
+	"github.com/ledgerwatch/erigon-lib/common/datadir"
+	"github.com/ledgerwatch/erigon-lib/kv"
+	"github.com/ledgerwatch/erigon/cmd/hack/tool/fromdb"
+	"github.com/ledgerwatch/erigon/ethclient"
+	"github.com/ledgerwatch/erigon/params"
+	"github.com/ledgerwatch/erigon/turbo/debug"
+	"github.com/ledgerwatch/erigon/zk/dynamic_configs"
+	"github.com/ledgerwatch/erigon/zk/syncer"
+	"github.com/ledgerwatch/log/v3"
+	"github.com/spf13/cobra"
+)
+
+var cmdDynamicConfigsZk = &cobra.Command{
+	Use: "dynamic_configs_zkevm",
+	Short: `Generate the allocs, chainspec and conf files of a dynamic chain starting from the state of the node at the end of a block.
+The SMT root of the allocs is verified against the state root of the block, nothing is written to the database.
+Examples:
+dynamic_configs_zkevm --datadir=/datadirs/hermez-mainnet --block=1000000 --chain-name=dynamic-mainnet-shadowfork --output-dir=/dynamic-mainnet-shadowfork
+dynamic_configs_zkevm --datadir=/datadirs/hermez-mainnet --block=1000000 --chain-name=dynamic-devnet --chain-id=2440 --output-dir=/dynamic-devnet
+		`,
+	Run: func(cmd *cobra.Command, args []string) {
+		ctx, _ := common.RootContext()
+		logger := debug.SetupCobra(cmd, "integration")
+		db, err := openDB(dbCfg(kv.ChainDB, chaindata), false, logger)
+		if err != nil {
+			logger.Error("Opening DB", "error", err)
+			return
+		}
+		defer db.Close()
+
+		spec, err := dynamic_configs.ChainSpec(fromdb.ChainConfig(db), dynamicChainName, dynamicChainId)
+		if err != nil {
+			log.Error(err.Error())
+			return
+		}
+
+		var configs *dynamic_configs.Configs
+		if err := db.View(ctx, func(tx kv.Tx) error {
+			configs, err = dynamic_configs.FromState(ctx, tx, datadir.New(datadirCli).Tmp, stateBlockNo, spec)
+			return err
+		}); err != nil {
+			if !errors.Is(err, context.Canceled) {
+				log.Error(err.Error())
+			}
+			return
+		}
+
+		writeDynamicConfigs(configs)
+	},
+}
+
+var cmdDynamicConfigsL1Zk = &cobra.Command{
+	Use: "dynamic_configs_l1_zkevm",
+	Short: `Generate the allocs, chainspec and conf files of a dynamic chain from the creation of its rollup on the L1.
+The allocs of the genesis are read from a file and their SMT root is verified against the genesis of the rollup type.
+Examples:
+dynamic_configs_l1_zkevm --datadir=/datadirs/scratch --l1-rpc-url=https://rpc.sepolia.org --address-rollup=0x32d33D5137a7cFFb54c5Bf8371172bcEc5f310ff --rollup-id=1 --l1-block=4794475 --allocs=genesis.json --chain-name=dynamic-mynetwork --output-dir=/dynamic-mynetwork
+		`,
+	Run: func(cmd *cobra.Command, args []string) {
+		ctx, _ := common.RootContext()
+		debug.SetupCobra(cmd, "integration")
+
+		base := params.ChainConfigByChainName(baseChain)
+		if base == nil {
+			log.Error("Unknown base chain", "chain", baseChain)
+			return
+		}
+		spec, err := dynamic_configs.ChainSpec(base, dynamicChainName, 0)
+		if err != nil {
+			log.Error(err.Error())
+			return
+		}
+
+		allocs, err := dynamic_configs.ReadAllocs(allocsFile)
+		if err != nil {
+			log.Error(err.Error())
+			return
+		}
+
+		client, err := ethclient.Dial(l1RpcUrl)
+		if err != nil {
+			log.Error("Failed to dial the L1", "url", l1RpcUrl, "err", err)
+			return
+		}
+		defer client.Close()
+		l1 := syncer.NewL1Syncer(ctx, []syncer.IEtherman{client}, nil, nil, 0, 0, "latest")
+
+		configs, err := dynamic_configs.FromL1(ctx, l1, common.HexToAddress(rollupManagerAddr), rollupId, l1BlockNo, datadir.New(datadirCli).Tmp, allocs, spec)
+		if err != nil {
+			if !errors.Is(err, context.Canceled) {
+				log.Error(err.Error())
+			}
+			return
+		}
+
+		writeDynamicConfigs(configs)
+	},
+}
+
+func writeDynamicConfigs(configs *dynamic_configs.Configs) {
+	if err := configs.Write(dynamicConfigsDir); err != nil {
+		log.Error("Failed to write the dynamic configs", "dir", dynamicConfigsDir, "err", err)
+		return
+	}
+	log.Info("Wrote the dynamic configs, start the sequencer with zkevm.sequencer-initial-fork-id set to the fork",
+		"dir", dynamicConfigsDir, "chain", configs.ChainSpec.ChainName, "chainId", configs.ChainSpec.ChainID, "root", configs.Conf.Root,
+		"accounts", len(configs.Allocs), "fork", configs.ForkId)
+}
+
+func init() {
+	withDataDir(cmdDynamicConfigsZk)
+	withStateBlockNo(cmdDynamicConfigsZk)
+	withDynamicChain(cmdDynamicConfigsZk)
+	rootCmd.AddCommand(cmdDynamicConfigsZk)
+
+	withDataDir(cmdDynamicConfigsL1Zk)
+	withRollupCreation(cmdDynamicConfigsL1Zk)
+	withDynamicChain(cmdDynamicConfigsL1Zk)
+	rootCmd.AddCommand(cmdDynamicConfigsL1Zk)
+}
@@ -0,0 +1,101 @@
+package commands
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/ledgerwatch/erigon-lib/common"
+	"github.com/ledgerwatch/erigon-lib/common/hexutil"
+	"github.com/ledgerwatch/erigon-lib/common/length"
+	"github.com/ledgerwatch/erigon-lib/kv"
+	"github.com/ledgerwatch/erigon/turbo/debug"
+	"github.com/ledgerwatch/erigon/zk/l1_data"
+	"github.com/ledgerwatch/log/v3"
+	"github.com/spf13/cobra"
+)
+
+var cmdExportBatchesZk = &cobra.Command{
+	Use: "export_batches_zkevm",
+	Short: `Export a range of batches as the batch data posted on L1 with their acc input hash chain.
+Examples:
+export_batches_zkevm --datadir=/datadirs/hermez-mainnet --from-batch=100 --to-batch=200 --export-dir=/exports/100-200 --old-acc-input-hash=0x...
+		`,
+	Run: func(cmd *cobra.Command, args []string) {
+		ctx, _ := common.RootContext()
+		logger := debug.SetupCobra(cmd, "integration")
+		oldAccInputHash, err := parseOldAccInputHash(oldAccInputHashFlag, fromBatch)
+		if err != nil {
+			logger.Error("Invalid --old-acc-input-hash", "error", err)
+			return
+		}
+		db, err := openDB(dbCfg(kv.ChainDB, chaindata), false, logger)
+		if err != nil {
+			logger.Error("Opening DB", "error", err)
+			return
+		}
+		defer db.Close()
+
+		var manifest *l1_data.BatchExportManifest
+		if err := db.View(ctx, func(tx kv.Tx) error {
+			manifest, err = l1_data.ExportBatches(tx, exportDir, fromBatch, toBatch, oldAccInputHash)
+			return err
+		}); err != nil {
+			if !errors.Is(err, context.Canceled) {
+				log.Error(err.Error())
+			}
+			return
+		}
+
+		log.Info("Batches exported", "dir", exportDir, "from", manifest.FirstBatch, "to", manifest.LastBatch, "accInputHash", manifest.FinalAccInputHash)
+	},
+}
+
+// parseOldAccInputHash reads the acc input hash the export starts from, the node does not keep it so it has to be
+// given for any batch but the first, whose old acc input hash is zero
+func parseOldAccInputHash(flag string, fromBatch uint64) (common.Hash, error) {
+	if flag == "" {
+		if fromBatch > 1 {
+			return common.Hash{}, fmt.Errorf("required to export from batch %d", fromBatch)
+		}
+		return common.Hash{}, nil
+	}
+	b, err := hexutil.Decode(flag)
+	if err != nil {
+		return common.Hash{}, err
+	}
+	if len(b) != length.Hash {
+		return common.Hash{}, fmt.Errorf("%d bytes instead of %d", len(b), length.Hash)
+	}
+	return common.BytesToHash(b), nil
+}
+
+var cmdVerifyBatchExportZk = &cobra.Command{
+	Use: "verify_batch_export_zkevm",
+	Short: `Decode the batch data of an export and recompute its acc input hash chain.
+Examples:
+verify_batch_export_zkevm --export-dir=/exports/100-200
+		`,
+	Run: func(cmd *cobra.Command, args []string) {
+		debug.SetupCobra(cmd, "integration")
+
+		manifest, err := l1_data.VerifyBatchExport(exportDir)
+		if err != nil {
+			log.Error("Batch export is invalid", "dir", exportDir, "err", err)
+			return
+		}
+
+		log.Info("Batch export is valid", "dir", exportDir, "from", manifest.FirstBatch, "to", manifest.LastBatch, "accInputHash", manifest.FinalAccInputHash)
+	},
+}
+
+func init() {
+	withDataDir(cmdExportBatchesZk)
+	withBatchRange(cmdExportBatchesZk)
+	withExportDir(cmdExportBatchesZk)
+	withOldAccInputHash(cmdExportBatchesZk)
+	rootCmd.AddCommand(cmdExportBatchesZk)
+
+	withExportDir(cmdVerifyBatchExportZk)
+	rootCmd.AddCommand(cmdVerifyBatchExportZk)
+}
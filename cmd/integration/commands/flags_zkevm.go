@@ -1,6 +1,11 @@
 package commands
 
-import "github.com/spf13/cobra"
+import (
+	"math"
+
+	"github.com/ledgerwatch/erigon-lib/chain/networkname"
+	"github.com/spf13/cobra"
+)
 
 var (
 	unwindBatchNo uint64
@@ -9,3 +14,128 @@ var (
 func withUnwindBatchNo(cmd *cobra.Command) {
 	cmd.Flags().Uint64Var(&unwindBatchNo, "unwind-batch-no", 0, "batch number to unwind to (this batch number will be the tip after unwind)")
 }
+
+var (
+	fromBatch, toBatch  uint64
+	exportDir           string
+	oldAccInputHashFlag string
+)
+
+func withBatchRange(cmd *cobra.Command) {
+	cmd.Flags().Uint64Var(&fromBatch, "from-batch", 1, "first batch to export")
+	cmd.Flags().Uint64Var(&toBatch, "to-batch", 0, "last batch to export")
+	must(cmd.MarkFlagRequired("to-batch"))
+}
+
+func withExportDir(cmd *cobra.Command) {
+	cmd.Flags().StringVar(&exportDir, "export-dir", "", "directory of the batch export")
+	must(cmd.MarkFlagRequired("export-dir"))
+	must(cmd.MarkFlagDirname("export-dir"))
+}
+
+func withOldAccInputHash(cmd *cobra.Command) {
+	cmd.Flags().StringVar(&oldAccInputHashFlag, "old-acc-input-hash", "", "acc input hash of the batch before --from-batch as read from the rollup contract, required unless exporting from batch 1")
+}
+
+var (
+	fromBlock, toBlock uint64
+	repair             bool
+)
+
+func withBlockRange(cmd *cobra.Command) {
+	cmd.Flags().Uint64Var(&fromBlock, "from-block", 1, "first block to check")
+	cmd.Flags().Uint64Var(&toBlock, "to-block", math.MaxUint64, "last block to check, defaults to the highest canonical block")
+}
+
+func withRepair(cmd *cobra.Command) {
+	cmd.Flags().BoolVar(&repair, "repair", false, "fix the violations which can be derived from the chain data")
+}
+
+var (
+	rewindBatchNo uint64
+	dryRun        bool
+	dryRunTables  []string
+	dryRunKeys    bool
+	force         bool
+)
+
+func withRewindBatchNo(cmd *cobra.Command) {
+	cmd.Flags().Uint64Var(&rewindBatchNo, "batch", 0, "batch to rewind to, its last block will be the tip after the rewind")
+	must(cmd.MarkFlagRequired("batch"))
+}
+
+func withDryRun(cmd *cobra.Command) {
+	cmd.Flags().BoolVar(&dryRun, "dry-run", false, "print what would change without changing anything")
+	cmd.Flags().StringSliceVar(&dryRunTables, "dry-run-tables", nil, "tables the dry run diffs, all of them if empty")
+	cmd.Flags().BoolVar(&dryRunKeys, "dry-run-keys", false, "print every key the dry run finds changed rather than the counts per table")
+}
+
+func withForce(cmd *cobra.Command) {
+	cmd.Flags().BoolVar(&force, "force", false, "skip the safety checks which can be overridden")
+}
+
+var (
+	replayBatchNo uint64
+	l1RpcUrl      string
+	daUrl         string
+	memdbSize     string
+	outputFile    string
+)
+
+func withReplayBatchNo(cmd *cobra.Command) {
+	cmd.Flags().Uint64Var(&replayBatchNo, "batch", 0, "batch to replay from its L1 data")
+	must(cmd.MarkFlagRequired("batch"))
+}
+
+func withL1Sources(cmd *cobra.Command) {
+	cmd.Flags().StringVar(&l1RpcUrl, "l1-rpc-url", "", "L1 RPC to fetch the sequence transaction from when the node has no L1 batch data for the batch")
+	cmd.Flags().StringVar(&daUrl, "da-url", "", "data availability URL to fetch the batch data of a validium from")
+}
+
+func withMemdbSize(cmd *cobra.Command) {
+	cmd.Flags().StringVar(&memdbSize, "memdb-size", "2GB", "size of the in memory overlay the state is unwound in, older batches need more")
+}
+
+func withOutputFile(cmd *cobra.Command) {
+	cmd.Flags().StringVar(&outputFile, "output", "", "file to write the JSON result to, stdout by default")
+}
+
+var (
+	dynamicChainName  string
+	dynamicChainId    uint64
+	dynamicConfigsDir string
+	stateBlockNo      uint64
+	rollupManagerAddr string
+	rollupId          uint64
+	l1BlockNo         uint64
+	allocsFile        string
+	baseChain         string
+)
+
+func withDynamicChain(cmd *cobra.Command) {
+	cmd.Flags().StringVar(&dynamicChainName, "chain-name", "", "name of the dynamic chain, has to start with dynamic")
+	must(cmd.MarkFlagRequired("chain-name"))
+	cmd.Flags().StringVar(&dynamicConfigsDir, "output-dir", "", "directory to write the dynamic config files to")
+	must(cmd.MarkFlagRequired("output-dir"))
+	must(cmd.MarkFlagDirname("output-dir"))
+}
+
+func withStateBlockNo(cmd *cobra.Command) {
+	cmd.Flags().Uint64Var(&stateBlockNo, "block", 0, "block whose state the chain starts from")
+	must(cmd.MarkFlagRequired("block"))
+	cmd.Flags().Uint64Var(&dynamicChainId, "chain-id", 0, "chain id of the new chain, defaults to the chain id of the node which a shadow fork has to keep")
+}
+
+func withRollupCreation(cmd *cobra.Command) {
+	cmd.Flags().StringVar(&l1RpcUrl, "l1-rpc-url", "", "L1 RPC to read the rollup creation from")
+	must(cmd.MarkFlagRequired("l1-rpc-url"))
+	cmd.Flags().StringVar(&rollupManagerAddr, "address-rollup", "", "address of the rollup manager")
+	must(cmd.MarkFlagRequired("address-rollup"))
+	cmd.Flags().Uint64Var(&rollupId, "rollup-id", 1, "id of the rollup in the rollup manager")
+	cmd.Flags().Uint64Var(&l1BlockNo, "l1-block", 0, "L1 block the rollup was created in")
+	must(cmd.MarkFlagRequired("l1-block"))
+	cmd.Flags().StringVar(&allocsFile, "allocs", "", "allocs of the genesis, as an allocs config file or the genesis file of the contracts deployment")
+	must(cmd.MarkFlagRequired("allocs"))
+	must(cmd.MarkFlagFilename("allocs"))
+	cmd.Flags().StringVar(&baseChain, "base-chain", networkname.HermezMainnetChainName, "chain the chainspec is copied from")
+}
@@ -0,0 +1,115 @@
+package commands
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+
+	"github.com/c2h5oh/datasize"
+	"github.com/ledgerwatch/erigon-lib/common"
+	"github.com/ledgerwatch/erigon-lib/common/datadir"
+	"github.com/ledgerwatch/erigon-lib/kv"
+	"github.com/ledgerwatch/erigon-lib/kv/kvcfg"
+	"github.com/ledgerwatch/erigon/cmd/hack/tool/fromdb"
+	"github.com/ledgerwatch/erigon/core/types"
+	"github.com/ledgerwatch/erigon/eth/ethconfig"
+	"github.com/ledgerwatch/erigon/ethclient"
+	"github.com/ledgerwatch/erigon/turbo/debug"
+	"github.com/ledgerwatch/erigon/zk/replay"
+	"github.com/ledgerwatch/log/v3"
+	"github.com/spf13/cobra"
+)
+
+var cmdReplayBatchZk = &cobra.Command{
+	Use: "replay_batch_zkevm",
+	Short: `Replay a batch from its L1 data on the state of the previous batch and report the first mismatch with the stored blocks.
+The node has to be stopped, nothing is written to the database.
+Examples:
+replay_batch_zkevm --datadir=/datadirs/hermez-mainnet --batch=100
+replay_batch_zkevm --datadir=/datadirs/hermez-mainnet --batch=100 --l1-rpc-url=https://rpc.sepolia.org --output=/tmp/batch-100.json
+		`,
+	Run: func(cmd *cobra.Command, args []string) {
+		ctx, _ := common.RootContext()
+		logger := debug.SetupCobra(cmd, "integration")
+		db, err := openDB(dbCfg(kv.ChainDB, chaindata), false, logger)
+		if err != nil {
+			logger.Error("Opening DB", "error", err)
+			return
+		}
+		defer db.Close()
+
+		var memdb datasize.ByteSize
+		must(memdb.UnmarshalText([]byte(memdbSize)))
+
+		chainConfig := fromdb.ChainConfig(db)
+		blockReader, _ := blocksIO(db, logger)
+		engine, _ := initConsensusEngine(ctx, chainConfig, datadirCli, db, blockReader, logger)
+		_, _, agg := allSnapshots(ctx, db, logger)
+		zkConfig := &ethconfig.Zk{WitnessMemdbSize: memdb, DAUrl: daUrl}
+
+		var l1 replay.L1TransactionReader
+		if l1RpcUrl != "" {
+			client, err := ethclient.Dial(l1RpcUrl)
+			if err != nil {
+				log.Error("Failed to dial the L1", "url", l1RpcUrl, "err", err)
+				return
+			}
+			defer client.Close()
+			l1 = &l1Transactions{ctx: ctx, client: client}
+		}
+
+		replayer := replay.NewReplayer(datadir.New(datadirCli), kvcfg.HistoryV3.FromDB(db), agg, blockReader, chainConfig, zkConfig, engine, l1)
+
+		var result *replay.Result
+		if err := db.View(ctx, func(tx kv.Tx) error {
+			result, err = replayer.ReplayBatch(ctx, tx, replayBatchNo)
+			return err
+		}); err != nil {
+			if !errors.Is(err, context.Canceled) {
+				log.Error(err.Error())
+			}
+			return
+		}
+
+		out := os.Stdout
+		if outputFile != "" {
+			if out, err = os.Create(outputFile); err != nil {
+				log.Error("Failed to create the output file", "file", outputFile, "err", err)
+				return
+			}
+			defer out.Close()
+		}
+		encoder := json.NewEncoder(out)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(result); err != nil {
+			log.Error("Failed to write the result", "err", err)
+			return
+		}
+
+		if !result.Match {
+			log.Warn("Batch differs from its replay", "batch", result.BatchNumber, "block", result.FirstMismatch.Block, "field", result.FirstMismatch.Field)
+			return
+		}
+		log.Info("Batch matches its replay", "batch", result.BatchNumber, "stateRoot", result.NewStateRoot)
+	},
+}
+
+// l1Transactions fetches the sequence transactions from an L1 RPC
+type l1Transactions struct {
+	ctx    context.Context
+	client *ethclient.Client
+}
+
+func (l *l1Transactions) GetTransaction(hash common.Hash) (types.Transaction, bool, error) {
+	return l.client.TransactionByHash(l.ctx, hash)
+}
+
+func init() {
+	withDataDir(cmdReplayBatchZk)
+	withReplayBatchNo(cmdReplayBatchZk)
+	withL1Sources(cmdReplayBatchZk)
+	withMemdbSize(cmdReplayBatchZk)
+	withOutputFile(cmdReplayBatchZk)
+	rootCmd.AddCommand(cmdReplayBatchZk)
+}
@@ -0,0 +1,494 @@
+package commands
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/0xPolygonHermez/zkevm-data-streamer/datastreamer"
+	log2 "github.com/0xPolygonHermez/zkevm-data-streamer/log"
+	"github.com/ledgerwatch/erigon-lib/common"
+	"github.com/ledgerwatch/erigon-lib/kv"
+	"github.com/ledgerwatch/log/v3"
+	"github.com/spf13/cobra"
+
+	"github.com/ledgerwatch/erigon/cmd/hack/tool/fromdb"
+	"github.com/ledgerwatch/erigon/cmd/utils"
+	"github.com/ledgerwatch/erigon/eth/stagedsync/stages"
+	"github.com/ledgerwatch/erigon/turbo/debug"
+	"github.com/ledgerwatch/erigon/zk/consistency"
+	"github.com/ledgerwatch/erigon/zk/datastream/proto/github.com/0xPolygonHermez/zkevm-node/state/datastream"
+	"github.com/ledgerwatch/erigon/zk/datastream/server"
+	"github.com/ledgerwatch/erigon/zk/datastream/types"
+	"github.com/ledgerwatch/erigon/zk/hermez_db"
+	"github.com/ledgerwatch/erigon/zk/sequencer"
+)
+
+var cmdRewindBatchZk = &cobra.Command{
+	Use: "rewind_batch_zkevm",
+	Short: `Rewind the node to the end of a batch: unwind all stages, clean the hermez tables and truncate the datastream in one go.
+The node has to be stopped, the database is opened exclusively.  Nothing is committed unless the result passes the checks.
+Examples:
+rewind_batch_zkevm --datadir=/datadirs/hermez-mainnet --chain=hermez-mainnet --batch=100 --dry-run  # print what would change
+rewind_batch_zkevm --datadir=/datadirs/hermez-mainnet --chain=hermez-mainnet --batch=100 --dry-run --dry-run-tables=hermez_blockBatches --dry-run-keys
+rewind_batch_zkevm --datadir=/datadirs/hermez-mainnet --chain=hermez-mainnet --batch=100
+rewind_batch_zkevm --datadir=/datadirs/hermez-mainnet --chain=hermez-mainnet --batch=100 --datadir-compare=/datadirs/pre-synced-batch-100
+		`,
+	Example: "go run ./cmd/integration rewind_batch_zkevm --config=... --chain=dynamic-integration --datadir=... --batch=100",
+	Run: func(cmd *cobra.Command, args []string) {
+		ctx, _ := common.RootContext()
+		logger := debug.SetupCobra(cmd, "integration")
+
+		// an exclusive open fails while the node or any other process has the database open
+		db, err := dbCfg(kv.ChainDB, chaindata).Exclusive().Open(ctx)
+		if err != nil {
+			logger.Error("Opening DB exclusively, is the node stopped?", "error", err)
+			return
+		}
+		defer db.Close()
+
+		if err := rewindZk(ctx, db, logger); err != nil {
+			if !errors.Is(err, context.Canceled) {
+				log.Error(err.Error())
+			}
+			return
+		}
+
+		if dryRun || len(datadirCompare) == 0 {
+			return
+		}
+
+		dbCompare, err := openDB(dbCfg(kv.ChainDB, filepath.Join(datadirCompare, "chaindata")), false, logger)
+		if err != nil {
+			logger.Error("Opening DB", "error", err)
+			return
+		}
+		defer dbCompare.Close()
+
+		diff, err := compareDbs(db, dbCompare)
+		if err != nil {
+			log.Error(err.Error())
+			return
+		}
+		if len(diff) > 0 {
+			log.Error("Databases are different")
+			for _, d := range diff {
+				log.Error(d)
+			}
+			return
+		}
+		log.Info("Databases match")
+	},
+}
+
+func init() {
+	withConfig(cmdRewindBatchZk)
+	withChain(cmdRewindBatchZk)
+	withDataDir(cmdRewindBatchZk)
+	withDataDirCompare(cmdRewindBatchZk)
+	withRewindBatchNo(cmdRewindBatchZk)
+	withDryRun(cmdRewindBatchZk)
+	withForce(cmdRewindBatchZk)
+	rootCmd.AddCommand(cmdRewindBatchZk)
+}
+
+// rewindZk rewinds to the end of the batch set in the rewindBatchNo flag.  The database changes are only committed once
+// they are checked and the datastream is truncated, if the commit fails after that the node writes the missing
+// datastream entries again on startup.
+func rewindZk(ctx context.Context, db kv.RwDB, logger log.Logger) error {
+	chainId := fromdb.ChainConfig(db).ChainID.Uint64()
+	_, _, stateStages := newSyncZk(ctx, db)
+
+	stream, err := openDatastream(datadirCli)
+	if err != nil {
+		return fmt.Errorf("failed to open the datastream, is the node stopped? %w", err)
+	}
+
+	// the state before the rewind for the dry run to diff against
+	var before kv.Tx
+	if dryRun {
+		if before, err = db.BeginRo(ctx); err != nil {
+			return err
+		}
+		defer before.Rollback()
+	}
+
+	tx, err := db.BeginRw(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	tipBlock, err := checkRewind(tx, rewindBatchNo)
+	if err != nil {
+		return err
+	}
+
+	var tables []string
+	if dryRun {
+		if tables, err = existingTables(tx, dryRunTables); err != nil {
+			return err
+		}
+	}
+
+	logger.Info("Rewinding", "batch", rewindBatchNo, "block", tipBlock)
+	if err = unwindZkToBatch(db, tx, stateStages, rewindBatchNo); err != nil {
+		return err
+	}
+
+	// the datastream stage isn't unwound with the others, the sequencer resumes the stream from its progress
+	dataStreamProgress, err := stages.GetStageProgress(tx, stages.DataStream)
+	if err != nil {
+		return err
+	}
+	if dataStreamProgress > tipBlock {
+		if err = stages.SaveStageProgress(tx, stages.DataStream, tipBlock); err != nil {
+			return err
+		}
+	}
+
+	if err = cleanRewoundHermezDb(ctx, tx, tipBlock, logger); err != nil {
+		return err
+	}
+	if err = checkRewound(ctx, tx, rewindBatchNo, tipBlock); err != nil {
+		return err
+	}
+
+	if dryRun {
+		if err = printRewindDiff(before, tx, tables, dryRunKeys, logger); err != nil {
+			return err
+		}
+		if stream != nil {
+			return printDatastreamRewind(stream, chainId, rewindBatchNo, logger)
+		}
+		return nil
+	}
+
+	if stream != nil {
+		if err = rewindDatastream(stream, chainId, rewindBatchNo, tipBlock, logger); err != nil {
+			return err
+		}
+	}
+
+	if err = tx.Commit(); err != nil {
+		return err
+	}
+	logger.Info("Rewound", "batch", rewindBatchNo, "block", tipBlock)
+	return nil
+}
+
+// checkRewind returns the last block of the batch after checking the batch is a closed batch below the tip and, for a
+// sequencer, that no batch after it has been sequenced on the L1 already
+func checkRewind(tx kv.Tx, batchNo uint64) (uint64, error) {
+	hermezDb := hermez_db.NewHermezDbReader(tx)
+
+	tipBlock, found, err := hermezDb.GetHighestBlockInBatch(batchNo)
+	if err != nil {
+		return 0, err
+	}
+	if !found {
+		return 0, fmt.Errorf("no block found in batch %d", batchNo)
+	}
+
+	executed, err := stages.GetStageProgress(tx, stages.Execution)
+	if err != nil {
+		return 0, err
+	}
+	if executed <= tipBlock {
+		return 0, fmt.Errorf("batch %d ends at block %d, nothing to rewind with the tip at block %d", batchNo, tipBlock, executed)
+	}
+
+	if !sequencer.IsSequencer() {
+		return tipBlock, nil
+	}
+
+	// the batches after it would be sealed again differently to what the L1 has
+	sequence, err := hermezDb.GetLatestSequence()
+	if err != nil {
+		return 0, err
+	}
+	if sequence != nil && sequence.BatchNo > batchNo {
+		if !force {
+			return 0, fmt.Errorf("batch %d is sequenced on the L1 already, rewinding the sequencer below it needs --force", sequence.BatchNo)
+		}
+		log.Warn("Rewinding the sequencer below batches sequenced on the L1", "sequenced", sequence.BatchNo, "batch", batchNo)
+	}
+
+	return tipBlock, nil
+}
+
+// cleanRewoundHermezDb deletes the hermez entries the stages left beyond the new tip
+func cleanRewoundHermezDb(ctx context.Context, tx kv.RwTx, tipBlock uint64, logger log.Logger) error {
+	violations, err := consistency.Check(ctx, tx, tipBlock+1, tipBlock)
+	if err != nil {
+		return err
+	}
+	repaired, err := consistency.Repair(tx, violations)
+	if err != nil {
+		return err
+	}
+	if repaired > 0 {
+		logger.Info("Cleaned the hermez tables beyond the tip", "violations", repaired)
+	}
+	return nil
+}
+
+// checkRewound checks the stages are at or below the new tip and the hermez tables are consistent for the last batch
+func checkRewound(ctx context.Context, tx kv.Tx, batchNo, tipBlock uint64) error {
+	// the stages with their progress in blocks, the others are at batches or l1 blocks
+	blockStages := []stages.SyncStage{
+		stages.Execution,
+		stages.IntermediateHashes,
+		stages.HashState,
+		stages.AccountHistoryIndex,
+		stages.StorageHistoryIndex,
+		stages.CallTraces,
+		stages.LogIndex,
+		stages.TxLookup,
+		stages.DataStream,
+	}
+	if !sequencer.IsSequencer() {
+		blockStages = append(blockStages, stages.Senders, stages.BlockHashes, stages.Batches)
+	}
+	for _, stage := range blockStages {
+		progress, err := stages.GetStageProgress(tx, stage)
+		if err != nil {
+			return err
+		}
+		if progress > tipBlock {
+			return fmt.Errorf("stage %s is at block %d after the rewind to block %d", stage, progress, tipBlock)
+		}
+	}
+
+	head, err := consistency.HighestCanonicalBlock(tx)
+	if err != nil {
+		return err
+	}
+	if head != tipBlock {
+		return fmt.Errorf("highest canonical block is %d after the rewind to block %d", head, tipBlock)
+	}
+
+	firstBlock, _, err := hermez_db.NewHermezDbReader(tx).GetLowestBlockInBatch(batchNo)
+	if err != nil {
+		return err
+	}
+	violations, err := consistency.Check(ctx, tx, firstBlock, tipBlock)
+	if err != nil {
+		return err
+	}
+	for _, v := range violations {
+		log.Error("Hermez db violation after the rewind", "check", v.Check, "block", v.Block, "batch", v.Batch, "detail", v.Detail)
+	}
+	if len(violations) > 0 {
+		if !force {
+			return fmt.Errorf("%d violations in the hermez tables after the rewind, nothing is committed", len(violations))
+		}
+		log.Warn("Committing the rewind with violations in the hermez tables", "violations", len(violations))
+	}
+	return nil
+}
+
+// openDatastream opens the datastream file of the node in the data dir, nil if the node doesn't have one
+func openDatastream(dataDir string) (*datastreamer.StreamServer, error) {
+	file := filepath.Join(dataDir, "data-stream")
+	if _, err := os.Stat(file + ".bin"); err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	logConfig := &log2.Config{
+		Environment: "production",
+		Level:       "warn",
+		Outputs:     nil,
+	}
+	// the server is never started, the version is read from the header of the existing file
+	return datastreamer.NewServer(0, uint8(utils.DatastreamVersionFlag.Value), 1, datastreamer.StreamType(1), file, time.Second, time.Second, time.Second, logConfig)
+}
+
+// datastreamRewindEntry is the entry the datastream is truncated from, the start of the batch after the one rewound
+// to, false if the datastream doesn't reach that batch
+func datastreamRewindEntry(stream *datastreamer.StreamServer, chainId, batchNo uint64) (uint64, bool, error) {
+	srv := server.NewDataStreamServer(stream, chainId)
+	highestBatch, err := srv.GetHighestBatchNumber()
+	if err != nil {
+		return 0, false, err
+	}
+	if highestBatch <= batchNo {
+		return 0, false, nil
+	}
+
+	bookmark, err := types.NewBookmarkProto(batchNo+1, datastream.BookmarkType_BOOKMARK_TYPE_BATCH).Marshal()
+	if err != nil {
+		return 0, false, err
+	}
+	entryNum, err := stream.GetBookmark(bookmark)
+	if err != nil {
+		return 0, false, fmt.Errorf("failed to find the start of batch %d in the datastream: %w", batchNo+1, err)
+	}
+	return entryNum, true, nil
+}
+
+// rewindDatastream truncates the datastream to the end of the batch and checks it ends with the batch and its last block
+func rewindDatastream(stream *datastreamer.StreamServer, chainId, batchNo, tipBlock uint64, logger log.Logger) error {
+	entryNum, found, err := datastreamRewindEntry(stream, chainId, batchNo)
+	if err != nil || !found {
+		return err
+	}
+
+	if err = server.NewDataStreamServer(stream, chainId).UnwindToBatchStart(batchNo + 1); err != nil {
+		return err
+	}
+
+	// a new server so nothing cached from before the truncation is used
+	srv := server.NewDataStreamServer(stream, chainId)
+	highestBlock, err := srv.GetHighestBlockNumber()
+	if err != nil {
+		return err
+	}
+	closedBatch, err := srv.GetHighestClosedBatchNoCache()
+	if err != nil {
+		return err
+	}
+	if highestBlock != tipBlock || closedBatch != batchNo {
+		return fmt.Errorf("datastream ends at block %d and closed batch %d after the rewind to block %d and batch %d", highestBlock, closedBatch, tipBlock, batchNo)
+	}
+
+	logger.Info("Truncated the datastream", "fromEntry", entryNum)
+	return nil
+}
+
+func printDatastreamRewind(stream *datastreamer.StreamServer, chainId, batchNo uint64, logger log.Logger) error {
+	entryNum, found, err := datastreamRewindEntry(stream, chainId, batchNo)
+	if err != nil {
+		return err
+	}
+	if !found {
+		logger.Info("Datastream would not change, it doesn't reach past the batch", "batch", batchNo)
+		return nil
+	}
+	total := stream.GetHeader().TotalEntries
+	logger.Info("Datastream would be truncated", "fromEntry", entryNum, "entries", total-entryNum)
+	return nil
+}
+
+// existingTables returns the chaindata tables in the database, only the ones of the filter if it is not empty
+func existingTables(tx kv.RwTx, filter []string) ([]string, error) {
+	for _, table := range filter {
+		if _, ok := kv.ChaindataTablesCfg[table]; !ok {
+			return nil, fmt.Errorf("unknown table %s", table)
+		}
+	}
+	if len(filter) == 0 {
+		filter = kv.ChaindataTables
+	}
+	tables := make([]string, 0, len(filter))
+	for _, table := range filter {
+		exists, err := tx.ExistsBucket(table)
+		if err != nil {
+			return nil, err
+		}
+		if exists {
+			tables = append(tables, table)
+		}
+	}
+	return tables, nil
+}
+
+// printRewindDiff prints how many entries of each table are different after the rewind, and with printKeys the key of
+// every one of them
+func printRewindDiff(before, after kv.Tx, tables []string, printKeys bool, logger log.Logger) error {
+	changedTables := 0
+	for _, table := range tables {
+		removed, added, changed := 0, 0, 0
+		err := diffTable(before, after, table, func(op string, k []byte) {
+			switch op {
+			case "removed":
+				removed++
+			case "added":
+				added++
+			case "changed":
+				changed++
+			}
+			if printKeys {
+				fmt.Printf("%s\t%s\t%x\n", table, op, k)
+			}
+		})
+		if err != nil {
+			return fmt.Errorf("failed to diff table %s: %w", table, err)
+		}
+		if removed+added+changed > 0 {
+			changedTables++
+			logger.Info("Table would change", "table", table, "removed", removed, "added", added, "changed", changed)
+		}
+	}
+	logger.Info("Dry run complete, nothing is changed", "tables", changedTables)
+	return nil
+}
+
+// diffTable walks both versions of the table in key order and reports the keys only in one of them and, for tables
+// with one value per key, the keys with a different value.  Each value of a dup sorted table is an entry of its own.
+func diffTable(before, after kv.Tx, table string, report func(op string, k []byte)) error {
+	dupSort := kv.ChaindataTablesCfg[table].Flags&kv.DupSort != 0
+
+	c1, err := before.Cursor(table)
+	if err != nil {
+		return err
+	}
+	defer c1.Close()
+	c2, err := after.Cursor(table)
+	if err != nil {
+		return err
+	}
+	defer c2.Close()
+
+	k1, v1, err := c1.First()
+	if err != nil {
+		return err
+	}
+	k2, v2, err := c2.First()
+	if err != nil {
+		return err
+	}
+
+	for k1 != nil || k2 != nil {
+		cmp := 0
+		switch {
+		case k1 == nil:
+			cmp = 1
+		case k2 == nil:
+			cmp = -1
+		default:
+			if cmp = bytes.Compare(k1, k2); cmp == 0 && dupSort {
+				cmp = bytes.Compare(v1, v2)
+			}
+		}
+
+		advance1, advance2 := cmp <= 0, cmp >= 0
+		switch {
+		case cmp < 0:
+			report("removed", k1)
+		case cmp > 0:
+			report("added", k2)
+		case !bytes.Equal(v1, v2):
+			report("changed", k1)
+		}
+
+		if advance1 {
+			if k1, v1, err = c1.Next(); err != nil {
+				return err
+			}
+		}
+		if advance2 {
+			if k2, v2, err = c2.Next(); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
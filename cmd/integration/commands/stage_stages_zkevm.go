@@ -9,6 +9,7 @@ import (
 	common2 "github.com/ledgerwatch/erigon-lib/common"
 	"github.com/ledgerwatch/erigon-lib/kv"
 	"github.com/ledgerwatch/erigon-lib/wrap"
+	"github.com/ledgerwatch/erigon/eth/stagedsync"
 	"github.com/ledgerwatch/erigon/eth/stagedsync/stages"
 	smtdb "github.com/ledgerwatch/erigon/smt/pkg/db"
 	"github.com/ledgerwatch/erigon/turbo/debug"
@@ -86,31 +87,34 @@ func unwindZk(ctx context.Context, db kv.RwDB) error {
 	}
 	defer tx.Rollback()
 
-	if err := hermez_db.CreateHermezBuckets(tx); err != nil {
+	if err := unwindZkToBatch(db, tx, stateStages, unwindBatchNo); err != nil {
 		return err
 	}
 
-	if err := smtdb.CreateEriDbBuckets(tx); err != nil {
+	if err := tx.Commit(); err != nil {
 		return err
 	}
 
-	stateStages.DisableStages(stages.Snapshots)
+	return nil
+}
 
-	err = stateStages.UnwindToBatch(unwindBatchNo, tx)
-	if err != nil {
+// unwindZkToBatch runs the unwind of all stages in the transaction so the tip is the highest block of the batch
+func unwindZkToBatch(db kv.RwDB, tx kv.RwTx, stateStages *stagedsync.Sync, batchNo uint64) error {
+	if err := hermez_db.CreateHermezBuckets(tx); err != nil {
 		return err
 	}
 
-	err = stateStages.RunUnwind(db, wrap.TxContainer{Tx: tx})
-	if err != nil {
+	if err := smtdb.CreateEriDbBuckets(tx); err != nil {
 		return err
 	}
 
-	if err := tx.Commit(); err != nil {
+	stateStages.DisableStages(stages.Snapshots)
+
+	if err := stateStages.UnwindToBatch(batchNo, tx); err != nil {
 		return err
 	}
 
-	return nil
+	return stateStages.RunUnwind(db, wrap.TxContainer{Tx: tx})
 }
 
 func compareDbs(db1, db2 kv.RwDB) ([]string, error) {
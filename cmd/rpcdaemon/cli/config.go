@@ -69,6 +69,7 @@ import (
 	"github.com/ledgerwatch/erigon/turbo/rpchelper"
 	"github.com/ledgerwatch/erigon/turbo/services"
 	"github.com/ledgerwatch/erigon/turbo/snapshotsync/freezeblocks"
+	"github.com/ledgerwatch/erigon/zk/rpc_ratelimit"
 
 	// Force-load native and js packages, to trigger registration
 	_ "github.com/ledgerwatch/erigon/eth/tracers/js"
@@ -153,6 +154,7 @@ func RootCommand() (*cobra.Command, *httpcfg.HttpCfg) {
 	rootCmd.PersistentFlags().IntVar(&cfg.WebsocketSubscribeLogsChannelSize, utils.WSSubscribeLogsChannelSize.Name, utils.WSSubscribeLogsChannelSize.Value, utils.WSSubscribeLogsChannelSize.Usage)
 
 	rootCmd.PersistentFlags().StringVar(&cfg.L2RpcUrl, utils.L2RpcUrlFlag.Name, utils.L2RpcUrlFlag.Value, utils.L2RpcUrlFlag.Usage)
+	rootCmd.PersistentFlags().StringVar(&cfg.RpcRateLimitConfig, utils.RpcRateLimitConfigFlag.Name, utils.RpcRateLimitConfigFlag.Value, utils.RpcRateLimitConfigFlag.Usage)
 
 	if err := rootCmd.MarkPersistentFlagFilename("rpc.accessList", "json"); err != nil {
 		panic(err)
@@ -583,6 +585,15 @@ func startRegularRpcServer(ctx context.Context, cfg *httpcfg.HttpCfg, rpcAPI []r
 
 	srv.SetBatchLimit(cfg.BatchLimit)
 
+	// the http and ws servers share the limiter so a client is counted once whichever it calls
+	rateLimiter, err := rpc_ratelimit.Load(cfg.RpcRateLimitConfig)
+	if err != nil {
+		return err
+	}
+	if rateLimiter != nil {
+		srv.SetRateLimiter(rateLimiter)
+	}
+
 	defer srv.Stop()
 
 	var defaultAPIList []rpc.API
@@ -743,6 +754,9 @@ func startRegularRpcServer(ctx context.Context, cfg *httpcfg.HttpCfg, rpcAPI []r
 		wsSrv.SetAllowList(allowListForRPC)
 
 		wsSrv.SetBatchLimit(cfg.BatchLimit)
+		if rateLimiter != nil {
+			wsSrv.SetRateLimiter(rateLimiter)
+		}
 
 		var defaultAPIList []rpc.API
 
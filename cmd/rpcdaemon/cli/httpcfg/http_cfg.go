@@ -99,4 +99,5 @@ type HttpCfg struct {
 	DataStreamInactivityTimeout       time.Duration
 	DataStreamInactivityCheckInterval time.Duration
 	L2RpcUrl                          string
+	RpcRateLimitConfig                string
 }
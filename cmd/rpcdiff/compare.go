@@ -0,0 +1,229 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Difference is a value that is not the same in the results of the reference and the target.  The path is the dot
+// separated keys and indexes leading to the value, empty for the whole result.  A missing value is null.
+type Difference struct {
+	Path      string      `json:"path"`
+	Reference interface{} `json:"reference"`
+	Target    interface{} `json:"target"`
+}
+
+// Comparator returns the differences between the normalised results of a method on the reference and the target
+type Comparator func(reference, target interface{}) []Difference
+
+var comparators = map[string]Comparator{}
+
+// RegisterComparator replaces the comparison of the results of a method, by default every difference counts
+func RegisterComparator(method string, comparator Comparator) {
+	comparators[method] = comparator
+}
+
+func comparatorFor(method string) Comparator {
+	if comparator, ok := comparators[method]; ok {
+		return comparator
+	}
+	return Diff
+}
+
+// Rules are the known benign differences in the results of a method, paths match a difference at or below them and
+// a * in a path matches any key or index
+type Rules struct {
+	// Ignore are the paths whose differences don't matter
+	Ignore []string
+	// Lagging are the paths only set once a node synced further, e.g. the L1 transactions of a batch, a difference
+	// where one of the nodes hasn't set them yet doesn't matter
+	Lagging []string
+}
+
+func (r Rules) Comparator() Comparator {
+	return func(reference, target interface{}) []Difference {
+		return r.filter(Diff(reference, target))
+	}
+}
+
+func (r Rules) filter(differences []Difference) []Difference {
+	var kept []Difference
+	for _, d := range differences {
+		if matchesAny(r.Ignore, d.Path) {
+			continue
+		}
+		if (d.Reference == nil || d.Target == nil) && matchesAny(r.Lagging, d.Path) {
+			continue
+		}
+		kept = append(kept, d)
+	}
+	return kept
+}
+
+func matchesAny(patterns []string, path string) bool {
+	for _, pattern := range patterns {
+		if matchPath(pattern, path) {
+			return true
+		}
+	}
+	return false
+}
+
+func matchPath(pattern, path string) bool {
+	if pattern == "" {
+		return true
+	}
+	if path == "" {
+		return false
+	}
+	patternKeys, pathKeys := strings.Split(pattern, "."), strings.Split(path, ".")
+	if len(patternKeys) > len(pathKeys) {
+		return false
+	}
+	for i, key := range patternKeys {
+		if key != "*" && key != pathKeys[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// ignoreProgress compares methods returning how far a node synced, which differ whenever the nodes aren't idle
+func ignoreProgress(_, _ interface{}) []Difference {
+	return nil
+}
+
+func init() {
+	for _, method := range []string{
+		"eth_blockNumber",
+		"eth_gasPrice",
+		"zkevm_batchNumber",
+		"zkevm_virtualBatchNumber",
+		"zkevm_verifiedBatchNumber",
+		"zkevm_consolidatedBlockNumber",
+		"zkevm_getLatestGlobalExitRoot",
+	} {
+		RegisterComparator(method, ignoreProgress)
+	}
+
+	// batch timestamps differ between node implementations, see zk/debug_tools/rpc-batch-compare
+	RegisterComparator("zkevm_getBatchByNumber", Rules{
+		Ignore:  []string{"timestamp"},
+		Lagging: []string{"sendSequencesTxHash", "verifyBatchTxHash"},
+	}.Comparator())
+
+	// the status is the latest transition, which depends on how far each node synced the L1
+	RegisterComparator("zkevm_getBatchStatus", Rules{
+		Ignore:  []string{"status"},
+		Lagging: []string{"virtual", "verified", "finalized"},
+	}.Comparator())
+	RegisterComparator("zkevm_getBatchStatusRange", Rules{
+		Ignore:  []string{"*.status"},
+		Lagging: []string{"*"},
+	}.Comparator())
+
+	// the table grows with the L1 info tree updates each node synced
+	RegisterComparator("zkevm_getExitRootTable", Rules{Lagging: []string{"*"}}.Comparator())
+}
+
+// normalise decodes a result, dropping the differences in encoding nodes are free to make: the case of hex strings
+// and null fields against missing ones
+func normalise(raw json.RawMessage) (interface{}, error) {
+	if len(raw) == 0 {
+		return nil, nil
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(raw))
+	decoder.UseNumber()
+	var value interface{}
+	if err := decoder.Decode(&value); err != nil {
+		return nil, err
+	}
+	return normaliseValue(value), nil
+}
+
+func normaliseValue(value interface{}) interface{} {
+	switch value := value.(type) {
+	case string:
+		if strings.HasPrefix(value, "0x") || strings.HasPrefix(value, "0X") {
+			return strings.ToLower(value)
+		}
+	case map[string]interface{}:
+		for key, field := range value {
+			if field == nil {
+				delete(value, key)
+				continue
+			}
+			value[key] = normaliseValue(field)
+		}
+	case []interface{}:
+		for i := range value {
+			value[i] = normaliseValue(value[i])
+		}
+	}
+	return value
+}
+
+// Diff returns every difference between two normalised results, in the order of their paths
+func Diff(reference, target interface{}) []Difference {
+	return diff("", reference, target, nil)
+}
+
+func diff(path string, reference, target interface{}, differences []Difference) []Difference {
+	switch reference := reference.(type) {
+	case map[string]interface{}:
+		targetMap, ok := target.(map[string]interface{})
+		if !ok {
+			return append(differences, Difference{Path: path, Reference: reference, Target: target})
+		}
+
+		keys := make([]string, 0, len(reference)+len(targetMap))
+		for key := range reference {
+			keys = append(keys, key)
+		}
+		for key := range targetMap {
+			if _, ok := reference[key]; !ok {
+				keys = append(keys, key)
+			}
+		}
+		sort.Strings(keys)
+
+		for _, key := range keys {
+			differences = diff(joinPath(path, key), reference[key], targetMap[key], differences)
+		}
+		return differences
+	case []interface{}:
+		targetSlice, ok := target.([]interface{})
+		if !ok {
+			return append(differences, Difference{Path: path, Reference: reference, Target: target})
+		}
+
+		for i := 0; i < len(reference) || i < len(targetSlice); i++ {
+			var referenceItem, targetItem interface{}
+			if i < len(reference) {
+				referenceItem = reference[i]
+			}
+			if i < len(targetSlice) {
+				targetItem = targetSlice[i]
+			}
+			differences = diff(joinPath(path, strconv.Itoa(i)), referenceItem, targetItem, differences)
+		}
+		return differences
+	default:
+		// a map or slice target has another type than the reference, so this never compares them
+		if reference != target {
+			differences = append(differences, Difference{Path: path, Reference: reference, Target: target})
+		}
+		return differences
+	}
+}
+
+func joinPath(path, key string) string {
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+type testRpcError struct {
+	code int
+}
+
+func (e testRpcError) Error() string  { return "failed" }
+func (e testRpcError) ErrorCode() int { return e.code }
+
+// testNode answers every method with a fixed result or error
+type testNode struct {
+	results map[string]string
+	errors  map[string]error
+}
+
+func (n *testNode) CallContext(_ context.Context, result interface{}, method string, _ ...interface{}) error {
+	if err, ok := n.errors[method]; ok {
+		return err
+	}
+	return json.Unmarshal([]byte(n.results[method]), result)
+}
+
+func mustNormalise(t *testing.T, raw string) interface{} {
+	t.Helper()
+	value, err := normalise(json.RawMessage(raw))
+	require.NoError(t, err)
+	return value
+}
+
+func TestDiff(t *testing.T) {
+	reference := mustNormalise(t, `{"hash":"0xABCD","number":"0x1","extra":null,"txs":[{"gas":"0x5"},{"gas":"0x6"}]}`)
+	target := mustNormalise(t, `{"hash":"0xabcd","number":"0x1","txs":[{"gas":"0x5"},{"gas":"0x7"},{"gas":"0x8"}]}`)
+
+	require.Equal(t, []Difference{
+		{Path: "txs.1.gas", Reference: "0x6", Target: "0x7"},
+		{Path: "txs.2", Target: map[string]interface{}{"gas": "0x8"}},
+	}, Diff(reference, target))
+
+	require.Empty(t, Rules{Ignore: []string{"txs.*.gas"}, Lagging: []string{"txs"}}.filter(Diff(reference, target)))
+	require.Len(t, Rules{Lagging: []string{"txs.*.gas"}}.filter(Diff(reference, target)), 2)
+
+	require.Equal(t, []Difference{{Reference: json.Number("1"), Target: "1"}}, Diff(mustNormalise(t, `1`), mustNormalise(t, `"1"`)))
+	require.Empty(t, Diff(mustNormalise(t, `null`), mustNormalise(t, ``)))
+}
+
+func TestZkevmComparators(t *testing.T) {
+	compare := comparatorFor("zkevm_getBatchByNumber")
+	reference := mustNormalise(t, `{"number":"0x2","timestamp":"0x10","verifyBatchTxHash":"0x01","stateRoot":"0xaa"}`)
+
+	require.Empty(t, compare(reference, mustNormalise(t, `{"number":"0x2","timestamp":"0x11","verifyBatchTxHash":null,"stateRoot":"0xaa"}`)))
+	require.Equal(t, []Difference{{Path: "verifyBatchTxHash", Reference: "0x01", Target: "0x02"}},
+		compare(reference, mustNormalise(t, `{"number":"0x2","timestamp":"0x10","verifyBatchTxHash":"0x02","stateRoot":"0xaa"}`)))
+
+	require.Empty(t, comparatorFor("zkevm_batchNumber")(mustNormalise(t, `"0x1"`), mustNormalise(t, `"0x2"`)))
+	require.Len(t, comparatorFor("eth_getBlockByNumber")(mustNormalise(t, `{"a":"0x1"}`), mustNormalise(t, `{"a":"0x2"}`)), 1)
+}
+
+func TestCompareAll(t *testing.T) {
+	reference := &testNode{
+		results: map[string]string{"eth_getBlockByNumber": `{"hash":"0x1"}`, "eth_chainId": `"0x1"`, "eth_getBlockReceipts": `[]`},
+		errors:  map[string]error{"zkevm_getBatchByNumber": testRpcError{code: -32000}, "debug_traceBlockByNumber": testRpcError{code: -32000}},
+	}
+	target := &testNode{
+		results: map[string]string{"eth_getBlockByNumber": `{"hash":"0x2"}`, "zkevm_getBatchByNumber": `{}`, "eth_chainId": `"0x1"`},
+		errors:  map[string]error{"debug_traceBlockByNumber": testRpcError{code: -32000}, "eth_getBlockReceipts": errors.New("connection refused")},
+	}
+
+	requests := []*Request{
+		{Method: "eth_chainId"},
+		{Method: "eth_getBlockByNumber", Params: []interface{}{"0x1", true}},
+		{Method: "zkevm_getBatchByNumber"},
+		{Method: "debug_traceBlockByNumber"},
+		{Method: "eth_getBlockReceipts"},
+	}
+	report, err := compareAll(context.Background(), reference, target, requests, 2, parseIgnore(nil))
+	require.NoError(t, err)
+	require.Equal(t, 5, report.Requests)
+	require.Equal(t, 2, report.Matches)
+	require.Equal(t, 2, report.Mismatches)
+	require.Equal(t, 1, report.Errors)
+	require.Len(t, report.Results, 3)
+	require.Equal(t, "eth_getBlockByNumber", report.Results[0].Method)
+	require.Equal(t, []Difference{{Path: "hash", Reference: "0x1", Target: "0x2"}}, report.Results[0].Differences)
+	require.Equal(t, "error", report.Results[1].Differences[0].Path)
+	require.Equal(t, "target: connection refused", report.Results[2].Error)
+	require.Equal(t, 1, report.Methods["eth_getBlockReceipts"].Errors)
+
+	report, err = compareAll(context.Background(), reference, target, requests[:2], 1, parseIgnore([]string{"eth_getBlockByNumber:hash"}))
+	require.NoError(t, err)
+	require.Equal(t, 2, report.Matches)
+}
+
+func TestRequests(t *testing.T) {
+	r, err := parseRange("10-14")
+	require.NoError(t, err)
+	requests := rangeRequests([]string{"eth_getBlockByNumber"}, blockMethods, r, 2)
+	require.Len(t, requests, 3)
+	require.Equal(t, "0xe", requests[2].Params[0].(interface{ String() string }).String())
+
+	r, err = parseRange("10-")
+	require.NoError(t, err)
+	require.True(t, r.openEnd)
+	require.NoError(t, closeRange(context.Background(), r, "eth_blockNumber",
+		&testNode{results: map[string]string{"eth_blockNumber": `"0x20"`}}, &testNode{results: map[string]string{"eth_blockNumber": `"0x18"`}}))
+	require.Equal(t, uint64(0x18), r.to)
+
+	_, err = parseRange("20-10")
+	require.Error(t, err)
+
+	blockList, batchList, others := splitMethods([]string{"zkevm_getBatchByNumber", "eth_getBlockReceipts", "eth_call"})
+	require.Equal(t, []string{"eth_getBlockReceipts"}, blockList)
+	require.Equal(t, []string{"zkevm_getBatchByNumber"}, batchList)
+	require.Equal(t, []string{"eth_call"}, others)
+
+	path := filepath.Join(t.TempDir(), "requests.jsonl")
+	require.NoError(t, os.WriteFile(path, []byte(`{"jsonrpc":"2.0","id":1,"method":"eth_chainId"}
+
+{"jsonrpc":"2.0","id":2,"method":"eth_call","params":[{"to":"0x1"},"latest"]}
+`), 0600))
+	corpusRequests, err := readCorpus(path, []string{"eth_call"})
+	require.NoError(t, err)
+	require.Len(t, corpusRequests, 1)
+	require.Len(t, corpusRequests[0].Params, 2)
+}
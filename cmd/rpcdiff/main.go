@@ -0,0 +1,239 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+
+	"github.com/ledgerwatch/erigon-lib/common/hexutil"
+	"github.com/ledgerwatch/log/v3"
+	"github.com/urfave/cli/v2"
+
+	"github.com/ledgerwatch/erigon/params"
+	"github.com/ledgerwatch/erigon/rpc"
+)
+
+var (
+	referenceUrl string
+	targetUrl    string
+	methods      string
+	blocks       string
+	batches      string
+	step         uint64
+	corpus       string
+	ignore       cli.StringSlice
+	workers      int
+	output       string
+)
+
+func main() {
+	log.Root().SetHandler(log.LvlFilterHandler(log.LvlInfo, log.StderrHandler))
+
+	app := cli.NewApp()
+	app.Name = "rpcdiff"
+	app.Version = params.VersionWithCommit(params.GitCommit)
+	app.Usage = "Compare the JSON-RPC results of a target node with a reference node"
+	app.UsageText = app.Name + ` --reference URL --target URL [--blocks RANGE] [--batches RANGE] [--corpus FILE] [flags]`
+	app.Flags = []cli.Flag{
+		&cli.StringFlag{
+			Name:        "reference",
+			Usage:       "RPC URL of the reference node",
+			Required:    true,
+			Destination: &referenceUrl,
+		},
+		&cli.StringFlag{
+			Name:        "target",
+			Usage:       "RPC URL of the node compared with the reference",
+			Required:    true,
+			Destination: &targetUrl,
+		},
+		&cli.StringFlag{
+			Name:        "methods",
+			Usage:       "Comma separated methods to compare, by default " + strings.Join(defaultMethods, ",") + " over the ranges and every method of the corpus",
+			Destination: &methods,
+		},
+		&cli.StringFlag{
+			Name:        "blocks",
+			Usage:       "Blocks to call the block methods for: 100, 100-200, or 100- to the lowest head of both nodes",
+			Destination: &blocks,
+		},
+		&cli.StringFlag{
+			Name:        "batches",
+			Usage:       "Batches to call the batch methods for: 100, 100-200, or 100- to the lowest head of both nodes",
+			Destination: &batches,
+		},
+		&cli.Uint64Flag{
+			Name:        "step",
+			Usage:       "Only call every step-th block and batch of the ranges",
+			Value:       1,
+			Destination: &step,
+		},
+		&cli.StringFlag{
+			Name:        "corpus",
+			Usage:       "File of recorded JSON-RPC requests to replay, one per line",
+			Destination: &corpus,
+		},
+		&cli.StringSliceFlag{
+			Name:        "ignore",
+			Usage:       "Differences to ignore as method:path, or path for every method, e.g. eth_getBlockByNumber:transactions.*.yParity",
+			Destination: &ignore,
+		},
+		&cli.IntFlag{
+			Name:        "workers",
+			Usage:       "Requests made to both nodes at the same time",
+			Value:       4,
+			Destination: &workers,
+		},
+		&cli.StringFlag{
+			Name:        "output",
+			Usage:       "File to write the JSON report to, stdout by default",
+			Destination: &output,
+		},
+	}
+	app.Before = func(cliCtx *cli.Context) error {
+		var cancel context.CancelFunc
+		cliCtx.Context, cancel = context.WithCancel(context.Background())
+		go handleTerminationSignals(cancel)
+		return nil
+	}
+	app.Action = run
+
+	if err := app.Run(os.Args); err != nil {
+		_, _ = fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+func run(cliCtx *cli.Context) error {
+	ctx := cliCtx.Context
+
+	blockRange, err := parseRange(blocks)
+	if err != nil {
+		return err
+	}
+	batchRange, err := parseRange(batches)
+	if err != nil {
+		return err
+	}
+	if blockRange == nil && batchRange == nil && corpus == "" {
+		return fmt.Errorf("nothing to compare, give --blocks, --batches or --corpus")
+	}
+	if step == 0 {
+		return fmt.Errorf("--step must be positive")
+	}
+
+	var methodList []string
+	if methods != "" {
+		for _, method := range strings.Split(methods, ",") {
+			methodList = append(methodList, strings.TrimSpace(method))
+		}
+	}
+
+	reference, err := rpc.DialContext(ctx, referenceUrl, log.Root())
+	if err != nil {
+		return fmt.Errorf("reference: %w", err)
+	}
+	defer reference.Close()
+	target, err := rpc.DialContext(ctx, targetUrl, log.Root())
+	if err != nil {
+		return fmt.Errorf("target: %w", err)
+	}
+	defer target.Close()
+
+	var requests []*Request
+	if corpus != "" {
+		if requests, err = readCorpus(corpus, methodList); err != nil {
+			return err
+		}
+	}
+
+	rangeMethods := methodList
+	if len(rangeMethods) == 0 {
+		rangeMethods = defaultMethods
+	}
+	blockMethodList, batchMethodList, others := splitMethods(rangeMethods)
+	if len(others) > 0 && corpus == "" {
+		return fmt.Errorf("%s can't be called over a range of blocks or batches, use a corpus, the range methods are %s", strings.Join(others, ", "), strings.Join(rangeMethodNames(), ", "))
+	}
+	if blockRange != nil {
+		if err := closeRange(ctx, blockRange, "eth_blockNumber", reference, target); err != nil {
+			return err
+		}
+		requests = append(requests, rangeRequests(blockMethodList, blockMethods, blockRange, step)...)
+	}
+	if batchRange != nil {
+		if err := closeRange(ctx, batchRange, "zkevm_batchNumber", reference, target); err != nil {
+			return err
+		}
+		requests = append(requests, rangeRequests(batchMethodList, batchMethods, batchRange, step)...)
+	}
+
+	log.Info("[rpcdiff] Starting", "reference", referenceUrl, "target", targetUrl, "requests", len(requests))
+
+	report, err := compareAll(ctx, reference, target, requests, workers, parseIgnore(ignore.Value()))
+	if err != nil {
+		return err
+	}
+	report.Reference, report.Target = referenceUrl, targetUrl
+
+	if err := writeReport(report); err != nil {
+		return err
+	}
+
+	log.Info("[rpcdiff] Finished", "requests", report.Requests, "matches", report.Matches, "mismatches", report.Mismatches, "errors", report.Errors)
+	if report.Mismatches > 0 || report.Errors > 0 {
+		return cli.Exit(fmt.Sprintf("%d mismatches and %d errors", report.Mismatches, report.Errors), 1)
+	}
+	return nil
+}
+
+// closeRange ends an open ended range at the lowest head of both nodes
+func closeRange(ctx context.Context, r *blockRange, headMethod string, reference, target caller) error {
+	if !r.openEnd {
+		return nil
+	}
+
+	var referenceHead, targetHead hexutil.Uint64
+	if err := reference.CallContext(ctx, &referenceHead, headMethod); err != nil {
+		return fmt.Errorf("reference %s: %w", headMethod, err)
+	}
+	if err := target.CallContext(ctx, &targetHead, headMethod); err != nil {
+		return fmt.Errorf("target %s: %w", headMethod, err)
+	}
+
+	r.to = uint64(min(referenceHead, targetHead))
+	if r.to < r.from {
+		return fmt.Errorf("%s: the nodes are at %d and %d, before the start of the range %d", headMethod, referenceHead, targetHead, r.from)
+	}
+	r.openEnd = false
+	return nil
+}
+
+func writeReport(report *Report) error {
+	out := os.Stdout
+	if output != "" {
+		file, err := os.Create(output)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		out = file
+	}
+
+	encoder := json.NewEncoder(out)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(report)
+}
+
+// handleTerminationSignals handles termination signals
+func handleTerminationSignals(stopFunc func()) {
+	signalCh := make(chan os.Signal, 1)
+	signal.Notify(signalCh, syscall.SIGTERM, syscall.SIGINT)
+	<-signalCh
+	log.Info("[rpcdiff] Stopping")
+	stopFunc()
+}
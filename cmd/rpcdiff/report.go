@@ -0,0 +1,187 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ledgerwatch/log/v3"
+
+	"github.com/ledgerwatch/erigon/rpc"
+)
+
+// caller is a JSON-RPC client of a node
+type caller interface {
+	CallContext(ctx context.Context, result interface{}, method string, args ...interface{}) error
+}
+
+// Result is a request whose results differ between the nodes, or that failed on one of them
+type Result struct {
+	Method      string        `json:"method"`
+	Params      []interface{} `json:"params"`
+	Differences []Difference  `json:"differences,omitempty"`
+	Error       string        `json:"error,omitempty"`
+}
+
+type MethodSummary struct {
+	Requests   int `json:"requests"`
+	Mismatches int `json:"mismatches"`
+	Errors     int `json:"errors"`
+}
+
+// Report is the outcome of a run, results only holds the requests that didn't match in the order they were made
+type Report struct {
+	Reference  string                    `json:"reference"`
+	Target     string                    `json:"target"`
+	StartedAt  time.Time                 `json:"startedAt"`
+	FinishedAt time.Time                 `json:"finishedAt"`
+	Requests   int                       `json:"requests"`
+	Matches    int                       `json:"matches"`
+	Mismatches int                       `json:"mismatches"`
+	Errors     int                       `json:"errors"`
+	Methods    map[string]*MethodSummary `json:"methods"`
+	Results    []*Result                 `json:"results"`
+}
+
+// parseIgnore reads paths to ignore written as method:path, or as a path ignored for every method
+func parseIgnore(values []string) map[string]Rules {
+	ignore := map[string]Rules{}
+	for _, value := range values {
+		method, path, found := strings.Cut(value, ":")
+		if !found {
+			method, path = "", value
+		}
+		rules := ignore[method]
+		rules.Ignore = append(rules.Ignore, path)
+		ignore[method] = rules
+	}
+	return ignore
+}
+
+// compareAll makes every request to both nodes with a number of workers and reports where they differ
+func compareAll(ctx context.Context, reference, target caller, requests []*Request, workers int, ignore map[string]Rules) (*Report, error) {
+	report := &Report{StartedAt: time.Now().UTC(), Methods: map[string]*MethodSummary{}}
+
+	results := make([]*Result, len(requests))
+	indexes := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < max(workers, 1); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range indexes {
+				results[i] = compareRequest(ctx, reference, target, requests[i], ignore)
+			}
+		}()
+	}
+
+	logEvery := time.NewTicker(30 * time.Second)
+	defer logEvery.Stop()
+
+LOOP:
+	for i := range requests {
+		select {
+		case <-logEvery.C:
+			log.Info("[rpcdiff] Comparing", "request", i, "of", len(requests))
+		default:
+		}
+
+		select {
+		case <-ctx.Done():
+			break LOOP
+		case indexes <- i:
+		}
+	}
+	close(indexes)
+	wg.Wait()
+
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	for i, request := range requests {
+		summary, ok := report.Methods[request.Method]
+		if !ok {
+			summary = &MethodSummary{}
+			report.Methods[request.Method] = summary
+		}
+		report.Requests++
+		summary.Requests++
+
+		result := results[i]
+		switch {
+		case result == nil:
+			report.Matches++
+		case result.Error != "":
+			report.Errors++
+			summary.Errors++
+			report.Results = append(report.Results, result)
+		default:
+			report.Mismatches++
+			summary.Mismatches++
+			report.Results = append(report.Results, result)
+		}
+	}
+	report.FinishedAt = time.Now().UTC()
+
+	return report, nil
+}
+
+// compareRequest returns nil if both nodes return the same, and the differences or the error otherwise.  Both nodes
+// failing the request with the same error code is the same.
+func compareRequest(ctx context.Context, reference, target caller, request *Request, ignore map[string]Rules) *Result {
+	var referenceRaw, targetRaw json.RawMessage
+	referenceErr := reference.CallContext(ctx, &referenceRaw, request.Method, request.Params...)
+	targetErr := target.CallContext(ctx, &targetRaw, request.Method, request.Params...)
+
+	result := &Result{Method: request.Method, Params: request.Params}
+
+	var referenceRpcErr, targetRpcErr rpc.Error
+	referenceFailed := errors.As(referenceErr, &referenceRpcErr)
+	targetFailed := errors.As(targetErr, &targetRpcErr)
+	switch {
+	case referenceErr != nil && !referenceFailed:
+		result.Error = fmt.Sprintf("reference: %v", referenceErr)
+		return result
+	case targetErr != nil && !targetFailed:
+		result.Error = fmt.Sprintf("target: %v", targetErr)
+		return result
+	case referenceFailed && targetFailed:
+		if referenceRpcErr.ErrorCode() == targetRpcErr.ErrorCode() {
+			return nil
+		}
+		result.Differences = []Difference{{Path: "error", Reference: referenceErr.Error(), Target: targetErr.Error()}}
+		return result
+	case referenceFailed:
+		result.Differences = []Difference{{Path: "error", Reference: referenceErr.Error()}}
+		return result
+	case targetFailed:
+		result.Differences = []Difference{{Path: "error", Target: targetErr.Error()}}
+		return result
+	}
+
+	referenceResult, err := normalise(referenceRaw)
+	if err != nil {
+		result.Error = fmt.Sprintf("reference: %v", err)
+		return result
+	}
+	targetResult, err := normalise(targetRaw)
+	if err != nil {
+		result.Error = fmt.Sprintf("target: %v", err)
+		return result
+	}
+
+	differences := comparatorFor(request.Method)(referenceResult, targetResult)
+	differences = ignore[""].filter(differences)
+	differences = ignore[request.Method].filter(differences)
+	if len(differences) == 0 {
+		return nil
+	}
+
+	result.Differences = differences
+	return result
+}
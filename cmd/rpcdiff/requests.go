@@ -0,0 +1,163 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/ledgerwatch/erigon-lib/common/hexutil"
+)
+
+// Request is a call made to both nodes, read from a corpus of JSON-RPC requests or generated over a range
+type Request struct {
+	Method string        `json:"method"`
+	Params []interface{} `json:"params"`
+}
+
+// the methods that can be called over a range of blocks or batches with the params of each block or batch
+var (
+	blockMethods = map[string]func(blockNo uint64) []interface{}{
+		"eth_getBlockByNumber":           func(n uint64) []interface{} { return []interface{}{hexutil.Uint64(n), true} },
+		"eth_getBlockReceipts":           func(n uint64) []interface{} { return []interface{}{hexutil.Uint64(n)} },
+		"debug_traceBlockByNumber":       func(n uint64) []interface{} { return []interface{}{hexutil.Uint64(n)} },
+		"zkevm_getFullBlockByNumber":     func(n uint64) []interface{} { return []interface{}{hexutil.Uint64(n), true} },
+		"zkevm_batchNumberByBlockNumber": func(n uint64) []interface{} { return []interface{}{hexutil.Uint64(n)} },
+		"zkevm_getL2BlockInfoTree":       func(n uint64) []interface{} { return []interface{}{hexutil.Uint64(n)} },
+	}
+	batchMethods = map[string]func(batchNo uint64) []interface{}{
+		"zkevm_getBatchByNumber":         func(n uint64) []interface{} { return []interface{}{hexutil.Uint64(n), true} },
+		"zkevm_getBatchStatus":           func(n uint64) []interface{} { return []interface{}{hexutil.Uint64(n)} },
+		"zkevm_getForkIdByBatchNumber":   func(n uint64) []interface{} { return []interface{}{hexutil.Uint64(n)} },
+		"zkevm_getBatchCountersByNumber": func(n uint64) []interface{} { return []interface{}{hexutil.Uint64(n)} },
+		"zkevm_getExecutorDivergence":    func(n uint64) []interface{} { return []interface{}{hexutil.Uint64(n)} },
+		"zkevm_getBatchWitness":          func(n uint64) []interface{} { return []interface{}{n} },
+	}
+)
+
+// defaultMethods are compared when no methods are given, the cheap ones of each range
+var defaultMethods = []string{"eth_getBlockByNumber", "eth_getBlockReceipts", "zkevm_getBatchByNumber"}
+
+// blockRange is an inclusive range of blocks or batches, to the lowest head of both nodes when open ended
+type blockRange struct {
+	from, to uint64
+	openEnd  bool
+}
+
+// parseRange reads a range written as 100, 100-200 or 100-
+func parseRange(s string) (*blockRange, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return nil, nil
+	}
+
+	fromStr, toStr, isRange := strings.Cut(s, "-")
+	from, err := strconv.ParseUint(fromStr, 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid range %q: %w", s, err)
+	}
+	if !isRange {
+		return &blockRange{from: from, to: from}, nil
+	}
+	if toStr == "" {
+		return &blockRange{from: from, openEnd: true}, nil
+	}
+	to, err := strconv.ParseUint(toStr, 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid range %q: %w", s, err)
+	}
+	if to < from {
+		return nil, fmt.Errorf("invalid range %q: the end is before the start", s)
+	}
+	return &blockRange{from: from, to: to}, nil
+}
+
+// rangeRequests calls every method over the range, every step blocks or batches
+func rangeRequests(methods []string, params map[string]func(uint64) []interface{}, r *blockRange, step uint64) []*Request {
+	var requests []*Request
+	for n := r.from; n <= r.to; n += step {
+		for _, method := range methods {
+			if p, ok := params[method]; ok {
+				requests = append(requests, &Request{Method: method, Params: p(n)})
+			}
+		}
+		if n+step < n {
+			break
+		}
+	}
+	return requests
+}
+
+// splitMethods sorts the methods into those called per block, per batch and the others, which can only come from a
+// corpus
+func splitMethods(methods []string) (blocks, batches, others []string) {
+	for _, method := range methods {
+		if _, ok := blockMethods[method]; ok {
+			blocks = append(blocks, method)
+		} else if _, ok := batchMethods[method]; ok {
+			batches = append(batches, method)
+		} else {
+			others = append(others, method)
+		}
+	}
+	return blocks, batches, others
+}
+
+func rangeMethodNames() []string {
+	var names []string
+	for method := range blockMethods {
+		names = append(names, method)
+	}
+	for method := range batchMethods {
+		names = append(names, method)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// readCorpus reads one JSON-RPC request per line, the id and version are ignored and blank lines skipped.  Only the
+// given methods are kept unless none are given.
+func readCorpus(path string, methods []string) ([]*Request, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	keep := make(map[string]bool, len(methods))
+	for _, method := range methods {
+		keep[method] = true
+	}
+
+	var requests []*Request
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" {
+			continue
+		}
+
+		var request Request
+		if err := json.Unmarshal([]byte(text), &request); err != nil {
+			return nil, fmt.Errorf("%s line %d: %w", path, line, err)
+		}
+		if request.Method == "" {
+			return nil, fmt.Errorf("%s line %d: no method", path, line)
+		}
+		if len(keep) > 0 && !keep[request.Method] {
+			continue
+		}
+		if request.Params == nil {
+			request.Params = []interface{}{}
+		}
+		requests = append(requests, &request)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return requests, nil
+}
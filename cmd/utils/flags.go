@@ -415,6 +415,11 @@ var (
 		Usage: "Designed for recovery of the network from the L1 batch data, slower mode of operation than the datastream.  If set the datastream will not be used",
 		Value: 0,
 	}
+	L1SyncArchive = cli.StringFlag{
+		Name:  "zkevm.l1-sync-archive",
+		Usage: "Path to a pre-downloaded L1 sequence archive (manifest.json, sequences.json, calldata.json and optional accInputHashes.json). When set together with zkevm.l1-sync-start-block the L1 recovery reads batch data from the archive instead of the L1 RPC",
+		Value: "",
+	}
 	L1SyncStopBatch = cli.Uint64Flag{
 		Name:  "zkevm.l1-sync-stop-batch",
 		Usage: "Designed mainly for debugging, this will stop the L1 sync going on for too long when you only want to pull a handful of batches from the L1 during recovery",
@@ -440,6 +445,16 @@ var (
 		Usage: "The port used for the L1 cache",
 		Value: 6969,
 	}
+	L1CacheAdminPortFlag = cli.UintFlag{
+		Name:  "zkevm.l1-cache-admin-port",
+		Usage: "The port the admin endpoints of the L1 cache listen on, bound to localhost. Disabled when 0",
+		Value: 0,
+	}
+	L1CacheMethodTTLsFlag = cli.StringFlag{
+		Name:  "zkevm.l1-cache-method-ttls",
+		Usage: "Comma separated list of method=duration pairs controlling how long L1 cache entries live, a method can be qualified with a block tag e.g. eth_getBlockByNumber:latest=12s. Methods not listed never expire, requests for a block tag expire after 12s",
+		Value: "",
+	}
 	AddressSequencerFlag = cli.StringFlag{
 		Name:  "zkevm.address-sequencer",
 		Usage: "Sequencer address",
@@ -526,6 +541,36 @@ var (
 		Usage: "Regenerate the SMT in memory (requires a lot of RAM for most chains)",
 		Value: false,
 	}
+	ConsistencyCheckBlocksFlag = cli.Uint64Flag{
+		Name:  "zkevm.consistency-check-blocks",
+		Usage: "Check the hermez tables against the chain data for this many blocks back from the tip at startup, 0 to disable",
+		Value: 0,
+	}
+	PruneIntermediateTxStateRootsFlag = cli.Uint64Flag{
+		Name:  "zkevm.prune.intermediate-tx-state-roots",
+		Usage: "Keep the intermediate tx state roots of this many blocks back from the tip, 0 keeps all of them",
+		Value: 0,
+	}
+	PruneBatchCountersFlag = cli.Uint64Flag{
+		Name:  "zkevm.prune.batch-counters",
+		Usage: "Keep the batch counters of this many blocks back from the tip, 0 keeps all of them",
+		Value: 0,
+	}
+	PruneSmtDepthsFlag = cli.Uint64Flag{
+		Name:  "zkevm.prune.smt-depths",
+		Usage: "Keep the smt depths of this many blocks back from the tip, 0 keeps all of them",
+		Value: 0,
+	}
+	PruneL1BatchDataFlag = cli.Uint64Flag{
+		Name:  "zkevm.prune.l1-batch-data",
+		Usage: "Keep the l1 batch data of this many batches back from the tip, 0 keeps all of them",
+		Value: 0,
+	}
+	PruneExecutorDivergencesFlag = cli.Uint64Flag{
+		Name:  "zkevm.prune.executor-divergences",
+		Usage: "Keep the executor divergence reports of this many batches back from the tip, 0 keeps all of them",
+		Value: 0,
+	}
 	SequencerBlockSealTime = cli.StringFlag{
 		Name:  "zkevm.sequencer-block-seal-time",
 		Usage: "Block seal time. Defaults to 6s",
@@ -571,6 +616,21 @@ var (
 		Usage: "Reuse the L1 info index for resequencing",
 		Value: true,
 	}
+	SequencerShadowFork = cli.BoolFlag{
+		Name:  "zkevm.sequencer-shadow-fork",
+		Usage: "When enabled, the sequencer replays the transactions of the source chain read from zkevm.l2-datastreamer-url and records the differences of their results",
+		Value: false,
+	}
+	SequencerShadowForkStartBlock = cli.Uint64Flag{
+		Name:  "zkevm.sequencer-shadow-fork-start-block",
+		Usage: "The block of the source chain the state of the shadow fork was taken at, the replay starts with the next block",
+		Value: 0,
+	}
+	SequencerShadowForkReport = cli.StringFlag{
+		Name:  "zkevm.sequencer-shadow-fork-report",
+		Usage: "File the shadow fork appends the per transaction comparison to as json lines (default: <datadir>/shadow-fork.jsonl)",
+		Value: "",
+	}
 	ExecutorUrls = cli.StringFlag{
 		Name:  "zkevm.executor-urls",
 		Usage: "A comma separated list of grpc addresses that host executors",
@@ -602,11 +662,36 @@ var (
 		Usage: "The maximum number of concurrent requests to the executor",
 		Value: 1,
 	}
+	ExecutorUrlSettings = cli.StringFlag{
+		Name:  "zkevm.executor-url-settings",
+		Usage: "Per executor overrides of the timeout, weight and max concurrent requests, e.g. \"host1:50071,timeout=30s,weight=2;host2:50071,max-concurrent=4\"",
+		Value: "",
+	}
+	ExecutorBreakerErrorRate = cli.Float64Flag{
+		Name:  "zkevm.executor-breaker-error-rate",
+		Usage: "Share of failed requests (0-1) over the recent requests to an executor that takes it out of rotation, 0 disables the circuit breaker. With a single executor the sequencer waits on it while its breaker is open",
+		Value: 0,
+	}
+	ExecutorBreakerCooldown = cli.DurationFlag{
+		Name:  "zkevm.executor-breaker-cooldown",
+		Usage: "How long an executor taken out of rotation is left alone before a probe request is sent to re-admit it",
+		Value: 30 * time.Second,
+	}
+	ExecutorHedgeAfter = cli.DurationFlag{
+		Name:  "zkevm.executor-hedge-after",
+		Usage: "Send a verification request to a second executor if the first hasn't answered within this time, the first answer wins. 0 disables hedging",
+		Value: 0,
+	}
 	RpcRateLimitsFlag = cli.IntFlag{
 		Name:  "zkevm.rpc-ratelimit",
 		Usage: "RPC rate limit in requests per second.",
 		Value: 0,
 	}
+	RpcRateLimitConfigFlag = cli.StringFlag{
+		Name:  "zkevm.rpc-ratelimit-config",
+		Usage: "YAML file with the request rate limit per client IP or API key and the cost of each RPC method. No limit if empty",
+		Value: "",
+	}
 	RpcGetBatchWitnessConcurrencyLimitFlag = cli.IntFlag{
 		Name:  "zkevm.rpc-get-batch-witness-concurrency-limit",
 		Usage: "The maximum number of concurrent requests to the executor for getBatchWitness.",
@@ -642,6 +727,21 @@ var (
 		Usage: "Define the inactivity check interval timeout when interacting with a data stream server",
 		Value: 5 * time.Minute,
 	}
+	DataStreamAuditMode = cli.StringFlag{
+		Name:  "zkevm.data-stream-audit-mode",
+		Usage: "Compare the data stream with the database in the background: 'sample' audits the latest and random batches, 'scan' audits every batch in turn. Disabled if empty",
+		Value: "",
+	}
+	DataStreamAuditInterval = cli.DurationFlag{
+		Name:  "zkevm.data-stream-audit-interval",
+		Usage: "Define the pause between two rounds of the data stream audit",
+		Value: time.Minute,
+	}
+	DataStreamAuditBatches = cli.Uint64Flag{
+		Name:  "zkevm.data-stream-audit-batches",
+		Usage: "Define how many batches the data stream audit compares every round",
+		Value: 10,
+	}
 	Limbo = cli.BoolFlag{
 		Name:  "zkevm.limbo",
 		Usage: "Enable limbo processing on batches that failed verification",
@@ -652,6 +752,11 @@ var (
 		Usage: "Allow the sequencer to proceed transactions with 0 gas price",
 		Value: false,
 	}
+	GaslessSponsorship = cli.BoolFlag{
+		Name:  "zkevm.gasless-sponsorship",
+		Usage: "Only let transactions with 0 gas price into the pool if a sponsorship in the ACL pays for them. Has no effect if free transactions are allowed",
+		Value: false,
+	}
 	AllowPreEIP155Transactions = cli.BoolFlag{
 		Name:  "zkevm.allow-pre-eip155-transactions",
 		Usage: "Allow the sequencer to proceed pre-EIP155 transactions",
@@ -693,6 +798,31 @@ var (
 		Usage: "Apply factor to L1 gas price to calculate l2 gasPrice",
 		Value: 1,
 	}
+	DynamicGasPrice = cli.BoolFlag{
+		Name:  "zkevm.dynamic-gas-price",
+		Usage: "Price L2 gas from a moving average of the L1 gas price and the counter saturation of recent batches, the result is also used for the effective gas price of sequenced transactions",
+		Value: false,
+	}
+	DynamicGasPriceL1Samples = cli.IntFlag{
+		Name:  "zkevm.dynamic-gas-price-l1-samples",
+		Usage: "Number of L1 gas price samples in the moving average used by the dynamic gas price",
+		Value: 20,
+	}
+	DynamicGasPriceBatchWindow = cli.IntFlag{
+		Name:  "zkevm.dynamic-gas-price-batch-window",
+		Usage: "Number of recently closed batches used to measure the counter saturation for the dynamic gas price",
+		Value: 10,
+	}
+	DynamicGasPriceSaturationTarget = cli.Float64Flag{
+		Name:  "zkevm.dynamic-gas-price-saturation-target",
+		Usage: "Counter saturation of recent batches (0-1) above which the dynamic gas price starts to increase",
+		Value: 0.5,
+	}
+	DynamicGasPriceMaxMultiplier = cli.Float64Flag{
+		Name:  "zkevm.dynamic-gas-price-max-multiplier",
+		Usage: "Multiplier applied to the dynamic gas price when recent batches are fully saturated",
+		Value: 2,
+	}
 	WitnessFullFlag = cli.BoolFlag{
 		Name:  "zkevm.witness-full",
 		Usage: "Enable/Diable witness full",
@@ -705,9 +835,39 @@ var (
 	}
 	PoolManagerUrl = cli.StringFlag{
 		Name:  "zkevm.pool-manager-url",
-		Usage: "The URL of the pool manager. If set, eth_sendRawTransaction will be redirected there.",
+		Usage: "The URL of the pool manager, or a comma separated list of them to fail over between. If set, eth_sendRawTransaction will be redirected there.",
 		Value: "",
 	}
+	TxForwardQueueSize = cli.IntFlag{
+		Name:  "zkevm.tx-forward-queue-size",
+		Usage: "The most transactions held for a retry when the pool manager or sequencer can't be reached",
+		Value: 1000,
+	}
+	TxForwardBatchSize = cli.IntFlag{
+		Name:  "zkevm.tx-forward-batch-size",
+		Usage: "The most queued transactions sent to the pool manager or sequencer in one request",
+		Value: 50,
+	}
+	TxForwardRetries = cli.IntFlag{
+		Name:  "zkevm.tx-forward-retries",
+		Usage: "How many times a queued transaction is retried before it is dropped",
+		Value: 5,
+	}
+	TxForwardBackoff = cli.DurationFlag{
+		Name:  "zkevm.tx-forward-backoff",
+		Usage: "The wait before the first retry of a queued transaction, doubled with every further retry",
+		Value: time.Second,
+	}
+	TxForwardPendingTTL = cli.DurationFlag{
+		Name:  "zkevm.tx-forward-pending-ttl",
+		Usage: "How long a forwarded transaction is returned as pending by eth_getTransactionByHash until it is seen in a block",
+		Value: 10 * time.Minute,
+	}
+	TxForwardValidate = cli.BoolFlag{
+		Name:  "zkevm.tx-forward-validate",
+		Usage: "Check the nonce, balance, intrinsic gas and ACL of a transaction against the latest state before forwarding it",
+		Value: false,
+	}
 	TxPoolRejectSmartContractDeployments = cli.BoolFlag{
 		Name:  "zkevm.reject-smart-contract-deployments",
 		Usage: "Reject smart contract deployments",
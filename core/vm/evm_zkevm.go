@@ -49,6 +49,14 @@ func (evm *EVM) precompile_zkevm(addr libcommon.Address, retSize int) (Precompil
 	return p, ok
 }
 
+// CounterCollector returns the zk counter collector in use for the current execution, nil if counters are not being collected
+func (evm *EVM) CounterCollector() *CounterCollector {
+	if evm.zkConfig == nil {
+		return nil
+	}
+	return evm.zkConfig.CounterCollector
+}
+
 // NewEVM returns a new EVM. The returned EVM is not thread safe and should
 // only ever be used *once*.
 func NewZkEVM(blockCtx evmtypes.BlockContext, txCtx evmtypes.TxContext, state evmtypes.IntraBlockState, chainConfig *chain.Config, zkVmConfig ZkConfig) *EVM {
@@ -72,6 +72,11 @@ func (bcc *BatchCounterCollector) Clone() *BatchCounterCollector {
 	}
 }
 
+// SmtLevels returns the smt levels assumed for batch level and transaction level counters after the mcp reduction
+func (bcc *BatchCounterCollector) SmtLevels() (batch int, transaction int) {
+	return bcc.smtLevels, bcc.smtLevelsForTransaction
+}
+
 // AddNewTransactionCounters makes the collector aware that a new transaction is attempting to be added to the collector
 // here we check the batchL2Data length and ensure that it doesn't cause an overflow.  This will be re-calculated
 // every time a new transaction is added as it needs to take into account all the transactions in a batch.
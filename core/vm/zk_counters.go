@@ -60,6 +60,8 @@ func (c *Counter) Used() int { return c.used }
 
 func (c *Counter) Limit() int { return c.initialAmount }
 
+func (c *Counter) Remaining() int { return c.remaining }
+
 func (c *Counter) AsMap() map[string]int {
 	return map[string]int{
 		"remaining":     c.remaining,
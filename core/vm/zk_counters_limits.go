@@ -81,6 +81,11 @@ func createCountrsByLimits(c counterLimits) *Counters {
 	return &counters
 }
 
+// GetCounterLimits returns a fresh set of counters with the limits in place for the given fork
+func GetCounterLimits(forkId uint16) Counters {
+	return *getCounterLimits(forkId)
+}
+
 // tp ne used on next forkid counters
 func getCounterLimits(forkId uint16) *Counters {
 	totalSteps := getTotalSteps(forkId)
@@ -187,6 +187,32 @@ func (c *Config) SetForkIdBlock(forkIdNumber ForkId, blockNum uint64) error {
 	return nil
 }
 
+// ForkIdBlock returns the block a fork id activates at, nil if it is not scheduled or unknown
+func (c *Config) ForkIdBlock(forkIdNumber ForkId) *big.Int {
+	switch forkIdNumber {
+	case ForkID4:
+		return c.ForkID4Block
+	case ForkID5Dragonfruit:
+		return c.ForkID5DragonfruitBlock
+	case ForkID6IncaBerry:
+		return c.ForkID6IncaBerryBlock
+	case ForkID7Etrog:
+		return c.ForkID7EtrogBlock
+	case ForkID8Elderberry:
+		return c.ForkID88ElderberryBlock
+	case ForkID9Elderberry2:
+		return c.ForkID9Elderberry2Block
+	case ForkID10:
+		return c.ForkID10
+	case ForkID11:
+		return c.ForkID11
+	case ForkID12Banana:
+		return c.ForkID12BananaBlock
+	default:
+		return nil
+	}
+}
+
 func (c *Config) getEngine() string {
 	switch {
 	case c.Ethash != nil:
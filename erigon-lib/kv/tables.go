@@ -547,6 +547,10 @@ const (
 	TableHashKey                      = "HermezSmtHashKey"
 	TablePoolLimbo                    = "PoolLimbo"
 	BATCH_ENDS                        = "batch_ends"
+	EXECUTOR_DIVERGENCES              = "executor_divergences"      // batch number -> executor divergence report json
+	BATCH_TRANSITIONS                 = "batch_transitions"         // status, batch number -> l1 block and l1 tx hash
+	PRUNE_PROGRESS                    = "zk_prune_progress"         // table name -> first block or batch number not pruned
+	SHADOW_FORK_SOURCE_BLOCKS         = "shadow_fork_source_blocks" // l2blockno -> last source block replayed by a shadow fork
 	//Diagnostics tables
 	DiagSystemInfo = "DiagSystemInfo"
 	DiagSyncStages = "DiagSyncStages"
@@ -791,6 +795,10 @@ var ChaindataTables = []string{
 	TableHashKey,
 	TablePoolLimbo,
 	BATCH_ENDS,
+	EXECUTOR_DIVERGENCES,
+	BATCH_TRANSITIONS,
+	PRUNE_PROGRESS,
+	SHADOW_FORK_SOURCE_BLOCKS,
 }
 
 const (
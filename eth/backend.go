@@ -40,6 +40,8 @@ import (
 
 	"github.com/0xPolygonHermez/zkevm-data-streamer/datastreamer"
 	"github.com/ledgerwatch/erigon/zk/sequencer"
+	"github.com/ledgerwatch/erigon/zk/shadowfork"
+	"github.com/ledgerwatch/erigon/zk/tx_forwarder"
 	"github.com/ledgerwatch/erigon/zk/txpool"
 
 	"github.com/erigontech/mdbx-go/mdbx"
@@ -127,8 +129,13 @@ import (
 	"github.com/ledgerwatch/erigon/turbo/snapshotsync/snap"
 	stages2 "github.com/ledgerwatch/erigon/turbo/stages"
 	"github.com/ledgerwatch/erigon/turbo/stages/headerdownload"
+	"github.com/ledgerwatch/erigon/zk/consistency"
 	"github.com/ledgerwatch/erigon/zk/contracts"
+	"github.com/ledgerwatch/erigon/zk/datastream/audit"
 	"github.com/ledgerwatch/erigon/zk/datastream/client"
+	"github.com/ledgerwatch/erigon/zk/datastream/server"
+	zkevents "github.com/ledgerwatch/erigon/zk/events"
+	"github.com/ledgerwatch/erigon/zk/fee_oracle"
 	"github.com/ledgerwatch/erigon/zk/hermez_db"
 	"github.com/ledgerwatch/erigon/zk/l1_cache"
 	"github.com/ledgerwatch/erigon/zk/legacy_executor_verifier"
@@ -222,6 +229,13 @@ type Ethereum struct {
 	l1Syncer        *syncer.L1Syncer
 	etherManClients []*etherman.Client
 	l1Cache         *l1_cache.L1Cache
+	feeOracle       *fee_oracle.Oracle
+	dataStreamAudit *audit.Auditor
+	shadowFork      *shadowfork.ShadowFork
+	txForwarder     *tx_forwarder.Forwarder
+
+	// the one wrapper of the data stream, shared by the sequencer and the zk events feed
+	dataStreamServer *server.DataStreamServer
 
 	preStartTasks *PreStartTasks
 
@@ -960,6 +974,12 @@ func New(ctx context.Context, stack *node.Node, config *ethconfig.Config, logger
 		log.Warn("failed to record erigon version in db", "err", err)
 	}
 
+	if config.Zk != nil && config.Zk.ConsistencyCheckBlocks > 0 {
+		if err := checkHermezDbConsistency(ctx, tx, config.Zk.ConsistencyCheckBlocks); err != nil {
+			return nil, err
+		}
+	}
+
 	executionProgress, err := stages.GetStageProgress(tx, stages.Execution)
 	if err != nil {
 		return nil, err
@@ -990,7 +1010,27 @@ func New(ctx context.Context, stack *node.Node, config *ethconfig.Config, logger
 				log.Info("[dataStream] setting the stream progress to 0")
 				backend.preStartTasks.WarmUpDataStream = true
 			}
+			backend.dataStreamServer = server.NewDataStreamServer(backend.dataStream, backend.chainConfig.ChainID.Uint64())
+		}
+
+		// zkevm: events for the zkevm subscriptions, published by the stage loop once the stages committed
+		var closedBatches zkevents.ClosedBatchReader
+		if backend.dataStream != nil {
+			closedBatches = backend.dataStreamServer
+
+			// zkevm: audit the stream against the db in the background, started on the call to Init
+			if backend.config.DataStreamAuditMode != "" {
+				backend.dataStreamAudit, err = audit.New(audit.Config{
+					Mode:     backend.config.DataStreamAuditMode,
+					Interval: backend.config.DataStreamAuditInterval,
+					Batches:  backend.config.DataStreamAuditBatches,
+				}, backend.chainDB, backend.dataStream, backend.chainConfig.ChainID.Uint64())
+				if err != nil {
+					return nil, err
+				}
+			}
 		}
+		backend.notifications.ZkEvents = zkevents.NewFeed(backend.chainDB, closedBatches)
 
 		// entering ZK territory!
 		cfg := backend.config
@@ -1000,7 +1040,7 @@ func New(ctx context.Context, stack *node.Node, config *ethconfig.Config, logger
 		l1Urls := strings.Split(cfg.L1RpcUrl, ",")
 
 		if cfg.Zk.L1CacheEnabled {
-			l1Cache, err := l1_cache.NewL1Cache(ctx, path.Join(stack.DataDir(), "l1cache"), cfg.Zk.L1CachePort)
+			l1Cache, err := l1_cache.NewL1Cache(ctx, path.Join(stack.DataDir(), "l1cache"), cfg.Zk.L1CachePort, cfg.Zk.L1CacheAdminPort, cfg.Zk.L1CacheMethodTTLs)
 			if err != nil {
 				return nil, err
 			}
@@ -1087,6 +1127,13 @@ func New(ctx context.Context, stack *node.Node, config *ethconfig.Config, logger
 		// Check if L1 contracts addresses should be retrieved from the L1 chain
 		l1ContractAddressProcess(ctx, cfg.Zk, backend.l1Syncer)
 
+		// shared by the sequencer and the rpc so the effective gas price of sequenced transactions matches the suggested gas price
+		backend.feeOracle = fee_oracle.NewOracleFromZk(cfg.Zk)
+		if backend.feeOracle != nil {
+			// the L1 gas price is sampled in the background so that neither the sequencer nor the rpc waits on the L1
+			go backend.feeOracle.Run(ctx)
+		}
+
 		l1InfoTreeSyncer := syncer.NewL1Syncer(
 			ctx,
 			ethermanClients,
@@ -1117,6 +1164,9 @@ func New(ctx context.Context, stack *node.Node, config *ethconfig.Config, logger
 					MaxConcurrentRequests: cfg.ExecutorMaxConcurrentRequests,
 					OutputLocation:        cfg.ExecutorPayloadOutput,
 				}
+				if levCfg.UrlSettings, err = legacy_executor_verifier.ParseExecutorSettings(cfg.ExecutorUrlSettings); err != nil {
+					return nil, fmt.Errorf("invalid executor url settings: %w", err)
+				}
 				executors := legacy_executor_verifier.NewExecutors(levCfg)
 				for _, e := range executors {
 					legacyExecutors = append(legacyExecutors, e)
@@ -1153,6 +1203,11 @@ func New(ctx context.Context, stack *node.Node, config *ethconfig.Config, logger
 				cfg.L1HighestBlockType,
 			)
 
+			// zkevm: replay the transactions of the source chain of a shadow fork instead of the pool
+			if backend.shadowFork, err = shadowfork.NewFromZk(cfg.Zk, dirs.DataDir); err != nil {
+				return nil, err
+			}
+
 			backend.syncStages = stages2.NewSequencerZkStages(
 				backend.sentryCtx,
 				backend.chainDB,
@@ -1165,6 +1220,7 @@ func New(ctx context.Context, stack *node.Node, config *ethconfig.Config, logger
 				backend.forkValidator,
 				backend.engine,
 				backend.dataStream,
+				backend.dataStreamServer,
 				backend.l1Syncer,
 				seqVerSyncer,
 				l1InfoTreeSyncer,
@@ -1172,6 +1228,8 @@ func New(ctx context.Context, stack *node.Node, config *ethconfig.Config, logger
 				backend.txPool2,
 				backend.txPool2DB,
 				verifier,
+				backend.feeOracle,
+				backend.shadowFork,
 			)
 
 			backend.syncUnwindOrder = zkStages.ZkSequencerUnwindOrder
@@ -1256,6 +1314,29 @@ func recordStartupVersionInDb(tx kv.RwTx) error {
 	return nil
 }
 
+// checkHermezDbConsistency checks the hermez tables for the last blocks and warns about what it finds, fixing it is
+// left to the check_hermez_db_zkevm integration command
+func checkHermezDbConsistency(ctx context.Context, tx kv.Tx, blocks uint64) error {
+	head, err := consistency.HighestCanonicalBlock(tx)
+	if err != nil {
+		return err
+	}
+	fromBlock := uint64(1)
+	if head > blocks {
+		fromBlock = head - blocks + 1
+	}
+
+	violations, err := consistency.Check(ctx, tx, fromBlock, head)
+	if err != nil {
+		return err
+	}
+	for _, v := range violations {
+		log.Warn("[hermez-db] Inconsistency found", "check", v.Check, "block", v.Block, "batch", v.Batch, "repairable", v.Repairable(), "detail", v.Detail)
+	}
+	log.Info("[hermez-db] Consistency checked", "from", fromBlock, "to", head, "violations", len(violations))
+	return nil
+}
+
 // creates an EtherMan instance with default parameters
 func newEtherMan(cfg *ethconfig.Config, l2ChainName, url string) *etherman.Client {
 	ethmanConf := etherman.Config{
@@ -1327,7 +1408,13 @@ func (s *Ethereum) Init(stack *node.Node, config *ethconfig.Config, chainConfig
 	// apiList := jsonrpc.APIList(chainKv, borDb, ethRpcClient, txPoolRpcClient, miningRpcClient, ff, stateCache, blockReader, backend.agg, httpRpcCfg, backend.engine, config, backend.l1Syncer)
 	// authApiList := jsonrpc.AuthAPIList(chainKv, ethRpcClient, txPoolRpcClient, miningRpcClient, ff, stateCache, blockReader, backend.agg, httpRpcCfg, backend.engine, config)
 
-	s.apiList = jsonrpc.APIList(chainKv, ethRpcClient, txPoolRpcClient, s.txPool2, miningRpcClient, ff, stateCache, blockReader, s.agg, &httpRpcCfg, s.engine, config, s.l1Syncer, s.logger, s.dataStream)
+	// non-sequencers forward transactions to the pool manager or the sequencer, the forwarder retries in the background
+	// until the node stops
+	if !sequencer.IsSequencer() {
+		s.txForwarder = tx_forwarder.NewFromZk(config.Zk)
+	}
+
+	s.apiList = jsonrpc.APIList(chainKv, ethRpcClient, txPoolRpcClient, s.txPool2, miningRpcClient, ff, stateCache, blockReader, s.agg, &httpRpcCfg, s.engine, config, s.l1Syncer, s.logger, s.dataStream, s.feeOracle, s.notifications.ZkEvents, s.dataStreamAudit, s.txForwarder)
 
 	if config.SilkwormRpcDaemon && httpRpcCfg.Enabled {
 		interface_log_settings := silkworm.RpcInterfaceLogSettings{
@@ -1371,6 +1458,10 @@ func (s *Ethereum) Init(stack *node.Node, config *ethconfig.Config, chainConfig
 		}
 	}()
 
+	if s.dataStreamAudit != nil {
+		go s.dataStreamAudit.Run(ctx)
+	}
+
 	// Register the backend on the node
 	stack.RegisterLifecycle(s)
 	return nil
@@ -1938,6 +2029,14 @@ func (s *Ethereum) Stop() error {
 	if s.txPool2DB != nil {
 		s.txPool2DB.Close()
 	}
+	if s.txForwarder != nil {
+		s.txForwarder.Stop()
+	}
+	if s.shadowFork != nil {
+		if err := s.shadowFork.Close(); err != nil {
+			s.logger.Error("Failed to close the shadow fork report", "err", err)
+		}
+	}
 	if s.agg != nil {
 		s.agg.Close()
 	}
@@ -5,6 +5,7 @@ import (
 
 	"github.com/c2h5oh/datasize"
 	"github.com/ledgerwatch/erigon-lib/common"
+	"github.com/ledgerwatch/erigon/zk/hermez_db"
 )
 
 type Zk struct {
@@ -14,6 +15,7 @@ type Zk struct {
 	L2DataStreamerTimeout                  time.Duration
 	L1SyncStartBlock                       uint64
 	L1SyncStopBatch                        uint64
+	L1SyncArchive                          string
 	L1ChainId                              uint64
 	L1RpcUrl                               string
 	AddressSequencer                       common.Address
@@ -32,6 +34,8 @@ type Zk struct {
 	L1FinalizedBlockRequirement            uint64
 	L1CacheEnabled                         bool
 	L1CachePort                            uint
+	L1CacheAdminPort                       uint
+	L1CacheMethodTTLs                      map[string]time.Duration
 	RpcRateLimits                          int
 	RpcGetBatchWitnessConcurrencyLimit     int
 	DatastreamVersion                      int
@@ -44,14 +48,22 @@ type Zk struct {
 	SequencerResequence                    bool
 	SequencerResequenceStrict              bool
 	SequencerResequenceReuseL1InfoIndex    bool
+	SequencerShadowFork                    bool
+	SequencerShadowForkStartBlock          uint64
+	SequencerShadowForkReport              string
 	ExecutorUrls                           []string
 	ExecutorStrictMode                     bool
 	ExecutorRequestTimeout                 time.Duration
 	DatastreamNewBlockTimeout              time.Duration
 	WitnessMemdbSize                       datasize.ByteSize
 	ExecutorMaxConcurrentRequests          int
+	ExecutorUrlSettings                    string
+	ExecutorBreakerErrorRate               float64
+	ExecutorBreakerCooldown                time.Duration
+	ExecutorHedgeAfter                     time.Duration
 	Limbo                                  bool
 	AllowFreeTransactions                  bool
+	GaslessSponsorship                     bool
 	AllowPreEIP155Transactions             bool
 	EffectiveGasPriceForEthTransfer        uint8
 	EffectiveGasPriceForErc20Transfer      uint8
@@ -60,19 +72,29 @@ type Zk struct {
 	DefaultGasPrice                        uint64
 	MaxGasPrice                            uint64
 	GasPriceFactor                         float64
+	DynamicGasPrice                        bool
+	DynamicGasPriceL1Samples               int
+	DynamicGasPriceBatchWindow             int
+	DynamicGasPriceSaturationTarget        float64
+	DynamicGasPriceMaxMultiplier           float64
 	DAUrl                                  string
 	DataStreamHost                         string
 	DataStreamPort                         uint
 	DataStreamWriteTimeout                 time.Duration
 	DataStreamInactivityTimeout            time.Duration
 	DataStreamInactivityCheckInterval      time.Duration
+	DataStreamAuditMode                    string
+	DataStreamAuditInterval                time.Duration
+	DataStreamAuditBatches                 uint64
 
-	RebuildTreeAfter      uint64
-	IncrementTreeAlways   bool
-	SmtRegenerateInMemory bool
-	WitnessFull           bool
-	SyncLimit             uint64
-	Gasless               bool
+	RebuildTreeAfter       uint64
+	IncrementTreeAlways    bool
+	SmtRegenerateInMemory  bool
+	ConsistencyCheckBlocks uint64
+	Prune                  hermez_db.PruneMode
+	WitnessFull            bool
+	SyncLimit              uint64
+	Gasless                bool
 
 	DebugTimers    bool
 	DebugNoSync    bool
@@ -81,6 +103,12 @@ type Zk struct {
 	DebugStepAfter uint64
 
 	PoolManagerUrl              string
+	TxForwardQueueSize          int
+	TxForwardBatchSize          int
+	TxForwardRetries            int
+	TxForwardBackoff            time.Duration
+	TxForwardPendingTTL         time.Duration
+	TxForwardValidate           bool
 	DisableVirtualCounters      bool
 	VirtualCountersSmtReduction float64
 	ExecutorPayloadOutput       string
@@ -101,6 +129,11 @@ func (c *Zk) HasExecutors() bool {
 	return len(c.ExecutorUrls) > 0 && c.ExecutorUrls[0] != ""
 }
 
+// UseL1SyncArchive returns true when the L1 recovery reads the sequences from an archive rather than the L1
+func (c *Zk) UseL1SyncArchive() bool {
+	return c.L1SyncArchive != "" && c.L1SyncStartBlock > 0
+}
+
 // ShouldImportInitialBatch returns true in case initial batch config file name is non-empty string.
 func (c *Zk) ShouldImportInitialBatch() bool {
 	return c.InitialBatchCfgFile != ""
@@ -572,6 +572,12 @@ func PruneExecutionStageZk(s *PruneState, tx kv.RwTx, cfg ExecuteBlockCfg, ctx c
 		}
 	}
 
+	if cfg.zk != nil && cfg.zk.Prune.Enabled() {
+		if err = PruneZkTables(ctx, tx, cfg.zk.Prune, s.ForwardProgress); err != nil {
+			return err
+		}
+	}
+
 	if err = s.Done(tx); err != nil {
 		return err
 	}
@@ -583,6 +589,16 @@ func PruneExecutionStageZk(s *PruneState, tx kv.RwTx, cfg ExecuteBlockCfg, ctx c
 	return nil
 }
 
+// PruneZkTables prunes the zk tables only needed near the tip as far back from the given head block as the mode keeps
+func PruneZkTables(ctx context.Context, tx kv.RwTx, mode hermez_db.PruneMode, headBlock uint64) error {
+	hermezDb := hermez_db.NewHermezDb(tx)
+	headBatch, err := hermezDb.GetBatchNoByL2Block(headBlock)
+	if err != nil {
+		return err
+	}
+	return hermezDb.Prune(ctx, mode, headBlock, headBatch, hermez_db.PruneLimit)
+}
+
 func UnwindExecutionStageDbWrites(ctx context.Context, u *UnwindState, s *StageState, tx kv.RwTx) error {
 	// backward values that by default handinged in stage_headers
 	// TODO: check for other missing value like - WriteHeader_zkEvm, WriteHeadHeaderHash, WriteCanonicalHash, WriteBody, WriteSenders, WriteTxLookupEntries_zkEvm
@@ -31,4 +31,5 @@ var (
 	// HighestUsedL1InfoIndex      SyncStage = "HighestUsedL1InfoTree"
 	SequenceExecutorVerify SyncStage = "SequenceExecutorVerify"
 	L1BlockSync            SyncStage = "L1BlockSync"
+	ShadowForkSourceBlock  SyncStage = "ShadowForkSourceBlock" // last block of the source chain replayed by a shadow fork
 )
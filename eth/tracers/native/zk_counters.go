@@ -0,0 +1,397 @@
+package native
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync/atomic"
+
+	"github.com/holiman/uint256"
+
+	libcommon "github.com/ledgerwatch/erigon-lib/common"
+	"github.com/ledgerwatch/erigon/core/vm"
+	"github.com/ledgerwatch/erigon/eth/tracers"
+)
+
+func init() {
+	register("zkCountersTracer", newZkCountersTracer)
+}
+
+const (
+	zkCountersTxLabel         = "[tx]"
+	zkCountersEnterLabel      = "[enter]"
+	zkCountersPrecompileLabel = "[precompile]"
+)
+
+var errZkCountersNotCollected = errors.New("zk counters are not being collected for this trace, use debug_traceTransactionCounters or debug_traceBlockCounters")
+
+// zkCounterNames maps the json names of the counters, as used by zkevm_estimateCounters, to the counter keys
+var zkCounterNames = map[string]vm.CounterKey{
+	"steps":            vm.S,
+	"arithmetics":      vm.A,
+	"binaries":         vm.B,
+	"memAligns":        vm.M,
+	"keccakHashes":     vm.K,
+	"poseidonPaddings": vm.D,
+	"poseidonhashes":   vm.P,
+	"SHA256hashes":     vm.SHA,
+}
+
+type zkCounterValues [vm.CounterTypesCount]int
+
+func (v *zkCounterValues) add(other zkCounterValues) {
+	for i := range v {
+		v[i] += other[i]
+	}
+}
+
+func (v zkCounterValues) isZero() bool {
+	for _, c := range v {
+		if c != 0 {
+			return false
+		}
+	}
+	return true
+}
+
+func (v zkCounterValues) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		Steps            int `json:"steps"`
+		Arithmetics      int `json:"arithmetics"`
+		Binaries         int `json:"binaries"`
+		MemAligns        int `json:"memAligns"`
+		KeccakHashes     int `json:"keccakHashes"`
+		PoseidonPaddings int `json:"poseidonPaddings"`
+		Poseidonhashes   int `json:"poseidonhashes"`
+		SHA256hashes     int `json:"SHA256hashes"`
+	}{
+		Steps:            v[vm.S],
+		Arithmetics:      v[vm.A],
+		Binaries:         v[vm.B],
+		MemAligns:        v[vm.M],
+		KeccakHashes:     v[vm.K],
+		PoseidonPaddings: v[vm.D],
+		Poseidonhashes:   v[vm.P],
+		SHA256hashes:     v[vm.SHA],
+	})
+}
+
+type zkCountersFrame struct {
+	Type       string             `json:"type"`
+	From       libcommon.Address  `json:"from"`
+	To         libcommon.Address  `json:"to"`
+	Precompile bool               `json:"precompile,omitempty"`
+	Error      string             `json:"error,omitempty"`
+	Self       zkCounterValues    `json:"self"`
+	Total      zkCounterValues    `json:"total"`
+	Calls      []*zkCountersFrame `json:"calls,omitempty"`
+
+	// self counters of the frame split by opcode, only used for the folded output
+	opcodes map[string]*zkCounterValues
+	lastOp  string
+}
+
+func (f *zkCountersFrame) label() string {
+	return fmt.Sprintf("%s@%s", f.Type, f.To.Hex())
+}
+
+// sumTotals fills in the inclusive counters of the frame and all of its children
+func (f *zkCountersFrame) sumTotals() zkCounterValues {
+	f.Total = f.Self
+	for _, c := range f.Calls {
+		f.Total.add(c.sumTotals())
+	}
+	return f.Total
+}
+
+type zkCountersTx struct {
+	TxHash libcommon.Hash   `json:"txHash"`
+	Total  zkCounterValues  `json:"total"`
+	Call   *zkCountersFrame `json:"call,omitempty"`
+}
+
+type zkContractCounters struct {
+	Calls    int             `json:"calls"`
+	Counters zkCounterValues `json:"counters"`
+}
+
+type zkOpcodeCounters struct {
+	Count    int             `json:"count"`
+	Counters zkCounterValues `json:"counters"`
+}
+
+type zkCountersResult struct {
+	SmtLevels    int                                       `json:"smtLevels"`
+	Total        zkCounterValues                           `json:"total"`
+	Transactions []*zkCountersTx                           `json:"transactions"`
+	Contracts    map[libcommon.Address]*zkContractCounters `json:"contracts"`
+	Opcodes      map[string]*zkOpcodeCounters              `json:"opcodes"`
+	Folded       []string                                  `json:"folded,omitempty"`
+}
+
+type zkCountersTracerConfig struct {
+	Folded       string `json:"folded"`       // Counter to produce folded stacks for (e.g. "steps"), disabled when empty
+	DisableCalls bool   `json:"disableCalls"` // If true, the call tree is not included in the result
+}
+
+// zkCountersTracer attributes the zk counters used during execution to call frames, contracts and opcodes.  The
+// counters are sampled from the execution counter collector between every step so whatever was used since the
+// previous step is attributed to the opcode that ran last in the current frame.  Counters used while entering a
+// frame before its first step are labelled [enter], calls to precompiles [precompile] and anything outside of the
+// interpreter loop [tx].  The same instance can be used for every transaction in a block to get block level totals.
+type zkCountersTracer struct {
+	noopTracer
+	config    zkCountersTracerConfig
+	interrupt uint32 // Atomic flag to signal execution interruption
+	reason    error  // Textual reason for the interruption
+
+	collector *vm.CounterCollector
+	last      zkCounterValues
+	smtLevels int
+
+	callstack []*zkCountersFrame
+	txs       []*zkCountersTx
+	contracts map[libcommon.Address]*zkContractCounters
+	opcodes   map[string]*zkOpcodeCounters
+}
+
+// newZkCountersTracer returns a native go tracer which aggregates the zk counters
+// of a transaction, and implements vm.EVMLogger.
+func newZkCountersTracer(ctx *tracers.Context, cfg json.RawMessage) (tracers.Tracer, error) {
+	var config zkCountersTracerConfig
+	if cfg != nil {
+		if err := json.Unmarshal(cfg, &config); err != nil {
+			return nil, err
+		}
+	}
+	if config.Folded != "" {
+		if _, ok := zkCounterNames[config.Folded]; !ok {
+			return nil, fmt.Errorf("unknown counter %q for folded output", config.Folded)
+		}
+	}
+	return &zkCountersTracer{
+		config:    config,
+		contracts: make(map[libcommon.Address]*zkContractCounters),
+		opcodes:   make(map[string]*zkOpcodeCounters),
+	}, nil
+}
+
+// CaptureStart implements the EVMLogger interface to initialize the tracing operation.
+func (t *zkCountersTracer) CaptureStart(env *vm.EVM, from libcommon.Address, to libcommon.Address, precompile bool, create bool, input []byte, gas uint64, value *uint256.Int, code []byte) {
+	collector := env.CounterCollector()
+	if collector != t.collector {
+		// every transaction normally comes with its own collector so start counting from zero
+		t.last = zkCounterValues{}
+	}
+	t.collector = collector
+	if collector != nil {
+		t.smtLevels = collector.GetSmtLevels()
+	}
+
+	typ := vm.CALL
+	if create {
+		typ = vm.CREATE
+	}
+	root := &zkCountersFrame{
+		Type:       typ.String(),
+		From:       from,
+		To:         to,
+		Precompile: precompile,
+		lastOp:     zkCountersTxLabel,
+	}
+	t.callstack = []*zkCountersFrame{root}
+	t.txs = append(t.txs, &zkCountersTx{TxHash: env.TxContext.TxHash, Call: root})
+	t.contract(to).Calls++
+}
+
+// CaptureEnd is called after the call finishes to finalize the tracing.
+func (t *zkCountersTracer) CaptureEnd(output []byte, gasUsed uint64, err error) {
+	if len(t.callstack) == 0 {
+		return
+	}
+	t.sample()
+
+	root := t.callstack[0]
+	if err != nil {
+		root.Error = err.Error()
+	}
+	t.txs[len(t.txs)-1].Total = root.sumTotals()
+	t.callstack = nil
+}
+
+// CaptureState implements the EVMLogger interface to trace a single step of VM execution.
+func (t *zkCountersTracer) CaptureState(pc uint64, op vm.OpCode, gas, cost uint64, scope *vm.ScopeContext, rData []byte, depth int, err error) {
+	if atomic.LoadUint32(&t.interrupt) > 0 || len(t.callstack) == 0 {
+		return
+	}
+	t.sample()
+
+	name := op.String()
+	t.callstack[len(t.callstack)-1].lastOp = name
+	t.opcode(name).Count++
+}
+
+// CaptureEnter is called when EVM enters a new scope (via call, create or selfdestruct).
+func (t *zkCountersTracer) CaptureEnter(typ vm.OpCode, from libcommon.Address, to libcommon.Address, precompile, create bool, input []byte, gas uint64, value *uint256.Int, code []byte) {
+	if atomic.LoadUint32(&t.interrupt) > 0 || len(t.callstack) == 0 {
+		return
+	}
+	// whatever was used up to here belongs to the calling opcode in the parent frame
+	t.sample()
+
+	frame := &zkCountersFrame{
+		Type:       typ.String(),
+		From:       from,
+		To:         to,
+		Precompile: precompile,
+		lastOp:     zkCountersEnterLabel,
+	}
+	if precompile {
+		frame.lastOp = zkCountersPrecompileLabel
+	}
+	t.callstack = append(t.callstack, frame)
+	t.contract(to).Calls++
+}
+
+// CaptureExit is called when EVM exits a scope, even if the scope didn't
+// execute any code.
+func (t *zkCountersTracer) CaptureExit(output []byte, gasUsed uint64, err error) {
+	size := len(t.callstack)
+	if atomic.LoadUint32(&t.interrupt) > 0 || size <= 1 {
+		return
+	}
+	t.sample()
+
+	frame := t.callstack[size-1]
+	t.callstack = t.callstack[:size-1]
+	if err != nil {
+		frame.Error = err.Error()
+	}
+	parent := t.callstack[size-2]
+	parent.Calls = append(parent.Calls, frame)
+}
+
+// sample attributes the counters used since the previous sample to the last opcode of the current frame
+func (t *zkCountersTracer) sample() {
+	if t.collector == nil || len(t.callstack) == 0 {
+		return
+	}
+
+	var current, delta zkCounterValues
+	for i, c := range t.collector.Counters() {
+		if c != nil && i < len(current) {
+			current[i] = c.Used()
+		}
+	}
+	for i := range current {
+		delta[i] = current[i] - t.last[i]
+	}
+	t.last = current
+	if delta.isZero() {
+		return
+	}
+
+	frame := t.callstack[len(t.callstack)-1]
+	frame.Self.add(delta)
+	if frame.opcodes == nil {
+		frame.opcodes = make(map[string]*zkCounterValues)
+	}
+	byOp, ok := frame.opcodes[frame.lastOp]
+	if !ok {
+		byOp = &zkCounterValues{}
+		frame.opcodes[frame.lastOp] = byOp
+	}
+	byOp.add(delta)
+	t.contract(frame.To).Counters.add(delta)
+	t.opcode(frame.lastOp).Counters.add(delta)
+}
+
+func (t *zkCountersTracer) contract(addr libcommon.Address) *zkContractCounters {
+	c, ok := t.contracts[addr]
+	if !ok {
+		c = &zkContractCounters{}
+		t.contracts[addr] = c
+	}
+	return c
+}
+
+func (t *zkCountersTracer) opcode(name string) *zkOpcodeCounters {
+	o, ok := t.opcodes[name]
+	if !ok {
+		o = &zkOpcodeCounters{}
+		t.opcodes[name] = o
+	}
+	return o
+}
+
+// folded writes the frames in the folded stack format used by flamegraph tools, one line per frame and opcode with
+// the self value of the configured counter
+func (t *zkCountersTracer) folded() []string {
+	key := zkCounterNames[t.config.Folded]
+	var lines []string
+	var walk func(stack []string, f *zkCountersFrame)
+	walk = func(stack []string, f *zkCountersFrame) {
+		stack = append(stack, f.label())
+		ops := make([]string, 0, len(f.opcodes))
+		for op := range f.opcodes {
+			ops = append(ops, op)
+		}
+		sort.Strings(ops)
+		for _, op := range ops {
+			if v := f.opcodes[op][key]; v > 0 {
+				lines = append(lines, fmt.Sprintf("%s;%s %d", strings.Join(stack, ";"), op, v))
+			}
+		}
+		for _, c := range f.Calls {
+			walk(stack, c)
+		}
+	}
+	for _, tx := range t.txs {
+		if tx.Call != nil {
+			walk([]string{tx.TxHash.Hex()}, tx.Call)
+		}
+	}
+	return lines
+}
+
+// GetResult returns the json-encoded aggregated counters, and any error arising
+// from the encoding or forceful termination (via `Stop`).
+func (t *zkCountersTracer) GetResult() (json.RawMessage, error) {
+	if t.collector == nil && len(t.txs) > 0 {
+		return nil, errZkCountersNotCollected
+	}
+
+	res := zkCountersResult{
+		SmtLevels:    t.smtLevels,
+		Transactions: t.txs,
+		Contracts:    t.contracts,
+		Opcodes:      t.opcodes,
+	}
+	for _, tx := range t.txs {
+		res.Total.add(tx.Total)
+	}
+	if t.config.Folded != "" {
+		res.Folded = t.folded()
+	}
+	if t.config.DisableCalls {
+		txs := make([]*zkCountersTx, len(t.txs))
+		for i, tx := range t.txs {
+			txs[i] = &zkCountersTx{TxHash: tx.TxHash, Total: tx.Total}
+		}
+		res.Transactions = txs
+	}
+
+	out, err := json.Marshal(res)
+	if err != nil {
+		return nil, err
+	}
+	return out, t.reason
+}
+
+// Stop terminates execution of the tracer at the first opportune moment.
+func (t *zkCountersTracer) Stop(err error) {
+	t.reason = err
+	atomic.StoreUint32(&t.interrupt, 1)
+}
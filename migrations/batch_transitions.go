@@ -0,0 +1,58 @@
+package migrations
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/ledgerwatch/erigon-lib/common"
+	"github.com/ledgerwatch/erigon-lib/common/datadir"
+	"github.com/ledgerwatch/erigon-lib/kv"
+	"github.com/ledgerwatch/erigon/zk/hermez_db"
+	"github.com/ledgerwatch/erigon/zk/types"
+	"github.com/ledgerwatch/log/v3"
+)
+
+// batchTransitions fills the batch transitions from the sequences and verifications already synced from the l1.  The
+// finalized transitions are added by the l1 syncer stage.
+var batchTransitions = Migration{
+	Name: "fill batch transitions from l1 sequences and verifications",
+	Up: func(db kv.RwDB, dirs datadir.Dirs, progress []byte, BeforeCommit Callback, logger log.Logger) (err error) {
+		tx, err := db.BeginRw(context.Background())
+		if err != nil {
+			return err
+		}
+		defer tx.Rollback()
+
+		hermezDb := hermez_db.NewHermezDb(tx)
+		tables := map[string]types.BatchStatus{
+			kv.L1SEQUENCES:     types.BatchStatusVirtual,
+			kv.L1VERIFICATIONS: types.BatchStatusVerified,
+		}
+		for table, status := range tables {
+			if err = tx.ForEach(table, []byte{}, func(k, v []byte) error {
+				l1BlockNo, batchNo, err := hermez_db.SplitKey(k)
+				if err != nil {
+					return err
+				}
+				// the value starts with the l1 tx hash
+				if len(v) < 32 {
+					return fmt.Errorf("invalid %s entry for batch %d: %d bytes", table, batchNo, len(v))
+				}
+				return hermezDb.WriteBatchTransition(&types.BatchTransition{
+					Status:    status,
+					BatchNo:   batchNo,
+					L1BlockNo: l1BlockNo,
+					L1TxHash:  common.BytesToHash(v[:32]),
+				})
+			}); err != nil {
+				return err
+			}
+		}
+
+		// the transitions are written in one go so there is no progress to keep
+		if err := BeforeCommit(tx, nil, true); err != nil {
+			return err
+		}
+		return tx.Commit()
+	},
+}
@@ -0,0 +1,60 @@
+package migrations
+
+import (
+	"context"
+	"testing"
+
+	"github.com/ledgerwatch/erigon-lib/common"
+	"github.com/ledgerwatch/erigon-lib/kv"
+	"github.com/ledgerwatch/erigon-lib/kv/memdb"
+	"github.com/ledgerwatch/erigon/zk/hermez_db"
+	"github.com/ledgerwatch/erigon/zk/types"
+	"github.com/ledgerwatch/log/v3"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBatchTransitions(t *testing.T) {
+	require, tmpDir, db := require.New(t), t.TempDir(), memdb.NewTestDB(t)
+
+	err := db.Update(context.Background(), func(tx kv.RwTx) error {
+		if err := hermez_db.CreateHermezBuckets(tx); err != nil {
+			return err
+		}
+		hermezDb := hermez_db.NewHermezDb(tx)
+		if err := hermezDb.WriteSequence(100, 5, common.HexToHash("0x1"), common.Hash{}, common.Hash{}); err != nil {
+			return err
+		}
+		return hermezDb.WriteVerification(101, 3, common.HexToHash("0x2"), common.Hash{})
+	})
+	require.NoError(err)
+
+	migrator := NewMigrator(kv.ChainDB)
+	migrator.Migrations = []Migration{batchTransitions}
+	require.NoError(migrator.Apply(db, tmpDir, log.New()))
+
+	err = db.View(context.Background(), func(tx kv.Tx) error {
+		hermezDb := hermez_db.NewHermezDbReader(tx)
+		virtual, err := hermezDb.GetBatchTransition(types.BatchStatusVirtual, 5)
+		require.NoError(err)
+		require.Equal(&types.BatchTransition{Status: types.BatchStatusVirtual, BatchNo: 5, L1BlockNo: 100, L1TxHash: common.HexToHash("0x1")}, virtual)
+		verified, err := hermezDb.GetBatchTransition(types.BatchStatusVerified, 3)
+		require.NoError(err)
+		require.Equal(&types.BatchTransition{Status: types.BatchStatusVerified, BatchNo: 3, L1BlockNo: 101, L1TxHash: common.HexToHash("0x2")}, verified)
+		return nil
+	})
+	require.NoError(err)
+
+	// a truncated entry fails the migration rather than panicking
+	db = memdb.NewTestDB(t)
+	err = db.Update(context.Background(), func(tx kv.RwTx) error {
+		if err := hermez_db.CreateHermezBuckets(tx); err != nil {
+			return err
+		}
+		return tx.Put(kv.L1SEQUENCES, hermez_db.ConcatKey(100, 5), []byte{1, 2, 3})
+	})
+	require.NoError(err)
+
+	migrator = NewMigrator(kv.ChainDB)
+	migrator.Migrations = []Migration{batchTransitions}
+	require.ErrorContains(migrator.Apply(db, tmpDir, log.New()), "invalid hermez_l1Sequences entry for batch 5")
+}
@@ -41,6 +41,8 @@ var migrations = map[kv.Label][]Migration{
 		ProhibitNewDownloadsLock2,
 		countersToArray,
 		resetL1Sequences,
+		batchTransitions,
+		pruneBatchWitnesses,
 	},
 	kv.TxPoolDB: {},
 	kv.SentryDB: {},
@@ -0,0 +1,50 @@
+package migrations
+
+import (
+	"context"
+
+	"github.com/ledgerwatch/erigon-lib/common/datadir"
+	"github.com/ledgerwatch/erigon-lib/kv"
+	"github.com/ledgerwatch/erigon/eth/stagedsync/stages"
+	"github.com/ledgerwatch/erigon/ethdb/prune"
+	"github.com/ledgerwatch/erigon/zk/hermez_db"
+	"github.com/ledgerwatch/log/v3"
+)
+
+// pruneBatchWitnesses deletes the witnesses cached by older versions for the batches whose state history the prune
+// config has pruned, nothing writes that table anymore.  Nodes keeping their whole history keep their witnesses.  The
+// other zk tables are pruned by the stages once a retention is set with the zkevm.prune.* flags.
+var pruneBatchWitnesses = Migration{
+	Name: "prune the batch witnesses cached by older versions",
+	Up: func(db kv.RwDB, dirs datadir.Dirs, progress []byte, BeforeCommit Callback, logger log.Logger) (err error) {
+		tx, err := db.BeginRw(context.Background())
+		if err != nil {
+			return err
+		}
+		defer tx.Rollback()
+
+		pm, err := prune.Get(tx)
+		if err != nil {
+			return err
+		}
+		if pm.History.Enabled() {
+			headBlock, err := stages.GetStageProgress(tx, stages.Execution)
+			if err != nil {
+				return err
+			}
+			hermezDb := hermez_db.NewHermezDb(tx)
+			pruneToBatch, err := hermezDb.GetBatchNoByL2Block(pm.History.PruneTo(headBlock))
+			if err != nil {
+				return err
+			}
+			if err = hermezDb.PruneBatchWitnesses(context.Background(), pruneToBatch); err != nil {
+				return err
+			}
+		}
+
+		if err := BeforeCommit(tx, nil, true); err != nil {
+			return err
+		}
+		return tx.Commit()
+	},
+}
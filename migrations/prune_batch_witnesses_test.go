@@ -0,0 +1,84 @@
+package migrations
+
+import (
+	"context"
+	"testing"
+
+	"github.com/ledgerwatch/erigon-lib/kv"
+	"github.com/ledgerwatch/erigon-lib/kv/memdb"
+	"github.com/ledgerwatch/erigon/eth/stagedsync/stages"
+	"github.com/ledgerwatch/erigon/ethdb/prune"
+	"github.com/ledgerwatch/erigon/zk/hermez_db"
+	"github.com/ledgerwatch/log/v3"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPruneBatchWitnesses(t *testing.T) {
+	// 10 blocks per batch up to block 50 and a witness cached for each batch
+	newDb := func(pruneHistory prune.BlockAmount) kv.RwDB {
+		db := memdb.NewTestDB(t)
+		err := db.Update(context.Background(), func(tx kv.RwTx) error {
+			if err := hermez_db.CreateHermezBuckets(tx); err != nil {
+				return err
+			}
+			hermezDb := hermez_db.NewHermezDb(tx)
+			for blockNo := uint64(1); blockNo <= 50; blockNo++ {
+				if err := hermezDb.WriteBlockBatch(blockNo, (blockNo+9)/10); err != nil {
+					return err
+				}
+			}
+			for batchNo := uint64(1); batchNo <= 5; batchNo++ {
+				if err := hermezDb.WriteWitness(batchNo, []byte{byte(batchNo)}); err != nil {
+					return err
+				}
+			}
+			if err := stages.SaveStageProgress(tx, stages.Execution, 50); err != nil {
+				return err
+			}
+			if pruneHistory == nil {
+				return nil
+			}
+			pm := prune.DefaultMode
+			pm.History = pruneHistory
+			return prune.Override(tx, pm)
+		})
+		require.NoError(t, err)
+		return db
+	}
+	witnesses := func(db kv.RwDB) (kept []uint64) {
+		err := db.View(context.Background(), func(tx kv.Tx) error {
+			hermezDb := hermez_db.NewHermezDbReader(tx)
+			for batchNo := uint64(1); batchNo <= 5; batchNo++ {
+				witness, err := hermezDb.GetWitness(batchNo)
+				if err != nil {
+					return err
+				}
+				if witness != nil {
+					kept = append(kept, batchNo)
+				}
+			}
+			return nil
+		})
+		require.NoError(t, err)
+		return kept
+	}
+	migrate := func(db kv.RwDB) {
+		migrator := NewMigrator(kv.ChainDB)
+		migrator.Migrations = []Migration{pruneBatchWitnesses}
+		require.NoError(t, migrator.Apply(db, t.TempDir(), log.New()))
+	}
+
+	// without history pruning the witnesses are kept
+	db := newDb(nil)
+	migrate(db)
+	require.Equal(t, []uint64{1, 2, 3, 4, 5}, witnesses(db))
+
+	// block 25 is the first one with history, so the batches before its batch 3 lose their witnesses
+	db = newDb(prune.Distance(25))
+	migrate(db)
+	require.Equal(t, []uint64{3, 4, 5}, witnesses(db))
+	err := db.View(context.Background(), func(tx kv.Tx) error {
+		return hermez_db.NewHermezDbReader(tx).CheckPruned(hermez_db.BATCH_WITNESSES, 2)
+	})
+	require.ErrorIs(t, err, hermez_db.ErrPruned)
+}
@@ -16,7 +16,10 @@
 
 package rpc
 
-import "fmt"
+import (
+	"fmt"
+	"time"
+)
 
 var (
 	_ Error = new(methodNotFoundError)
@@ -26,6 +29,7 @@ var (
 	_ Error = new(invalidMessageError)
 	_ Error = new(InvalidParamsError)
 	_ Error = new(CustomError)
+	_ Error = new(LimitExceededError)
 )
 
 const defaultErrorCode = -32000
@@ -89,3 +93,19 @@ type CustomError struct {
 func (e *CustomError) ErrorCode() int { return e.Code }
 
 func (e *CustomError) Error() string { return e.Message }
+
+// the client called more than its rate limit allows, RetryAfter is how long until the call would be let through
+type LimitExceededError struct {
+	Method     string
+	RetryAfter time.Duration
+}
+
+func (e *LimitExceededError) ErrorCode() int { return -32005 }
+
+func (e *LimitExceededError) Error() string {
+	return fmt.Sprintf("limit exceeded for %s", e.Method)
+}
+
+func (e *LimitExceededError) ErrorData() interface{} {
+	return map[string]interface{}{"retryAfter": e.RetryAfter.Seconds()}
+}
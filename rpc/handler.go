@@ -68,6 +68,9 @@ type handler struct {
 	allowList     AllowList // a list of explicitly allowed methods, if empty -- everything is allowed
 	forbiddenList ForbiddenList
 
+	rateLimiter     RateLimiter // limits the calls of the client, nil if they are unlimited
+	rateLimitClient RateLimitClient
+
 	subLock             sync.Mutex
 	serverSubs          map[ID]*Subscription
 	maxBatchConcurrency uint
@@ -463,6 +466,11 @@ func (h *handler) isMethodAllowedByGranularControl(method string) bool {
 // handleCall processes method calls.
 func (h *handler) handleCall(cp *callProc, msg *jsonrpcMessage, stream *jsoniter.Stream) *jsonrpcMessage {
 	if msg.isSubscribe() {
+		namespace := msg.namespace()
+		registered := msg.Method == namespace+subscribeMethodSuffix && h.reg.hasService(namespace)
+		if err := h.rateLimit(msg, registered); err != nil {
+			return msg.errorResponse(err)
+		}
 		return h.handleSubscribe(cp, msg, stream)
 	}
 	var callb *callback
@@ -471,6 +479,11 @@ func (h *handler) handleCall(cp *callProc, msg *jsonrpcMessage, stream *jsoniter
 	} else if h.isMethodAllowedByGranularControl(msg.Method) {
 		callb = h.reg.callback(msg.Method)
 	}
+	if callb != h.unsubscribeCb {
+		if err := h.rateLimit(msg, callb != nil); err != nil {
+			return msg.errorResponse(err)
+		}
+	}
 	if callb == nil {
 		return msg.errorResponse(&methodNotFoundError{method: msg.Method})
 	}
@@ -493,6 +506,19 @@ func (h *handler) handleCall(cp *callProc, msg *jsonrpcMessage, stream *jsoniter
 	return answer
 }
 
+// rateLimit takes the call from the client's budget.  Calls of methods that are not registered are all counted as
+// unknownRateLimitMethod, the method name is the client's own and the limiter labels its metrics with it.
+func (h *handler) rateLimit(msg *jsonrpcMessage, registered bool) error {
+	if h.rateLimiter == nil {
+		return nil
+	}
+	method := msg.Method
+	if !registered {
+		method = unknownRateLimitMethod
+	}
+	return h.rateLimiter.Allow(h.rateLimitClient, method)
+}
+
 // handleSubscribe processes *_subscribe method calls.
 func (h *handler) handleSubscribe(cp *callProc, msg *jsonrpcMessage, stream *jsoniter.Stream) *jsonrpcMessage {
 	if !h.allowSubscribe {
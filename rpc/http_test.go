@@ -19,8 +19,10 @@ package rpc
 import (
 	"net/http"
 	"net/http/httptest"
+	"reflect"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/ledgerwatch/log/v3"
 )
@@ -129,3 +131,61 @@ func TestHTTPRespBodyUnlimited(t *testing.T) {
 		t.Fatalf("response has wrong length %d, want %d", len(r), respLength)
 	}
 }
+
+type keyRateLimiter struct {
+	clients []RateLimitClient
+	methods []string
+}
+
+func (l *keyRateLimiter) Allow(client RateLimitClient, method string) error {
+	l.clients = append(l.clients, client)
+	l.methods = append(l.methods, method)
+	if client.APIKey == "" {
+		return &LimitExceededError{Method: method, RetryAfter: time.Second}
+	}
+	return nil
+}
+
+func TestHTTPRateLimit(t *testing.T) {
+	logger := log.New()
+	s := newTestServer(logger)
+	defer s.Stop()
+	limiter := &keyRateLimiter{}
+	s.SetRateLimiter(limiter)
+	ts := httptest.NewServer(s)
+	defer ts.Close()
+
+	c, err := DialHTTP(ts.URL, logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	err = c.Call(nil, "test_noArgsRets")
+	if ec, ok := err.(Error); !ok || ec.ErrorCode() != -32005 {
+		t.Fatalf("expected limit exceeded error, got %v", err)
+	}
+	if de, ok := err.(DataError); !ok || de.ErrorData().(map[string]interface{})["retryAfter"] != float64(1) {
+		t.Fatalf("expected retryAfter in error data, got %v", err)
+	}
+
+	c.SetHeader(APIKeyHeader, "key")
+	var res echoResult
+	if err := c.Call(&res, "test_echo", "x", 1); err != nil {
+		t.Fatal(err)
+	}
+	if len(limiter.clients) != 2 || limiter.clients[1].APIKey != "key" || limiter.clients[1].IP != "127.0.0.1" {
+		t.Fatalf("wrong clients passed to the rate limiter: %v", limiter.clients)
+	}
+
+	// made up method names never reach the limiter, they could break its metrics
+	if err := c.Call(nil, `test_"made up`); err == nil {
+		t.Fatal("expected method not found error")
+	}
+	if err := c.Call(nil, `test_x"_subscribe`); err == nil {
+		t.Fatal("expected subscription error")
+	}
+	if want := []string{"test_noArgsRets", "test_echo", "unknown", "unknown"}; !reflect.DeepEqual(limiter.methods, want) {
+		t.Fatalf("wrong methods passed to the rate limiter: %v, want %v", limiter.methods, want)
+	}
+}
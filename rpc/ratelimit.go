@@ -0,0 +1,33 @@
+package rpc
+
+import "net"
+
+// APIKeyHeader is the HTTP header clients can identify themselves with to the rate limiter instead of by their IP
+const APIKeyHeader = "X-Api-Key"
+
+// RateLimitClient is who a call is counted against by the rate limiter.  The IP is the one of the connection, clients
+// behind a proxy all share the proxy's.
+type RateLimitClient struct {
+	APIKey string
+	IP     string
+}
+
+// unknownRateLimitMethod is the method the calls of unregistered methods are counted as
+const unknownRateLimitMethod = "unknown"
+
+// RateLimiter limits how often clients can call methods
+type RateLimiter interface {
+	// Allow returns the error to answer the call with if the client is over its limit, usually a *LimitExceededError.
+	// The method is always a registered one or "unknown".
+	Allow(client RateLimitClient, method string) error
+}
+
+type rateLimitClientKey struct{}
+
+func newRateLimitClient(apiKey, remoteAddr string) RateLimitClient {
+	host, _, err := net.SplitHostPort(remoteAddr)
+	if err != nil {
+		host = remoteAddr
+	}
+	return RateLimitClient{APIKey: apiKey, IP: host}
+}
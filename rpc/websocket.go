@@ -64,6 +64,7 @@ func (s *Server) WebsocketHandler(allowedOrigins []string, jwtSecret []byte, com
 			return
 		}
 		codec := NewWebsocketCodec(conn)
+		codec.(*websocketCodec).rateLimitClient = newRateLimitClient(r.Header.Get(APIKeyHeader), r.RemoteAddr)
 		s.ServeCodec(codec, 0)
 	})
 }
@@ -246,6 +247,8 @@ type websocketCodec struct {
 
 	wg        sync.WaitGroup
 	pingReset chan struct{}
+
+	rateLimitClient RateLimitClient
 }
 
 func NewWebsocketCodec(conn *websocket.Conn) ServerCodec {
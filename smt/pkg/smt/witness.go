@@ -2,8 +2,11 @@ package smt
 
 import (
 	"context"
+	"fmt"
+	"math/big"
 
 	libcommon "github.com/ledgerwatch/erigon-lib/common"
+	"github.com/ledgerwatch/erigon/smt/pkg/db"
 	"github.com/ledgerwatch/erigon/smt/pkg/utils"
 	"github.com/ledgerwatch/erigon/turbo/trie"
 )
@@ -112,3 +115,120 @@ func BuildWitness(s *SMT, rd trie.RetainDecider, ctx context.Context) (*trie.Wit
 
 	return trie.NewWitness(operands), err
 }
+
+// BuildSMTFromWitness rebuilds the partial tree a witness was made from in memory.  Nodes that were not retained in the
+// witness are kept as their hash only so the root matches the tree the witness was built from, the tree can only be
+// modified along the paths the witness retained.
+func BuildSMTFromWitness(w *trie.Witness) (*SMT, error) {
+	memDb := db.NewMemDb()
+	s := NewSMT(memDb, false)
+
+	b := &witnessTreeBuilder{s: s, memDb: memDb, operators: w.Operators}
+	root, err := b.build(0)
+	if err != nil {
+		return nil, err
+	}
+	if b.position != len(b.operators) {
+		return nil, fmt.Errorf("unexpected witness operator %T at position %d", b.operators[b.position], b.position)
+	}
+
+	if err = s.setLastRoot(root); err != nil {
+		return nil, err
+	}
+	s.updateDepth(b.maxLevel)
+
+	return s, nil
+}
+
+type witnessTreeBuilder struct {
+	s         *SMT
+	memDb     *db.MemDb
+	operators []trie.WitnessOperator
+	position  int
+	maxLevel  int
+}
+
+// build consumes the operators of the node at the given level, operators come in the pre-order BuildWitness traverses
+// the tree in, and returns its hash
+func (b *witnessTreeBuilder) build(level int) (utils.NodeKey, error) {
+	if b.position >= len(b.operators) {
+		if level == 0 {
+			// an empty witness is an empty tree
+			return utils.NodeKey{}, nil
+		}
+		return utils.NodeKey{}, fmt.Errorf("witness ended unexpectedly at level %d", level)
+	}
+
+	operator := b.operators[b.position]
+	b.position++
+
+	switch op := operator.(type) {
+	case *trie.OperatorBranch:
+		var children [2]utils.NodeKey
+		for i := 0; i < 2; i++ {
+			if op.Mask&(1<<i) == 0 {
+				continue
+			}
+			child, err := b.build(level + 1)
+			if err != nil {
+				return utils.NodeKey{}, err
+			}
+			children[i] = child
+		}
+		return b.s.hashcalcAndSave(utils.ConcatArrays4(children[0], children[1]), utils.BranchCapacity)
+	case *trie.OperatorHash:
+		return utils.ScalarToRoot(op.Hash.Big()), nil
+	case *trie.OperatorCode:
+		// the code comes right before the leaf holding its hash
+		if err := b.memDb.AddCode(op.Code); err != nil {
+			return utils.NodeKey{}, err
+		}
+		return b.build(level)
+	case *trie.OperatorSMTLeafValue:
+		return b.leaf(op, level)
+	default:
+		return utils.NodeKey{}, fmt.Errorf("unexpected witness operator %T at position %d", operator, b.position-1)
+	}
+}
+
+func (b *witnessTreeBuilder) leaf(op *trie.OperatorSMTLeafValue, level int) (utils.NodeKey, error) {
+	address := libcommon.BytesToAddress(op.Address)
+	var storageKey libcommon.Hash
+
+	var key utils.NodeKey
+	switch t := int(op.NodeType); t {
+	case utils.KEY_BALANCE, utils.KEY_NONCE, utils.SC_CODE, utils.SC_LENGTH:
+		key = utils.Key(address.String(), t)
+	case utils.SC_STORAGE:
+		storageKey = libcommon.BytesToHash(op.StorageKey)
+		key = utils.KeyContractStorage(utils.ScalarToArrayBig(utils.ConvertHexToBigInt(address.String())), storageKey.String())
+	default:
+		return utils.NodeKey{}, fmt.Errorf("unexpected smt leaf type %d", op.NodeType)
+	}
+
+	value, err := utils.NodeValue8FromBigIntArray(utils.ScalarToArrayBig(new(big.Int).SetBytes(op.Value)))
+	if err != nil {
+		return utils.NodeKey{}, err
+	}
+	valueHash, err := b.s.hashcalcAndSave(value.ToUintArray(), utils.BranchCapacity)
+	if err != nil {
+		return utils.NodeKey{}, err
+	}
+
+	leafHash, err := b.s.hashcalcAndSave(utils.ConcatArrays4(utils.RemoveKeyBits(key, level), valueHash), utils.LeafCapacity)
+	if err != nil {
+		return utils.NodeKey{}, err
+	}
+	if err = b.s.Db.InsertHashKey(leafHash, key); err != nil {
+		return utils.NodeKey{}, err
+	}
+	if err = b.s.Db.InsertKeySource(key, utils.EncodeKeySource(int(op.NodeType), address, storageKey)); err != nil {
+		return utils.NodeKey{}, err
+	}
+
+	if level > b.maxLevel {
+		b.maxLevel = level
+	}
+
+	return leafHash, nil
+}
@@ -5,6 +5,7 @@ import (
 	"context"
 	"encoding/hex"
 	"fmt"
+	"math/big"
 	"testing"
 
 	"github.com/holiman/uint256"
@@ -158,3 +159,66 @@ func TestSMTWitnessRetainListEmptyVal(t *testing.T) {
 		t.Errorf("witness contains unexpected operator")
 	}
 }
+
+func TestBuildSMTFromWitness(t *testing.T) {
+	smtTrie, rl := prepareSMT(t)
+
+	contract := libcommon.HexToAddress("0x71dd1027069078091B3ca48093B00E4735B20624")
+	sKey := libcommon.HexToHash("0x5")
+
+	for name, retain := range map[string]trie.RetainDecider{"full": nil, "retain list": rl} {
+		t.Run(name, func(t *testing.T) {
+			witness, err := smt.BuildWitness(smtTrie, retain, context.Background())
+			if err != nil {
+				t.Fatalf("error building witness: %v", err)
+			}
+
+			// go through the wire format as the executor would
+			var buf bytes.Buffer
+			if _, err = witness.WriteInto(&buf, false); err != nil {
+				t.Fatalf("error writing witness: %v", err)
+			}
+			decoded, err := trie.NewWitnessFromReader(&buf, false)
+			if err != nil {
+				t.Fatalf("error reading witness: %v", err)
+			}
+
+			rebuilt, err := smt.BuildSMTFromWitness(decoded)
+			if err != nil {
+				t.Fatalf("error building smt from witness: %v", err)
+			}
+			if rebuilt.LastRoot().Cmp(smtTrie.LastRoot()) != 0 {
+				t.Fatalf("rebuilt root %x, expected %x", rebuilt.LastRoot(), smtTrie.LastRoot())
+			}
+
+			// the retained paths can be modified and give the same root as the full tree
+			full, err := smt.BuildWitness(smtTrie, nil, context.Background())
+			if err != nil {
+				t.Fatalf("error building witness: %v", err)
+			}
+			expected, err := smt.BuildSMTFromWitness(full)
+			if err != nil {
+				t.Fatalf("error building smt from witness: %v", err)
+			}
+			for _, s := range []*smt.SMT{rebuilt, expected} {
+				if _, err = s.SetAccountState(contract.String(), big.NewInt(5), big.NewInt(2)); err != nil {
+					t.Fatalf("error setting account state: %v", err)
+				}
+				if _, err = s.SetContractStorage(contract.String(), map[string]string{sKey.String(): "0x0"}, nil); err != nil {
+					t.Fatalf("error setting storage: %v", err)
+				}
+			}
+			if rebuilt.LastRoot().Cmp(expected.LastRoot()) != 0 {
+				t.Fatalf("modified root %x, expected %x", rebuilt.LastRoot(), expected.LastRoot())
+			}
+		})
+	}
+
+	empty, err := smt.BuildSMTFromWitness(trie.NewWitness(nil))
+	if err != nil {
+		t.Fatalf("error building smt from empty witness: %v", err)
+	}
+	if empty.LastRoot().Sign() != 0 {
+		t.Errorf("empty witness gave root %x", empty.LastRoot())
+	}
+}
@@ -177,10 +177,13 @@ var DefaultFlags = []cli.Flag{
 	&utils.L2DataStreamerTimeout,
 	&utils.L1SyncStartBlock,
 	&utils.L1SyncStopBatch,
+	&utils.L1SyncArchive,
 	&utils.L1ChainIdFlag,
 	&utils.L1RpcUrlFlag,
 	&utils.L1CacheEnabledFlag,
 	&utils.L1CachePortFlag,
+	&utils.L1CacheAdminPortFlag,
+	&utils.L1CacheMethodTTLsFlag,
 	&utils.AddressSequencerFlag,
 	&utils.AddressAdminFlag,
 	&utils.AddressRollupFlag,
@@ -196,11 +199,18 @@ var DefaultFlags = []cli.Flag{
 	&utils.L1ContractAddressCheckFlag,
 	&utils.L1ContractAddressRetrieveFlag,
 	&utils.RpcRateLimitsFlag,
+	&utils.RpcRateLimitConfigFlag,
 	&utils.RpcGetBatchWitnessConcurrencyLimitFlag,
 	&utils.DatastreamVersionFlag,
 	&utils.RebuildTreeAfterFlag,
 	&utils.IncrementTreeAlways,
 	&utils.SmtRegenerateInMemory,
+	&utils.ConsistencyCheckBlocksFlag,
+	&utils.PruneIntermediateTxStateRootsFlag,
+	&utils.PruneBatchCountersFlag,
+	&utils.PruneSmtDepthsFlag,
+	&utils.PruneL1BatchDataFlag,
+	&utils.PruneExecutorDivergencesFlag,
 	&utils.SequencerBlockSealTime,
 	&utils.SequencerBatchSealTime,
 	&utils.SequencerBatchVerificationTimeout,
@@ -210,14 +220,22 @@ var DefaultFlags = []cli.Flag{
 	&utils.SequencerResequence,
 	&utils.SequencerResequenceStrict,
 	&utils.SequencerResequenceReuseL1InfoIndex,
+	&utils.SequencerShadowFork,
+	&utils.SequencerShadowForkStartBlock,
+	&utils.SequencerShadowForkReport,
 	&utils.ExecutorUrls,
 	&utils.ExecutorStrictMode,
 	&utils.ExecutorRequestTimeout,
 	&utils.DatastreamNewBlockTimeout,
 	&utils.WitnessMemdbSize,
 	&utils.ExecutorMaxConcurrentRequests,
+	&utils.ExecutorUrlSettings,
+	&utils.ExecutorBreakerErrorRate,
+	&utils.ExecutorBreakerCooldown,
+	&utils.ExecutorHedgeAfter,
 	&utils.Limbo,
 	&utils.AllowFreeTransactions,
+	&utils.GaslessSponsorship,
 	&utils.AllowPreEIP155Transactions,
 	&utils.EffectiveGasPriceForEthTransfer,
 	&utils.EffectiveGasPriceForErc20Transfer,
@@ -226,11 +244,19 @@ var DefaultFlags = []cli.Flag{
 	&utils.DefaultGasPrice,
 	&utils.MaxGasPrice,
 	&utils.GasPriceFactor,
+	&utils.DynamicGasPrice,
+	&utils.DynamicGasPriceL1Samples,
+	&utils.DynamicGasPriceBatchWindow,
+	&utils.DynamicGasPriceSaturationTarget,
+	&utils.DynamicGasPriceMaxMultiplier,
 	&utils.DataStreamHost,
 	&utils.DataStreamPort,
 	&utils.DataStreamWriteTimeout,
 	&utils.DataStreamInactivityTimeout,
 	&utils.DataStreamInactivityCheckInterval,
+	&utils.DataStreamAuditMode,
+	&utils.DataStreamAuditInterval,
+	&utils.DataStreamAuditBatches,
 	&utils.WitnessFullFlag,
 	&utils.SyncLimit,
 	&utils.ExecutorPayloadOutput,
@@ -277,6 +303,12 @@ var DefaultFlags = []cli.Flag{
 	&SyncLoopBreakAfterFlag,
 	&SyncLoopPruneLimitFlag,
 	&utils.PoolManagerUrl,
+	&utils.TxForwardQueueSize,
+	&utils.TxForwardBatchSize,
+	&utils.TxForwardRetries,
+	&utils.TxForwardBackoff,
+	&utils.TxForwardPendingTTL,
+	&utils.TxForwardValidate,
 	&utils.TxPoolRejectSmartContractDeployments,
 	&utils.DisableVirtualCounters,
 	&utils.DAUrl,
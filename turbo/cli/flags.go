@@ -516,6 +516,7 @@ func setEmbeddedRpcDaemon(ctx *cli.Context, cfg *nodecfg.Config, logger log.Logg
 		DataStreamInactivityTimeout:       ctx.Duration(utils.DataStreamInactivityTimeout.Name),
 		DataStreamInactivityCheckInterval: ctx.Duration(utils.DataStreamInactivityCheckInterval.Name),
 		L2RpcUrl:                          ctx.String(utils.L2RpcUrlFlag.Name),
+		RpcRateLimitConfig:                ctx.String(utils.RpcRateLimitConfigFlag.Name),
 	}
 
 	if ctx.IsSet(utils.HttpCompressionFlag.Name) {
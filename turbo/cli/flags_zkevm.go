@@ -11,6 +11,9 @@ import (
 	libcommon "github.com/ledgerwatch/erigon-lib/common"
 	"github.com/ledgerwatch/erigon/cmd/utils"
 	"github.com/ledgerwatch/erigon/eth/ethconfig"
+	"github.com/ledgerwatch/erigon/zk/hermez_db"
+	"github.com/ledgerwatch/erigon/zk/l1_cache"
+	"github.com/ledgerwatch/erigon/zk/legacy_executor_verifier"
 	"github.com/ledgerwatch/erigon/zk/sequencer"
 	utils2 "github.com/ledgerwatch/erigon/zk/utils"
 	"github.com/urfave/cli/v2"
@@ -112,6 +115,19 @@ func ApplyFlagsForZkConfig(ctx *cli.Context, cfg *ethconfig.Config) {
 
 	witnessMemSize := utils.DatasizeFlagValue(ctx, utils.WitnessMemdbSize.Name)
 
+	l1CacheMethodTTLs, err := l1_cache.ParseMethodTTLs(ctx.String(utils.L1CacheMethodTTLsFlag.Name))
+	if err != nil {
+		panic(fmt.Sprintf("could not parse l1 cache method ttls: %s", err))
+	}
+
+	zkPrune := hermez_db.PruneMode{
+		IntermediateTxStateRoots: ctx.Uint64(utils.PruneIntermediateTxStateRootsFlag.Name),
+		BatchCounters:            ctx.Uint64(utils.PruneBatchCountersFlag.Name),
+		SmtDepths:                ctx.Uint64(utils.PruneSmtDepthsFlag.Name),
+		L1BatchData:              ctx.Uint64(utils.PruneL1BatchDataFlag.Name),
+		ExecutorDivergences:      ctx.Uint64(utils.PruneExecutorDivergencesFlag.Name),
+	}
+
 	cfg.Zk = &ethconfig.Zk{
 		L2ChainId:                              ctx.Uint64(utils.L2ChainIdFlag.Name),
 		L2RpcUrl:                               ctx.String(utils.L2RpcUrlFlag.Name),
@@ -119,10 +135,13 @@ func ApplyFlagsForZkConfig(ctx *cli.Context, cfg *ethconfig.Config) {
 		L2DataStreamerTimeout:                  l2DataStreamTimeout,
 		L1SyncStartBlock:                       ctx.Uint64(utils.L1SyncStartBlock.Name),
 		L1SyncStopBatch:                        ctx.Uint64(utils.L1SyncStopBatch.Name),
+		L1SyncArchive:                          ctx.String(utils.L1SyncArchive.Name),
 		L1ChainId:                              ctx.Uint64(utils.L1ChainIdFlag.Name),
 		L1RpcUrl:                               ctx.String(utils.L1RpcUrlFlag.Name),
 		L1CacheEnabled:                         ctx.Bool(utils.L1CacheEnabledFlag.Name),
 		L1CachePort:                            ctx.Uint(utils.L1CachePortFlag.Name),
+		L1CacheAdminPort:                       ctx.Uint(utils.L1CacheAdminPortFlag.Name),
+		L1CacheMethodTTLs:                      l1CacheMethodTTLs,
 		AddressSequencer:                       libcommon.HexToAddress(ctx.String(utils.AddressSequencerFlag.Name)),
 		AddressAdmin:                           libcommon.HexToAddress(ctx.String(utils.AddressAdminFlag.Name)),
 		AddressRollup:                          libcommon.HexToAddress(ctx.String(utils.AddressRollupFlag.Name)),
@@ -142,6 +161,8 @@ func ApplyFlagsForZkConfig(ctx *cli.Context, cfg *ethconfig.Config) {
 		RebuildTreeAfter:                       ctx.Uint64(utils.RebuildTreeAfterFlag.Name),
 		IncrementTreeAlways:                    ctx.Bool(utils.IncrementTreeAlways.Name),
 		SmtRegenerateInMemory:                  ctx.Bool(utils.SmtRegenerateInMemory.Name),
+		ConsistencyCheckBlocks:                 ctx.Uint64(utils.ConsistencyCheckBlocksFlag.Name),
+		Prune:                                  zkPrune,
 		SequencerBlockSealTime:                 sequencerBlockSealTime,
 		SequencerBatchSealTime:                 sequencerBatchSealTime,
 		SequencerBatchVerificationTimeout:      sequencerBatchVerificationTimeout,
@@ -151,14 +172,22 @@ func ApplyFlagsForZkConfig(ctx *cli.Context, cfg *ethconfig.Config) {
 		SequencerResequence:                    ctx.Bool(utils.SequencerResequence.Name),
 		SequencerResequenceStrict:              ctx.Bool(utils.SequencerResequenceStrict.Name),
 		SequencerResequenceReuseL1InfoIndex:    ctx.Bool(utils.SequencerResequenceReuseL1InfoIndex.Name),
+		SequencerShadowFork:                    ctx.Bool(utils.SequencerShadowFork.Name),
+		SequencerShadowForkStartBlock:          ctx.Uint64(utils.SequencerShadowForkStartBlock.Name),
+		SequencerShadowForkReport:              ctx.String(utils.SequencerShadowForkReport.Name),
 		ExecutorUrls:                           strings.Split(strings.ReplaceAll(ctx.String(utils.ExecutorUrls.Name), " ", ""), ","),
 		ExecutorStrictMode:                     ctx.Bool(utils.ExecutorStrictMode.Name),
 		ExecutorRequestTimeout:                 ctx.Duration(utils.ExecutorRequestTimeout.Name),
 		DatastreamNewBlockTimeout:              ctx.Duration(utils.DatastreamNewBlockTimeout.Name),
 		WitnessMemdbSize:                       *witnessMemSize,
 		ExecutorMaxConcurrentRequests:          ctx.Int(utils.ExecutorMaxConcurrentRequests.Name),
+		ExecutorUrlSettings:                    ctx.String(utils.ExecutorUrlSettings.Name),
+		ExecutorBreakerErrorRate:               ctx.Float64(utils.ExecutorBreakerErrorRate.Name),
+		ExecutorBreakerCooldown:                ctx.Duration(utils.ExecutorBreakerCooldown.Name),
+		ExecutorHedgeAfter:                     ctx.Duration(utils.ExecutorHedgeAfter.Name),
 		Limbo:                                  ctx.Bool(utils.Limbo.Name),
 		AllowFreeTransactions:                  ctx.Bool(utils.AllowFreeTransactions.Name),
+		GaslessSponsorship:                     ctx.Bool(utils.GaslessSponsorship.Name),
 		AllowPreEIP155Transactions:             ctx.Bool(utils.AllowPreEIP155Transactions.Name),
 		EffectiveGasPriceForEthTransfer:        uint8(math.Round(effectiveGasPriceForEthTransferVal * 255.0)),
 		EffectiveGasPriceForErc20Transfer:      uint8(math.Round(effectiveGasPriceForErc20TransferVal * 255.0)),
@@ -167,6 +196,11 @@ func ApplyFlagsForZkConfig(ctx *cli.Context, cfg *ethconfig.Config) {
 		DefaultGasPrice:                        ctx.Uint64(utils.DefaultGasPrice.Name),
 		MaxGasPrice:                            ctx.Uint64(utils.MaxGasPrice.Name),
 		GasPriceFactor:                         ctx.Float64(utils.GasPriceFactor.Name),
+		DynamicGasPrice:                        ctx.Bool(utils.DynamicGasPrice.Name),
+		DynamicGasPriceL1Samples:               ctx.Int(utils.DynamicGasPriceL1Samples.Name),
+		DynamicGasPriceBatchWindow:             ctx.Int(utils.DynamicGasPriceBatchWindow.Name),
+		DynamicGasPriceSaturationTarget:        ctx.Float64(utils.DynamicGasPriceSaturationTarget.Name),
+		DynamicGasPriceMaxMultiplier:           ctx.Float64(utils.DynamicGasPriceMaxMultiplier.Name),
 		WitnessFull:                            ctx.Bool(utils.WitnessFullFlag.Name),
 		SyncLimit:                              ctx.Uint64(utils.SyncLimit.Name),
 		DebugTimers:                            ctx.Bool(utils.DebugTimers.Name),
@@ -175,6 +209,12 @@ func ApplyFlagsForZkConfig(ctx *cli.Context, cfg *ethconfig.Config) {
 		DebugStep:                              ctx.Uint64(utils.DebugStep.Name),
 		DebugStepAfter:                         ctx.Uint64(utils.DebugStepAfter.Name),
 		PoolManagerUrl:                         ctx.String(utils.PoolManagerUrl.Name),
+		TxForwardQueueSize:                     ctx.Int(utils.TxForwardQueueSize.Name),
+		TxForwardBatchSize:                     ctx.Int(utils.TxForwardBatchSize.Name),
+		TxForwardRetries:                       ctx.Int(utils.TxForwardRetries.Name),
+		TxForwardBackoff:                       ctx.Duration(utils.TxForwardBackoff.Name),
+		TxForwardPendingTTL:                    ctx.Duration(utils.TxForwardPendingTTL.Name),
+		TxForwardValidate:                      ctx.Bool(utils.TxForwardValidate.Name),
 		TxPoolRejectSmartContractDeployments:   ctx.Bool(utils.TxPoolRejectSmartContractDeployments.Name),
 		DisableVirtualCounters:                 ctx.Bool(utils.DisableVirtualCounters.Name),
 		ExecutorPayloadOutput:                  ctx.String(utils.ExecutorPayloadOutput.Name),
@@ -183,6 +223,9 @@ func ApplyFlagsForZkConfig(ctx *cli.Context, cfg *ethconfig.Config) {
 		DataStreamPort:                         ctx.Uint(utils.DataStreamPort.Name),
 		DataStreamWriteTimeout:                 ctx.Duration(utils.DataStreamWriteTimeout.Name),
 		DataStreamInactivityTimeout:            ctx.Duration(utils.DataStreamInactivityTimeout.Name),
+		DataStreamAuditMode:                    ctx.String(utils.DataStreamAuditMode.Name),
+		DataStreamAuditInterval:                ctx.Duration(utils.DataStreamAuditInterval.Name),
+		DataStreamAuditBatches:                 ctx.Uint64(utils.DataStreamAuditBatches.Name),
 		VirtualCountersSmtReduction:            ctx.Float64(utils.VirtualCountersSmtReduction.Name),
 		InitialBatchCfgFile:                    ctx.String(utils.InitialBatchCfgFile.Name),
 		ACLPrintHistory:                        ctx.Int(utils.ACLPrintHistory.Name),
@@ -217,6 +260,18 @@ func ApplyFlagsForZkConfig(ctx *cli.Context, cfg *ethconfig.Config) {
 		if len(cfg.ExecutorUrls) > 0 && cfg.ExecutorUrls[0] != "" && cfg.DisableVirtualCounters {
 			panic("You cannot disable virtual counters when running with executors")
 		}
+
+		if _, err := legacy_executor_verifier.ParseExecutorSettings(cfg.ExecutorUrlSettings); err != nil {
+			panic(fmt.Sprintf("invalid %s: %v", utils.ExecutorUrlSettings.Name, err))
+		}
+
+		if cfg.SequencerShadowFork {
+			// the source chain of the shadow fork is read from the datastream of its node
+			checkFlag(utils.L2DataStreamerUrlFlag.Name, cfg.L2DataStreamerUrl)
+			if cfg.SequencerResequence {
+				panic(fmt.Sprintf("You cannot enable both %s and %s", utils.SequencerShadowFork.Name, utils.SequencerResequence.Name))
+			}
+		}
 	}
 
 	checkFlag(utils.AddressZkevmFlag.Name, cfg.AddressZkevm)
@@ -17,8 +17,12 @@ import (
 	"github.com/ledgerwatch/erigon/rpc"
 	"github.com/ledgerwatch/erigon/turbo/rpchelper"
 	"github.com/ledgerwatch/erigon/turbo/services"
+	"github.com/ledgerwatch/erigon/zk/datastream/audit"
+	zkevents "github.com/ledgerwatch/erigon/zk/events"
+	"github.com/ledgerwatch/erigon/zk/fee_oracle"
 	"github.com/ledgerwatch/erigon/zk/sequencer"
 	"github.com/ledgerwatch/erigon/zk/syncer"
+	"github.com/ledgerwatch/erigon/zk/tx_forwarder"
 
 	txpool2 "github.com/ledgerwatch/erigon/zk/txpool"
 	"github.com/0xPolygonHermez/zkevm-data-streamer/datastreamer"
@@ -29,6 +33,7 @@ func APIList(db kv.RoDB, eth rpchelper.ApiBackend, txPool txpool.TxpoolClient, r
 	filters *rpchelper.Filters, stateCache kvcache.Cache,
 	blockReader services.FullBlockReader, agg *libstate.Aggregator, cfg *httpcfg.HttpCfg, engine consensus.EngineReader,
 	ethCfg *ethconfig.Config, l1Syncer *syncer.L1Syncer, logger log.Logger, datastreamServer *datastreamer.StreamServer,
+	feeOracle *fee_oracle.Oracle, zkEvents *zkevents.Feed, dataStreamAudit *audit.Auditor, txForwarder *tx_forwarder.Forwarder,
 ) (list []rpc.API) {
 	// non-sequencer nodes should forward on requests to the sequencer
 	rpcUrl := ""
@@ -39,6 +44,19 @@ func APIList(db kv.RoDB, eth rpchelper.ApiBackend, txPool txpool.TxpoolClient, r
 	base := NewBaseApi(filters, stateCache, blockReader, agg, cfg.WithDatadir, cfg.EvmCallTimeout, engine, cfg.Dirs)
 	base.SetL2RpcUrl(ethCfg.Zk.L2RpcUrl)
 	base.SetGasless(ethCfg.AllowFreeTransactions)
+	if feeOracle == nil {
+		feeOracle = fee_oracle.NewOracleFromZk(ethCfg.Zk)
+	}
+	base.SetFeeOracle(feeOracle)
+	if !sequencer.IsSequencer() {
+		if txForwarder == nil {
+			txForwarder = tx_forwarder.NewFromZk(ethCfg.Zk)
+		}
+		base.SetTxForwarder(txForwarder)
+		if rawPool != nil {
+			base.SetTxAllowList(rawPool)
+		}
+	}
 	ethImpl := NewEthAPI(base, db, eth, txPool, mining, cfg.Gascap, cfg.Feecap, cfg.ReturnDataLimit, ethCfg, cfg.AllowUnprotectedTxs, cfg.MaxGetProofRewindBlockCount, cfg.WebsocketSubscribeLogsChannelSize, logger)
 	erigonImpl := NewErigonAPI(base, db, eth)
 	txpoolImpl := NewTxPoolAPI(base, db, txPool, rawPool, rpcUrl)
@@ -69,7 +87,13 @@ func APIList(db kv.RoDB, eth rpchelper.ApiBackend, txPool txpool.TxpoolClient, r
 	otsImpl := NewOtterscanAPI(base, db, cfg.OtsMaxPageSize)
 	gqlImpl := NewGraphQLAPI(base, db)
 	overlayImpl := NewOverlayAPI(base, db, cfg.Gascap, cfg.OverlayGetLogsTimeout, cfg.OverlayReplayBlockTimeout, otsImpl)
-	zkEvmImpl := NewZkEvmAPI(ethImpl, db, cfg.ReturnDataLimit, ethCfg, l1Syncer, rpcUrl, datastreamServer)
+	zkEvmImpl := NewZkEvmAPI(ethImpl, db, cfg.ReturnDataLimit, ethCfg, l1Syncer, rpcUrl, datastreamServer, zkEvents)
+	if rawPool != nil {
+		zkEvmImpl.sponsors = rawPool
+	}
+	if dataStreamAudit != nil {
+		zkEvmImpl.dataStreamAudit = dataStreamAudit
+	}
 
 	if cfg.GraphQLEnabled {
 		list = append(list, rpc.API{
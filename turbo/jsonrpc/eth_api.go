@@ -38,7 +38,9 @@ import (
 	ethapi2 "github.com/ledgerwatch/erigon/turbo/adapter/ethapi"
 	"github.com/ledgerwatch/erigon/turbo/rpchelper"
 	"github.com/ledgerwatch/erigon/turbo/services"
+	"github.com/ledgerwatch/erigon/zk/fee_oracle"
 	"github.com/ledgerwatch/erigon/zk/hermez_db"
+	"github.com/ledgerwatch/erigon/zk/tx_forwarder"
 	"github.com/ledgerwatch/erigon/zk/utils"
 )
 
@@ -131,6 +133,9 @@ type BaseAPI struct {
 	dirs           datadir.Dirs
 	l2RpcUrl       string
 	gasless        bool
+	feeOracle      *fee_oracle.Oracle
+	txForwarder    *tx_forwarder.Forwarder
+	txAcl          txAllowList
 }
 
 func NewBaseApi(f *rpchelper.Filters, stateCache kvcache.Cache, blockReader services.FullBlockReader, agg *libstate.Aggregator, singleNodeMode bool, evmCallTimeout time.Duration, engine consensus.EngineReader, dirs datadir.Dirs) *BaseAPI {
@@ -363,6 +368,7 @@ type APIImpl struct {
 	ReturnDataLimit             int
 	ZkRpcUrl                    string
 	PoolManagerUrl              string
+	ValidateForwardedTxs        bool
 	AllowFreeTransactions       bool
 	AllowPreEIP155Transactions  bool
 	AllowUnprotectedTxs         bool
@@ -396,6 +402,7 @@ func NewEthAPI(base *BaseAPI, db kv.RoDB, eth rpchelper.ApiBackend, txPool txpoo
 		ReturnDataLimit:             returnDataLimit,
 		ZkRpcUrl:                    ethCfg.L2RpcUrl,
 		PoolManagerUrl:              ethCfg.PoolManagerUrl,
+		ValidateForwardedTxs:        ethCfg.TxForwardValidate,
 		AllowFreeTransactions:       ethCfg.AllowFreeTransactions,
 		AllowPreEIP155Transactions:  ethCfg.AllowPreEIP155Transactions,
 		MaxGetProofRewindBlockCount: maxGetProofRewindBlockCount,
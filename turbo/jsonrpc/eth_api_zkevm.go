@@ -6,10 +6,14 @@ import (
 	"github.com/ledgerwatch/erigon-lib/chain"
 	"github.com/ledgerwatch/erigon-lib/common"
 	"github.com/ledgerwatch/erigon-lib/common/hexutil"
+	"github.com/ledgerwatch/erigon-lib/kv"
 	types2 "github.com/ledgerwatch/erigon-lib/types"
 	"github.com/ledgerwatch/erigon/consensus/misc"
 	"github.com/ledgerwatch/erigon/core/types"
+	"github.com/ledgerwatch/erigon/zk/fee_oracle"
+	"github.com/ledgerwatch/erigon/zk/hermez_db"
 	zktx "github.com/ledgerwatch/erigon/zk/tx"
+	"github.com/ledgerwatch/erigon/zk/tx_forwarder"
 )
 
 func (api *BaseAPI) SetL2RpcUrl(url string) {
@@ -27,6 +31,24 @@ func (api *BaseAPI) SetGasless(gasless bool) {
 	api.gasless = gasless
 }
 
+func (api *BaseAPI) SetFeeOracle(feeOracle *fee_oracle.Oracle) {
+	api.feeOracle = feeOracle
+}
+
+func (api *BaseAPI) SetTxForwarder(txForwarder *tx_forwarder.Forwarder) {
+	api.txForwarder = txForwarder
+}
+
+func (api *BaseAPI) SetTxAllowList(txAcl txAllowList) {
+	api.txAcl = txAcl
+}
+
+// checkZkPruneHistory is checkPruneHistory for the zk tables pruned by the zkevm.prune.* flags, number is a block or a
+// batch number depending on the table
+func (api *BaseAPI) checkZkPruneHistory(tx kv.Tx, table string, number uint64) error {
+	return hermez_db.NewHermezDbReader(tx).CheckPruned(table, number)
+}
+
 // RPCTransaction represents a transaction that will serialize to the RPC representation of a transaction
 type RPCTransaction struct {
 	BlockHash           *common.Hash       `json:"blockHash"`
@@ -181,6 +181,9 @@ func (api *APIImpl) FeeHistory(ctx context.Context, blockCount rpc.DecimalOrHex,
 			results.BaseFee[i] = (*hexutil.Big)(v)
 		}
 	}
+	if err = api.applyFeeEstimate(tx, results); err != nil {
+		return nil, err
+	}
 	return results, nil
 }
 
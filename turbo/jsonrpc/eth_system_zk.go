@@ -9,6 +9,9 @@ import (
 	"time"
 
 	"github.com/ledgerwatch/erigon-lib/common/hexutil"
+	"github.com/ledgerwatch/erigon-lib/kv"
+	"github.com/ledgerwatch/erigon/zk/fee_oracle"
+	"github.com/ledgerwatch/erigon/zk/hermez_db"
 	"github.com/ledgerwatch/erigon/zkevm/encoding"
 	"github.com/ledgerwatch/erigon/zkevm/jsonrpc/client"
 	"github.com/ledgerwatch/log/v3"
@@ -67,6 +70,20 @@ func (api *APIImpl) GasPrice_nonRedirected(ctx context.Context) (*hexutil.Big, e
 		return &price, nil
 	}
 
+	if api.feeOracle != nil {
+		tx, err := api.db.BeginRo(ctx)
+		if err != nil {
+			return nil, err
+		}
+		defer tx.Rollback()
+
+		estimate, err := api.feeEstimate(tx)
+		if err != nil {
+			return nil, err
+		}
+		return truncateGasPrice(estimate.GasPrice)
+	}
+
 	// if gas price timestamp is older than 3 seconds, update it
 	if time.Since(api.L1GasPrice.timestamp) > 3*time.Second || api.L1GasPrice.gasPrice == nil {
 		l1GasPrice, err := api.l1GasPrice()
@@ -95,6 +112,11 @@ func (api *APIImpl) GasPrice_nonRedirected(ctx context.Context) (*hexutil.Big, e
 		result = maxGasPrice
 	}
 
+	return truncateGasPrice(result)
+}
+
+// truncateGasPrice keeps the 3 most significant digits of the gas price
+func truncateGasPrice(result *big.Int) (*hexutil.Big, error) {
 	var truncateValue *big.Int
 	log.Debug("Full L2 gas price value: ", result, ". Length: ", len(result.String()))
 	numLength := len(result.String())
@@ -139,3 +161,38 @@ func (api *APIImpl) l1GasPrice() (*big.Int, error) {
 
 	return price, nil
 }
+
+// feeEstimate returns the estimate of the fee oracle for the batch following the latest one, the latest batch being the
+// one the sequencer is still filling
+func (api *APIImpl) feeEstimate(tx kv.Tx) (*fee_oracle.Estimate, error) {
+	latestBatch, err := getLatestBatchNumber(tx)
+	if err != nil {
+		return nil, err
+	}
+
+	var lastClosedBatch uint64
+	if latestBatch > 0 {
+		lastClosedBatch = latestBatch - 1
+	}
+
+	return api.feeOracle.Estimate(hermez_db.NewHermezDbReader(tx), lastClosedBatch)
+}
+
+// applyFeeEstimate raises the base fee of the next block in a fee history to the gas price suggested by the fee oracle
+// so wallets pricing from eth_feeHistory are in line with eth_gasPrice
+func (api *APIImpl) applyFeeEstimate(tx kv.Tx, results *feeHistoryResult) error {
+	if api.feeOracle == nil || api.BaseAPI.gasless || len(results.BaseFee) == 0 {
+		return nil
+	}
+
+	estimate, err := api.feeEstimate(tx)
+	if err != nil {
+		return err
+	}
+
+	next := len(results.BaseFee) - 1
+	if results.BaseFee[next] == nil || results.BaseFee[next].ToInt().Cmp(estimate.GasPrice) < 0 {
+		results.BaseFee[next] = (*hexutil.Big)(new(big.Int).Set(estimate.GasPrice))
+	}
+	return nil
+}
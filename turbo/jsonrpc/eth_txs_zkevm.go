@@ -105,12 +105,23 @@ func (api *APIImpl) GetTransactionByHash(ctx context.Context, txnHash common.Has
 			return newRPCBorTransaction(borTx, txnHash, blockHash, blockNum, uint64(len(block.Transactions())), baseFee, chainConfig.ChainID), nil
 		}
 
+		api.txForwarder.Forget(txnHash)
 		return newRPCTransaction_zkevm(txn, blockHash, blockNum, txnIndex, baseFee, includel2TxHash), nil
 	}
 
 	if !sequencer.IsSequencer() {
 		// forward the request on to the sequencer at this point as it is the only node with an active txpool
-		return api.forwardGetTransactionByHash(api.l2RpcUrl, txnHash, includeExtraInfo)
+		res, err := api.forwardGetTransactionByHash(api.l2RpcUrl, txnHash, includeExtraInfo)
+		if err == nil && len(res) > 0 && string(res) != "null" {
+			return res, nil
+		}
+		// the sequencer may not have it yet if it was sent through a pool manager or is still queued for a retry
+		if txn := api.txForwarder.Pending(txnHash); txn != nil {
+			if curHeader := rawdb.ReadCurrentHeader(tx); curHeader != nil {
+				return newRPCPendingTransaction_zkevm(txn, curHeader, chainConfig, includel2TxHash), nil
+			}
+		}
+		return res, err
 	}
 
 	curHeader := rawdb.ReadCurrentHeader(tx)
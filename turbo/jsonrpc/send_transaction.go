@@ -32,14 +32,9 @@ func (api *APIImpl) SendRawTransaction(ctx context.Context, encodedTx hexutility
 	}
 	chainId := cc.ChainID
 
-	// [zkevm] - proxy the request if the chainID is ZK and not a sequencer
+	// [zkevm] - forward the request to the pool manager or the sequencer if the chainID is ZK and not a sequencer
 	if api.isZkNonSequencer(chainId) {
-		// [zkevm] - proxy the request to the pool manager if the pool manager is set
-		if api.isPoolManagerAddressSet() {
-			return api.sendTxZk(api.PoolManagerUrl, encodedTx, chainId.Uint64())
-		}
-
-		return api.sendTxZk(api.l2RpcUrl, encodedTx, chainId.Uint64())
+		return api.sendTxZk(ctx, tx, encodedTx)
 	}
 
 	txn, err := types.DecodeWrappedTransaction(encodedTx)
@@ -1,39 +1,123 @@
 package jsonrpc
 
 import (
+	"context"
+	"errors"
 	"fmt"
-	"strings"
 
 	"math/big"
 
+	"github.com/holiman/uint256"
 	zkchainconfig "github.com/ledgerwatch/erigon-lib/chain"
 	"github.com/ledgerwatch/erigon-lib/common"
 	"github.com/ledgerwatch/erigon-lib/common/hexutility"
+	"github.com/ledgerwatch/erigon-lib/kv"
+	"github.com/ledgerwatch/erigon/core"
+	"github.com/ledgerwatch/erigon/core/rawdb"
+	"github.com/ledgerwatch/erigon/core/types"
+	"github.com/ledgerwatch/erigon/rpc"
+	"github.com/ledgerwatch/erigon/turbo/rpchelper"
 	"github.com/ledgerwatch/erigon/zk/sequencer"
-	"github.com/ledgerwatch/erigon/zkevm/jsonrpc/client"
+	txpool2 "github.com/ledgerwatch/erigon/zk/txpool"
 )
 
-func (api *APIImpl) isPoolManagerAddressSet() bool {
-	return api.PoolManagerUrl != ""
+var errNoTxForwarder = errors.New("no pool manager or sequencer to forward transactions to")
+
+// txAllowList is the acl of the node's pool, checked before a transaction is forwarded
+type txAllowList interface {
+	IsTransactionAllowed(ctx context.Context, sender common.Address, creation bool) (bool, error)
 }
 
 func (api *APIImpl) isZkNonSequencer(chainId *big.Int) bool {
 	return !sequencer.IsSequencer() && zkchainconfig.IsZk(chainId.Uint64())
 }
 
-func (api *APIImpl) sendTxZk(rpcUrl string, encodedTx hexutility.Bytes, chainId uint64) (common.Hash, error) {
-	res, err := client.JSONRPCCall(rpcUrl, "eth_sendRawTransaction", encodedTx)
+// sendTxZk forwards the transaction to the pool manager or the sequencer, checking it against the latest state
+// first so the obviously invalid ones are rejected without a round trip
+func (api *APIImpl) sendTxZk(ctx context.Context, tx kv.Tx, encodedTx hexutility.Bytes) (common.Hash, error) {
+	if api.txForwarder == nil {
+		return common.Hash{}, errNoTxForwarder
+	}
+
+	txn, err := types.DecodeWrappedTransaction(encodedTx)
 	if err != nil {
 		return common.Hash{}, err
 	}
 
-	if res.Error != nil {
-		return common.Hash{}, fmt.Errorf("RPC error response: %s", res.Error.Message)
+	if api.ValidateForwardedTxs {
+		if err := api.validateForwardedTx(ctx, tx, txn); err != nil {
+			return common.Hash{}, err
+		}
 	}
 
-	//hash comes in escaped quotes, so we trim them here
-	// \"0x1234\" -> 0x1234
-	hashHex := strings.Trim(string(res.Result), "\"")
+	return api.txForwarder.Forward(txn, encodedTx)
+}
+
+func (api *APIImpl) validateForwardedTx(ctx context.Context, tx kv.Tx, txn types.Transaction) error {
+	cc, err := api.chainConfig(ctx, tx)
+	if err != nil {
+		return err
+	}
+	header := rawdb.ReadCurrentHeader(tx)
+	if header == nil {
+		return errors.New("current header not found")
+	}
+
+	if txn.Protected() && cc.ChainID.Cmp(txn.GetChainID().ToBig()) != 0 {
+		return fmt.Errorf("invalid chain id, expected: %d got: %d", cc.ChainID, txn.GetChainID())
+	}
+
+	signer := types.MakeSigner(cc, header.Number.Uint64(), header.Time)
+	sender, err := txn.Sender(*signer)
+	if err != nil {
+		return err
+	}
+
+	intrinsicGas, err := core.IntrinsicGas(txn.GetData(), txn.GetAccessList(), txn.GetTo() == nil, true, true, cc.IsShanghai(header.Time))
+	if err != nil {
+		return err
+	}
+	if txn.GetGas() < intrinsicGas {
+		return fmt.Errorf("%w: have %d, want %d", core.ErrIntrinsicGas, txn.GetGas(), intrinsicGas)
+	}
+
+	reader, err := rpchelper.CreateStateReader(ctx, tx, rpc.BlockNumberOrHashWithNumber(rpc.LatestBlockNumber), 0, api.filters, api.stateCache, api.historyV3(tx), "")
+	if err != nil {
+		return err
+	}
+	acc, err := reader.ReadAccountData(sender)
+	if err != nil {
+		return err
+	}
+	nonce, balance := uint64(0), uint256.NewInt(0)
+	if acc != nil {
+		nonce, balance = acc.Nonce, &acc.Balance
+	}
+	if txn.GetNonce() < nonce {
+		return fmt.Errorf("%w: address %v, tx: %d state: %d", core.ErrNonceTooLow, sender, txn.GetNonce(), nonce)
+	}
+
+	cost := new(uint256.Int).Set(txn.GetValue())
+	if !api.gasless {
+		cost.Add(cost, new(uint256.Int).Mul(uint256.NewInt(txn.GetGas()), txn.GetFeeCap()))
+	}
+	if balance.Cmp(cost) < 0 {
+		return fmt.Errorf("%w: address %v have %v want %v", core.ErrInsufficientFunds, sender, balance, cost)
+	}
+
+	if api.txAcl != nil {
+		creation := txn.GetTo() == nil
+		allowed, err := api.txAcl.IsTransactionAllowed(ctx, sender, creation)
+		if err != nil {
+			return err
+		}
+		if !allowed {
+			if creation {
+				return errors.New(txpool2.SenderDisallowedDeploy.String())
+			}
+			return errors.New(txpool2.SenderDisallowedSendTx.String())
+		}
+	}
 
-	return common.HexToHash(hashHex), nil
+	return nil
 }
@@ -2,6 +2,8 @@ package jsonrpc
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"math/big"
 	"time"
@@ -469,3 +471,154 @@ func (api *PrivateDebugAPIImpl) TraceTransactionCounters(ctx context.Context, ha
 	// Trace the transaction and return
 	return transactions.TraceTx(ctx, txEnv.Msg, txEnv.BlockContext, txEnv.TxContext, txEnv.Ibs, config, chainConfig, stream, api.evmCallTimeout)
 }
+
+// TraceBlockCounters implements debug_traceBlockCounters. Executes every transaction in the block with zk counters
+// enabled and returns the counters aggregated per call frame, contract and opcode by the zkCountersTracer.  Options
+// for the tracer can be passed in the tracerConfig field of the config.
+func (api *PrivateDebugAPIImpl) TraceBlockCounters(ctx context.Context, blockNrOrHash rpc.BlockNumberOrHash, config *tracers.TraceConfig_ZkEvm, stream *jsoniter.Stream) error {
+	tx, err := api.db.BeginRo(ctx)
+	if err != nil {
+		stream.WriteNil()
+		return err
+	}
+	defer tx.Rollback()
+
+	blockNum, _, _, err := rpchelper.GetBlockNumber(blockNrOrHash, tx, api.filters)
+	if err != nil {
+		stream.WriteNil()
+		return err
+	}
+
+	// check pruning to ensure we have history at this block level
+	if err = api.BaseAPI.checkPruneHistory(tx, blockNum); err != nil {
+		stream.WriteNil()
+		return err
+	}
+
+	block, err := api.blockByNumberWithSenders(ctx, tx, blockNum)
+	if err != nil {
+		stream.WriteNil()
+		return err
+	}
+	if block == nil {
+		stream.WriteNil()
+		return fmt.Errorf("invalid arguments; block with number %d not found", blockNum)
+	}
+
+	chainConfig, err := api.chainConfig(ctx, tx)
+	if err != nil {
+		stream.WriteNil()
+		return err
+	}
+	engine := api.engine()
+
+	txEnv, err := transactions.ComputeTxEnv_ZkEvm(ctx, engine, block, chainConfig, api._blockReader, tx, 0, api.historyV3(tx))
+	if err != nil {
+		stream.WriteNil()
+		return err
+	}
+	blockCtx := txEnv.BlockContext
+	ibs := txEnv.Ibs
+	rules := chainConfig.Rules(block.NumberU64(), block.Time())
+
+	// counters work
+	hermezDb := hermez_db.NewHermezDbReader(tx)
+	forkId, err := hermezDb.GetForkIdByBlockNum(blockNum)
+	if err != nil {
+		stream.WriteNil()
+		return err
+	}
+
+	smtDepth, err := getSmtDepth(hermezDb, blockNum, config)
+	if err != nil {
+		stream.WriteNil()
+		return err
+	}
+
+	// a single tracer is used for the whole block so that the counters are aggregated across transactions
+	tracerConfig := json.RawMessage("{}")
+	timeout := api.evmCallTimeout
+	if config != nil {
+		if config.TracerConfig != nil {
+			tracerConfig = *config.TracerConfig
+		}
+		if config.Timeout != nil {
+			if timeout, err = time.ParseDuration(*config.Timeout); err != nil {
+				stream.WriteNil()
+				return err
+			}
+		}
+	}
+	tracer, err := tracers.New("zkCountersTracer", &tracers.Context{
+		BlockHash: block.Hash(),
+		BlockNum:  blockNum,
+	}, tracerConfig)
+	if err != nil {
+		stream.WriteNil()
+		return err
+	}
+
+	// Handle timeouts and RPC cancellations
+	deadlineCtx, cancel := context.WithTimeout(ctx, timeout)
+	go func() {
+		<-deadlineCtx.Done()
+		tracer.Stop(errors.New("execution timeout"))
+	}()
+	defer cancel()
+
+	cumulativeGas := uint64(0)
+	for idx, txn := range block.Transactions() {
+		select {
+		default:
+		case <-ctx.Done():
+			stream.WriteNil()
+			return ctx.Err()
+		}
+
+		txHash := txn.Hash()
+		evm, effectiveGasPricePercentage, err := core.PrepareForTxExecution(chainConfig, &vm.Config{}, &blockCtx, hermezDb, ibs, block, &txHash, idx)
+		if err != nil {
+			stream.WriteNil()
+			return err
+		}
+
+		msg, _, err := core.GetTxContext(chainConfig, engine, ibs, block.Header(), txn, evm, effectiveGasPricePercentage)
+		if err != nil {
+			stream.WriteNil()
+			return err
+		}
+
+		txCtx := evmtypes.TxContext{
+			TxHash:            txHash,
+			Origin:            msg.From(),
+			GasPrice:          msg.GasPrice(),
+			Txn:               txn,
+			CumulativeGasUsed: &cumulativeGas,
+			BlockNum:          blockNum,
+		}
+
+		txCounters := vm.NewTransactionCounter(txn, smtDepth, uint16(forkId), api.config.Zk.VirtualCountersSmtReduction, false)
+		zkConfig := vm.NewZkConfig(vm.Config{Debug: true, Tracer: tracer}, txCounters.ExecutionCounters())
+		vmenv := vm.NewZkEVM(blockCtx, txCtx, ibs, chainConfig, zkConfig)
+
+		result, err := core.ApplyMessage(vmenv, msg, new(core.GasPool).AddGas(msg.Gas()), true /* refunds */, false /* gasBailout */)
+		if err != nil {
+			stream.WriteNil()
+			return fmt.Errorf("tracing failed for tx %s: %w", txHash.Hex(), err)
+		}
+		cumulativeGas += result.UsedGas
+
+		if err = ibs.FinalizeTx(rules, state.NewNoopWriter()); err != nil {
+			stream.WriteNil()
+			return err
+		}
+	}
+
+	res, err := tracer.GetResult()
+	if err != nil {
+		stream.WriteNil()
+		return err
+	}
+	stream.Write(res)
+	return nil
+}
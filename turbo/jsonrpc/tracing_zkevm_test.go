@@ -0,0 +1,137 @@
+package jsonrpc
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"testing"
+
+	"github.com/holiman/uint256"
+	jsoniter "github.com/json-iterator/go"
+	"github.com/ledgerwatch/erigon-lib/common"
+	"github.com/ledgerwatch/erigon-lib/common/datadir"
+	"github.com/ledgerwatch/erigon-lib/kv/kvcache"
+	"github.com/ledgerwatch/erigon/accounts/abi/bind/backends"
+	"github.com/ledgerwatch/erigon/core/types"
+	"github.com/ledgerwatch/erigon/eth/ethconfig"
+	"github.com/ledgerwatch/erigon/eth/tracers"
+	_ "github.com/ledgerwatch/erigon/eth/tracers/native"
+	"github.com/ledgerwatch/erigon/rpc"
+	"github.com/ledgerwatch/erigon/rpc/rpccfg"
+	"github.com/ledgerwatch/erigon/zk/hermez_db"
+	"github.com/stretchr/testify/require"
+)
+
+type testZkCounters struct {
+	Steps            int `json:"steps"`
+	Arithmetics      int `json:"arithmetics"`
+	Binaries         int `json:"binaries"`
+	MemAligns        int `json:"memAligns"`
+	KeccakHashes     int `json:"keccakHashes"`
+	PoseidonPaddings int `json:"poseidonPaddings"`
+	Poseidonhashes   int `json:"poseidonhashes"`
+	SHA256hashes     int `json:"SHA256hashes"`
+}
+
+type testZkCountersTrace struct {
+	Total        testZkCounters `json:"total"`
+	Transactions []struct {
+		TxHash common.Hash    `json:"txHash"`
+		Total  testZkCounters `json:"total"`
+		Call   *struct {
+			To   common.Address `json:"to"`
+			Self testZkCounters `json:"self"`
+		} `json:"call"`
+	} `json:"transactions"`
+	Contracts map[common.Address]struct {
+		Calls    int            `json:"calls"`
+		Counters testZkCounters `json:"counters"`
+	} `json:"contracts"`
+	Opcodes map[string]struct {
+		Counters testZkCounters `json:"counters"`
+	} `json:"opcodes"`
+	Folded []string `json:"folded"`
+}
+
+func TestTraceBlockCounters(t *testing.T) {
+	// PUSH1 1, PUSH1 2, ADD, POP, STOP
+	contract := common.HexToAddress("0xc0de")
+	alloc := types.GenesisAlloc{contract: {Balance: big.NewInt(0), Code: common.FromHex("0x600160020150" + "00")}}
+	for addr, account := range gspec.Alloc {
+		alloc[addr] = account
+	}
+
+	contractBackend := backends.NewTestSimulatedBackendWithConfig(t, alloc, gspec.Config, gspec.GasLimit)
+	defer contractBackend.Close()
+	stateCache := kvcache.New(kvcache.DefaultCoherentConfig)
+	contractBackend.Commit()
+
+	// block 2 holds two calls to the contract
+	signer := types.LatestSignerForChainID(gspec.Config.ChainID)
+	var hashes []common.Hash
+	for nonce := uint64(0); nonce < 2; nonce++ {
+		txn, err := types.SignTx(types.NewTransaction(nonce, contract, uint256.NewInt(0), 50000, uint256.NewInt(1), nil), *signer, key)
+		require.NoError(t, err)
+		require.NoError(t, contractBackend.SendTransaction(ctx, txn))
+		hashes = append(hashes, txn.Hash())
+	}
+	contractBackend.Commit()
+
+	db := contractBackend.DB()
+	agg := contractBackend.Agg()
+
+	tx, err := db.BeginRw(ctx)
+	require.NoError(t, err)
+	hDB := hermez_db.NewHermezDb(tx)
+	for i := uint64(0); i <= 2; i++ {
+		require.NoError(t, hDB.WriteBlockBatch(i, 1))
+	}
+	require.NoError(t, hDB.WriteForkId(1, 12))
+	require.NoError(t, hDB.WriteSmtDepth(2, 40))
+	require.NoError(t, tx.Commit())
+
+	baseApi := NewBaseApi(nil, stateCache, contractBackend.BlockReader(), agg, false, rpccfg.DefaultEvmCallTimeout, contractBackend.Engine(), datadir.New(t.TempDir()))
+	api := NewPrivateDebugAPI(baseApi, db, 0, &ethconfig.Defaults)
+
+	traceBlock := func(tracerConfig string) testZkCountersTrace {
+		var buf bytes.Buffer
+		stream := jsoniter.NewStream(jsoniter.ConfigDefault, &buf, 4096)
+		var config *tracers.TraceConfig_ZkEvm
+		if tracerConfig != "" {
+			raw := json.RawMessage(tracerConfig)
+			config = &tracers.TraceConfig_ZkEvm{TracerConfig: &raw}
+		}
+		require.NoError(t, api.TraceBlockCounters(ctx, rpc.BlockNumberOrHashWithNumber(2), config, stream))
+		require.NoError(t, stream.Flush())
+
+		var res testZkCountersTrace
+		require.NoError(t, json.Unmarshal(buf.Bytes(), &res))
+		return res
+	}
+
+	res := traceBlock("")
+	require.Len(t, res.Transactions, 2)
+
+	// both calls run the same code, a PUSH1 uses 26 steps, ADD 22 steps and a binary, POP 15 steps and STOP 32 steps
+	expected := testZkCounters{Steps: 2*26 + 22 + 15 + 32, Binaries: 1}
+	for i, trace := range res.Transactions {
+		require.Equal(t, hashes[i], trace.TxHash)
+		require.NotNil(t, trace.Call)
+		require.Equal(t, contract, trace.Call.To)
+		require.Equal(t, trace.Total, trace.Call.Self)
+		require.Equal(t, expected, trace.Total)
+	}
+	total := testZkCounters{Steps: 2 * expected.Steps, Binaries: 2 * expected.Binaries}
+	require.Equal(t, total, res.Total)
+	require.Equal(t, 2, res.Contracts[contract].Calls)
+	require.Equal(t, total, res.Contracts[contract].Counters)
+	require.Equal(t, testZkCounters{Steps: 2 * 2 * 26}, res.Opcodes["PUSH1"].Counters)
+	require.Equal(t, testZkCounters{Steps: 2 * 22, Binaries: 2}, res.Opcodes["ADD"].Counters)
+	require.Equal(t, testZkCounters{Steps: 2 * 15}, res.Opcodes["POP"].Counters)
+	require.Equal(t, testZkCounters{Steps: 2 * 32}, res.Opcodes["STOP"].Counters)
+
+	res = traceBlock(`{"folded":"steps","disableCalls":true}`)
+	require.Nil(t, res.Transactions[0].Call)
+	require.Contains(t, res.Folded, fmt.Sprintf("%s;CALL@%s;ADD 22", hashes[0].Hex(), contract.Hex()))
+}
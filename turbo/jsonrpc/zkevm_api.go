@@ -32,6 +32,7 @@ import (
 	"github.com/ledgerwatch/erigon/smt/pkg/smt"
 	smtUtils "github.com/ledgerwatch/erigon/smt/pkg/utils"
 	"github.com/ledgerwatch/erigon/turbo/rpchelper"
+	zkevents "github.com/ledgerwatch/erigon/zk/events"
 	"github.com/ledgerwatch/erigon/zk/hermez_db"
 	"github.com/ledgerwatch/erigon/zk/legacy_executor_verifier"
 	types "github.com/ledgerwatch/erigon/zk/rpcdaemon"
@@ -44,6 +45,8 @@ import (
 	"github.com/ledgerwatch/erigon/zk/witness"
 	"github.com/ledgerwatch/erigon/zkevm/hex"
 	"github.com/ledgerwatch/erigon/zkevm/jsonrpc/client"
+	"github.com/ledgerwatch/erigon/zk/datastream/audit"
+	"github.com/ledgerwatch/erigon/zk/replay"
 	"github.com/ledgerwatch/erigon/zk/datastream/server"
 	"github.com/0xPolygonHermez/zkevm-data-streamer/datastreamer"
 )
@@ -71,13 +74,21 @@ type ZkEvmAPI interface {
 	GetExitRootsByGER(ctx context.Context, globalExitRoot common.Hash) (*ZkExitRoots, error)
 	GetL2BlockInfoTree(ctx context.Context, blockNum rpc.BlockNumberOrHash) (json.RawMessage, error)
 	EstimateCounters(ctx context.Context, argsOrNil *zkevmRPCTransaction) (json.RawMessage, error)
+	EstimateCountersMany(ctx context.Context, rpcTxs []*zkevmRPCTransaction, blockNrOrHash *rpc.BlockNumberOrHash) (json.RawMessage, error)
+	EstimateFee(ctx context.Context, rpcTx *zkevmRPCTransaction) (json.RawMessage, error)
 	GetBatchCountersByNumber(ctx context.Context, batchNumRpc rpc.BlockNumber) (res json.RawMessage, err error)
+	GetExecutorDivergence(ctx context.Context, batchNumber rpc.BlockNumber) (json.RawMessage, error)
+	GetBatchStatus(ctx context.Context, batchNumber rpc.BlockNumber) (*BatchStatus, error)
+	GetBatchStatusRange(ctx context.Context, fromBatch, toBatch rpc.BlockNumber) ([]*BatchStatus, error)
 	GetExitRootTable(ctx context.Context) ([]l1InfoTreeData, error)
 	GetVersionHistory(ctx context.Context) (json.RawMessage, error)
 	GetForkId(ctx context.Context) (hexutil.Uint64, error)
 	GetForkById(ctx context.Context, forkId hexutil.Uint64) (res json.RawMessage, err error)
 	GetForkIdByBatchNumber(ctx context.Context, batchNumber rpc.BlockNumber) (hexutil.Uint64, error)
 	GetForks(ctx context.Context) (res json.RawMessage, err error)
+	GetSponsorQuota(ctx context.Context, address common.Address) ([]*SponsorQuota, error)
+	GetDatastreamHealth(ctx context.Context) (*audit.Status, error)
+	ReplayBatch(ctx context.Context, batchNumber hexutil.Uint64) (*replay.Result, error)
 }
 
 const getBatchWitness = "getBatchWitness"
@@ -93,6 +104,9 @@ type ZkEvmAPIImpl struct {
 	l2SequencerUrl   string
 	semaphores       map[string]chan struct{}
 	datastreamServer *server.DataStreamServer
+	zkEvents         *zkevents.Feed
+	sponsors         sponsorQuotaReader
+	dataStreamAudit  dataStreamAuditor
 }
 
 func (api *ZkEvmAPIImpl) initializeSemaphores(functionLimits map[string]int) {
@@ -114,6 +128,7 @@ func NewZkEvmAPI(
 	l1Syncer *syncer.L1Syncer,
 	l2SequencerUrl string,
 	datastreamServer *datastreamer.StreamServer,
+	zkEvents *zkevents.Feed,
 ) *ZkEvmAPIImpl {
 
 	var streamServer *server.DataStreamServer
@@ -129,10 +144,13 @@ func NewZkEvmAPI(
 		l1Syncer:         l1Syncer,
 		l2SequencerUrl:   l2SequencerUrl,
 		datastreamServer: streamServer,
+		zkEvents:         zkEvents,
 	}
 
 	a.initializeSemaphores(map[string]int{
 		getBatchWitness: zkConfig.Zk.RpcGetBatchWitnessConcurrencyLimit,
+		// a replay unwinds the state in memory the same as a witness does
+		replayBatch: zkConfig.Zk.RpcGetBatchWitnessConcurrencyLimit,
 	})
 
 	return a
@@ -1068,6 +1086,17 @@ func (api *ZkEvmAPIImpl) GetBatchWitness(ctx context.Context, batchNumber uint64
 		if witnessCached != nil {
 			return witnessCached, nil
 		}
+
+		// a pruned witness can only be generated again while the state history of the batch is kept
+		if prunedErr := api.ethApi.BaseAPI.checkZkPruneHistory(tx, hermez_db.BATCH_WITNESSES, batchNumber); prunedErr != nil {
+			blockNo, _, err := hermezDb.GetLowestBlockInBatch(batchNumber)
+			if err != nil {
+				return nil, err
+			}
+			if api.ethApi.BaseAPI.checkPruneHistory(tx, blockNo) != nil {
+				return nil, prunedErr
+			}
+		}
 	}
 
 	return api.getBatchWitness(ctx, tx, batchNumber, false, checkedMode)
@@ -15,6 +15,7 @@ import (
 	"github.com/ledgerwatch/erigon-lib/common"
 	"github.com/ledgerwatch/erigon-lib/common/datadir"
 	"github.com/ledgerwatch/erigon-lib/common/hexutil"
+	"github.com/ledgerwatch/erigon-lib/kv"
 	"github.com/ledgerwatch/erigon-lib/kv/kvcache"
 	"github.com/ledgerwatch/erigon/accounts/abi/bind/backends"
 	"github.com/ledgerwatch/erigon/cmd/rpcdaemon/commands/mocks"
@@ -75,7 +76,7 @@ func TestLatestConsolidatedBlockNumber(t *testing.T) {
 	baseApi := NewBaseApi(nil, stateCache, contractBackend.BlockReader(), agg, false, rpccfg.DefaultEvmCallTimeout, contractBackend.Engine(), datadir.New(t.TempDir()))
 	ethImpl := NewEthAPI(baseApi, db, nil, nil, nil, 5000000, 100_000, 100_000, &ethconfig.Defaults, false, 100, 100, log.New())
 	var l1Syncer *syncer.L1Syncer
-	zkEvmImpl := NewZkEvmAPI(ethImpl, db, 100_000, &ethconfig.Defaults, l1Syncer, "", nil)
+	zkEvmImpl := NewZkEvmAPI(ethImpl, db, 100_000, &ethconfig.Defaults, l1Syncer, "", nil, nil)
 	tx, err := db.BeginRw(ctx)
 	assert.NoError(err)
 	hDB := hermez_db.NewHermezDb(tx)
@@ -108,7 +109,7 @@ func TestIsBlockConsolidated(t *testing.T) {
 	baseApi := NewBaseApi(nil, stateCache, contractBackend.BlockReader(), agg, false, rpccfg.DefaultEvmCallTimeout, contractBackend.Engine(), datadir.New(t.TempDir()))
 	ethImpl := NewEthAPI(baseApi, db, nil, nil, nil, 5000000, 100_000, 100_000, &ethconfig.Defaults, false, 100, 100, log.New())
 	var l1Syncer *syncer.L1Syncer
-	zkEvmImpl := NewZkEvmAPI(ethImpl, db, 100_000, &ethconfig.Defaults, l1Syncer, "", nil)
+	zkEvmImpl := NewZkEvmAPI(ethImpl, db, 100_000, &ethconfig.Defaults, l1Syncer, "", nil, nil)
 	isConsolidated, err := zkEvmImpl.IsBlockConsolidated(ctx, 11)
 	assert.NoError(err)
 	t.Logf("blockNumber: 11 -> %v", isConsolidated)
@@ -150,7 +151,7 @@ func TestIsBlockVirtualized(t *testing.T) {
 	baseApi := NewBaseApi(nil, stateCache, contractBackend.BlockReader(), agg, false, rpccfg.DefaultEvmCallTimeout, contractBackend.Engine(), datadir.New(t.TempDir()))
 	ethImpl := NewEthAPI(baseApi, db, nil, nil, nil, 5000000, 100_000, 100_000, &ethconfig.Defaults, false, 100, 100, log.New())
 	var l1Syncer *syncer.L1Syncer
-	zkEvmImpl := NewZkEvmAPI(ethImpl, db, 100_000, &ethconfig.Defaults, l1Syncer, "", nil)
+	zkEvmImpl := NewZkEvmAPI(ethImpl, db, 100_000, &ethconfig.Defaults, l1Syncer, "", nil, nil)
 	isVirtualized, err := zkEvmImpl.IsBlockVirtualized(ctx, 50)
 	assert.NoError(err)
 	t.Logf("blockNumber: 50 -> %v", isVirtualized)
@@ -198,7 +199,7 @@ func TestBatchNumberByBlockNumber(t *testing.T) {
 	baseApi := NewBaseApi(nil, stateCache, contractBackend.BlockReader(), agg, false, rpccfg.DefaultEvmCallTimeout, contractBackend.Engine(), datadir.New(t.TempDir()))
 	ethImpl := NewEthAPI(baseApi, db, nil, nil, nil, 5000000, 100_000, 100_000, &ethconfig.Defaults, false, 100, 100, log.New())
 	var l1Syncer *syncer.L1Syncer
-	zkEvmImpl := NewZkEvmAPI(ethImpl, db, 100_000, &ethconfig.Defaults, l1Syncer, "", nil)
+	zkEvmImpl := NewZkEvmAPI(ethImpl, db, 100_000, &ethconfig.Defaults, l1Syncer, "", nil, nil)
 	batchNumber, err := zkEvmImpl.BatchNumberByBlockNumber(ctx, rpc.BlockNumber(10))
 	assert.Error(err)
 	tx, err := db.BeginRw(ctx)
@@ -253,7 +254,7 @@ func TestBatchNumber(t *testing.T) {
 	baseApi := NewBaseApi(nil, stateCache, contractBackend.BlockReader(), agg, false, rpccfg.DefaultEvmCallTimeout, contractBackend.Engine(), datadir.New(t.TempDir()))
 	ethImpl := NewEthAPI(baseApi, db, nil, nil, nil, 5000000, 100_000, 100_000, &ethconfig.Defaults, false, 100, 100, log.New())
 	var l1Syncer *syncer.L1Syncer
-	zkEvmImpl := NewZkEvmAPI(ethImpl, db, 100_000, &ethconfig.Defaults, l1Syncer, "", nil)
+	zkEvmImpl := NewZkEvmAPI(ethImpl, db, 100_000, &ethconfig.Defaults, l1Syncer, "", nil, nil)
 	tx, err := db.BeginRw(ctx)
 	assert.NoError(err)
 	hDB := hermez_db.NewHermezDb(tx)
@@ -290,7 +291,7 @@ func TestVirtualBatchNumber(t *testing.T) {
 	baseApi := NewBaseApi(nil, stateCache, contractBackend.BlockReader(), agg, false, rpccfg.DefaultEvmCallTimeout, contractBackend.Engine(), datadir.New(t.TempDir()))
 	ethImpl := NewEthAPI(baseApi, db, nil, nil, nil, 5000000, 100_000, 100_000, &ethconfig.Defaults, false, 100, 100, log.New())
 	var l1Syncer *syncer.L1Syncer
-	zkEvmImpl := NewZkEvmAPI(ethImpl, db, 100_000, &ethconfig.Defaults, l1Syncer, "", nil)
+	zkEvmImpl := NewZkEvmAPI(ethImpl, db, 100_000, &ethconfig.Defaults, l1Syncer, "", nil, nil)
 	tx, err := db.BeginRw(ctx)
 	assert.NoError(err)
 	hDB := hermez_db.NewHermezDb(tx)
@@ -327,7 +328,7 @@ func TestVerifiedBatchNumber(t *testing.T) {
 	baseApi := NewBaseApi(nil, stateCache, contractBackend.BlockReader(), agg, false, rpccfg.DefaultEvmCallTimeout, contractBackend.Engine(), datadir.New(t.TempDir()))
 	ethImpl := NewEthAPI(baseApi, db, nil, nil, nil, 5000000, 100_000, 100_000, &ethconfig.Defaults, false, 100, 100, log.New())
 	var l1Syncer *syncer.L1Syncer
-	zkEvmImpl := NewZkEvmAPI(ethImpl, db, 100_000, &ethconfig.Defaults, l1Syncer, "", nil)
+	zkEvmImpl := NewZkEvmAPI(ethImpl, db, 100_000, &ethconfig.Defaults, l1Syncer, "", nil, nil)
 	tx, err := db.BeginRw(ctx)
 	assert.NoError(err)
 	hDB := hermez_db.NewHermezDb(tx)
@@ -379,7 +380,7 @@ func TestGetBatchByNumber(t *testing.T) {
 	)
 	cfg := &ethconfig.Defaults
 	cfg.Zk.L1RollupId = 1
-	zkEvmImpl := NewZkEvmAPI(ethImpl, db, 100_000, &ethconfig.Defaults, l1Syncer, "", nil)
+	zkEvmImpl := NewZkEvmAPI(ethImpl, db, 100_000, &ethconfig.Defaults, l1Syncer, "", nil, nil)
 	tx, err := db.BeginRw(ctx)
 	assert.NoError(err)
 	hDB := hermez_db.NewHermezDb(tx)
@@ -503,7 +504,7 @@ func TestGetBatchDataByNumber(t *testing.T) {
 	baseApi := NewBaseApi(nil, stateCache, contractBackend.BlockReader(), agg, false, rpccfg.DefaultEvmCallTimeout, contractBackend.Engine(), datadir.New(t.TempDir()))
 	ethImpl := NewEthAPI(baseApi, db, nil, nil, nil, 5000000, 100_000, 100_000, &ethconfig.Defaults, false, 100, 100, log.New())
 
-	zkEvmImpl := NewZkEvmAPI(ethImpl, db, 100_000, &ethconfig.Defaults, nil, "", nil)
+	zkEvmImpl := NewZkEvmAPI(ethImpl, db, 100_000, &ethconfig.Defaults, nil, "", nil, nil)
 	tx, err := db.BeginRw(ctx)
 	assert.NoError(err)
 	hDB := hermez_db.NewHermezDb(tx)
@@ -651,7 +652,7 @@ func TestGetExitRootsByGER(t *testing.T) {
 		0,
 		"latest",
 	)
-	zkEvmImpl := NewZkEvmAPI(ethImpl, db, 100_000, &ethconfig.Defaults, l1Syncer, "", nil)
+	zkEvmImpl := NewZkEvmAPI(ethImpl, db, 100_000, &ethconfig.Defaults, l1Syncer, "", nil, nil)
 	tx, err := db.BeginRw(ctx)
 	assert.NoError(err)
 	hDB := hermez_db.NewHermezDb(tx)
@@ -726,7 +727,7 @@ func TestLatestGlobalExitRoot(t *testing.T) {
 		0,
 		"latest",
 	)
-	zkEvmImpl := NewZkEvmAPI(ethImpl, db, 100_000, &ethconfig.Defaults, l1Syncer, "", nil)
+	zkEvmImpl := NewZkEvmAPI(ethImpl, db, 100_000, &ethconfig.Defaults, l1Syncer, "", nil, nil)
 	tx, err := db.BeginRw(ctx)
 	assert.NoError(err)
 	hDB := hermez_db.NewHermezDb(tx)
@@ -785,7 +786,7 @@ func TestGetVersionHistory(t *testing.T) {
 	baseApi := NewBaseApi(nil, stateCache, contractBackend.BlockReader(), agg, false, rpccfg.DefaultEvmCallTimeout, contractBackend.Engine(), datadir.New(t.TempDir()))
 	ethImpl := NewEthAPI(baseApi, db, nil, nil, nil, 5000000, 100_000, 100_000, &ethconfig.Defaults, false, 100, 100, log.New())
 	var l1Syncer *syncer.L1Syncer
-	zkEvmImpl := NewZkEvmAPI(ethImpl, db, 100_000, &ethconfig.Defaults, l1Syncer, "", nil)
+	zkEvmImpl := NewZkEvmAPI(ethImpl, db, 100_000, &ethconfig.Defaults, l1Syncer, "", nil, nil)
 
 	tx, err := db.BeginRw(ctx)
 	assert.NoError(err)
@@ -827,7 +828,7 @@ func TestGetExitRootTable(t *testing.T) {
 	baseApi := NewBaseApi(nil, stateCache, contractBackend.BlockReader(), agg, false, rpccfg.DefaultEvmCallTimeout, contractBackend.Engine(), datadir.New(t.TempDir()))
 	ethImpl := NewEthAPI(baseApi, db, nil, nil, nil, 5000000, 100_000, 100_000, &ethconfig.Defaults, false, 100, 100, log.New())
 
-	zkEvmImpl := NewZkEvmAPI(ethImpl, db, 100_000, &ethconfig.Defaults, nil, "", nil)
+	zkEvmImpl := NewZkEvmAPI(ethImpl, db, 100_000, &ethconfig.Defaults, nil, "", nil, nil)
 	tx, err := db.BeginRw(ctx)
 	assert.NoError(err)
 	hDB := hermez_db.NewHermezDb(tx)
@@ -901,7 +902,7 @@ func TestGetFullBlockByNumber(t *testing.T) {
 	baseApi := NewBaseApi(nil, stateCache, contractBackend.BlockReader(), agg, false, rpccfg.DefaultEvmCallTimeout, contractBackend.Engine(), datadir.New(t.TempDir()))
 	ethImpl := NewEthAPI(baseApi, db, nil, nil, nil, 5000000, 100_000, 100_000, &ethconfig.Defaults, false, 100, 100, log.New())
 
-	zkEvmImpl := NewZkEvmAPI(ethImpl, db, 100_000, &ethconfig.Defaults, nil, "", nil)
+	zkEvmImpl := NewZkEvmAPI(ethImpl, db, 100_000, &ethconfig.Defaults, nil, "", nil, nil)
 	tx, err := db.BeginRw(ctx)
 	assert.NoError(err)
 	hDB := hermez_db.NewHermezDb(tx)
@@ -1075,7 +1076,7 @@ func TestGetFullBlockByHash(t *testing.T) {
 	baseApi := NewBaseApi(nil, stateCache, contractBackend.BlockReader(), agg, false, rpccfg.DefaultEvmCallTimeout, contractBackend.Engine(), datadir.New(t.TempDir()))
 	ethImpl := NewEthAPI(baseApi, db, nil, nil, nil, 5000000, 100_000, 100_000, &ethconfig.Defaults, false, 100, 100, log.New())
 
-	zkEvmImpl := NewZkEvmAPI(ethImpl, db, 100_000, &ethconfig.Defaults, nil, "", nil)
+	zkEvmImpl := NewZkEvmAPI(ethImpl, db, 100_000, &ethconfig.Defaults, nil, "", nil, nil)
 	tx, err := db.BeginRw(ctx)
 	assert.NoError(err)
 	hDB := hermez_db.NewHermezDb(tx)
@@ -1245,7 +1246,7 @@ func TestGetForkId(t *testing.T) {
 	baseApi := NewBaseApi(nil, stateCache, contractBackend.BlockReader(), agg, false, rpccfg.DefaultEvmCallTimeout, contractBackend.Engine(), datadir.New(t.TempDir()))
 	ethImpl := NewEthAPI(baseApi, db, nil, nil, nil, 5000000, 100_000, 100_000, &ethconfig.Defaults, false, 100, 100, log.New())
 	var l1Syncer *syncer.L1Syncer
-	zkEvmImpl := NewZkEvmAPI(ethImpl, db, 100_000, &ethconfig.Defaults, l1Syncer, "", nil)
+	zkEvmImpl := NewZkEvmAPI(ethImpl, db, 100_000, &ethconfig.Defaults, l1Syncer, "", nil, nil)
 	tx, err := db.BeginRw(ctx)
 	assert.NoError(err)
 	hDB := hermez_db.NewHermezDb(tx)
@@ -1287,7 +1288,7 @@ func TestGetForkIdByBatchNumber(t *testing.T) {
 	baseApi := NewBaseApi(nil, stateCache, contractBackend.BlockReader(), agg, false, rpccfg.DefaultEvmCallTimeout, contractBackend.Engine(), datadir.New(t.TempDir()))
 	ethImpl := NewEthAPI(baseApi, db, nil, nil, nil, 5000000, 100_000, 100_000, &ethconfig.Defaults, false, 100, 100, log.New())
 	var l1Syncer *syncer.L1Syncer
-	zkEvmImpl := NewZkEvmAPI(ethImpl, db, 100_000, &ethconfig.Defaults, l1Syncer, "", nil)
+	zkEvmImpl := NewZkEvmAPI(ethImpl, db, 100_000, &ethconfig.Defaults, l1Syncer, "", nil, nil)
 	tx, err := db.BeginRw(ctx)
 	assert.NoError(err)
 	hDB := hermez_db.NewHermezDb(tx)
@@ -1333,7 +1334,7 @@ func TestGetForkById(t *testing.T) {
 	baseApi := NewBaseApi(nil, stateCache, contractBackend.BlockReader(), agg, false, rpccfg.DefaultEvmCallTimeout, contractBackend.Engine(), datadir.New(t.TempDir()))
 	ethImpl := NewEthAPI(baseApi, db, nil, nil, nil, 5000000, 100_000, 100_000, &ethconfig.Defaults, false, 100, 100, log.New())
 	var l1Syncer *syncer.L1Syncer
-	zkEvmImpl := NewZkEvmAPI(ethImpl, db, 100_000, &ethconfig.Defaults, l1Syncer, "", nil)
+	zkEvmImpl := NewZkEvmAPI(ethImpl, db, 100_000, &ethconfig.Defaults, l1Syncer, "", nil, nil)
 	tx, err := db.BeginRw(ctx)
 	assert.NoError(err)
 	hDB := hermez_db.NewHermezDb(tx)
@@ -1400,7 +1401,7 @@ func TestGetForks(t *testing.T) {
 	baseApi := NewBaseApi(nil, stateCache, contractBackend.BlockReader(), agg, false, rpccfg.DefaultEvmCallTimeout, contractBackend.Engine(), datadir.New(t.TempDir()))
 	ethImpl := NewEthAPI(baseApi, db, nil, nil, nil, 5000000, 100_000, 100_000, &ethconfig.Defaults, false, 100, 100, log.New())
 	var l1Syncer *syncer.L1Syncer
-	zkEvmImpl := NewZkEvmAPI(ethImpl, db, 100_000, &ethconfig.Defaults, l1Syncer, "", nil)
+	zkEvmImpl := NewZkEvmAPI(ethImpl, db, 100_000, &ethconfig.Defaults, l1Syncer, "", nil, nil)
 	tx, err := db.BeginRw(ctx)
 	assert.NoError(err)
 	hDB := hermez_db.NewHermezDb(tx)
@@ -1443,3 +1444,95 @@ func TestGetForks(t *testing.T) {
 	assert.Equal(forks[2].Version, "")
 	assert.Equal(forks[2].BlockNumber, hexutil.Uint64(3000))
 }
+
+func TestGetBatchStatus(t *testing.T) {
+	assert := assert.New(t)
+	////////////////
+	contractBackend := backends.NewTestSimulatedBackendWithConfig(t, gspec.Alloc, gspec.Config, gspec.GasLimit)
+	defer contractBackend.Close()
+	stateCache := kvcache.New(kvcache.DefaultCoherentConfig)
+	contractBackend.Commit()
+	contractBackend.Commit()
+	///////////
+
+	db := contractBackend.DB()
+	agg := contractBackend.Agg()
+
+	baseApi := NewBaseApi(nil, stateCache, contractBackend.BlockReader(), agg, false, rpccfg.DefaultEvmCallTimeout, contractBackend.Engine(), datadir.New(t.TempDir()))
+	ethImpl := NewEthAPI(baseApi, db, nil, nil, nil, 5000000, 100_000, 100_000, &ethconfig.Defaults, false, 100, 100, log.New())
+	var l1Syncer *syncer.L1Syncer
+	zkEvmImpl := NewZkEvmAPI(ethImpl, db, 100_000, &ethconfig.Defaults, l1Syncer, "", nil, nil)
+
+	tx, err := db.BeginRw(ctx)
+	assert.NoError(err)
+	hDB := hermez_db.NewHermezDb(tx)
+	assert.NoError(hDB.WriteBlockBatch(1, 1))
+	assert.NoError(hDB.WriteBatchTransition(&zktypes.BatchTransition{Status: zktypes.BatchStatusVirtual, BatchNo: 3, L1BlockNo: 100, L1TxHash: common.HexToHash("0x1")}))
+	assert.NoError(hDB.WriteBatchTransition(&zktypes.BatchTransition{Status: zktypes.BatchStatusVerified, BatchNo: 1, L1BlockNo: 101, L1TxHash: common.HexToHash("0x2")}))
+	assert.NoError(tx.Commit())
+
+	var header *types.Header
+	assert.NoError(db.View(ctx, func(tx kv.Tx) (err error) {
+		header, err = contractBackend.BlockReader().HeaderByNumber(ctx, tx, 1)
+		return err
+	}))
+	blockTime := hexutil.Uint64(header.Time)
+	l1Block, l1Tx := hexutil.Uint64(100), common.HexToHash("0x1")
+	verifiedL1Block, verifiedL1Tx := hexutil.Uint64(101), common.HexToHash("0x2")
+
+	status, err := zkEvmImpl.GetBatchStatus(ctx, 1)
+	assert.NoError(err)
+	assert.Equal(&BatchStatus{
+		Number:   1,
+		Status:   "verified",
+		Trusted:  &BatchStatusTransition{Timestamp: &blockTime},
+		Virtual:  &BatchStatusTransition{L1BlockNumber: &l1Block, L1TxHash: &l1Tx},
+		Verified: &BatchStatusTransition{L1BlockNumber: &verifiedL1Block, L1TxHash: &verifiedL1Tx},
+	}, status)
+
+	// sequenced on the l1 but not yet seen by the node
+	status, err = zkEvmImpl.GetBatchStatus(ctx, 3)
+	assert.NoError(err)
+	assert.Equal("virtual", status.Status)
+	assert.Nil(status.Trusted)
+
+	status, err = zkEvmImpl.GetBatchStatus(ctx, 4)
+	assert.NoError(err)
+	assert.Nil(status)
+
+	statuses, err := zkEvmImpl.GetBatchStatusRange(ctx, 1, 10)
+	assert.NoError(err)
+	assert.Len(statuses, 3)
+
+	_, err = zkEvmImpl.GetBatchStatusRange(ctx, 1, 2000)
+	assert.Error(err)
+
+	// the subscription only sends what happens after it is made
+	watcher := &batchTransitionWatcher{api: zkEvmImpl}
+	assert.NoError(db.View(ctx, watcher.init))
+
+	tx, err = db.BeginRw(ctx)
+	assert.NoError(err)
+	hDB = hermez_db.NewHermezDb(tx)
+	assert.NoError(hDB.WriteBlockBatch(2, 2))
+	assert.NoError(hDB.WriteBatchTransition(&zktypes.BatchTransition{Status: zktypes.BatchStatusVerified, BatchNo: 3, L1BlockNo: 102, L1TxHash: common.HexToHash("0x3")}))
+	assert.NoError(tx.Commit())
+
+	var events []*BatchTransitionEvent
+	assert.NoError(db.View(ctx, func(tx kv.Tx) (err error) {
+		events, err = watcher.poll(ctx, tx)
+		return err
+	}))
+	assert.Len(events, 2)
+	assert.Equal("trusted", events[0].Status)
+	assert.Equal(hexutil.Uint64(2), events[0].FromBatch)
+	assert.Equal("verified", events[1].Status)
+	assert.Equal(hexutil.Uint64(2), events[1].FromBatch)
+	assert.Equal(hexutil.Uint64(3), events[1].ToBatch)
+
+	assert.NoError(db.View(ctx, func(tx kv.Tx) (err error) {
+		events, err = watcher.poll(ctx, tx)
+		return err
+	}))
+	assert.Empty(events)
+}
@@ -0,0 +1,395 @@
+package jsonrpc
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/ledgerwatch/erigon-lib/common"
+	"github.com/ledgerwatch/erigon-lib/common/hexutil"
+	"github.com/ledgerwatch/erigon-lib/kv"
+	"github.com/ledgerwatch/log/v3"
+
+	"github.com/ledgerwatch/erigon/common/debug"
+	"github.com/ledgerwatch/erigon/rpc"
+	zkevents "github.com/ledgerwatch/erigon/zk/events"
+	"github.com/ledgerwatch/erigon/zk/hermez_db"
+	"github.com/ledgerwatch/erigon/zk/syncer"
+	zktypes "github.com/ledgerwatch/erigon/zk/types"
+)
+
+const (
+	// the most batches zkevm_getBatchStatusRange returns
+	maxBatchStatusRange = 1000
+	// how often subscriptions without zk events check for new transitions and the most transitions of one status sent
+	// per check
+	batchTransitionsPollInterval = time.Second
+	batchTransitionsPollLimit    = 1000
+)
+
+var batchL1Statuses = []zktypes.BatchStatus{zktypes.BatchStatusVirtual, zktypes.BatchStatusVerified, zktypes.BatchStatusFinalized}
+
+// BatchStatusTransition is when and, for the L1 statuses, in which L1 transaction a batch reached a status.  The
+// timestamp of an L1 status is the one of its L1 block, it is only known to nodes with an L1 endpoint.
+type BatchStatusTransition struct {
+	L1BlockNumber *hexutil.Uint64 `json:"l1BlockNumber,omitempty"`
+	L1TxHash      *common.Hash    `json:"l1TxHash,omitempty"`
+	Timestamp     *hexutil.Uint64 `json:"timestamp,omitempty"`
+}
+
+// BatchStatus is the lifecycle of a batch, trusted -> virtual -> verified -> finalized.  Status is the furthest one
+// reached and the transitions not yet made are omitted.
+type BatchStatus struct {
+	Number    hexutil.Uint64         `json:"number"`
+	Status    string                 `json:"status"`
+	Trusted   *BatchStatusTransition `json:"trusted,omitempty"`
+	Virtual   *BatchStatusTransition `json:"virtual,omitempty"`
+	Verified  *BatchStatusTransition `json:"verified,omitempty"`
+	Finalized *BatchStatusTransition `json:"finalized,omitempty"`
+}
+
+// BatchTransitionEvent is sent to zkevm_subscribe batchTransitions subscribers when batches reach a new status.  An
+// L1 transaction moves a range of batches at once, trusted events are sent for every batch the node sees.
+type BatchTransitionEvent struct {
+	Status        string          `json:"status"`
+	FromBatch     hexutil.Uint64  `json:"fromBatch"`
+	ToBatch       hexutil.Uint64  `json:"toBatch"`
+	L1BlockNumber *hexutil.Uint64 `json:"l1BlockNumber,omitempty"`
+	L1TxHash      *common.Hash    `json:"l1TxHash,omitempty"`
+	Timestamp     *hexutil.Uint64 `json:"timestamp,omitempty"`
+}
+
+func newBatchStatusTransition(transition *zktypes.BatchTransition, l1Times *l1BlockTimes) *BatchStatusTransition {
+	l1BlockNumber := hexutil.Uint64(transition.L1BlockNo)
+	l1TxHash := transition.L1TxHash
+	return &BatchStatusTransition{
+		L1BlockNumber: &l1BlockNumber,
+		L1TxHash:      &l1TxHash,
+		Timestamp:     l1Times.get(transition.L1BlockNo),
+	}
+}
+
+// l1BlockTimes reads the timestamps of the L1 blocks of transitions from the L1 when they are asked for, a block is
+// only read once per request
+type l1BlockTimes struct {
+	syncer *syncer.L1Syncer
+	times  map[uint64]uint64
+}
+
+func (api *ZkEvmAPIImpl) newL1BlockTimes() *l1BlockTimes {
+	return &l1BlockTimes{syncer: api.l1Syncer, times: make(map[uint64]uint64)}
+}
+
+// get returns the timestamp of the L1 block, nil without an L1 syncer or when the L1 can't be reached
+func (t *l1BlockTimes) get(l1BlockNo uint64) *hexutil.Uint64 {
+	if t.syncer == nil {
+		return nil
+	}
+	if timestamp, ok := t.times[l1BlockNo]; ok {
+		return optionalTimestamp(timestamp)
+	}
+	header, err := t.syncer.GetHeader(l1BlockNo)
+	if err != nil {
+		log.Debug("[rpc] failed to get the L1 block of a batch transition", "l1BlockNo", l1BlockNo, "err", err)
+		return nil
+	}
+	t.times[l1BlockNo] = header.Time
+	return optionalTimestamp(header.Time)
+}
+
+func optionalTimestamp(timestamp uint64) *hexutil.Uint64 {
+	if timestamp == 0 {
+		return nil
+	}
+	t := hexutil.Uint64(timestamp)
+	return &t
+}
+
+// GetBatchStatus implements zkevm_getBatchStatus. It returns the status of the batch with the time and L1
+// transaction of every transition it made, null if the node doesn't know the batch.
+func (api *ZkEvmAPIImpl) GetBatchStatus(ctx context.Context, batchNumber rpc.BlockNumber) (*BatchStatus, error) {
+	tx, err := api.db.BeginRo(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	latestBatchNo, err := getLatestBatchNumber(tx)
+	if err != nil {
+		return nil, err
+	}
+
+	batchNo, err := resolveBatchStatusNumber(batchNumber, latestBatchNo)
+	if err != nil {
+		return nil, err
+	}
+
+	return api.getBatchStatus(ctx, tx, hermez_db.NewHermezDbReader(tx), api.newL1BlockTimes(), batchNo, latestBatchNo)
+}
+
+// GetBatchStatusRange implements zkevm_getBatchStatusRange. It returns the statuses of the batches from and to
+// including both, batches unknown to the node are left out.
+func (api *ZkEvmAPIImpl) GetBatchStatusRange(ctx context.Context, fromBatch, toBatch rpc.BlockNumber) ([]*BatchStatus, error) {
+	tx, err := api.db.BeginRo(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	latestBatchNo, err := getLatestBatchNumber(tx)
+	if err != nil {
+		return nil, err
+	}
+
+	from, err := resolveBatchStatusNumber(fromBatch, latestBatchNo)
+	if err != nil {
+		return nil, err
+	}
+	to, err := resolveBatchStatusNumber(toBatch, latestBatchNo)
+	if err != nil {
+		return nil, err
+	}
+	if from > to {
+		return nil, fmt.Errorf("from batch %d is after to batch %d", from, to)
+	}
+	if to-from >= maxBatchStatusRange {
+		return nil, fmt.Errorf("range of %d batches is larger than the limit of %d", to-from+1, maxBatchStatusRange)
+	}
+
+	hermezDb := hermez_db.NewHermezDbReader(tx)
+	l1Times := api.newL1BlockTimes()
+	statuses := make([]*BatchStatus, 0, to-from+1)
+	for batchNo := from; batchNo <= to; batchNo++ {
+		status, err := api.getBatchStatus(ctx, tx, hermezDb, l1Times, batchNo, latestBatchNo)
+		if err != nil {
+			return nil, err
+		}
+		if status != nil {
+			statuses = append(statuses, status)
+		}
+	}
+
+	return statuses, nil
+}
+
+func resolveBatchStatusNumber(batchNumber rpc.BlockNumber, latestBatchNo uint64) (uint64, error) {
+	switch batchNumber {
+	case rpc.LatestBlockNumber, rpc.PendingBlockNumber:
+		return latestBatchNo, nil
+	case rpc.EarliestBlockNumber:
+		return 0, nil
+	}
+	if batchNumber < 0 {
+		return 0, fmt.Errorf("unsupported batch number %d", batchNumber)
+	}
+	return uint64(batchNumber), nil
+}
+
+func (api *ZkEvmAPIImpl) getBatchStatus(ctx context.Context, tx kv.Tx, hermezDb *hermez_db.HermezDbReader, l1Times *l1BlockTimes, batchNo, latestBatchNo uint64) (*BatchStatus, error) {
+	status := &BatchStatus{Number: hexutil.Uint64(batchNo)}
+	known := false
+
+	if batchNo <= latestBatchNo {
+		timestamp, found, err := api.trustedBatchTimestamp(ctx, tx, hermezDb, batchNo)
+		if err != nil {
+			return nil, err
+		}
+		if found {
+			status.Status = zktypes.BatchStatusTrusted.String()
+			status.Trusted = &BatchStatusTransition{Timestamp: optionalTimestamp(timestamp)}
+			known = true
+		}
+	}
+
+	for _, l1Status := range batchL1Statuses {
+		transition, err := hermezDb.GetBatchTransition(l1Status, batchNo)
+		if err != nil {
+			return nil, err
+		}
+		if transition == nil {
+			break
+		}
+
+		status.Status = l1Status.String()
+		switch l1Status {
+		case zktypes.BatchStatusVirtual:
+			status.Virtual = newBatchStatusTransition(transition, l1Times)
+		case zktypes.BatchStatusVerified:
+			status.Verified = newBatchStatusTransition(transition, l1Times)
+		case zktypes.BatchStatusFinalized:
+			status.Finalized = newBatchStatusTransition(transition, l1Times)
+		}
+		known = true
+	}
+
+	if !known {
+		return nil, nil
+	}
+	return status, nil
+}
+
+// trustedBatchTimestamp is the time of the latest block of the batch the node has
+func (api *ZkEvmAPIImpl) trustedBatchTimestamp(ctx context.Context, tx kv.Tx, hermezDb *hermez_db.HermezDbReader, batchNo uint64) (uint64, bool, error) {
+	blockNo, found, err := hermezDb.GetHighestBlockInBatch(batchNo)
+	if err != nil || !found {
+		return 0, false, err
+	}
+	header, err := api.ethApi._blockReader.HeaderByNumber(ctx, tx, blockNo)
+	if err != nil || header == nil {
+		return 0, false, err
+	}
+	return header.Time, true, nil
+}
+
+// BatchTransitions implements zkevm_subscribe batchTransitions. It sends an event every time batches reach a new
+// status, starting with the transitions after the subscription was made.
+func (api *ZkEvmAPIImpl) BatchTransitions(ctx context.Context) (*rpc.Subscription, error) {
+	notifier, supported := rpc.NotifierFromContext(ctx)
+	if !supported {
+		return &rpc.Subscription{}, rpc.ErrNotificationsUnsupported
+	}
+
+	// inside the node the zk events wake the watcher after every commit, a standalone rpcdaemon has to poll
+	var published <-chan *zkevents.Events
+	var polls <-chan time.Time
+	var stop func()
+	if api.zkEvents != nil {
+		events, unsubscribe, err := api.zkEvents.Subscribe(ctx)
+		if err != nil {
+			return nil, err
+		}
+		published, stop = events, unsubscribe
+	} else {
+		ticker := time.NewTicker(batchTransitionsPollInterval)
+		polls, stop = ticker.C, ticker.Stop
+	}
+
+	watcher := &batchTransitionWatcher{api: api}
+	if err := api.db.View(ctx, watcher.init); err != nil {
+		stop()
+		return nil, err
+	}
+
+	rpcSub := notifier.CreateSubscription()
+
+	go func() {
+		defer debug.LogPanic()
+		defer stop()
+		for {
+			select {
+			case <-published:
+			case <-polls:
+			case <-rpcSub.Err():
+				return
+			}
+
+			var events []*BatchTransitionEvent
+			if err := api.db.View(context.Background(), func(tx kv.Tx) (err error) {
+				events, err = watcher.poll(context.Background(), tx)
+				return err
+			}); err != nil {
+				log.Warn("[rpc] error while reading batch transitions", "err", err)
+				continue
+			}
+			for _, event := range events {
+				if err := notifier.Notify(rpcSub.ID, event); err != nil {
+					log.Warn("[rpc] error while notifying subscription", "err", err)
+				}
+			}
+		}
+	}()
+
+	return rpcSub, nil
+}
+
+// batchTransitionWatcher turns the batches seen and the transitions written since the last poll into events
+type batchTransitionWatcher struct {
+	api *ZkEvmAPIImpl
+
+	latestBatchNo uint64
+	// the highest batch of the latest transition seen per l1 status
+	latestTransitions map[zktypes.BatchStatus]uint64
+}
+
+func (w *batchTransitionWatcher) init(tx kv.Tx) (err error) {
+	if w.latestBatchNo, err = getLatestBatchNumber(tx); err != nil {
+		return err
+	}
+
+	hermezDb := hermez_db.NewHermezDbReader(tx)
+	w.latestTransitions = make(map[zktypes.BatchStatus]uint64)
+	for _, status := range batchL1Statuses {
+		latest, err := hermezDb.GetLatestBatchTransition(status)
+		if err != nil {
+			return err
+		}
+		if latest != nil {
+			w.latestTransitions[status] = latest.BatchNo
+		}
+	}
+	return nil
+}
+
+func (w *batchTransitionWatcher) poll(ctx context.Context, tx kv.Tx) ([]*BatchTransitionEvent, error) {
+	hermezDb := hermez_db.NewHermezDbReader(tx)
+	l1Times := w.api.newL1BlockTimes()
+	var events []*BatchTransitionEvent
+
+	latestBatchNo, err := getLatestBatchNumber(tx)
+	if err != nil {
+		return nil, err
+	}
+	if latestBatchNo > w.latestBatchNo+batchTransitionsPollLimit {
+		latestBatchNo = w.latestBatchNo + batchTransitionsPollLimit
+	}
+	for batchNo := w.latestBatchNo + 1; batchNo <= latestBatchNo; batchNo++ {
+		timestamp, found, err := w.api.trustedBatchTimestamp(ctx, tx, hermezDb, batchNo)
+		if err != nil {
+			return nil, err
+		}
+		if !found {
+			continue
+		}
+		events = append(events, &BatchTransitionEvent{
+			Status:    zktypes.BatchStatusTrusted.String(),
+			FromBatch: hexutil.Uint64(batchNo),
+			ToBatch:   hexutil.Uint64(batchNo),
+			Timestamp: optionalTimestamp(timestamp),
+		})
+	}
+	// an unwind moves the latest batch back and its batches are trusted again when they are seen again
+	w.latestBatchNo = latestBatchNo
+
+	for _, status := range batchL1Statuses {
+		// a rollback of sequenced batches on the l1 removes their virtual transitions
+		latest, err := hermezDb.GetLatestBatchTransition(status)
+		if err != nil {
+			return nil, err
+		}
+		if latest == nil {
+			w.latestTransitions[status] = 0
+		} else if latest.BatchNo < w.latestTransitions[status] {
+			w.latestTransitions[status] = latest.BatchNo
+		}
+
+		transitions, err := hermezDb.GetBatchTransitionsFrom(status, w.latestTransitions[status]+1, batchTransitionsPollLimit)
+		if err != nil {
+			return nil, err
+		}
+		for _, transition := range transitions {
+			l1BlockNumber := hexutil.Uint64(transition.L1BlockNo)
+			l1TxHash := transition.L1TxHash
+			events = append(events, &BatchTransitionEvent{
+				Status:        status.String(),
+				FromBatch:     hexutil.Uint64(w.latestTransitions[status] + 1),
+				ToBatch:       hexutil.Uint64(transition.BatchNo),
+				L1BlockNumber: &l1BlockNumber,
+				L1TxHash:      &l1TxHash,
+				Timestamp:     l1Times.get(transition.L1BlockNo),
+			})
+			w.latestTransitions[status] = transition.BatchNo
+		}
+	}
+
+	return events, nil
+}
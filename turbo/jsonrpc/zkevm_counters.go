@@ -52,13 +52,9 @@ func (tx *zkevmRPCTransaction) Tx(sr state.StateReader) (types.Transaction, erro
 		return nil, nil
 	}
 
-	sender := common.HexToAddress(defaultSenderAddress)
-	if tx.From != nil {
-		sender = *tx.From
-	}
 	nonce := uint64(0)
 
-	ad, err := sr.ReadAccountData(sender)
+	ad, err := sr.ReadAccountData(tx.sender())
 	if err != nil {
 		return nil, err
 	}
@@ -66,6 +62,18 @@ func (tx *zkevmRPCTransaction) Tx(sr state.StateReader) (types.Transaction, erro
 		nonce = ad.Nonce
 	}
 
+	return tx.txWithNonce(nonce)
+}
+
+func (tx *zkevmRPCTransaction) sender() common.Address {
+	if tx.From != nil {
+		return *tx.From
+	}
+	return common.HexToAddress(defaultSenderAddress)
+}
+
+// txWithNonce builds the types.Transaction from the rpcTransaction using the given sender nonce
+func (tx *zkevmRPCTransaction) txWithNonce(nonce uint64) (types.Transaction, error) {
 	if tx.Value == nil {
 		// set this to something non nil
 		tx.Value = &hexutil.Big{}
@@ -105,7 +113,7 @@ func (tx *zkevmRPCTransaction) Tx(sr state.StateReader) (types.Transaction, erro
 		)
 	}
 
-	legacy.SetSender(sender)
+	legacy.SetSender(tx.sender())
 
 	legacy.V = *uint256.MustFromHex(defaultV)
 	legacy.R = *uint256.MustFromHex(defaultR)
@@ -304,6 +312,10 @@ func getSmtDepth(hermezDb *hermez_db.HermezDbReader, blockNum uint64, config *tr
 	if config != nil && config.SmtDepth != nil {
 		smtDepth = *config.SmtDepth
 	} else {
+		// the closest depth kept could be far off the one of a pruned block
+		if err := hermezDb.CheckPruned(hermez_db.SMT_DEPTHS, blockNum); err != nil {
+			return 0, err
+		}
 		depthBlockNum, smtDepth, err := hermezDb.GetClosestSmtDepth(blockNum)
 		if err != nil {
 			return 0, err
@@ -0,0 +1,278 @@
+package jsonrpc
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/ledgerwatch/erigon-lib/common"
+
+	"github.com/ledgerwatch/erigon/core"
+	"github.com/ledgerwatch/erigon/core/state"
+	"github.com/ledgerwatch/erigon/core/types"
+	"github.com/ledgerwatch/erigon/core/vm"
+	"github.com/ledgerwatch/erigon/rpc"
+	"github.com/ledgerwatch/erigon/turbo/rpchelper"
+	"github.com/ledgerwatch/erigon/zk/hermez_db"
+)
+
+type countersManyResponse struct {
+	BlockNumber       uint64             `json:"blockNumber"`
+	ForkId            uint64             `json:"forkId"`
+	SmtDepth          int                `json:"smtDepth"`
+	SmtLevels         int                `json:"smtLevels"`
+	SmtLevelsForTx    int                `json:"smtLevelsForTransaction"`
+	SmtReduction      float64            `json:"smtReduction"`
+	VerifyMerkleProof bool               `json:"verifyMerkleProof"`
+	CountersUsed      combinecCounters   `json:"countersUsed"`
+	CountersLimits    combinecCounters   `json:"countersLimits"`
+	OverflowIndex     *int               `json:"overflowIndex"`
+	OverflowCounters  []string           `json:"overflowCounters,omitempty"`
+	Transactions      []txCountersResult `json:"transactions"`
+}
+
+type txCountersResult struct {
+	Index                  int              `json:"index"`
+	Hash                   common.Hash      `json:"hash"`
+	From                   common.Address   `json:"from"`
+	CountersUsed           combinecCounters `json:"countersUsed"`
+	CumulativeCountersUsed combinecCounters `json:"cumulativeCountersUsed"`
+	Overflow               bool             `json:"overflow"`
+	RevertInfo             revertInfo       `json:"revertInfo"`
+	Error                  string           `json:"error,omitempty"`
+}
+
+// EstimateCountersMany implements zkevm_estimateCountersMany. The transactions are executed in order on top of the state
+// of the given block (latest by default) as if they were sequenced in a single new block.  The counters used by each
+// transaction are returned along with the running total for the batch and the index of the first transaction that
+// would overflow the zk counter limits of the fork in use at that block.
+func (zkapi *ZkEvmAPIImpl) EstimateCountersMany(ctx context.Context, rpcTxs []*zkevmRPCTransaction, blockNrOrHash *rpc.BlockNumberOrHash) (json.RawMessage, error) {
+	api := zkapi.ethApi
+
+	if len(rpcTxs) == 0 {
+		return nil, errors.New("empty transactions")
+	}
+
+	dbtx, err := api.db.BeginRo(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer dbtx.Rollback()
+
+	chainConfig, err := api.chainConfig(ctx, dbtx)
+	if err != nil {
+		return nil, err
+	}
+	engine := api.engine()
+
+	numOrHash := latestNumOrHash
+	if blockNrOrHash != nil {
+		numOrHash = *blockNrOrHash
+	}
+
+	blockNum, blockHash, isLatest, err := rpchelper.GetCanonicalBlockNumber(numOrHash, dbtx, api.filters)
+	if err != nil {
+		return nil, err
+	}
+
+	// if we've pruned this history away for this block then just return early
+	// to save any red herring errors
+	if err = api.BaseAPI.checkPruneHistory(dbtx, blockNum); err != nil {
+		return nil, err
+	}
+
+	block := api.tryBlockFromLru(blockHash)
+	if block == nil {
+		block, err = api.blockWithSenders(ctx, dbtx, blockHash, blockNum)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if block == nil {
+		return nil, fmt.Errorf("could not find block %d in cache or db", blockNum)
+	}
+
+	stateReader, err := rpchelper.CreateStateReaderFromBlockNumber(ctx, dbtx, blockNum, isLatest, 0, api.stateCache, api.historyV3(dbtx), chainConfig.ChainName)
+	if err != nil {
+		return nil, err
+	}
+	header := block.HeaderNoCopy()
+	ibs := state.New(stateReader)
+	blockCtx := core.NewEVMBlockContext(header, core.GetHashFn(header, nil), engine, nil)
+	rules := chainConfig.Rules(blockNum, header.Time)
+	signer := types.MakeSigner(chainConfig, blockNum, header.Time)
+
+	hermezDb := hermez_db.NewHermezDbReader(dbtx)
+	forkId, err := hermezDb.GetForkIdByBlockNum(blockNum)
+	if err != nil {
+		return nil, err
+	}
+	smtDepth, err := getSmtDepth(hermezDb, blockNum, nil)
+	if err != nil {
+		return nil, err
+	}
+	l1InfoIndex, err := hermezDb.GetBlockL1InfoTreeIndex(blockNum)
+	if err != nil {
+		return nil, err
+	}
+	verifyMerkleProof := l1InfoIndex != 0
+
+	smtReduction := zkapi.config.Zk.VirtualCountersSmtReduction
+	batchCounters := vm.NewBatchCounterCollector(smtDepth, uint16(forkId), smtReduction, false, nil)
+
+	// the bundle is treated as a single new block in the batch
+	if _, err = batchCounters.StartNewBlock(verifyMerkleProof); err != nil {
+		return nil, err
+	}
+
+	smtLevels, smtLevelsForTx := batchCounters.SmtLevels()
+	res := countersManyResponse{
+		BlockNumber:       blockNum,
+		ForkId:            forkId,
+		SmtDepth:          smtDepth,
+		SmtLevels:         smtLevels,
+		SmtLevelsForTx:    smtLevelsForTx,
+		SmtReduction:      smtReduction,
+		VerifyMerkleProof: verifyMerkleProof,
+		Transactions:      make([]txCountersResult, 0, len(rpcTxs)),
+	}
+
+	var totalGasUsed uint64
+	for i, rpcTx := range rpcTxs {
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		default:
+		}
+
+		if rpcTx == nil {
+			return nil, fmt.Errorf("transaction %d is empty", i)
+		}
+
+		// the nonce is taken from the state so far so that consecutive transactions from the same sender line up
+		tx, err := rpcTx.txWithNonce(ibs.GetNonce(rpcTx.sender()))
+		if err != nil {
+			return nil, fmt.Errorf("transaction %d: %w", i, err)
+		}
+
+		msg, err := tx.AsMessage(*signer, header.BaseFee, rules)
+		if err != nil {
+			return nil, fmt.Errorf("transaction %d: %w", i, err)
+		}
+		msg.SetCheckNonce(false)
+
+		txCounters := vm.NewTransactionCounter(tx, smtDepth, uint16(forkId), smtReduction, false)
+		overflow, err := batchCounters.AddNewTransactionCounters(txCounters)
+		if err != nil {
+			return nil, err
+		}
+
+		zkConfig := vm.ZkConfig{Config: vm.Config{NoBaseFee: true}, CounterCollector: txCounters.ExecutionCounters()}
+		evm := vm.NewZkEVM(blockCtx, core.NewEVMTxContext(msg), ibs, chainConfig, zkConfig)
+		gp := new(core.GasPool).AddGas(msg.Gas())
+		ibs.Init(tx.Hash(), header.Hash(), i)
+
+		// the counters only overflow through their limits, an error here means the transaction can't be executed at all
+		execResult, applyErr := core.ApplyMessage(evm, msg, gp, true /* refunds */, false /* gasBailout */)
+
+		result := txCountersResult{
+			Index: i,
+			Hash:  tx.Hash(),
+			From:  rpcTx.sender(),
+		}
+
+		var gasUsed uint64
+		if applyErr != nil {
+			result.Error = applyErr.Error()
+		} else {
+			if err = txCounters.ProcessTx(ibs, execResult.ReturnData); err != nil {
+				return nil, err
+			}
+			batchCounters.UpdateExecutionAndProcessingCountersCache(txCounters)
+
+			gasUsed = execResult.UsedGas
+			var errText string
+			if execResult.Err != nil {
+				errText = execResult.Err.Error()
+			}
+			result.RevertInfo = revertInfo{
+				Message: errText,
+				Data:    execResult.ReturnData,
+			}
+		}
+		if err = ibs.FinalizeTx(rules, state.NewNoopWriter()); err != nil {
+			return nil, err
+		}
+		totalGasUsed += gasUsed
+
+		cumulative, err := batchCounters.CombineCollectors(verifyMerkleProof)
+		if err != nil {
+			return nil, err
+		}
+		overflowed := overflowedCounters(cumulative)
+		if len(overflowed) > 0 {
+			overflow = true
+		}
+
+		result.CountersUsed = usedCounters(txCounters.CombineCounters(), gasUsed)
+		result.CumulativeCountersUsed = usedCounters(cumulative, totalGasUsed)
+		result.Overflow = overflow
+
+		if overflow && res.OverflowIndex == nil {
+			idx := i
+			res.OverflowIndex = &idx
+			res.OverflowCounters = overflowed
+		}
+
+		res.Transactions = append(res.Transactions, result)
+	}
+
+	collected, err := batchCounters.CombineCollectors(verifyMerkleProof)
+	if err != nil {
+		return nil, err
+	}
+	res.CountersUsed = usedCounters(collected, totalGasUsed)
+	res.CountersLimits = limitCounters(collected, header.GasLimit)
+
+	return json.Marshal(res)
+}
+
+func usedCounters(c vm.Counters, gas uint64) combinecCounters {
+	return combinecCounters{
+		Gas:              gas,
+		KeccakHashes:     c.GetKeccakHashes().Used(),
+		Poseidonhashes:   c.GetPoseidonHashes().Used(),
+		PoseidonPaddings: c.GetPoseidonPaddings().Used(),
+		MemAligns:        c.GetMemAligns().Used(),
+		Arithmetics:      c.GetArithmetics().Used(),
+		Binaries:         c.GetBinaries().Used(),
+		Steps:            c.GetSteps().Used(),
+		SHA256hashes:     c.GetSHA256Hashes().Used(),
+	}
+}
+
+func limitCounters(c vm.Counters, gas uint64) combinecCounters {
+	return combinecCounters{
+		Gas:              gas,
+		KeccakHashes:     c.GetKeccakHashes().Limit(),
+		Poseidonhashes:   c.GetPoseidonHashes().Limit(),
+		PoseidonPaddings: c.GetPoseidonPaddings().Limit(),
+		MemAligns:        c.GetMemAligns().Limit(),
+		Arithmetics:      c.GetArithmetics().Limit(),
+		Binaries:         c.GetBinaries().Limit(),
+		Steps:            c.GetSteps().Limit(),
+		SHA256hashes:     c.GetSHA256Hashes().Limit(),
+	}
+}
+
+// overflowedCounters returns the names of the counters that have gone over their limit
+func overflowedCounters(c vm.Counters) []string {
+	var names []string
+	for k, v := range c {
+		if v != nil && v.Remaining() < 0 {
+			names = append(names, string(vm.CounterKeyNames[k]))
+		}
+	}
+	return names
+}
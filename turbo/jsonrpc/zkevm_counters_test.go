@@ -0,0 +1,79 @@
+package jsonrpc
+
+import (
+	"encoding/json"
+	"math/big"
+	"testing"
+
+	"github.com/ledgerwatch/erigon-lib/common/datadir"
+	"github.com/ledgerwatch/erigon-lib/common/hexutil"
+	"github.com/ledgerwatch/erigon-lib/kv/kvcache"
+	"github.com/ledgerwatch/erigon/accounts/abi/bind/backends"
+	"github.com/ledgerwatch/erigon/eth/ethconfig"
+	"github.com/ledgerwatch/erigon/rpc/rpccfg"
+	"github.com/ledgerwatch/erigon/zk/hermez_db"
+	"github.com/ledgerwatch/log/v3"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEstimateCountersMany(t *testing.T) {
+	contractBackend := backends.NewTestSimulatedBackendWithConfig(t, gspec.Alloc, gspec.Config, gspec.GasLimit)
+	defer contractBackend.Close()
+	stateCache := kvcache.New(kvcache.DefaultCoherentConfig)
+	contractBackend.Commit()
+
+	db := contractBackend.DB()
+	agg := contractBackend.Agg()
+
+	baseApi := NewBaseApi(nil, stateCache, contractBackend.BlockReader(), agg, false, rpccfg.DefaultEvmCallTimeout, contractBackend.Engine(), datadir.New(t.TempDir()))
+	ethImpl := NewEthAPI(baseApi, db, nil, nil, nil, 5000000, 100_000, 100_000, &ethconfig.Defaults, false, 100, 100, log.New())
+	zkEvmImpl := NewZkEvmAPI(ethImpl, db, 100_000, &ethconfig.Defaults, nil, "", nil, nil)
+
+	tx, err := db.BeginRw(ctx)
+	require.NoError(t, err)
+	hDB := hermez_db.NewHermezDb(tx)
+	for i := uint64(0); i <= 1; i++ {
+		require.NoError(t, hDB.WriteBlockBatch(i, 1))
+	}
+	require.NoError(t, hDB.WriteForkId(1, 12))
+	require.NoError(t, tx.Commit())
+
+	_, err = zkEvmImpl.EstimateCountersMany(ctx, nil, nil)
+	require.Error(t, err)
+
+	value := (*hexutil.Big)(big.NewInt(1000))
+	transfer := &zkevmRPCTransaction{Gas: 21000, From: &address, To: &address1, Value: value}
+	raw, err := zkEvmImpl.EstimateCountersMany(ctx, []*zkevmRPCTransaction{transfer, transfer}, nil)
+	require.NoError(t, err)
+
+	var res countersManyResponse
+	require.NoError(t, json.Unmarshal(raw, &res))
+	require.Equal(t, uint64(12), res.ForkId)
+	require.Nil(t, res.OverflowIndex)
+	require.Len(t, res.Transactions, 2)
+
+	first, second := res.Transactions[0], res.Transactions[1]
+	require.NotEqual(t, first.Hash, second.Hash, "the second transfer takes the next nonce")
+	require.Equal(t, uint64(21000), first.CountersUsed.Gas)
+	require.Equal(t, uint64(42000), second.CumulativeCountersUsed.Gas)
+	require.Equal(t, res.CountersUsed, second.CumulativeCountersUsed)
+	require.Greater(t, first.CountersUsed.Steps, 0)
+	require.Greater(t, second.CumulativeCountersUsed.Steps, first.CumulativeCountersUsed.Steps)
+	require.Greater(t, res.CountersLimits.Steps, res.CountersUsed.Steps)
+	require.Empty(t, first.Error)
+
+	// a transaction that can't be paid for fails on its own without overflowing the batch
+	tooMuch := &zkevmRPCTransaction{Gas: 21000, From: &address, To: &address1, Value: (*hexutil.Big)(new(big.Int).Lsh(big.NewInt(1), 200))}
+	raw, err = zkEvmImpl.EstimateCountersMany(ctx, []*zkevmRPCTransaction{transfer, tooMuch, transfer}, nil)
+	require.NoError(t, err)
+
+	res = countersManyResponse{}
+	require.NoError(t, json.Unmarshal(raw, &res))
+	require.Nil(t, res.OverflowIndex)
+	require.Len(t, res.Transactions, 3)
+	require.NotEmpty(t, res.Transactions[1].Error)
+	require.False(t, res.Transactions[1].Overflow)
+	require.Zero(t, res.Transactions[1].CountersUsed.Gas)
+	require.Empty(t, res.Transactions[2].Error)
+	require.Equal(t, uint64(42000), res.CountersUsed.Gas)
+}
@@ -0,0 +1,22 @@
+package jsonrpc
+
+import (
+	"context"
+	"errors"
+
+	"github.com/ledgerwatch/erigon/zk/datastream/audit"
+)
+
+// dataStreamAuditor is the background audit of the node's datastream against its database
+type dataStreamAuditor interface {
+	Status() *audit.Status
+}
+
+// GetDatastreamHealth returns what the datastream audit found since the node started, healthy until the stream
+// diverges from the database.  Only available on nodes serving a datastream with the audit enabled.
+func (api *ZkEvmAPIImpl) GetDatastreamHealth(ctx context.Context) (*audit.Status, error) {
+	if api.dataStreamAudit == nil {
+		return nil, errors.New("the datastream audit is not enabled, see --zkevm.data-stream-audit-mode")
+	}
+	return api.dataStreamAudit.Status(), nil
+}
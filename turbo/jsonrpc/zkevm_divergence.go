@@ -0,0 +1,59 @@
+package jsonrpc
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/ledgerwatch/erigon/rpc"
+	"github.com/ledgerwatch/erigon/zk/hermez_db"
+	"github.com/ledgerwatch/erigon/zkevm/jsonrpc/client"
+)
+
+// GetExecutorDivergence implements zkevm_getExecutorDivergence. It returns the report the sequencer wrote when the
+// executor disagreed with its state root for the batch, or the most recent report for latest.  Null is returned if
+// the batch did not diverge.
+func (api *ZkEvmAPIImpl) GetExecutorDivergence(ctx context.Context, batchNumber rpc.BlockNumber) (json.RawMessage, error) {
+	tx, err := api.db.BeginRo(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	cc, err := api.ethApi.chainConfig(ctx, tx)
+	if err != nil {
+		return nil, err
+	}
+	// only the sequencer verifies batches against the executor
+	if api.ethApi.isZkNonSequencer(cc.ChainID) {
+		res, err := client.JSONRPCCall(api.l2SequencerUrl, "zkevm_getExecutorDivergence", batchNumber)
+		if err != nil {
+			return nil, err
+		}
+		if res.Error != nil {
+			return nil, fmt.Errorf("RPC error response: %s", res.Error.Message)
+		}
+		return res.Result, nil
+	}
+
+	hermezDb := hermez_db.NewHermezDbReader(tx)
+
+	var report []byte
+	switch batchNumber {
+	case rpc.LatestBlockNumber, rpc.PendingBlockNumber:
+		_, report, err = hermezDb.GetLatestExecutorDivergence()
+	default:
+		if batchNumber < 0 {
+			return nil, fmt.Errorf("unsupported batch number %d", batchNumber)
+		}
+		report, err = hermezDb.GetExecutorDivergence(uint64(batchNumber))
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if len(report) == 0 {
+		return json.RawMessage("null"), nil
+	}
+	return report, nil
+}
@@ -0,0 +1,141 @@
+package jsonrpc
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/holiman/uint256"
+	"github.com/ledgerwatch/erigon-lib/common/hexutil"
+	"github.com/ledgerwatch/erigon-lib/common/hexutility"
+
+	"github.com/ledgerwatch/erigon/core"
+	"github.com/ledgerwatch/erigon/turbo/adapter/ethapi"
+	"github.com/ledgerwatch/erigon/zkevm/jsonrpc/client"
+)
+
+var errDynamicGasPriceDisabled = errors.New("dynamic gas price is not enabled, start the node with --zkevm.dynamic-gas-price")
+
+type feeEstimateResponse struct {
+	L1GasPrice                  *hexutil.Big   `json:"l1GasPrice"`
+	L1DataCostPerByte           *hexutil.Big   `json:"l1DataCostPerByte"`
+	LastClosedBatch             hexutil.Uint64 `json:"lastClosedBatch"`
+	BatchSaturation             float64        `json:"batchSaturation"`
+	CongestionMultiplier        float64        `json:"congestionMultiplier"`
+	GasPrice                    *hexutil.Big   `json:"gasPrice"`
+	Gas                         hexutil.Uint64 `json:"gas"`
+	BreakEvenGasPrice           *hexutil.Big   `json:"breakEvenGasPrice"`
+	EffectiveGasPricePercentage uint8          `json:"effectiveGasPricePercentage"`
+	EffectiveGasPrice           *hexutil.Big   `json:"effectiveGasPrice"`
+	Fee                         *hexutil.Big   `json:"fee"`
+}
+
+// EstimateFee implements zkevm_estimateFee. It returns the inputs of the dynamic gas price along with the effective
+// gas price percentage the sequencer would apply to the transaction and the resulting fee.  If the transaction has no
+// gas price the suggested gas price is used, and if it has no gas the gas is estimated.
+func (zkapi *ZkEvmAPIImpl) EstimateFee(ctx context.Context, rpcTx *zkevmRPCTransaction) (json.RawMessage, error) {
+	api := zkapi.ethApi
+
+	if rpcTx == nil {
+		return nil, errors.New("empty transaction")
+	}
+
+	tx, err := api.db.BeginRo(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	cc, err := api.chainConfig(ctx, tx)
+	if err != nil {
+		return nil, err
+	}
+	// only the sequencer knows how full the recent batches were
+	if api.isZkNonSequencer(cc.ChainID) {
+		res, err := client.JSONRPCCall(api.l2RpcUrl, "zkevm_estimateFee", rpcTx)
+		if err != nil {
+			return nil, err
+		}
+		if res.Error != nil {
+			return nil, fmt.Errorf("RPC error response: %s", res.Error.Message)
+		}
+		return res.Result, nil
+	}
+
+	if api.feeOracle == nil {
+		return nil, errDynamicGasPriceDisabled
+	}
+
+	estimate, err := api.feeEstimate(tx)
+	if err != nil {
+		return nil, err
+	}
+	tx.Rollback()
+
+	// work on a copy so the gas and gas price filled in below are not written back to the request
+	txArgs := *rpcTx
+	if txArgs.Gas == 0 {
+		// estimated before the suggested gas price is filled in so the sender balance is only checked when a price was given
+		gas, err := api.EstimateGas(ctx, rpcTx.callArgs(), nil)
+		if err != nil {
+			return nil, err
+		}
+		txArgs.Gas = gas
+	}
+	if txArgs.GasPrice == nil {
+		suggested, err := truncateGasPrice(estimate.GasPrice)
+		if err != nil {
+			return nil, err
+		}
+		txArgs.GasPrice = suggested
+	}
+
+	transaction, err := txArgs.txWithNonce(uint64(txArgs.Nonce))
+	if err != nil {
+		return nil, err
+	}
+
+	gasPrice := transaction.GetPrice()
+	percentage := estimate.EffectiveGasPricePercentage(transaction)
+	effectiveGasPrice := core.CalculateEffectiveGas(gasPrice.Clone(), percentage)
+	fee := new(uint256.Int).Mul(effectiveGasPrice, uint256.NewInt(transaction.GetGas()))
+
+	var encoded bytes.Buffer
+	if err = transaction.MarshalBinary(&encoded); err != nil {
+		return nil, err
+	}
+
+	return json.Marshal(feeEstimateResponse{
+		L1GasPrice:                  (*hexutil.Big)(estimate.L1GasPrice),
+		L1DataCostPerByte:           (*hexutil.Big)(estimate.L1DataCostPerByte),
+		LastClosedBatch:             hexutil.Uint64(estimate.LastClosedBatch),
+		BatchSaturation:             estimate.BatchSaturation,
+		CongestionMultiplier:        estimate.CongestionMultiplier,
+		GasPrice:                    (*hexutil.Big)(estimate.GasPrice),
+		Gas:                         txArgs.Gas,
+		BreakEvenGasPrice:           (*hexutil.Big)(estimate.BreakEvenGasPrice(encoded.Bytes(), transaction.GetGas())),
+		EffectiveGasPricePercentage: percentage,
+		EffectiveGasPrice:           (*hexutil.Big)(effectiveGasPrice.ToBig()),
+		Fee:                         (*hexutil.Big)(fee.ToBig()),
+	})
+}
+
+// callArgs converts the rpcTransaction to the arguments of eth_estimateGas
+func (tx *zkevmRPCTransaction) callArgs() *ethapi.CallArgs {
+	args := &ethapi.CallArgs{
+		From:     tx.From,
+		To:       tx.To,
+		GasPrice: tx.GasPrice,
+		Value:    tx.Value,
+	}
+	if tx.Data != nil {
+		data := hexutility.Bytes(tx.Data)
+		args.Data = &data
+	} else if tx.Input != nil {
+		input := hexutility.Bytes(tx.Input)
+		args.Input = &input
+	}
+	return args
+}
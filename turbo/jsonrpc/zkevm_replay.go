@@ -0,0 +1,62 @@
+package jsonrpc
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/ledgerwatch/erigon-lib/common/hexutil"
+
+	"github.com/ledgerwatch/erigon/zk/replay"
+)
+
+const replayBatch = "replayBatch"
+
+// ReplayBatch implements zkevm_replayBatch.  It executes the batch again from the data it was sequenced with on the
+// L1, on top of the state before it and in an overlay that is thrown away, and compares every block root and receipt
+// with what the node stored.  The first mismatch comes with the struct logs of the transactions involved.  Without
+// the l1 batch data of the l1 recovery the batch is read from its sequence transaction, a validium from the DA.
+func (api *ZkEvmAPIImpl) ReplayBatch(ctx context.Context, batchNumber hexutil.Uint64) (*replay.Result, error) {
+	// limit in-flight requests by name
+	semaphore := api.semaphores[replayBatch]
+	if semaphore != nil {
+		select {
+		case semaphore <- struct{}{}:
+			defer func() { <-semaphore }()
+		default:
+			return nil, fmt.Errorf("busy")
+		}
+	}
+
+	tx, err := api.db.BeginRo(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	if api.ethApi.historyV3(tx) {
+		return nil, fmt.Errorf("not supported by Erigon3")
+	}
+
+	chainConfig, err := api.ethApi.chainConfig(ctx, tx)
+	if err != nil {
+		return nil, err
+	}
+
+	var l1 replay.L1TransactionReader
+	if api.l1Syncer != nil {
+		l1 = api.l1Syncer
+	}
+
+	replayer := replay.NewReplayer(
+		api.ethApi.dirs,
+		api.ethApi.historyV3(tx),
+		api.ethApi._agg,
+		api.ethApi._blockReader,
+		chainConfig,
+		api.config.Zk,
+		api.ethApi._engine,
+		l1,
+	)
+
+	return replayer.ReplayBatch(ctx, tx, uint64(batchNumber))
+}
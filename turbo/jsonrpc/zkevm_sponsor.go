@@ -0,0 +1,82 @@
+package jsonrpc
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/ledgerwatch/erigon-lib/common"
+	"github.com/ledgerwatch/erigon-lib/common/hexutil"
+
+	"github.com/ledgerwatch/erigon/zk/sequencer"
+	txpool2 "github.com/ledgerwatch/erigon/zk/txpool"
+	"github.com/ledgerwatch/erigon/zkevm/jsonrpc/client"
+)
+
+// sponsorQuotaReader is the pool of the sequencer, where sponsored transactions are charged to their sponsors
+type sponsorQuotaReader interface {
+	SponsorQuotas(ctx context.Context, addr common.Address) ([]*txpool2.SponsorQuota, error)
+}
+
+// SponsorQuota is a sponsorship of an address as a sender or as a contract with what is left of its daily gas budget.
+// GasCharged is charged for mined transactions, GasHeld is held for the ones waiting in the pool, both at the gas
+// limit of the transactions.  The budget starts afresh at ResetsAt.
+type SponsorQuota struct {
+	Kind           string           `json:"kind"`
+	Address        common.Address   `json:"address"`
+	DailyGasBudget hexutil.Uint64   `json:"dailyGasBudget"`
+	GasCharged     hexutil.Uint64   `json:"gasCharged"`
+	GasHeld        hexutil.Uint64   `json:"gasHeld"`
+	Remaining      hexutil.Uint64   `json:"remaining"`
+	ResetsAt       hexutil.Uint64   `json:"resetsAt"`
+	Contracts      []common.Address `json:"contracts,omitempty"`
+}
+
+// GetSponsorQuota returns the sponsorships paying for free transactions sent by or to the address, empty if there
+// are none.  Nodes other than the sequencer ask the sequencer.
+func (api *ZkEvmAPIImpl) GetSponsorQuota(ctx context.Context, address common.Address) ([]*SponsorQuota, error) {
+	if !sequencer.IsSequencer() {
+		return api.sendGetSponsorQuota(api.l2SequencerUrl, address)
+	}
+	if api.sponsors == nil {
+		return nil, errors.New("sponsorships are only available with the node's own txpool")
+	}
+
+	quotas, err := api.sponsors.SponsorQuotas(ctx, address)
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]*SponsorQuota, 0, len(quotas))
+	for _, quota := range quotas {
+		result = append(result, &SponsorQuota{
+			Kind:           quota.Kind.String(),
+			Address:        quota.Address,
+			DailyGasBudget: hexutil.Uint64(quota.DailyGasBudget),
+			GasCharged:     hexutil.Uint64(quota.GasCharged),
+			GasHeld:        hexutil.Uint64(quota.GasHeld),
+			Remaining:      hexutil.Uint64(quota.Remaining()),
+			ResetsAt:       hexutil.Uint64(quota.Day.Add(24 * time.Hour).Unix()),
+			Contracts:      quota.Contracts,
+		})
+	}
+	return result, nil
+}
+
+func (api *ZkEvmAPIImpl) sendGetSponsorQuota(rpcUrl string, address common.Address) ([]*SponsorQuota, error) {
+	res, err := client.JSONRPCCall(rpcUrl, "zkevm_getSponsorQuota", address)
+	if err != nil {
+		return nil, err
+	}
+	if res.Error != nil {
+		return nil, fmt.Errorf("RPC error response: %s", res.Error.Message)
+	}
+
+	var quotas []*SponsorQuota
+	if err := json.Unmarshal(res.Result, &quotas); err != nil {
+		return nil, err
+	}
+	return quotas, nil
+}
@@ -0,0 +1,173 @@
+package jsonrpc
+
+import (
+	"context"
+	"errors"
+
+	"github.com/ledgerwatch/erigon-lib/common"
+	"github.com/ledgerwatch/erigon-lib/common/hexutil"
+	"github.com/ledgerwatch/log/v3"
+
+	"github.com/ledgerwatch/erigon/common/debug"
+	"github.com/ledgerwatch/erigon/rpc"
+	zkevents "github.com/ledgerwatch/erigon/zk/events"
+	zktypes "github.com/ledgerwatch/erigon/zk/types"
+)
+
+// the events are published by the stage loop, a standalone rpcdaemon has no way to receive them
+var errZkEventsUnavailable = errors.New("zkevm subscriptions are only available on the rpc of a node")
+
+const (
+	batchOpened = "opened"
+	batchClosed = "closed"
+)
+
+// BatchEvent is sent to zkevm_subscribe newBatches subscribers when a batch gets its first block and when it is closed
+type BatchEvent struct {
+	Number hexutil.Uint64 `json:"number"`
+	Status string         `json:"status"`
+}
+
+// BatchL1Event is sent to zkevm_subscribe virtualBatches and verifiedBatches subscribers, the batches up to and
+// including Number were sequenced or verified in the L1 transaction
+type BatchL1Event struct {
+	Number        hexutil.Uint64  `json:"number"`
+	L1BlockNumber hexutil.Uint64  `json:"l1BlockNumber"`
+	L1TxHash      common.Hash     `json:"l1TxHash"`
+	Timestamp     *hexutil.Uint64 `json:"timestamp,omitempty"`
+}
+
+// L1InfoTreeUpdateEvent is sent to zkevm_subscribe l1InfoTreeUpdates subscribers for every new leaf of the l1 info
+// tree and with it a new global exit root
+type L1InfoTreeUpdateEvent struct {
+	Index           hexutil.Uint64 `json:"index"`
+	GlobalExitRoot  common.Hash    `json:"globalExitRoot"`
+	MainnetExitRoot common.Hash    `json:"mainnetExitRoot"`
+	RollupExitRoot  common.Hash    `json:"rollupExitRoot"`
+	ParentHash      common.Hash    `json:"parentHash"`
+	Timestamp       hexutil.Uint64 `json:"timestamp"`
+	L1BlockNumber   hexutil.Uint64 `json:"l1BlockNumber"`
+}
+
+// ForkIdEvent is sent to zkevm_subscribe forkIds subscribers when the chain moves to a new fork id
+type ForkIdEvent struct {
+	ForkId      hexutil.Uint64 `json:"forkId"`
+	BatchNumber hexutil.Uint64 `json:"batchNumber"`
+	BlockNumber hexutil.Uint64 `json:"blockNumber"`
+}
+
+// NewBatches implements zkevm_subscribe newBatches. It sends an event when a batch is opened and when it is closed.
+func (api *ZkEvmAPIImpl) NewBatches(ctx context.Context) (*rpc.Subscription, error) {
+	return api.subscribeZkEvents(ctx, func(events *zkevents.Events) (notifications []interface{}) {
+		for _, batch := range events.Batches {
+			status := batchOpened
+			if batch.Closed {
+				status = batchClosed
+			}
+			notifications = append(notifications, &BatchEvent{Number: hexutil.Uint64(batch.BatchNumber), Status: status})
+		}
+		return notifications
+	})
+}
+
+// VirtualBatches implements zkevm_subscribe virtualBatches. It sends an event for every sequence of batches on the L1.
+func (api *ZkEvmAPIImpl) VirtualBatches(ctx context.Context) (*rpc.Subscription, error) {
+	return api.subscribeBatchTransitions(ctx, zktypes.BatchStatusVirtual)
+}
+
+// VerifiedBatches implements zkevm_subscribe verifiedBatches. It sends an event for every verification of batches on
+// the L1.
+func (api *ZkEvmAPIImpl) VerifiedBatches(ctx context.Context) (*rpc.Subscription, error) {
+	return api.subscribeBatchTransitions(ctx, zktypes.BatchStatusVerified)
+}
+
+func (api *ZkEvmAPIImpl) subscribeBatchTransitions(ctx context.Context, status zktypes.BatchStatus) (*rpc.Subscription, error) {
+	return api.subscribeZkEvents(ctx, func(events *zkevents.Events) (notifications []interface{}) {
+		l1Times := api.newL1BlockTimes()
+		for _, transition := range events.Transitions {
+			if transition.Status != status {
+				continue
+			}
+			notifications = append(notifications, &BatchL1Event{
+				Number:        hexutil.Uint64(transition.BatchNo),
+				L1BlockNumber: hexutil.Uint64(transition.L1BlockNo),
+				L1TxHash:      transition.L1TxHash,
+				Timestamp:     l1Times.get(transition.L1BlockNo),
+			})
+		}
+		return notifications
+	})
+}
+
+// L1InfoTreeUpdates implements zkevm_subscribe l1InfoTreeUpdates. It sends an event for every update of the l1 info
+// tree, each bringing a new global exit root.
+func (api *ZkEvmAPIImpl) L1InfoTreeUpdates(ctx context.Context) (*rpc.Subscription, error) {
+	return api.subscribeZkEvents(ctx, func(events *zkevents.Events) (notifications []interface{}) {
+		for _, update := range events.L1InfoTreeUpdates {
+			notifications = append(notifications, &L1InfoTreeUpdateEvent{
+				Index:           hexutil.Uint64(update.Index),
+				GlobalExitRoot:  update.GER,
+				MainnetExitRoot: update.MainnetExitRoot,
+				RollupExitRoot:  update.RollupExitRoot,
+				ParentHash:      update.ParentHash,
+				Timestamp:       hexutil.Uint64(update.Timestamp),
+				L1BlockNumber:   hexutil.Uint64(update.BlockNumber),
+			})
+		}
+		return notifications
+	})
+}
+
+// ForkIds implements zkevm_subscribe forkIds. It sends an event when the chain moves to a new fork id.
+func (api *ZkEvmAPIImpl) ForkIds(ctx context.Context) (*rpc.Subscription, error) {
+	return api.subscribeZkEvents(ctx, func(events *zkevents.Events) (notifications []interface{}) {
+		for _, fork := range events.ForkIds {
+			notifications = append(notifications, &ForkIdEvent{
+				ForkId:      hexutil.Uint64(fork.ForkId),
+				BatchNumber: hexutil.Uint64(fork.BatchNumber),
+				BlockNumber: hexutil.Uint64(fork.BlockNumber),
+			})
+		}
+		return notifications
+	})
+}
+
+// subscribeZkEvents creates a subscription sending what toNotifications picks out of every publish of the zk events
+func (api *ZkEvmAPIImpl) subscribeZkEvents(ctx context.Context, toNotifications func(*zkevents.Events) []interface{}) (*rpc.Subscription, error) {
+	if api.zkEvents == nil {
+		return &rpc.Subscription{}, errZkEventsUnavailable
+	}
+	notifier, supported := rpc.NotifierFromContext(ctx)
+	if !supported {
+		return &rpc.Subscription{}, rpc.ErrNotificationsUnsupported
+	}
+
+	events, unsubscribe, err := api.zkEvents.Subscribe(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	rpcSub := notifier.CreateSubscription()
+
+	go func() {
+		defer debug.LogPanic()
+		defer unsubscribe()
+		for {
+			select {
+			case e, ok := <-events:
+				if !ok {
+					return
+				}
+				for _, notification := range toNotifications(e) {
+					if err := notifier.Notify(rpcSub.ID, notification); err != nil {
+						log.Warn("[rpc] error while notifying subscription", "err", err)
+					}
+				}
+			case <-rpcSub.Err():
+				return
+			}
+		}
+	}()
+
+	return rpcSub, nil
+}
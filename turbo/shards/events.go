@@ -6,6 +6,7 @@ import (
 	"github.com/ledgerwatch/erigon-lib/common"
 	"github.com/ledgerwatch/erigon-lib/gointerfaces/remote"
 	"github.com/ledgerwatch/erigon/core/types"
+	zkevents "github.com/ledgerwatch/erigon/zk/events"
 )
 
 type RpcEventType uint64
@@ -142,4 +143,5 @@ type Notifications struct {
 	Events               *Events
 	Accumulator          *Accumulator
 	StateChangesConsumer StateChangeConsumer
+	ZkEvents             *zkevents.Feed
 }
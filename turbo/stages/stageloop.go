@@ -272,6 +272,10 @@ func (h *Hook) afterRun(tx kv.Tx, finishProgressBefore uint64) error {
 		h.updateHead(h.ctx)
 	}
 	if h.notifications != nil {
+		// zkevm: the feed diffs the committed state in a read tx of its own
+		if err := h.notifications.ZkEvents.Publish(h.ctx); err != nil {
+			h.logger.Warn("[hook] Failed to publish zk events", "err", err)
+		}
 		return h.sendNotifications(h.notifications, tx, finishProgressBefore)
 	}
 	return nil
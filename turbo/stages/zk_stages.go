@@ -16,7 +16,10 @@ import (
 	"github.com/ledgerwatch/erigon/turbo/engineapi/engine_helpers"
 	"github.com/ledgerwatch/erigon/turbo/shards"
 	"github.com/ledgerwatch/erigon/turbo/snapshotsync/freezeblocks"
+	"github.com/ledgerwatch/erigon/zk/datastream/server"
+	"github.com/ledgerwatch/erigon/zk/fee_oracle"
 	"github.com/ledgerwatch/erigon/zk/legacy_executor_verifier"
+	"github.com/ledgerwatch/erigon/zk/shadowfork"
 	zkStages "github.com/ledgerwatch/erigon/zk/stages"
 	"github.com/ledgerwatch/erigon/zk/syncer"
 	"github.com/ledgerwatch/erigon/zk/txpool"
@@ -99,6 +102,7 @@ func NewSequencerZkStages(ctx context.Context,
 	forkValidator *engine_helpers.ForkValidator,
 	engine consensus.Engine,
 	datastreamServer *datastreamer.StreamServer,
+	sequencerDatastreamServer *server.DataStreamServer,
 	sequencerStageSyncer *syncer.L1Syncer,
 	l1Syncer *syncer.L1Syncer,
 	l1InfoTreeSyncer *syncer.L1Syncer,
@@ -106,6 +110,8 @@ func NewSequencerZkStages(ctx context.Context,
 	txPool *txpool.TxPool,
 	txPoolDb kv.RwDB,
 	verifier *legacy_executor_verifier.LegacyExecutorVerifier,
+	feeOracle *fee_oracle.Oracle,
+	shadowFork *shadowfork.ShadowFork,
 ) []*stagedsync.Stage {
 	dirs := cfg.Dirs
 	blockReader := freezeblocks.NewBlockReader(snapshots, nil)
@@ -138,12 +144,16 @@ func NewSequencerZkStages(ctx context.Context,
 			cfg.Sync,
 			agg,
 			datastreamServer,
+			sequencerDatastreamServer,
 			cfg.Zk,
 			&cfg.Miner,
 			txPool,
 			txPoolDb,
 			verifier,
 			uint16(cfg.YieldSize),
+			feeOracle,
+			notifications.ZkEvents,
+			shadowFork,
 		),
 		stagedsync.StageHashStateCfg(db, dirs, cfg.HistoryV3, agg),
 		zkStages.StageZkInterHashesCfg(db, true, true, false, dirs.Tmp, blockReader, controlServer.Hd, cfg.HistoryV3, agg, cfg.Zk),
@@ -0,0 +1,408 @@
+package consistency
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/ledgerwatch/erigon-lib/common"
+	"github.com/ledgerwatch/erigon-lib/kv"
+	"github.com/ledgerwatch/erigon/core/rawdb"
+	"github.com/ledgerwatch/erigon/zk/hermez_db"
+)
+
+// The invariants between the hermez tables and the chain data
+const (
+	// CheckHeader every block up to the highest canonical one has a header
+	CheckHeader = "header"
+	// CheckBlockBatch every block maps to a batch
+	CheckBlockBatch = "block-batch"
+	// CheckBatchBlocks a batch lists exactly the blocks mapping to it
+	CheckBatchBlocks = "batch-blocks"
+	// CheckBatchOrder the batches of consecutive blocks never go down
+	CheckBatchOrder = "batch-order"
+	// CheckStateRoot the state root stored for a block is the one of its header
+	CheckStateRoot = "state-root"
+	// CheckGlobalExitRoot the GER of a block is a known one
+	CheckGlobalExitRoot = "global-exit-root"
+	// CheckL1InfoTreeIndex the l1 info tree index of a block has its leaf in the l1 info tree
+	CheckL1InfoTreeIndex = "l1-info-tree-index"
+	// CheckForkId every batch has a fork id and they never go down
+	CheckForkId = "fork-id"
+	// CheckBatchEnd only the last block of a batch is marked as its end
+	CheckBatchEnd = "batch-end"
+	// CheckDangling nothing is stored for blocks or batches beyond the highest canonical block
+	CheckDangling = "dangling"
+)
+
+// blockKeyedTables are the hermez tables with keys starting with the block number, entries beyond the highest
+// canonical block are left behind by crashed unwinds
+var blockKeyedTables = []string{
+	hermez_db.BLOCKBATCHES,
+	hermez_db.STATE_ROOTS,
+	hermez_db.BLOCK_GLOBAL_EXIT_ROOTS,
+	hermez_db.BLOCK_L1_INFO_TREE_INDEX,
+	hermez_db.BLOCK_INFO_ROOTS,
+	hermez_db.BLOCK_L1_BLOCK_HASHES,
+	hermez_db.INTERMEDIATE_TX_STATEROOTS,
+	hermez_db.BATCH_COUNTERS,
+	hermez_db.REUSED_L1_INFO_TREE_INDEX,
+	hermez_db.SMT_DEPTHS,
+	hermez_db.BATCH_ENDS,
+}
+
+// Violation is a broken invariant between the hermez tables and the chain data
+type Violation struct {
+	Check  string
+	Block  uint64
+	Batch  uint64
+	Detail string
+
+	// repair fixes the violation when the right value can be derived, nil otherwise
+	repair func(tx kv.RwTx, hermezDb *hermez_db.HermezDb) error
+}
+
+// Repairable is true if the right value can be derived from the chain data or the other hermez tables
+func (v *Violation) Repairable() bool {
+	return v.repair != nil
+}
+
+func (v *Violation) String() string {
+	return fmt.Sprintf("[%s] block %d batch %d: %s", v.Check, v.Block, v.Batch, v.Detail)
+}
+
+type checker struct {
+	ctx           context.Context
+	tx            kv.Tx
+	hermezDb      *hermez_db.HermezDbReader
+	head          uint64
+	hasL1InfoTree bool
+	violations    []*Violation
+}
+
+func (c *checker) report(v *Violation) {
+	c.violations = append(c.violations, v)
+}
+
+// Check walks the blocks from fromBlock to toBlock, capped at the highest canonical block, and returns every broken
+// invariant it finds.  Entries beyond the highest canonical block are always reported as dangling.
+func Check(ctx context.Context, tx kv.Tx, fromBlock, toBlock uint64) ([]*Violation, error) {
+	head, err := HighestCanonicalBlock(tx)
+	if err != nil {
+		return nil, err
+	}
+
+	hermezDb := hermez_db.NewHermezDbReader(tx)
+	_, hasL1InfoTree, err := hermezDb.GetLatestL1InfoTreeUpdate()
+	if err != nil {
+		return nil, err
+	}
+
+	c := &checker{ctx: ctx, tx: tx, hermezDb: hermezDb, head: head, hasL1InfoTree: hasL1InfoTree}
+	if err := c.checkBlocks(max(fromBlock, 1), min(toBlock, head)); err != nil {
+		return nil, err
+	}
+	if err := c.checkDangling(); err != nil {
+		return nil, err
+	}
+	return c.violations, nil
+}
+
+// Repair fixes the repairable violations and returns how many it fixed
+func Repair(tx kv.RwTx, violations []*Violation) (int, error) {
+	hermezDb := hermez_db.NewHermezDb(tx)
+	repaired := 0
+	for _, v := range violations {
+		if v.repair == nil {
+			continue
+		}
+		if err := v.repair(tx, hermezDb); err != nil {
+			return repaired, fmt.Errorf("failed to repair %s: %w", v, err)
+		}
+		repaired++
+	}
+	return repaired, nil
+}
+
+// HighestCanonicalBlock is the number of the last block with a canonical hash
+func HighestCanonicalBlock(tx kv.Tx) (uint64, error) {
+	c, err := tx.Cursor(kv.HeaderCanonical)
+	if err != nil {
+		return 0, err
+	}
+	defer c.Close()
+
+	k, _, err := c.Last()
+	if err != nil || k == nil {
+		return 0, err
+	}
+	return hermez_db.BytesToUint64(k), nil
+}
+
+func (c *checker) batchOf(blockNo uint64) (uint64, bool, error) {
+	if blockNo == 0 {
+		return 0, true, nil
+	}
+	return c.hermezDb.CheckBatchNoByL2Block(blockNo)
+}
+
+func (c *checker) checkBlocks(fromBlock, toBlock uint64) error {
+	if fromBlock > toBlock {
+		return nil
+	}
+
+	prevBatch, _, err := c.batchOf(fromBlock - 1)
+	if err != nil {
+		return err
+	}
+	prevForkId, err := c.hermezDb.GetForkId(prevBatch)
+	if err != nil {
+		return err
+	}
+
+	var batchBlocks map[uint64]struct{}
+	currentBatch := uint64(0)
+	for blockNo := fromBlock; blockNo <= toBlock; blockNo++ {
+		if err := c.ctx.Err(); err != nil {
+			return err
+		}
+
+		hash, err := rawdb.ReadCanonicalHash(c.tx, blockNo)
+		if err != nil {
+			return err
+		}
+		header := rawdb.ReadHeader(c.tx, hash, blockNo)
+		if header == nil {
+			c.report(&Violation{Check: CheckHeader, Block: blockNo, Detail: "no canonical header"})
+		}
+
+		batchNo, found, err := c.batchOf(blockNo)
+		if err != nil {
+			return err
+		}
+		if !found {
+			c.report(&Violation{Check: CheckBlockBatch, Block: blockNo, Detail: "block has no batch"})
+		} else {
+			if batchNo < prevBatch {
+				c.report(&Violation{Check: CheckBatchOrder, Block: blockNo, Batch: batchNo, Detail: fmt.Sprintf("batch goes down from %d", prevBatch)})
+			}
+			if batchNo != currentBatch || batchBlocks == nil {
+				currentBatch = batchNo
+				if batchBlocks, err = c.checkBatchBlocks(batchNo); err != nil {
+					return err
+				}
+			}
+			if _, ok := batchBlocks[blockNo]; !ok {
+				blockNo, batchNo := blockNo, batchNo
+				c.report(&Violation{Check: CheckBatchBlocks, Block: blockNo, Batch: batchNo, Detail: "block is missing from the blocks of its batch",
+					repair: func(tx kv.RwTx, hermezDb *hermez_db.HermezDb) error { return hermezDb.WriteBlockBatch(blockNo, batchNo) }})
+			}
+
+			forkId, err := c.hermezDb.GetForkId(batchNo)
+			if err != nil {
+				return err
+			}
+			if forkId == 0 {
+				c.report(&Violation{Check: CheckForkId, Block: blockNo, Batch: batchNo, Detail: "batch has no fork id"})
+			} else if forkId < prevForkId {
+				c.report(&Violation{Check: CheckForkId, Block: blockNo, Batch: batchNo, Detail: fmt.Sprintf("fork id goes down from %d to %d", prevForkId, forkId)})
+			}
+			prevBatch, prevForkId = batchNo, max(prevForkId, forkId)
+		}
+
+		if header != nil {
+			if err := c.checkStateRoot(blockNo, batchNo, header.Root); err != nil {
+				return err
+			}
+		}
+		if err := c.checkL1References(blockNo, batchNo); err != nil {
+			return err
+		}
+		if err := c.checkBatchEnd(blockNo, batchNo); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// checkBatchBlocks checks that every block listed for the batch maps back to it and returns the listed blocks
+func (c *checker) checkBatchBlocks(batchNo uint64) (map[uint64]struct{}, error) {
+	blockNos, err := c.hermezDb.GetL2BlockNosByBatch(batchNo)
+	if err != nil {
+		return nil, err
+	}
+
+	listed := make(map[uint64]struct{}, len(blockNos))
+	for _, blockNo := range blockNos {
+		listed[blockNo] = struct{}{}
+		// blocks beyond the head are reported as dangling
+		if blockNo > c.head {
+			continue
+		}
+		mapped, found, err := c.batchOf(blockNo)
+		if err != nil {
+			return nil, err
+		}
+		if !found {
+			c.report(&Violation{Check: CheckBatchBlocks, Block: blockNo, Batch: batchNo, Detail: "listed block has no batch"})
+		} else if mapped != batchNo {
+			blockNo := blockNo
+			c.report(&Violation{Check: CheckBatchBlocks, Block: blockNo, Batch: batchNo, Detail: fmt.Sprintf("listed block belongs to batch %d", mapped),
+				repair: func(tx kv.RwTx, hermezDb *hermez_db.HermezDb) error { return hermezDb.DeleteBatchBlock(batchNo, blockNo) }})
+		}
+	}
+	return listed, nil
+}
+
+func (c *checker) checkStateRoot(blockNo, batchNo uint64, headerRoot common.Hash) error {
+	stateRoot, err := c.hermezDb.GetStateRoot(blockNo)
+	if err != nil {
+		return err
+	}
+	// only nodes syncing from the datastream keep state roots
+	if stateRoot == (common.Hash{}) || stateRoot == headerRoot {
+		return nil
+	}
+	c.report(&Violation{Check: CheckStateRoot, Block: blockNo, Batch: batchNo, Detail: fmt.Sprintf("state root %s, header has %s", stateRoot.Hex(), headerRoot.Hex()),
+		repair: func(tx kv.RwTx, hermezDb *hermez_db.HermezDb) error { return hermezDb.WriteStateRoot(blockNo, headerRoot) }})
+	return nil
+}
+
+func (c *checker) checkL1References(blockNo, batchNo uint64) error {
+	ger, err := c.hermezDb.GetBlockGlobalExitRoot(blockNo)
+	if err != nil {
+		return err
+	}
+	if ger != (common.Hash{}) {
+		// nodes syncing from the datastream record the GERs they have seen, the others have the l1 info tree
+		written, err := c.hermezDb.CheckGlobalExitRootWritten(ger)
+		if err != nil {
+			return err
+		}
+		if !written {
+			update, err := c.hermezDb.GetL1InfoTreeUpdateByGer(ger)
+			if err != nil {
+				return err
+			}
+			if update == nil {
+				c.report(&Violation{Check: CheckGlobalExitRoot, Block: blockNo, Batch: batchNo, Detail: fmt.Sprintf("unknown GER %s", ger.Hex())})
+			}
+		}
+	}
+
+	// nodes syncing from the datastream don't keep the l1 info tree
+	if !c.hasL1InfoTree {
+		return nil
+	}
+	index, err := c.hermezDb.GetBlockL1InfoTreeIndex(blockNo)
+	if err != nil {
+		return err
+	}
+	if index == 0 {
+		return nil
+	}
+	update, err := c.hermezDb.GetL1InfoTreeUpdate(index)
+	if err != nil {
+		return err
+	}
+	if update == nil {
+		c.report(&Violation{Check: CheckL1InfoTreeIndex, Block: blockNo, Batch: batchNo, Detail: fmt.Sprintf("l1 info tree index %d has no leaf", index)})
+	}
+	return nil
+}
+
+func (c *checker) checkBatchEnd(blockNo, batchNo uint64) error {
+	if blockNo >= c.head {
+		return nil
+	}
+	end, err := c.hermezDb.GetBatchEnd(blockNo)
+	if err != nil || !end {
+		return err
+	}
+	nextBatch, found, err := c.batchOf(blockNo + 1)
+	if err != nil {
+		return err
+	}
+	if found && nextBatch == batchNo {
+		c.report(&Violation{Check: CheckBatchEnd, Block: blockNo, Batch: batchNo, Detail: "block is marked as the end of its batch but the next block is in it too",
+			repair: func(tx kv.RwTx, hermezDb *hermez_db.HermezDb) error { return hermezDb.DeleteBatchEnds(blockNo, blockNo) }})
+	}
+	return nil
+}
+
+// checkDangling reports the entries of the block keyed tables beyond the highest canonical block and the blocks of the
+// batches after the batch of that block
+func (c *checker) checkDangling() error {
+	from := hermez_db.Uint64ToBytes(c.head + 1)
+	for _, table := range blockKeyedTables {
+		keys, err := keysFrom(c.tx, table, from)
+		if err != nil {
+			return err
+		}
+		if len(keys) == 0 {
+			continue
+		}
+		table := table
+		c.report(&Violation{Check: CheckDangling, Block: hermez_db.BytesToUint64(keys[0][:8]),
+			Detail: fmt.Sprintf("%d entries in %s beyond the highest canonical block %d", len(keys), table, c.head),
+			repair: func(tx kv.RwTx, hermezDb *hermez_db.HermezDb) error { return deleteKeys(tx, table, keys) }})
+	}
+
+	headBatch, _, err := c.batchOf(c.head)
+	if err != nil {
+		return err
+	}
+	batchKeys, err := keysFrom(c.tx, hermez_db.BATCH_BLOCKS, hermez_db.Uint64ToBytes(headBatch+1))
+	if err != nil {
+		return err
+	}
+	if len(batchKeys) > 0 {
+		c.report(&Violation{Batch: hermez_db.BytesToUint64(batchKeys[0]), Check: CheckDangling,
+			Detail: fmt.Sprintf("%d batches in %s beyond the batch %d of the highest canonical block", len(batchKeys), hermez_db.BATCH_BLOCKS, headBatch),
+			repair: func(tx kv.RwTx, hermezDb *hermez_db.HermezDb) error { return deleteKeys(tx, hermez_db.BATCH_BLOCKS, batchKeys) }})
+	}
+
+	// the head batch may still be listing blocks that were unwound
+	blockNos, err := c.hermezDb.GetL2BlockNosByBatch(headBatch)
+	if err != nil {
+		return err
+	}
+	for _, blockNo := range blockNos {
+		if blockNo > c.head {
+			blockNo := blockNo
+			c.report(&Violation{Check: CheckDangling, Block: blockNo, Batch: headBatch, Detail: "batch lists a block beyond the highest canonical block",
+				repair: func(tx kv.RwTx, hermezDb *hermez_db.HermezDb) error { return hermezDb.DeleteBatchBlock(headBatch, blockNo) }})
+		}
+	}
+	return nil
+}
+
+func keysFrom(tx kv.Tx, table string, from []byte) ([][]byte, error) {
+	c, err := tx.Cursor(table)
+	if err != nil {
+		return nil, err
+	}
+	defer c.Close()
+
+	var keys [][]byte
+	for k, _, err := c.Seek(from); k != nil; k, _, err = c.Next() {
+		if err != nil {
+			return nil, err
+		}
+		if len(k) < 8 {
+			return nil, errors.New("unexpected key in " + table)
+		}
+		keys = append(keys, common.Copy(k))
+	}
+	return keys, nil
+}
+
+func deleteKeys(tx kv.RwTx, table string, keys [][]byte) error {
+	for _, k := range keys {
+		if err := tx.Delete(table, k); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,117 @@
+package consistency
+
+import (
+	"context"
+	"math/big"
+	"testing"
+
+	"github.com/ledgerwatch/erigon-lib/common"
+	"github.com/ledgerwatch/erigon-lib/kv"
+	"github.com/ledgerwatch/erigon-lib/kv/memdb"
+	"github.com/ledgerwatch/erigon/core/rawdb"
+	"github.com/ledgerwatch/erigon/core/types"
+	"github.com/ledgerwatch/erigon/zk/hermez_db"
+	"github.com/stretchr/testify/require"
+)
+
+// writeChain writes blocks 0 to 5 with blocks 1-2 in batch 1 and 3-5 in batch 2
+func writeChain(t *testing.T, tx kv.RwTx) {
+	require.NoError(t, hermez_db.CreateHermezBuckets(tx))
+	hermezDb := hermez_db.NewHermezDb(tx)
+
+	batches := []uint64{0, 1, 1, 2, 2, 2}
+	for blockNo, batchNo := range batches {
+		header := &types.Header{Number: big.NewInt(int64(blockNo)), Root: common.BigToHash(big.NewInt(int64(100 + blockNo)))}
+		require.NoError(t, rawdb.WriteHeader(tx, header))
+		require.NoError(t, rawdb.WriteCanonicalHash(tx, header.Hash(), uint64(blockNo)))
+		require.NoError(t, hermezDb.WriteBlockBatch(uint64(blockNo), batchNo))
+		require.NoError(t, hermezDb.WriteStateRoot(uint64(blockNo), header.Root))
+	}
+	require.NoError(t, hermezDb.WriteForkId(1, 7))
+	require.NoError(t, hermezDb.WriteForkId(2, 7))
+	require.NoError(t, hermezDb.WriteBatchEnd(2))
+	require.NoError(t, hermezDb.WriteBatchEnd(5))
+}
+
+func checks(violations []*Violation) []string {
+	names := make([]string, 0, len(violations))
+	for _, v := range violations {
+		names = append(names, v.Check)
+	}
+	return names
+}
+
+func TestCheck(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("consistent", func(t *testing.T) {
+		_, tx := memdb.NewTestTx(t)
+		writeChain(t, tx)
+
+		violations, err := Check(ctx, tx, 0, 100)
+		require.NoError(t, err)
+		require.Empty(t, violations)
+	})
+
+	t.Run("repairable", func(t *testing.T) {
+		_, tx := memdb.NewTestTx(t)
+		writeChain(t, tx)
+		hermezDb := hermez_db.NewHermezDb(tx)
+
+		require.NoError(t, hermezDb.WriteStateRoot(4, common.HexToHash("0xdead")))
+		require.NoError(t, hermezDb.WriteBatchEnd(3))
+		require.NoError(t, hermezDb.DeleteBatchBlock(2, 5))
+		// left behind by an unwind of blocks 6 and 7
+		require.NoError(t, hermezDb.WriteBlockBatch(6, 2))
+		require.NoError(t, hermezDb.WriteBlockBatch(7, 3))
+		require.NoError(t, hermezDb.WriteStateRoot(7, common.HexToHash("0xbeef")))
+
+		violations, err := Check(ctx, tx, 0, 100)
+		require.NoError(t, err)
+		require.ElementsMatch(t, []string{
+			CheckStateRoot, CheckBatchEnd, CheckBatchBlocks,
+			CheckDangling, CheckDangling, CheckDangling, CheckDangling,
+		}, checks(violations))
+		for _, v := range violations {
+			require.True(t, v.Repairable(), v.String())
+		}
+
+		repaired, err := Repair(tx, violations)
+		require.NoError(t, err)
+		require.Equal(t, len(violations), repaired)
+
+		violations, err = Check(ctx, tx, 0, 100)
+		require.NoError(t, err)
+		require.Empty(t, violations)
+	})
+
+	t.Run("not repairable", func(t *testing.T) {
+		_, tx := memdb.NewTestTx(t)
+		writeChain(t, tx)
+		hermezDb := hermez_db.NewHermezDb(tx)
+
+		require.NoError(t, tx.Delete(hermez_db.BLOCKBATCHES, hermez_db.Uint64ToBytes(4)))
+		require.NoError(t, hermezDb.WriteForkId(2, 6))
+		require.NoError(t, hermezDb.WriteBlockGlobalExitRoot(3, common.HexToHash("0x1234")))
+
+		violations, err := Check(ctx, tx, 0, 100)
+		require.NoError(t, err)
+		// block 4 is still listed by batch 2 so it is reported from both sides
+		require.ElementsMatch(t, []string{CheckBatchBlocks, CheckBlockBatch, CheckForkId, CheckForkId, CheckGlobalExitRoot}, checks(violations))
+		for _, v := range violations {
+			require.False(t, v.Repairable(), v.String())
+		}
+	})
+
+	t.Run("range", func(t *testing.T) {
+		_, tx := memdb.NewTestTx(t)
+		writeChain(t, tx)
+		hermezDb := hermez_db.NewHermezDb(tx)
+
+		require.NoError(t, hermezDb.WriteStateRoot(1, common.HexToHash("0xdead")))
+
+		violations, err := Check(ctx, tx, 2, 5)
+		require.NoError(t, err)
+		require.Empty(t, violations)
+	})
+}
@@ -0,0 +1,391 @@
+package audit
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/0xPolygonHermez/zkevm-data-streamer/datastreamer"
+	"github.com/ledgerwatch/erigon-lib/kv"
+	"github.com/ledgerwatch/erigon-lib/metrics"
+	"github.com/ledgerwatch/log/v3"
+
+	"github.com/ledgerwatch/erigon/core/rawdb"
+	"github.com/ledgerwatch/erigon/crypto"
+	"github.com/ledgerwatch/erigon/eth/stagedsync/stages"
+	"github.com/ledgerwatch/erigon/zk/datastream/server"
+	"github.com/ledgerwatch/erigon/zk/datastream/types"
+	"github.com/ledgerwatch/erigon/zk/hermez_db"
+)
+
+const (
+	// ModeSample audits the latest closed batch and random older ones every round
+	ModeSample = "sample"
+	// ModeScan audits the batches in order, starting again from the first one when it reaches the tip
+	ModeScan = "scan"
+
+	maxRecentDivergences = 100
+)
+
+// the checks done on every batch, used as the check of a divergence
+const (
+	CheckBatchBlocks      = "batch-blocks"
+	CheckBlockHash        = "block-hash"
+	CheckParentHash       = "parent-hash"
+	CheckStateRoot        = "state-root"
+	CheckGer              = "ger"
+	CheckL1InfoTreeIndex  = "l1-info-tree-index"
+	CheckTransactionCount = "tx-count"
+	CheckTransaction      = "tx"
+)
+
+var (
+	auditedBatchesCounter = metrics.GetOrCreateCounter(`datastream_audit_batches_total`)
+	auditErrorsCounter    = metrics.GetOrCreateCounter(`datastream_audit_errors_total`)
+	lastAuditedBatchGauge = metrics.GetOrCreateGauge(`datastream_audit_last_batch`)
+)
+
+func divergencesCounter(check string) metrics.Counter {
+	return metrics.GetOrCreateCounter(fmt.Sprintf(`datastream_audit_divergences_total{check="%s"}`, check))
+}
+
+// Config is how the auditor picks the batches it compares
+type Config struct {
+	Mode string
+	// Interval is the pause between two rounds
+	Interval time.Duration
+	// Batches is how many batches are audited every round
+	Batches uint64
+}
+
+func (c Config) Validate() error {
+	if c.Mode != ModeSample && c.Mode != ModeScan {
+		return fmt.Errorf("unknown datastream audit mode %q, expected %s or %s", c.Mode, ModeSample, ModeScan)
+	}
+	if c.Interval <= 0 {
+		return fmt.Errorf("datastream audit interval must be positive")
+	}
+	if c.Batches == 0 {
+		return fmt.Errorf("datastream audit batches must be positive")
+	}
+	return nil
+}
+
+// Divergence is a value of the datastream that doesn't match the database
+type Divergence struct {
+	Batch      uint64 `json:"batch"`
+	Block      uint64 `json:"block,omitempty"`
+	Check      string `json:"check"`
+	Stream     string `json:"stream"`
+	Db         string `json:"db"`
+	DetectedAt uint64 `json:"detectedAt"`
+}
+
+func (d *Divergence) String() string {
+	return fmt.Sprintf("batch %d block %d %s: stream %s, db %s", d.Batch, d.Block, d.Check, d.Stream, d.Db)
+}
+
+// Status is what the auditor found since the node started
+type Status struct {
+	Mode    string `json:"mode"`
+	Healthy bool   `json:"healthy"`
+	// LastRound is the unix time of the last finished round
+	LastRound        uint64 `json:"lastRound"`
+	AuditedBatches   uint64 `json:"auditedBatches"`
+	LastAuditedBatch uint64 `json:"lastAuditedBatch"`
+	// ScanPosition is the next batch audited in scan mode
+	ScanPosition uint64 `json:"scanPosition,omitempty"`
+	Divergences  uint64 `json:"divergences"`
+	// RecentDivergences are the last divergences found, oldest first
+	RecentDivergences []*Divergence `json:"recentDivergences"`
+	LastError         string        `json:"lastError,omitempty"`
+}
+
+// Auditor compares the batches of the datastream with the database in the background, so a drift between the two
+// is noticed when it happens rather than when a client trips over it
+type Auditor struct {
+	cfg     Config
+	db      kv.RoDB
+	stream  *datastreamer.StreamServer
+	chainId uint64
+	rand    *rand.Rand
+
+	mu       sync.Mutex
+	scanNext uint64
+	status   Status
+}
+
+func New(cfg Config, db kv.RoDB, stream *datastreamer.StreamServer, chainId uint64) (*Auditor, error) {
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	return &Auditor{
+		cfg:      cfg,
+		db:       db,
+		stream:   stream,
+		chainId:  chainId,
+		rand:     rand.New(rand.NewSource(time.Now().UnixNano())),
+		scanNext: 1,
+		status:   Status{Mode: cfg.Mode, Healthy: true},
+	}, nil
+}
+
+// Run audits a round of batches every interval until the context is done
+func (a *Auditor) Run(ctx context.Context) {
+	log.Info("[Datastream audit] Starting", "mode", a.cfg.Mode, "interval", a.cfg.Interval, "batches", a.cfg.Batches)
+
+	ticker := time.NewTicker(a.cfg.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		if err := a.round(ctx); err != nil && ctx.Err() == nil {
+			auditErrorsCounter.Inc()
+			log.Warn("[Datastream audit] Round failed", "err", err)
+			a.mu.Lock()
+			a.status.LastError = err.Error()
+			a.mu.Unlock()
+		}
+	}
+}
+
+// Status returns a copy of what the auditor found so far
+func (a *Auditor) Status() *Status {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	status := a.status
+	status.RecentDivergences = append([]*Divergence{}, a.status.RecentDivergences...)
+	if a.cfg.Mode == ModeScan {
+		status.ScanPosition = a.scanNext
+	}
+	return &status
+}
+
+func (a *Auditor) round(ctx context.Context) error {
+	highest, err := a.highestAuditableBatch(ctx)
+	if err != nil {
+		return err
+	}
+	if highest == 0 {
+		return nil
+	}
+
+	for _, batchNo := range a.pick(highest) {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+
+		divergences, err := a.auditBatch(ctx, batchNo)
+		if err != nil {
+			return err
+		}
+		if len(divergences) > 0 {
+			// the stream and the db are written in different transactions and both unwind, audit again so a
+			// batch caught halfway through either isn't reported
+			if divergences, err = a.auditBatch(ctx, batchNo); err != nil {
+				return err
+			}
+		}
+
+		a.record(batchNo, divergences)
+	}
+
+	a.mu.Lock()
+	a.status.LastRound = uint64(time.Now().Unix())
+	a.status.LastError = ""
+	a.mu.Unlock()
+
+	return nil
+}
+
+// highestAuditableBatch is the highest batch closed in the stream whose blocks are committed to the db
+func (a *Auditor) highestAuditableBatch(ctx context.Context) (uint64, error) {
+	closed, err := server.NewDataStreamServer(a.stream, a.chainId).GetHighestClosedBatchNoCache()
+	if err != nil {
+		return 0, err
+	}
+
+	var committed uint64
+	if err := a.db.View(ctx, func(tx kv.Tx) error {
+		progress, err := stages.GetStageProgress(tx, stages.DataStream)
+		if err != nil {
+			return err
+		}
+		if progress == 0 {
+			return nil
+		}
+		batchNo, err := hermez_db.NewHermezDbReader(tx).GetBatchNoByL2Block(progress)
+		if err != nil {
+			return err
+		}
+		// the batch of the stage progress may still be open
+		if batchNo > 0 {
+			committed = batchNo - 1
+		}
+		return nil
+	}); err != nil {
+		return 0, err
+	}
+
+	return min(closed, committed), nil
+}
+
+func (a *Auditor) pick(highest uint64) []uint64 {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	var batches []uint64
+	switch a.cfg.Mode {
+	case ModeSample:
+		batches = append(batches, highest)
+		for i := uint64(1); i < a.cfg.Batches && i < highest; i++ {
+			batches = append(batches, 1+uint64(a.rand.Int63n(int64(highest))))
+		}
+	case ModeScan:
+		for i := uint64(0); i < a.cfg.Batches; i++ {
+			if a.scanNext > highest {
+				log.Info("[Datastream audit] Scanned every batch", "highest", highest)
+				a.scanNext = 1
+				break
+			}
+			batches = append(batches, a.scanNext)
+			a.scanNext++
+		}
+	}
+	return batches
+}
+
+func (a *Auditor) record(batchNo uint64, divergences []*Divergence) {
+	auditedBatchesCounter.Inc()
+	lastAuditedBatchGauge.SetUint64(batchNo)
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	a.status.AuditedBatches++
+	a.status.LastAuditedBatch = batchNo
+	for _, d := range divergences {
+		log.Error("[Datastream audit] Datastream diverges from the database", "batch", d.Batch, "block", d.Block, "check", d.Check, "stream", d.Stream, "db", d.Db)
+		divergencesCounter(d.Check).Inc()
+		a.status.Healthy = false
+		a.status.Divergences++
+		a.status.RecentDivergences = append(a.status.RecentDivergences, d)
+	}
+	if extra := len(a.status.RecentDivergences) - maxRecentDivergences; extra > 0 {
+		a.status.RecentDivergences = a.status.RecentDivergences[extra:]
+	}
+}
+
+func (a *Auditor) auditBatch(ctx context.Context, batchNo uint64) ([]*Divergence, error) {
+	// a fresh server every time, the server caches the highest block and batch it wrote
+	batches, err := server.NewDataStreamServer(a.stream, a.chainId).ReadBatches(batchNo, batchNo)
+	if err != nil {
+		return nil, fmt.Errorf("reading batch %d from the datastream: %w", batchNo, err)
+	}
+
+	var divergences []*Divergence
+	if err := a.db.View(ctx, func(tx kv.Tx) error {
+		divergences, err = compareBatch(tx, batchNo, batches[0])
+		return err
+	}); err != nil {
+		return nil, fmt.Errorf("auditing batch %d: %w", batchNo, err)
+	}
+	return divergences, nil
+}
+
+// compareBatch returns where the blocks of the batch in the stream differ from the db
+func compareBatch(tx kv.Tx, batchNo uint64, streamBlocks []*types.FullL2Block) ([]*Divergence, error) {
+	hermezDb := hermez_db.NewHermezDbReader(tx)
+	now := uint64(time.Now().Unix())
+
+	var divergences []*Divergence
+	diverge := func(blockNo uint64, check string, stream, db interface{}) {
+		divergences = append(divergences, &Divergence{
+			Batch:      batchNo,
+			Block:      blockNo,
+			Check:      check,
+			Stream:     fmt.Sprint(stream),
+			Db:         fmt.Sprint(db),
+			DetectedAt: now,
+		})
+	}
+
+	dbBlockNos, err := hermezDb.GetL2BlockNosByBatch(batchNo)
+	if err != nil {
+		return nil, err
+	}
+	streamBlockNos := make([]uint64, 0, len(streamBlocks))
+	for _, block := range streamBlocks {
+		streamBlockNos = append(streamBlockNos, block.L2BlockNumber)
+	}
+	if fmt.Sprint(streamBlockNos) != fmt.Sprint(dbBlockNos) {
+		diverge(0, CheckBatchBlocks, streamBlockNos, dbBlockNos)
+	}
+
+	for _, streamBlock := range streamBlocks {
+		blockNo := streamBlock.L2BlockNumber
+
+		hash, err := rawdb.ReadCanonicalHash(tx, blockNo)
+		if err != nil {
+			return nil, err
+		}
+		block := rawdb.ReadBlock(tx, hash, blockNo)
+		if block == nil {
+			diverge(blockNo, CheckBlockHash, streamBlock.L2Blockhash, "missing")
+			continue
+		}
+
+		if streamBlock.L2Blockhash != block.Hash() {
+			diverge(blockNo, CheckBlockHash, streamBlock.L2Blockhash, block.Hash())
+		}
+		if streamBlock.ParentHash != block.ParentHash() {
+			diverge(blockNo, CheckParentHash, streamBlock.ParentHash, block.ParentHash())
+		}
+		if streamBlock.StateRoot != block.Root() {
+			diverge(blockNo, CheckStateRoot, streamBlock.StateRoot, block.Root())
+		}
+
+		ger, err := hermezDb.GetBlockGlobalExitRoot(blockNo)
+		if err != nil {
+			return nil, err
+		}
+		if streamBlock.GlobalExitRoot != ger {
+			diverge(blockNo, CheckGer, streamBlock.GlobalExitRoot, ger)
+		}
+
+		l1InfoTreeIndex, err := hermezDb.GetBlockL1InfoTreeIndex(blockNo)
+		if err != nil {
+			return nil, err
+		}
+		if uint64(streamBlock.L1InfoTreeIndex) != l1InfoTreeIndex {
+			diverge(blockNo, CheckL1InfoTreeIndex, streamBlock.L1InfoTreeIndex, l1InfoTreeIndex)
+		}
+
+		txs := block.Transactions()
+		if len(streamBlock.L2Txs) != len(txs) {
+			diverge(blockNo, CheckTransactionCount, len(streamBlock.L2Txs), len(txs))
+			continue
+		}
+		for i, transaction := range txs {
+			var encoded bytes.Buffer
+			if err := transaction.EncodeRLP(&encoded); err != nil {
+				return nil, err
+			}
+			if !bytes.Equal(streamBlock.L2Txs[i].Encoded, encoded.Bytes()) {
+				// the hashes of the encodings keep the status readable
+				diverge(blockNo, CheckTransaction, fmt.Sprintf("tx %d %s", i, crypto.Keccak256Hash(streamBlock.L2Txs[i].Encoded)), fmt.Sprintf("tx %d %s", i, crypto.Keccak256Hash(encoded.Bytes())))
+			}
+		}
+	}
+
+	return divergences, nil
+}
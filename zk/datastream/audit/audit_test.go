@@ -0,0 +1,103 @@
+package audit
+
+import (
+	"bytes"
+	"math/big"
+	"testing"
+	"time"
+
+	libcommon "github.com/ledgerwatch/erigon-lib/common"
+	"github.com/ledgerwatch/erigon-lib/kv/memdb"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ledgerwatch/erigon/common/u256"
+	"github.com/ledgerwatch/erigon/core/rawdb"
+	"github.com/ledgerwatch/erigon/core/types"
+	dstypes "github.com/ledgerwatch/erigon/zk/datastream/types"
+	"github.com/ledgerwatch/erigon/zk/hermez_db"
+)
+
+func TestCompareBatch(t *testing.T) {
+	_, dbTx := memdb.NewTestTx(t)
+	require.NoError(t, hermez_db.CreateHermezBuckets(dbTx))
+	hermezDb := hermez_db.NewHermezDb(dbTx)
+
+	ger := libcommon.HexToHash("0xabc")
+	var streamBlocks []*dstypes.FullL2Block
+	parent := libcommon.Hash{}
+	for blockNo := uint64(1); blockNo <= 2; blockNo++ {
+		tx := types.NewTransaction(blockNo, libcommon.HexToAddress("0x1000"), u256.Num1, 1, u256.Num1, nil)
+		block := types.NewBlockWithHeader(&types.Header{
+			Number:     new(big.Int).SetUint64(blockNo),
+			ParentHash: parent,
+			Root:       libcommon.BigToHash(new(big.Int).SetUint64(blockNo)),
+		}).WithBody(types.Transactions{tx}, nil)
+		parent = block.Hash()
+
+		require.NoError(t, rawdb.WriteBlock(dbTx, block))
+		require.NoError(t, rawdb.WriteCanonicalHash(dbTx, block.Hash(), blockNo))
+		require.NoError(t, hermezDb.WriteBlockBatch(blockNo, 1))
+		require.NoError(t, hermezDb.WriteBlockGlobalExitRoot(blockNo, ger))
+		require.NoError(t, hermezDb.WriteBlockL1InfoTreeIndex(blockNo, 7))
+
+		var encoded bytes.Buffer
+		require.NoError(t, tx.EncodeRLP(&encoded))
+		streamBlocks = append(streamBlocks, &dstypes.FullL2Block{
+			BatchNumber:     1,
+			L2BlockNumber:   blockNo,
+			L2Blockhash:     block.Hash(),
+			ParentHash:      block.ParentHash(),
+			StateRoot:       block.Root(),
+			GlobalExitRoot:  ger,
+			L1InfoTreeIndex: 7,
+			L2Txs:           []dstypes.L2TransactionProto{{L2BlockNumber: blockNo, Encoded: encoded.Bytes()}},
+		})
+	}
+
+	divergences, err := compareBatch(dbTx, 1, streamBlocks)
+	require.NoError(t, err)
+	require.Empty(t, divergences)
+
+	streamBlocks[1].GlobalExitRoot = libcommon.HexToHash("0xdef")
+	streamBlocks[1].L2Txs[0].Encoded = []byte{1}
+	divergences, err = compareBatch(dbTx, 1, streamBlocks)
+	require.NoError(t, err)
+	require.Len(t, divergences, 2)
+	require.Equal(t, CheckGer, divergences[0].Check)
+	require.Equal(t, uint64(2), divergences[0].Block)
+	require.Equal(t, CheckTransaction, divergences[1].Check)
+
+	// a block missing from the stream is a batch boundary divergence
+	divergences, err = compareBatch(dbTx, 1, streamBlocks[:1])
+	require.NoError(t, err)
+	require.Len(t, divergences, 1)
+	require.Equal(t, CheckBatchBlocks, divergences[0].Check)
+	require.Equal(t, "[1]", divergences[0].Stream)
+	require.Equal(t, "[1 2]", divergences[0].Db)
+}
+
+func TestAuditorPick(t *testing.T) {
+	scan, err := New(Config{Mode: ModeScan, Interval: time.Second, Batches: 3}, nil, nil, 1)
+	require.NoError(t, err)
+	require.Equal(t, []uint64{1, 2, 3}, scan.pick(4))
+	require.Equal(t, []uint64{4}, scan.pick(4))
+	require.Equal(t, []uint64{1, 2, 3}, scan.pick(4))
+
+	sample, err := New(Config{Mode: ModeSample, Interval: time.Second, Batches: 5}, nil, nil, 1)
+	require.NoError(t, err)
+	batches := sample.pick(10)
+	require.Len(t, batches, 5)
+	require.Equal(t, uint64(10), batches[0])
+	for _, batchNo := range batches {
+		require.True(t, batchNo >= 1 && batchNo <= 10)
+	}
+
+	sample.record(3, []*Divergence{{Batch: 3, Check: CheckStateRoot}})
+	status := sample.Status()
+	require.False(t, status.Healthy)
+	require.Equal(t, uint64(1), status.Divergences)
+	require.Equal(t, uint64(3), status.LastAuditedBatch)
+
+	_, err = New(Config{Mode: "full"}, nil, nil, 1)
+	require.Error(t, err)
+}
@@ -680,12 +680,18 @@ LOOP_ENTRIES:
 
 		switch parsedProto := parsedProto.(type) {
 		case *types.BatchStart:
+			if parsedProto.Number < start || parsedProto.Number > end {
+				return nil, fmt.Errorf("unexpected batch start %d reading batches %d to %d", parsedProto.Number, start, end)
+			}
 			batches[parsedProto.Number-start] = []*types.FullL2Block{}
 		case *types.BatchEnd:
 			if parsedProto.Number == end {
 				break LOOP_ENTRIES
 			}
 		case *types.FullL2Block:
+			if parsedProto.BatchNumber < start || parsedProto.BatchNumber > end {
+				return nil, fmt.Errorf("unexpected block %d of batch %d reading batches %d to %d", parsedProto.L2BlockNumber, parsedProto.BatchNumber, start, end)
+			}
 			batches[parsedProto.BatchNumber-start] = append(batches[parsedProto.BatchNumber-start], parsedProto)
 		default:
 			continue
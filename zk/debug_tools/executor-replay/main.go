@@ -0,0 +1,81 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/ledgerwatch/erigon/zk/legacy_executor_verifier/proto/github.com/0xPolygonHermez/zkevm-node/state/runtime/executor"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+)
+
+// replays the payloads recorded with zkevm.executor-payload-output against one or more executors and compares the
+// results with the roots and counters the node recorded, exits with 1 if any executor regressed
+func main() {
+	dir := flag.String("dir", "", "directory with the recorded payload_N.json and expected_N.json files")
+	endpoints := flag.String("endpoints", "", "comma separated list of executor grpc endpoints")
+	from := flag.Uint64("from", 0, "first batch to replay")
+	to := flag.Uint64("to", 0, "last batch to replay, 0 for all")
+	timeout := flag.Duration("timeout", 60*time.Second, "timeout of a single executor request")
+	output := flag.String("output", "", "optional file to write the full summary to as json")
+	flag.Parse()
+
+	if *dir == "" || *endpoints == "" {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	if err := run(*dir, strings.Split(*endpoints, ","), *from, *to, *timeout, *output); err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+}
+
+func run(dir string, endpoints []string, from, to uint64, timeout time.Duration, output string) error {
+	batches, err := loadRecordedBatches(dir, from, to)
+	if err != nil {
+		return err
+	}
+	if len(batches) == 0 {
+		return fmt.Errorf("no recorded payloads found in %s", dir)
+	}
+
+	targets := make([]replayTarget, 0, len(endpoints))
+	for _, endpoint := range endpoints {
+		endpoint = strings.TrimSpace(endpoint)
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		conn, err := grpc.DialContext(ctx, endpoint, grpc.WithTransportCredentials(insecure.NewCredentials()), grpc.WithBlock())
+		cancel()
+		if err != nil {
+			return fmt.Errorf("failed to connect to %s: %w", endpoint, err)
+		}
+		defer conn.Close()
+		targets = append(targets, replayTarget{Url: endpoint, Client: executor.NewExecutorServiceClient(conn)})
+	}
+
+	fmt.Printf("replaying %d batches (%d-%d) against %d executors\n", len(batches), batches[0].BatchNumber, batches[len(batches)-1].BatchNumber, len(targets))
+	summary := replayRecordedBatches(context.Background(), batches, targets, timeout)
+	if err = summary.Print(os.Stdout); err != nil {
+		return err
+	}
+
+	if output != "" {
+		asJson, err := json.MarshalIndent(summary, "", "  ")
+		if err != nil {
+			return err
+		}
+		if err = os.WriteFile(output, asJson, 0644); err != nil {
+			return err
+		}
+	}
+
+	if summary.Regressions() {
+		return fmt.Errorf("regressions found")
+	}
+	return nil
+}
@@ -0,0 +1,304 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"github.com/ledgerwatch/erigon-lib/common"
+	"github.com/ledgerwatch/erigon/zk/legacy_executor_verifier"
+	"github.com/ledgerwatch/erigon/zk/legacy_executor_verifier/proto/github.com/0xPolygonHermez/zkevm-node/state/runtime/executor"
+	"google.golang.org/grpc"
+)
+
+// recordedBatch is a payload written by an executor with an output location, Expected is nil for recordings made
+// before expectations were written
+type recordedBatch struct {
+	BatchNumber uint64
+	Request     *executor.ProcessStatelessBatchRequestV2
+	Expected    *legacy_executor_verifier.RecordedExpectation
+}
+
+// loadRecordedBatches reads the payloads recorded in dir for batches from-to, to of 0 means no upper limit.  The
+// batches are returned in order.
+func loadRecordedBatches(dir string, from, to uint64) ([]*recordedBatch, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var batches []*recordedBatch
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !strings.HasPrefix(name, legacy_executor_verifier.RecordedPayloadPrefix) || !strings.HasSuffix(name, ".json") {
+			continue
+		}
+		batchNumber, err := strconv.ParseUint(strings.TrimSuffix(strings.TrimPrefix(name, legacy_executor_verifier.RecordedPayloadPrefix), ".json"), 10, 64)
+		if err != nil {
+			continue
+		}
+		if batchNumber < from || (to > 0 && batchNumber > to) {
+			continue
+		}
+
+		contents, err := os.ReadFile(path.Join(dir, name))
+		if err != nil {
+			return nil, err
+		}
+		batch := &recordedBatch{BatchNumber: batchNumber, Request: &executor.ProcessStatelessBatchRequestV2{}}
+		if err = json.Unmarshal(contents, batch.Request); err != nil {
+			return nil, fmt.Errorf("failed to read %s: %w", name, err)
+		}
+
+		contents, err = os.ReadFile(path.Join(dir, fmt.Sprintf("%s%d.json", legacy_executor_verifier.RecordedExpectationPrefix, batchNumber)))
+		switch {
+		case errors.Is(err, os.ErrNotExist):
+		case err != nil:
+			return nil, err
+		default:
+			batch.Expected = &legacy_executor_verifier.RecordedExpectation{}
+			if err = json.Unmarshal(contents, batch.Expected); err != nil {
+				return nil, fmt.Errorf("failed to read expectation of batch %d: %w", batchNumber, err)
+			}
+		}
+
+		batches = append(batches, batch)
+	}
+
+	sort.Slice(batches, func(i, j int) bool {
+		return batches[i].BatchNumber < batches[j].BatchNumber
+	})
+	return batches, nil
+}
+
+// replayTarget is an executor recorded batches are replayed against
+type replayTarget struct {
+	Url    string
+	Client executor.ExecutorServiceClient
+}
+
+type replayStatus string
+
+const (
+	replayMatch      replayStatus = "match"
+	replayMismatch   replayStatus = "mismatch"
+	replayError      replayStatus = "error"
+	replayUnverified replayStatus = "unverified"
+)
+
+type counterDelta struct {
+	Counter  string `json:"counter"`
+	Recorded int    `json:"recorded"`
+	Executor int    `json:"executor"`
+}
+
+type replayResult struct {
+	BatchNumber       uint64         `json:"batchNumber"`
+	Executor          string         `json:"executor"`
+	Status            replayStatus   `json:"status"`
+	Duration          time.Duration  `json:"duration"`
+	StateRoot         common.Hash    `json:"stateRoot"`
+	ExpectedStateRoot *common.Hash   `json:"expectedStateRoot,omitempty"`
+	Counters          map[string]int `json:"counters,omitempty"`
+	// CounterUndershoots are the counters the node recorded lower than the executor used, the batch could overflow
+	// on the prover
+	CounterUndershoots []counterDelta `json:"counterUndershoots,omitempty"`
+	Error              string         `json:"error,omitempty"`
+}
+
+type replayExecutorSummary struct {
+	Executor           string        `json:"executor"`
+	Batches            int           `json:"batches"`
+	Matches            int           `json:"matches"`
+	Mismatches         int           `json:"mismatches"`
+	Errors             int           `json:"errors"`
+	Unverified         int           `json:"unverified"`
+	CounterUndershoots int           `json:"counterUndershoots"`
+	TotalDuration      time.Duration `json:"totalDuration"`
+	MaxDuration        time.Duration `json:"maxDuration"`
+}
+
+type replaySummary struct {
+	Executors []*replayExecutorSummary `json:"executors"`
+	Results   []*replayResult          `json:"results"`
+	// Disagreements are the batches the executors returned different state roots for
+	Disagreements []uint64 `json:"disagreements,omitempty"`
+}
+
+// Regressions reports whether any executor failed, returned an unexpected root or used more counters than recorded
+func (s *replaySummary) Regressions() bool {
+	if len(s.Disagreements) > 0 {
+		return true
+	}
+	for _, e := range s.Executors {
+		if e.Mismatches > 0 || e.Errors > 0 || e.CounterUndershoots > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *replaySummary) Print(w io.Writer) error {
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(tw, "executor\tbatches\tmatch\tmismatch\terror\tunverified\tcounter undershoot\tavg time\tmax time")
+	for _, e := range s.Executors {
+		var avg time.Duration
+		if e.Batches > 0 {
+			avg = e.TotalDuration / time.Duration(e.Batches)
+		}
+		fmt.Fprintf(tw, "%s\t%d\t%d\t%d\t%d\t%d\t%d\t%s\t%s\n", e.Executor, e.Batches, e.Matches, e.Mismatches, e.Errors, e.Unverified, e.CounterUndershoots, avg.Round(time.Millisecond), e.MaxDuration.Round(time.Millisecond))
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+
+	for _, r := range s.Results {
+		switch r.Status {
+		case replayMismatch:
+			fmt.Fprintf(w, "batch %d: %s returned root %s, recorded %s\n", r.BatchNumber, r.Executor, r.StateRoot, r.ExpectedStateRoot)
+		case replayError:
+			fmt.Fprintf(w, "batch %d: %s failed: %s\n", r.BatchNumber, r.Executor, r.Error)
+		}
+		for _, d := range r.CounterUndershoots {
+			fmt.Fprintf(w, "batch %d: %s used %d %s counters, recorded %d\n", r.BatchNumber, r.Executor, d.Executor, d.Counter, d.Recorded)
+		}
+	}
+	for _, batchNumber := range s.Disagreements {
+		fmt.Fprintf(w, "batch %d: executors returned different state roots\n", batchNumber)
+	}
+	return nil
+}
+
+// replayRecordedBatches sends every batch to all targets at once and compares the answers with the recorded
+// expectations and with each other.  Batches are replayed one after the other in the order given.
+func replayRecordedBatches(ctx context.Context, batches []*recordedBatch, targets []replayTarget, timeout time.Duration) *replaySummary {
+	summary := &replaySummary{}
+	byExecutor := make(map[string]*replayExecutorSummary, len(targets))
+	for _, t := range targets {
+		byExecutor[t.Url] = &replayExecutorSummary{Executor: t.Url}
+		summary.Executors = append(summary.Executors, byExecutor[t.Url])
+	}
+
+	for _, batch := range batches {
+		if ctx.Err() != nil {
+			break
+		}
+
+		results := make([]*replayResult, len(targets))
+		var wg sync.WaitGroup
+		for i, t := range targets {
+			wg.Add(1)
+			go func(i int, t replayTarget) {
+				defer wg.Done()
+				results[i] = replayBatch(ctx, batch, t, timeout)
+			}(i, t)
+		}
+		wg.Wait()
+
+		roots := make(map[common.Hash]struct{})
+		for _, r := range results {
+			if r.Status != replayError {
+				roots[r.StateRoot] = struct{}{}
+			}
+
+			e := byExecutor[r.Executor]
+			e.Batches++
+			e.TotalDuration += r.Duration
+			if r.Duration > e.MaxDuration {
+				e.MaxDuration = r.Duration
+			}
+			switch r.Status {
+			case replayMatch:
+				e.Matches++
+			case replayMismatch:
+				e.Mismatches++
+			case replayError:
+				e.Errors++
+			case replayUnverified:
+				e.Unverified++
+			}
+			if len(r.CounterUndershoots) > 0 {
+				e.CounterUndershoots++
+			}
+		}
+		if len(roots) > 1 {
+			summary.Disagreements = append(summary.Disagreements, batch.BatchNumber)
+		}
+		summary.Results = append(summary.Results, results...)
+	}
+
+	return summary
+}
+
+func replayBatch(ctx context.Context, batch *recordedBatch, target replayTarget, timeout time.Duration) *replayResult {
+	result := &replayResult{BatchNumber: batch.BatchNumber, Executor: target.Url}
+
+	size := 1024 * 1024 * 256
+	sendCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	start := time.Now()
+	resp, err := target.Client.ProcessStatelessBatchV2(sendCtx, batch.Request, grpc.MaxCallSendMsgSize(size), grpc.MaxCallRecvMsgSize(size))
+	result.Duration = time.Since(start)
+	if err == nil && resp == nil {
+		err = errors.New("nil response")
+	}
+	if err != nil {
+		result.Status = replayError
+		result.Error = err.Error()
+		return result
+	}
+
+	result.StateRoot = common.BytesToHash(resp.NewStateRoot)
+	result.Counters = legacy_executor_verifier.ResponseCounters(resp)
+
+	// without an expectation only the executor errors are checked
+	request := &legacy_executor_verifier.VerifierRequest{BatchNumber: batch.BatchNumber, ForkId: resp.ForkId, StateRoot: result.StateRoot}
+	if batch.Expected != nil {
+		request.ForkId = batch.Expected.ForkId
+		request.StateRoot = batch.Expected.StateRoot
+		result.ExpectedStateRoot = &batch.Expected.StateRoot
+	}
+
+	_, _, err = legacy_executor_verifier.CheckResponse(resp, request)
+	switch {
+	case errors.Is(err, legacy_executor_verifier.ErrExecutorStateRootMismatch):
+		result.Status = replayMismatch
+	case err != nil:
+		result.Status = replayError
+		result.Error = err.Error()
+	case batch.Expected == nil:
+		result.Status = replayUnverified
+	default:
+		result.Status = replayMatch
+	}
+
+	if batch.Expected != nil && len(batch.Expected.Counters) > 0 {
+		for _, counter := range sortedCounterNames(result.Counters) {
+			if used, recorded := result.Counters[counter], batch.Expected.Counters[counter]; recorded < used {
+				result.CounterUndershoots = append(result.CounterUndershoots, counterDelta{Counter: counter, Recorded: recorded, Executor: used})
+			}
+		}
+	}
+
+	return result
+}
+
+func sortedCounterNames(counters map[string]int) []string {
+	names := make([]string, 0, len(counters))
+	for name := range counters {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
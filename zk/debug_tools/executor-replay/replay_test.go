@@ -0,0 +1,112 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/ledgerwatch/erigon-lib/common"
+	"github.com/ledgerwatch/erigon/zk/legacy_executor_verifier"
+	"github.com/ledgerwatch/erigon/zk/legacy_executor_verifier/proto/github.com/0xPolygonHermez/zkevm-node/state/runtime/executor"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+)
+
+type replayClient struct {
+	executor.ExecutorServiceClient
+	resp *executor.ProcessBatchResponseV2
+	err  error
+}
+
+func (c *replayClient) ProcessStatelessBatchV2(context.Context, *executor.ProcessStatelessBatchRequestV2, ...grpc.CallOption) (*executor.ProcessBatchResponseV2, error) {
+	return c.resp, c.err
+}
+
+func writeRecording(t *testing.T, dir string, batchNumber uint64, expected *legacy_executor_verifier.RecordedExpectation) {
+	asJson, err := json.Marshal(&executor.ProcessStatelessBatchRequestV2{Witness: []byte{1, 2}, DataStream: []byte{3}})
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(path.Join(dir, fmt.Sprintf("%s%d.json", legacy_executor_verifier.RecordedPayloadPrefix, batchNumber)), asJson, 0644))
+
+	// older recordings don't have an expectation next to the payload
+	if expected == nil {
+		return
+	}
+	asJson, err = json.Marshal(expected)
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(path.Join(dir, fmt.Sprintf("%s%d.json", legacy_executor_verifier.RecordedExpectationPrefix, batchNumber)), asJson, 0644))
+}
+
+func TestReplayRecordedBatches(t *testing.T) {
+	dir := t.TempDir()
+	root := common.HexToHash("0x1234")
+
+	writeRecording(t, dir, 5, &legacy_executor_verifier.RecordedExpectation{
+		BatchNumber:  5,
+		ForkId:       9,
+		BlockNumbers: []uint64{50},
+		StateRoot:    root,
+		Counters:     map[string]int{"S": 100, "K": 2},
+	})
+	writeRecording(t, dir, 6, nil)
+
+	batches, err := loadRecordedBatches(dir, 0, 0)
+	require.NoError(t, err)
+	require.Len(t, batches, 2)
+	assert.Equal(t, uint64(5), batches[0].BatchNumber)
+	assert.Equal(t, []byte{1, 2}, batches[0].Request.Witness)
+	require.NotNil(t, batches[0].Expected)
+	assert.Equal(t, root, batches[0].Expected.StateRoot)
+	assert.Equal(t, map[string]int{"S": 100, "K": 2}, batches[0].Expected.Counters)
+	assert.Nil(t, batches[1].Expected)
+
+	filtered, err := loadRecordedBatches(dir, 6, 6)
+	require.NoError(t, err)
+	require.Len(t, filtered, 1)
+	assert.Equal(t, uint64(6), filtered[0].BatchNumber)
+
+	targets := []replayTarget{
+		{Url: "same", Client: &replayClient{resp: &executor.ProcessBatchResponseV2{NewStateRoot: root.Bytes(), CntSteps: 100, CntKeccakHashes: 2}}},
+		{Url: "hungry", Client: &replayClient{resp: &executor.ProcessBatchResponseV2{NewStateRoot: root.Bytes(), CntSteps: 150}}},
+		{Url: "wrong", Client: &replayClient{resp: &executor.ProcessBatchResponseV2{NewStateRoot: common.HexToHash("0x1").Bytes()}}},
+		{Url: "broken", Client: &replayClient{err: errors.New("unavailable")}},
+	}
+	summary := replayRecordedBatches(context.Background(), batches, targets, time.Second)
+
+	require.Len(t, summary.Results, 8)
+	statuses := make(map[string][]replayStatus)
+	for _, r := range summary.Results {
+		statuses[r.Executor] = append(statuses[r.Executor], r.Status)
+	}
+	assert.Equal(t, []replayStatus{replayMatch, replayUnverified}, statuses["same"])
+	assert.Equal(t, []replayStatus{replayMatch, replayUnverified}, statuses["hungry"])
+	assert.Equal(t, []replayStatus{replayMismatch, replayUnverified}, statuses["wrong"])
+	assert.Equal(t, []replayStatus{replayError, replayError}, statuses["broken"])
+
+	assert.Equal(t, []counterDelta{{Counter: "S", Recorded: 100, Executor: 150}}, summary.Results[1].CounterUndershoots)
+	assert.Empty(t, summary.Results[0].CounterUndershoots)
+
+	// both batches got different roots from "wrong"
+	assert.Equal(t, []uint64{5, 6}, summary.Disagreements)
+
+	byExecutor := make(map[string]*replayExecutorSummary)
+	for _, e := range summary.Executors {
+		byExecutor[e.Executor] = e
+	}
+	assert.Equal(t, 1, byExecutor["same"].Matches)
+	assert.Equal(t, 1, byExecutor["hungry"].CounterUndershoots)
+	assert.Equal(t, 1, byExecutor["wrong"].Mismatches)
+	assert.Equal(t, 2, byExecutor["broken"].Errors)
+	assert.True(t, summary.Regressions())
+
+	var out bytes.Buffer
+	require.NoError(t, summary.Print(&out))
+	assert.Contains(t, out.String(), "batch 5: hungry used 150 S counters, recorded 100")
+	assert.Contains(t, out.String(), "batch 6: executors returned different state roots")
+}
@@ -0,0 +1,32 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/ledgerwatch/erigon/zk/fake_executor"
+)
+
+// serves ProcessStatelessBatchV2 by re-executing batches with the node's own zkEVM so the sequencer and verifier can
+// run without a real executor, the counters returned are the node's virtual counters
+func main() {
+	address := flag.String("address", ":50071", "address to serve the executor grpc service on")
+	smtReduction := flag.Float64("smt-reduction", 1, "smt depth reduction used when counting, see zkevm.virtual-counters-smt-reduction")
+	flag.Parse()
+
+	server := fake_executor.NewServer(*smtReduction)
+	listening, stop, err := server.Start(*address)
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	fmt.Printf("fake executor listening on %s\n", listening)
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+	<-signals
+	stop()
+}
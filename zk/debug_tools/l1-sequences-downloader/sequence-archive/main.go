@@ -0,0 +1,99 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/ledgerwatch/erigon-lib/common"
+	"github.com/ledgerwatch/erigon/zk/l1_data"
+	"github.com/ledgerwatch/erigon/zk/types"
+)
+
+// packages the output of the sequence-logs, sequence-calldata and sequence-accinputhash tools into a checksummed
+// sequence archive that the node can use for L1 recovery with the zkevm.l1-sync-archive flag
+func main() {
+	sequencesFile := flag.String("sequences", "l1BatchInfos.json", "sequence logs file produced by sequence-logs")
+	calldataFile := flag.String("calldata", "calldataFinal.json", "calldata file produced by sequence-calldata")
+	accInputHashesFile := flag.String("acc-input-hashes", "", "optional acc input hashes file produced by sequence-accinputhash")
+	l1InfoTreeFile := flag.String("l1-info-tree", "", "optional json file with the ordered l1 info tree updates")
+	l1ChainId := flag.Uint64("l1-chain-id", 0, "chain id of the L1 the data was downloaded from")
+	rollupAddress := flag.String("rollup-address", "", "address of the rollup contract the logs were taken from")
+	rollupId := flag.Uint64("rollup-id", 0, "rollup id")
+	out := flag.String("out", "sequence-archive", "output directory")
+	verifyOnly := flag.Bool("verify", false, "only verify the archive in the output directory")
+	flag.Parse()
+
+	if *verifyOnly {
+		archive, err := l1_data.ReadSequenceArchive(*out)
+		if err != nil {
+			panic(err)
+		}
+		if err := archive.Verify(); err != nil {
+			panic(err)
+		}
+		fmt.Printf("archive ok: %d sequences, batches %d-%d\n", len(archive.Sequences), archive.Manifest.FirstBatch, archive.Manifest.LastBatch)
+		return
+	}
+
+	archive := &l1_data.SequenceArchive{
+		Manifest: l1_data.SequenceArchiveManifest{
+			L1ChainId:     *l1ChainId,
+			RollupAddress: common.HexToAddress(*rollupAddress),
+			RollupId:      *rollupId,
+		},
+	}
+
+	if err := readJson(*sequencesFile, &archive.Sequences); err != nil {
+		panic(err)
+	}
+
+	calldata := make(map[string]string)
+	if err := readJson(*calldataFile, &calldata); err != nil {
+		panic(err)
+	}
+	archive.Calldata = make(map[common.Hash][]byte, len(calldata))
+	for txHash, data := range calldata {
+		archive.Calldata[common.HexToHash(txHash)] = common.FromHex(data)
+	}
+
+	if *accInputHashesFile != "" {
+		accInputHashes := make(map[uint64]string)
+		if err := readJson(*accInputHashesFile, &accInputHashes); err != nil {
+			panic(err)
+		}
+		archive.AccInputHashes = make(map[uint64]common.Hash, len(accInputHashes))
+		for batchNo, hash := range accInputHashes {
+			archive.AccInputHashes[batchNo] = common.HexToHash(hash)
+		}
+	}
+
+	if *l1InfoTreeFile != "" {
+		var updates []types.L1InfoTreeUpdate
+		if err := readJson(*l1InfoTreeFile, &updates); err != nil {
+			panic(err)
+		}
+		archive.L1InfoTreeUpdates = updates
+	}
+
+	if err := archive.Verify(); err != nil {
+		panic(err)
+	}
+
+	if err := l1_data.WriteSequenceArchive(*out, archive); err != nil {
+		panic(err)
+	}
+
+	fmt.Printf("wrote archive to %s: %d sequences, batches %d-%d, l1 blocks %d-%d\n",
+		*out, len(archive.Sequences), archive.Manifest.FirstBatch, archive.Manifest.LastBatch, archive.Manifest.FromL1Block, archive.Manifest.ToL1Block)
+}
+
+func readJson(path string, target interface{}) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return json.NewDecoder(f).Decode(target)
+}
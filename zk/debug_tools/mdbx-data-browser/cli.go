@@ -2,15 +2,21 @@ package main
 
 import (
 	"context"
+	"encoding/csv"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"math"
 	"os"
 	"path/filepath"
+	"strconv"
+	"strings"
 	"time"
 
+	libcommon "github.com/ledgerwatch/erigon-lib/common"
 	"github.com/ledgerwatch/erigon-lib/kv"
 	"github.com/ledgerwatch/erigon-lib/kv/mdbx"
+	"github.com/ledgerwatch/log/v3"
 	"github.com/urfave/cli/v2"
 
 	"github.com/ledgerwatch/erigon/cmd/utils"
@@ -34,6 +40,13 @@ var (
 		Value:       false,
 	}
 
+	formatFlag = &cli.StringFlag{
+		Name:        "format",
+		Usage:       "Output format of the table entries and lookups, json or csv",
+		Destination: &outputFormat,
+		Value:       formatJson,
+	}
+
 	// commands
 	getBatchByNumberCmd = &cli.Command{
 		Action: dumpBatchesByNumbers,
@@ -82,11 +95,106 @@ var (
 		},
 	}
 
+	getTableCmd = &cli.Command{
+		Action: dumpTable,
+		Name:   "output-table",
+		Usage:  "Outputs decoded entries of a table, either under a key or in a block, batch or index range",
+		Flags: []cli.Flag{
+			&utils.DataDirFlag,
+			&cli.StringFlag{
+				Name:        "table",
+				Usage:       "Table name",
+				Destination: &tableName,
+				Required:    true,
+			},
+			&cli.StringFlag{
+				Name:        "key",
+				Usage:       "Key of the entry, a number for tables keyed by numbers, a string for tables keyed by names, hex otherwise",
+				Destination: &tableKey,
+			},
+			&cli.Uint64Flag{
+				Name:        "from",
+				Usage:       "Lowest block, batch, L1 block or index number the keys start with",
+				Destination: &rangeFrom,
+			},
+			&cli.Uint64Flag{
+				Name:        "to",
+				Usage:       "Highest block, batch, L1 block or index number the keys start with",
+				Destination: &rangeTo,
+				Value:       math.MaxUint64,
+			},
+			&cli.IntFlag{
+				Name:        "limit",
+				Usage:       "Maximum number of entries, 0 for all of them",
+				Destination: &entriesLimit,
+				Value:       100,
+			},
+			formatFlag,
+			fileOutputFlag,
+		},
+	}
+
+	lookupGerCmd = &cli.Command{
+		Action: dumpGerLookup,
+		Name:   "lookup-ger",
+		Usage:  "Outputs the blocks a global exit root was set in and its L1 info tree update",
+		Flags: []cli.Flag{
+			&utils.DataDirFlag,
+			&cli.StringFlag{
+				Name:        "ger",
+				Usage:       "Global exit root",
+				Destination: &lookupHash,
+				Required:    true,
+			},
+			formatFlag,
+			fileOutputFlag,
+		},
+	}
+
+	lookupTxCmd = &cli.Command{
+		Action: dumpTxLookup,
+		Name:   "lookup-tx",
+		Usage:  "Outputs the block and batch a transaction was included in",
+		Flags: []cli.Flag{
+			&utils.DataDirFlag,
+			&cli.StringFlag{
+				Name:        "tx-hash",
+				Usage:       "Transaction hash",
+				Destination: &lookupHash,
+				Required:    true,
+			},
+			formatFlag,
+			fileOutputFlag,
+		},
+	}
+
+	replCmd = &cli.Command{
+		Action: runReplCmd,
+		Name:   "repl",
+		Usage:  "Starts an interactive read-only shell to query the database",
+		Flags: []cli.Flag{
+			&utils.DataDirFlag,
+			formatFlag,
+		},
+	}
+
 	// parameters
 	chainDataDir        string
 	batchOrBlockNumbers *cli.Uint64Slice = cli.NewUint64Slice()
 	verboseOutput       bool
 	fileOutput          bool
+	outputFormat        string = formatJson
+	tableName           string
+	tableKey            string
+	rangeFrom           uint64
+	rangeTo             uint64 = math.MaxUint64
+	entriesLimit        int    = 100
+	lookupHash          string
+)
+
+const (
+	formatJson = "json"
+	formatCsv  = "csv"
 )
 
 // dumpBatchesByNumbers retrieves batches by given numbers and dumps them either on standard output or to a file
@@ -193,16 +301,212 @@ func dumpBatchAffiliation(cliCtx *cli.Context) error {
 	return nil
 }
 
-// createDbTx creates a read-only database transaction, that allows querying it.
+// dumpTable retrieves the decoded entries of a table and dumps them either on standard output or to a file
+func dumpTable(cliCtx *cli.Context) error {
+	if !cliCtx.IsSet(utils.DataDirFlag.Name) {
+		return errors.New("chain data directory is not provided")
+	}
+
+	chainDataDir = cliCtx.String(utils.DataDirFlag.Name)
+
+	tx, cleanup, err := createDbTx(chainDataDir, cliCtx.Context)
+	if err != nil {
+		return fmt.Errorf("failed to create read-only db transaction: %w", err)
+	}
+	defer cleanup()
+
+	r := NewDbDataRetriever(tx)
+	entries := make([]Entry, 0)
+	if cliCtx.IsSet("key") {
+		entry, err := r.GetEntry(tableName, tableKey)
+		if err != nil {
+			return fmt.Errorf("failed to retrieve the entry %s of the table %s: %w", tableKey, tableName, err)
+		}
+		if entry != nil {
+			entries = append(entries, *entry)
+		}
+	} else {
+		entries, err = r.ScanTable(tableName, rangeFrom, rangeTo, entriesLimit)
+		if err != nil {
+			return fmt.Errorf("failed to scan the table %s: %w", tableName, err)
+		}
+	}
+
+	return formatAndOutputResults(entries)
+}
+
+// dumpGerLookup retrieves where the global exit root was used and dumps it either on standard output or to a file
+func dumpGerLookup(cliCtx *cli.Context) error {
+	if !cliCtx.IsSet(utils.DataDirFlag.Name) {
+		return errors.New("chain data directory is not provided")
+	}
+
+	chainDataDir = cliCtx.String(utils.DataDirFlag.Name)
+
+	tx, cleanup, err := createDbTx(chainDataDir, cliCtx.Context)
+	if err != nil {
+		return fmt.Errorf("failed to create read-only db transaction: %w", err)
+	}
+	defer cleanup()
+
+	lookup, err := NewDbDataRetriever(tx).FindBlocksByGer(libcommon.HexToHash(lookupHash))
+	if err != nil {
+		return fmt.Errorf("failed to look up the global exit root %s: %w", lookupHash, err)
+	}
+
+	return formatAndOutputResults(lookup)
+}
+
+// dumpTxLookup retrieves the block and batch of a transaction and dumps them either on standard output or to a file
+func dumpTxLookup(cliCtx *cli.Context) error {
+	if !cliCtx.IsSet(utils.DataDirFlag.Name) {
+		return errors.New("chain data directory is not provided")
+	}
+
+	chainDataDir = cliCtx.String(utils.DataDirFlag.Name)
+
+	tx, cleanup, err := createDbTx(chainDataDir, cliCtx.Context)
+	if err != nil {
+		return fmt.Errorf("failed to create read-only db transaction: %w", err)
+	}
+	defer cleanup()
+
+	lookup, err := NewDbDataRetriever(tx).FindBatchByTxHash(libcommon.HexToHash(lookupHash))
+	if err != nil {
+		return fmt.Errorf("failed to look up the transaction %s: %w", lookupHash, err)
+	}
+
+	return formatAndOutputResults(lookup)
+}
+
+// runReplCmd starts the interactive shell on the standard input and output
+func runReplCmd(cliCtx *cli.Context) error {
+	if !cliCtx.IsSet(utils.DataDirFlag.Name) {
+		return errors.New("chain data directory is not provided")
+	}
+
+	chainDataDir = cliCtx.String(utils.DataDirFlag.Name)
+
+	tx, cleanup, err := createDbTx(chainDataDir, cliCtx.Context)
+	if err != nil {
+		return fmt.Errorf("failed to create read-only db transaction: %w", err)
+	}
+	defer cleanup()
+
+	return newRepl(NewDbDataRetriever(tx), outputFormat).run(os.Stdin, os.Stdout)
+}
+
+// createDbTx opens the database read-only and creates a read-only database transaction, that allows querying it.
 func createDbTx(chainDataDir string, ctx context.Context) (kv.Tx, func(), error) {
-	db := mdbx.MustOpen(chainDataDir)
+	db, err := mdbx.NewMDBX(log.New()).Path(chainDataDir).Label(kv.ChainDB).Readonly().Open(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
 	dbTx, err := db.BeginRo(ctx)
+	if err != nil {
+		db.Close()
+		return nil, nil, err
+	}
 	cleanupFn := func() {
 		dbTx.Rollback()
 		db.Close()
 	}
 
-	return dbTx, cleanupFn, err
+	return dbTx, cleanupFn, nil
+}
+
+// formatAndOutputResults formats results in the output format and prints them either to the terminal or to the file
+func formatAndOutputResults(results interface{}) error {
+	formatted, err := formatResults(results, outputFormat)
+	if err != nil {
+		return err
+	}
+
+	if err := outputResults(formatted); err != nil {
+		return fmt.Errorf("failed to output results: %w", err)
+	}
+	return nil
+}
+
+// formatResults formats results either as indented JSON or as CSV, which is supported for table entries and lookups
+func formatResults(results interface{}, format string) (string, error) {
+	switch format {
+	case formatJson:
+		jsonResults, err := json.MarshalIndent(results, "", "  ")
+		if err != nil {
+			return "", fmt.Errorf("failed to serialize results into the JSON format: %w", err)
+		}
+		return string(jsonResults), nil
+	case formatCsv:
+		records, err := csvRecords(results)
+		if err != nil {
+			return "", err
+		}
+		var sb strings.Builder
+		w := csv.NewWriter(&sb)
+		if err := w.WriteAll(records); err != nil {
+			return "", fmt.Errorf("failed to serialize results into the CSV format: %w", err)
+		}
+		return strings.TrimSuffix(sb.String(), "\n"), nil
+	default:
+		return "", fmt.Errorf("unknown output format %q, expected %s or %s", format, formatJson, formatCsv)
+	}
+}
+
+// csvRecords flattens results into CSV records with a header, values that aren't plain are JSON encoded
+func csvRecords(results interface{}) ([][]string, error) {
+	switch r := results.(type) {
+	case []Entry:
+		records := [][]string{{"key", "value", "error"}}
+		for _, entry := range r {
+			key, err := csvValue(entry.Key)
+			if err != nil {
+				return nil, err
+			}
+			value, err := csvValue(entry.Value)
+			if err != nil {
+				return nil, err
+			}
+			records = append(records, []string{key, value, entry.Error})
+		}
+		return records, nil
+	case *GerLookup:
+		update, err := csvValue(r.L1InfoTreeUpdate)
+		if err != nil {
+			return nil, err
+		}
+		records := [][]string{{"ger", "known", "block", "l1InfoTreeUpdate"}}
+		if len(r.Blocks) == 0 {
+			records = append(records, []string{r.Ger.Hex(), strconv.FormatBool(r.Known), "", update})
+		}
+		for _, block := range r.Blocks {
+			records = append(records, []string{r.Ger.Hex(), strconv.FormatBool(r.Known), strconv.FormatUint(block, 10), update})
+		}
+		return records, nil
+	case *TxLookup:
+		return [][]string{
+			{"txHash", "block", "batch"},
+			{r.TxHash.Hex(), strconv.FormatUint(r.Block, 10), strconv.FormatUint(r.Batch, 10)},
+		}, nil
+	default:
+		return nil, fmt.Errorf("csv output is not supported for %T, use json", results)
+	}
+}
+
+func csvValue(v interface{}) (string, error) {
+	switch value := v.(type) {
+	case nil:
+		return "", nil
+	case string:
+		return value, nil
+	case fmt.Stringer:
+		return value.String(), nil
+	}
+	jsonValue, err := json.Marshal(v)
+	if err != nil {
+		return "", err
+	}
+	return string(jsonValue), nil
 }
 
 // outputResults prints results either to the terminal or to the file
@@ -210,7 +514,7 @@ func outputResults(results string) error {
 	// output results to the file
 	if fileOutput {
 		formattedTime := time.Now().Format("02-01-2006 15:04:05")
-		fileName := fmt.Sprintf("output_%s.json", formattedTime)
+		fileName := fmt.Sprintf("output_%s.%s", formattedTime, outputFormat)
 
 		file, err := os.Create(fileName)
 		if err != nil {
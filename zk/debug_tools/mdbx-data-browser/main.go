@@ -17,6 +17,10 @@ func main() {
 		getBatchByNumberCmd,
 		getBlockByNumberCmd,
 		getBatchAffiliationCmd,
+		getTableCmd,
+		lookupGerCmd,
+		lookupTxCmd,
+		replCmd,
 	}
 
 	logging.SetupLogger("mdbx data browser")
@@ -0,0 +1,162 @@
+package main
+
+import (
+	"fmt"
+
+	libcommon "github.com/ledgerwatch/erigon-lib/common"
+
+	"github.com/ledgerwatch/erigon/core/rawdb"
+	"github.com/ledgerwatch/erigon/zk/hermez_db"
+	zktypes "github.com/ledgerwatch/erigon/zk/types"
+)
+
+// Entry is a decoded table entry, values that can't be decoded are kept as hex alongside the error
+type Entry struct {
+	Key   interface{} `json:"key"`
+	Value interface{} `json:"value"`
+	Error string      `json:"error,omitempty"`
+}
+
+// GerLookup is where a global exit root was used in the blocks and the l1 info tree
+type GerLookup struct {
+	Ger              libcommon.Hash            `json:"ger"`
+	Known            bool                      `json:"known"`
+	Blocks           []uint64                  `json:"blocks"`
+	L1InfoTreeUpdate *zktypes.L1InfoTreeUpdate `json:"l1InfoTreeUpdate,omitempty"`
+}
+
+// TxLookup is the block and the batch a transaction was included in
+type TxLookup struct {
+	TxHash libcommon.Hash `json:"txHash"`
+	Block  uint64         `json:"block"`
+	Batch  uint64         `json:"batch"`
+}
+
+func newEntry(schema tableSchema, k, v []byte) Entry {
+	entry := Entry{Key: schema.decodeKey(k)}
+	value, err := schema.value(v)
+	if err != nil {
+		value, _ = decodeBytes(v)
+		entry.Error = err.Error()
+	}
+	entry.Value = value
+	return entry
+}
+
+// ScanTable returns up to limit entries of the table with the block, batch or index number their keys start with in
+// [from, to].  Tables with keys not starting with a number are scanned from the start, ignoring the range.
+func (d *DbDataRetriever) ScanTable(table string, from, to uint64, limit int) ([]Entry, error) {
+	if from > to {
+		return nil, fmt.Errorf("from %d is above to %d", from, to)
+	}
+	schema := schemaOf(table)
+
+	c, err := d.tx.Cursor(table)
+	if err != nil {
+		return nil, err
+	}
+	defer c.Close()
+
+	ranged := schema.orderedByNumber()
+	var k, v []byte
+	if ranged {
+		k, v, err = c.Seek(hermez_db.Uint64ToBytes(from))
+	} else {
+		k, v, err = c.First()
+	}
+
+	entries := make([]Entry, 0)
+	for ; k != nil; k, v, err = c.Next() {
+		if err != nil {
+			return nil, err
+		}
+		if limit > 0 && len(entries) >= limit {
+			break
+		}
+		if number, ok := schema.leadingNumber(k); ok {
+			if number > to {
+				if ranged {
+					break
+				}
+				continue
+			}
+			if number < from {
+				continue
+			}
+		}
+		entries = append(entries, newEntry(schema, k, v))
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return entries, nil
+}
+
+// GetEntry returns the entry of the table under the key, nil if there is none
+func (d *DbDataRetriever) GetEntry(table, key string) (*Entry, error) {
+	schema := schemaOf(table)
+	k, err := schema.encodeKey(key)
+	if err != nil {
+		return nil, err
+	}
+
+	v, err := d.tx.GetOne(table, k)
+	if err != nil {
+		return nil, err
+	}
+	if v == nil {
+		return nil, nil
+	}
+
+	entry := newEntry(schema, k, v)
+	return &entry, nil
+}
+
+// FindBlocksByGer returns the blocks the global exit root was set in and the l1 info tree update it came with
+func (d *DbDataRetriever) FindBlocksByGer(ger libcommon.Hash) (*GerLookup, error) {
+	hermezDb := hermez_db.NewHermezDbReader(d.tx)
+
+	known, err := hermezDb.CheckGlobalExitRootWritten(ger)
+	if err != nil {
+		return nil, err
+	}
+
+	update, err := hermezDb.GetL1InfoTreeUpdateByGer(ger)
+	if err != nil {
+		return nil, err
+	}
+
+	lookup := &GerLookup{Ger: ger, Known: known, Blocks: make([]uint64, 0), L1InfoTreeUpdate: update}
+
+	// blocks are keyed by number so every one of them has to be checked
+	err = d.tx.ForEach(hermez_db.BLOCK_GLOBAL_EXIT_ROOTS, nil, func(k, v []byte) error {
+		if libcommon.BytesToHash(v) == ger {
+			lookup.Blocks = append(lookup.Blocks, hermez_db.BytesToUint64(k))
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return lookup, nil
+}
+
+// FindBatchByTxHash returns the block and batch the transaction was included in
+func (d *DbDataRetriever) FindBatchByTxHash(txHash libcommon.Hash) (*TxLookup, error) {
+	blockNum, err := rawdb.ReadTxLookupEntry(d.tx, txHash)
+	if err != nil {
+		return nil, err
+	}
+	if blockNum == nil {
+		return nil, fmt.Errorf("transaction %s is not found", txHash)
+	}
+
+	batchNum, err := d.dbReader.GetBatchNoByL2Block(*blockNum)
+	if err != nil {
+		return nil, err
+	}
+
+	return &TxLookup{TxHash: txHash, Block: *blockNum, Batch: batchNum}, nil
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	libcommon "github.com/ledgerwatch/erigon-lib/common"
+	"github.com/ledgerwatch/erigon-lib/kv/memdb"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ledgerwatch/erigon/common/u256"
+	"github.com/ledgerwatch/erigon/core/rawdb"
+	"github.com/ledgerwatch/erigon/core/types"
+	"github.com/ledgerwatch/erigon/zk/hermez_db"
+	zktypes "github.com/ledgerwatch/erigon/zk/types"
+)
+
+func TestDbDataRetrieverScanTable(t *testing.T) {
+	_, dbTx := memdb.NewTestTx(t)
+	require.NoError(t, hermez_db.CreateHermezBuckets(dbTx))
+	db := hermez_db.NewHermezDb(dbTx)
+
+	for blockNum := uint64(1); blockNum <= 10; blockNum++ {
+		require.NoError(t, db.WriteBlockBatch(blockNum, (blockNum+1)/2))
+	}
+	require.NoError(t, db.WriteSequence(100, 1, libcommon.HexToHash("0x1"), libcommon.HexToHash("0x2"), libcommon.Hash{}))
+	require.NoError(t, db.WriteSequence(200, 2, libcommon.HexToHash("0x3"), libcommon.HexToHash("0x4"), libcommon.HexToHash("0x5")))
+
+	r := NewDbDataRetriever(dbTx)
+
+	entries, err := r.ScanTable(hermez_db.BLOCKBATCHES, 3, 6, 0)
+	require.NoError(t, err)
+	require.Equal(t, []Entry{{Key: uint64(3), Value: uint64(2)}, {Key: uint64(4), Value: uint64(2)}, {Key: uint64(5), Value: uint64(3)}, {Key: uint64(6), Value: uint64(3)}}, entries)
+
+	entries, err = r.ScanTable(hermez_db.BLOCKBATCHES, 3, 6, 2)
+	require.NoError(t, err)
+	require.Len(t, entries, 2)
+
+	// sequences are ranged by l1 block
+	entries, err = r.ScanTable(hermez_db.L1SEQUENCES, 150, 250, 0)
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	require.Equal(t, map[string]uint64{"l1Block": 200, "batch": 2}, entries[0].Key)
+	require.Equal(t, libcommon.HexToHash("0x5"), entries[0].Value.(map[string]libcommon.Hash)["l1InfoRoot"])
+
+	entry, err := r.GetEntry(hermez_db.BLOCKBATCHES, "7")
+	require.NoError(t, err)
+	require.Equal(t, &Entry{Key: uint64(7), Value: uint64(4)}, entry)
+
+	entry, err = r.GetEntry(hermez_db.BLOCKBATCHES, "11")
+	require.NoError(t, err)
+	require.Nil(t, entry)
+
+	// batch transitions are decoded as written by the l1 syncer
+	require.NoError(t, db.WriteBatchTransition(&zktypes.BatchTransition{Status: zktypes.BatchStatusVerified, BatchNo: 2, L1BlockNo: 300, L1TxHash: libcommon.HexToHash("0x6")}))
+	entries, err = r.ScanTable(hermez_db.BATCH_TRANSITIONS, 0, 10, 0)
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	require.Empty(t, entries[0].Error)
+	require.Equal(t, map[string]interface{}{"l1Block": uint64(300), "l1TxHash": libcommon.HexToHash("0x6")}, entries[0].Value)
+
+	// values that can't be decoded are kept as hex
+	require.NoError(t, dbTx.Put(hermez_db.STATE_ROOTS, hermez_db.Uint64ToBytes(1), []byte{1, 2}))
+	entries, err = r.ScanTable(hermez_db.STATE_ROOTS, 0, 10, 0)
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	require.NotEmpty(t, entries[0].Error)
+
+	csvEntries, err := formatResults([]Entry{{Key: uint64(1), Value: []uint64{1, 2}}}, formatCsv)
+	require.NoError(t, err)
+	require.Equal(t, "key,value,error\n1,\"[1,2]\",", csvEntries)
+}
+
+func TestDbDataRetrieverLookups(t *testing.T) {
+	_, dbTx := memdb.NewTestTx(t)
+	require.NoError(t, hermez_db.CreateHermezBuckets(dbTx))
+	db := hermez_db.NewHermezDb(dbTx)
+
+	ger := libcommon.HexToHash("0xabc")
+	require.NoError(t, db.WriteGlobalExitRoot(ger))
+	require.NoError(t, db.WriteL1InfoTreeUpdateToGer(&zktypes.L1InfoTreeUpdate{Index: 3, GER: ger, BlockNumber: 50}))
+	require.NoError(t, db.WriteBlockGlobalExitRoot(2, ger))
+	require.NoError(t, db.WriteBlockGlobalExitRoot(4, libcommon.HexToHash("0xdef")))
+	require.NoError(t, db.WriteBlockGlobalExitRoot(5, ger))
+
+	tx := types.NewTransaction(1, libcommon.HexToAddress("0x1000"), u256.Num1, 1, u256.Num1, nil)
+	block := createBlock(t, 5, types.Transactions{tx})
+	rawdb.WriteTxLookupEntries(dbTx, block)
+	require.NoError(t, db.WriteBlockBatch(5, 2))
+
+	r := NewDbDataRetriever(dbTx)
+
+	gerLookup, err := r.FindBlocksByGer(ger)
+	require.NoError(t, err)
+	require.True(t, gerLookup.Known)
+	require.Equal(t, []uint64{2, 5}, gerLookup.Blocks)
+	require.Equal(t, uint64(3), gerLookup.L1InfoTreeUpdate.Index)
+
+	txLookup, err := r.FindBatchByTxHash(tx.Hash())
+	require.NoError(t, err)
+	require.Equal(t, &TxLookup{TxHash: tx.Hash(), Block: 5, Batch: 2}, txLookup)
+
+	_, err = r.FindBatchByTxHash(libcommon.HexToHash("0x1"))
+	require.Error(t, err)
+
+	// the shell keeps going after a failing command
+	var out bytes.Buffer
+	in := strings.NewReader("format csv\ntx " + tx.Hash().Hex() + "\nscan unknown_command_args x\nger\nexit\n")
+	require.NoError(t, newRepl(r, formatJson).run(in, &out))
+	require.Contains(t, out.String(), tx.Hash().Hex()+",5,2")
+	require.Contains(t, out.String(), "error: invalid from")
+	require.Contains(t, out.String(), "error: usage: ger <global exit root>")
+}
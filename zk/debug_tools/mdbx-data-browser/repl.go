@@ -0,0 +1,163 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+
+	libcommon "github.com/ledgerwatch/erigon-lib/common"
+)
+
+const replHelp = `commands:
+  tables                               lists the tables, the zk ones with the number their keys start with
+  get <table> <key>                    outputs the entry of the table under the key
+  scan <table> [from] [to] [limit]     outputs the entries of the table with keys starting with a number in [from, to]
+  ger <global exit root>               outputs the blocks the global exit root was set in
+  tx <tx hash>                         outputs the block and batch the transaction was included in
+  batch <number>                       outputs the batch
+  block <number>                       outputs the block
+  format json|csv                      sets the output format
+  help                                 prints this help
+  exit | quit                          leaves the shell`
+
+// repl is a read-only interactive shell over a database transaction
+type repl struct {
+	r      *DbDataRetriever
+	format string
+}
+
+func newRepl(r *DbDataRetriever, format string) *repl {
+	return &repl{r: r, format: format}
+}
+
+// run reads commands line by line until the input ends or the shell is left, a failing command doesn't end it
+func (s *repl) run(in io.Reader, out io.Writer) error {
+	scanner := bufio.NewScanner(in)
+	fmt.Fprintln(out, `mdbx data browser, type "help" for the commands`)
+	for {
+		fmt.Fprint(out, "> ")
+		if !scanner.Scan() {
+			fmt.Fprintln(out)
+			return scanner.Err()
+		}
+
+		args := strings.Fields(scanner.Text())
+		if len(args) == 0 {
+			continue
+		}
+		if args[0] == "exit" || args[0] == "quit" {
+			return nil
+		}
+
+		output, err := s.execute(args[0], args[1:])
+		if err != nil {
+			fmt.Fprintf(out, "error: %v\n", err)
+			continue
+		}
+		fmt.Fprintln(out, output)
+	}
+}
+
+func (s *repl) execute(cmd string, args []string) (string, error) {
+	switch cmd {
+	case "help":
+		return replHelp, nil
+	case "tables":
+		var sb strings.Builder
+		for _, table := range knownTables() {
+			sb.WriteString(table)
+			if number := schemaOf(table).number; number != "" {
+				sb.WriteString(" (" + number + ")")
+			}
+			sb.WriteString("\n")
+		}
+		return strings.TrimSuffix(sb.String(), "\n"), nil
+	case "format":
+		if len(args) != 1 || (args[0] != formatJson && args[0] != formatCsv) {
+			return "", fmt.Errorf("usage: format json|csv")
+		}
+		s.format = args[0]
+		return "output format is " + s.format, nil
+	case "get":
+		if len(args) != 2 {
+			return "", fmt.Errorf("usage: get <table> <key>")
+		}
+		entry, err := s.r.GetEntry(args[0], args[1])
+		if err != nil {
+			return "", err
+		}
+		entries := make([]Entry, 0, 1)
+		if entry != nil {
+			entries = append(entries, *entry)
+		}
+		return formatResults(entries, s.format)
+	case "scan":
+		if len(args) < 1 || len(args) > 4 {
+			return "", fmt.Errorf("usage: scan <table> [from] [to] [limit]")
+		}
+		from, to, limit := uint64(0), uint64(math.MaxUint64), 100
+		var err error
+		if len(args) > 1 {
+			if from, err = strconv.ParseUint(args[1], 10, 64); err != nil {
+				return "", fmt.Errorf("invalid from: %w", err)
+			}
+		}
+		if len(args) > 2 {
+			if to, err = strconv.ParseUint(args[2], 10, 64); err != nil {
+				return "", fmt.Errorf("invalid to: %w", err)
+			}
+		}
+		if len(args) > 3 {
+			if limit, err = strconv.Atoi(args[3]); err != nil {
+				return "", fmt.Errorf("invalid limit: %w", err)
+			}
+		}
+		entries, err := s.r.ScanTable(args[0], from, to, limit)
+		if err != nil {
+			return "", err
+		}
+		return formatResults(entries, s.format)
+	case "ger":
+		if len(args) != 1 {
+			return "", fmt.Errorf("usage: ger <global exit root>")
+		}
+		lookup, err := s.r.FindBlocksByGer(libcommon.HexToHash(args[0]))
+		if err != nil {
+			return "", err
+		}
+		return formatResults(lookup, s.format)
+	case "tx":
+		if len(args) != 1 {
+			return "", fmt.Errorf("usage: tx <tx hash>")
+		}
+		lookup, err := s.r.FindBatchByTxHash(libcommon.HexToHash(args[0]))
+		if err != nil {
+			return "", err
+		}
+		return formatResults(lookup, s.format)
+	case "batch", "block":
+		if len(args) != 1 {
+			return "", fmt.Errorf("usage: %s <number>", cmd)
+		}
+		number, err := strconv.ParseUint(args[0], 10, 64)
+		if err != nil {
+			return "", fmt.Errorf("invalid number: %w", err)
+		}
+		var result interface{}
+		if cmd == "batch" {
+			result, err = s.r.GetBatchByNumber(number, false)
+		} else {
+			result, err = s.r.GetBlockByNumber(number, false, false)
+		}
+		if err != nil {
+			return "", err
+		}
+		// batches and blocks are only shown as json
+		return formatResults(result, formatJson)
+	default:
+		return "", fmt.Errorf("unknown command %q, type \"help\" for the commands", cmd)
+	}
+}
@@ -0,0 +1,293 @@
+package main
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	libcommon "github.com/ledgerwatch/erigon-lib/common"
+	"github.com/ledgerwatch/erigon-lib/common/hexutility"
+	"github.com/ledgerwatch/erigon-lib/common/length"
+	"github.com/ledgerwatch/erigon-lib/kv"
+
+	smtdb "github.com/ledgerwatch/erigon/smt/pkg/db"
+	dstypes "github.com/ledgerwatch/erigon/zk/datastream/types"
+	"github.com/ledgerwatch/erigon/zk/hermez_db"
+	zktypes "github.com/ledgerwatch/erigon/zk/types"
+)
+
+// keyKind is the layout of the keys of a table
+type keyKind int
+
+const (
+	keyBytes        keyKind = iota // anything else, shown as hex
+	keyNumber                      // block, batch or index number
+	keyHash                        // 32 bytes hash
+	keyString                      // text
+	keyL1BlockBatch                // l1 block number | batch number
+	keyBlockTxHash                 // block number | tx hash
+	keyStatusBatch                 // batch status | batch number
+)
+
+// tableSchema describes how to decode the entries of a table
+type tableSchema struct {
+	key keyKind
+	// number is what the leading number of the keys is, empty if the keys don't start with one
+	number string
+	value  func(v []byte) (interface{}, error)
+}
+
+// tableSchemas are the zk tables from hermez_db and the smt tables, the rest of the chaindata tables are shown as hex
+var tableSchemas = map[string]tableSchema{
+	hermez_db.L1VERIFICATIONS:                   {key: keyL1BlockBatch, number: "l1 block", value: decodeL1BatchInfo},
+	hermez_db.L1SEQUENCES:                       {key: keyL1BlockBatch, number: "l1 block", value: decodeL1BatchInfo},
+	hermez_db.FORKIDS:                           {key: keyNumber, number: "batch", value: decodeNumber},
+	hermez_db.FORKID_BLOCK:                      {key: keyNumber, number: "fork id", value: decodeNumber},
+	hermez_db.BLOCKBATCHES:                      {key: keyNumber, number: "block", value: decodeNumber},
+	hermez_db.GLOBAL_EXIT_ROOTS:                 {key: keyHash, value: decodeFlag},
+	hermez_db.BLOCK_GLOBAL_EXIT_ROOTS:           {key: keyNumber, number: "block", value: decodeHash},
+	hermez_db.GLOBAL_EXIT_ROOTS_BATCHES:         {key: keyNumber, number: "batch", value: decodeGerUpdate},
+	hermez_db.TX_PRICE_PERCENTAGE:               {key: keyHash, value: decodeNumber},
+	hermez_db.STATE_ROOTS:                       {key: keyNumber, number: "block", value: decodeHash},
+	hermez_db.L1_INFO_TREE_UPDATES:              {key: keyNumber, number: "index", value: decodeL1InfoTreeUpdate},
+	hermez_db.L1_INFO_TREE_UPDATES_BY_GER:       {key: keyHash, value: decodeL1InfoTreeUpdate},
+	hermez_db.BLOCK_L1_INFO_TREE_INDEX:          {key: keyNumber, number: "block", value: decodeNumber},
+	hermez_db.BLOCK_L1_INFO_TREE_INDEX_PROGRESS: {key: keyNumber, number: "block", value: decodeNumber},
+	hermez_db.L1_INJECTED_BATCHES:               {key: keyNumber, number: "index", value: decodeL1InjectedBatch},
+	hermez_db.BLOCK_INFO_ROOTS:                  {key: keyNumber, number: "block", value: decodeHash},
+	hermez_db.BLOCK_L1_BLOCK_HASHES:             {key: keyNumber, number: "block", value: decodeHash},
+	hermez_db.INTERMEDIATE_TX_STATEROOTS:        {key: keyBlockTxHash, number: "block", value: decodeHash},
+	hermez_db.BATCH_WITNESSES:                   {key: keyNumber, number: "batch", value: decodeBytes},
+	hermez_db.BATCH_COUNTERS:                    {key: keyNumber, number: "block", value: decodeJson},
+	hermez_db.L1_BATCH_DATA:                     {key: keyNumber, number: "batch", value: decodeL1BatchData},
+	hermez_db.REUSED_L1_INFO_TREE_INDEX:         {key: keyNumber, number: "block", value: decodeFlag},
+	hermez_db.LATEST_USED_GER:                   {key: keyNumber, number: "block", value: decodeHash},
+	hermez_db.BATCH_BLOCKS:                      {key: keyNumber, number: "batch", value: decodeNumbers},
+	hermez_db.SMT_DEPTHS:                        {key: keyNumber, number: "block", value: decodeNumber},
+	hermez_db.L1_INFO_LEAVES:                    {key: keyNumber, number: "index", value: decodeHash},
+	hermez_db.L1_INFO_ROOTS:                     {key: keyHash, value: decodeNumber},
+	hermez_db.INVALID_BATCHES:                   {key: keyNumber, number: "batch", value: decodeFlag},
+	hermez_db.ROllUP_TYPES_FORKS:                {key: keyNumber, number: "rollup type", value: decodeNumber},
+	hermez_db.FORK_HISTORY:                      {key: keyNumber, number: "index", value: decodeForkHistory},
+	hermez_db.JUST_UNWOUND:                      {key: keyNumber, number: "batch", value: decodeFlag},
+	hermez_db.PLAIN_STATE_VERSION:               {key: keyNumber, number: "batch", value: decodeBytes},
+	hermez_db.ERIGON_VERSIONS:                   {key: keyString, value: decodeNumber},
+	hermez_db.BATCH_ENDS:                        {key: keyNumber, number: "block", value: decodeFlag},
+	hermez_db.EXECUTOR_DIVERGENCES:              {key: keyNumber, number: "batch", value: decodeJson},
+	hermez_db.BATCH_TRANSITIONS:                 {key: keyStatusBatch, value: decodeBatchTransition},
+	hermez_db.PRUNE_PROGRESS:                    {key: keyString, value: decodeNumber},
+	hermez_db.SHADOW_FORK_SOURCE_BLOCKS:         {key: keyNumber, number: "block", value: decodeNumber},
+	smtdb.TableSmt:                              {key: keyString, value: decodeString},
+	smtdb.TableStats:                            {key: keyString, value: decodeString},
+	smtdb.TableAccountValues:                    {key: keyString, value: decodeString},
+	smtdb.TableMetadata:                         {key: keyBytes, value: decodeBytes},
+	smtdb.TableHashKey:                          {key: keyBytes, value: decodeBytes},
+}
+
+// schemaOf returns the schema of the table, tables without one are shown as hex
+func schemaOf(table string) tableSchema {
+	if schema, ok := tableSchemas[table]; ok {
+		return schema
+	}
+	return tableSchema{key: keyBytes, value: decodeBytes}
+}
+
+// knownTables returns the zk tables followed by the other chaindata tables
+func knownTables() []string {
+	zkTables := make([]string, 0, len(tableSchemas))
+	for table := range tableSchemas {
+		zkTables = append(zkTables, table)
+	}
+	sort.Strings(zkTables)
+
+	tables := zkTables
+	for _, table := range kv.ChaindataTables {
+		if _, ok := tableSchemas[table]; !ok {
+			tables = append(tables, table)
+		}
+	}
+	return tables
+}
+
+// leadingNumber is the block, batch or index number a key starts with
+func (s tableSchema) leadingNumber(k []byte) (uint64, bool) {
+	switch s.key {
+	case keyNumber, keyL1BlockBatch, keyBlockTxHash:
+		if len(k) >= 8 {
+			return hermez_db.BytesToUint64(k[:8]), true
+		}
+	case keyStatusBatch:
+		if len(k) == 9 {
+			return hermez_db.BytesToUint64(k[1:]), true
+		}
+	}
+	return 0, false
+}
+
+// orderedByNumber is whether the keys are sorted by the number they start with, so a range can be seeked to
+func (s tableSchema) orderedByNumber() bool {
+	return s.key == keyNumber || s.key == keyL1BlockBatch || s.key == keyBlockTxHash
+}
+
+// decodeKey returns a printable form of the key
+func (s tableSchema) decodeKey(k []byte) interface{} {
+	switch s.key {
+	case keyNumber:
+		if len(k) == 8 {
+			return hermez_db.BytesToUint64(k)
+		}
+	case keyHash:
+		if len(k) == length.Hash {
+			return libcommon.BytesToHash(k)
+		}
+	case keyString:
+		if utf8.Valid(k) {
+			return string(k)
+		}
+	case keyL1BlockBatch:
+		if l1BlockNo, batchNo, err := hermez_db.SplitKey(k); err == nil {
+			return map[string]uint64{"l1Block": l1BlockNo, "batch": batchNo}
+		}
+	case keyBlockTxHash:
+		if len(k) == 8+length.Hash {
+			return map[string]interface{}{"block": hermez_db.BytesToUint64(k[:8]), "txHash": libcommon.BytesToHash(k[8:])}
+		}
+	case keyStatusBatch:
+		if len(k) == 9 {
+			return map[string]interface{}{"status": zktypes.BatchStatus(k[0]).String(), "batch": hermez_db.BytesToUint64(k[1:])}
+		}
+	}
+	return hexutility.Bytes(k)
+}
+
+// encodeKey parses a key typed in by the user, numbers for numbered keys, hex for hashes and bytes, text otherwise
+func (s tableSchema) encodeKey(key string) ([]byte, error) {
+	switch s.key {
+	case keyNumber:
+		n, err := strconv.ParseUint(key, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("key must be a number: %w", err)
+		}
+		return hermez_db.Uint64ToBytes(n), nil
+	case keyString:
+		return []byte(key), nil
+	case keyL1BlockBatch, keyBlockTxHash, keyStatusBatch:
+		// composite keys are given whole as hex
+		if !strings.HasPrefix(key, "0x") {
+			return nil, fmt.Errorf("composite keys must be given as hex")
+		}
+	}
+	return hex.DecodeString(strings.TrimPrefix(key, "0x"))
+}
+
+func decodeNumber(v []byte) (interface{}, error) {
+	switch len(v) {
+	case 1:
+		return uint64(v[0]), nil
+	case 8:
+		return hermez_db.BytesToUint64(v), nil
+	}
+	return nil, fmt.Errorf("unexpected number length %d", len(v))
+}
+
+func decodeNumbers(v []byte) (interface{}, error) {
+	if len(v)%8 != 0 {
+		return nil, fmt.Errorf("unexpected numbers length %d", len(v))
+	}
+	numbers := make([]uint64, 0, len(v)/8)
+	for i := 0; i < len(v); i += 8 {
+		numbers = append(numbers, hermez_db.BytesToUint64(v[i:i+8]))
+	}
+	return numbers, nil
+}
+
+func decodeFlag(v []byte) (interface{}, error) {
+	return len(v) > 0 && v[0] != 0, nil
+}
+
+func decodeHash(v []byte) (interface{}, error) {
+	if len(v) != length.Hash {
+		return nil, fmt.Errorf("unexpected hash length %d", len(v))
+	}
+	return libcommon.BytesToHash(v), nil
+}
+
+func decodeBytes(v []byte) (interface{}, error) {
+	return hexutility.Bytes(v), nil
+}
+
+func decodeString(v []byte) (interface{}, error) {
+	return string(v), nil
+}
+
+func decodeJson(v []byte) (interface{}, error) {
+	return json.RawMessage(v), nil
+}
+
+func decodeL1BatchInfo(v []byte) (interface{}, error) {
+	if len(v) != 64 && len(v) != 96 {
+		return nil, fmt.Errorf("unexpected l1 batch info length %d", len(v))
+	}
+	info := map[string]libcommon.Hash{
+		"l1TxHash":  libcommon.BytesToHash(v[:32]),
+		"stateRoot": libcommon.BytesToHash(v[32:64]),
+	}
+	if len(v) == 96 {
+		info["l1InfoRoot"] = libcommon.BytesToHash(v[64:])
+	}
+	return info, nil
+}
+
+func decodeGerUpdate(v []byte) (interface{}, error) {
+	return dstypes.DecodeGerUpdate(v)
+}
+
+func decodeL1InfoTreeUpdate(v []byte) (interface{}, error) {
+	if len(v) < 144 {
+		return nil, fmt.Errorf("unexpected l1 info tree update length %d", len(v))
+	}
+	update := &zktypes.L1InfoTreeUpdate{}
+	update.Unmarshall(v)
+	return update, nil
+}
+
+func decodeL1InjectedBatch(v []byte) (interface{}, error) {
+	batch := &zktypes.L1InjectedBatch{}
+	if err := batch.Unmarshall(v); err != nil {
+		return nil, err
+	}
+	return batch, nil
+}
+
+func decodeL1BatchData(v []byte) (interface{}, error) {
+	if len(v) < length.Addr+length.Hash+8 {
+		return nil, fmt.Errorf("unexpected l1 batch data length %d", len(v))
+	}
+	return map[string]interface{}{
+		"coinbase":       libcommon.BytesToAddress(v[:length.Addr]),
+		"l1InfoRoot":     libcommon.BytesToHash(v[length.Addr : length.Addr+length.Hash]),
+		"limitTimestamp": hermez_db.BytesToUint64(v[length.Addr+length.Hash : length.Addr+length.Hash+8]),
+		"batchL2Data":    hexutility.Bytes(v[length.Addr+length.Hash+8:]),
+	}, nil
+}
+
+func decodeForkHistory(v []byte) (interface{}, error) {
+	if len(v) != 16 {
+		return nil, fmt.Errorf("unexpected fork history length %d", len(v))
+	}
+	return map[string]uint64{"forkId": hermez_db.BytesToUint64(v[:8]), "lastVerifiedBatch": hermez_db.BytesToUint64(v[8:])}, nil
+}
+
+func decodeBatchTransition(v []byte) (interface{}, error) {
+	if len(v) != 40 {
+		return nil, fmt.Errorf("unexpected batch transition length %d", len(v))
+	}
+	return map[string]interface{}{
+		"l1Block":  hermez_db.BytesToUint64(v[:8]),
+		"l1TxHash": libcommon.BytesToHash(v[8:40]),
+	}, nil
+}
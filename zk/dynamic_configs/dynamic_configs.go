@@ -0,0 +1,338 @@
+package dynamic_configs
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/holiman/uint256"
+	"github.com/ledgerwatch/erigon-lib/chain"
+	"github.com/ledgerwatch/erigon-lib/common"
+	"github.com/ledgerwatch/erigon-lib/kv"
+	"github.com/ledgerwatch/erigon-lib/kv/kvcfg"
+	"github.com/ledgerwatch/erigon-lib/kv/memdb"
+	"github.com/ledgerwatch/log/v3"
+
+	"github.com/ledgerwatch/erigon/core/rawdb"
+	"github.com/ledgerwatch/erigon/core/state"
+	"github.com/ledgerwatch/erigon/core/types"
+	"github.com/ledgerwatch/erigon/core/types/accounts"
+	"github.com/ledgerwatch/erigon/smt/pkg/db"
+	"github.com/ledgerwatch/erigon/smt/pkg/smt"
+	"github.com/ledgerwatch/erigon/smt/pkg/utils"
+	"github.com/ledgerwatch/erigon/zk/hermez_db"
+	"github.com/ledgerwatch/erigon/zk/stages"
+	"github.com/ledgerwatch/erigon/zk/syncer"
+)
+
+const logPrefix = "dynamic_configs"
+
+// Conf is the dynamic-<chain>-conf.json of a dynamic chain, the genesis header fields that aren't in the chainspec
+type Conf struct {
+	Root       string `json:"root"`
+	Timestamp  uint64 `json:"timestamp"`
+	GasLimit   uint64 `json:"gasLimit"`
+	Difficulty int64  `json:"difficulty"`
+}
+
+// Configs are the files a dynamic chain is started from
+type Configs struct {
+	Allocs    types.GenesisAlloc
+	ChainSpec *chain.Config
+	Conf      Conf
+	// ForkId is the fork the genesis state was produced by, the chain should be sequenced from it on with
+	// zkevm.sequencer-initial-fork-id
+	ForkId uint64
+}
+
+// L1 is the rollup manager the creation of a rollup is read from
+type L1 interface {
+	GetRollupCreation(ctx context.Context, addr *common.Address, rollupId, l1Block uint64) (*syncer.RollupCreation, error)
+	CallRollupType(ctx context.Context, addr *common.Address, rollupType uint64) (*syncer.RollupType, error)
+}
+
+// ChainSpec copies the chain config of an existing chain for a dynamic chain: the fork blocks are cleared as the new
+// chain starts from its genesis in a single fork, and the chain id is replaced unless it is 0
+func ChainSpec(base *chain.Config, chainName string, chainId uint64) (*chain.Config, error) {
+	if !strings.HasPrefix(chainName, "dynamic") {
+		return nil, fmt.Errorf("chain name %s must start with dynamic for the node to load it from the config files", chainName)
+	}
+
+	b, err := json.Marshal(base)
+	if err != nil {
+		return nil, err
+	}
+	spec := &chain.Config{}
+	if err := json.Unmarshal(b, spec); err != nil {
+		return nil, err
+	}
+
+	spec.ChainName = chainName
+	if chainId != 0 {
+		spec.ChainID = new(big.Int).SetUint64(chainId)
+	}
+	spec.ForkID4Block = nil
+	spec.ForkID5DragonfruitBlock = nil
+	spec.ForkID6IncaBerryBlock = nil
+	spec.ForkID7EtrogBlock = nil
+	spec.ForkID88ElderberryBlock = nil
+	spec.ForkID9Elderberry2Block = nil
+	spec.ForkID10 = nil
+	spec.ForkID11 = nil
+	spec.ForkID12BananaBlock = nil
+
+	return spec, nil
+}
+
+// FromState generates the configs of a chain starting from the state of the node at the end of a block.  The allocs
+// are read from the plain state and its history, and their SMT root is verified against the state root of the block.
+func FromState(ctx context.Context, tx kv.Tx, tmpDir string, blockNo uint64, spec *chain.Config) (*Configs, error) {
+	historyV3, err := kvcfg.HistoryV3.Enabled(tx)
+	if err != nil {
+		return nil, err
+	}
+	if historyV3 {
+		return nil, errors.New("reading the state of a block isn't supported with history v3")
+	}
+
+	header := rawdb.ReadHeaderByNumber(tx, blockNo)
+	if header == nil {
+		return nil, fmt.Errorf("block %d not found", blockNo)
+	}
+
+	forkId, err := hermez_db.NewHermezDbReader(tx).GetForkIdByBlockNum(blockNo)
+	if err != nil {
+		return nil, err
+	}
+
+	allocs, err := readAllocs(ctx, tx, blockNo)
+	if err != nil {
+		return nil, err
+	}
+
+	root, err := AllocsRoot(ctx, tmpDir, allocs)
+	if err != nil {
+		return nil, err
+	}
+	if root != header.Root {
+		return nil, fmt.Errorf("the SMT root %s of the state doesn't match the state root %s of block %d", root, header.Root, blockNo)
+	}
+
+	return &Configs{
+		Allocs:    allocs,
+		ChainSpec: spec,
+		Conf: Conf{
+			Root:      root.Hex(),
+			Timestamp: header.Time,
+			GasLimit:  header.GasLimit,
+		},
+		ForkId: forkId,
+	}, nil
+}
+
+// readAllocs reads every account with its code and storage as of the end of the block
+func readAllocs(ctx context.Context, tx kv.Tx, blockNo uint64) (types.GenesisAlloc, error) {
+	psr := state.NewPlainStateReader(tx)
+	allocs := make(types.GenesisAlloc)
+
+	err := state.WalkAsOfAccounts(tx, common.Address{}, blockNo+1, func(k, v []byte) (bool, error) {
+		if err := ctx.Err(); err != nil {
+			return false, err
+		}
+		if len(k) > 32 {
+			return true, nil
+		}
+		var acc accounts.Account
+		if err := acc.DecodeForStorage(v); err != nil {
+			return false, err
+		}
+		addr := common.BytesToAddress(k)
+
+		code, err := psr.ReadAccountCode(addr, acc.Incarnation, acc.CodeHash)
+		if err != nil {
+			return false, err
+		}
+
+		storage := make(map[common.Hash]common.Hash)
+		if err := state.WalkAsOfStorage(tx, addr, acc.Incarnation, common.Hash{}, blockNo+1, func(_, loc, vs []byte) (bool, error) {
+			if len(vs) > 0 {
+				storage[common.BytesToHash(loc)] = common.BytesToHash(vs)
+			}
+			return true, nil
+		}); err != nil {
+			return false, err
+		}
+
+		allocs[addr] = types.GenesisAccount{
+			Code:    code,
+			Storage: storage,
+			Balance: acc.Balance.ToBig(),
+			Nonce:   acc.Nonce,
+		}
+		return true, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	log.Info(fmt.Sprintf("[%s] Read the state", logPrefix), "block", blockNo, "accounts", len(allocs))
+	return allocs, nil
+}
+
+// FromL1 generates the configs of a rollup created on the L1 with the rollup manager.  The allocs of the genesis aren't
+// on the L1 so they have to be given, their SMT root is verified against the genesis of the rollup type.  The chain id of
+// the spec is set to the one the rollup was created with.
+func FromL1(ctx context.Context, l1 L1, rollupManager common.Address, rollupId, l1Block uint64, tmpDir string, allocs types.GenesisAlloc, spec *chain.Config) (*Configs, error) {
+	creation, err := l1.GetRollupCreation(ctx, &rollupManager, rollupId, l1Block)
+	if err != nil {
+		return nil, err
+	}
+	rollupType, err := l1.CallRollupType(ctx, &rollupManager, creation.RollupTypeId)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get rollup type %d: %w", creation.RollupTypeId, err)
+	}
+
+	root, err := AllocsRoot(ctx, tmpDir, allocs)
+	if err != nil {
+		return nil, err
+	}
+	if root != rollupType.Genesis {
+		return nil, fmt.Errorf("the SMT root %s of the allocs doesn't match the genesis %s of rollup type %d", root, rollupType.Genesis, creation.RollupTypeId)
+	}
+
+	spec.ChainID = new(big.Int).SetUint64(creation.ChainId)
+
+	return &Configs{
+		Allocs:    allocs,
+		ChainSpec: spec,
+		Conf: Conf{
+			Root:      root.Hex(),
+			Timestamp: creation.Timestamp,
+		},
+		ForkId: rollupType.ForkId,
+	}, nil
+}
+
+// AllocsRoot builds the SMT of the allocs in a temporary database and returns its root
+func AllocsRoot(ctx context.Context, tmpDir string, allocs types.GenesisAlloc) (common.Hash, error) {
+	tmpDb := memdb.New(tmpDir)
+	defer tmpDb.Close()
+	tx, err := tmpDb.BeginRw(ctx)
+	if err != nil {
+		return common.Hash{}, err
+	}
+	defer tx.Rollback()
+
+	if err := db.CreateEriDbBuckets(tx); err != nil {
+		return common.Hash{}, err
+	}
+	eridb := db.NewEriDb(tx)
+
+	keys := []utils.NodeKey{}
+	for addr, a := range allocs {
+		balance, overflow := uint256.FromBig(a.Balance)
+		if overflow {
+			return common.Hash{}, fmt.Errorf("balance of %s overflows", addr)
+		}
+		acc := &accounts.Account{Nonce: a.Nonce, Balance: *balance}
+
+		storage := make(map[string]string, len(a.Storage))
+		for k, v := range a.Storage {
+			storage[k.String()] = v.String()
+		}
+
+		if keys, err = stages.InsertAccountToKV(eridb, keys, addr, acc, a.Code, storage); err != nil {
+			return common.Hash{}, err
+		}
+	}
+
+	tree := smt.NewSMT(eridb, false)
+	if _, err := tree.GenerateFromKVBulk(ctx, logPrefix, keys); err != nil {
+		return common.Hash{}, err
+	}
+	return common.BigToHash(tree.LastRoot()), nil
+}
+
+// polygonGenesis is the genesis file of the contracts deployment, with the allocs and the root of the rollup type
+type polygonGenesis struct {
+	Root    string `json:"root"`
+	Genesis []struct {
+		Balance  string            `json:"balance"`
+		Nonce    string            `json:"nonce"`
+		Address  string            `json:"address"`
+		Bytecode string            `json:"bytecode,omitempty"`
+		Storage  map[string]string `json:"storage,omitempty"`
+	} `json:"genesis"`
+}
+
+// ReadAllocs reads allocs in the format of the allocs config file, or from the genesis file of the contracts deployment
+func ReadAllocs(filename string) (types.GenesisAlloc, error) {
+	b, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	var genesis polygonGenesis
+	if err := json.Unmarshal(b, &genesis); err != nil || genesis.Genesis == nil {
+		allocs := make(types.GenesisAlloc)
+		if err := json.Unmarshal(b, &allocs); err != nil {
+			return nil, fmt.Errorf("could not parse allocs %s: %w", filename, err)
+		}
+		return allocs, nil
+	}
+
+	allocs := make(types.GenesisAlloc, len(genesis.Genesis))
+	for _, a := range genesis.Genesis {
+		balance := new(big.Int)
+		if a.Balance != "" {
+			if _, ok := balance.SetString(a.Balance, 0); !ok {
+				return nil, fmt.Errorf("invalid balance %q of %s", a.Balance, a.Address)
+			}
+		}
+		var nonce uint64
+		if a.Nonce != "" {
+			if nonce, err = strconv.ParseUint(a.Nonce, 0, 64); err != nil {
+				return nil, fmt.Errorf("invalid nonce %q of %s: %w", a.Nonce, a.Address, err)
+			}
+		}
+		storage := make(map[common.Hash]common.Hash, len(a.Storage))
+		for k, v := range a.Storage {
+			storage[common.HexToHash(k)] = common.HexToHash(v)
+		}
+		allocs[common.HexToAddress(a.Address)] = types.GenesisAccount{
+			Code:    common.FromHex(a.Bytecode),
+			Storage: storage,
+			Balance: balance,
+			Nonce:   nonce,
+		}
+	}
+	return allocs, nil
+}
+
+// Write writes the allocs, chainspec and conf files of the chain to the dir, next to the node config file that uses them
+func (c *Configs) Write(dir string) error {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	files := map[string]interface{}{
+		"allocs":    c.Allocs,
+		"chainspec": c.ChainSpec,
+		"conf":      c.Conf,
+	}
+	for suffix, v := range files {
+		b, err := json.MarshalIndent(v, "", "  ")
+		if err != nil {
+			return err
+		}
+		if err := os.WriteFile(filepath.Join(dir, fmt.Sprintf("%s-%s.json", c.ChainSpec.ChainName, suffix)), b, 0644); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,195 @@
+package dynamic_configs
+
+import (
+	"context"
+	"encoding/hex"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/holiman/uint256"
+	"github.com/ledgerwatch/erigon-lib/chain"
+	"github.com/ledgerwatch/erigon-lib/common"
+	"github.com/ledgerwatch/erigon-lib/kv"
+	"github.com/ledgerwatch/erigon-lib/kv/dbutils"
+	"github.com/ledgerwatch/erigon-lib/kv/memdb"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ledgerwatch/erigon/core"
+	"github.com/ledgerwatch/erigon/core/rawdb"
+	"github.com/ledgerwatch/erigon/core/types"
+	"github.com/ledgerwatch/erigon/core/types/accounts"
+	"github.com/ledgerwatch/erigon/crypto"
+	"github.com/ledgerwatch/erigon/params"
+	"github.com/ledgerwatch/erigon/smt/pkg/smt"
+	"github.com/ledgerwatch/erigon/zk/hermez_db"
+	"github.com/ledgerwatch/erigon/zk/syncer"
+)
+
+var (
+	alice    = common.HexToAddress("0xa")
+	contract = common.HexToAddress("0xc")
+)
+
+func testAllocs() types.GenesisAlloc {
+	return types.GenesisAlloc{
+		alice: {Balance: big.NewInt(1000), Nonce: 3},
+		contract: {
+			Balance: big.NewInt(0),
+			Nonce:   1,
+			Code:    common.FromHex("0x6001600055"),
+			Storage: map[common.Hash]common.Hash{{1}: {2}, common.HexToHash("0x5"): common.HexToHash("0x10")},
+		},
+	}
+}
+
+// expectedRoot inserts the allocs one by one the same as the genesis of a chain is written
+func expectedRoot(t *testing.T, allocs types.GenesisAlloc) common.Hash {
+	tree := smt.NewSMT(nil, false)
+	for addr, a := range allocs {
+		_, err := tree.SetAccountState(addr.String(), a.Balance, new(big.Int).SetUint64(a.Nonce))
+		require.NoError(t, err)
+		if len(a.Code) > 0 {
+			require.NoError(t, tree.SetContractBytecode(addr.String(), hex.EncodeToString(a.Code)))
+		}
+		storage := make(map[string]string)
+		for k, v := range a.Storage {
+			storage[k.String()] = v.String()
+		}
+		if len(storage) > 0 {
+			_, err = tree.SetContractStorage(addr.String(), storage, nil)
+			require.NoError(t, err)
+		}
+	}
+	return common.BigToHash(tree.LastRoot())
+}
+
+// writeState writes the allocs to the plain state as the state at the end of block 1 of fork 9
+func writeState(t *testing.T, tx kv.RwTx, allocs types.GenesisAlloc, root common.Hash) {
+	for addr, a := range allocs {
+		balance, _ := uint256.FromBig(a.Balance)
+		acc := accounts.Account{Nonce: a.Nonce, Balance: *balance, Incarnation: 1, CodeHash: crypto.Keccak256Hash(a.Code)}
+		if len(a.Code) == 0 {
+			acc.CodeHash = common.Hash(crypto.Keccak256Hash(nil))
+		} else {
+			require.NoError(t, tx.Put(kv.Code, acc.CodeHash[:], a.Code))
+		}
+		v := make([]byte, acc.EncodingLengthForStorage())
+		acc.EncodeForStorage(v)
+		require.NoError(t, tx.Put(kv.PlainState, addr[:], v))
+		for k, sv := range a.Storage {
+			require.NoError(t, tx.Put(kv.PlainState, dbutils.PlainGenerateCompositeStorageKey(addr[:], acc.Incarnation, k[:]), new(uint256.Int).SetBytes(sv[:]).Bytes()))
+		}
+	}
+
+	header := &types.Header{Number: big.NewInt(1), Root: root, Time: 1700000000, GasLimit: 1125899906842624}
+	rawdb.WriteHeader(tx, header)
+	require.NoError(t, rawdb.WriteCanonicalHash(tx, header.Hash(), 1))
+
+	require.NoError(t, hermez_db.CreateHermezBuckets(tx))
+	hermezDb := hermez_db.NewHermezDb(tx)
+	require.NoError(t, hermezDb.WriteBlockBatch(1, 1))
+	require.NoError(t, hermezDb.WriteForkId(1, 9))
+}
+
+func testSpec(t *testing.T) *chain.Config {
+	spec, err := ChainSpec(params.HermezMainnetChainConfig, "dynamic-test", 0)
+	require.NoError(t, err)
+	return spec
+}
+
+func TestChainSpec(t *testing.T) {
+	base := &chain.Config{ChainName: "hermez-mainnet", ChainID: big.NewInt(1101), LondonBlock: big.NewInt(10), ForkID7EtrogBlock: big.NewInt(5)}
+
+	spec, err := ChainSpec(base, "dynamic-mainnet-shadowfork", 2440)
+	require.NoError(t, err)
+	require.Equal(t, "dynamic-mainnet-shadowfork", spec.ChainName)
+	require.Equal(t, uint64(2440), spec.ChainID.Uint64())
+	require.Nil(t, spec.ForkID7EtrogBlock)
+	require.Equal(t, base.LondonBlock, spec.LondonBlock)
+	require.Equal(t, big.NewInt(5), base.ForkID7EtrogBlock)
+
+	_, err = ChainSpec(base, "mainnet-shadowfork", 0)
+	require.Error(t, err)
+}
+
+func TestFromState(t *testing.T) {
+	ctx := context.Background()
+	allocs := testAllocs()
+	root := expectedRoot(t, allocs)
+
+	_, tx := memdb.NewTestTx(t)
+	writeState(t, tx, allocs, root)
+
+	configs, err := FromState(ctx, tx, t.TempDir(), 1, testSpec(t))
+	require.NoError(t, err)
+	require.Equal(t, uint64(9), configs.ForkId)
+	require.Equal(t, Conf{Root: root.Hex(), Timestamp: 1700000000, GasLimit: 1125899906842624}, configs.Conf)
+	require.Equal(t, allocs[contract].Storage, configs.Allocs[contract].Storage)
+	require.Equal(t, allocs[contract].Code, configs.Allocs[contract].Code)
+	require.Equal(t, uint64(3), configs.Allocs[alice].Nonce)
+
+	_, tx = memdb.NewTestTx(t)
+	writeState(t, tx, allocs, common.Hash{1})
+	_, err = FromState(ctx, tx, t.TempDir(), 1, testSpec(t))
+	require.ErrorContains(t, err, "doesn't match the state root")
+}
+
+type simulatedL1 struct {
+	genesis common.Hash
+}
+
+func (l *simulatedL1) GetRollupCreation(_ context.Context, _ *common.Address, rollupId, l1Block uint64) (*syncer.RollupCreation, error) {
+	return &syncer.RollupCreation{RollupTypeId: 2, ChainId: 2442, L1Block: l1Block, Timestamp: 1710000000}, nil
+}
+
+func (l *simulatedL1) CallRollupType(_ context.Context, _ *common.Address, rollupType uint64) (*syncer.RollupType, error) {
+	return &syncer.RollupType{ForkId: 9, Genesis: l.genesis}, nil
+}
+
+func TestFromL1(t *testing.T) {
+	ctx := context.Background()
+	allocs := testAllocs()
+	root := expectedRoot(t, allocs)
+
+	configs, err := FromL1(ctx, &simulatedL1{genesis: root}, common.HexToAddress("0x1"), 1, 100, t.TempDir(), allocs, testSpec(t))
+	require.NoError(t, err)
+	require.Equal(t, uint64(2442), configs.ChainSpec.ChainID.Uint64())
+	require.Equal(t, uint64(9), configs.ForkId)
+	require.Equal(t, Conf{Root: root.Hex(), Timestamp: 1710000000}, configs.Conf)
+
+	_, err = FromL1(ctx, &simulatedL1{genesis: common.Hash{1}}, common.HexToAddress("0x1"), 1, 100, t.TempDir(), allocs, testSpec(t))
+	require.ErrorContains(t, err, "doesn't match the genesis")
+}
+
+func TestReadAllocs(t *testing.T) {
+	dir := t.TempDir()
+	filename := filepath.Join(dir, "genesis.json")
+	require.NoError(t, os.WriteFile(filename, []byte(`{
+  "root": "0x0",
+  "genesis": [
+    {"accountName": "alice", "balance": "1000", "nonce": "3", "address": "0x000000000000000000000000000000000000000a"},
+    {"contractName": "contract", "balance": "0", "nonce": "1", "address": "0x000000000000000000000000000000000000000c",
+     "bytecode": "0x6001600055", "storage": {"0x0100000000000000000000000000000000000000000000000000000000000000":
+       "0x0200000000000000000000000000000000000000000000000000000000000000", "0x05": "0x10"}}
+  ]
+}`), 0644))
+
+	allocs, err := ReadAllocs(filename)
+	require.NoError(t, err)
+	require.Equal(t, expectedRoot(t, testAllocs()), expectedRoot(t, allocs))
+
+	// the written files load as a dynamic chain
+	configs := &Configs{Allocs: allocs, ChainSpec: testSpec(t), Conf: Conf{Root: "0x1", Timestamp: 5}}
+	require.NoError(t, configs.Write(dir))
+	params.DynamicChainConfigPath = dir
+	genesis := core.DynamicGenesisBlock("dynamic-test")
+	require.Equal(t, uint64(5), genesis.Timestamp)
+	require.Equal(t, params.HermezMainnetChainConfig.ChainID, genesis.Config.ChainID)
+	require.Len(t, genesis.Alloc, 2)
+
+	allocs, err = ReadAllocs(filepath.Join(dir, "dynamic-test-allocs.json"))
+	require.NoError(t, err)
+	require.Equal(t, expectedRoot(t, testAllocs()), expectedRoot(t, allocs))
+}
@@ -0,0 +1,277 @@
+package events
+
+import (
+	"context"
+	"sync"
+
+	"github.com/ledgerwatch/erigon-lib/common"
+	"github.com/ledgerwatch/erigon-lib/kv"
+	"github.com/ledgerwatch/erigon/zk/hermez_db"
+	"github.com/ledgerwatch/erigon/zk/types"
+)
+
+// maxEventsPerKind caps the events of one kind in a single publish, when catching up only the latest are sent
+const maxEventsPerKind = 1000
+
+// BatchEvent is a batch getting its first block (opened) or being sealed (closed)
+type BatchEvent struct {
+	BatchNumber uint64
+	Closed      bool
+}
+
+// ForkIdEvent is the chain moving to a new fork id from the given batch and block
+type ForkIdEvent struct {
+	ForkId      uint64
+	BatchNumber uint64
+	BlockNumber uint64
+}
+
+// Events is everything that changed between two publishes of the feed, each kind in ascending order
+type Events struct {
+	Batches           []BatchEvent
+	Transitions       []*types.BatchTransition
+	L1InfoTreeUpdates []*types.L1InfoTreeUpdate
+	ForkIds           []ForkIdEvent
+}
+
+func (e *Events) empty() bool {
+	return len(e.Batches) == 0 && len(e.Transitions) == 0 && len(e.L1InfoTreeUpdates) == 0 && len(e.ForkIds) == 0
+}
+
+// ClosedBatchReader knows the highest sealed batch, the data stream is the source of truth for it
+type ClosedBatchReader interface {
+	GetHighestClosedBatchNoCache() (uint64, error)
+}
+
+// progress is what the feed compares between publishes to work out the events
+type progress struct {
+	batchNo         uint64
+	closedBatchNo   uint64
+	forkId          uint64
+	l1InfoTreeIndex uint64
+	hasL1InfoTree   bool
+	transitions     map[types.BatchStatus]uint64
+}
+
+// Feed turns the zk progress committed by the stages into events for its subscribers.  Rather than the stages
+// emitting events as they write, which would leak events of rolled back transactions, the feed is published after
+// every commit and diffs the committed state against the previous publish.
+type Feed struct {
+	db            kv.RoDB
+	closedBatches ClosedBatchReader
+
+	lock          sync.Mutex
+	id            int
+	subscriptions map[int]chan *Events
+	last          *progress
+}
+
+// NewFeed creates a feed reading from db, without a closed batch reader a batch is closed when the next one opens
+func NewFeed(db kv.RoDB, closedBatches ClosedBatchReader) *Feed {
+	return &Feed{
+		db:            db,
+		closedBatches: closedBatches,
+		subscriptions: map[int]chan *Events{},
+	}
+}
+
+// Subscribe returns a channel receiving the events of every publish from now on and a func to unsubscribe
+func (f *Feed) Subscribe(ctx context.Context) (<-chan *Events, func(), error) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	// the first subscriber sets the baseline, otherwise the changes of the next commit would only become the baseline
+	if f.last == nil {
+		if err := f.db.View(ctx, func(tx kv.Tx) (err error) {
+			f.last, err = f.readProgress(hermez_db.NewHermezDbReader(tx))
+			return err
+		}); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	ch := make(chan *Events, 8)
+	f.id++
+	id := f.id
+	f.subscriptions[id] = ch
+	return ch, func() {
+		f.lock.Lock()
+		defer f.lock.Unlock()
+		if _, ok := f.subscriptions[id]; ok {
+			delete(f.subscriptions, id)
+			close(ch)
+		}
+	}, nil
+}
+
+// Publish sends the events committed since the previous publish to the subscribers.  It is a no-op on a nil feed
+// so callers don't need to know whether events are enabled.
+func (f *Feed) Publish(ctx context.Context) error {
+	if f == nil {
+		return nil
+	}
+
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	// without subscribers there is nobody to diff for, start again from whatever is there when one arrives
+	if len(f.subscriptions) == 0 {
+		f.last = nil
+		return nil
+	}
+
+	var events *Events
+	if err := f.db.View(ctx, func(tx kv.Tx) error {
+		hermezDb := hermez_db.NewHermezDbReader(tx)
+		current, err := f.readProgress(hermezDb)
+		if err != nil {
+			return err
+		}
+		if f.last != nil {
+			if events, err = f.diff(hermezDb, f.last, current); err != nil {
+				return err
+			}
+		}
+		f.last = current
+		return nil
+	}); err != nil {
+		return err
+	}
+
+	if events == nil || events.empty() {
+		return nil
+	}
+	for _, ch := range f.subscriptions {
+		common.PrioritizedSend(ch, events)
+	}
+	return nil
+}
+
+var feedStatuses = []types.BatchStatus{types.BatchStatusVirtual, types.BatchStatusVerified, types.BatchStatusFinalized}
+
+func (f *Feed) readProgress(hermezDb *hermez_db.HermezDbReader) (*progress, error) {
+	batchNo, err := hermezDb.GetLatestDownloadedBatchNo()
+	if err != nil {
+		return nil, err
+	}
+	forkId, err := hermezDb.GetForkId(batchNo)
+	if err != nil {
+		return nil, err
+	}
+
+	closedBatchNo := uint64(0)
+	if batchNo > 0 {
+		closedBatchNo = batchNo - 1
+	}
+	if f.closedBatches != nil {
+		if closedBatchNo, err = f.closedBatches.GetHighestClosedBatchNoCache(); err != nil {
+			return nil, err
+		}
+	}
+
+	p := &progress{
+		batchNo:       batchNo,
+		closedBatchNo: closedBatchNo,
+		forkId:        forkId,
+		transitions:   map[types.BatchStatus]uint64{},
+	}
+
+	update, found, err := hermezDb.GetLatestL1InfoTreeUpdate()
+	if err != nil {
+		return nil, err
+	}
+	if found {
+		p.l1InfoTreeIndex = update.Index
+		p.hasL1InfoTree = true
+	}
+
+	for _, status := range feedStatuses {
+		transition, err := hermezDb.GetLatestBatchTransition(status)
+		if err != nil {
+			return nil, err
+		}
+		if transition != nil {
+			p.transitions[status] = transition.BatchNo
+		}
+	}
+
+	return p, nil
+}
+
+// diff works out the events between two progress readings, anything that went backwards was unwound and only
+// becomes an event again once it is written anew
+func (f *Feed) diff(hermezDb *hermez_db.HermezDbReader, last, current *progress) (*Events, error) {
+	events := &Events{}
+
+	openFrom := latestFrom(last.batchNo+1, current.batchNo)
+	closeFrom := latestFrom(last.closedBatchNo+1, current.closedBatchNo)
+	for batchNo := min(openFrom, closeFrom); batchNo <= max(current.batchNo, current.closedBatchNo); batchNo++ {
+		if batchNo >= openFrom && batchNo <= current.batchNo {
+			events.Batches = append(events.Batches, BatchEvent{BatchNumber: batchNo})
+		}
+		if batchNo >= closeFrom && batchNo <= current.closedBatchNo {
+			events.Batches = append(events.Batches, BatchEvent{BatchNumber: batchNo, Closed: true})
+		}
+	}
+
+	for _, status := range feedStatuses {
+		lastBatchNo, seen := last.transitions[status]
+		latest, ok := current.transitions[status]
+		if !ok || seen && latest <= lastBatchNo {
+			continue
+		}
+		from := uint64(0)
+		if seen {
+			from = lastBatchNo + 1
+		}
+		transitions, err := hermezDb.GetBatchTransitionsFrom(status, from, 0)
+		if err != nil {
+			return nil, err
+		}
+		if len(transitions) > maxEventsPerKind {
+			transitions = transitions[len(transitions)-maxEventsPerKind:]
+		}
+		events.Transitions = append(events.Transitions, transitions...)
+	}
+
+	if current.hasL1InfoTree && (!last.hasL1InfoTree || current.l1InfoTreeIndex > last.l1InfoTreeIndex) {
+		from := uint64(0)
+		if last.hasL1InfoTree {
+			from = last.l1InfoTreeIndex + 1
+		}
+		for index := latestFrom(from, current.l1InfoTreeIndex); index <= current.l1InfoTreeIndex; index++ {
+			update, err := hermezDb.GetL1InfoTreeUpdate(index)
+			if err != nil {
+				return nil, err
+			}
+			if update != nil {
+				events.L1InfoTreeUpdates = append(events.L1InfoTreeUpdates, update)
+			}
+		}
+	}
+
+	if current.forkId > last.forkId {
+		event := ForkIdEvent{ForkId: current.forkId, BatchNumber: current.batchNo}
+		blockNo, found, err := hermezDb.GetForkIdBlock(current.forkId)
+		if err != nil {
+			return nil, err
+		}
+		if found {
+			event.BlockNumber = blockNo
+			if event.BatchNumber, err = hermezDb.GetBatchNoByL2Block(blockNo); err != nil {
+				return nil, err
+			}
+		}
+		events.ForkIds = append(events.ForkIds, event)
+	}
+
+	return events, nil
+}
+
+// latestFrom moves the start of the range [from, to] up so it holds no more than maxEventsPerKind numbers
+func latestFrom(from, to uint64) uint64 {
+	if to >= maxEventsPerKind && from < to-maxEventsPerKind+1 {
+		return to - maxEventsPerKind + 1
+	}
+	return from
+}
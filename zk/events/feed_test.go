@@ -0,0 +1,114 @@
+package events
+
+import (
+	"context"
+	"testing"
+
+	"github.com/ledgerwatch/erigon-lib/common"
+	"github.com/ledgerwatch/erigon-lib/kv"
+	"github.com/ledgerwatch/erigon-lib/kv/memdb"
+	"github.com/ledgerwatch/erigon/zk/hermez_db"
+	"github.com/ledgerwatch/erigon/zk/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type testClosedBatches uint64
+
+func (c *testClosedBatches) GetHighestClosedBatchNoCache() (uint64, error) {
+	return uint64(*c), nil
+}
+
+func newTestDb(t *testing.T) kv.RwDB {
+	db := memdb.NewTestDB(t)
+	require.NoError(t, db.Update(context.Background(), func(tx kv.RwTx) error {
+		return hermez_db.CreateHermezBuckets(tx)
+	}))
+	return db
+}
+
+func writeBlock(t *testing.T, db kv.RwDB, blockNo, batchNo, forkId uint64) {
+	require.NoError(t, db.Update(context.Background(), func(tx kv.RwTx) error {
+		hermezDb := hermez_db.NewHermezDb(tx)
+		if err := hermezDb.WriteForkId(batchNo, forkId); err != nil {
+			return err
+		}
+		if err := hermezDb.WriteForkIdBlockOnce(forkId, blockNo); err != nil {
+			return err
+		}
+		return hermezDb.WriteBlockBatch(blockNo, batchNo)
+	}))
+}
+
+func receive(t *testing.T, ch <-chan *Events) *Events {
+	select {
+	case events := <-ch:
+		return events
+	default:
+		t.Fatal("expected events")
+		return nil
+	}
+}
+
+func TestFeed(t *testing.T) {
+	ctx := context.Background()
+	db := newTestDb(t)
+	writeBlock(t, db, 1, 1, 8)
+
+	feed := NewFeed(db, nil)
+	// nothing to diff against without subscribers
+	require.NoError(t, feed.Publish(ctx))
+
+	ch, unsubscribe, err := feed.Subscribe(ctx)
+	require.NoError(t, err)
+
+	writeBlock(t, db, 2, 2, 9)
+	require.NoError(t, db.Update(ctx, func(tx kv.RwTx) error {
+		hermezDb := hermez_db.NewHermezDb(tx)
+		if err := hermezDb.WriteL1InfoTreeUpdate(&types.L1InfoTreeUpdate{Index: 0, GER: common.Hash{1}}); err != nil {
+			return err
+		}
+		if err := hermezDb.WriteL1InfoTreeUpdate(&types.L1InfoTreeUpdate{Index: 1, GER: common.Hash{2}}); err != nil {
+			return err
+		}
+		return hermezDb.WriteBatchTransition(&types.BatchTransition{Status: types.BatchStatusVirtual, BatchNo: 1, L1BlockNo: 100})
+	}))
+	require.NoError(t, feed.Publish(ctx))
+
+	events := receive(t, ch)
+	assert.Equal(t, []BatchEvent{{BatchNumber: 1, Closed: true}, {BatchNumber: 2}}, events.Batches)
+	assert.Equal(t, []ForkIdEvent{{ForkId: 9, BatchNumber: 2, BlockNumber: 2}}, events.ForkIds)
+	require.Len(t, events.L1InfoTreeUpdates, 2)
+	assert.Equal(t, common.Hash{2}, events.L1InfoTreeUpdates[1].GER)
+	require.Len(t, events.Transitions, 1)
+	assert.Equal(t, uint64(100), events.Transitions[0].L1BlockNo)
+
+	// nothing committed, nothing sent
+	require.NoError(t, feed.Publish(ctx))
+	assert.Empty(t, ch)
+
+	unsubscribe()
+	_, open := <-ch
+	assert.False(t, open)
+}
+
+func TestFeedClosedBatches(t *testing.T) {
+	ctx := context.Background()
+	db := newTestDb(t)
+	writeBlock(t, db, 1, 1, 9)
+
+	closed := testClosedBatches(0)
+	feed := NewFeed(db, &closed)
+	ch, unsubscribe, err := feed.Subscribe(ctx)
+	require.NoError(t, err)
+	defer unsubscribe()
+
+	// the batch is only closed once the reader says so, not when the next one opens
+	writeBlock(t, db, 2, 2, 9)
+	require.NoError(t, feed.Publish(ctx))
+	assert.Equal(t, []BatchEvent{{BatchNumber: 2}}, receive(t, ch).Batches)
+
+	closed = 2
+	require.NoError(t, feed.Publish(ctx))
+	assert.Equal(t, []BatchEvent{{BatchNumber: 1, Closed: true}, {BatchNumber: 2, Closed: true}}, receive(t, ch).Batches)
+}
@@ -0,0 +1,353 @@
+package fake_executor
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math/big"
+
+	"github.com/holiman/uint256"
+	"github.com/ledgerwatch/erigon-lib/chain"
+	"github.com/ledgerwatch/erigon-lib/common"
+	"github.com/ledgerwatch/erigon/core"
+	"github.com/ledgerwatch/erigon/core/state"
+	"github.com/ledgerwatch/erigon/core/types"
+	"github.com/ledgerwatch/erigon/core/vm"
+	"github.com/ledgerwatch/erigon/core/vm/evmtypes"
+	"github.com/ledgerwatch/erigon/params"
+	"github.com/ledgerwatch/erigon/smt/pkg/blockinfo"
+	"github.com/ledgerwatch/erigon/smt/pkg/smt"
+	"github.com/ledgerwatch/erigon/turbo/trie"
+	"github.com/ledgerwatch/erigon/zk/datastream/client"
+	dstypes "github.com/ledgerwatch/erigon/zk/datastream/types"
+	zktx "github.com/ledgerwatch/erigon/zk/tx"
+	"github.com/ledgerwatch/erigon/zk/utils"
+)
+
+// the gas available to a single transaction, the same as the sequencer uses
+const transactionGasLimit = 30_000_000
+
+var (
+	ErrInvalidWitness    = errors.New("invalid witness")
+	ErrInvalidDataStream = errors.New("invalid data stream")
+	ErrUnsupportedForkId = errors.New("unsupported fork id")
+)
+
+// BatchResult is the outcome of re-executing a batch
+type BatchResult struct {
+	BatchNumber  uint64
+	ForkId       uint64
+	OldStateRoot common.Hash
+	NewStateRoot common.Hash
+	GasUsed      uint64
+	Counters     vm.Counters
+	// Overflow is set when the batch used more counters than the fork allows, the prover would reject it
+	Overflow bool
+	Blocks   []BlockResult
+	// Accounts are the values after the batch of every account the batch read or wrote
+	Accounts map[common.Address]*AccountResult
+}
+
+// BlockResult is the outcome of a block of the batch
+type BlockResult struct {
+	Number        uint64
+	Timestamp     uint64
+	Coinbase      common.Address
+	GasLimit      uint64
+	GasUsed       uint64
+	Ger           common.Hash
+	L1BlockHash   common.Hash
+	BlockInfoRoot common.Hash
+	Txs           []TxResult
+}
+
+// TxResult is the outcome of a transaction of a block
+type TxResult struct {
+	Hash                common.Hash
+	Type                uint8
+	Status              uint64
+	GasUsed             uint64
+	CumulativeGasUsed   uint64
+	EffectivePercentage uint8
+	ContractAddress     common.Address
+}
+
+// AccountResult is an account after the batch, only the storage slots the batch read or wrote are included
+type AccountResult struct {
+	Nonce   uint64
+	Balance uint256.Int
+	Code    []byte
+	Storage map[common.Hash]uint256.Int
+}
+
+// ExecuteBatch re-executes the batch in the data stream on top of the state in the witness.  Only batches from fork
+// 7 (etrog) onwards are supported.
+func ExecuteBatch(ctx context.Context, witness, dataStream []byte, smtReduction float64) (*BatchResult, error) {
+	w, err := trie.NewWitnessFromReader(bytes.NewReader(witness), false)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidWitness, err)
+	}
+	tree, err := smt.BuildSMTFromWitness(w)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidWitness, err)
+	}
+	witnessState, err := newWitnessState(w)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidWitness, err)
+	}
+
+	start, blocks, err := readBatch(dataStream)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidDataStream, err)
+	}
+	if start.ForkId < uint64(chain.ForkID7Etrog) {
+		return nil, fmt.Errorf("%w: %d", ErrUnsupportedForkId, start.ForkId)
+	}
+
+	chainConfig, err := chainConfigForFork(start.ChainId, start.ForkId)
+	if err != nil {
+		return nil, err
+	}
+
+	e := &batchExecution{
+		ctx:          ctx,
+		chainConfig:  chainConfig,
+		forkId:       start.ForkId,
+		tree:         tree,
+		state:        witnessState,
+		root:         common.BigToHash(tree.LastRoot()),
+		smtReduction: smtReduction,
+		counters:     vm.NewBatchCounterCollector(tree.GetDepth(), uint16(start.ForkId), smtReduction, false, nil),
+	}
+	result := &BatchResult{
+		BatchNumber:  start.Number,
+		ForkId:       start.ForkId,
+		OldStateRoot: e.root,
+	}
+
+	var l1InfoTreeIndex uint32
+	for _, block := range blocks {
+		if err = ctx.Err(); err != nil {
+			return nil, err
+		}
+		blockResult, err := e.executeBlock(block)
+		if err != nil {
+			return nil, fmt.Errorf("block %d: %w", block.L2BlockNumber, err)
+		}
+		result.Blocks = append(result.Blocks, blockResult)
+		l1InfoTreeIndex = block.L1InfoTreeIndex
+	}
+
+	if result.Counters, err = e.counters.CombineCollectors(l1InfoTreeIndex != 0); err != nil {
+		return nil, err
+	}
+	for _, c := range result.Counters {
+		if c.Remaining() < 0 {
+			result.Overflow = true
+		}
+	}
+	result.NewStateRoot = e.root
+	result.GasUsed = e.gasUsed
+	result.Accounts = witnessState.touchedAccounts()
+
+	return result, nil
+}
+
+type batchExecution struct {
+	ctx          context.Context
+	chainConfig  *chain.Config
+	forkId       uint64
+	tree         *smt.SMT
+	state        *witnessState
+	root         common.Hash
+	smtReduction float64
+	counters     *vm.BatchCounterCollector
+	gasUsed      uint64
+}
+
+// executeBlock runs a block the way the sequencer builds it and moves the root on
+func (e *batchExecution) executeBlock(block *dstypes.FullL2Block) (BlockResult, error) {
+	blockNumber := block.L2BlockNumber
+
+	gasLimit := utils.GetBlockGasLimitForFork(e.forkId)
+	if e.chainConfig.IsForkID8Elderberry(blockNumber) && block.BlockGasLimit != 0 {
+		gasLimit = block.BlockGasLimit
+	}
+	header := &types.Header{
+		Number:     new(big.Int).SetUint64(blockNumber),
+		Time:       uint64(block.Timestamp),
+		Coinbase:   block.Coinbase,
+		GasLimit:   gasLimit,
+		Difficulty: new(big.Int),
+	}
+
+	result := BlockResult{
+		Number:      blockNumber,
+		Timestamp:   header.Time,
+		Coinbase:    header.Coinbase,
+		GasLimit:    header.GasLimit,
+		Ger:         block.GlobalExitRoot,
+		L1BlockHash: block.L1BlockHash,
+		Txs:         make([]TxResult, 0, len(block.L2Txs)),
+	}
+
+	if _, err := e.counters.StartNewBlock(block.L1InfoTreeIndex != 0); err != nil {
+		return BlockResult{}, err
+	}
+
+	ibs := state.New(e.state)
+	ibs.PreExecuteStateSet(e.chainConfig, blockNumber, header.Time, &e.root)
+
+	// the ger is only written when the l1 info tree index is set and the contract doesn't know it yet
+	if block.L1InfoTreeIndex > 0 && ibs.ReadGerManagerL1BlockHash(block.GlobalExitRoot) == (common.Hash{}) {
+		ibs.WriteGerManagerL1BlockHash(block.GlobalExitRoot, block.L1BlockHash)
+	}
+
+	blockContext := core.NewEVMBlockContext(header, func(uint64) common.Hash { return common.Hash{} }, nil, &block.Coinbase)
+	noop := state.NewNoopWriter()
+	txInfos := make([]blockinfo.ExecutedTxInfo, 0, len(block.L2Txs))
+	for i, l2Tx := range block.L2Txs {
+		tx, effectiveGasPrice, err := zktx.DecodeTx(l2Tx.Encoded, l2Tx.EffectiveGasPricePercentage, e.forkId)
+		if err != nil {
+			return BlockResult{}, fmt.Errorf("%w: tx %d: %v", ErrInvalidDataStream, i, err)
+		}
+
+		txCounters := vm.NewTransactionCounter(tx, e.tree.GetDepth(), uint16(e.forkId), e.smtReduction, false)
+		if _, err = e.counters.AddNewTransactionCounters(txCounters); err != nil {
+			return BlockResult{}, err
+		}
+
+		ibs.Init(tx.Hash(), common.Hash{}, i)
+		evm := vm.NewZkEVM(blockContext, evmtypes.TxContext{}, ibs, e.chainConfig, vm.NewZkConfig(vm.Config{}, txCounters.ExecutionCounters()))
+		gasPool := new(core.GasPool).AddGas(transactionGasLimit)
+
+		receipt, execResult, err := core.ApplyTransaction_zkevm(e.chainConfig, nil, evm, gasPool, ibs, noop, header, tx, &header.GasUsed, effectiveGasPrice, false)
+		if err != nil {
+			return BlockResult{}, fmt.Errorf("tx %d: %w", i, err)
+		}
+		if err = txCounters.ProcessTx(ibs, execResult.ReturnData); err != nil {
+			return BlockResult{}, err
+		}
+		e.counters.UpdateExecutionAndProcessingCountersCache(txCounters)
+
+		if err = ibs.FinalizeTx(evm.ChainRules(), noop); err != nil {
+			return BlockResult{}, err
+		}
+
+		sender, ok := tx.GetSender()
+		if !ok {
+			signer := types.MakeSigner(e.chainConfig, blockNumber, header.Time)
+			if sender, err = tx.Sender(*signer); err != nil {
+				return BlockResult{}, err
+			}
+		}
+		txInfos = append(txInfos, blockinfo.ExecutedTxInfo{
+			Tx:                tx,
+			EffectiveGasPrice: effectiveGasPrice,
+			Receipt:           core.CreateReceiptForBlockInfoTree(receipt, e.chainConfig, blockNumber, execResult),
+			Signer:            &sender,
+		})
+		result.Txs = append(result.Txs, TxResult{
+			Hash:                tx.Hash(),
+			Type:                tx.Type(),
+			Status:              receipt.Status,
+			GasUsed:             receipt.GasUsed,
+			CumulativeGasUsed:   receipt.CumulativeGasUsed,
+			EffectivePercentage: effectiveGasPrice,
+			ContractAddress:     receipt.ContractAddress,
+		})
+	}
+
+	blockInfoRoot, err := blockinfo.BuildBlockInfoTree(&header.Coinbase, blockNumber, header.Time, header.GasLimit, header.GasUsed, block.GlobalExitRoot, block.L1BlockHash, e.root, &txInfos)
+	if err != nil {
+		return BlockResult{}, err
+	}
+	ibs.PostExecuteStateSet(e.chainConfig, blockNumber, blockInfoRoot)
+
+	// there is no consensus engine to finalise with, the executor only knows about the state changes
+	if err = ibs.CommitBlock(e.chainConfig.Rules(blockNumber, header.Time), e.state); err != nil {
+		return BlockResult{}, err
+	}
+
+	if e.root, err = e.state.flush(e.ctx, e.tree); err != nil {
+		return BlockResult{}, err
+	}
+	e.gasUsed += header.GasUsed
+	result.GasUsed = header.GasUsed
+	result.BlockInfoRoot = *blockInfoRoot
+
+	return result, nil
+}
+
+// readBatch decodes the data stream entries the verifier sends for a single batch
+func readBatch(dataStream []byte) (start *dstypes.BatchStart, blocks []*dstypes.FullL2Block, err error) {
+	// the stream client expects well formed streams and panics on one that ends in the middle of a block
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("malformed stream: %v", r)
+		}
+	}()
+
+	iterator := &streamBytesIterator{data: dataStream}
+	for {
+		entry, err := client.ReadParsedProto(iterator)
+		if err != nil {
+			return nil, nil, err
+		}
+		if entry == nil {
+			break
+		}
+
+		switch entry := entry.(type) {
+		case *dstypes.BatchStart:
+			if start != nil {
+				return nil, nil, fmt.Errorf("more than one batch in the stream")
+			}
+			start = entry
+		case *dstypes.FullL2Block:
+			blocks = append(blocks, entry)
+		}
+	}
+
+	if start == nil {
+		return nil, nil, fmt.Errorf("no batch start in the stream")
+	}
+	return start, blocks, nil
+}
+
+// streamBytesIterator reads the file entries the verifier marshals one after the other
+type streamBytesIterator struct {
+	data []byte
+}
+
+func (it *streamBytesIterator) NextFileEntry() (*dstypes.FileEntry, error) {
+	if len(it.data) == 0 {
+		return nil, nil
+	}
+	if len(it.data) < int(dstypes.FileEntryMinSize) {
+		return nil, fmt.Errorf("truncated entry of %d bytes", len(it.data))
+	}
+
+	length := binary.BigEndian.Uint32(it.data[1:5])
+	if length < dstypes.FileEntryMinSize || int(length) > len(it.data) {
+		return nil, fmt.Errorf("invalid entry length %d", length)
+	}
+
+	entry, err := dstypes.DecodeFileEntry(it.data[:length])
+	if err != nil {
+		return nil, err
+	}
+	it.data = it.data[length:]
+	return entry, nil
+}
+
+func chainConfigForFork(chainId, forkId uint64) (*chain.Config, error) {
+	cfg := *params.HermezLocalDevnetChainConfig
+	cfg.ChainID = new(big.Int).SetUint64(chainId)
+	if err := utils.RecoverySetBlockConfigForks(0, forkId, &cfg, "fake executor"); err != nil {
+		return nil, err
+	}
+	return &cfg, nil
+}
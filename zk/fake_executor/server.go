@@ -0,0 +1,187 @@
+package fake_executor
+
+import (
+	"context"
+	"encoding/hex"
+	"errors"
+	"net"
+	"strconv"
+
+	"github.com/ledgerwatch/erigon-lib/common"
+	"github.com/ledgerwatch/erigon/core/vm"
+	smtutils "github.com/ledgerwatch/erigon/smt/pkg/utils"
+	"github.com/ledgerwatch/erigon/zk/legacy_executor_verifier/proto/github.com/0xPolygonHermez/zkevm-node/state/runtime/executor"
+	"github.com/ledgerwatch/log/v3"
+	"google.golang.org/grpc"
+)
+
+// Server answers ProcessStatelessBatchV2 like the executor does by re-executing the batch with the node's own zkEVM.
+// It is meant for tests, the counters are the node's virtual counters rather than the ones the prover would use.
+// Block responses carry no block hashes or logs and transaction responses no intermediate state roots, contract code
+// is returned as its smt hash.
+type Server struct {
+	executor.UnimplementedExecutorServiceServer
+
+	smtReduction float64
+}
+
+// NewServer creates a server counting with the given smt depth reduction, see zkevm.virtual-counters-smt-reduction.
+// 1 counts with the full depth of the tree.
+func NewServer(smtReduction float64) *Server {
+	return &Server{smtReduction: smtReduction}
+}
+
+// Start serves on the given address, ":0" picks a free port, and returns the address listened on and a function
+// stopping the server
+func (s *Server) Start(address string) (string, func(), error) {
+	listener, err := net.Listen("tcp", address)
+	if err != nil {
+		return "", nil, err
+	}
+
+	size := 1024 * 1024 * 256
+	grpcServer := grpc.NewServer(grpc.MaxRecvMsgSize(size), grpc.MaxSendMsgSize(size))
+	executor.RegisterExecutorServiceServer(grpcServer, s)
+
+	go func() {
+		if err := grpcServer.Serve(listener); err != nil {
+			log.Warn("fake executor stopped", "err", err)
+		}
+	}()
+
+	return listener.Addr().String(), grpcServer.Stop, nil
+}
+
+func (s *Server) ProcessStatelessBatchV2(ctx context.Context, request *executor.ProcessStatelessBatchRequestV2) (*executor.ProcessBatchResponseV2, error) {
+	result, err := ExecuteBatch(ctx, request.Witness, request.DataStream, s.smtReduction)
+	if err != nil {
+		log.Debug("fake executor failed to execute batch", "context", request.ContextId, "err", err)
+		return errorResponse(err), nil
+	}
+
+	resp := &executor.ProcessBatchResponseV2{
+		NewStateRoot:        result.NewStateRoot.Bytes(),
+		OldStateRoot:        result.OldStateRoot.Bytes(),
+		NewBatchNum:         result.BatchNumber,
+		ForkId:              result.ForkId,
+		GasUsed:             result.GasUsed,
+		CntKeccakHashes:     counterUsed(result.Counters, vm.K),
+		CntPoseidonHashes:   counterUsed(result.Counters, vm.P),
+		CntPoseidonPaddings: counterUsed(result.Counters, vm.D),
+		CntMemAligns:        counterUsed(result.Counters, vm.M),
+		CntArithmetics:      counterUsed(result.Counters, vm.A),
+		CntBinaries:         counterUsed(result.Counters, vm.B),
+		CntSteps:            counterUsed(result.Counters, vm.S),
+		CntSha256Hashes:     counterUsed(result.Counters, vm.SHA),
+		Error:               executor.ExecutorError_EXECUTOR_ERROR_NO_ERROR,
+		ErrorRom:            executor.RomError_ROM_ERROR_NO_ERROR,
+		BlockResponses:      blockResponses(result.Blocks),
+		ReadWriteAddresses:  readWriteAddresses(result.Accounts),
+	}
+	if result.Overflow {
+		resp.InvalidBatch = 1
+		resp.ErrorRom = overflowRomError(result.Counters)
+	}
+
+	return resp, nil
+}
+
+func blockResponses(blocks []BlockResult) []*executor.ProcessBlockResponseV2 {
+	responses := make([]*executor.ProcessBlockResponseV2, 0, len(blocks))
+	for _, block := range blocks {
+		txResponses := make([]*executor.ProcessTransactionResponseV2, 0, len(block.Txs))
+		for _, tx := range block.Txs {
+			txResponse := &executor.ProcessTransactionResponseV2{
+				TxHash:              tx.Hash.Bytes(),
+				TxHashL2:            tx.Hash.Bytes(),
+				BlockNumber:         block.Number,
+				Type:                uint32(tx.Type),
+				GasUsed:             tx.GasUsed,
+				CumulativeGasUsed:   tx.CumulativeGasUsed,
+				EffectivePercentage: uint32(tx.EffectivePercentage),
+				Status:              uint32(tx.Status),
+				Error:               executor.RomError_ROM_ERROR_NO_ERROR,
+			}
+			if tx.ContractAddress != (common.Address{}) {
+				txResponse.CreateAddress = tx.ContractAddress.Hex()
+			}
+			txResponses = append(txResponses, txResponse)
+		}
+
+		responses = append(responses, &executor.ProcessBlockResponseV2{
+			Coinbase:      block.Coinbase.Hex(),
+			GasLimit:      block.GasLimit,
+			BlockNumber:   block.Number,
+			Timestamp:     block.Timestamp,
+			Ger:           block.Ger.Bytes(),
+			BlockHashL1:   block.L1BlockHash.Bytes(),
+			GasUsed:       block.GasUsed,
+			BlockInfoRoot: block.BlockInfoRoot.Bytes(),
+			Responses:     txResponses,
+			Error:         executor.RomError_ROM_ERROR_NO_ERROR,
+		})
+	}
+	return responses
+}
+
+func readWriteAddresses(accounts map[common.Address]*AccountResult) map[string]*executor.InfoReadWriteV2 {
+	addresses := make(map[string]*executor.InfoReadWriteV2, len(accounts))
+	for address, acc := range accounts {
+		info := &executor.InfoReadWriteV2{
+			Nonce:     strconv.FormatUint(acc.Nonce, 10),
+			Balance:   acc.Balance.Dec(),
+			ScLength:  strconv.Itoa(len(acc.Code)),
+			ScStorage: make(map[string]string, len(acc.Storage)),
+		}
+		if len(acc.Code) > 0 {
+			info.ScCode = smtutils.HashContractBytecode(hex.EncodeToString(acc.Code))
+		}
+		for key, value := range acc.Storage {
+			info.ScStorage[key.Hex()] = value.Hex()
+		}
+		addresses[address.Hex()] = info
+	}
+	return addresses
+}
+
+func counterUsed(counters vm.Counters, key vm.CounterKey) uint32 {
+	return uint32(counters[key].Used())
+}
+
+func errorResponse(err error) *executor.ProcessBatchResponseV2 {
+	resp := &executor.ProcessBatchResponseV2{
+		Error:    executor.ExecutorError_EXECUTOR_ERROR_UNSPECIFIED,
+		ErrorRom: executor.RomError_ROM_ERROR_NO_ERROR,
+		Debug:    &executor.ResponseDebug{ErrorLog: err.Error()},
+	}
+	switch {
+	case errors.Is(err, ErrInvalidWitness):
+		resp.Error = executor.ExecutorError_EXECUTOR_ERROR_INVALID_WITNESS
+	case errors.Is(err, ErrInvalidDataStream):
+		resp.Error = executor.ExecutorError_EXECUTOR_ERROR_INVALID_DATA_STREAM
+	case errors.Is(err, ErrUnsupportedForkId):
+		resp.Error = executor.ExecutorError_EXECUTOR_ERROR_UNSUPPORTED_FORK_ID
+	}
+	return resp
+}
+
+var overflowRomErrors = map[vm.CounterKey]executor.RomError{
+	vm.S:   executor.RomError_ROM_ERROR_OUT_OF_COUNTERS_STEP,
+	vm.K:   executor.RomError_ROM_ERROR_OUT_OF_COUNTERS_KECCAK,
+	vm.B:   executor.RomError_ROM_ERROR_OUT_OF_COUNTERS_BINARY,
+	vm.M:   executor.RomError_ROM_ERROR_OUT_OF_COUNTERS_MEM,
+	vm.A:   executor.RomError_ROM_ERROR_OUT_OF_COUNTERS_ARITH,
+	vm.D:   executor.RomError_ROM_ERROR_OUT_OF_COUNTERS_PADDING,
+	vm.P:   executor.RomError_ROM_ERROR_OUT_OF_COUNTERS_POSEIDON,
+	vm.SHA: executor.RomError_ROM_ERROR_OUT_OF_COUNTERS_SHA,
+}
+
+// overflowRomError is the error of the first counter that ran out
+func overflowRomError(counters vm.Counters) executor.RomError {
+	for key, c := range counters {
+		if romErr, ok := overflowRomErrors[vm.CounterKey(key)]; ok && c.Remaining() < 0 {
+			return romErr
+		}
+	}
+	return executor.RomError_ROM_ERROR_NO_ERROR
+}
@@ -0,0 +1,172 @@
+package fake_executor
+
+import (
+	"bytes"
+	"context"
+	"math/big"
+	"testing"
+
+	"github.com/holiman/uint256"
+	"github.com/ledgerwatch/erigon-lib/common"
+	"github.com/ledgerwatch/erigon/core/types"
+	"github.com/ledgerwatch/erigon/core/vm"
+	"github.com/ledgerwatch/erigon/crypto"
+	"github.com/ledgerwatch/erigon/smt/pkg/smt"
+	"github.com/ledgerwatch/erigon/zk/datastream/proto/github.com/0xPolygonHermez/zkevm-node/state/datastream"
+	dstypes "github.com/ledgerwatch/erigon/zk/datastream/types"
+	"github.com/ledgerwatch/erigon/zk/legacy_executor_verifier/proto/github.com/0xPolygonHermez/zkevm-node/state/runtime/executor"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+)
+
+const testChainId = 1001
+
+type streamEntry interface {
+	Marshal() ([]byte, error)
+	Type() dstypes.EntryType
+}
+
+func encodeStream(t *testing.T, entries ...streamEntry) []byte {
+	var out []byte
+	for _, entry := range entries {
+		data, err := entry.Marshal()
+		require.NoError(t, err)
+		fileEntry := dstypes.FileEntry{
+			PacketType: 2,
+			Length:     dstypes.FileEntryMinSize + uint32(len(data)),
+			EntryType:  entry.Type(),
+			Data:       data,
+		}
+		out = append(out, fileEntry.Encode()...)
+	}
+	return out
+}
+
+// testBatch builds the witness of a tree holding a funded sender and a stream with a single transfer from it
+func testBatch(t *testing.T, forkId, nonce uint64) (witness, stream []byte, oldRoot common.Hash, transfer types.Transaction) {
+	key, err := crypto.GenerateKey()
+	require.NoError(t, err)
+	sender := crypto.PubkeyToAddress(key.PublicKey)
+
+	tree := smt.NewSMT(nil, false)
+	_, err = tree.SetAccountState(sender.String(), big.NewInt(1e18), big.NewInt(0))
+	require.NoError(t, err)
+
+	w, err := smt.BuildWitness(tree, nil, context.Background())
+	require.NoError(t, err)
+	var buf bytes.Buffer
+	_, err = w.WriteInto(&buf, false)
+	require.NoError(t, err)
+
+	tx := types.NewTransaction(nonce, common.HexToAddress("0x1234"), uint256.NewInt(1000), 21000, uint256.NewInt(1e9), nil)
+	signed, err := types.SignTx(tx, *types.LatestSignerForChainID(big.NewInt(testChainId)), key)
+	require.NoError(t, err)
+	var encoded bytes.Buffer
+	require.NoError(t, signed.EncodeRLP(&encoded))
+
+	stream = encodeStream(t,
+		&dstypes.BatchStartProto{BatchStart: &datastream.BatchStart{Number: 1, ForkId: forkId, ChainId: testChainId, Type: datastream.BatchType_BATCH_TYPE_REGULAR}},
+		&dstypes.L2BlockProto{L2Block: &datastream.L2Block{Number: 1, BatchNumber: 1, Timestamp: 1700000000, DeltaTimestamp: 1, Coinbase: common.HexToAddress("0x5678").Bytes()}},
+		&dstypes.TxProto{Transaction: &datastream.Transaction{L2BlockNumber: 1, IsValid: true, Encoded: encoded.Bytes(), EffectiveGasPricePercentage: 255}},
+		&dstypes.L2BlockEndProto{Number: 1},
+		&dstypes.BatchEndProto{BatchEnd: &datastream.BatchEnd{Number: 1}},
+	)
+
+	return buf.Bytes(), stream, common.BigToHash(tree.LastRoot()), signed
+}
+
+func TestExecuteBatch(t *testing.T) {
+	witness, stream, oldRoot, transfer := testBatch(t, 9, 0)
+	sender, err := transfer.Sender(*types.LatestSignerForChainID(big.NewInt(testChainId)))
+	require.NoError(t, err)
+
+	result, err := ExecuteBatch(context.Background(), witness, stream, 1)
+	require.NoError(t, err)
+	assert.Equal(t, uint64(1), result.BatchNumber)
+	assert.Equal(t, uint64(9), result.ForkId)
+	assert.Equal(t, oldRoot, result.OldStateRoot)
+	assert.NotEqual(t, oldRoot, result.NewStateRoot)
+	assert.Equal(t, uint64(21000), result.GasUsed)
+	assert.False(t, result.Overflow)
+	assert.Positive(t, counterUsed(result.Counters, vm.S))
+	assert.Positive(t, counterUsed(result.Counters, vm.P))
+
+	require.Len(t, result.Blocks, 1)
+	block := result.Blocks[0]
+	assert.Equal(t, uint64(1), block.Number)
+	assert.Equal(t, uint64(1700000000), block.Timestamp)
+	assert.Equal(t, common.HexToAddress("0x5678"), block.Coinbase)
+	assert.Equal(t, uint64(21000), block.GasUsed)
+	assert.NotEqual(t, common.Hash{}, block.BlockInfoRoot)
+	require.Len(t, block.Txs, 1)
+	assert.Equal(t, TxResult{Hash: transfer.Hash(), Status: types.ReceiptStatusSuccessful, GasUsed: 21000, CumulativeGasUsed: 21000, EffectivePercentage: 255}, block.Txs[0])
+
+	require.Contains(t, result.Accounts, sender)
+	assert.Equal(t, uint64(1), result.Accounts[sender].Nonce)
+	assert.Equal(t, uint64(1e18-1000-21000*1e9), result.Accounts[sender].Balance.Uint64())
+	require.Contains(t, result.Accounts, common.HexToAddress("0x1234"))
+	assert.Equal(t, uint64(1000), result.Accounts[common.HexToAddress("0x1234")].Balance.Uint64())
+
+	again, err := ExecuteBatch(context.Background(), witness, stream, 1)
+	require.NoError(t, err)
+	assert.Equal(t, result.NewStateRoot, again.NewStateRoot)
+
+	// the nonce is read from the witness
+	witness, stream, _, _ = testBatch(t, 9, 1)
+	_, err = ExecuteBatch(context.Background(), witness, stream, 1)
+	assert.ErrorContains(t, err, "nonce too high")
+}
+
+func TestServer(t *testing.T) {
+	address, stop, err := NewServer(1).Start("127.0.0.1:0")
+	require.NoError(t, err)
+	defer stop()
+
+	conn, err := grpc.Dial(address, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	require.NoError(t, err)
+	defer conn.Close()
+	client := executor.NewExecutorServiceClient(conn)
+
+	witness, stream, oldRoot, transfer := testBatch(t, 9, 0)
+	sender, err := transfer.Sender(*types.LatestSignerForChainID(big.NewInt(testChainId)))
+	require.NoError(t, err)
+	resp, err := client.ProcessStatelessBatchV2(context.Background(), &executor.ProcessStatelessBatchRequestV2{Witness: witness, DataStream: stream})
+	require.NoError(t, err)
+	assert.Equal(t, executor.ExecutorError_EXECUTOR_ERROR_NO_ERROR, resp.Error)
+	assert.Equal(t, oldRoot.Bytes(), resp.OldStateRoot)
+	assert.Len(t, resp.NewStateRoot, 32)
+	assert.Equal(t, uint64(21000), resp.GasUsed)
+	assert.Positive(t, resp.CntSteps)
+
+	require.Len(t, resp.BlockResponses, 1)
+	assert.Equal(t, uint64(1), resp.BlockResponses[0].BlockNumber)
+	assert.Equal(t, common.HexToAddress("0x5678").Hex(), resp.BlockResponses[0].Coinbase)
+	require.Len(t, resp.BlockResponses[0].Responses, 1)
+	assert.Equal(t, transfer.Hash().Bytes(), resp.BlockResponses[0].Responses[0].TxHash)
+	assert.Equal(t, uint64(21000), resp.BlockResponses[0].Responses[0].CumulativeGasUsed)
+	require.Contains(t, resp.ReadWriteAddresses, sender.Hex())
+	assert.Equal(t, "1", resp.ReadWriteAddresses[sender.Hex()].Nonce)
+	require.Contains(t, resp.ReadWriteAddresses, common.HexToAddress("0x1234").Hex())
+	assert.Equal(t, "1000", resp.ReadWriteAddresses[common.HexToAddress("0x1234").Hex()].Balance)
+
+	_, oldForkStream, _, _ := testBatch(t, 6, 0)
+	tests := map[string]struct {
+		witness, stream []byte
+		expected        executor.ExecutorError
+	}{
+		"invalid witness":     {[]byte{0xff}, stream, executor.ExecutorError_EXECUTOR_ERROR_INVALID_WITNESS},
+		"invalid data stream": {witness, stream[:len(stream)-5], executor.ExecutorError_EXECUTOR_ERROR_INVALID_DATA_STREAM},
+		"unsupported fork":    {witness, oldForkStream, executor.ExecutorError_EXECUTOR_ERROR_UNSUPPORTED_FORK_ID},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			resp, err := client.ProcessStatelessBatchV2(context.Background(), &executor.ProcessStatelessBatchRequestV2{Witness: tt.witness, DataStream: tt.stream})
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, resp.Error)
+			assert.NotEmpty(t, resp.Debug.ErrorLog)
+		})
+	}
+}
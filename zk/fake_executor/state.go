@@ -0,0 +1,218 @@
+package fake_executor
+
+import (
+	"context"
+	"encoding/hex"
+	"fmt"
+	"math/big"
+
+	"github.com/holiman/uint256"
+	"github.com/ledgerwatch/erigon-lib/common"
+	"github.com/ledgerwatch/erigon/core/state"
+	"github.com/ledgerwatch/erigon/core/types/accounts"
+	"github.com/ledgerwatch/erigon/crypto"
+	"github.com/ledgerwatch/erigon/smt/pkg/smt"
+	"github.com/ledgerwatch/erigon/smt/pkg/utils"
+	"github.com/ledgerwatch/erigon/turbo/trie"
+)
+
+// witnessState is the state a batch runs against, read from the leaves of the witness.  It is both the reader and
+// the writer of the blocks executed on top of it and keeps the changes since the last flush in the form the SMT takes
+// them.
+type witnessState struct {
+	accounts map[common.Address]*accounts.Account
+	code     map[common.Address][]byte
+	storage  map[common.Address]map[common.Hash]uint256.Int
+	// touched are the accounts and storage slots read or written since the start of the batch
+	touched map[common.Address]map[common.Hash]struct{}
+
+	accChanges     map[common.Address]*accounts.Account
+	codeChanges    map[common.Address]string
+	storageChanges map[common.Address]map[string]string
+}
+
+var _ state.StateReader = (*witnessState)(nil)
+var _ state.StateWriter = (*witnessState)(nil)
+
+func newWitnessState(w *trie.Witness) (*witnessState, error) {
+	s := &witnessState{
+		accounts: make(map[common.Address]*accounts.Account),
+		code:     make(map[common.Address][]byte),
+		storage:  make(map[common.Address]map[common.Hash]uint256.Int),
+		touched:  make(map[common.Address]map[common.Hash]struct{}),
+	}
+	s.resetChanges()
+
+	// the code operator always comes right before the leaf of the code hash
+	var code []byte
+	for _, operator := range w.Operators {
+		switch op := operator.(type) {
+		case *trie.OperatorCode:
+			code = op.Code
+		case *trie.OperatorSMTLeafValue:
+			address := common.BytesToAddress(op.Address)
+			acc := s.accounts[address]
+			if acc == nil {
+				newAcc := accounts.NewAccount()
+				newAcc.Initialised = true
+				acc = &newAcc
+				s.accounts[address] = acc
+			}
+
+			switch int(op.NodeType) {
+			case utils.KEY_BALANCE:
+				acc.Balance.SetBytes(op.Value)
+			case utils.KEY_NONCE:
+				acc.Nonce = new(big.Int).SetBytes(op.Value).Uint64()
+			case utils.SC_CODE:
+				if code == nil {
+					return nil, fmt.Errorf("no code in witness for %s", address)
+				}
+				s.code[address] = code
+				acc.CodeHash = crypto.Keccak256Hash(code)
+				acc.Incarnation = state.FirstContractIncarnation
+				code = nil
+			case utils.SC_STORAGE:
+				if s.storage[address] == nil {
+					s.storage[address] = make(map[common.Hash]uint256.Int)
+				}
+				var value uint256.Int
+				value.SetBytes(op.Value)
+				s.storage[address][common.BytesToHash(op.StorageKey)] = value
+			}
+		}
+	}
+
+	return s, nil
+}
+
+func (s *witnessState) resetChanges() {
+	s.accChanges = make(map[common.Address]*accounts.Account)
+	s.codeChanges = make(map[common.Address]string)
+	s.storageChanges = make(map[common.Address]map[string]string)
+}
+
+// flush applies the changes written since the last flush to the tree and returns the new root
+func (s *witnessState) flush(ctx context.Context, tree *smt.SMT) (common.Hash, error) {
+	// like the interhashes stage the code of every changed contract is set again
+	for address, acc := range s.accChanges {
+		if acc == nil {
+			continue
+		}
+		if code := s.code[address]; len(code) > 0 {
+			s.codeChanges[address] = "0x" + hex.EncodeToString(code)
+		}
+	}
+
+	if _, _, err := tree.SetStorage(ctx, "[fake executor]", s.accChanges, s.codeChanges, s.storageChanges); err != nil {
+		return common.Hash{}, err
+	}
+	s.resetChanges()
+
+	return common.BigToHash(tree.LastRoot()), nil
+}
+
+func (s *witnessState) touch(address common.Address, key *common.Hash) {
+	keys, ok := s.touched[address]
+	if !ok {
+		keys = make(map[common.Hash]struct{})
+		s.touched[address] = keys
+	}
+	if key != nil {
+		keys[*key] = struct{}{}
+	}
+}
+
+// touchedAccounts returns the current values of the touched accounts and storage slots
+func (s *witnessState) touchedAccounts() map[common.Address]*AccountResult {
+	result := make(map[common.Address]*AccountResult, len(s.touched))
+	for address, keys := range s.touched {
+		acc := &AccountResult{Code: s.code[address], Storage: make(map[common.Hash]uint256.Int, len(keys))}
+		if a, ok := s.accounts[address]; ok {
+			acc.Nonce = a.Nonce
+			acc.Balance = a.Balance
+		}
+		for key := range keys {
+			acc.Storage[key] = s.storage[address][key]
+		}
+		result[address] = acc
+	}
+	return result
+}
+
+func (s *witnessState) ReadAccountData(address common.Address) (*accounts.Account, error) {
+	s.touch(address, nil)
+	acc, ok := s.accounts[address]
+	if !ok {
+		return nil, nil
+	}
+	var cpy accounts.Account
+	cpy.Copy(acc)
+	return &cpy, nil
+}
+
+func (s *witnessState) ReadAccountStorage(address common.Address, _ uint64, key *common.Hash) ([]byte, error) {
+	s.touch(address, key)
+	value, ok := s.storage[address][*key]
+	if !ok {
+		return nil, nil
+	}
+	return value.Bytes(), nil
+}
+
+func (s *witnessState) ReadAccountCode(address common.Address, _ uint64, _ common.Hash) ([]byte, error) {
+	return s.code[address], nil
+}
+
+func (s *witnessState) ReadAccountCodeSize(address common.Address, _ uint64, _ common.Hash) (int, error) {
+	return len(s.code[address]), nil
+}
+
+func (s *witnessState) ReadAccountIncarnation(address common.Address) (uint64, error) {
+	if acc, ok := s.accounts[address]; ok {
+		return acc.Incarnation, nil
+	}
+	return 0, nil
+}
+
+func (s *witnessState) UpdateAccountData(address common.Address, _, account *accounts.Account) error {
+	var cpy accounts.Account
+	cpy.Copy(account)
+	s.touch(address, nil)
+	s.accounts[address] = &cpy
+	s.accChanges[address] = &cpy
+	return nil
+}
+
+func (s *witnessState) UpdateAccountCode(address common.Address, _ uint64, _ common.Hash, code []byte) error {
+	s.touch(address, nil)
+	s.code[address] = common.CopyBytes(code)
+	s.codeChanges[address] = "0x" + hex.EncodeToString(code)
+	return nil
+}
+
+func (s *witnessState) DeleteAccount(address common.Address, _ *accounts.Account) error {
+	s.touch(address, nil)
+	delete(s.accounts, address)
+	delete(s.code, address)
+	s.accChanges[address] = nil
+	return nil
+}
+
+func (s *witnessState) WriteAccountStorage(address common.Address, _ uint64, key *common.Hash, _, value *uint256.Int) error {
+	s.touch(address, key)
+	if s.storage[address] == nil {
+		s.storage[address] = make(map[common.Hash]uint256.Int)
+	}
+	s.storage[address][*key] = *value
+
+	if s.storageChanges[address] == nil {
+		s.storageChanges[address] = make(map[string]string)
+	}
+	s.storageChanges[address][fmt.Sprintf("0x%032x", *key)] = fmt.Sprintf("0x%032x", common.BytesToHash(value.Bytes()))
+	return nil
+}
+
+func (s *witnessState) CreateContract(common.Address) error {
+	return nil
+}
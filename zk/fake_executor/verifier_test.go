@@ -0,0 +1,108 @@
+package fake_executor
+
+import (
+	"context"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/holiman/uint256"
+	"github.com/ledgerwatch/erigon-lib/common"
+	"github.com/ledgerwatch/erigon-lib/kv"
+	"github.com/ledgerwatch/erigon-lib/kv/memdb"
+	"github.com/ledgerwatch/erigon/core/rawdb"
+	"github.com/ledgerwatch/erigon/core/state"
+	"github.com/ledgerwatch/erigon/core/types"
+	"github.com/ledgerwatch/erigon/core/types/accounts"
+	"github.com/ledgerwatch/erigon/eth/ethconfig"
+	"github.com/ledgerwatch/erigon/zk/hermez_db"
+	"github.com/ledgerwatch/erigon/zk/legacy_executor_verifier"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type testWitnessGenerator []byte
+
+func (w testWitnessGenerator) GetWitnessByBlockRange(kv.Tx, context.Context, uint64, uint64, bool, bool) ([]byte, error) {
+	return w, nil
+}
+
+// TestVerifierDivergence runs a batch the node recorded through the verifier against the fake executor, the report of
+// the mismatch must only point at the account the node got wrong
+func TestVerifierDivergence(t *testing.T) {
+	address, stop, err := NewServer(1).Start("127.0.0.1:0")
+	require.NoError(t, err)
+	defer stop()
+
+	witness, _, oldRoot, transfer := testBatch(t, 9, 0)
+	sender, err := transfer.Sender(*types.LatestSignerForChainID(big.NewInt(testChainId)))
+	require.NoError(t, err)
+	coinbase, recipient := common.HexToAddress("0x5678"), common.HexToAddress("0x1234")
+
+	db := memdb.NewTestDB(t)
+	err = db.Update(context.Background(), func(tx kv.RwTx) error {
+		require.NoError(t, hermez_db.CreateHermezBuckets(tx))
+		hermezDb := hermez_db.NewHermezDb(tx)
+
+		genesis := types.NewBlockWithHeader(&types.Header{Number: big.NewInt(0), Time: 1699999999, Root: oldRoot})
+		block := types.NewBlockWithHeader(&types.Header{
+			Number:     big.NewInt(1),
+			ParentHash: genesis.Hash(),
+			Time:       1700000000,
+			Coinbase:   coinbase,
+			GasUsed:    21000,
+		}).WithBody(types.Transactions{transfer}, nil)
+		for _, b := range []*types.Block{genesis, block} {
+			require.NoError(t, rawdb.WriteBlock(tx, b))
+			require.NoError(t, rawdb.WriteCanonicalHash(tx, b.Hash(), b.NumberU64()))
+			require.NoError(t, hermezDb.WriteBlockBatch(b.NumberU64(), b.NumberU64()))
+		}
+		require.NoError(t, rawdb.WriteReceipts(tx, 1, types.Receipts{{Status: types.ReceiptStatusSuccessful, CumulativeGasUsed: 21000, GasUsed: 21000, TxHash: transfer.Hash()}}))
+		require.NoError(t, hermezDb.WriteForkId(1, 9))
+		require.NoError(t, hermezDb.WriteEffectiveGasPricePercentage(transfer.Hash(), 255))
+
+		// the recipient is off by one wei
+		writer := state.NewPlainStateWriterNoHistory(tx)
+		for addr, acc := range map[common.Address]struct{ nonce, balance uint64 }{
+			sender:    {1, 1e18 - 1000 - 21000*1e9},
+			recipient: {0, 999},
+			coinbase:  {0, 21000 * 1e9},
+		} {
+			a := accounts.NewAccount()
+			a.Nonce = acc.nonce
+			a.Balance = *uint256.NewInt(acc.balance)
+			require.NoError(t, writer.UpdateAccountData(addr, &accounts.Account{}, &a))
+		}
+		return nil
+	})
+	require.NoError(t, err)
+
+	chainConfig, err := chainConfigForFork(testChainId, 9)
+	require.NoError(t, err)
+	executors := []*legacy_executor_verifier.Executor{legacy_executor_verifier.NewExecutor(address, 5*time.Second, 1, "")}
+	verifier := legacy_executor_verifier.NewLegacyExecutorVerifier(ethconfig.Zk{}, executors, chainConfig, db, testWitnessGenerator(witness), nil)
+
+	request := legacy_executor_verifier.NewVerifierRequest(9, 1, []uint64{1}, common.Hash{1}, nil)
+	bundle, err := verifier.VerifyAsync(request).Get()
+	require.NoError(t, err)
+	require.NotNil(t, bundle.Response)
+	assert.False(t, bundle.Response.Valid)
+	require.ErrorIs(t, bundle.Response.Error, legacy_executor_verifier.ErrExecutorStateRootMismatch)
+
+	report := bundle.Response.Divergence
+	require.NotNil(t, report)
+	assert.Equal(t, oldRoot, report.ExecutorOldStateRoot)
+	assert.Empty(t, report.Batch)
+	assert.Empty(t, report.Blocks)
+
+	var divergent []common.Address
+	for _, account := range report.Accounts {
+		divergent = append(divergent, account.Address)
+		if account.Address == recipient {
+			assert.Equal(t, []legacy_executor_verifier.FieldDivergence{{Field: "balance", Ours: "999", Executor: "1000"}}, account.Fields)
+		}
+	}
+	assert.Contains(t, divergent, recipient)
+	assert.NotContains(t, divergent, sender)
+	assert.NotContains(t, divergent, coinbase)
+}
@@ -0,0 +1,384 @@
+package fee_oracle
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"sync"
+	"time"
+
+	"github.com/ledgerwatch/erigon/core/types"
+	"github.com/ledgerwatch/erigon/core/vm"
+	"github.com/ledgerwatch/erigon/eth/ethconfig"
+	"github.com/ledgerwatch/erigon/zkevm/jsonrpc/client"
+	"github.com/ledgerwatch/log/v3"
+)
+
+const (
+	// l1SampleInterval is the minimum time between two samples of the L1 gas price
+	l1SampleInterval = 3 * time.Second
+
+	// calldata gas cost per byte on the L1
+	zeroByteGas    = 4
+	nonZeroByteGas = 16
+
+	// the effective gas price percentage is stored as a byte, 255 means the full gas price is paid
+	maxEffectivePercentage = 255
+)
+
+var ErrNoL1GasPrice = errors.New("no l1 gas price available")
+
+type Config struct {
+	DefaultGasPrice uint64
+	MaxGasPrice     uint64
+	GasPriceFactor  float64
+
+	// L1Samples is the number of L1 gas price samples in the moving average
+	L1Samples int
+	// BatchWindow is the number of closed batches used to measure the counter saturation
+	BatchWindow int
+	// SaturationTarget is the saturation of the batches above which the price starts to increase
+	SaturationTarget float64
+	// MaxMultiplier is the multiplier applied to the price when the batches are fully saturated
+	MaxMultiplier float64
+}
+
+// L1GasPriceFunc returns the current gas price of the L1
+type L1GasPriceFunc func() (*big.Int, error)
+
+// BatchCountersReader is the part of the hermez db needed to measure the counter saturation of recent batches
+type BatchCountersReader interface {
+	GetLatestBatchCounters(batchNumber uint64) ([]int, bool, error)
+	GetForkId(batchNumber uint64) (uint64, error)
+}
+
+// Estimate is a snapshot of the pricing inputs along with the suggested L2 gas price
+type Estimate struct {
+	L1GasPrice           *big.Int
+	L1DataCostPerByte    *big.Int
+	BatchSaturation      float64
+	CongestionMultiplier float64
+	GasPrice             *big.Int
+	LastClosedBatch      uint64
+}
+
+// Oracle computes the L2 gas price from the recent L1 gas price and how full recent batches were with regard to
+// their zk counters.  The L1 price is taken as a moving average of samples so a single spike on the L1 does not move
+// the L2 price, and once the batches are fuller than the target saturation the price is scaled up linearly until
+// MaxMultiplier is reached for completely full batches.
+type Oracle struct {
+	cfg        Config
+	l1GasPrice L1GasPriceFunc
+
+	mu         sync.Mutex
+	running    bool // the L1 is sampled by Run rather than by Estimate
+	l1Samples  []*big.Int
+	lastSample time.Time
+	latest     *Estimate
+}
+
+func NewOracle(cfg Config, l1GasPrice L1GasPriceFunc) *Oracle {
+	if cfg.L1Samples <= 0 {
+		cfg.L1Samples = 1
+	}
+	if cfg.GasPriceFactor <= 0 {
+		cfg.GasPriceFactor = 1
+	}
+	if cfg.MaxMultiplier < 1 {
+		cfg.MaxMultiplier = 1
+	}
+	return &Oracle{
+		cfg:        cfg,
+		l1GasPrice: l1GasPrice,
+	}
+}
+
+// NewOracleFromZk returns an oracle sampling the configured L1 rpc, or nil if the dynamic gas price is not enabled
+func NewOracleFromZk(zk *ethconfig.Zk) *Oracle {
+	if zk == nil || !zk.DynamicGasPrice {
+		return nil
+	}
+	return NewOracle(Config{
+		DefaultGasPrice:  zk.DefaultGasPrice,
+		MaxGasPrice:      zk.MaxGasPrice,
+		GasPriceFactor:   zk.GasPriceFactor,
+		L1Samples:        zk.DynamicGasPriceL1Samples,
+		BatchWindow:      zk.DynamicGasPriceBatchWindow,
+		SaturationTarget: zk.DynamicGasPriceSaturationTarget,
+		MaxMultiplier:    zk.DynamicGasPriceMaxMultiplier,
+	}, L1RpcGasPrice(zk.L1RpcUrl))
+}
+
+// L1RpcGasPrice returns an L1GasPriceFunc calling eth_gasPrice on the given L1 rpc
+func L1RpcGasPrice(url string) L1GasPriceFunc {
+	return func() (*big.Int, error) {
+		res, err := client.JSONRPCCall(url, "eth_gasPrice")
+		if err != nil {
+			return nil, err
+		}
+		if res.Error != nil {
+			return nil, fmt.Errorf("RPC error response: %s", res.Error.Message)
+		}
+
+		var resultString string
+		if err := json.Unmarshal(res.Result, &resultString); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal result: %v", err)
+		}
+		if len(resultString) < 3 {
+			return nil, fmt.Errorf("invalid gas price %q", resultString)
+		}
+
+		price, ok := big.NewInt(0).SetString(resultString[2:], 16)
+		if !ok {
+			return nil, fmt.Errorf("failed to convert result to big.Int")
+		}
+		return price, nil
+	}
+}
+
+// Run samples the L1 gas price every l1SampleInterval until the context is done.  While it runs Estimate only uses the
+// samples taken here so it never waits on the L1.
+func (o *Oracle) Run(ctx context.Context) {
+	o.mu.Lock()
+	o.running = true
+	o.mu.Unlock()
+
+	ticker := time.NewTicker(l1SampleInterval)
+	defer ticker.Stop()
+	for {
+		if price, err := o.l1GasPrice(); err != nil {
+			log.Warn("[fee-oracle] Failed to sample the L1 gas price", "err", err)
+		} else {
+			o.mu.Lock()
+			o.addL1Sample(price)
+			o.mu.Unlock()
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Estimate refreshes the L1 gas price if the last sample is stale and Run is not sampling it, measures the saturation of the batches up to and
+// including lastClosedBatch and returns the resulting estimate, which is also kept as the latest estimate
+func (o *Oracle) Estimate(reader BatchCountersReader, lastClosedBatch uint64) (*Estimate, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	if err := o.sampleL1(); err != nil {
+		return nil, err
+	}
+
+	saturation, err := o.batchSaturation(reader, lastClosedBatch)
+	if err != nil {
+		return nil, err
+	}
+
+	l1GasPrice := o.averageL1GasPrice()
+	multiplier := o.congestionMultiplier(saturation)
+
+	// the default gas price acts as the floor of the base price before any congestion is applied
+	base := new(big.Float).Mul(big.NewFloat(o.cfg.GasPriceFactor), new(big.Float).SetInt(l1GasPrice))
+	if minGasPrice := new(big.Float).SetUint64(o.cfg.DefaultGasPrice); base.Cmp(minGasPrice) < 0 {
+		base = minGasPrice
+	}
+	price, _ := base.Mul(base, big.NewFloat(multiplier)).Int(nil)
+
+	if o.cfg.MaxGasPrice > 0 {
+		maxGasPrice := new(big.Int).SetUint64(o.cfg.MaxGasPrice)
+		if price.Cmp(maxGasPrice) > 0 {
+			price = maxGasPrice
+		}
+	}
+
+	estimate := &Estimate{
+		L1GasPrice:           l1GasPrice,
+		L1DataCostPerByte:    new(big.Int).Mul(l1GasPrice, big.NewInt(nonZeroByteGas)),
+		BatchSaturation:      saturation,
+		CongestionMultiplier: multiplier,
+		GasPrice:             price,
+		LastClosedBatch:      lastClosedBatch,
+	}
+	o.latest = estimate
+
+	return estimate, nil
+}
+
+// Latest returns the last estimate made by the oracle, nil if none has been made yet
+func (o *Oracle) Latest() *Estimate {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return o.latest
+}
+
+func (o *Oracle) sampleL1() error {
+	if o.running {
+		if len(o.l1Samples) == 0 {
+			return ErrNoL1GasPrice
+		}
+		return nil
+	}
+	if len(o.l1Samples) > 0 && time.Since(o.lastSample) < l1SampleInterval {
+		return nil
+	}
+
+	price, err := o.l1GasPrice()
+	if err != nil {
+		if len(o.l1Samples) == 0 {
+			return fmt.Errorf("%w: %v", ErrNoL1GasPrice, err)
+		}
+		// keep pricing from the samples we have rather than failing every request while the L1 is unavailable
+		log.Warn("[fee-oracle] Failed to sample the L1 gas price, using previous samples", "err", err)
+		return nil
+	}
+	o.addL1Sample(price)
+
+	return nil
+}
+
+func (o *Oracle) addL1Sample(price *big.Int) {
+	o.l1Samples = append(o.l1Samples, price)
+	if len(o.l1Samples) > o.cfg.L1Samples {
+		o.l1Samples = o.l1Samples[len(o.l1Samples)-o.cfg.L1Samples:]
+	}
+	o.lastSample = time.Now()
+}
+
+func (o *Oracle) averageL1GasPrice() *big.Int {
+	sum := new(big.Int)
+	for _, s := range o.l1Samples {
+		sum.Add(sum, s)
+	}
+	return sum.Div(sum, big.NewInt(int64(len(o.l1Samples))))
+}
+
+// batchSaturation returns the average over the window of the saturation of each batch, the saturation of a batch
+// being the usage of its fullest counter
+func (o *Oracle) batchSaturation(reader BatchCountersReader, lastClosedBatch uint64) (float64, error) {
+	if reader == nil || o.cfg.BatchWindow <= 0 || lastClosedBatch == 0 {
+		return 0, nil
+	}
+
+	var total float64
+	var batches int
+	for i := 0; i < o.cfg.BatchWindow && uint64(i) < lastClosedBatch; i++ {
+		batchNo := lastClosedBatch - uint64(i)
+		used, found, err := reader.GetLatestBatchCounters(batchNo)
+		if err != nil {
+			return 0, err
+		}
+		if !found || len(used) == 0 {
+			continue
+		}
+		forkId, err := reader.GetForkId(batchNo)
+		if err != nil {
+			return 0, err
+		}
+		total += CounterSaturation(used, vm.GetCounterLimits(uint16(forkId)))
+		batches++
+	}
+
+	if batches == 0 {
+		return 0, nil
+	}
+	return total / float64(batches), nil
+}
+
+// CounterSaturation returns the highest ratio of used to limit across the counters
+func CounterSaturation(used []int, limits vm.Counters) float64 {
+	var saturation float64
+	for i, u := range used {
+		if i >= len(limits) || limits[i] == nil || limits[i].Limit() <= 0 {
+			continue
+		}
+		if s := float64(u) / float64(limits[i].Limit()); s > saturation {
+			saturation = s
+		}
+	}
+	return saturation
+}
+
+func (o *Oracle) congestionMultiplier(saturation float64) float64 {
+	target := o.cfg.SaturationTarget
+	if saturation <= target || target >= 1 {
+		return 1
+	}
+	if saturation > 1 {
+		saturation = 1
+	}
+	return 1 + (o.cfg.MaxMultiplier-1)*(saturation-target)/(1-target)
+}
+
+// BreakEvenGasPrice returns the gas price at which the transaction pays for its own L1 data and its L2 execution at
+// the suggested price
+func (e *Estimate) BreakEvenGasPrice(encodedTx []byte, gas uint64) *big.Int {
+	if gas == 0 {
+		return new(big.Int).Set(e.GasPrice)
+	}
+
+	var dataGas int64
+	for _, b := range encodedTx {
+		if b == 0 {
+			dataGas += zeroByteGas
+		} else {
+			dataGas += nonZeroByteGas
+		}
+	}
+
+	total := new(big.Int).Mul(e.L1GasPrice, big.NewInt(dataGas))
+	total.Add(total, new(big.Int).Mul(e.GasPrice, new(big.Int).SetUint64(gas)))
+
+	// round up so the break even price always covers the cost
+	gasBig := new(big.Int).SetUint64(gas)
+	breakEven, rem := new(big.Int).QuoRem(total, gasBig, new(big.Int))
+	if rem.Sign() > 0 {
+		breakEven.Add(breakEven, big.NewInt(1))
+	}
+	return breakEven
+}
+
+// EffectiveGasPricePercentage returns the effective gas price percentage for a transaction, the transaction pays
+// gasPrice * (percentage + 1) / 256 so the percentage is the smallest one that still covers the break even price.
+// The gas limit of the transaction is used for the L2 gas as the percentage is needed before execution.
+func (e *Estimate) EffectiveGasPricePercentage(tx types.Transaction) uint8 {
+	gasPrice := tx.GetPrice()
+	if gasPrice == nil || gasPrice.IsZero() {
+		return maxEffectivePercentage
+	}
+
+	var buf bytes.Buffer
+	if err := tx.MarshalBinary(&buf); err != nil {
+		return maxEffectivePercentage
+	}
+
+	return EffectivePercentage(e.BreakEvenGasPrice(buf.Bytes(), tx.GetGas()), gasPrice.ToBig())
+}
+
+// EffectivePercentage returns the smallest percentage for which gasPrice * (percentage + 1) / 256 >= breakEven
+func EffectivePercentage(breakEven, gasPrice *big.Int) uint8 {
+	if gasPrice.Sign() <= 0 || breakEven.Cmp(gasPrice) >= 0 {
+		return maxEffectivePercentage
+	}
+
+	// ceil(breakEven * 256 / gasPrice) - 1
+	num := new(big.Int).Mul(breakEven, big.NewInt(maxEffectivePercentage+1))
+	pct, rem := new(big.Int).QuoRem(num, gasPrice, new(big.Int))
+	if rem.Sign() > 0 {
+		pct.Add(pct, big.NewInt(1))
+	}
+	pct.Sub(pct, big.NewInt(1))
+
+	if pct.Sign() < 0 {
+		return 0
+	}
+	if pct.Cmp(big.NewInt(maxEffectivePercentage)) > 0 {
+		return maxEffectivePercentage
+	}
+	return uint8(pct.Uint64())
+}
@@ -0,0 +1,222 @@
+package fee_oracle
+
+import (
+	"context"
+	"errors"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/ledgerwatch/erigon/core/vm"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type testBatchCounters struct {
+	counters map[uint64][]int
+}
+
+func (t *testBatchCounters) GetLatestBatchCounters(batchNumber uint64) ([]int, bool, error) {
+	c, ok := t.counters[batchNumber]
+	return c, ok, nil
+}
+
+func (t *testBatchCounters) GetForkId(uint64) (uint64, error) {
+	return 9, nil
+}
+
+// usedAt returns counters using the given fraction of the fork 9 steps limit and nothing else
+func usedAt(fraction float64) []int {
+	limits := vm.GetCounterLimits(9)
+	used := make([]int, len(limits))
+	used[vm.S] = int(fraction * float64(limits[vm.S].Limit()))
+	return used
+}
+
+func testConfig() Config {
+	return Config{
+		DefaultGasPrice:  1_000,
+		GasPriceFactor:   0.5,
+		L1Samples:        3,
+		BatchWindow:      2,
+		SaturationTarget: 0.5,
+		MaxMultiplier:    3,
+	}
+}
+
+func TestCongestionMultiplier(t *testing.T) {
+	o := NewOracle(testConfig(), nil)
+
+	scenarios := map[string]struct {
+		saturation float64
+		expected   float64
+	}{
+		"empty":        {saturation: 0, expected: 1},
+		"at target":    {saturation: 0.5, expected: 1},
+		"half way":     {saturation: 0.75, expected: 2},
+		"full":         {saturation: 1, expected: 3},
+		"over the top": {saturation: 1.5, expected: 3},
+	}
+
+	for name, s := range scenarios {
+		t.Run(name, func(t *testing.T) {
+			assert.InDelta(t, s.expected, o.congestionMultiplier(s.saturation), 1e-9)
+		})
+	}
+}
+
+func TestEffectivePercentage(t *testing.T) {
+	scenarios := map[string]struct {
+		breakEven int64
+		gasPrice  int64
+		expected  uint8
+	}{
+		"break even above price": {breakEven: 200, gasPrice: 100, expected: 255},
+		"break even at price":    {breakEven: 100, gasPrice: 100, expected: 255},
+		"half":                   {breakEven: 50, gasPrice: 100, expected: 127},
+		"rounds up":              {breakEven: 51, gasPrice: 100, expected: 130},
+		"nothing to cover":       {breakEven: 0, gasPrice: 100, expected: 0},
+		"zero price":             {breakEven: 10, gasPrice: 0, expected: 255},
+	}
+
+	for name, s := range scenarios {
+		t.Run(name, func(t *testing.T) {
+			pct := EffectivePercentage(big.NewInt(s.breakEven), big.NewInt(s.gasPrice))
+			assert.Equal(t, s.expected, pct)
+
+			// the percentage must always cover the break even price
+			if s.gasPrice > 0 && s.breakEven < s.gasPrice {
+				paid := s.gasPrice * (int64(pct) + 1) / 256
+				assert.GreaterOrEqual(t, paid, s.breakEven)
+			}
+		})
+	}
+}
+
+func TestBreakEvenGasPrice(t *testing.T) {
+	e := &Estimate{L1GasPrice: big.NewInt(10), GasPrice: big.NewInt(100)}
+
+	// 2 zero bytes and 1 non-zero byte cost 2*4 + 16 = 24 gas on the L1, so 240 wei spread over 21000 gas rounds up to 1
+	assert.Equal(t, big.NewInt(101), e.BreakEvenGasPrice([]byte{0, 0, 1}, 21000))
+	assert.Equal(t, big.NewInt(100), e.BreakEvenGasPrice(nil, 21000))
+	assert.Equal(t, big.NewInt(100), e.BreakEvenGasPrice([]byte{1}, 0))
+}
+
+func TestEstimate(t *testing.T) {
+	l1Prices := []*big.Int{big.NewInt(10_000), big.NewInt(20_000)}
+	calls := 0
+	l1 := func() (*big.Int, error) {
+		if calls >= len(l1Prices) {
+			return nil, errors.New("l1 unavailable")
+		}
+		p := l1Prices[calls]
+		calls++
+		return p, nil
+	}
+
+	o := NewOracle(testConfig(), l1)
+	reader := &testBatchCounters{counters: map[uint64][]int{
+		3: usedAt(0.5),
+		4: usedAt(1),
+		5: usedAt(1),
+	}}
+
+	// batches 4 and 5 are full: multiplier is 3 and the price is 0.5 * 10000 * 3
+	estimate, err := o.Estimate(reader, 5)
+	require.NoError(t, err)
+	assert.Equal(t, big.NewInt(10_000), estimate.L1GasPrice)
+	assert.Equal(t, big.NewInt(160_000), estimate.L1DataCostPerByte)
+	assert.InDelta(t, 1, estimate.BatchSaturation, 1e-3)
+	assert.InDelta(t, 3, estimate.CongestionMultiplier, 1e-2)
+	assert.InDelta(t, 15_000, estimate.GasPrice.Int64(), 50)
+	assert.Equal(t, estimate, o.Latest())
+
+	// the L1 is sampled again once the interval has passed and averaged, batches 3 and 4 average 0.75 saturation
+	o.lastSample = o.lastSample.Add(-l1SampleInterval)
+	estimate, err = o.Estimate(reader, 4)
+	require.NoError(t, err)
+	assert.Equal(t, big.NewInt(15_000), estimate.L1GasPrice)
+	assert.InDelta(t, 0.75, estimate.BatchSaturation, 1e-3)
+	assert.InDelta(t, 2, estimate.CongestionMultiplier, 1e-2)
+
+	// a failing L1 keeps the previous samples
+	o.lastSample = o.lastSample.Add(-l1SampleInterval)
+	estimate, err = o.Estimate(reader, 2)
+	require.NoError(t, err)
+	assert.Equal(t, big.NewInt(15_000), estimate.L1GasPrice)
+	assert.Equal(t, float64(0), estimate.BatchSaturation)
+	assert.Equal(t, big.NewInt(7_500), estimate.GasPrice)
+}
+
+func TestEstimateLimits(t *testing.T) {
+	cfg := testConfig()
+	cfg.MaxGasPrice = 4_000
+
+	o := NewOracle(cfg, func() (*big.Int, error) { return big.NewInt(100), nil })
+
+	// 0.5 * 100 is below the default gas price so the floor applies
+	estimate, err := o.Estimate(nil, 0)
+	require.NoError(t, err)
+	assert.Equal(t, big.NewInt(1_000), estimate.GasPrice)
+
+	// the floor is still scaled by congestion but capped at the max gas price
+	reader := &testBatchCounters{counters: map[uint64][]int{1: usedAt(1)}}
+	estimate, err = o.Estimate(reader, 1)
+	require.NoError(t, err)
+	assert.InDelta(t, 3_000, estimate.GasPrice.Int64(), 10)
+
+	o.cfg.MaxMultiplier = 10
+	estimate, err = o.Estimate(reader, 1)
+	require.NoError(t, err)
+	assert.Equal(t, big.NewInt(4_000), estimate.GasPrice)
+}
+
+func TestEstimateNoL1(t *testing.T) {
+	o := NewOracle(testConfig(), func() (*big.Int, error) { return nil, errors.New("l1 unavailable") })
+
+	_, err := o.Estimate(nil, 0)
+	require.ErrorIs(t, err, ErrNoL1GasPrice)
+	assert.Nil(t, o.Latest())
+}
+
+func TestEstimateRunning(t *testing.T) {
+	sampled := make(chan struct{})
+	unblock := make(chan struct{})
+	calls := 0
+	l1 := func() (*big.Int, error) {
+		calls++
+		if calls == 1 {
+			close(sampled)
+			return big.NewInt(10_000), nil
+		}
+		// a slow L1 must not hold up the estimates
+		<-unblock
+		return nil, errors.New("l1 unavailable")
+	}
+
+	o := NewOracle(testConfig(), l1)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		o.Run(ctx)
+		close(done)
+	}()
+	<-sampled
+
+	require.Eventually(t, func() bool {
+		estimate, err := o.Estimate(nil, 0)
+		return err == nil && estimate.L1GasPrice.Cmp(big.NewInt(10_000)) == 0
+	}, time.Second, 10*time.Millisecond)
+
+	// estimates keep using the samples of Run even once they are stale
+	o.mu.Lock()
+	o.lastSample = o.lastSample.Add(-l1SampleInterval)
+	o.mu.Unlock()
+	estimate, err := o.Estimate(nil, 0)
+	require.NoError(t, err)
+	assert.Equal(t, big.NewInt(10_000), estimate.L1GasPrice)
+
+	cancel()
+	close(unblock)
+	<-done
+}
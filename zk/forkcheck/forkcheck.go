@@ -0,0 +1,413 @@
+package forkcheck
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"github.com/ledgerwatch/erigon-lib/chain"
+	"github.com/ledgerwatch/erigon-lib/common"
+	"github.com/ledgerwatch/erigon-lib/kv"
+	"github.com/ledgerwatch/erigon/eth/ethconfig"
+	"github.com/ledgerwatch/erigon/zk/hermez_db"
+	"github.com/ledgerwatch/erigon/zk/syncer"
+)
+
+// The cross checks of the fork schedule between the config, the database and the L1
+const (
+	// CheckForkOrder a fork never activates before the forks below it
+	CheckForkOrder = "fork-order"
+	// CheckForkBlock a fork pinned to a block in the chain config activated at that block in the database
+	CheckForkBlock = "fork-block"
+	// CheckForkBatch the first block of a fork starts a batch of that fork and the batches follow the fork history
+	CheckForkBatch = "fork-batch"
+	// CheckForkHistory the fork history only goes up and ends at the fork of the rollup on the L1
+	CheckForkHistory = "fork-history"
+	// CheckRollupType the rollup types the node knows are the ones of the rollup manager, with the same fork ids
+	CheckRollupType = "rollup-type"
+	// CheckRollup the rollup on the L1 is the configured contract of the configured chain and the node isn't ahead of it
+	CheckRollup = "rollup"
+	// CheckUnsupportedFork every fork id the node is configured, synced or asked to run is one it can execute
+	CheckUnsupportedFork = "unsupported-fork"
+)
+
+// L1 reads the rollup manager, *syncer.L1Syncer satisfies it
+type L1 interface {
+	CallRollupManager(ctx context.Context, addr *common.Address) (common.Address, error)
+	CallRollupTypeCount(ctx context.Context, addr *common.Address) (uint64, error)
+	CallRollupType(ctx context.Context, addr *common.Address, rollupType uint64) (*syncer.RollupType, error)
+	CallRollupData(ctx context.Context, addr *common.Address, rollupId uint64) (*syncer.RollupData, error)
+}
+
+// Report is the effective fork schedule of a node and everything in it that doesn't add up
+type Report struct {
+	ChainName     string              `json:"chainName"`
+	ChainId       uint64              `json:"chainId"`
+	RollupId      uint64              `json:"rollupId"`
+	RollupManager *common.Address     `json:"rollupManager,omitempty"`
+	Forks         []*Fork             `json:"forks"`
+	ForkHistory   []*ForkHistoryEntry `json:"forkHistory,omitempty"`
+	RollupTypes   []*RollupType       `json:"rollupTypes,omitempty"`
+	Rollup        *syncer.RollupData  `json:"rollup,omitempty"`
+	Mismatches    []*Mismatch         `json:"mismatches"`
+}
+
+// Fork is where a fork activates, the config block is only set when the chain config pins it
+type Fork struct {
+	ForkId      uint64  `json:"forkId"`
+	ConfigBlock *uint64 `json:"configBlock,omitempty"`
+	DbBlock     *uint64 `json:"dbBlock,omitempty"`
+	FirstBatch  *uint64 `json:"firstBatch,omitempty"`
+}
+
+// ForkHistoryEntry is a fork the rollup moved to on the L1, it applies to the batches after the last verified one
+type ForkHistoryEntry struct {
+	ForkId            uint64 `json:"forkId"`
+	LastVerifiedBatch uint64 `json:"lastVerifiedBatch"`
+}
+
+type RollupType struct {
+	Id       uint64  `json:"id"`
+	DbForkId *uint64 `json:"dbForkId,omitempty"`
+	L1ForkId *uint64 `json:"l1ForkId,omitempty"`
+	Obsolete bool    `json:"obsolete,omitempty"`
+}
+
+type Mismatch struct {
+	Check  string `json:"check"`
+	Detail string `json:"detail"`
+}
+
+func (m *Mismatch) String() string {
+	return fmt.Sprintf("[%s] %s", m.Check, m.Detail)
+}
+
+type checker struct {
+	ctx      context.Context
+	chainCfg *chain.Config
+	zkCfg    *ethconfig.Zk
+	hermezDb *hermez_db.HermezDbReader
+	l1       L1
+
+	report      *Report
+	forks       map[uint64]*Fork
+	rollupTypes map[uint64]*RollupType
+	unsupported map[uint64]bool
+
+	// the fork of the highest batch the node has, 0 without a database
+	latestBatchForkId uint64
+	// only the sequencer syncs the rollup types from the L1
+	syncsRollupTypes bool
+}
+
+func (c *checker) mismatch(check, format string, args ...interface{}) {
+	c.report.Mismatches = append(c.report.Mismatches, &Mismatch{Check: check, Detail: fmt.Sprintf(format, args...)})
+}
+
+func (c *checker) fork(forkId uint64) *Fork {
+	f, ok := c.forks[forkId]
+	if !ok {
+		f = &Fork{ForkId: forkId}
+		c.forks[forkId] = f
+	}
+	return f
+}
+
+func (c *checker) rollupType(id uint64) *RollupType {
+	t, ok := c.rollupTypes[id]
+	if !ok {
+		t = &RollupType{Id: id}
+		c.rollupTypes[id] = t
+	}
+	return t
+}
+
+func (c *checker) checkSupported(forkId uint64, where string) {
+	if c.unsupported[forkId] {
+		return
+	}
+	for _, supported := range chain.ForkIdsOrdered {
+		if uint64(supported) == forkId {
+			return
+		}
+	}
+	c.unsupported[forkId] = true
+	c.mismatch(CheckUnsupportedFork, "fork %d of %s is not supported", forkId, where)
+}
+
+// Check cross checks the fork schedule of the chain config against the database and the rollup manager on the L1.
+// tx and l1 can be nil to skip the checks that need them.
+func Check(ctx context.Context, chainCfg *chain.Config, zkCfg *ethconfig.Zk, tx kv.Tx, l1 L1) (*Report, error) {
+	c := &checker{
+		ctx:         ctx,
+		chainCfg:    chainCfg,
+		zkCfg:       zkCfg,
+		l1:          l1,
+		report:      &Report{ChainName: chainCfg.ChainName, RollupId: zkCfg.L1RollupId, Mismatches: []*Mismatch{}},
+		forks:       make(map[uint64]*Fork),
+		rollupTypes: make(map[uint64]*RollupType),
+		unsupported: make(map[uint64]bool),
+	}
+	if chainCfg.ChainID != nil {
+		c.report.ChainId = chainCfg.ChainID.Uint64()
+	}
+
+	c.checkConfig()
+	if tx != nil {
+		c.hermezDb = hermez_db.NewHermezDbReader(tx)
+		if err := c.checkDb(tx); err != nil {
+			return nil, err
+		}
+	}
+	if l1 != nil {
+		if err := c.checkL1(); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, forkId := range sortedKeys(c.forks) {
+		c.report.Forks = append(c.report.Forks, c.forks[forkId])
+	}
+	for _, id := range sortedKeys(c.rollupTypes) {
+		c.report.RollupTypes = append(c.report.RollupTypes, c.rollupTypes[id])
+	}
+
+	return c.report, nil
+}
+
+func (c *checker) checkConfig() {
+	// chain.ForkIdsOrdered is highest first
+	blocks := make(map[uint64]uint64)
+	for i := len(chain.ForkIdsOrdered) - 1; i >= 0; i-- {
+		forkId := chain.ForkIdsOrdered[i]
+		block := c.chainCfg.ForkIdBlock(forkId)
+		if block == nil {
+			continue
+		}
+		blockNo := block.Uint64()
+		c.fork(uint64(forkId)).ConfigBlock = &blockNo
+		blocks[uint64(forkId)] = blockNo
+	}
+	c.checkOrder(blocks, "the chain config")
+}
+
+// checkOrder reports the forks activating before a lower one
+func (c *checker) checkOrder(blocks map[uint64]uint64, where string) {
+	forkIds := sortedKeys(blocks)
+	for i := 1; i < len(forkIds); i++ {
+		prev, forkId := forkIds[i-1], forkIds[i]
+		if blocks[forkId] < blocks[prev] {
+			c.mismatch(CheckForkOrder, "in %s fork %d activates at block %d, before fork %d at block %d", where, forkId, blocks[forkId], prev, blocks[prev])
+		}
+	}
+}
+
+func (c *checker) checkDb(tx kv.Tx) error {
+	forkBlocks, err := c.hermezDb.GetAllForkBlocks()
+	if err != nil {
+		return err
+	}
+	for _, forkId := range sortedKeys(forkBlocks) {
+		blockNo := forkBlocks[forkId]
+		f := c.fork(forkId)
+		f.DbBlock = &blockNo
+		c.checkSupported(forkId, "the database")
+		if f.ConfigBlock != nil && *f.ConfigBlock != blockNo {
+			c.mismatch(CheckForkBlock, "fork %d activates at block %d in the chain config but at block %d in the database", forkId, *f.ConfigBlock, blockNo)
+		}
+		if err := c.checkForkStart(f, blockNo); err != nil {
+			return err
+		}
+	}
+	c.checkOrder(forkBlocks, "the database")
+
+	rollupTypes, err := c.hermezDb.GetAllRollupTypes()
+	if err != nil {
+		return err
+	}
+	c.syncsRollupTypes = len(rollupTypes) > 0
+	for id, forkId := range rollupTypes {
+		forkId := forkId
+		c.rollupType(id).DbForkId = &forkId
+	}
+
+	if c.latestBatchForkId, err = latestBatchForkId(tx); err != nil {
+		return err
+	}
+
+	return c.checkForkHistory()
+}
+
+// checkForkStart checks the first block of a fork starts a batch of that fork after a batch of a lower one
+func (c *checker) checkForkStart(f *Fork, blockNo uint64) error {
+	if blockNo == 0 {
+		return nil
+	}
+	batchNo, found, err := c.hermezDb.CheckBatchNoByL2Block(blockNo)
+	if err != nil {
+		return err
+	}
+	if !found {
+		c.mismatch(CheckForkBatch, "first block %d of fork %d has no batch", blockNo, f.ForkId)
+		return nil
+	}
+	f.FirstBatch = &batchNo
+
+	batchForkId, err := c.hermezDb.GetForkId(batchNo)
+	if err != nil {
+		return err
+	}
+	if batchForkId != f.ForkId {
+		c.mismatch(CheckForkBatch, "first block %d of fork %d is in batch %d of fork %d", blockNo, f.ForkId, batchNo, batchForkId)
+	}
+
+	if blockNo == 1 {
+		return nil
+	}
+	prevBatchNo, found, err := c.hermezDb.CheckBatchNoByL2Block(blockNo - 1)
+	if err != nil || !found {
+		return err
+	}
+	if prevBatchNo == batchNo {
+		c.mismatch(CheckForkBatch, "fork %d starts at block %d in the middle of batch %d", f.ForkId, blockNo, batchNo)
+		return nil
+	}
+	prevForkId, err := c.hermezDb.GetForkId(prevBatchNo)
+	if err != nil {
+		return err
+	}
+	if prevForkId >= f.ForkId {
+		c.mismatch(CheckForkBatch, "fork %d starts at block %d but batch %d before it is already of fork %d", f.ForkId, blockNo, prevBatchNo, prevForkId)
+	}
+	return nil
+}
+
+func (c *checker) checkForkHistory() error {
+	forkIds, batches, err := c.hermezDb.GetAllForkHistory()
+	if err != nil {
+		return err
+	}
+
+	for i, forkId := range forkIds {
+		c.report.ForkHistory = append(c.report.ForkHistory, &ForkHistoryEntry{ForkId: forkId, LastVerifiedBatch: batches[i]})
+		if forkId == 0 {
+			c.mismatch(CheckForkHistory, "entry %d is for a rollup type the node doesn't know", i)
+			continue
+		}
+		c.checkSupported(forkId, "the fork history")
+		if i > 0 && (forkId < forkIds[i-1] || batches[i] < batches[i-1]) {
+			c.mismatch(CheckForkHistory, "entry %d moves from fork %d after batch %d back to fork %d after batch %d", i, forkIds[i-1], batches[i-1], forkId, batches[i])
+		}
+	}
+
+	// the batch after the last verified one of an entry is the first of its fork, unless a later entry moves on at the
+	// same batch
+	for i := range forkIds {
+		if i+1 < len(forkIds) && batches[i+1] == batches[i] {
+			continue
+		}
+		batchNo := batches[i] + 1
+		batchForkId, err := c.hermezDb.GetForkId(batchNo)
+		if err != nil {
+			return err
+		}
+		if batchForkId != 0 && batchForkId != forkIds[i] {
+			c.mismatch(CheckForkBatch, "batch %d is of fork %d but the fork history moves to fork %d after batch %d", batchNo, batchForkId, forkIds[i], batches[i])
+		}
+	}
+
+	return nil
+}
+
+func (c *checker) checkL1() error {
+	rollupManager := c.zkCfg.AddressRollup
+	if rollupManager == (common.Address{}) {
+		var err error
+		if rollupManager, err = c.l1.CallRollupManager(c.ctx, &c.zkCfg.AddressZkevm); err != nil {
+			return fmt.Errorf("failed to get the rollup manager of %s: %w", c.zkCfg.AddressZkevm, err)
+		}
+	}
+	c.report.RollupManager = &rollupManager
+
+	count, err := c.l1.CallRollupTypeCount(c.ctx, &rollupManager)
+	if err != nil {
+		return fmt.Errorf("failed to get the rollup type count: %w", err)
+	}
+	for id := uint64(1); id <= count; id++ {
+		rollupType, err := c.l1.CallRollupType(c.ctx, &rollupManager, id)
+		if err != nil {
+			return fmt.Errorf("failed to get rollup type %d: %w", id, err)
+		}
+		t := c.rollupType(id)
+		t.L1ForkId, t.Obsolete = &rollupType.ForkId, rollupType.Obsolete
+	}
+	for _, id := range sortedKeys(c.rollupTypes) {
+		t := c.rollupTypes[id]
+		switch {
+		case t.L1ForkId == nil:
+			c.mismatch(CheckRollupType, "rollup type %d is unknown to the rollup manager, which has %d", id, count)
+		case t.DbForkId == nil:
+			if c.syncsRollupTypes {
+				c.mismatch(CheckRollupType, "rollup type %d of fork %d is unknown to the node", id, *t.L1ForkId)
+			}
+		case *t.DbForkId != *t.L1ForkId:
+			c.mismatch(CheckRollupType, "rollup type %d is of fork %d in the database but of fork %d on the L1", id, *t.DbForkId, *t.L1ForkId)
+		}
+	}
+
+	rollup, err := c.l1.CallRollupData(c.ctx, &rollupManager, c.zkCfg.L1RollupId)
+	if err != nil {
+		return fmt.Errorf("failed to get rollup %d: %w", c.zkCfg.L1RollupId, err)
+	}
+	if rollup.RollupContract == (common.Address{}) {
+		c.mismatch(CheckRollup, "rollup %d does not exist on the rollup manager %s", c.zkCfg.L1RollupId, rollupManager)
+		return nil
+	}
+	c.report.Rollup = rollup
+
+	if rollup.RollupContract != c.zkCfg.AddressZkevm {
+		c.mismatch(CheckRollup, "rollup %d is the contract %s, not the configured %s", c.zkCfg.L1RollupId, rollup.RollupContract, c.zkCfg.AddressZkevm)
+	}
+	if rollup.ChainId != c.report.ChainId {
+		c.mismatch(CheckRollup, "rollup %d is chain %d, not chain %d of the chain config", c.zkCfg.L1RollupId, rollup.ChainId, c.report.ChainId)
+	}
+	if t, ok := c.rollupTypes[rollup.RollupTypeId]; !ok || t.L1ForkId == nil {
+		c.mismatch(CheckRollupType, "rollup %d is of rollup type %d which the rollup manager doesn't have", c.zkCfg.L1RollupId, rollup.RollupTypeId)
+	} else if *t.L1ForkId != rollup.ForkId {
+		c.mismatch(CheckRollupType, "rollup %d is on fork %d but its rollup type %d is of fork %d", c.zkCfg.L1RollupId, rollup.ForkId, rollup.RollupTypeId, *t.L1ForkId)
+	}
+	c.checkSupported(rollup.ForkId, "the rollup")
+
+	if c.latestBatchForkId > rollup.ForkId {
+		c.mismatch(CheckRollup, "the node is on fork %d, ahead of fork %d of the rollup", c.latestBatchForkId, rollup.ForkId)
+	}
+	if n := len(c.report.ForkHistory); n > 0 && c.report.ForkHistory[n-1].ForkId != rollup.ForkId {
+		c.mismatch(CheckForkHistory, "the fork history ends at fork %d but the rollup is on fork %d", c.report.ForkHistory[n-1].ForkId, rollup.ForkId)
+	}
+
+	return nil
+}
+
+// latestBatchForkId is the fork of the highest batch with a fork id
+func latestBatchForkId(tx kv.Tx) (uint64, error) {
+	c, err := tx.Cursor(hermez_db.FORKIDS)
+	if err != nil {
+		return 0, err
+	}
+	defer c.Close()
+
+	_, v, err := c.Last()
+	if err != nil || len(v) == 0 {
+		return 0, err
+	}
+	return hermez_db.BytesToUint64(v), nil
+}
+
+func sortedKeys[V any](m map[uint64]V) []uint64 {
+	keys := make([]uint64, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i] < keys[j] })
+	return keys
+}
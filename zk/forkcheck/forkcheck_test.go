@@ -0,0 +1,148 @@
+package forkcheck
+
+import (
+	"context"
+	"math/big"
+	"testing"
+
+	"github.com/ledgerwatch/erigon-lib/chain"
+	"github.com/ledgerwatch/erigon-lib/common"
+	"github.com/ledgerwatch/erigon-lib/kv"
+	"github.com/ledgerwatch/erigon-lib/kv/memdb"
+	"github.com/ledgerwatch/erigon/eth/ethconfig"
+	"github.com/ledgerwatch/erigon/zk/hermez_db"
+	"github.com/ledgerwatch/erigon/zk/syncer"
+	"github.com/stretchr/testify/require"
+)
+
+var (
+	rollupManager = common.HexToAddress("0x1")
+	rollup        = common.HexToAddress("0x2")
+)
+
+// simulatedL1 is a rollup manager with rollup types by id and a single rollup
+type simulatedL1 struct {
+	rollupTypes map[uint64]uint64
+	rollup      syncer.RollupData
+}
+
+func (l *simulatedL1) CallRollupManager(context.Context, *common.Address) (common.Address, error) {
+	return rollupManager, nil
+}
+
+func (l *simulatedL1) CallRollupTypeCount(context.Context, *common.Address) (uint64, error) {
+	return uint64(len(l.rollupTypes)), nil
+}
+
+func (l *simulatedL1) CallRollupType(_ context.Context, _ *common.Address, rollupType uint64) (*syncer.RollupType, error) {
+	return &syncer.RollupType{ForkId: l.rollupTypes[rollupType]}, nil
+}
+
+func (l *simulatedL1) CallRollupData(_ context.Context, _ *common.Address, rollupId uint64) (*syncer.RollupData, error) {
+	if rollupId != 1 {
+		return &syncer.RollupData{}, nil
+	}
+	data := l.rollup
+	return &data, nil
+}
+
+func newSimulatedL1() *simulatedL1 {
+	return &simulatedL1{
+		rollupTypes: map[uint64]uint64{1: 7, 2: 9},
+		rollup:      syncer.RollupData{RollupContract: rollup, ChainId: 2442, ForkId: 9, LastVerifiedBatch: 3, RollupTypeId: 2},
+	}
+}
+
+// writeSchedule writes blocks 1-2 in batches 1-2 of fork 7 and blocks 3-5 in batches 3-4 of fork 9, with the fork
+// history of a sequencer upgraded after batch 2
+func writeSchedule(t *testing.T, tx kv.RwTx) {
+	require.NoError(t, hermez_db.CreateHermezBuckets(tx))
+	hermezDb := hermez_db.NewHermezDb(tx)
+
+	batches := []uint64{1, 2, 3, 3, 4}
+	forks := map[uint64]uint64{1: 7, 2: 7, 3: 9, 4: 9}
+	for i, batchNo := range batches {
+		require.NoError(t, hermezDb.WriteBlockBatch(uint64(i+1), batchNo))
+	}
+	for batchNo, forkId := range forks {
+		require.NoError(t, hermezDb.WriteForkId(batchNo, forkId))
+	}
+	require.NoError(t, hermezDb.WriteForkIdBlockOnce(7, 1))
+	require.NoError(t, hermezDb.WriteForkIdBlockOnce(9, 3))
+
+	require.NoError(t, hermezDb.WriteRollupType(1, 7))
+	require.NoError(t, hermezDb.WriteRollupType(2, 9))
+	require.NoError(t, hermezDb.WriteNewForkHistory(7, 0))
+	require.NoError(t, hermezDb.WriteNewForkHistory(9, 2))
+}
+
+func checks(report *Report) []string {
+	names := make([]string, 0, len(report.Mismatches))
+	for _, m := range report.Mismatches {
+		names = append(names, m.Check)
+	}
+	return names
+}
+
+func TestCheck(t *testing.T) {
+	ctx := context.Background()
+	zkCfg := &ethconfig.Zk{L1RollupId: 1, AddressZkevm: rollup}
+	chainCfg := func() *chain.Config {
+		return &chain.Config{ChainName: "dynamic-test", ChainID: big.NewInt(2442), ForkID7EtrogBlock: big.NewInt(1)}
+	}
+
+	t.Run("consistent", func(t *testing.T) {
+		_, tx := memdb.NewTestTx(t)
+		writeSchedule(t, tx)
+
+		report, err := Check(ctx, chainCfg(), zkCfg, tx, newSimulatedL1())
+		require.NoError(t, err)
+		require.Empty(t, report.Mismatches)
+		require.Len(t, report.Forks, 2)
+		require.Equal(t, uint64(3), *report.Forks[1].FirstBatch)
+		require.Equal(t, rollupManager, *report.RollupManager)
+	})
+
+	t.Run("config only", func(t *testing.T) {
+		cfg := chainCfg()
+		cfg.ForkID88ElderberryBlock = big.NewInt(0)
+
+		report, err := Check(ctx, cfg, zkCfg, nil, nil)
+		require.NoError(t, err)
+		require.Equal(t, []string{CheckForkOrder}, checks(report))
+	})
+
+	t.Run("database", func(t *testing.T) {
+		_, tx := memdb.NewTestTx(t)
+		writeSchedule(t, tx)
+		hermezDb := hermez_db.NewHermezDb(tx)
+		// fork 9 starts with batch 3 but the batch is stored as fork 8
+		require.NoError(t, hermezDb.WriteForkId(3, 8))
+		cfg := chainCfg()
+		cfg.ForkID9Elderberry2Block = big.NewInt(4)
+
+		report, err := Check(ctx, cfg, zkCfg, tx, nil)
+		require.NoError(t, err)
+		require.Equal(t, []string{CheckForkBlock, CheckForkBatch, CheckForkBatch}, checks(report))
+	})
+
+	t.Run("l1", func(t *testing.T) {
+		_, tx := memdb.NewTestTx(t)
+		writeSchedule(t, tx)
+		l1 := newSimulatedL1()
+		l1.rollupTypes[3] = 12
+		l1.rollup.ChainId = 1
+		l1.rollup.ForkId = 7
+
+		report, err := Check(ctx, chainCfg(), zkCfg, tx, l1)
+		require.NoError(t, err)
+		require.Equal(t, []string{CheckRollupType, CheckRollup, CheckRollupType, CheckRollup, CheckForkHistory}, checks(report))
+	})
+
+	t.Run("unknown rollup", func(t *testing.T) {
+		report, err := Check(ctx, chainCfg(), &ethconfig.Zk{L1RollupId: 2, AddressZkevm: rollup}, nil, newSimulatedL1())
+		require.NoError(t, err)
+		require.Equal(t, []string{CheckRollup}, checks(report))
+		require.Nil(t, report.Rollup)
+	})
+}
@@ -52,6 +52,10 @@ const JUST_UNWOUND = "just_unwound"                                     // batch
 const PLAIN_STATE_VERSION = "plain_state_version"                       // batch number -> true
 const ERIGON_VERSIONS = "erigon_versions"                               // erigon version -> timestamp of startup
 const BATCH_ENDS = "batch_ends"                                         //
+const EXECUTOR_DIVERGENCES = "executor_divergences"                     // batch number -> executor divergence report json
+const BATCH_TRANSITIONS = "batch_transitions"                           // status, batch number -> l1 block and l1 tx hash
+const PRUNE_PROGRESS = "zk_prune_progress"                              // table name -> first block or batch number not pruned
+const SHADOW_FORK_SOURCE_BLOCKS = "shadow_fork_source_blocks"           // l2blockno -> last source block replayed by a shadow fork
 
 var HermezDbTables = []string{
 	L1VERIFICATIONS,
@@ -88,6 +92,10 @@ var HermezDbTables = []string{
 	PLAIN_STATE_VERSION,
 	ERIGON_VERSIONS,
 	BATCH_ENDS,
+	EXECUTOR_DIVERGENCES,
+	BATCH_TRANSITIONS,
+	PRUNE_PROGRESS,
+	SHADOW_FORK_SOURCE_BLOCKS,
 }
 
 type HermezDb struct {
@@ -699,6 +707,27 @@ func (db *HermezDb) WriteBlockBatch(l2BlockNo, batchNo uint64) error {
 	return db.tx.Put(BATCH_BLOCKS, Uint64ToBytes(batchNo), v)
 }
 
+// DeleteBatchBlock removes a block from the block numbers of a batch, the block -> batch record is left alone
+func (db *HermezDb) DeleteBatchBlock(batchNo, l2BlockNo uint64) error {
+	v, err := db.tx.GetOne(BATCH_BLOCKS, Uint64ToBytes(batchNo))
+	if err != nil {
+		return err
+	}
+
+	blocks := parseConcatenatedBlockNumbers(v)
+	remaining := make([]uint64, 0, len(blocks))
+	for _, b := range blocks {
+		if b != l2BlockNo {
+			remaining = append(remaining, b)
+		}
+	}
+
+	if len(remaining) == 0 {
+		return db.tx.Delete(BATCH_BLOCKS, Uint64ToBytes(batchNo))
+	}
+	return db.tx.Put(BATCH_BLOCKS, Uint64ToBytes(batchNo), concatenateBlockNumbers(remaining))
+}
+
 func (db *HermezDb) WriteGlobalExitRoot(ger common.Hash) error {
 	return db.tx.Put(GLOBAL_EXIT_ROOTS, ger.Bytes(), []byte{1})
 }
@@ -1189,6 +1218,12 @@ func (db *HermezDbReader) GetIntermediateTxStateRoot(l2BlockNo uint64, txHash co
 	if err != nil {
 		return common.Hash{}, err
 	}
+	// a root that is not there is zero unless it has been pruned
+	if data == nil {
+		if err := db.CheckPruned(INTERMEDIATE_TX_STATEROOTS, l2BlockNo); err != nil {
+			return common.Hash{}, err
+		}
+	}
 
 	return common.BytesToHash(data), nil
 }
@@ -1427,6 +1462,154 @@ func (db *HermezDbReader) GetWitness(batchNumber uint64) ([]byte, error) {
 	return v, nil
 }
 
+func (db *HermezDb) WriteExecutorDivergence(batchNumber uint64, report []byte) error {
+	return db.tx.Put(EXECUTOR_DIVERGENCES, Uint64ToBytes(batchNumber), report)
+}
+
+func (db *HermezDb) DeleteExecutorDivergences(fromBatchNum, toBatchNum uint64) error {
+	return db.deleteFromBucketWithUintKeysRange(EXECUTOR_DIVERGENCES, fromBatchNum, toBatchNum)
+}
+
+func (db *HermezDbReader) GetExecutorDivergence(batchNumber uint64) ([]byte, error) {
+	return db.tx.GetOne(EXECUTOR_DIVERGENCES, Uint64ToBytes(batchNumber))
+}
+
+// GetLatestExecutorDivergence returns the report of the highest batch that diverged from the executor
+func (db *HermezDbReader) GetLatestExecutorDivergence() (batchNumber uint64, report []byte, err error) {
+	c, err := db.tx.Cursor(EXECUTOR_DIVERGENCES)
+	if err != nil {
+		return 0, nil, err
+	}
+	defer c.Close()
+
+	k, v, err := c.Last()
+	if err != nil || k == nil {
+		return 0, nil, err
+	}
+	return BytesToUint64(k), v, nil
+}
+
+func (db *HermezDb) WriteShadowForkSourceBlock(l2BlockNo, sourceBlockNo uint64) error {
+	return db.tx.Put(SHADOW_FORK_SOURCE_BLOCKS, Uint64ToBytes(l2BlockNo), Uint64ToBytes(sourceBlockNo))
+}
+
+func (db *HermezDb) DeleteShadowForkSourceBlocks(fromBlockNum, toBlockNum uint64) error {
+	return db.deleteFromBucketWithUintKeysRange(SHADOW_FORK_SOURCE_BLOCKS, fromBlockNum, toBlockNum)
+}
+
+// GetShadowForkSourceBlock returns the last source block whose transactions were all replayed by a shadow fork up to
+// the l2 block, 0 if the block was not sequenced by a shadow fork
+func (db *HermezDbReader) GetShadowForkSourceBlock(l2BlockNo uint64) (uint64, error) {
+	v, err := db.tx.GetOne(SHADOW_FORK_SOURCE_BLOCKS, Uint64ToBytes(l2BlockNo))
+	if err != nil {
+		return 0, err
+	}
+	return BytesToUint64(v), nil
+}
+
+func batchTransitionKey(status types.BatchStatus, batchNo uint64) []byte {
+	return append([]byte{byte(status)}, Uint64ToBytes(batchNo)...)
+}
+
+func parseBatchTransition(k, v []byte) (*types.BatchTransition, error) {
+	if len(k) != 9 || len(v) != 40 {
+		return nil, fmt.Errorf("invalid batch transition entry")
+	}
+	return &types.BatchTransition{
+		Status:    types.BatchStatus(k[0]),
+		BatchNo:   BytesToUint64(k[1:]),
+		L1BlockNo: BytesToUint64(v[:8]),
+		L1TxHash:  common.BytesToHash(v[8:40]),
+	}, nil
+}
+
+func (db *HermezDb) WriteBatchTransition(transition *types.BatchTransition) error {
+	v := make([]byte, 0, 40)
+	v = append(v, Uint64ToBytes(transition.L1BlockNo)...)
+	v = append(v, transition.L1TxHash.Bytes()...)
+	return db.tx.Put(BATCH_TRANSITIONS, batchTransitionKey(transition.Status, transition.BatchNo), v)
+}
+
+// GetBatchTransition returns the transition to the status covering the batch, nil if the batch didn't reach it
+func (db *HermezDbReader) GetBatchTransition(status types.BatchStatus, batchNo uint64) (*types.BatchTransition, error) {
+	c, err := db.tx.Cursor(BATCH_TRANSITIONS)
+	if err != nil {
+		return nil, err
+	}
+	defer c.Close()
+
+	// the first transition at or above the batch covers it
+	k, v, err := c.Seek(batchTransitionKey(status, batchNo))
+	if err != nil || k == nil || k[0] != byte(status) {
+		return nil, err
+	}
+	return parseBatchTransition(k, v)
+}
+
+// GetBatchTransitionsFrom returns up to limit transitions to the status covering batchNo and the batches above it in
+// batch order, 0 for no limit
+func (db *HermezDbReader) GetBatchTransitionsFrom(status types.BatchStatus, batchNo uint64, limit int) ([]*types.BatchTransition, error) {
+	c, err := db.tx.Cursor(BATCH_TRANSITIONS)
+	if err != nil {
+		return nil, err
+	}
+	defer c.Close()
+
+	var transitions []*types.BatchTransition
+	for k, v, err := c.Seek(batchTransitionKey(status, batchNo)); k != nil && k[0] == byte(status); k, v, err = c.Next() {
+		if err != nil {
+			return nil, err
+		}
+		transition, err := parseBatchTransition(k, v)
+		if err != nil {
+			return nil, err
+		}
+		transitions = append(transitions, transition)
+		if limit > 0 && len(transitions) == limit {
+			break
+		}
+	}
+	return transitions, nil
+}
+
+// GetLatestBatchTransition returns the transition to the status of the highest batch, nil if there is none
+func (db *HermezDbReader) GetLatestBatchTransition(status types.BatchStatus) (*types.BatchTransition, error) {
+	c, err := db.tx.Cursor(BATCH_TRANSITIONS)
+	if err != nil {
+		return nil, err
+	}
+	defer c.Close()
+
+	// seek past the last possible key of the status and step back
+	k, v, err := c.Seek([]byte{byte(status) + 1})
+	if err != nil {
+		return nil, err
+	}
+	if k == nil {
+		k, v, err = c.Last()
+	} else {
+		k, v, err = c.Prev()
+	}
+	if err != nil || k == nil || k[0] != byte(status) {
+		return nil, err
+	}
+	return parseBatchTransition(k, v)
+}
+
+// DeleteBatchTransitionsAbove removes the transitions to the status of the batches above batchNo
+func (db *HermezDb) DeleteBatchTransitionsAbove(status types.BatchStatus, batchNo uint64) error {
+	transitions, err := db.GetBatchTransitionsFrom(status, batchNo+1, 0)
+	if err != nil {
+		return err
+	}
+	for _, transition := range transitions {
+		if err = db.tx.Delete(BATCH_TRANSITIONS, batchTransitionKey(status, transition.BatchNo)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 func (db *HermezDb) WriteBatchCounters(blockNumber uint64, counters []int) error {
 	countersJson, err := json.Marshal(counters)
 	if err != nil {
@@ -1440,6 +1623,9 @@ func (db *HermezDbReader) GetLatestBatchCounters(batchNumber uint64) (countersAr
 	if err != nil {
 		return nil, false, err
 	}
+	if len(batchBlockNumbers) == 0 {
+		return nil, false, nil
+	}
 
 	v, err := db.tx.GetOne(BATCH_COUNTERS, Uint64ToBytes(batchBlockNumbers[len(batchBlockNumbers)-1]))
 	if err != nil {
@@ -1678,6 +1864,24 @@ func (db *HermezDbReader) GetForkFromRollupType(rollupType uint64) (uint64, erro
 	return BytesToUint64(v), nil
 }
 
+func (db *HermezDbReader) GetAllRollupTypes() (map[uint64]uint64, error) {
+	c, err := db.tx.Cursor(ROllUP_TYPES_FORKS)
+	if err != nil {
+		return nil, err
+	}
+	defer c.Close()
+
+	rollupTypes := make(map[uint64]uint64)
+	for k, v, err := c.First(); k != nil; k, v, err = c.Next() {
+		if err != nil {
+			return nil, err
+		}
+		rollupTypes[BytesToUint64(k)] = BytesToUint64(v)
+	}
+
+	return rollupTypes, nil
+}
+
 func (db *HermezDb) WriteNewForkHistory(forkId, lastVerifiedBatch uint64) error {
 	cursor, err := db.tx.Cursor(FORK_HISTORY)
 	if err != nil {
@@ -9,6 +9,7 @@ import (
 	"github.com/ledgerwatch/erigon-lib/common"
 	"github.com/ledgerwatch/erigon-lib/kv"
 	"github.com/ledgerwatch/erigon-lib/kv/mdbx"
+	"github.com/ledgerwatch/erigon/zk/types"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -622,3 +623,58 @@ func TestDeleteForkId(t *testing.T) {
 		})
 	}
 }
+
+func TestBatchTransitions(t *testing.T) {
+	tx, cleanup := GetDbTx()
+	defer cleanup()
+	db := NewHermezDb(tx)
+
+	for _, transition := range []*types.BatchTransition{
+		{Status: types.BatchStatusVirtual, BatchNo: 5, L1BlockNo: 100, L1TxHash: common.HexToHash("0x1")},
+		{Status: types.BatchStatusVirtual, BatchNo: 9, L1BlockNo: 101, L1TxHash: common.HexToHash("0x2")},
+		{Status: types.BatchStatusVirtual, BatchNo: 12, L1BlockNo: 102, L1TxHash: common.HexToHash("0x3")},
+		{Status: types.BatchStatusVerified, BatchNo: 9, L1BlockNo: 103, L1TxHash: common.HexToHash("0x4")},
+	} {
+		require.NoError(t, db.WriteBatchTransition(transition))
+	}
+
+	// a transition covers the batches above the previous one
+	virtual, err := db.GetBatchTransition(types.BatchStatusVirtual, 6)
+	require.NoError(t, err)
+	assert.Equal(t, &types.BatchTransition{Status: types.BatchStatusVirtual, BatchNo: 9, L1BlockNo: 101, L1TxHash: common.HexToHash("0x2")}, virtual)
+
+	verified, err := db.GetBatchTransition(types.BatchStatusVerified, 10)
+	require.NoError(t, err)
+	assert.Nil(t, verified)
+
+	finalized, err := db.GetBatchTransition(types.BatchStatusFinalized, 1)
+	require.NoError(t, err)
+	assert.Nil(t, finalized)
+
+	latest, err := db.GetLatestBatchTransition(types.BatchStatusVirtual)
+	require.NoError(t, err)
+	assert.Equal(t, uint64(12), latest.BatchNo)
+	latest, err = db.GetLatestBatchTransition(types.BatchStatusVerified)
+	require.NoError(t, err)
+	assert.Equal(t, uint64(9), latest.BatchNo)
+	latest, err = db.GetLatestBatchTransition(types.BatchStatusFinalized)
+	require.NoError(t, err)
+	assert.Nil(t, latest)
+
+	transitions, err := db.GetBatchTransitionsFrom(types.BatchStatusVirtual, 6, 0)
+	require.NoError(t, err)
+	require.Len(t, transitions, 2)
+	assert.Equal(t, uint64(9), transitions[0].BatchNo)
+	assert.Equal(t, uint64(12), transitions[1].BatchNo)
+	transitions, err = db.GetBatchTransitionsFrom(types.BatchStatusVirtual, 0, 1)
+	require.NoError(t, err)
+	require.Len(t, transitions, 1)
+
+	require.NoError(t, db.DeleteBatchTransitionsAbove(types.BatchStatusVirtual, 9))
+	latest, err = db.GetLatestBatchTransition(types.BatchStatusVirtual)
+	require.NoError(t, err)
+	assert.Equal(t, uint64(9), latest.BatchNo)
+	verified, err = db.GetBatchTransition(types.BatchStatusVerified, 9)
+	require.NoError(t, err)
+	assert.NotNil(t, verified)
+}
@@ -0,0 +1,155 @@
+package hermez_db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+
+	"github.com/ledgerwatch/erigon-lib/common"
+)
+
+// ErrPruned is returned for the entries of the tables pruned by the zkevm.prune.* retention
+var ErrPruned = errors.New("has been pruned")
+
+// PruneMode is how many blocks or batches back from the tip the zk tables only needed near it are kept, 0 keeps
+// everything
+type PruneMode struct {
+	IntermediateTxStateRoots uint64 // blocks
+	BatchCounters            uint64 // blocks
+	SmtDepths                uint64 // blocks
+	L1BatchData              uint64 // batches
+	ExecutorDivergences      uint64 // batches
+}
+
+func (m PruneMode) Enabled() bool {
+	return m != PruneMode{}
+}
+
+type prunedTable struct {
+	table    string
+	distance uint64
+	byBatch  bool
+}
+
+func (m PruneMode) tables() []prunedTable {
+	return []prunedTable{
+		{table: INTERMEDIATE_TX_STATEROOTS, distance: m.IntermediateTxStateRoots},
+		{table: BATCH_COUNTERS, distance: m.BatchCounters},
+		{table: SMT_DEPTHS, distance: m.SmtDepths},
+		{table: L1_BATCH_DATA, distance: m.L1BatchData, byBatch: true},
+		{table: EXECUTOR_DIVERGENCES, distance: m.ExecutorDivergences, byBatch: true},
+	}
+}
+
+// PruneLimit is how many entries of a table a single prune deletes at most, so catching up on a long running node is
+// spread over many sync cycles
+const PruneLimit = 100_000
+
+// Prune deletes the entries older than their retention back from the head block and batch.  The last entry of a table is
+// never deleted, the sequencer resumes from the latest smt depth and the l1 recovery from the latest l1 batch data, and
+// the counters of the blocks of the head batch are always kept.
+func (db *HermezDb) Prune(ctx context.Context, mode PruneMode, headBlock, headBatch uint64, limit int) error {
+	for _, t := range mode.tables() {
+		head := headBlock
+		if t.byBatch {
+			head = headBatch
+		}
+		if t.distance == 0 || head <= t.distance {
+			continue
+		}
+		pruneTo := head - t.distance
+
+		if t.table == BATCH_COUNTERS {
+			firstBlock, found, err := db.GetLowestBlockInBatch(headBatch)
+			if err != nil {
+				return err
+			}
+			if found {
+				pruneTo = min(pruneTo, firstBlock)
+			}
+		}
+
+		if err := db.pruneTable(ctx, t.table, pruneTo, limit); err != nil {
+			return fmt.Errorf("prune %s: %w", t.table, err)
+		}
+	}
+	return nil
+}
+
+// PruneBatchWitnesses deletes the witnesses cached by older versions for the batches below pruneTo.  Nothing writes
+// them anymore, so they are pruned once by a migration rather than with the PruneMode.
+func (db *HermezDb) PruneBatchWitnesses(ctx context.Context, pruneTo uint64) error {
+	return db.pruneTable(ctx, BATCH_WITNESSES, pruneTo, math.MaxInt)
+}
+
+// pruneTable deletes the entries with keys starting with a block or batch number below pruneTo and records up to where
+// the table is pruned
+func (db *HermezDb) pruneTable(ctx context.Context, table string, pruneTo uint64, limit int) error {
+	c, err := db.tx.RwCursor(table)
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+
+	last, _, err := c.Last()
+	if err != nil || last == nil {
+		return err
+	}
+	pruneTo = min(pruneTo, BytesToUint64(last))
+
+	deleted := 0
+	for k, _, err := c.First(); k != nil; k, _, err = c.Next() {
+		if err != nil {
+			return err
+		}
+		number := BytesToUint64(k)
+		if number >= pruneTo {
+			break
+		}
+		if deleted >= limit {
+			// entries from here on are still there
+			pruneTo = number
+			break
+		}
+		select {
+		case <-ctx.Done():
+			return common.ErrStopped
+		default:
+		}
+		if err = c.DeleteCurrent(); err != nil {
+			return err
+		}
+		deleted++
+	}
+
+	prunedTo, err := db.GetPrunedTo(table)
+	if err != nil {
+		return err
+	}
+	if pruneTo <= prunedTo {
+		return nil
+	}
+	return db.tx.Put(PRUNE_PROGRESS, []byte(table), Uint64ToBytes(pruneTo))
+}
+
+// GetPrunedTo returns the block or batch number below which the entries of the table have been pruned, 0 if it never was
+func (db *HermezDbReader) GetPrunedTo(table string) (uint64, error) {
+	v, err := db.tx.GetOne(PRUNE_PROGRESS, []byte(table))
+	if err != nil {
+		return 0, err
+	}
+	return BytesToUint64(v), nil
+}
+
+// CheckPruned returns ErrPruned if the entries of the table for the block or batch number have been pruned
+func (db *HermezDbReader) CheckPruned(table string, number uint64) error {
+	prunedTo, err := db.GetPrunedTo(table)
+	if err != nil {
+		return err
+	}
+	if number < prunedTo {
+		return fmt.Errorf("%s %w below %d", table, ErrPruned, prunedTo)
+	}
+	return nil
+}
@@ -0,0 +1,98 @@
+package hermez_db
+
+import (
+	"context"
+	"testing"
+
+	"github.com/ledgerwatch/erigon-lib/common"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPrune(t *testing.T) {
+	tx, cleanup := GetDbTx()
+	defer cleanup()
+	db := NewHermezDb(tx)
+	ctx := context.Background()
+
+	// blocks 1 to 20 in batches of 5 blocks
+	for blockNo := uint64(1); blockNo <= 20; blockNo++ {
+		batchNo := (blockNo + 4) / 5
+		require.NoError(t, db.WriteBlockBatch(blockNo, batchNo))
+		require.NoError(t, db.WriteIntermediateTxStateRoot(blockNo, common.HexToHash("0x1"), common.HexToHash("0x2")))
+		require.NoError(t, db.WriteIntermediateTxStateRoot(blockNo, common.HexToHash("0x3"), common.HexToHash("0x4")))
+		require.NoError(t, db.WriteBatchCounters(blockNo, []int{1}))
+	}
+	for batchNo := uint64(1); batchNo <= 4; batchNo++ {
+		require.NoError(t, db.WriteL1BatchData(batchNo, []byte{1}))
+		require.NoError(t, db.WriteExecutorDivergence(batchNo, []byte("{}")))
+	}
+	require.NoError(t, db.WriteSmtDepth(3, 10))
+
+	mode := PruneMode{IntermediateTxStateRoots: 5, BatchCounters: 2, SmtDepths: 1, L1BatchData: 1, ExecutorDivergences: 2}
+
+	// the limit spreads the pruning of the intermediate roots over several calls
+	require.NoError(t, db.Prune(ctx, mode, 20, 4, 4))
+	prunedTo, err := db.GetPrunedTo(INTERMEDIATE_TX_STATEROOTS)
+	require.NoError(t, err)
+	require.Equal(t, uint64(3), prunedTo)
+	for i := 0; i < 10; i++ {
+		require.NoError(t, db.Prune(ctx, mode, 20, 4, 4))
+	}
+
+	prunedTo, err = db.GetPrunedTo(INTERMEDIATE_TX_STATEROOTS)
+	require.NoError(t, err)
+	require.Equal(t, uint64(15), prunedTo)
+	_, err = db.GetIntermediateTxStateRoot(14, common.HexToHash("0x1"))
+	require.ErrorIs(t, err, ErrPruned)
+	root, err := db.GetIntermediateTxStateRoot(15, common.HexToHash("0x3"))
+	require.NoError(t, err)
+	require.Equal(t, common.HexToHash("0x4"), root)
+	// a root never written above the pruned blocks is still zero
+	root, err = db.GetIntermediateTxStateRoot(15, common.HexToHash("0x5"))
+	require.NoError(t, err)
+	require.Equal(t, common.Hash{}, root)
+
+	// the counters of the head batch are kept
+	prunedTo, err = db.GetPrunedTo(BATCH_COUNTERS)
+	require.NoError(t, err)
+	require.Equal(t, uint64(16), prunedTo)
+	_, found, err := db.GetLatestBatchCounters(3)
+	require.NoError(t, err)
+	require.False(t, found)
+	_, found, err = db.GetLatestBatchCounters(4)
+	require.NoError(t, err)
+	require.True(t, found)
+
+	// the last smt depth is kept
+	closest, depth, err := db.GetClosestSmtDepth(20)
+	require.NoError(t, err)
+	require.Equal(t, uint64(3), closest)
+	require.Equal(t, uint64(10), depth)
+
+	prunedTo, err = db.GetPrunedTo(L1_BATCH_DATA)
+	require.NoError(t, err)
+	require.Equal(t, uint64(3), prunedTo)
+	data, err := db.GetL1BatchData(2)
+	require.NoError(t, err)
+	require.Empty(t, data)
+
+	prunedTo, err = db.GetPrunedTo(EXECUTOR_DIVERGENCES)
+	require.NoError(t, err)
+	require.Equal(t, uint64(2), prunedTo)
+	report, err := db.GetExecutorDivergence(1)
+	require.NoError(t, err)
+	require.Empty(t, report)
+	report, err = db.GetExecutorDivergence(2)
+	require.NoError(t, err)
+	require.NotEmpty(t, report)
+
+	prunedTo, err = db.GetPrunedTo(BATCH_WITNESSES)
+	require.NoError(t, err)
+	require.Zero(t, prunedTo)
+
+	// pruning less than before doesn't move the progress back
+	require.NoError(t, db.Prune(ctx, PruneMode{IntermediateTxStateRoots: 10}, 20, 4, PruneLimit))
+	prunedTo, err = db.GetPrunedTo(INTERMEDIATE_TX_STATEROOTS)
+	require.NoError(t, err)
+	require.Equal(t, uint64(15), prunedTo)
+}
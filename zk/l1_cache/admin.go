@@ -0,0 +1,179 @@
+package l1_cache
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ledgerwatch/erigon-lib/kv"
+)
+
+const defaultAdminListLimit = 100
+
+type CacheEntry struct {
+	Key     string     `json:"key"`
+	ChainId string     `json:"chainId"`
+	Method  string     `json:"method"`
+	Size    int        `json:"size"`
+	Expiry  *time.Time `json:"expiry,omitempty"`
+}
+
+// entryFilter matches cache entries by chain id and/or method, empty fields match everything
+type entryFilter struct {
+	chainID string
+	method  string
+}
+
+func filterFromRequest(r *http.Request) entryFilter {
+	q := r.URL.Query()
+	return entryFilter{chainID: q.Get("chainid"), method: q.Get("method")}
+}
+
+func parseCacheKey(key string) (chainID string, method string) {
+	idx := strings.Index(key, "_")
+	if idx < 0 {
+		return "", ""
+	}
+	chainID = key[:idx]
+	var request struct {
+		Method string `json:"method"`
+	}
+	if err := json.Unmarshal([]byte(key[idx+1:]), &request); err == nil {
+		method = request.Method
+	}
+	return chainID, method
+}
+
+func (f entryFilter) matches(chainID, method string) bool {
+	if f.chainID != "" && f.chainID != chainID {
+		return false
+	}
+	if f.method != "" && f.method != method {
+		return false
+	}
+	return true
+}
+
+// errLimitReached stops the iteration of the entries once the limit is reached
+var errLimitReached = errors.New("limit reached")
+
+// listEntries returns up to limit cached entries matching the filter
+func listEntries(tx kv.Tx, filter entryFilter, limit int) ([]CacheEntry, error) {
+	entries := make([]CacheEntry, 0)
+	err := tx.ForEach(bucketName, nil, func(k, v []byte) error {
+		if limit > 0 && len(entries) >= limit {
+			return errLimitReached
+		}
+		key := string(k)
+		entryChainID, entryMethod := parseCacheKey(key)
+		if !filter.matches(entryChainID, entryMethod) {
+			return nil
+		}
+		entry := CacheEntry{
+			Key:     key,
+			ChainId: entryChainID,
+			Method:  entryMethod,
+			Size:    len(v),
+		}
+		expiry, err := tx.GetOne(expiryBucket, k)
+		if err != nil {
+			return err
+		}
+		if expiry != nil {
+			if expiryTime, err := time.Parse(time.RFC3339Nano, string(expiry)); err == nil {
+				entry.Expiry = &expiryTime
+			}
+		}
+		entries = append(entries, entry)
+		return nil
+	})
+	if errors.Is(err, errLimitReached) {
+		err = nil
+	}
+	return entries, err
+}
+
+// purgeEntries removes every cached entry matching the filter and returns how many were removed
+func purgeEntries(tx kv.RwTx, filter entryFilter) (int, error) {
+	var toDelete []string
+	err := tx.ForEach(bucketName, nil, func(k, _ []byte) error {
+		entryChainID, entryMethod := parseCacheKey(string(k))
+		if filter.matches(entryChainID, entryMethod) {
+			toDelete = append(toDelete, string(k))
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	for _, key := range toDelete {
+		evictFromCache(tx, key)
+	}
+	return len(toDelete), nil
+}
+
+// handleAdminEntries lists cached entries: GET /admin/entries?chainid=&method=&limit=
+func (c *L1Cache) handleAdminEntries(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	limit := defaultAdminListLimit
+	if l := r.URL.Query().Get("limit"); l != "" {
+		parsed, err := strconv.Atoi(l)
+		if err != nil || parsed < 0 {
+			http.Error(w, "Invalid limit parameter", http.StatusBadRequest)
+			return
+		}
+		limit = parsed
+	}
+	filter := filterFromRequest(r)
+
+	tx, err := c.db.BeginRo(r.Context())
+	if err != nil {
+		http.Error(w, "Failed to begin transaction", http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+
+	entries, err := listEntries(tx, filter, limit)
+	if err != nil {
+		http.Error(w, "Failed to read cache entries", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(entries)
+}
+
+// handleAdminPurge removes cached entries: POST|DELETE /admin/purge?chainid=&method=
+func (c *L1Cache) handleAdminPurge(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost && r.Method != http.MethodDelete {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	filter := filterFromRequest(r)
+
+	tx, err := c.db.BeginRw(r.Context())
+	if err != nil {
+		http.Error(w, "Failed to begin transaction", http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+
+	purged, err := purgeEntries(tx, filter)
+	if err != nil {
+		http.Error(w, "Failed to purge cache entries", http.StatusInternalServerError)
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		http.Error(w, "Failed to commit purge", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]int{"purged": purged})
+}
@@ -7,13 +7,17 @@ import (
 	"fmt"
 	"io"
 	"net/http"
+	"strings"
 	"time"
 
 	"errors"
 
+	libcommon "github.com/ledgerwatch/erigon-lib/common"
 	"github.com/ledgerwatch/erigon-lib/kv"
 	"github.com/ledgerwatch/erigon-lib/kv/mdbx"
+	"github.com/ledgerwatch/erigon-lib/metrics"
 	"github.com/ledgerwatch/log/v3"
+	"golang.org/x/sync/singleflight"
 )
 
 const (
@@ -24,25 +28,103 @@ const (
 // methods we don't cache
 var methodsToIgnore = map[string]struct{}{}
 
-// methods we configure expiry for
+// default expiry per method, can be extended/overridden by the per-method ttl config.
+// keys are either a method name or "method:param" where param is one of paramsToExpire
 var methodsToExpire = map[string]time.Duration{
 	//"eth_getBlockByNumber": 1 * time.Minute, // example here but currently we don't want any methods to expire
 }
 
-// params that trigger expiration
+// defaultTagTTL is the expiry of a request for a block tag when no ttl is configured for it, about an L1 slot
+const defaultTagTTL = 12 * time.Second
+
+// params that trigger expiration, a request for one of these tags is never cached indefinitely
 var paramsToExpire = map[string]struct{}{
 	"latest":    {},
 	"finalized": {},
+	"safe":      {},
+	"pending":   {},
+}
+
+var (
+	cacheRequestsCounter = metrics.GetOrCreateCounter(`l1_cache_requests_total`)
+	upstreamErrorCounter = metrics.GetOrCreateCounter(`l1_cache_upstream_errors_total`)
+)
+
+func hitCounter(method string) metrics.Counter {
+	return metrics.GetOrCreateCounter(fmt.Sprintf(`l1_cache_hits_total{method="%s"}`, method))
+}
+
+func missCounter(method string) metrics.Counter {
+	return metrics.GetOrCreateCounter(fmt.Sprintf(`l1_cache_misses_total{method="%s"}`, method))
+}
+
+func coalescedCounter(method string) metrics.Counter {
+	return metrics.GetOrCreateCounter(fmt.Sprintf(`l1_cache_coalesced_total{method="%s"}`, method))
 }
 
 type L1Cache struct {
-	server *http.Server
-	db     kv.RwDB
+	server     *http.Server
+	admin      *http.Server
+	db         kv.RwDB
+	methodTTLs map[string]time.Duration
+	inflight   singleflight.Group
+	client     *http.Client
 }
 
-func NewL1Cache(ctx context.Context, dbPath string, port uint) (*L1Cache, error) {
+// NewL1Cache starts the cache server on the port. The admin endpoints are only served on a separate listener bound
+// to localhost when adminPort is set, as they can list and purge every entry.
+func NewL1Cache(ctx context.Context, dbPath string, port, adminPort uint, methodTTLs map[string]time.Duration) (*L1Cache, error) {
 	db := mdbx.NewMDBX(log.New()).Path(dbPath).MustOpen()
 
+	cache, err := newL1Cache(ctx, db, methodTTLs)
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	cache.server = newServer(fmt.Sprintf(":%d", port), cache.handler())
+	go serve(cache.server, "L1 Cache Server", port)
+
+	if adminPort != 0 {
+		cache.admin = newServer(fmt.Sprintf("127.0.0.1:%d", adminPort), cache.adminHandler())
+		go serve(cache.admin, "L1 Cache Admin Server", adminPort)
+	}
+
+	go func() {
+		<-ctx.Done()
+		log.Info("Shutting down L1 Cache Server...")
+		if err := cache.server.Shutdown(context.Background()); err != nil {
+			log.Error("Failed to shutdown L1 Cache Server", "error", err)
+		}
+		if cache.admin != nil {
+			if err := cache.admin.Shutdown(context.Background()); err != nil {
+				log.Error("Failed to shutdown L1 Cache Admin Server", "error", err)
+			}
+		}
+		db.Close()
+	}()
+
+	return cache, nil
+}
+
+func newServer(addr string, handler http.Handler) *http.Server {
+	return &http.Server{
+		Addr:           addr,
+		Handler:        handler,
+		ReadTimeout:    10 * time.Second,
+		WriteTimeout:   10 * time.Second,
+		MaxHeaderBytes: 1 << 20,
+	}
+}
+
+func serve(server *http.Server, name string, port uint) {
+	log.Info(fmt.Sprintf("Starting %s on port:", name), "port", port)
+	if err := server.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
+		log.Error(fmt.Sprintf("%s stopped", name), "error", err)
+	}
+}
+
+func newL1Cache(ctx context.Context, db kv.RwDB, methodTTLs map[string]time.Duration) (*L1Cache, error) {
 	tx, err := db.BeginRw(ctx)
 	if err != nil {
 		return nil, err
@@ -59,36 +141,131 @@ func NewL1Cache(ctx context.Context, dbPath string, port uint) (*L1Cache, error)
 		return nil, err
 	}
 
-	http.HandleFunc("/", handleRequest(db))
-	addr := fmt.Sprintf(":%d", port)
-	server := &http.Server{
-		Addr:           addr,
-		Handler:        nil,
-		ReadTimeout:    10 * time.Second,
-		WriteTimeout:   10 * time.Second,
-		MaxHeaderBytes: 1 << 20,
+	ttls := make(map[string]time.Duration, len(methodsToExpire)+len(methodTTLs))
+	for k, v := range methodsToExpire {
+		ttls[k] = v
+	}
+	for k, v := range methodTTLs {
+		ttls[k] = v
 	}
 
-	go func() {
-		log.Info("Starting L1 Cache Server on port:", "port", port)
-		if err := server.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
-			log.Error("L1 Cache Server stopped", "error", err)
+	return &L1Cache{
+		db:         db,
+		methodTTLs: ttls,
+		client:     &http.Client{Timeout: 30 * time.Second},
+	}, nil
+}
+
+func (c *L1Cache) handler() http.Handler {
+	return http.HandlerFunc(c.handleRequest)
+}
+
+func (c *L1Cache) adminHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/admin/entries", c.handleAdminEntries)
+	mux.HandleFunc("/admin/purge", c.handleAdminPurge)
+	return mux
+}
+
+// ParseMethodTTLs parses a comma separated list of method=duration pairs, e.g.
+// "eth_blockNumber=5s,eth_getBlockByNumber:latest=12s".  A method can be qualified with
+// a block tag to only apply the ttl when the first param of the request is that tag.
+func ParseMethodTTLs(value string) (map[string]time.Duration, error) {
+	result := make(map[string]time.Duration)
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return result, nil
+	}
+	for _, pair := range strings.Split(value, ",") {
+		parts := strings.SplitN(strings.TrimSpace(pair), "=", 2)
+		if len(parts) != 2 || parts[0] == "" {
+			return nil, fmt.Errorf("invalid method ttl %q, expected method=duration", pair)
 		}
-	}()
+		ttl, err := time.ParseDuration(parts[1])
+		if err != nil {
+			return nil, fmt.Errorf("invalid ttl for method %s: %w", parts[0], err)
+		}
+		if ttl < 0 {
+			return nil, fmt.Errorf("negative ttl for method %s", parts[0])
+		}
+		result[parts[0]] = ttl
+	}
+	return result, nil
+}
 
-	go func() {
-		<-ctx.Done()
-		log.Info("Shutting down L1 Cache Server...")
-		if err := server.Shutdown(context.Background()); err != nil {
-			log.Error("Failed to shutdown L1 Cache Server", "error", err)
+// rpcRequest is a single JSON-RPC request as it was sent to us, the id is kept raw so that
+// the response can be returned with exactly the id the client used
+type rpcRequest struct {
+	JsonRpc string          `json:"jsonrpc"`
+	Id      json.RawMessage `json:"id,omitempty"`
+	Method  string          `json:"method"`
+	Params  json.RawMessage `json:"params,omitempty"`
+}
+
+func (r *rpcRequest) cacheKey(chainID string) (string, error) {
+	// the id is deliberately left out so identical calls from different clients share an entry
+	params := r.Params
+	if len(params) > 0 {
+		compacted := new(bytes.Buffer)
+		if err := json.Compact(compacted, params); err != nil {
+			return "", err
 		}
-		db.Close()
-	}()
+		params = compacted.Bytes()
+	}
+	keyed := struct {
+		JsonRpc string          `json:"jsonrpc"`
+		Method  string          `json:"method"`
+		Params  json.RawMessage `json:"params,omitempty"`
+	}{r.JsonRpc, r.Method, params}
+	body, err := json.Marshal(keyed)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%s_%s", chainID, body), nil
+}
 
-	return &L1Cache{
-		server: server,
-		db:     db,
-	}, nil
+func (r *rpcRequest) firstParamTag() string {
+	var params []interface{}
+	if err := json.Unmarshal(r.Params, &params); err != nil || len(params) == 0 {
+		return ""
+	}
+	param, ok := params[0].(string)
+	if !ok {
+		return ""
+	}
+	if _, shouldExpire := paramsToExpire[param]; !shouldExpire {
+		return ""
+	}
+	return param
+}
+
+func (c *L1Cache) ttlFor(req *rpcRequest) time.Duration {
+	if tag := req.firstParamTag(); tag != "" {
+		if ttl, found := c.methodTTLs[req.Method+":"+tag]; found {
+			return ttl
+		}
+		// the result for a tag changes with every L1 block
+		return defaultTagTTL
+	}
+	return c.methodTTLs[req.Method]
+}
+
+type rpcResponse struct {
+	Id    json.RawMessage `json:"id"`
+	Error json.RawMessage `json:"error,omitempty"`
+}
+
+// withId replaces the id of a cached/shared response with the one from the current request
+func withId(response []byte, id json.RawMessage) ([]byte, error) {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(response, &fields); err != nil {
+		return nil, err
+	}
+	if len(id) == 0 {
+		id = json.RawMessage("null")
+	}
+	fields["id"] = id
+	return json.Marshal(fields)
 }
 
 func fetchFromCache(tx kv.RwTx, key string) ([]byte, bool) {
@@ -99,7 +276,7 @@ func fetchFromCache(tx kv.RwTx, key string) ([]byte, bool) {
 
 	expiry, err := tx.GetOne(expiryBucket, []byte(key))
 	if err == nil && expiry != nil {
-		expiryTime, err := time.Parse(time.RFC3339, string(expiry))
+		expiryTime, err := time.Parse(time.RFC3339Nano, string(expiry))
 		if err == nil && time.Now().After(expiryTime) {
 			// Cache entry has expired
 			evictFromCache(tx, key)
@@ -135,7 +312,7 @@ func saveToCache(tx kv.RwTx, key string, response []byte, duration time.Duration
 	}
 	// Only set expiry if duration is not zero (indicating that it should expire)
 	if duration > 0 {
-		expiryTime := time.Now().Add(duration).Format(time.RFC3339)
+		expiryTime := time.Now().Add(duration).Format(time.RFC3339Nano)
 		if err := tx.Put(expiryBucket, []byte(key), []byte(expiryTime)); err != nil {
 			return err
 		}
@@ -143,127 +320,300 @@ func saveToCache(tx kv.RwTx, key string, response []byte, duration time.Duration
 	return nil
 }
 
-func generateCacheKey(chainID string, body []byte) (string, error) {
-	var request map[string]interface{}
-	err := json.Unmarshal(body, &request)
+// lookup returns the cached responses for the given keys, a nil entry means a miss
+func (c *L1Cache) lookup(ctx context.Context, reqs []*rpcRequest, keys []string) ([][]byte, error) {
+	results := make([][]byte, len(reqs))
+	tx, err := c.db.BeginRw(ctx)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
-	delete(request, "id")
-	modifiedBody, err := json.Marshal(request)
+	defer tx.Rollback()
+	for i, req := range reqs {
+		if _, ignore := methodsToIgnore[req.Method]; ignore {
+			continue
+		}
+		if cached, found := fetchFromCache(tx, keys[i]); found {
+			// copy as the value is only valid for the lifetime of the transaction
+			results[i] = libcommon.Copy(cached)
+		}
+	}
+	// commit as lookups can evict expired entries
+	return results, tx.Commit()
+}
+
+func (c *L1Cache) store(ctx context.Context, reqs []*rpcRequest, keys []string, responses [][]byte) error {
+	tx, err := c.db.BeginRw(ctx)
 	if err != nil {
-		return "", err
+		return err
 	}
-	return fmt.Sprintf("%s_%s", chainID, modifiedBody), nil
+	defer tx.Rollback()
+	for i, req := range reqs {
+		if _, ignore := methodsToIgnore[req.Method]; ignore {
+			continue
+		}
+		var parsed rpcResponse
+		if err := json.Unmarshal(responses[i], &parsed); err != nil {
+			log.Warn("Failed to parse upstream response, not caching", "method", req.Method, "error", err)
+			continue
+		}
+		if len(parsed.Error) > 0 && string(parsed.Error) != "null" {
+			log.Warn("Received error response from upstream, not caching", "method", req.Method, "error", string(parsed.Error))
+			continue
+		}
+		if err := saveToCache(tx, keys[i], responses[i], c.ttlFor(req)); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
 }
 
-func handleRequest(db kv.RwDB) http.HandlerFunc {
-	return func(w http.ResponseWriter, r *http.Request) {
-		endpoint := r.URL.Query().Get("endpoint")
-		chainID := r.URL.Query().Get("chainid")
-		if endpoint == "" || chainID == "" {
-			http.Error(w, "Missing endpoint or chainid parameter", http.StatusBadRequest)
-			return
+type upstreamResult struct {
+	status int
+	body   []byte
+}
+
+// fetchUpstream sends the body to the endpoint, identical concurrent calls (by key) share a single
+// upstream request
+func (c *L1Cache) fetchUpstream(endpoint, key string, body []byte) (*upstreamResult, bool, error) {
+	res, err, shared := c.inflight.Do(endpoint+"|"+key, func() (interface{}, error) {
+		resp, err := c.client.Post(endpoint, "application/json", bytes.NewBuffer(body))
+		if err != nil {
+			return nil, err
+		}
+		defer resp.Body.Close()
+		responseBody, err := io.ReadAll(resp.Body)
+		if err != nil {
+			return nil, err
 		}
+		return &upstreamResult{status: resp.StatusCode, body: responseBody}, nil
+	})
+	if err != nil {
+		upstreamErrorCounter.Inc()
+		return nil, shared, err
+	}
+	return res.(*upstreamResult), shared, nil
+}
+
+func (c *L1Cache) handleRequest(w http.ResponseWriter, r *http.Request) {
+	endpoint := r.URL.Query().Get("endpoint")
+	chainID := r.URL.Query().Get("chainid")
+	if endpoint == "" || chainID == "" {
+		http.Error(w, "Missing endpoint or chainid parameter", http.StatusBadRequest)
+		return
+	}
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, "Failed to read request body", http.StatusInternalServerError)
+		return
+	}
+	defer r.Body.Close()
+
+	cacheRequestsCounter.Inc()
+
+	trimmed := bytes.TrimSpace(body)
+	if len(trimmed) > 0 && trimmed[0] == '[' {
+		c.handleBatch(w, r, endpoint, chainID, trimmed)
+		return
+	}
 
-		body, err := io.ReadAll(r.Body)
+	var request rpcRequest
+	if err := json.Unmarshal(body, &request); err != nil {
+		http.Error(w, "Invalid JSON-RPC request", http.StatusBadRequest)
+		return
+	}
+	if request.Method == "" {
+		http.Error(w, "Invalid JSON-RPC method", http.StatusBadRequest)
+		return
+	}
+
+	cacheKey, err := request.cacheKey(chainID)
+	if err != nil {
+		http.Error(w, "Failed to generate cache key", http.StatusInternalServerError)
+		return
+	}
+	reqs, keys := []*rpcRequest{&request}, []string{cacheKey}
+
+	cached, err := c.lookup(r.Context(), reqs, keys)
+	if err != nil {
+		http.Error(w, "Failed to read from cache", http.StatusInternalServerError)
+		return
+	}
+	if cached[0] != nil {
+		response, err := withId(cached[0], request.Id)
 		if err != nil {
-			http.Error(w, "Failed to read request body", http.StatusInternalServerError)
+			http.Error(w, "Failed to read from cache", http.StatusInternalServerError)
 			return
 		}
-		defer r.Body.Close()
+		hitCounter(request.Method).Inc()
+		writeResponse(w, "HIT", response)
+		return
+	}
+	missCounter(request.Method).Inc()
+
+	upstream, shared, err := c.fetchUpstream(endpoint, cacheKey, body)
+	if err != nil {
+		http.Error(w, "Failed to fetch from upstream", http.StatusInternalServerError)
+		return
+	}
+	if shared {
+		coalescedCounter(request.Method).Inc()
+	}
 
-		var request map[string]interface{}
-		if err := json.Unmarshal(body, &request); err != nil {
-			http.Error(w, "Invalid JSON-RPC request", http.StatusBadRequest)
+	responseBody := upstream.body
+	if upstream.status == http.StatusOK {
+		if err := c.store(r.Context(), reqs, keys, [][]byte{responseBody}); err != nil {
+			http.Error(w, "Failed to save to cache", http.StatusInternalServerError)
 			return
 		}
+		if shared {
+			// the response may belong to another client's request
+			if withOwnId, err := withId(responseBody, request.Id); err == nil {
+				responseBody = withOwnId
+			}
+		}
+	}
+
+	writeResponse(w, "MISS", responseBody)
+}
+
+// handleBatch serves the cached elements of a batch request and forwards only the misses
+// upstream as a single batch
+func (c *L1Cache) handleBatch(w http.ResponseWriter, r *http.Request, endpoint, chainID string, body []byte) {
+	var requests []*rpcRequest
+	if err := json.Unmarshal(body, &requests); err != nil || len(requests) == 0 {
+		http.Error(w, "Invalid JSON-RPC batch request", http.StatusBadRequest)
+		return
+	}
 
-		method, ok := request["method"].(string)
-		if !ok {
+	keys := make([]string, len(requests))
+	for i, req := range requests {
+		if req == nil || req.Method == "" {
 			http.Error(w, "Invalid JSON-RPC method", http.StatusBadRequest)
 			return
 		}
-
-		cacheKey, err := generateCacheKey(chainID, body)
+		key, err := req.cacheKey(chainID)
 		if err != nil {
 			http.Error(w, "Failed to generate cache key", http.StatusInternalServerError)
 			return
 		}
+		keys[i] = key
+	}
 
-		if _, ignore := methodsToIgnore[method]; !ignore {
-			tx, err := db.BeginRw(r.Context())
-			if err != nil {
-				http.Error(w, "Failed to begin transaction", http.StatusInternalServerError)
-				return
-			}
-			if cachedResponse, found := fetchFromCache(tx, cacheKey); found {
-				w.Header().Set("Content-Type", "application/json")
-				w.Header().Set("X-Cache-Status", "HIT")
-				w.Write(cachedResponse)
-				tx.Commit()
+	responses, err := c.lookup(r.Context(), requests, keys)
+	if err != nil {
+		http.Error(w, "Failed to read from cache", http.StatusInternalServerError)
+		return
+	}
+
+	var missIdx []int
+	for i, req := range requests {
+		if responses[i] != nil {
+			hitCounter(req.Method).Inc()
+			if responses[i], err = withId(responses[i], req.Id); err != nil {
+				http.Error(w, "Failed to read from cache", http.StatusInternalServerError)
 				return
 			}
-			tx.Rollback()
+			continue
 		}
+		missCounter(req.Method).Inc()
+		missIdx = append(missIdx, i)
+	}
 
-		resp, err := http.Post(endpoint, "application/json", bytes.NewBuffer(body))
+	status := "HIT"
+	if len(missIdx) > 0 {
+		status = "MISS"
+		if len(missIdx) < len(requests) {
+			status = "PARTIAL"
+		}
+
+		// re-number the outgoing requests so responses can be matched back regardless of the client ids
+		missReqs := make([]*rpcRequest, len(missIdx))
+		missKeys := make([]string, len(missIdx))
+		outgoing := make([]rpcRequest, len(missIdx))
+		for j, i := range missIdx {
+			missReqs[j] = requests[i]
+			missKeys[j] = keys[i]
+			outgoing[j] = *requests[i]
+			outgoing[j].Id = json.RawMessage(fmt.Sprintf("%d", j))
+		}
+		outgoingBody, err := json.Marshal(outgoing)
 		if err != nil {
-			http.Error(w, "Failed to fetch from upstream", http.StatusInternalServerError)
+			http.Error(w, "Failed to build upstream request", http.StatusInternalServerError)
 			return
 		}
-		defer resp.Body.Close()
 
-		responseBody, err := io.ReadAll(resp.Body)
+		upstream, shared, err := c.fetchUpstream(endpoint, strings.Join(missKeys, "\n"), outgoingBody)
 		if err != nil {
-			http.Error(w, "Failed to read upstream response", http.StatusInternalServerError)
+			http.Error(w, "Failed to fetch from upstream", http.StatusInternalServerError)
+			return
+		}
+		if shared {
+			for _, req := range missReqs {
+				coalescedCounter(req.Method).Inc()
+			}
+		}
+		if upstream.status != http.StatusOK {
+			writeResponse(w, status, upstream.body)
 			return
 		}
 
-		if resp.StatusCode == http.StatusOK {
-			// Check if the response contains a JSON-RPC error
-			var jsonResponse map[string]interface{}
-			if err := json.Unmarshal(responseBody, &jsonResponse); err == nil {
-				if _, hasError := jsonResponse["error"]; hasError {
-					log.Warn("Received error response from upstream, not caching", "error", jsonResponse["error"])
-				} else {
-					if _, ignore := methodsToIgnore[method]; !ignore {
-						cacheDuration := time.Duration(0)
-						if duration, found := methodsToExpire[method]; found {
-							if method == "eth_getBlockByNumber" {
-								params, ok := request["params"].([]interface{})
-								if ok && len(params) > 0 {
-									param, ok := params[0].(string)
-									if ok {
-										if _, shouldExpire := paramsToExpire[param]; shouldExpire {
-											cacheDuration = duration
-										}
-									}
-								}
-							} else {
-								cacheDuration = duration
-							}
-						}
-						tx, err := db.BeginRw(r.Context())
-						if err != nil {
-							http.Error(w, "Failed to begin transaction", http.StatusInternalServerError)
-							return
-						}
-						defer tx.Rollback()
-						if err := saveToCache(tx, cacheKey, responseBody, cacheDuration); err != nil {
-							http.Error(w, "Failed to save to cache", http.StatusInternalServerError)
-							return
-						}
-						tx.Commit()
-					}
-				}
-			} else {
-				fmt.Println("Failed to parse upstream response, not caching")
+		var upstreamResponses []json.RawMessage
+		if err := json.Unmarshal(upstream.body, &upstreamResponses); err != nil {
+			// upstream didn't answer with a batch (e.g. a single error object), pass it through
+			writeResponse(w, status, upstream.body)
+			return
+		}
+
+		missResponses := make([][]byte, len(missIdx))
+		for _, raw := range upstreamResponses {
+			var parsed rpcResponse
+			if err := json.Unmarshal(raw, &parsed); err != nil {
+				continue
+			}
+			var j int
+			if err := json.Unmarshal(parsed.Id, &j); err != nil || j < 0 || j >= len(missIdx) {
+				continue
+			}
+			missResponses[j] = raw
+		}
+
+		var toStoreReqs []*rpcRequest
+		var toStoreKeys []string
+		var toStore [][]byte
+		for j, i := range missIdx {
+			if missResponses[j] == nil {
+				http.Error(w, "Incomplete batch response from upstream", http.StatusBadGateway)
+				return
+			}
+			toStoreReqs = append(toStoreReqs, missReqs[j])
+			toStoreKeys = append(toStoreKeys, missKeys[j])
+			toStore = append(toStore, missResponses[j])
+			if responses[i], err = withId(missResponses[j], requests[i].Id); err != nil {
+				http.Error(w, "Failed to read upstream response", http.StatusInternalServerError)
+				return
 			}
 		}
+		if err := c.store(r.Context(), toStoreReqs, toStoreKeys, toStore); err != nil {
+			http.Error(w, "Failed to save to cache", http.StatusInternalServerError)
+			return
+		}
+	}
 
-		w.Header().Set("Content-Type", "application/json")
-		w.Header().Set("X-Cache-Status", "MISS")
-		w.Write(responseBody)
+	out := make([]json.RawMessage, len(responses))
+	for i := range responses {
+		out[i] = responses[i]
+	}
+	response, err := json.Marshal(out)
+	if err != nil {
+		http.Error(w, "Failed to build batch response", http.StatusInternalServerError)
+		return
 	}
+	writeResponse(w, status, response)
+}
+
+func writeResponse(w http.ResponseWriter, cacheStatus string, body []byte) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("X-Cache-Status", cacheStatus)
+	w.Write(body)
 }
@@ -0,0 +1,242 @@
+package l1_cache
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/ledgerwatch/erigon-lib/kv"
+	"github.com/ledgerwatch/erigon-lib/kv/memdb"
+	"github.com/stretchr/testify/require"
+)
+
+type upstreamCounter struct {
+	calls    atomic.Int64
+	requests atomic.Int64
+	delay    time.Duration
+}
+
+// newUpstream returns a fake L1 node answering every request with the method name as result
+func newUpstream(t *testing.T, counter *upstreamCounter) *httptest.Server {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		counter.calls.Add(1)
+		body, err := io.ReadAll(r.Body)
+		require.NoError(t, err)
+		time.Sleep(counter.delay)
+
+		respond := func(req rpcRequest) map[string]interface{} {
+			counter.requests.Add(1)
+			return map[string]interface{}{"jsonrpc": "2.0", "id": req.Id, "result": req.Method}
+		}
+
+		if strings.HasPrefix(string(body), "[") {
+			var reqs []rpcRequest
+			require.NoError(t, json.Unmarshal(body, &reqs))
+			out := make([]interface{}, 0, len(reqs))
+			for _, req := range reqs {
+				out = append(out, respond(req))
+			}
+			json.NewEncoder(w).Encode(out)
+			return
+		}
+		var req rpcRequest
+		require.NoError(t, json.Unmarshal(body, &req))
+		json.NewEncoder(w).Encode(respond(req))
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func newTestCache(t *testing.T, upstream *httptest.Server, ttls map[string]time.Duration) (*L1Cache, kv.RwDB, string) {
+	db := memdb.NewTestDB(t)
+	cache, err := newL1Cache(context.Background(), db, ttls)
+	require.NoError(t, err)
+	server := httptest.NewServer(cache.handler())
+	t.Cleanup(server.Close)
+	return cache, db, fmt.Sprintf("%s?endpoint=%s&chainid=1", server.URL, url.QueryEscape(upstream.URL))
+}
+
+func post(t *testing.T, target, body string) (string, []byte) {
+	resp, err := http.Post(target, "application/json", strings.NewReader(body))
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	out, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, resp.StatusCode, string(out))
+	return resp.Header.Get("X-Cache-Status"), out
+}
+
+func TestL1Cache_HitKeepsRequestId(t *testing.T) {
+	counter := &upstreamCounter{}
+	_, _, target := newTestCache(t, newUpstream(t, counter), nil)
+
+	status, _ := post(t, target, `{"jsonrpc":"2.0","id":1,"method":"eth_chainId","params":[]}`)
+	require.Equal(t, "MISS", status)
+
+	status, body := post(t, target, `{"jsonrpc":"2.0","id":42,"method":"eth_chainId","params":[]}`)
+	require.Equal(t, "HIT", status)
+
+	var resp map[string]interface{}
+	require.NoError(t, json.Unmarshal(body, &resp))
+	require.Equal(t, float64(42), resp["id"])
+	require.Equal(t, int64(1), counter.calls.Load())
+}
+
+func TestL1Cache_CoalescesConcurrentRequests(t *testing.T) {
+	counter := &upstreamCounter{delay: 200 * time.Millisecond}
+	_, _, target := newTestCache(t, newUpstream(t, counter), nil)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(id int) {
+			defer wg.Done()
+			_, body := post(t, target, fmt.Sprintf(`{"jsonrpc":"2.0","id":%d,"method":"eth_getLogs","params":[{"fromBlock":"0x1"}]}`, id))
+			var resp map[string]interface{}
+			require.NoError(t, json.Unmarshal(body, &resp))
+			require.Equal(t, float64(id), resp["id"])
+		}(i)
+	}
+	wg.Wait()
+
+	require.Equal(t, int64(1), counter.calls.Load())
+}
+
+func TestL1Cache_BatchOnlyForwardsMisses(t *testing.T) {
+	counter := &upstreamCounter{}
+	_, _, target := newTestCache(t, newUpstream(t, counter), nil)
+
+	post(t, target, `{"jsonrpc":"2.0","id":1,"method":"eth_chainId","params":[]}`)
+
+	status, body := post(t, target, `[{"jsonrpc":"2.0","id":"a","method":"eth_chainId","params":[]},{"jsonrpc":"2.0","id":"b","method":"net_version","params":[]}]`)
+	require.Equal(t, "PARTIAL", status)
+
+	var resps []map[string]interface{}
+	require.NoError(t, json.Unmarshal(body, &resps))
+	require.Len(t, resps, 2)
+	require.Equal(t, "a", resps[0]["id"])
+	require.Equal(t, "eth_chainId", resps[0]["result"])
+	require.Equal(t, "b", resps[1]["id"])
+	require.Equal(t, "net_version", resps[1]["result"])
+
+	// only net_version should have gone upstream with the batch
+	require.Equal(t, int64(2), counter.calls.Load())
+	require.Equal(t, int64(2), counter.requests.Load())
+
+	status, _ = post(t, target, `[{"jsonrpc":"2.0","id":"c","method":"net_version","params":[]}]`)
+	require.Equal(t, "HIT", status)
+}
+
+func TestL1Cache_MethodTTL(t *testing.T) {
+	counter := &upstreamCounter{}
+	ttls := map[string]time.Duration{"eth_getBlockByNumber:latest": 50 * time.Millisecond}
+	_, _, target := newTestCache(t, newUpstream(t, counter), ttls)
+
+	latest := `{"jsonrpc":"2.0","id":1,"method":"eth_getBlockByNumber","params":["latest",false]}`
+	numbered := `{"jsonrpc":"2.0","id":1,"method":"eth_getBlockByNumber","params":["0x10",false]}`
+
+	post(t, target, latest)
+	post(t, target, numbered)
+	status, _ := post(t, target, latest)
+	require.Equal(t, "HIT", status)
+
+	time.Sleep(100 * time.Millisecond)
+
+	status, _ = post(t, target, latest)
+	require.Equal(t, "MISS", status)
+	status, _ = post(t, target, numbered)
+	require.Equal(t, "HIT", status)
+}
+
+func TestL1Cache_AdminPurge(t *testing.T) {
+	counter := &upstreamCounter{}
+	cache, db, target := newTestCache(t, newUpstream(t, counter), nil)
+
+	post(t, target, `{"jsonrpc":"2.0","id":1,"method":"eth_chainId","params":[]}`)
+	post(t, target, `{"jsonrpc":"2.0","id":1,"method":"net_version","params":[]}`)
+
+	admin := httptest.NewServer(cache.adminHandler())
+	defer admin.Close()
+
+	// the admin endpoints are not served on the cache port
+	resp, err := http.Post(strings.Split(target, "?")[0]+"/admin/purge", "application/json", nil)
+	require.NoError(t, err)
+	resp.Body.Close()
+	require.Equal(t, http.StatusBadRequest, resp.StatusCode)
+
+	resp, err = http.Get(admin.URL + "/admin/entries?method=net_version")
+	require.NoError(t, err)
+	var entries []CacheEntry
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&entries))
+	resp.Body.Close()
+	require.Len(t, entries, 1)
+	require.Equal(t, "net_version", entries[0].Method)
+	require.Equal(t, "1", entries[0].ChainId)
+
+	resp, err = http.Post(admin.URL+"/admin/purge?method=eth_chainId", "application/json", nil)
+	require.NoError(t, err)
+	var purged map[string]int
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&purged))
+	resp.Body.Close()
+	require.Equal(t, 1, purged["purged"])
+
+	tx, err := db.BeginRo(context.Background())
+	require.NoError(t, err)
+	defer tx.Rollback()
+	remaining, err := listEntries(tx, entryFilter{}, 0)
+	require.NoError(t, err)
+	require.Len(t, remaining, 1)
+	require.Equal(t, "net_version", remaining[0].Method)
+}
+
+func TestL1Cache_ListEntriesLimit(t *testing.T) {
+	counter := &upstreamCounter{}
+	_, db, target := newTestCache(t, newUpstream(t, counter), nil)
+
+	for _, method := range []string{"eth_chainId", "net_version", "eth_gasPrice"} {
+		post(t, target, fmt.Sprintf(`{"jsonrpc":"2.0","id":1,"method":"%s","params":[]}`, method))
+	}
+
+	tx, err := db.BeginRo(context.Background())
+	require.NoError(t, err)
+	defer tx.Rollback()
+	entries, err := listEntries(tx, entryFilter{}, 2)
+	require.NoError(t, err)
+	require.Len(t, entries, 2)
+}
+
+func TestL1Cache_TagsExpireByDefault(t *testing.T) {
+	counter := &upstreamCounter{}
+	cache, _, _ := newTestCache(t, newUpstream(t, counter), map[string]time.Duration{"eth_getBlockByNumber": time.Hour})
+
+	latest := &rpcRequest{Method: "eth_getBlockByNumber", Params: json.RawMessage(`["latest",false]`)}
+	numbered := &rpcRequest{Method: "eth_getBlockByNumber", Params: json.RawMessage(`["0x10",false]`)}
+	getLogs := &rpcRequest{Method: "eth_getLogs", Params: json.RawMessage(`[{"fromBlock":"0x1"}]`)}
+
+	require.Equal(t, defaultTagTTL, cache.ttlFor(latest))
+	require.Equal(t, time.Hour, cache.ttlFor(numbered))
+	require.Zero(t, cache.ttlFor(getLogs))
+}
+
+func TestParseMethodTTLs(t *testing.T) {
+	ttls, err := ParseMethodTTLs("eth_blockNumber=5s, eth_getBlockByNumber:latest=12s")
+	require.NoError(t, err)
+	require.Equal(t, map[string]time.Duration{
+		"eth_blockNumber":             5 * time.Second,
+		"eth_getBlockByNumber:latest": 12 * time.Second,
+	}, ttls)
+
+	_, err = ParseMethodTTLs("eth_blockNumber")
+	require.Error(t, err)
+	_, err = ParseMethodTTLs("eth_blockNumber=-1s")
+	require.Error(t, err)
+}
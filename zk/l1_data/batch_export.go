@@ -0,0 +1,347 @@
+package l1_data
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/ledgerwatch/erigon-lib/chain"
+	"github.com/ledgerwatch/erigon-lib/common"
+	"github.com/ledgerwatch/erigon-lib/common/length"
+	"github.com/ledgerwatch/erigon-lib/kv"
+	"github.com/ledgerwatch/erigon/core/rawdb"
+	eritypes "github.com/ledgerwatch/erigon/core/types"
+	"github.com/ledgerwatch/erigon/zk/hermez_db"
+	zktx "github.com/ledgerwatch/erigon/zk/tx"
+	"github.com/ledgerwatch/erigon/zk/types"
+	"github.com/ledgerwatch/erigon/zk/utils"
+)
+
+// BatchExportVersion is the version of the on disk batch export layout written by ExportBatches
+const BatchExportVersion = 1
+
+const injectedBatchNumber = 1
+
+const (
+	BatchExportManifestFile = "manifest.json"
+	BatchExportBatchesFile  = "batches.json"
+)
+
+// Where the data and acc input hash inputs of an exported batch came from
+const (
+	// BatchSourceL1 is a batch read from the sequenceBatches calldata by the L1 block sync
+	BatchSourceL1 = "l1"
+	// BatchSourceInjected is the injected batch the rollup was initialised with
+	BatchSourceInjected = "injected"
+	// BatchSourceGenerated is a batch built from the L2 blocks, as the sequence sender would post it on its own.  The
+	// sequencer is the coinbase, the limit timestamp the time of the last block and the l1 info root the one of the
+	// highest l1 info tree index used by the batch unless the sequence of the batch is known.
+	BatchSourceGenerated = "generated"
+)
+
+// BatchExportManifest describes a directory of exported batches:
+//   - batches.json:   []ExportedBatch ordered by batch number with the checksum of the file in the manifest
+//   - batch_N.bin:    the batch L2 data of batch N exactly as it is posted on L1, checked by its batchHashData
+type BatchExportManifest struct {
+	Version             int                 `json:"version"`
+	FirstBatch          uint64              `json:"firstBatch"`
+	LastBatch           uint64              `json:"lastBatch"`
+	InitialAccInputHash common.Hash         `json:"initialAccInputHash"`
+	FinalAccInputHash   common.Hash         `json:"finalAccInputHash"`
+	Batches             SequenceArchiveFile `json:"batches"`
+}
+
+// ExportedBatch holds everything the acc input hash of a batch is calculated from besides its data
+type ExportedBatch struct {
+	BatchNumber  uint64 `json:"batchNumber"`
+	ForkId       uint64 `json:"forkId"`
+	Source       string `json:"source"`
+	File         string `json:"file"`
+	FirstBlock   uint64 `json:"firstBlock"`
+	LastBlock    uint64 `json:"lastBlock"`
+	Blocks       int    `json:"blocks"`
+	Transactions int    `json:"transactions"`
+
+	BatchHashData common.Hash `json:"batchHashData"`
+	// L1InfoRoot is used from fork 7 (etrog), GlobalExitRoot before it
+	L1InfoRoot        common.Hash    `json:"l1InfoRoot,omitempty"`
+	GlobalExitRoot    common.Hash    `json:"globalExitRoot,omitempty"`
+	LimitTimestamp    uint64         `json:"limitTimestamp"`
+	Sequencer         common.Address `json:"sequencer"`
+	ForcedBlockHashL1 common.Hash    `json:"forcedBlockHashL1,omitempty"`
+	OldAccInputHash   common.Hash    `json:"oldAccInputHash"`
+	AccInputHash      common.Hash    `json:"accInputHash"`
+}
+
+func (b *ExportedBatch) calculateAccInputHash(batchL2Data []byte) common.Hash {
+	if b.ForkId < uint64(chain.ForkID7Etrog) {
+		return *utils.CalculatePreEtrogAccInputHash(b.OldAccInputHash, batchL2Data, b.GlobalExitRoot, b.LimitTimestamp, b.Sequencer)
+	}
+	return *utils.CalculateEtrogAccInputHash(b.OldAccInputHash, batchL2Data, b.L1InfoRoot, b.LimitTimestamp, b.Sequencer, b.ForcedBlockHashL1)
+}
+
+func batchExportDataFile(batchNo uint64) string {
+	return fmt.Sprintf("batch_%d.bin", batchNo)
+}
+
+type batchExporter struct {
+	tx              kv.Tx
+	hermezDb        *hermez_db.HermezDbReader
+	l1InfoTreeRoots map[uint64]common.Hash
+}
+
+// ExportBatches writes the L1 batch data of fromBatch to toBatch to dir along with the acc input hash chain starting
+// at oldAccInputHash, the acc input hash of the batch before fromBatch
+func ExportBatches(tx kv.Tx, dir string, fromBatch, toBatch uint64, oldAccInputHash common.Hash) (*BatchExportManifest, error) {
+	if fromBatch == 0 || fromBatch > toBatch {
+		return nil, fmt.Errorf("invalid batch range %d-%d, the genesis batch is never sequenced", fromBatch, toBatch)
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+
+	exporter := &batchExporter{tx: tx, hermezDb: hermez_db.NewHermezDbReader(tx)}
+
+	batches := make([]*ExportedBatch, 0, toBatch-fromBatch+1)
+	accInputHash := oldAccInputHash
+	for batchNo := fromBatch; batchNo <= toBatch; batchNo++ {
+		batch, batchL2Data, err := exporter.exportBatch(batchNo)
+		if err != nil {
+			return nil, fmt.Errorf("batch %d: %w", batchNo, err)
+		}
+		batch.OldAccInputHash = accInputHash
+		batch.AccInputHash = batch.calculateAccInputHash(batchL2Data)
+		accInputHash = batch.AccInputHash
+
+		if err := os.WriteFile(filepath.Join(dir, batch.File), batchL2Data, 0644); err != nil {
+			return nil, err
+		}
+		batches = append(batches, batch)
+	}
+
+	manifest := &BatchExportManifest{
+		Version:             BatchExportVersion,
+		FirstBatch:          fromBatch,
+		LastBatch:           toBatch,
+		InitialAccInputHash: oldAccInputHash,
+		FinalAccInputHash:   accInputHash,
+	}
+	var err error
+	if manifest.Batches, err = writeArchiveFile(dir, BatchExportBatchesFile, batches); err != nil {
+		return nil, err
+	}
+	if _, err = writeArchiveFile(dir, BatchExportManifestFile, manifest); err != nil {
+		return nil, err
+	}
+	return manifest, nil
+}
+
+func (e *batchExporter) exportBatch(batchNo uint64) (*ExportedBatch, []byte, error) {
+	blockNos, err := e.hermezDb.GetL2BlockNosByBatch(batchNo)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(blockNos) == 0 {
+		return nil, nil, fmt.Errorf("no blocks found")
+	}
+	forkId, err := e.hermezDb.GetForkId(batchNo)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	blocks := make([]*eritypes.Block, 0, len(blockNos))
+	transactions := 0
+	for _, blockNo := range blockNos {
+		block, err := rawdb.ReadBlockByNumber(e.tx, blockNo)
+		if err != nil {
+			return nil, nil, err
+		}
+		if block == nil {
+			return nil, nil, fmt.Errorf("block %d not found", blockNo)
+		}
+		blocks = append(blocks, block)
+		transactions += len(block.Transactions())
+	}
+	lastBlock := blocks[len(blocks)-1]
+
+	batch := &ExportedBatch{
+		BatchNumber: batchNo,
+		ForkId:      forkId,
+		File:        batchExportDataFile(batchNo),
+		FirstBlock:  blockNos[0],
+		LastBlock:   blockNos[len(blockNos)-1],
+	}
+
+	var batchL2Data []byte
+	injected, err := e.injectedBatch(batchNo)
+	if err != nil {
+		return nil, nil, err
+	}
+	l1BatchData, err := e.hermezDb.GetL1BatchData(batchNo)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	switch {
+	case injected != nil:
+		batch.Source = BatchSourceInjected
+		batchL2Data = injected.Transaction
+		batch.L1InfoRoot = injected.LastGlobalExitRoot
+		batch.LimitTimestamp = injected.Timestamp
+		batch.Sequencer = injected.Sequencer
+		batch.ForcedBlockHashL1 = injected.L1ParentHash
+	case len(l1BatchData) >= length.Addr+length.Hash+8:
+		// the l1 block sync stores the sequence values in front of the batch data, see EncodeL1BatchData
+		batch.Source = BatchSourceL1
+		batch.Sequencer = common.BytesToAddress(l1BatchData[:length.Addr])
+		batch.L1InfoRoot = common.BytesToHash(l1BatchData[length.Addr : length.Addr+length.Hash])
+		batch.LimitTimestamp = binary.BigEndian.Uint64(l1BatchData[length.Addr+length.Hash:])
+		batchL2Data = l1BatchData[length.Addr+length.Hash+8:]
+	default:
+		batch.Source = BatchSourceGenerated
+		if batchL2Data, err = utils.GenerateBatchDataFromDb(e.tx, e.hermezDb, blocks, forkId); err != nil {
+			return nil, nil, err
+		}
+		batch.Sequencer = lastBlock.Coinbase()
+		batch.LimitTimestamp = lastBlock.Time()
+		if err := e.generatedRoots(batch, blockNos); err != nil {
+			return nil, nil, err
+		}
+	}
+	if forkId < uint64(chain.ForkID7Etrog) && batch.Source == BatchSourceL1 {
+		// the l1 block sync keeps no global exit roots, the one the batch was sequenced with is its own
+		batch.L1InfoRoot = common.Hash{}
+		if err := e.generatedRoots(batch, blockNos); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	decoded, err := zktx.DecodeBatchL2Blocks(batchL2Data, forkId)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to decode batch data: %w", err)
+	}
+	batch.Blocks, batch.Transactions = countDecodedBatch(decoded)
+	// the injected batch is not split into blocks the same way so only its own data is checked
+	if batch.Source != BatchSourceInjected && forkId >= uint64(chain.ForkID7Etrog) && batch.Blocks != len(blocks) {
+		return nil, nil, fmt.Errorf("%s batch data has %d blocks, the node has %d", batch.Source, batch.Blocks, len(blocks))
+	}
+	if batch.Source != BatchSourceInjected && batch.Transactions != transactions {
+		return nil, nil, fmt.Errorf("%s batch data has %d transactions, the node has %d", batch.Source, batch.Transactions, transactions)
+	}
+	batch.BatchHashData = common.BytesToHash(utils.CalculateBatchHashData(batchL2Data))
+
+	return batch, batchL2Data, nil
+}
+
+func (e *batchExporter) injectedBatch(batchNo uint64) (*types.L1InjectedBatch, error) {
+	if batchNo != injectedBatchNumber {
+		return nil, nil
+	}
+	return e.hermezDb.GetL1InjectedBatch(0)
+}
+
+// generatedRoots sets the root of a generated batch, the l1 info root of its sequence if it is known and otherwise
+// the root of the highest l1 info tree index the batch used.  Batches before etrog use the global exit root of the
+// batch.
+func (e *batchExporter) generatedRoots(batch *ExportedBatch, blockNos []uint64) error {
+	if batch.ForkId < uint64(chain.ForkID7Etrog) {
+		gerUpdate, err := e.hermezDb.GetBatchGlobalExitRoot(batch.BatchNumber)
+		if err != nil {
+			return err
+		}
+		if gerUpdate != nil {
+			batch.GlobalExitRoot = gerUpdate.GlobalExitRoot
+		}
+		return nil
+	}
+
+	_, sequence, err := e.hermezDb.GetRangeSequencesByBatch(batch.BatchNumber)
+	if err != nil {
+		return err
+	}
+	if sequence != nil && sequence.L1InfoRoot != (common.Hash{}) {
+		batch.L1InfoRoot = sequence.L1InfoRoot
+		return nil
+	}
+
+	var highestIndex uint64
+	for _, blockNo := range blockNos {
+		index, err := e.hermezDb.GetBlockL1InfoTreeIndex(blockNo)
+		if err != nil {
+			return err
+		}
+		highestIndex = max(highestIndex, index)
+	}
+	if e.l1InfoTreeRoots == nil {
+		if e.l1InfoTreeRoots, err = e.hermezDb.GetL1InfoTreeIndexToRoots(); err != nil {
+			return err
+		}
+	}
+	batch.L1InfoRoot = e.l1InfoTreeRoots[highestIndex]
+	return nil
+}
+
+func countDecodedBatch(decoded []zktx.DecodedBatchL2Data) (blocks, transactions int) {
+	for _, block := range decoded {
+		transactions += len(block.Transactions)
+	}
+	return len(decoded), transactions
+}
+
+// VerifyBatchExport checks an export written by ExportBatches: the data of every batch must match its batchHashData and
+// decode into its blocks and transactions, and the acc input hash chain recalculated from the data must match
+func VerifyBatchExport(dir string) (*BatchExportManifest, error) {
+	manifest := &BatchExportManifest{}
+	if err := readJsonFile(filepath.Join(dir, BatchExportManifestFile), manifest); err != nil {
+		return nil, fmt.Errorf("failed to read batch export manifest: %w", err)
+	}
+	if manifest.Version != BatchExportVersion {
+		return nil, fmt.Errorf("unsupported batch export version %d, expected %d", manifest.Version, BatchExportVersion)
+	}
+
+	var batches []*ExportedBatch
+	if err := readArchiveFile(dir, manifest.Batches, &batches); err != nil {
+		return nil, err
+	}
+	if uint64(len(batches)) != manifest.LastBatch-manifest.FirstBatch+1 {
+		return nil, fmt.Errorf("manifest covers batches %d-%d but %d are listed", manifest.FirstBatch, manifest.LastBatch, len(batches))
+	}
+
+	accInputHash := manifest.InitialAccInputHash
+	for i, batch := range batches {
+		if batch.BatchNumber != manifest.FirstBatch+uint64(i) {
+			return nil, fmt.Errorf("expected batch %d, found %d", manifest.FirstBatch+uint64(i), batch.BatchNumber)
+		}
+		if batch.OldAccInputHash != accInputHash {
+			return nil, fmt.Errorf("batch %d old accInputHash %s does not follow on from %s", batch.BatchNumber, batch.OldAccInputHash.Hex(), accInputHash.Hex())
+		}
+
+		batchL2Data, err := os.ReadFile(filepath.Join(dir, batch.File))
+		if err != nil {
+			return nil, err
+		}
+		if hash := utils.CalculateBatchHashData(batchL2Data); !bytes.Equal(hash, batch.BatchHashData.Bytes()) {
+			return nil, fmt.Errorf("batch %d data hash mismatch: calculated %x, export %s", batch.BatchNumber, hash, batch.BatchHashData.Hex())
+		}
+
+		decoded, err := zktx.DecodeBatchL2Blocks(batchL2Data, batch.ForkId)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode batch %d: %w", batch.BatchNumber, err)
+		}
+		if blocks, transactions := countDecodedBatch(decoded); blocks != batch.Blocks || transactions != batch.Transactions {
+			return nil, fmt.Errorf("batch %d decodes into %d blocks and %d transactions, export has %d and %d", batch.BatchNumber, blocks, transactions, batch.Blocks, batch.Transactions)
+		}
+
+		if calculated := batch.calculateAccInputHash(batchL2Data); calculated != batch.AccInputHash {
+			return nil, fmt.Errorf("accInputHash mismatch for batch %d: calculated %s, export %s", batch.BatchNumber, calculated.Hex(), batch.AccInputHash.Hex())
+		}
+		accInputHash = batch.AccInputHash
+	}
+
+	if accInputHash != manifest.FinalAccInputHash {
+		return nil, fmt.Errorf("final accInputHash mismatch: calculated %s, manifest %s", accInputHash.Hex(), manifest.FinalAccInputHash.Hex())
+	}
+	return manifest, nil
+}
@@ -0,0 +1,100 @@
+package l1_data
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ledgerwatch/erigon-lib/common"
+	zktx "github.com/ledgerwatch/erigon/zk/tx"
+	"github.com/ledgerwatch/erigon/zk/utils"
+	"github.com/stretchr/testify/require"
+)
+
+// writeTestBatchExport writes empty etrog batches the way ExportBatches does without needing a node's db
+func writeTestBatchExport(t *testing.T, dir string, fromBatch, toBatch uint64) {
+	oldAccInputHash := common.HexToHash("0x01")
+	accInputHash := oldAccInputHash
+	var batches []*ExportedBatch
+	for batchNo := fromBatch; batchNo <= toBatch; batchNo++ {
+		batchL2Data := append(zktx.GenerateStartBlockBatchL2Data(3, uint32(batchNo)), zktx.GenerateStartBlockBatchL2Data(2, uint32(batchNo))...)
+		batch := &ExportedBatch{
+			BatchNumber:     batchNo,
+			ForkId:          9,
+			Source:          BatchSourceGenerated,
+			File:            batchExportDataFile(batchNo),
+			Blocks:          2,
+			BatchHashData:   common.BytesToHash(utils.CalculateBatchHashData(batchL2Data)),
+			L1InfoRoot:      common.HexToHash("0x02"),
+			LimitTimestamp:  1_700_000_000 + batchNo,
+			Sequencer:       common.HexToAddress("0x03"),
+			OldAccInputHash: accInputHash,
+		}
+		batch.AccInputHash = batch.calculateAccInputHash(batchL2Data)
+		accInputHash = batch.AccInputHash
+		require.NoError(t, os.WriteFile(filepath.Join(dir, batch.File), batchL2Data, 0644))
+		batches = append(batches, batch)
+	}
+
+	manifest := &BatchExportManifest{
+		Version:             BatchExportVersion,
+		FirstBatch:          fromBatch,
+		LastBatch:           toBatch,
+		InitialAccInputHash: oldAccInputHash,
+		FinalAccInputHash:   accInputHash,
+	}
+	var err error
+	manifest.Batches, err = writeArchiveFile(dir, BatchExportBatchesFile, batches)
+	require.NoError(t, err)
+	_, err = writeArchiveFile(dir, BatchExportManifestFile, manifest)
+	require.NoError(t, err)
+}
+
+func TestVerifyBatchExport(t *testing.T) {
+	t.Run("valid export", func(t *testing.T) {
+		dir := t.TempDir()
+		writeTestBatchExport(t, dir, 5, 8)
+		manifest, err := VerifyBatchExport(dir)
+		require.NoError(t, err)
+		require.Equal(t, uint64(5), manifest.FirstBatch)
+		require.Equal(t, uint64(8), manifest.LastBatch)
+	})
+
+	t.Run("tampered batch data", func(t *testing.T) {
+		dir := t.TempDir()
+		writeTestBatchExport(t, dir, 5, 8)
+		path := filepath.Join(dir, batchExportDataFile(6))
+		data, err := os.ReadFile(path)
+		require.NoError(t, err)
+		data[len(data)-1]++
+		require.NoError(t, os.WriteFile(path, data, 0644))
+
+		_, err = VerifyBatchExport(dir)
+		require.ErrorContains(t, err, "batch 6 data hash mismatch")
+	})
+
+	t.Run("tampered metadata", func(t *testing.T) {
+		dir := t.TempDir()
+		writeTestBatchExport(t, dir, 5, 8)
+		path := filepath.Join(dir, BatchExportBatchesFile)
+		data, err := os.ReadFile(path)
+		require.NoError(t, err)
+		require.NoError(t, os.WriteFile(path, append(data, ' '), 0644))
+
+		_, err = VerifyBatchExport(dir)
+		require.ErrorContains(t, err, "checksum mismatch")
+	})
+
+	t.Run("acc input hash chain", func(t *testing.T) {
+		dir := t.TempDir()
+		writeTestBatchExport(t, dir, 5, 8)
+		manifest := &BatchExportManifest{}
+		require.NoError(t, readJsonFile(filepath.Join(dir, BatchExportManifestFile), manifest))
+		manifest.InitialAccInputHash = common.Hash{}
+		_, err := writeArchiveFile(dir, BatchExportManifestFile, manifest)
+		require.NoError(t, err)
+
+		_, err = VerifyBatchExport(dir)
+		require.ErrorContains(t, err, "batch 5 old accInputHash")
+	})
+}
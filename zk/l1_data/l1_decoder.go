@@ -187,6 +187,17 @@ func DecodeL1BatchData(txData []byte, daUrl string) ([][]byte, common.Address, u
 	return batchL2Datas, coinbase, limitTimstamp, err
 }
 
+// EncodeL1BatchData builds the value stored in the L1 batch data table for a single batch, the layout is
+// coinbase (20 bytes) | l1 info root (32 bytes) | limit timestamp (8 bytes) | batch l2 data
+func EncodeL1BatchData(coinbase common.Address, l1InfoRoot common.Hash, limitTimestamp uint64, batchL2Data []byte) []byte {
+	data := make([]byte, length.Addr+length.Hash+8+len(batchL2Data))
+	copy(data, coinbase.Bytes())
+	copy(data[length.Addr:], l1InfoRoot.Bytes())
+	binary.BigEndian.PutUint64(data[length.Addr+length.Hash:], limitTimestamp)
+	copy(data[length.Addr+length.Hash+8:], batchL2Data)
+	return data
+}
+
 type DecodedL1Data struct {
 	DecodedData     []zktx.DecodedBatchL2Data
 	Coinbase        common.Address
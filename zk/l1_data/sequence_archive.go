@@ -0,0 +1,383 @@
+package l1_data
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/ledgerwatch/erigon-lib/common"
+	"github.com/ledgerwatch/erigon/zk/hermez_db"
+	"github.com/ledgerwatch/erigon/zk/syncer"
+	"github.com/ledgerwatch/erigon/zk/types"
+)
+
+// SequenceArchiveVersion is the version of the on disk sequence archive layout written by WriteSequenceArchive
+const SequenceArchiveVersion = 1
+
+const (
+	SequenceArchiveManifestFile       = "manifest.json"
+	SequenceArchiveSequencesFile      = "sequences.json"
+	SequenceArchiveCalldataFile       = "calldata.json"
+	SequenceArchiveAccInputHashesFile = "accInputHashes.json"
+	SequenceArchiveL1InfoTreeFile     = "l1InfoTreeUpdates.json"
+)
+
+// SequenceArchiveManifest describes a directory of pre-downloaded L1 sequence data.  The data files use the same
+// formats as the l1-sequences-downloader debug tools:
+//   - sequences.json:      []types.L1BatchInfo taken from the SequenceBatches logs
+//   - calldata.json:       l1 tx hash -> hex encoded sequenceBatches calldata
+//   - accInputHashes.json: batch number -> acc input hash read from the rollup contract (optional)
+//   - l1InfoTreeUpdates.json: []types.L1InfoTreeUpdate ordered by index (optional, needed for a fully offline recovery)
+type SequenceArchiveManifest struct {
+	Version           int                  `json:"version"`
+	L1ChainId         uint64               `json:"l1ChainId"`
+	RollupAddress     common.Address       `json:"rollupAddress"`
+	RollupId          uint64               `json:"rollupId"`
+	FromL1Block       uint64               `json:"fromL1Block"`
+	ToL1Block         uint64               `json:"toL1Block"`
+	FirstBatch        uint64               `json:"firstBatch"`
+	LastBatch         uint64               `json:"lastBatch"`
+	Sequences         SequenceArchiveFile  `json:"sequences"`
+	Calldata          SequenceArchiveFile  `json:"calldata"`
+	AccInputHashes    *SequenceArchiveFile `json:"accInputHashes,omitempty"`
+	L1InfoTreeUpdates *SequenceArchiveFile `json:"l1InfoTreeUpdates,omitempty"`
+}
+
+type SequenceArchiveFile struct {
+	Name   string `json:"name"`
+	Sha256 string `json:"sha256"`
+}
+
+type SequenceArchive struct {
+	Manifest          SequenceArchiveManifest
+	Sequences         []types.L1BatchInfo
+	Calldata          map[common.Hash][]byte
+	AccInputHashes    map[uint64]common.Hash
+	L1InfoTreeUpdates []types.L1InfoTreeUpdate
+}
+
+// ReadSequenceArchiveManifest loads only the manifest of the archive in dir
+func ReadSequenceArchiveManifest(dir string) (*SequenceArchiveManifest, error) {
+	manifest := &SequenceArchiveManifest{}
+	if err := readJsonFile(filepath.Join(dir, SequenceArchiveManifestFile), manifest); err != nil {
+		return nil, fmt.Errorf("failed to read sequence archive manifest: %w", err)
+	}
+	if manifest.Version != SequenceArchiveVersion {
+		return nil, fmt.Errorf("unsupported sequence archive version %d, expected %d", manifest.Version, SequenceArchiveVersion)
+	}
+	return manifest, nil
+}
+
+// CheckNetwork returns an error when the archive was downloaded for another L1 chain, rollup manager or rollup, fields
+// left empty in the manifest are not checked
+func (m *SequenceArchiveManifest) CheckNetwork(l1ChainId uint64, rollupManager common.Address, rollupId uint64) error {
+	if m.L1ChainId != 0 && m.L1ChainId != l1ChainId {
+		return fmt.Errorf("sequence archive is for l1 chain %d, the node is on %d", m.L1ChainId, l1ChainId)
+	}
+	if m.RollupAddress != (common.Address{}) && m.RollupAddress != rollupManager {
+		return fmt.Errorf("sequence archive is for rollup manager %s, the node uses %s", m.RollupAddress, rollupManager)
+	}
+	if m.RollupId != 0 && m.RollupId != rollupId {
+		return fmt.Errorf("sequence archive is for rollup %d, the node is rollup %d", m.RollupId, rollupId)
+	}
+	return nil
+}
+
+// OpenSequenceArchive loads the archive in dir for an L1 recovery after checking it belongs to the network of the node
+// and verifying its contents
+func OpenSequenceArchive(dir string, l1ChainId uint64, rollupManager common.Address, rollupId uint64) (*SequenceArchive, error) {
+	archive, err := ReadSequenceArchive(dir)
+	if err != nil {
+		return nil, err
+	}
+	if err = archive.Manifest.CheckNetwork(l1ChainId, rollupManager, rollupId); err != nil {
+		return nil, err
+	}
+	if err = archive.Verify(); err != nil {
+		return nil, fmt.Errorf("sequence archive verification failed: %w", err)
+	}
+	return archive, nil
+}
+
+// ReadSequenceArchive loads the archive in dir, verifying the checksum of every file listed in the manifest
+func ReadSequenceArchive(dir string) (*SequenceArchive, error) {
+	manifest, err := ReadSequenceArchiveManifest(dir)
+	if err != nil {
+		return nil, err
+	}
+	archive := &SequenceArchive{Manifest: *manifest}
+
+	if err := readArchiveFile(dir, archive.Manifest.Sequences, &archive.Sequences); err != nil {
+		return nil, err
+	}
+
+	calldata := make(map[string]string)
+	if err := readArchiveFile(dir, archive.Manifest.Calldata, &calldata); err != nil {
+		return nil, err
+	}
+	archive.Calldata = make(map[common.Hash][]byte, len(calldata))
+	for txHash, data := range calldata {
+		archive.Calldata[common.HexToHash(txHash)] = common.FromHex(data)
+	}
+
+	if archive.Manifest.AccInputHashes != nil {
+		accInputHashes := make(map[uint64]string)
+		if err := readArchiveFile(dir, *archive.Manifest.AccInputHashes, &accInputHashes); err != nil {
+			return nil, err
+		}
+		archive.AccInputHashes = make(map[uint64]common.Hash, len(accInputHashes))
+		for batchNo, hash := range accInputHashes {
+			archive.AccInputHashes[batchNo] = common.HexToHash(hash)
+		}
+	}
+
+	if archive.Manifest.L1InfoTreeUpdates != nil {
+		if err := readArchiveFile(dir, *archive.Manifest.L1InfoTreeUpdates, &archive.L1InfoTreeUpdates); err != nil {
+			return nil, err
+		}
+	}
+
+	sortSequenceArchive(archive)
+
+	return archive, nil
+}
+
+// WriteSequenceArchive writes the archive data files to dir followed by a manifest containing their checksums.
+// The range fields of the manifest are derived from the sequences.
+func WriteSequenceArchive(dir string, archive *SequenceArchive) error {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+
+	sortSequenceArchive(archive)
+
+	manifest := archive.Manifest
+	manifest.Version = SequenceArchiveVersion
+	if len(archive.Sequences) > 0 {
+		manifest.FirstBatch = archive.Sequences[0].BatchNo
+		manifest.LastBatch = archive.Sequences[len(archive.Sequences)-1].BatchNo
+		manifest.FromL1Block, manifest.ToL1Block = archive.Sequences[0].L1BlockNo, archive.Sequences[0].L1BlockNo
+		for _, seq := range archive.Sequences {
+			if seq.L1BlockNo < manifest.FromL1Block {
+				manifest.FromL1Block = seq.L1BlockNo
+			}
+			if seq.L1BlockNo > manifest.ToL1Block {
+				manifest.ToL1Block = seq.L1BlockNo
+			}
+		}
+	}
+	for _, update := range archive.L1InfoTreeUpdates {
+		if update.BlockNumber > manifest.ToL1Block {
+			manifest.ToL1Block = update.BlockNumber
+		}
+	}
+
+	var err error
+	if manifest.Sequences, err = writeArchiveFile(dir, SequenceArchiveSequencesFile, archive.Sequences); err != nil {
+		return err
+	}
+
+	calldata := make(map[string]string, len(archive.Calldata))
+	for txHash, data := range archive.Calldata {
+		calldata[txHash.String()] = hex.EncodeToString(data)
+	}
+	if manifest.Calldata, err = writeArchiveFile(dir, SequenceArchiveCalldataFile, calldata); err != nil {
+		return err
+	}
+
+	manifest.AccInputHashes = nil
+	if len(archive.AccInputHashes) > 0 {
+		accInputHashes := make(map[uint64]string, len(archive.AccInputHashes))
+		for batchNo, hash := range archive.AccInputHashes {
+			accInputHashes[batchNo] = hash.Hex()
+		}
+		file, err := writeArchiveFile(dir, SequenceArchiveAccInputHashesFile, accInputHashes)
+		if err != nil {
+			return err
+		}
+		manifest.AccInputHashes = &file
+	}
+
+	manifest.L1InfoTreeUpdates = nil
+	if len(archive.L1InfoTreeUpdates) > 0 {
+		file, err := writeArchiveFile(dir, SequenceArchiveL1InfoTreeFile, archive.L1InfoTreeUpdates)
+		if err != nil {
+			return err
+		}
+		manifest.L1InfoTreeUpdates = &file
+	}
+
+	archive.Manifest = manifest
+	_, err = writeArchiveFile(dir, SequenceArchiveManifestFile, manifest)
+	return err
+}
+
+// Verify checks that every sequence has calldata and, when acc input hashes are present, that the acc input hash
+// chain recomputed from the calldata matches the one recorded from the rollup contract
+func (a *SequenceArchive) Verify() error {
+	for i, seq := range a.Sequences {
+		calldata, ok := a.Calldata[seq.L1TxHash]
+		if !ok {
+			return fmt.Errorf("calldata for sequence tx %s (batch %d) not found in archive", seq.L1TxHash, seq.BatchNo)
+		}
+		if len(calldata) < 4 {
+			return fmt.Errorf("calldata for sequence tx %s (batch %d) is too short", seq.L1TxHash, seq.BatchNo)
+		}
+		if i == 0 || len(a.AccInputHashes) == 0 {
+			continue
+		}
+
+		prevSeq := a.Sequences[i-1]
+		prevAccInputHash, ok := a.AccInputHashes[prevSeq.BatchNo]
+		if !ok {
+			continue
+		}
+		expected, ok := a.AccInputHashes[seq.BatchNo]
+		if !ok {
+			continue
+		}
+
+		decoded, err := syncer.DecodeSequenceBatchesCalldata(calldata)
+		if err != nil {
+			return fmt.Errorf("failed to decode calldata for tx %s: %w", seq.L1TxHash, err)
+		}
+		accInputHashCalcFn, totalSequenceBatches, err := syncer.GetAccInputDataCalcFunction(seq.L1InfoRoot, decoded)
+		if err != nil {
+			return fmt.Errorf("failed to get accInputHash calculation func: %w", err)
+		}
+		if totalSequenceBatches == 0 || seq.BatchNo-prevSeq.BatchNo > uint64(totalSequenceBatches) {
+			return fmt.Errorf("batch %d is out of range of sequence calldata: %d %d", seq.BatchNo, prevSeq.BatchNo, totalSequenceBatches)
+		}
+
+		accInputHash := &prevAccInputHash
+		for j := 0; j < int(seq.BatchNo-prevSeq.BatchNo); j++ {
+			accInputHash = accInputHashCalcFn(*accInputHash, j)
+		}
+		if *accInputHash != expected {
+			return fmt.Errorf("accInputHash mismatch for tx %s and batch %d: calculated %s, archive %s", seq.L1TxHash, seq.BatchNo, accInputHash.Hex(), expected.Hex())
+		}
+	}
+
+	return nil
+}
+
+type SequenceArchiveImportResult struct {
+	Sequences    int
+	Batches      int
+	HighestBatch uint64
+	HighestL1    uint64
+	ReachedStop  bool
+}
+
+// ImportSequenceArchive writes the batch data of every sequence in the archive sequenced at or after fromL1Block into
+// the L1 batch data table (and the sequences table), exactly as the L1 block sync would have done when reading the same
+// transactions from a live L1 node.  If stopBatch is non-zero the import stops once that batch has been written.
+func ImportSequenceArchive(hermezDb *hermez_db.HermezDb, archive *SequenceArchive, fromL1Block, stopBatch uint64, daUrl string) (*SequenceArchiveImportResult, error) {
+	result := &SequenceArchiveImportResult{}
+
+	for _, seq := range archive.Sequences {
+		if seq.L1BlockNo < fromL1Block {
+			continue
+		}
+
+		calldata, ok := archive.Calldata[seq.L1TxHash]
+		if !ok {
+			return result, fmt.Errorf("calldata for sequence tx %s (batch %d) not found in archive", seq.L1TxHash, seq.BatchNo)
+		}
+
+		batches, coinbase, limitTimestamp, err := DecodeL1BatchData(calldata, daUrl)
+		if err != nil {
+			return result, fmt.Errorf("failed to decode calldata for tx %s: %w", seq.L1TxHash, err)
+		}
+		if len(batches) == 0 || uint64(len(batches)-1) > seq.BatchNo {
+			return result, fmt.Errorf("sequence tx %s for batch %d contains %d batches", seq.L1TxHash, seq.BatchNo, len(batches))
+		}
+
+		// the log holds the last batch of the sequence so work backwards to the first one
+		initBatch := seq.BatchNo - uint64(len(batches)-1)
+		for idx, batch := range batches {
+			b := initBatch + uint64(idx)
+			if err := hermezDb.WriteL1BatchData(b, EncodeL1BatchData(coinbase, seq.L1InfoRoot, limitTimestamp, batch)); err != nil {
+				return result, err
+			}
+			result.Batches++
+			result.HighestBatch = b
+			if stopBatch > 0 && b >= stopBatch {
+				result.ReachedStop = true
+				break
+			}
+		}
+
+		if err := hermezDb.WriteSequence(seq.L1BlockNo, seq.BatchNo, seq.L1TxHash, seq.StateRoot, seq.L1InfoRoot); err != nil {
+			return result, err
+		}
+		result.Sequences++
+		if seq.L1BlockNo > result.HighestL1 {
+			result.HighestL1 = seq.L1BlockNo
+		}
+
+		if result.ReachedStop {
+			break
+		}
+	}
+
+	return result, nil
+}
+
+func sortSequenceArchive(archive *SequenceArchive) {
+	sort.Slice(archive.Sequences, func(i, j int) bool {
+		return archive.Sequences[i].BatchNo < archive.Sequences[j].BatchNo
+	})
+	sort.Slice(archive.L1InfoTreeUpdates, func(i, j int) bool {
+		return archive.L1InfoTreeUpdates[i].Index < archive.L1InfoTreeUpdates[j].Index
+	})
+}
+
+func readArchiveFile(dir string, file SequenceArchiveFile, target interface{}) error {
+	path := filepath.Join(dir, file.Name)
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	hasher := sha256.New()
+	if err := json.NewDecoder(io.TeeReader(f, hasher)).Decode(target); err != nil {
+		return fmt.Errorf("failed to decode %s: %w", file.Name, err)
+	}
+	// drain anything after the json value so the checksum covers the whole file
+	if _, err := io.Copy(hasher, f); err != nil {
+		return err
+	}
+
+	if sum := hex.EncodeToString(hasher.Sum(nil)); sum != file.Sha256 {
+		return fmt.Errorf("checksum mismatch for %s: expected %s, got %s", file.Name, file.Sha256, sum)
+	}
+	return nil
+}
+
+func writeArchiveFile(dir, name string, value interface{}) (SequenceArchiveFile, error) {
+	data, err := json.MarshalIndent(value, "", "  ")
+	if err != nil {
+		return SequenceArchiveFile{}, err
+	}
+	if err := os.WriteFile(filepath.Join(dir, name), data, 0644); err != nil {
+		return SequenceArchiveFile{}, err
+	}
+	sum := sha256.Sum256(data)
+	return SequenceArchiveFile{Name: name, Sha256: hex.EncodeToString(sum[:])}, nil
+}
+
+func readJsonFile(path string, target interface{}) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return json.NewDecoder(f).Decode(target)
+}
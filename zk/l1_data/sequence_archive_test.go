@@ -0,0 +1,141 @@
+package l1_data
+
+import (
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ledgerwatch/erigon-lib/common"
+	"github.com/ledgerwatch/erigon-lib/kv/memdb"
+	"github.com/ledgerwatch/erigon/zk/hermez_db"
+	"github.com/ledgerwatch/erigon/zk/syncer"
+	"github.com/ledgerwatch/erigon/zk/types"
+	"github.com/stretchr/testify/require"
+)
+
+// taken from https://sepolia.etherscan.io/tx/0x44b7aacaf535bd947803c88c18e63358c8ddd44fbb24950efbb5abb50f938cef
+const archiveTestCalldata = "0xdef57e5400000000000000000000000000000000000000000000000000000000000000800000000000000000000000000000000000000000000000000000000065f838a100000000000000000000000000000000000000000000000000000000000000010000000000000000000000007597b12b953bffe1457d89e7e4fe3da149b45d8800000000000000000000000000000000000000000000000000000000000000010000000000000000000000000000000000000000000000000000000000000020000000000000000000000000000000000000000000000000000000000000008000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000003cc0b00000890000000000b00000003000000000b00000003000000000b00000003000000000b00000003000000000b00000003000000000b00000003000000000b00000117000000000b00000003000000000b00000003000000000b00000003000000000b00000003000000000b00000003000000000b00000003000000000b00000003000000000b00000003000000000b00000003000000000b00000003000000000b00000003000000000b00000003000000000b00000003000000000b00000003000000000b00000003000000000b00000003000000000b00000003000000000b00000003000000000b00000003000000000b00000003000000000b00000003000000000b00000003000000000b00000003000000000b00000003000000000b00000003000000000b00000003000000000b00000003000000000b00000003000000000b00000003000000000b00000003000000000b00000003000000000b00000003000000000b00000003000000000b00000003000000000b00000003000000000b00000003000000000b00000003000000000b00000003000000000b00000003000000000b00000003000000000b00000003000000000b00000003000000000b00000003000000000b00000003000000000b00000003000000000b00000003000000000b00000003000000000b00000003000000000b00000003000000000b00000003000000000b00000003000000000b00000003000000000b00000003000000000b00000003000000000b00000003000000000b00000003000000000b00000003000000000b00000003000000000b00000003000000000b00000003000000000b00000003000000000b00000003000000000b00000003000000000b00000003000000000b00000003000000000b00000003000000000b00000003000000000b00000003000000000b00000003000000000b00000003000000000b00000003000000000b00000003000000000b00000003000000000b00000003000000000b00000003000000000b00000003000000000b00000003000000000b00000003000000000b00000003000000000b00000003000000000b00000003000000000b00000003000000000b00000003000000000b00000003000000000b00000003000000000b00000003000000000b00000003000000000b00000003000000000b00000003000000000b00000003000000000b00000003000000000b00000003000000000b00000003000000000b00000003000000000b00000003000000000b00000003000000000b00000003000000000b00000003000000000b00000003000000000b00000003000000000000000000000000000000000000000000000000"
+
+func buildTestArchive(t *testing.T) *SequenceArchive {
+	calldata := common.FromHex(archiveTestCalldata)
+	txA := common.HexToHash("0xa1")
+	txB := common.HexToHash("0xb2")
+	l1InfoRoot := common.HexToHash("0x1234")
+
+	// compute the acc input hash of the second sequence from the first so the chain verifies
+	decoded, err := syncer.DecodeSequenceBatchesCalldata(calldata)
+	require.NoError(t, err)
+	calcFn, _, err := syncer.GetAccInputDataCalcFunction(l1InfoRoot, decoded)
+	require.NoError(t, err)
+	firstAccInputHash := common.HexToHash("0xabcd")
+
+	return &SequenceArchive{
+		Manifest: SequenceArchiveManifest{L1ChainId: 11155111, RollupId: 1},
+		Sequences: []types.L1BatchInfo{
+			{BatchNo: 11, L1BlockNo: 200, L1TxHash: txB, L1InfoRoot: l1InfoRoot},
+			{BatchNo: 10, L1BlockNo: 100, L1TxHash: txA, L1InfoRoot: l1InfoRoot},
+		},
+		Calldata: map[common.Hash][]byte{
+			txA: calldata,
+			txB: calldata,
+		},
+		AccInputHashes: map[uint64]common.Hash{
+			10: firstAccInputHash,
+			11: *calcFn(firstAccInputHash, 0),
+		},
+	}
+}
+
+func TestSequenceArchive_WriteReadVerify(t *testing.T) {
+	dir := t.TempDir()
+	archive := buildTestArchive(t)
+	require.NoError(t, WriteSequenceArchive(dir, archive))
+
+	read, err := ReadSequenceArchive(dir)
+	require.NoError(t, err)
+	require.NoError(t, read.Verify())
+
+	require.Equal(t, uint64(10), read.Manifest.FirstBatch)
+	require.Equal(t, uint64(11), read.Manifest.LastBatch)
+	require.Equal(t, uint64(100), read.Manifest.FromL1Block)
+	require.Equal(t, uint64(200), read.Manifest.ToL1Block)
+	require.Len(t, read.Sequences, 2)
+	require.Equal(t, uint64(10), read.Sequences[0].BatchNo)
+}
+
+func TestSequenceArchive_ChecksumMismatch(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, WriteSequenceArchive(dir, buildTestArchive(t)))
+
+	path := filepath.Join(dir, SequenceArchiveSequencesFile)
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(path, append(data, ' '), 0644))
+
+	_, err = ReadSequenceArchive(dir)
+	require.ErrorContains(t, err, "checksum mismatch")
+}
+
+func TestOpenSequenceArchive_Network(t *testing.T) {
+	dir := t.TempDir()
+	archive := buildTestArchive(t)
+	rollupManager := common.HexToAddress("0x32d33D5137a7cFFb54c5Bf8371172bcEc5f310ff")
+	archive.Manifest.RollupAddress = rollupManager
+	require.NoError(t, WriteSequenceArchive(dir, archive))
+
+	_, err := OpenSequenceArchive(dir, 11155111, rollupManager, 1)
+	require.NoError(t, err)
+
+	_, err = OpenSequenceArchive(dir, 1, rollupManager, 1)
+	require.ErrorContains(t, err, "l1 chain")
+	_, err = OpenSequenceArchive(dir, 11155111, common.HexToAddress("0x1"), 1)
+	require.ErrorContains(t, err, "rollup manager")
+	_, err = OpenSequenceArchive(dir, 11155111, rollupManager, 2)
+	require.ErrorContains(t, err, "rollup 1")
+}
+
+func TestSequenceArchive_AccInputHashMismatch(t *testing.T) {
+	archive := buildTestArchive(t)
+	archive.AccInputHashes[11] = common.HexToHash("0xdead")
+	sortSequenceArchive(archive)
+	require.ErrorContains(t, archive.Verify(), "accInputHash mismatch")
+}
+
+func TestImportSequenceArchive(t *testing.T) {
+	archive := buildTestArchive(t)
+	sortSequenceArchive(archive)
+
+	_, tx := memdb.NewTestTx(t)
+	require.NoError(t, hermez_db.CreateHermezBuckets(tx))
+	hermezDb := hermez_db.NewHermezDb(tx)
+
+	// only the sequence from L1 block 200 onwards should be imported
+	result, err := ImportSequenceArchive(hermezDb, archive, 150, 0, "")
+	require.NoError(t, err)
+	require.Equal(t, 1, result.Sequences)
+	require.Equal(t, uint64(11), result.HighestBatch)
+	require.Equal(t, uint64(200), result.HighestL1)
+
+	data, err := hermezDb.GetL1BatchData(10)
+	require.NoError(t, err)
+	require.Empty(t, data)
+
+	data, err = hermezDb.GetL1BatchData(11)
+	require.NoError(t, err)
+	batches, coinbase, limitTimestamp, err := DecodeL1BatchData(common.FromHex(archiveTestCalldata), "")
+	require.NoError(t, err)
+	require.Equal(t, coinbase.Bytes(), data[:20])
+	require.Equal(t, archive.Sequences[1].L1InfoRoot.Bytes(), data[20:52])
+	require.Equal(t, limitTimestamp, binary.BigEndian.Uint64(data[52:60]))
+	require.Equal(t, batches[0], data[60:])
+
+	seq, err := hermezDb.GetLatestSequence()
+	require.NoError(t, err)
+	require.Equal(t, uint64(11), seq.BatchNo)
+
+	// the imported data must be usable by the recovery the same way the live L1 sync data is
+	decoded, err := BreakDownL1DataByBatch(11, 9, hermezDb.HermezDbReader)
+	require.NoError(t, err)
+	require.Equal(t, coinbase, decoded.Coinbase)
+}
@@ -0,0 +1,470 @@
+package legacy_executor_verifier
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/ledgerwatch/erigon-lib/common"
+	"github.com/ledgerwatch/erigon-lib/kv"
+	"github.com/ledgerwatch/erigon/core/rawdb"
+	"github.com/ledgerwatch/erigon/core/state"
+	smtutils "github.com/ledgerwatch/erigon/smt/pkg/utils"
+	"github.com/ledgerwatch/erigon/zk/hermez_db"
+	"github.com/ledgerwatch/erigon/zk/legacy_executor_verifier/proto/github.com/0xPolygonHermez/zkevm-node/state/runtime/executor"
+	"github.com/ledgerwatch/log/v3"
+)
+
+// DivergenceReport describes where the executor and the node disagree on the result of a batch.  Blocks and
+// transactions are compared in order so the first divergence points at where the executions split, the accounts are
+// the post-batch values the executor read or wrote that differ from our state after the last block of the batch.
+type DivergenceReport struct {
+	BatchNumber          uint64              `json:"batchNumber"`
+	ForkId               uint64              `json:"forkId"`
+	ExecutorForkId       uint64              `json:"executorForkId"`
+	Executor             string              `json:"executor"`
+	CreatedAt            time.Time           `json:"createdAt"`
+	BlockNumbers         []uint64            `json:"blockNumbers"`
+	OurOldStateRoot      common.Hash         `json:"ourOldStateRoot"`
+	ExecutorOldStateRoot common.Hash         `json:"executorOldStateRoot"`
+	OurNewStateRoot      common.Hash         `json:"ourNewStateRoot"`
+	ExecutorNewStateRoot common.Hash         `json:"executorNewStateRoot"`
+	FirstDivergence      *DivergencePoint    `json:"firstDivergence"`
+	Batch                []FieldDivergence   `json:"batch,omitempty"`
+	Blocks               []BlockDivergence   `json:"blocks,omitempty"`
+	Accounts             []AccountDivergence `json:"accounts,omitempty"`
+}
+
+// DivergencePoint is the earliest place the report found a difference, fields are only set down to the level the
+// divergence could be narrowed to
+type DivergencePoint struct {
+	BlockNumber *uint64         `json:"blockNumber,omitempty"`
+	TxIndex     *int            `json:"txIndex,omitempty"`
+	TxHash      *common.Hash    `json:"txHash,omitempty"`
+	Address     *common.Address `json:"address,omitempty"`
+	StorageKey  *common.Hash    `json:"storageKey,omitempty"`
+	Field       string          `json:"field"`
+}
+
+type FieldDivergence struct {
+	Field    string `json:"field"`
+	Ours     string `json:"ours"`
+	Executor string `json:"executor"`
+}
+
+type BlockDivergence struct {
+	Index        int               `json:"index"`
+	BlockNumber  uint64            `json:"blockNumber"`
+	Fields       []FieldDivergence `json:"fields,omitempty"`
+	Transactions []TxDivergence    `json:"transactions,omitempty"`
+}
+
+type TxDivergence struct {
+	Index  int               `json:"index"`
+	Hash   common.Hash       `json:"hash"`
+	Fields []FieldDivergence `json:"fields"`
+}
+
+type AccountDivergence struct {
+	Address common.Address      `json:"address"`
+	Fields  []FieldDivergence   `json:"fields,omitempty"`
+	Storage []StorageDivergence `json:"storage,omitempty"`
+}
+
+type StorageDivergence struct {
+	Key      common.Hash `json:"key"`
+	Ours     string      `json:"ours"`
+	Executor string      `json:"executor"`
+}
+
+// ourBlock is what the node recorded for a block of the batch, in the shape of the executor block response
+type ourBlock struct {
+	number        uint64
+	timestamp     uint64
+	coinbase      common.Address
+	gasUsed       uint64
+	ger           common.Hash
+	blockInfoRoot common.Hash
+	txs           []ourTx
+}
+
+type ourTx struct {
+	hash                common.Hash
+	status              uint64
+	cumulativeGasUsed   uint64
+	effectivePercentage uint8
+	stateRoot           common.Hash
+}
+
+// DiagnoseDivergence compares the executor response for a batch against our own blocks and post-batch state
+func DiagnoseDivergence(tx kv.Tx, request *VerifierRequest, resp *executor.ProcessBatchResponseV2, oldStateRoot common.Hash, executorUrl string) (*DivergenceReport, error) {
+	report := &DivergenceReport{
+		BatchNumber:          request.BatchNumber,
+		ForkId:               request.ForkId,
+		ExecutorForkId:       resp.ForkId,
+		Executor:             executorUrl,
+		CreatedAt:            time.Now().UTC(),
+		BlockNumbers:         request.BlockNumbers,
+		OurOldStateRoot:      oldStateRoot,
+		ExecutorOldStateRoot: common.BytesToHash(resp.OldStateRoot),
+		OurNewStateRoot:      request.StateRoot,
+		ExecutorNewStateRoot: common.BytesToHash(resp.NewStateRoot),
+	}
+
+	// a different starting point means the witness is wrong rather than the execution
+	if report.OurOldStateRoot != report.ExecutorOldStateRoot {
+		report.Batch = append(report.Batch, hashDivergence("oldStateRoot", report.OurOldStateRoot, report.ExecutorOldStateRoot))
+	}
+	if len(request.BlockNumbers) != len(resp.BlockResponses) {
+		report.Batch = append(report.Batch, uintDivergence("blockCount", uint64(len(request.BlockNumbers)), uint64(len(resp.BlockResponses))))
+	}
+
+	hermezDb := hermez_db.NewHermezDbReader(tx)
+	ours, err := loadOurBlocks(tx, hermezDb, request.BlockNumbers)
+	if err != nil {
+		return nil, err
+	}
+	report.Blocks = compareBlocks(ours, resp.BlockResponses)
+
+	// the post-batch state is read as of the block after the batch as the sequencer may have moved on since
+	reader := state.NewPlainState(tx, request.GetLastBlockNumber()+1, nil)
+	defer reader.Close()
+	if report.Accounts, err = compareAccounts(reader, resp.ReadWriteAddresses); err != nil {
+		return nil, err
+	}
+
+	report.FirstDivergence = report.firstDivergence()
+
+	return report, nil
+}
+
+func (r *DivergenceReport) firstDivergence() *DivergencePoint {
+	if len(r.Batch) > 0 {
+		return &DivergencePoint{Field: r.Batch[0].Field}
+	}
+
+	if len(r.Blocks) > 0 {
+		b := r.Blocks[0]
+		point := &DivergencePoint{BlockNumber: &b.BlockNumber}
+		// transactions run before the block level values are settled so they take precedence
+		if len(b.Transactions) > 0 {
+			t := b.Transactions[0]
+			point.TxIndex = &t.Index
+			point.TxHash = &t.Hash
+			point.Field = t.Fields[0].Field
+		} else {
+			point.Field = b.Fields[0].Field
+		}
+		return point
+	}
+
+	if len(r.Accounts) > 0 {
+		a := r.Accounts[0]
+		point := &DivergencePoint{Address: &a.Address}
+		if len(a.Fields) > 0 {
+			point.Field = a.Fields[0].Field
+		} else {
+			point.StorageKey = &a.Storage[0].Key
+			point.Field = "storage"
+		}
+		return point
+	}
+
+	return nil
+}
+
+func loadOurBlocks(tx kv.Tx, hermezDb *hermez_db.HermezDbReader, blockNumbers []uint64) ([]ourBlock, error) {
+	blocks := make([]ourBlock, 0, len(blockNumbers))
+	for _, blockNumber := range blockNumbers {
+		block, err := rawdb.ReadBlockByNumber(tx, blockNumber)
+		if err != nil {
+			return nil, err
+		}
+		if block == nil {
+			return nil, fmt.Errorf("block %d not found", blockNumber)
+		}
+
+		ger, err := hermezDb.GetBlockGlobalExitRoot(blockNumber)
+		if err != nil {
+			return nil, err
+		}
+		blockInfoRoot, err := hermezDb.GetBlockInfoRoot(blockNumber)
+		if err != nil {
+			return nil, err
+		}
+
+		ob := ourBlock{
+			number:        blockNumber,
+			timestamp:     block.Time(),
+			coinbase:      block.Coinbase(),
+			gasUsed:       block.GasUsed(),
+			ger:           ger,
+			blockInfoRoot: blockInfoRoot,
+			txs:           make([]ourTx, 0, len(block.Transactions())),
+		}
+
+		receipts := rawdb.ReadRawReceipts(tx, blockNumber)
+		for i, transaction := range block.Transactions() {
+			t := ourTx{hash: transaction.Hash()}
+			if i < len(receipts) && receipts[i] != nil {
+				t.status = receipts[i].Status
+				t.cumulativeGasUsed = receipts[i].CumulativeGasUsed
+			}
+			if t.effectivePercentage, err = hermezDb.GetEffectiveGasPricePercentage(t.hash); err != nil {
+				return nil, err
+			}
+			if t.stateRoot, err = hermezDb.GetIntermediateTxStateRoot(blockNumber, t.hash); err != nil {
+				return nil, err
+			}
+			ob.txs = append(ob.txs, t)
+		}
+
+		blocks = append(blocks, ob)
+	}
+
+	return blocks, nil
+}
+
+func compareBlocks(ours []ourBlock, responses []*executor.ProcessBlockResponseV2) []BlockDivergence {
+	var divergences []BlockDivergence
+	for i := 0; i < len(ours) && i < len(responses); i++ {
+		o, e := ours[i], responses[i]
+
+		d := BlockDivergence{Index: i, BlockNumber: o.number}
+		if o.number != e.BlockNumber {
+			d.Fields = append(d.Fields, uintDivergence("blockNumber", o.number, e.BlockNumber))
+		}
+		if o.timestamp != e.Timestamp {
+			d.Fields = append(d.Fields, uintDivergence("timestamp", o.timestamp, e.Timestamp))
+		}
+		if executorCoinbase := common.HexToAddress(e.Coinbase); o.coinbase != executorCoinbase {
+			d.Fields = append(d.Fields, FieldDivergence{Field: "coinbase", Ours: o.coinbase.Hex(), Executor: executorCoinbase.Hex()})
+		}
+		if o.gasUsed != e.GasUsed {
+			d.Fields = append(d.Fields, uintDivergence("gasUsed", o.gasUsed, e.GasUsed))
+		}
+		if executorGer := common.BytesToHash(e.Ger); o.ger != executorGer {
+			d.Fields = append(d.Fields, hashDivergence("ger", o.ger, executorGer))
+		}
+		if executorInfoRoot := common.BytesToHash(e.BlockInfoRoot); o.blockInfoRoot != (common.Hash{}) && o.blockInfoRoot != executorInfoRoot {
+			d.Fields = append(d.Fields, hashDivergence("blockInfoRoot", o.blockInfoRoot, executorInfoRoot))
+		}
+		if len(o.txs) != len(e.Responses) {
+			d.Fields = append(d.Fields, uintDivergence("txCount", uint64(len(o.txs)), uint64(len(e.Responses))))
+		}
+		if e.Error != executor.RomError_ROM_ERROR_UNSPECIFIED && e.Error != executor.RomError_ROM_ERROR_NO_ERROR {
+			d.Fields = append(d.Fields, FieldDivergence{Field: "error", Ours: executor.RomError_ROM_ERROR_NO_ERROR.String(), Executor: e.Error.String()})
+		}
+
+		d.Transactions = compareTransactions(o.txs, e.Responses)
+
+		if len(d.Fields) > 0 || len(d.Transactions) > 0 {
+			divergences = append(divergences, d)
+		}
+	}
+	return divergences
+}
+
+func compareTransactions(ours []ourTx, responses []*executor.ProcessTransactionResponseV2) []TxDivergence {
+	var divergences []TxDivergence
+	for i := 0; i < len(ours) && i < len(responses); i++ {
+		o, e := ours[i], responses[i]
+
+		d := TxDivergence{Index: i, Hash: o.hash}
+		if executorHash := common.BytesToHash(e.TxHash); o.hash != executorHash {
+			d.Fields = append(d.Fields, hashDivergence("hash", o.hash, executorHash))
+		}
+		if o.status != uint64(e.Status) {
+			d.Fields = append(d.Fields, uintDivergence("status", o.status, uint64(e.Status)))
+		}
+		if o.cumulativeGasUsed != e.CumulativeGasUsed {
+			d.Fields = append(d.Fields, uintDivergence("cumulativeGasUsed", o.cumulativeGasUsed, e.CumulativeGasUsed))
+		}
+		if uint32(o.effectivePercentage) != e.EffectivePercentage {
+			d.Fields = append(d.Fields, uintDivergence("effectivePercentage", uint64(o.effectivePercentage), uint64(e.EffectivePercentage)))
+		}
+		// intermediate roots are not kept for every fork so only compare when we have one
+		if executorRoot := common.BytesToHash(e.StateRoot); o.stateRoot != (common.Hash{}) && o.stateRoot != executorRoot {
+			d.Fields = append(d.Fields, hashDivergence("stateRoot", o.stateRoot, executorRoot))
+		}
+
+		if len(d.Fields) > 0 {
+			divergences = append(divergences, d)
+		}
+	}
+	return divergences
+}
+
+// compareAccounts compares the values the executor returned for every address it touched, empty values are the
+// ones the executor did not report
+func compareAccounts(reader state.StateReader, addresses map[string]*executor.InfoReadWriteV2) ([]AccountDivergence, error) {
+	var divergences []AccountDivergence
+	for addrStr, info := range addresses {
+		if info == nil {
+			continue
+		}
+		address := common.HexToAddress(addrStr)
+
+		acc, err := reader.ReadAccountData(address)
+		if err != nil {
+			return nil, err
+		}
+
+		var (
+			nonce       uint64
+			balance     = new(big.Int)
+			incarnation uint64
+			code        []byte
+		)
+		if acc != nil {
+			nonce = acc.Nonce
+			balance = acc.Balance.ToBig()
+			incarnation = acc.Incarnation
+			if code, err = reader.ReadAccountCode(address, incarnation, acc.CodeHash); err != nil {
+				return nil, err
+			}
+		}
+
+		d := AccountDivergence{Address: address}
+		if info.Nonce != "" {
+			if n, ok := parseExecutorValue(info.Nonce, 10); !ok || n.Cmp(new(big.Int).SetUint64(nonce)) != 0 {
+				d.Fields = append(d.Fields, FieldDivergence{Field: "nonce", Ours: fmt.Sprintf("%d", nonce), Executor: info.Nonce})
+			}
+		}
+		if info.Balance != "" {
+			if b, ok := parseExecutorValue(info.Balance, 10); !ok || b.Cmp(balance) != 0 {
+				d.Fields = append(d.Fields, FieldDivergence{Field: "balance", Ours: balance.String(), Executor: info.Balance})
+			}
+		}
+		if info.ScCode != "" {
+			if ours, matches := compareCode(code, info.ScCode); !matches {
+				d.Fields = append(d.Fields, FieldDivergence{Field: "code", Ours: ours, Executor: info.ScCode})
+			}
+		}
+		if info.ScLength != "" {
+			if l, ok := parseExecutorValue(info.ScLength, 10); !ok || l.Cmp(big.NewInt(int64(len(code)))) != 0 {
+				d.Fields = append(d.Fields, FieldDivergence{Field: "codeLength", Ours: fmt.Sprintf("%d", len(code)), Executor: info.ScLength})
+			}
+		}
+
+		for keyStr, value := range info.ScStorage {
+			key := common.HexToHash(keyStr)
+			raw, err := reader.ReadAccountStorage(address, incarnation, &key)
+			if err != nil {
+				return nil, err
+			}
+			ours := new(big.Int).SetBytes(raw)
+			if v, ok := parseExecutorValue(value, 16); !ok || v.Cmp(ours) != 0 {
+				d.Storage = append(d.Storage, StorageDivergence{Key: key, Ours: "0x" + ours.Text(16), Executor: value})
+			}
+		}
+		sort.Slice(d.Storage, func(i, j int) bool {
+			return bytes.Compare(d.Storage[i].Key.Bytes(), d.Storage[j].Key.Bytes()) < 0
+		})
+
+		if len(d.Fields) > 0 || len(d.Storage) > 0 {
+			divergences = append(divergences, d)
+		}
+	}
+
+	// the executor returns a map so order by address to keep reports comparable
+	sort.Slice(divergences, func(i, j int) bool {
+		return bytes.Compare(divergences[i].Address.Bytes(), divergences[j].Address.Bytes()) < 0
+	})
+
+	return divergences, nil
+}
+
+// compareCode compares our bytecode with the executor value which is either the bytecode itself or its smt hash
+func compareCode(code []byte, executorCode string) (string, bool) {
+	raw := strings.TrimPrefix(executorCode, "0x")
+	if len(raw) > 64 {
+		ours := hex.EncodeToString(code)
+		return "0x" + ours, strings.EqualFold(ours, raw)
+	}
+
+	ourHash := new(big.Int)
+	if len(code) > 0 {
+		ourHash = smtutils.HashContractBytecodeBigInt(hex.EncodeToString(code))
+	}
+	executorHash, ok := new(big.Int).SetString(raw, 16)
+	return "0x" + ourHash.Text(16), ok && executorHash.Cmp(ourHash) == 0
+}
+
+// parseExecutorValue parses a number from the executor, hex values may or may not carry a prefix
+func parseExecutorValue(s string, base int) (*big.Int, bool) {
+	if strings.HasPrefix(s, "0x") {
+		s, base = s[2:], 16
+	}
+	if s == "" {
+		return new(big.Int), true
+	}
+	return new(big.Int).SetString(s, base)
+}
+
+func uintDivergence(field string, ours, executor uint64) FieldDivergence {
+	return FieldDivergence{Field: field, Ours: fmt.Sprintf("%d", ours), Executor: fmt.Sprintf("%d", executor)}
+}
+
+func hashDivergence(field string, ours, executor common.Hash) FieldDivergence {
+	return FieldDivergence{Field: field, Ours: ours.Hex(), Executor: executor.Hex()}
+}
+
+// recordDivergence diagnoses a state root mismatch and writes the report next to the executor payload if payloads are
+// being written, the sequencer stores the report of the response with the batch
+func (v *LegacyExecutorVerifier) recordDivergence(tx kv.Tx, e *Executor, request *VerifierRequest, resp *executor.ProcessBatchResponseV2, oldStateRoot common.Hash) *DivergenceReport {
+	report, err := DiagnoseDivergence(tx, request, resp, oldStateRoot, e.grpcUrl)
+	if err != nil {
+		log.Error("[Verifier] Failed to diagnose the executor divergence", "batch", request.BatchNumber, "err", err)
+		return nil
+	}
+
+	logArgs := []interface{}{"batch", request.BatchNumber, "divergent-blocks", len(report.Blocks), "divergent-accounts", len(report.Accounts)}
+	if p := report.FirstDivergence; p != nil {
+		logArgs = append(logArgs, "field", p.Field)
+		if p.BlockNumber != nil {
+			logArgs = append(logArgs, "block", *p.BlockNumber)
+		}
+		if p.TxHash != nil {
+			logArgs = append(logArgs, "tx-index", *p.TxIndex, "tx", *p.TxHash)
+		}
+		if p.Address != nil {
+			logArgs = append(logArgs, "address", *p.Address)
+		}
+		if p.StorageKey != nil {
+			logArgs = append(logArgs, "storage-key", *p.StorageKey)
+		}
+	}
+	log.Error("[Verifier] Executor divergence", logArgs...)
+
+	asJson, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		log.Error("[Verifier] Failed to encode the executor divergence", "batch", request.BatchNumber, "err", err)
+		return report
+	}
+
+	if e.outputLocation != "" {
+		file := path.Join(e.outputLocation, fmt.Sprintf("divergence_%d.json", request.BatchNumber))
+		if err := os.WriteFile(file, asJson, 0644); err != nil {
+			log.Error("[Verifier] Failed to write the executor divergence", "file", file, "err", err)
+		}
+	}
+
+	return report
+}
+
+// WriteExecutorDivergence stores the report of the batch for zkevm_getExecutorDivergence
+func WriteExecutorDivergence(hermezDb *hermez_db.HermezDb, batchNumber uint64, report *DivergenceReport) error {
+	asJson, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return err
+	}
+	return hermezDb.WriteExecutorDivergence(batchNumber, asJson)
+}
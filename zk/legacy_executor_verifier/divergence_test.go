@@ -0,0 +1,148 @@
+package legacy_executor_verifier
+
+import (
+	"encoding/hex"
+	"testing"
+
+	"github.com/holiman/uint256"
+	"github.com/ledgerwatch/erigon-lib/common"
+	"github.com/ledgerwatch/erigon/core/types/accounts"
+	smtutils "github.com/ledgerwatch/erigon/smt/pkg/utils"
+	"github.com/ledgerwatch/erigon/zk/legacy_executor_verifier/proto/github.com/0xPolygonHermez/zkevm-node/state/runtime/executor"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type testStateReader struct {
+	accounts map[common.Address]*accounts.Account
+	code     map[common.Address][]byte
+	storage  map[common.Address]map[common.Hash][]byte
+}
+
+func (r *testStateReader) ReadAccountData(address common.Address) (*accounts.Account, error) {
+	return r.accounts[address], nil
+}
+
+func (r *testStateReader) ReadAccountStorage(address common.Address, _ uint64, key *common.Hash) ([]byte, error) {
+	return r.storage[address][*key], nil
+}
+
+func (r *testStateReader) ReadAccountCode(address common.Address, _ uint64, _ common.Hash) ([]byte, error) {
+	return r.code[address], nil
+}
+
+func (r *testStateReader) ReadAccountCodeSize(address common.Address, _ uint64, _ common.Hash) (int, error) {
+	return len(r.code[address]), nil
+}
+
+func (r *testStateReader) ReadAccountIncarnation(common.Address) (uint64, error) {
+	return 0, nil
+}
+
+func TestCompareBlocks(t *testing.T) {
+	txA, txB := common.HexToHash("0xa"), common.HexToHash("0xb")
+	ours := []ourBlock{
+		{number: 10, timestamp: 100, gasUsed: 21000, txs: []ourTx{{hash: txA, status: 1, cumulativeGasUsed: 21000, effectivePercentage: 255}}},
+		{number: 11, timestamp: 101, gasUsed: 42000, txs: []ourTx{
+			{hash: txA, status: 1, cumulativeGasUsed: 21000, effectivePercentage: 255},
+			{hash: txB, status: 1, cumulativeGasUsed: 42000, effectivePercentage: 255, stateRoot: common.HexToHash("0x1")},
+		}},
+	}
+	responses := []*executor.ProcessBlockResponseV2{
+		{BlockNumber: 10, Timestamp: 100, GasUsed: 21000, Coinbase: "0x0000000000000000000000000000000000000000", Responses: []*executor.ProcessTransactionResponseV2{
+			{TxHash: txA.Bytes(), Status: 1, CumulativeGasUsed: 21000, EffectivePercentage: 255},
+		}},
+		{BlockNumber: 11, Timestamp: 101, GasUsed: 40000, Responses: []*executor.ProcessTransactionResponseV2{
+			{TxHash: txA.Bytes(), Status: 1, CumulativeGasUsed: 21000, EffectivePercentage: 255},
+			{TxHash: txB.Bytes(), Status: 0, CumulativeGasUsed: 40000, EffectivePercentage: 255, StateRoot: common.HexToHash("0x2").Bytes()},
+		}},
+	}
+
+	divergences := compareBlocks(ours, responses)
+	require.Len(t, divergences, 1)
+
+	block := divergences[0]
+	assert.Equal(t, uint64(11), block.BlockNumber)
+	assert.Equal(t, []FieldDivergence{{Field: "gasUsed", Ours: "42000", Executor: "40000"}}, block.Fields)
+	require.Len(t, block.Transactions, 1)
+	assert.Equal(t, 1, block.Transactions[0].Index)
+	assert.Equal(t, txB, block.Transactions[0].Hash)
+
+	fields := make([]string, 0, len(block.Transactions[0].Fields))
+	for _, f := range block.Transactions[0].Fields {
+		fields = append(fields, f.Field)
+	}
+	assert.Equal(t, []string{"status", "cumulativeGasUsed", "stateRoot"}, fields)
+
+	report := &DivergenceReport{Blocks: divergences}
+	first := report.firstDivergence()
+	require.NotNil(t, first)
+	assert.Equal(t, uint64(11), *first.BlockNumber)
+	assert.Equal(t, 1, *first.TxIndex)
+	assert.Equal(t, txB, *first.TxHash)
+	assert.Equal(t, "status", first.Field)
+}
+
+func TestCompareAccounts(t *testing.T) {
+	addrA := common.HexToAddress("0x0a")
+	addrB := common.HexToAddress("0x0b")
+	addrC := common.HexToAddress("0x0c")
+	slot := common.HexToHash("0x01")
+	code := []byte{0x60, 0x01, 0x60, 0x02}
+
+	reader := &testStateReader{
+		accounts: map[common.Address]*accounts.Account{
+			addrA: {Nonce: 3, Balance: *uint256.NewInt(1000)},
+			addrB: {Nonce: 1, Balance: *uint256.NewInt(5)},
+		},
+		code: map[common.Address][]byte{addrB: code},
+		storage: map[common.Address]map[common.Hash][]byte{
+			addrB: {slot: {0x05}},
+		},
+	}
+
+	addresses := map[string]*executor.InfoReadWriteV2{
+		// matches
+		addrA.Hex(): {Nonce: "3", Balance: "1000"},
+		// storage differs, code hash matches
+		addrB.Hex(): {
+			Nonce:     "1",
+			ScCode:    smtutils.HashContractBytecode(hex.EncodeToString(code)),
+			ScLength:  "4",
+			ScStorage: map[string]string{slot.Hex(): "0x6"},
+		},
+		// we have no such account
+		addrC.Hex(): {Nonce: "0", Balance: "7"},
+	}
+
+	divergences, err := compareAccounts(reader, addresses)
+	require.NoError(t, err)
+	require.Len(t, divergences, 2)
+
+	assert.Equal(t, addrB, divergences[0].Address)
+	assert.Empty(t, divergences[0].Fields)
+	assert.Equal(t, []StorageDivergence{{Key: slot, Ours: "0x5", Executor: "0x6"}}, divergences[0].Storage)
+
+	assert.Equal(t, addrC, divergences[1].Address)
+	assert.Equal(t, []FieldDivergence{{Field: "balance", Ours: "0", Executor: "7"}}, divergences[1].Fields)
+
+	report := &DivergenceReport{Accounts: divergences}
+	first := report.firstDivergence()
+	require.NotNil(t, first)
+	assert.Nil(t, first.BlockNumber)
+	assert.Equal(t, addrB, *first.Address)
+	assert.Equal(t, slot, *first.StorageKey)
+}
+
+func TestCompareCode(t *testing.T) {
+	code := []byte{0x60, 0x01}
+
+	_, matches := compareCode(code, smtutils.HashContractBytecode(hex.EncodeToString(code)))
+	assert.True(t, matches)
+
+	_, matches = compareCode(nil, "0x0")
+	assert.True(t, matches)
+
+	_, matches = compareCode(code, "0x1234")
+	assert.False(t, matches)
+}
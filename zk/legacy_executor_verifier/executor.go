@@ -26,11 +26,16 @@ var (
 	ErrExecutorUnknownError      = errors.New("unknown error from executor")
 )
 
+// defaultExecutorTimeout is used for executors created without a request timeout
+const defaultExecutorTimeout = 60 * time.Second
+
 type Config struct {
 	GrpcUrls              []string
 	Timeout               time.Duration
 	MaxConcurrentRequests int
 	OutputLocation        string
+	// UrlSettings overrides the settings above for individual executor urls
+	UrlSettings map[string]ExecutorSettings
 }
 
 type Payload struct {
@@ -61,6 +66,10 @@ type Executor struct {
 	connCancel context.CancelFunc
 	client     executor.ExecutorServiceClient
 	semaphore  chan struct{}
+	timeout    time.Duration
+	// weight is the relative share of requests the executor gets compared to the others in the pool when they are
+	// equally healthy
+	weight float64
 
 	// if not empty then the executor will write the payload to this location before sending it to the
 	// remote executor
@@ -70,7 +79,20 @@ type Executor struct {
 func NewExecutors(cfg Config) []*Executor {
 	executors := make([]*Executor, len(cfg.GrpcUrls))
 	for i, grpcUrl := range cfg.GrpcUrls {
-		executors[i] = NewExecutor(grpcUrl, cfg.Timeout, cfg.MaxConcurrentRequests, cfg.OutputLocation)
+		timeout, maxConcurrentRequests, weight := cfg.Timeout, cfg.MaxConcurrentRequests, 1.0
+		if settings, ok := cfg.UrlSettings[grpcUrl]; ok {
+			if settings.Timeout > 0 {
+				timeout = settings.Timeout
+			}
+			if settings.MaxConcurrentRequests > 0 {
+				maxConcurrentRequests = settings.MaxConcurrentRequests
+			}
+			if settings.Weight > 0 {
+				weight = settings.Weight
+			}
+		}
+		executors[i] = NewExecutor(grpcUrl, timeout, maxConcurrentRequests, cfg.OutputLocation)
+		executors[i].weight = weight
 	}
 	return executors
 }
@@ -94,6 +116,8 @@ func NewExecutor(grpcUrl string, timeout time.Duration, maxConcurrentRequests in
 		connCancel:     cancel,
 		client:         client,
 		semaphore:      make(chan struct{}, maxConcurrentRequests),
+		timeout:        timeout,
+		weight:         1,
 		outputLocation: outputLocation,
 	}
 
@@ -159,7 +183,18 @@ func (e *Executor) CheckOnline() bool {
 }
 
 func (e *Executor) Verify(p *Payload, request *VerifierRequest, oldStateRoot common.Hash) (bool, *executor.ProcessBatchResponseV2, error, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), 60*time.Second)
+	return e.verify(context.Background(), p, request, oldStateRoot, true)
+}
+
+// verify sends the payload to the executor, the request is abandoned once ctx is cancelled or the executor timeout
+// passes.  The payload is only written to the output location when writePayload is set so hedged requests for the
+// same batch don't write the same files concurrently.
+func (e *Executor) verify(ctx context.Context, p *Payload, request *VerifierRequest, oldStateRoot common.Hash, writePayload bool) (bool, *executor.ProcessBatchResponseV2, error, error) {
+	timeout := e.timeout
+	if timeout <= 0 {
+		timeout = defaultExecutorTimeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
 	defer cancel()
 
 	correlation := uuid.New().String()
@@ -189,7 +224,7 @@ func (e *Executor) Verify(p *Payload, request *VerifierRequest, oldStateRoot com
 		L1InfoTreeIndexMinTimestamp: p.L1InfoTreeMinTimestamps,
 	}
 
-	if e.outputLocation != "" {
+	if writePayload && e.outputLocation != "" {
 		asJson, err := json.Marshal(grpcRequest)
 		if err != nil {
 			return false, nil, nil, err
@@ -215,6 +250,11 @@ func (e *Executor) Verify(p *Payload, request *VerifierRequest, oldStateRoot com
 		if err != nil {
 			return false, nil, nil, err
 		}
+
+		// and what we expect the executor to return so the payload can be replayed against other executors later on
+		if err = writeRecordedExpectation(e.outputLocation, request, oldStateRoot); err != nil {
+			return false, nil, nil, err
+		}
 	}
 
 	resp, err := e.client.ProcessStatelessBatchV2(ctx, grpcRequest, grpc.MaxCallSendMsgSize(size), grpc.MaxCallRecvMsgSize(size))
@@ -225,16 +265,7 @@ func (e *Executor) Verify(p *Payload, request *VerifierRequest, oldStateRoot com
 		return false, nil, nil, fmt.Errorf("nil response")
 	}
 
-	counters := map[string]int{
-		"SHA": int(resp.CntSha256Hashes),
-		"A":   int(resp.CntArithmetics),
-		"B":   int(resp.CntBinaries),
-		"K":   int(resp.CntKeccakHashes),
-		"M":   int(resp.CntMemAligns),
-		"P":   int(resp.CntPoseidonHashes),
-		"S":   int(resp.CntSteps),
-		"D":   int(resp.CntPoseidonPaddings),
-	}
+	counters := ResponseCounters(resp)
 
 	match := bytes.Equal(resp.NewStateRoot, request.StateRoot.Bytes())
 
@@ -280,11 +311,26 @@ func (e *Executor) Verify(p *Payload, request *VerifierRequest, oldStateRoot com
 
 	log.Debug("Received response from executor", "grpcUrl", e.grpcUrl, "response", resp)
 
-	ok, executorResponse, executorErr := responseCheck(resp, request)
+	ok, executorResponse, executorErr := CheckResponse(resp, request)
 	return ok, executorResponse, executorErr, nil
 }
 
-func responseCheck(resp *executor.ProcessBatchResponseV2, request *VerifierRequest) (bool, *executor.ProcessBatchResponseV2, error) {
+// ResponseCounters returns the counters used by the executor keyed like the counters of a VerifierRequest
+func ResponseCounters(resp *executor.ProcessBatchResponseV2) map[string]int {
+	return map[string]int{
+		"SHA": int(resp.CntSha256Hashes),
+		"A":   int(resp.CntArithmetics),
+		"B":   int(resp.CntBinaries),
+		"K":   int(resp.CntKeccakHashes),
+		"M":   int(resp.CntMemAligns),
+		"P":   int(resp.CntPoseidonHashes),
+		"S":   int(resp.CntSteps),
+		"D":   int(resp.CntPoseidonPaddings),
+	}
+}
+
+// CheckResponse checks the response of the executor against the request it was sent for
+func CheckResponse(resp *executor.ProcessBatchResponseV2, request *VerifierRequest) (bool, *executor.ProcessBatchResponseV2, error) {
 	if resp.ForkId != request.ForkId {
 		log.Warn("Executor fork id mismatch", "executor", resp.ForkId, "our", request.ForkId)
 	}
@@ -0,0 +1,494 @@
+package legacy_executor_verifier
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ledgerwatch/erigon-lib/common"
+	"github.com/ledgerwatch/erigon-lib/metrics"
+	"github.com/ledgerwatch/erigon/zk/legacy_executor_verifier/proto/github.com/0xPolygonHermez/zkevm-node/state/runtime/executor"
+	"github.com/ledgerwatch/log/v3"
+)
+
+const (
+	// breakerWindow is the number of most recent requests the error rate of an executor is calculated over
+	breakerWindow = 20
+	// breakerMinRequests is the number of requests in the window needed before the breaker can open
+	breakerMinRequests = 5
+	// readmitSteps is the number of successful requests a re-admitted executor needs before it gets its full weight
+	// back, every success in between raises its share by another step
+	readmitSteps = 4
+	// latencyEwmaAlpha is the weight of the latest request in the latency moving average
+	latencyEwmaAlpha = 0.2
+	// unknownLatency is assumed for executors that haven't answered a request yet
+	unknownLatency = time.Second
+)
+
+type breakerState int
+
+const (
+	breakerClosed breakerState = iota
+	breakerOpen
+	breakerHalfOpen
+)
+
+func (s breakerState) String() string {
+	switch s {
+	case breakerClosed:
+		return "closed"
+	case breakerOpen:
+		return "open"
+	case breakerHalfOpen:
+		return "half-open"
+	default:
+		return "unknown"
+	}
+}
+
+// ExecutorSettings overrides the pool wide executor settings for a single executor url, zero values keep the pool
+// wide setting
+type ExecutorSettings struct {
+	Timeout               time.Duration
+	Weight                float64
+	MaxConcurrentRequests int
+}
+
+// ParseExecutorSettings parses per executor settings in the form
+// "url,timeout=30s,weight=2,max-concurrent=4;url2,weight=0.5"
+func ParseExecutorSettings(s string) (map[string]ExecutorSettings, error) {
+	result := make(map[string]ExecutorSettings)
+	for _, entry := range strings.Split(s, ";") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		fields := strings.Split(entry, ",")
+		url := strings.TrimSpace(fields[0])
+		if url == "" {
+			return nil, fmt.Errorf("missing executor url in %q", entry)
+		}
+		if _, ok := result[url]; ok {
+			return nil, fmt.Errorf("duplicate settings for executor %s", url)
+		}
+
+		var settings ExecutorSettings
+		for _, field := range fields[1:] {
+			key, value, ok := strings.Cut(strings.TrimSpace(field), "=")
+			if !ok {
+				return nil, fmt.Errorf("invalid setting %q for executor %s, expected key=value", field, url)
+			}
+			switch key {
+			case "timeout":
+				timeout, err := time.ParseDuration(value)
+				if err != nil || timeout <= 0 {
+					return nil, fmt.Errorf("invalid timeout %q for executor %s", value, url)
+				}
+				settings.Timeout = timeout
+			case "weight":
+				weight, err := strconv.ParseFloat(value, 64)
+				if err != nil || weight <= 0 {
+					return nil, fmt.Errorf("invalid weight %q for executor %s", value, url)
+				}
+				settings.Weight = weight
+			case "max-concurrent":
+				maxConcurrent, err := strconv.Atoi(value)
+				if err != nil || maxConcurrent <= 0 {
+					return nil, fmt.Errorf("invalid max-concurrent %q for executor %s", value, url)
+				}
+				settings.MaxConcurrentRequests = maxConcurrent
+			default:
+				return nil, fmt.Errorf("unknown setting %q for executor %s", key, url)
+			}
+		}
+		result[url] = settings
+	}
+	return result, nil
+}
+
+type PoolConfig struct {
+	// BreakerErrorRate is the share of failed requests in the window that opens the breaker of an executor, 0
+	// disables the breaker
+	BreakerErrorRate float64
+	// BreakerCooldown is how long an executor is left alone after its breaker opened before a probe request is sent
+	BreakerCooldown time.Duration
+	// HedgeAfter is how long to wait for an executor before sending the same request to the next best one, 0 disables
+	// hedging
+	HedgeAfter time.Duration
+}
+
+// executorHealth tracks the latency and the circuit breaker of a single executor
+type executorHealth struct {
+	mtx sync.Mutex
+	cfg PoolConfig
+	now func() time.Time
+
+	latency  time.Duration
+	outcomes [breakerWindow]bool // true for failed requests
+	next     int
+	count    int
+
+	state    breakerState
+	openedAt time.Time
+	probing  bool
+	// readmitted counts the successful requests since the breaker closed, the executor is back at full weight once
+	// it reaches readmitSteps
+	readmitted int
+
+	metrics executorMetrics
+}
+
+func newExecutorHealth(cfg PoolConfig, url string) *executorHealth {
+	return &executorHealth{
+		cfg:        cfg,
+		now:        time.Now,
+		readmitted: readmitSteps,
+		metrics:    newExecutorMetrics(url),
+	}
+}
+
+// available reports whether the breaker lets a request through without reserving it
+func (h *executorHealth) available() bool {
+	h.mtx.Lock()
+	defer h.mtx.Unlock()
+	h.checkCooldown()
+	return h.state == breakerClosed || (h.state == breakerHalfOpen && !h.probing)
+}
+
+// begin reserves a request, a half open breaker only lets a single probe through at a time
+func (h *executorHealth) begin() bool {
+	h.mtx.Lock()
+	defer h.mtx.Unlock()
+	h.checkCooldown()
+	switch h.state {
+	case breakerClosed:
+		return true
+	case breakerHalfOpen:
+		if h.probing {
+			return false
+		}
+		h.probing = true
+		return true
+	default:
+		return false
+	}
+}
+
+// abandon releases a request reserved by begin that never reached the executor
+func (h *executorHealth) abandon() {
+	h.mtx.Lock()
+	defer h.mtx.Unlock()
+	h.probing = false
+}
+
+// finish records the outcome of a request reserved by begin
+func (h *executorHealth) finish(latency time.Duration, failed bool) {
+	h.mtx.Lock()
+	defer h.mtx.Unlock()
+	h.probing = false
+
+	if !failed {
+		if h.latency == 0 {
+			h.latency = latency
+		} else {
+			h.latency = time.Duration(latencyEwmaAlpha*float64(latency) + (1-latencyEwmaAlpha)*float64(h.latency))
+		}
+		h.metrics.latency.Set(h.latency.Seconds())
+	}
+
+	if h.cfg.BreakerErrorRate <= 0 {
+		return
+	}
+
+	switch h.state {
+	case breakerHalfOpen:
+		if failed {
+			h.open()
+			return
+		}
+		// the probe went through, start sending traffic again but only a small share of it
+		h.setState(breakerClosed)
+		h.readmitted = 1
+		h.resetWindow()
+	case breakerClosed:
+		if h.readmitted < readmitSteps {
+			// still being re-admitted, one failure is enough to take it out again
+			if failed {
+				h.open()
+			} else {
+				h.readmitted++
+			}
+			return
+		}
+		h.outcomes[h.next] = failed
+		h.next = (h.next + 1) % breakerWindow
+		if h.count < breakerWindow {
+			h.count++
+		}
+		if h.count >= breakerMinRequests && h.errorRate() >= h.cfg.BreakerErrorRate {
+			h.open()
+		}
+	}
+}
+
+func (h *executorHealth) errorRate() float64 {
+	if h.count == 0 {
+		return 0
+	}
+	failures := 0
+	for i := 0; i < h.count; i++ {
+		if h.outcomes[i] {
+			failures++
+		}
+	}
+	return float64(failures) / float64(h.count)
+}
+
+// admission is the share of its weight the executor currently gets
+func (h *executorHealth) admission() float64 {
+	h.mtx.Lock()
+	defer h.mtx.Unlock()
+	if h.state == breakerHalfOpen {
+		return 1 / float64(readmitSteps)
+	}
+	return float64(h.readmitted) / float64(readmitSteps)
+}
+
+func (h *executorHealth) averageLatency() time.Duration {
+	h.mtx.Lock()
+	defer h.mtx.Unlock()
+	if h.latency == 0 {
+		return unknownLatency
+	}
+	return h.latency
+}
+
+func (h *executorHealth) currentState() breakerState {
+	h.mtx.Lock()
+	defer h.mtx.Unlock()
+	h.checkCooldown()
+	return h.state
+}
+
+func (h *executorHealth) checkCooldown() {
+	if h.state == breakerOpen && h.now().Sub(h.openedAt) >= h.cfg.BreakerCooldown {
+		h.setState(breakerHalfOpen)
+	}
+}
+
+func (h *executorHealth) open() {
+	h.setState(breakerOpen)
+	h.openedAt = h.now()
+	h.readmitted = 0
+	h.resetWindow()
+}
+
+func (h *executorHealth) setState(state breakerState) {
+	h.state = state
+	h.metrics.breakerState.Set(float64(state))
+}
+
+func (h *executorHealth) resetWindow() {
+	h.next = 0
+	h.count = 0
+}
+
+type executorMetrics struct {
+	requests     metrics.Counter
+	failures     metrics.Counter
+	hedged       metrics.Counter
+	duration     metrics.Summary
+	latency      metrics.Gauge
+	breakerState metrics.Gauge
+}
+
+func newExecutorMetrics(url string) executorMetrics {
+	return executorMetrics{
+		requests:     metrics.GetOrCreateCounter(fmt.Sprintf(`zkevm_executor_requests_total{url="%s"}`, url)),
+		failures:     metrics.GetOrCreateCounter(fmt.Sprintf(`zkevm_executor_failures_total{url="%s"}`, url)),
+		hedged:       metrics.GetOrCreateCounter(fmt.Sprintf(`zkevm_executor_hedged_requests_total{url="%s"}`, url)),
+		duration:     metrics.GetOrCreateSummary(fmt.Sprintf(`zkevm_executor_request_seconds{url="%s"}`, url)),
+		latency:      metrics.GetOrCreateGauge(fmt.Sprintf(`zkevm_executor_latency_seconds{url="%s"}`, url)),
+		breakerState: metrics.GetOrCreateGauge(fmt.Sprintf(`zkevm_executor_breaker_state{url="%s"}`, url)),
+	}
+}
+
+type poolMember struct {
+	executor *Executor
+	health   *executorHealth
+}
+
+// score is higher for executors that are expected to answer sooner, it is the weighted reciprocal of the expected
+// time to drain the executor queue
+func (m *poolMember) score() float64 {
+	weight := m.executor.weight
+	if weight <= 0 {
+		weight = 1
+	}
+	latency := m.health.averageLatency().Seconds()
+	queue := float64(m.executor.QueueLength() + 1)
+	return weight * m.health.admission() / (queue * math.Max(latency, 1e-3))
+}
+
+// ExecutorPool spreads verification requests over the executors by their health.  Executors that keep failing are
+// taken out of rotation by a circuit breaker and are gradually re-admitted once a probe request succeeds.
+type ExecutorPool struct {
+	cfg     PoolConfig
+	members []*poolMember
+
+	// rotation makes executors with the same score take turns
+	mtx      sync.Mutex
+	rotation int
+}
+
+func NewExecutorPool(cfg PoolConfig, executors []*Executor) *ExecutorPool {
+	members := make([]*poolMember, len(executors))
+	for i, e := range executors {
+		members[i] = &poolMember{executor: e, health: newExecutorHealth(cfg, e.grpcUrl)}
+	}
+	return &ExecutorPool{cfg: cfg, members: members}
+}
+
+func (p *ExecutorPool) Executors() []*Executor {
+	executors := make([]*Executor, len(p.members))
+	for i, m := range p.members {
+		executors[i] = m.executor
+	}
+	return executors
+}
+
+// next reserves the online executor with the best score, the reservation must be released with finish or abandon on
+// the health of the returned member
+func (p *ExecutorPool) next(exclude *Executor) *poolMember {
+	if len(p.members) == 0 {
+		return nil
+	}
+
+	p.mtx.Lock()
+	p.rotation = (p.rotation + 1) % len(p.members)
+	start := p.rotation
+	p.mtx.Unlock()
+
+	skip := make(map[*poolMember]struct{})
+	for len(skip) < len(p.members) {
+		var best *poolMember
+		bestScore := 0.0
+		for i := 0; i < len(p.members); i++ {
+			m := p.members[(start+i)%len(p.members)]
+			if _, ok := skip[m]; ok {
+				continue
+			}
+			if m.executor == exclude || !m.health.available() || !m.executor.CheckOnline() {
+				skip[m] = struct{}{}
+				continue
+			}
+			if score := m.score(); best == nil || score > bestScore {
+				best, bestScore = m, score
+			}
+		}
+		if best == nil {
+			return nil
+		}
+		if best.health.begin() {
+			return best
+		}
+		// another request took the probe slot in the meantime
+		skip[best] = struct{}{}
+	}
+	return nil
+}
+
+// ExecutorResult is the answer of the executor that won the request
+type ExecutorResult struct {
+	Executor         *Executor
+	Ok               bool
+	ExecutorResponse *executor.ProcessBatchResponseV2
+	ExecutorErr      error
+	GeneralErr       error
+}
+
+// Verify sends the payload to the healthiest executor.  When hedging is enabled and the executor hasn't answered in
+// time the same payload is sent to the next best executor as well and the first answer wins.  cancelled is checked
+// once an executor has capacity for the request, ErrPromiseCancelled is returned if it reports true.
+func (p *ExecutorPool) Verify(payload *Payload, request *VerifierRequest, oldStateRoot common.Hash, cancelled func() bool) (*ExecutorResult, error) {
+	primary := p.next(nil)
+	if primary == nil {
+		return nil, ErrNoExecutorAvailable
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	results := make(chan *ExecutorResult, 2)
+	send := func(m *poolMember, hedged bool) {
+		go func() {
+			e := m.executor
+			e.AquireAccess()
+			defer e.ReleaseAccess()
+			if cancelled() || ctx.Err() != nil {
+				m.health.abandon()
+				results <- &ExecutorResult{Executor: e, GeneralErr: ErrPromiseCancelled}
+				return
+			}
+
+			m.health.metrics.requests.Inc()
+			start := time.Now()
+			ok, resp, executorErr, generalErr := e.verify(ctx, payload, request, oldStateRoot, !hedged)
+			m.health.metrics.duration.ObserveDuration(start)
+
+			// the loser of a hedged request is cancelled, that says nothing about its health
+			if generalErr != nil && ctx.Err() != nil {
+				m.health.abandon()
+			} else {
+				if generalErr != nil {
+					m.health.metrics.failures.Inc()
+				}
+				m.health.finish(time.Since(start), generalErr != nil)
+			}
+			results <- &ExecutorResult{Executor: e, Ok: ok, ExecutorResponse: resp, ExecutorErr: executorErr, GeneralErr: generalErr}
+		}()
+	}
+
+	send(primary, false)
+	inFlight := 1
+
+	var hedge <-chan time.Time
+	if p.cfg.HedgeAfter > 0 && len(p.members) > 1 {
+		timer := time.NewTimer(p.cfg.HedgeAfter)
+		defer timer.Stop()
+		hedge = timer.C
+	}
+
+	var last *ExecutorResult
+	for inFlight > 0 {
+		select {
+		case <-hedge:
+			hedge = nil
+			if m := p.next(primary.executor); m != nil {
+				log.Info("Executor is slow, hedging request", "batch", request.BatchNumber, "slow", primary.executor.grpcUrl, "hedge", m.executor.grpcUrl)
+				m.health.metrics.hedged.Inc()
+				send(m, true)
+				inFlight++
+			}
+		case r := <-results:
+			inFlight--
+			if r.GeneralErr == nil {
+				return r, nil
+			}
+			if last == nil || errors.Is(last.GeneralErr, ErrPromiseCancelled) {
+				last = r
+			}
+		}
+	}
+
+	if errors.Is(last.GeneralErr, ErrPromiseCancelled) {
+		return nil, ErrPromiseCancelled
+	}
+	return last, nil
+}
@@ -0,0 +1,230 @@
+package legacy_executor_verifier
+
+import (
+	"fmt"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/ledgerwatch/erigon-lib/common"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+)
+
+// testExecutor returns an executor backed by the mock client.  The connection goes to an empty grpc server, it is never
+// used for requests but keeps CheckOnline happy.
+func testExecutor(t *testing.T, url string, client *mockExecutorServiceClient) *Executor {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	server := grpc.NewServer()
+	go server.Serve(listener)
+	t.Cleanup(server.Stop)
+
+	conn, err := grpc.Dial(listener.Addr().String(), grpc.WithTransportCredentials(insecure.NewCredentials()))
+	require.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+
+	return &Executor{
+		grpcUrl:   url,
+		conn:      conn,
+		client:    client,
+		semaphore: make(chan struct{}, 2),
+		timeout:   time.Second,
+		weight:    1,
+	}
+}
+
+func TestParseExecutorSettings(t *testing.T) {
+	settings, err := ParseExecutorSettings(" host1:50071,timeout=30s,weight=2 ; host2:50071,max-concurrent=4;")
+	require.NoError(t, err)
+	assert.Equal(t, map[string]ExecutorSettings{
+		"host1:50071": {Timeout: 30 * time.Second, Weight: 2},
+		"host2:50071": {MaxConcurrentRequests: 4},
+	}, settings)
+
+	settings, err = ParseExecutorSettings("")
+	require.NoError(t, err)
+	assert.Empty(t, settings)
+
+	for _, invalid := range []string{
+		"host1:50071,timeout",
+		"host1:50071,timeout=soon",
+		"host1:50071,weight=-1",
+		"host1:50071,max-concurrent=0",
+		"host1:50071,colour=red",
+		",weight=1",
+		"host1:50071;host1:50071",
+	} {
+		_, err := ParseExecutorSettings(invalid)
+		assert.Error(t, err, invalid)
+	}
+}
+
+func TestExecutorHealthBreaker(t *testing.T) {
+	now := time.Unix(1000, 0)
+	h := newExecutorHealth(PoolConfig{BreakerErrorRate: 0.5, BreakerCooldown: 10 * time.Second}, "breaker-test")
+	h.now = func() time.Time { return now }
+
+	// a failure among successes is tolerated
+	for i := 0; i < breakerMinRequests; i++ {
+		require.True(t, h.begin())
+		h.finish(time.Millisecond, i == 0)
+	}
+	assert.Equal(t, breakerClosed, h.currentState())
+
+	// enough failures to reach the error rate open the breaker
+	for h.currentState() == breakerClosed {
+		require.True(t, h.begin())
+		h.finish(time.Millisecond, true)
+	}
+	assert.Equal(t, breakerOpen, h.currentState())
+	assert.False(t, h.available())
+
+	// after the cooldown a single probe is let through
+	now = now.Add(10 * time.Second)
+	assert.Equal(t, breakerHalfOpen, h.currentState())
+	require.True(t, h.begin())
+	assert.False(t, h.begin())
+
+	// a failed probe opens it again
+	h.finish(time.Millisecond, true)
+	assert.Equal(t, breakerOpen, h.currentState())
+
+	// a successful probe re-admits it with a small share that grows with every success
+	now = now.Add(10 * time.Second)
+	require.True(t, h.begin())
+	h.finish(time.Millisecond, false)
+	assert.Equal(t, breakerClosed, h.currentState())
+	assert.InDelta(t, 1/float64(readmitSteps), h.admission(), 1e-9)
+	for i := 1; i < readmitSteps; i++ {
+		require.True(t, h.begin())
+		h.finish(time.Millisecond, false)
+	}
+	assert.InDelta(t, 1, h.admission(), 1e-9)
+}
+
+func TestExecutorHealthReadmissionFailure(t *testing.T) {
+	now := time.Unix(1000, 0)
+	h := newExecutorHealth(PoolConfig{BreakerErrorRate: 0.5, BreakerCooldown: time.Second}, "readmission-test")
+	h.now = func() time.Time { return now }
+
+	h.open()
+	now = now.Add(time.Second)
+	require.True(t, h.begin())
+	h.finish(time.Millisecond, false)
+	require.Equal(t, breakerClosed, h.currentState())
+
+	// while being re-admitted a single failure is enough
+	require.True(t, h.begin())
+	h.finish(time.Millisecond, true)
+	assert.Equal(t, breakerOpen, h.currentState())
+}
+
+func TestExecutorPoolSelection(t *testing.T) {
+	fast := testExecutor(t, "fast", &mockExecutorServiceClient{})
+	slow := testExecutor(t, "slow", &mockExecutorServiceClient{})
+	pool := NewExecutorPool(PoolConfig{BreakerErrorRate: 0.5, BreakerCooldown: time.Minute}, []*Executor{fast, slow})
+
+	pool.members[0].health.finish(10*time.Millisecond, false)
+	pool.members[1].health.finish(time.Second, false)
+
+	for i := 0; i < 4; i++ {
+		m := pool.next(nil)
+		require.NotNil(t, m)
+		assert.Equal(t, fast, m.executor)
+		m.health.abandon()
+	}
+
+	// a heavier weight makes up for the latency
+	slow.weight = 1000
+	m := pool.next(nil)
+	require.NotNil(t, m)
+	assert.Equal(t, slow, m.executor)
+	m.health.abandon()
+
+	// open breakers are skipped and nothing is returned once all are open
+	pool.members[1].health.open()
+	m = pool.next(nil)
+	require.NotNil(t, m)
+	assert.Equal(t, fast, m.executor)
+	m.health.abandon()
+
+	pool.members[0].health.open()
+	assert.Nil(t, pool.next(nil))
+}
+
+func TestExecutorPoolVerify(t *testing.T) {
+	request := &VerifierRequest{BatchNumber: 1, StateRoot: common.Hash{0}}
+	notCancelled := func() bool { return false }
+
+	scenarios := map[string]struct {
+		primary     *mockExecutorServiceClient
+		secondary   *mockExecutorServiceClient
+		hedgeAfter  time.Duration
+		winner      string
+		generalErr  bool
+		primaryFail bool
+	}{
+		"no hedging": {
+			primary:    &mockExecutorServiceClient{delay: 50 * time.Millisecond},
+			secondary:  &mockExecutorServiceClient{delay: 50 * time.Millisecond},
+			hedgeAfter: 0,
+			winner:     "primary",
+		},
+		"hedged request wins": {
+			primary:    &mockExecutorServiceClient{delay: 500 * time.Millisecond},
+			secondary:  &mockExecutorServiceClient{},
+			hedgeAfter: 20 * time.Millisecond,
+			winner:     "secondary",
+		},
+		"hedge falls back to the slow executor": {
+			primary:    &mockExecutorServiceClient{delay: 100 * time.Millisecond},
+			secondary:  &mockExecutorServiceClient{shouldError: true},
+			hedgeAfter: 20 * time.Millisecond,
+			winner:     "primary",
+		},
+		"failure": {
+			primary:     &mockExecutorServiceClient{shouldError: true},
+			secondary:   &mockExecutorServiceClient{shouldError: true},
+			hedgeAfter:  0,
+			generalErr:  true,
+			primaryFail: true,
+		},
+	}
+
+	for name, s := range scenarios {
+		t.Run(name, func(t *testing.T) {
+			primary := testExecutor(t, fmt.Sprintf("primary-%s", name), s.primary)
+			secondary := testExecutor(t, fmt.Sprintf("secondary-%s", name), s.secondary)
+			pool := NewExecutorPool(PoolConfig{BreakerErrorRate: 0.5, BreakerCooldown: time.Minute, HedgeAfter: s.hedgeAfter}, []*Executor{primary, secondary})
+			// make sure the primary is picked first
+			pool.members[0].health.finish(time.Millisecond, false)
+
+			result, err := pool.Verify(&Payload{}, request, common.Hash{}, notCancelled)
+			require.NoError(t, err)
+			if s.generalErr {
+				assert.Error(t, result.GeneralErr)
+			} else {
+				require.NoError(t, result.GeneralErr)
+				assert.True(t, result.Ok)
+				assert.Equal(t, s.winner == "primary", result.Executor == primary)
+			}
+			if s.primaryFail {
+				assert.InDelta(t, 0.5, pool.members[0].health.errorRate(), 1e-9)
+			}
+		})
+	}
+}
+
+func TestExecutorPoolVerifyCancelled(t *testing.T) {
+	e := testExecutor(t, "cancelled", &mockExecutorServiceClient{})
+	pool := NewExecutorPool(PoolConfig{}, []*Executor{e})
+
+	_, err := pool.Verify(&Payload{}, &VerifierRequest{}, common.Hash{}, func() bool { return true })
+	assert.ErrorIs(t, err, ErrPromiseCancelled)
+
+	_, err = NewExecutorPool(PoolConfig{}, nil).Verify(&Payload{}, &VerifierRequest{}, common.Hash{}, func() bool { return false })
+	assert.ErrorIs(t, err, ErrNoExecutorAvailable)
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"errors"
 	"testing"
+	"time"
 
 	"github.com/ledgerwatch/erigon-lib/common"
 	"github.com/ledgerwatch/erigon/zk/legacy_executor_verifier/proto/github.com/0xPolygonHermez/zkevm-node/state/runtime/executor"
@@ -13,6 +14,7 @@ import (
 
 type mockExecutorServiceClient struct {
 	shouldError bool
+	delay       time.Duration
 }
 
 func (m *mockExecutorServiceClient) ProcessBatch(ctx context.Context, in *executor.ProcessBatchRequest, opts ...grpc.CallOption) (*executor.ProcessBatchResponse, error) {
@@ -31,6 +33,13 @@ func (m *mockExecutorServiceClient) GetFlushStatus(ctx context.Context, in *empt
 }
 
 func (m *mockExecutorServiceClient) ProcessStatelessBatchV2(ctx context.Context, in *executor.ProcessStatelessBatchRequestV2, opts ...grpc.CallOption) (*executor.ProcessBatchResponseV2, error) {
+	if m.delay > 0 {
+		select {
+		case <-time.After(m.delay):
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
 	if m.shouldError {
 		return nil, errors.New("mock error")
 	}
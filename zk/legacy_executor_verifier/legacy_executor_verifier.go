@@ -88,6 +88,7 @@ type VerifierResponse struct {
 	ExecutorResponse *executor.ProcessBatchResponseV2
 	OriginalCounters map[string]int
 	Error            error
+	Divergence       *DivergenceReport
 }
 
 type VerifierBundle struct {
@@ -119,8 +120,7 @@ type WitnessGenerator interface {
 type LegacyExecutorVerifier struct {
 	db                     kv.RwDB
 	cfg                    ethconfig.Zk
-	executors              []*Executor
-	executorNumber         int
+	executors              *ExecutorPool
 	cancelAllVerifications atomic.Bool
 
 	streamServer     *server.DataStreamServer
@@ -139,11 +139,15 @@ func NewLegacyExecutorVerifier(
 	stream *datastreamer.StreamServer,
 ) *LegacyExecutorVerifier {
 	streamServer := server.NewDataStreamServer(stream, chainCfg.ChainID.Uint64())
+	pool := NewExecutorPool(PoolConfig{
+		BreakerErrorRate: cfg.ExecutorBreakerErrorRate,
+		BreakerCooldown:  cfg.ExecutorBreakerCooldown,
+		HedgeAfter:       cfg.ExecutorHedgeAfter,
+	}, executors)
 	return &LegacyExecutorVerifier{
 		db:                     db,
 		cfg:                    cfg,
-		executors:              executors,
-		executorNumber:         0,
+		executors:              pool,
 		cancelAllVerifications: atomic.Bool{},
 		streamServer:           streamServer,
 		WitnessGenerator:       witnessGenerator,
@@ -197,27 +201,22 @@ func (v *LegacyExecutorVerifier) VerifySync(tx kv.Tx, request *VerifierRequest,
 		L1InfoTreeMinTimestamps: l1InfoTreeMinTimestamps,
 	}
 
-	e := v.GetNextOnlineAvailableExecutor()
-	if e == nil {
-		return ErrNoExecutorAvailable
+	previousBlock, err := rawdb.ReadBlockByNumber(tx, request.GetFirstBlockNumber()-1)
+	if err != nil {
+		return err
 	}
 
 	t := utils.StartTimer("legacy-executor-verifier", "verify-sync")
 	defer t.LogTimer()
 
-	e.AquireAccess()
-	defer e.ReleaseAccess()
-
-	previousBlock, err := rawdb.ReadBlockByNumber(tx, request.GetFirstBlockNumber()-1)
+	result, err := v.executors.Verify(payload, request, previousBlock.Root(), func() bool { return false })
 	if err != nil {
 		return err
 	}
-
-	_, _, executorErr, generalErr := e.Verify(payload, request, previousBlock.Root())
-	if generalErr != nil {
-		return generalErr
+	if result.GeneralErr != nil {
+		return result.GeneralErr
 	}
-	return executorErr
+	return result.ExecutorErr
 }
 
 func (v *LegacyExecutorVerifier) VerifyAsync(request *VerifierRequest) *Promise[*VerifierBundle] {
@@ -286,28 +285,26 @@ func (v *LegacyExecutorVerifier) VerifyAsync(request *VerifierRequest) *Promise[
 
 		verifierBundle.markAsreadyForSendingRequest()
 
-		e := v.GetNextOnlineAvailableExecutor()
-		if e == nil {
-			return verifierBundle, ErrNoExecutorAvailable
-		}
-
 		t := utils.StartTimer("legacy-executor-verifier", "verify-async")
 		defer t.LogTimer()
 
-		e.AquireAccess()
-		defer e.ReleaseAccess()
-		if v.cancelAllVerifications.Load() {
-			return nil, ErrPromiseCancelled
+		result, err := v.executors.Verify(payload, request, previousBlock.Root(), v.cancelAllVerifications.Load)
+		if err != nil {
+			if errors.Is(err, ErrPromiseCancelled) {
+				return nil, err
+			}
+			return verifierBundle, err
 		}
-
-		ok, executorResponse, executorErr, generalErr := e.Verify(payload, request, previousBlock.Root())
-		if generalErr != nil {
-			return verifierBundle, generalErr
+		if result.GeneralErr != nil {
+			return verifierBundle, result.GeneralErr
 		}
+		ok, executorResponse, executorErr := result.Ok, result.ExecutorResponse, result.ExecutorErr
 
+		var divergence *DivergenceReport
 		if executorErr != nil {
 			if errors.Is(executorErr, ErrExecutorStateRootMismatch) {
 				log.Error("[Verifier] State root mismatch detected", "err", executorErr)
+				divergence = v.recordDivergence(tx, result.Executor, request, executorResponse, previousBlock.Root())
 			} else if errors.Is(executorErr, ErrExecutorUnknownError) {
 				log.Error("[Verifier] Unexpected error found from executor", "err", executorErr)
 			} else {
@@ -320,6 +317,7 @@ func (v *LegacyExecutorVerifier) VerifyAsync(request *VerifierRequest) *Promise[
 			Witness:          witness,
 			ExecutorResponse: executorResponse,
 			Error:            executorErr,
+			Divergence:       divergence,
 		}
 		return verifierBundle, nil
 	})
@@ -420,7 +418,7 @@ func (v *LegacyExecutorVerifier) CancelAllRequests() {
 	// we need it because the promise's function must finish and then the promise checks if it has been cancelled
 	v.cancelAllVerifications.Store(true)
 
-	for _, e := range v.executors {
+	for _, e := range v.executors.Executors() {
 		// let's wait for all threads that are waiting to add to v.openRequests to finish
 		for e.QueueLength() > 0 {
 			time.Sleep(1 * time.Millisecond)
@@ -432,27 +430,6 @@ func (v *LegacyExecutorVerifier) CancelAllRequests() {
 	v.promises = make([]*Promise[*VerifierBundle], 0)
 }
 
-func (v *LegacyExecutorVerifier) GetNextOnlineAvailableExecutor() *Executor {
-	var exec *Executor
-
-	// TODO: find executors with spare capacity
-
-	// attempt to find an executor that is online amongst them all
-	for i := 0; i < len(v.executors); i++ {
-		v.executorNumber++
-		if v.executorNumber >= len(v.executors) {
-			v.executorNumber = 0
-		}
-		temp := v.executors[v.executorNumber]
-		if temp.CheckOnline() {
-			exec = temp
-			break
-		}
-	}
-
-	return exec
-}
-
 func (v *LegacyExecutorVerifier) GetWholeBatchStreamBytes(
 	batchNumber uint64,
 	tx kv.Tx,
@@ -0,0 +1,43 @@
+package legacy_executor_verifier
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+
+	"github.com/ledgerwatch/erigon-lib/common"
+)
+
+// RecordedPayloadPrefix and RecordedExpectationPrefix start the names of the files written per batch by an executor
+// with an output location
+const (
+	RecordedPayloadPrefix     = "payload_"
+	RecordedExpectationPrefix = "expected_"
+)
+
+// RecordedExpectation is what the node expected the executor to return for a recorded payload, it is written next to
+// the payload_N.json of the batch
+type RecordedExpectation struct {
+	BatchNumber  uint64         `json:"batchNumber"`
+	ForkId       uint64         `json:"forkId"`
+	BlockNumbers []uint64       `json:"blockNumbers"`
+	OldStateRoot common.Hash    `json:"oldStateRoot"`
+	StateRoot    common.Hash    `json:"stateRoot"`
+	Counters     map[string]int `json:"counters"`
+}
+
+func writeRecordedExpectation(dir string, request *VerifierRequest, oldStateRoot common.Hash) error {
+	asJson, err := json.Marshal(&RecordedExpectation{
+		BatchNumber:  request.BatchNumber,
+		ForkId:       request.ForkId,
+		BlockNumbers: request.BlockNumbers,
+		OldStateRoot: oldStateRoot,
+		StateRoot:    request.StateRoot,
+		Counters:     request.Counters,
+	})
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path.Join(dir, fmt.Sprintf("%s%d.json", RecordedExpectationPrefix, request.BatchNumber)), asJson, 0644)
+}
@@ -0,0 +1,47 @@
+package legacy_executor_verifier
+
+import (
+	"encoding/json"
+	"os"
+	"path"
+	"testing"
+
+	"github.com/ledgerwatch/erigon-lib/common"
+	"github.com/ledgerwatch/erigon/zk/legacy_executor_verifier/proto/github.com/0xPolygonHermez/zkevm-node/state/runtime/executor"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestVerifyRecordsExpectation(t *testing.T) {
+	dir := t.TempDir()
+	root := common.Hash{0}
+	oldRoot := common.HexToHash("0x1234")
+
+	recorder := &Executor{
+		client:         &mockExecutorServiceClient{},
+		outputLocation: dir,
+	}
+	request := NewVerifierRequest(9, 5, []uint64{50, 51}, root, map[string]int{"S": 100, "K": 2})
+	_, _, executorErr, generalErr := recorder.Verify(&Payload{Witness: []byte{1, 2}, DataStream: []byte{3}}, request, oldRoot)
+	require.NoError(t, executorErr)
+	require.NoError(t, generalErr)
+
+	contents, err := os.ReadFile(path.Join(dir, RecordedPayloadPrefix+"5.json"))
+	require.NoError(t, err)
+	payload := &executor.ProcessStatelessBatchRequestV2{}
+	require.NoError(t, json.Unmarshal(contents, payload))
+	assert.Equal(t, []byte{1, 2}, payload.Witness)
+
+	contents, err = os.ReadFile(path.Join(dir, RecordedExpectationPrefix+"5.json"))
+	require.NoError(t, err)
+	expected := &RecordedExpectation{}
+	require.NoError(t, json.Unmarshal(contents, expected))
+	assert.Equal(t, &RecordedExpectation{
+		BatchNumber:  5,
+		ForkId:       9,
+		BlockNumbers: []uint64{50, 51},
+		OldStateRoot: oldRoot,
+		StateRoot:    root,
+		Counters:     map[string]int{"S": 100, "K": 2},
+	}, expected)
+}
@@ -0,0 +1,83 @@
+package replay
+
+import (
+	"fmt"
+
+	"github.com/ledgerwatch/erigon-lib/common"
+	"github.com/ledgerwatch/erigon/core/types"
+	"github.com/ledgerwatch/erigon/zk/hermez_db"
+	"github.com/ledgerwatch/erigon/zk/l1_data"
+	zktx "github.com/ledgerwatch/erigon/zk/tx"
+)
+
+const (
+	// SourceL1BatchData is the batch data the l1 block sync keeps for the l1 recovery of the sequencer
+	SourceL1BatchData = "l1BatchData"
+	// SourceL1Transaction is the calldata of the sequence transaction, with the data of a validium fetched from the DA
+	SourceL1Transaction = "l1Transaction"
+)
+
+// L1TransactionReader fetches the sequence transactions of the batches the node has no batch data for
+type L1TransactionReader interface {
+	GetTransaction(hash common.Hash) (types.Transaction, bool, error)
+}
+
+// batchData is a batch as it was sequenced on the L1
+type batchData struct {
+	source   string
+	l1TxHash *common.Hash
+	coinbase common.Address
+	blocks   []zktx.DecodedBatchL2Data
+}
+
+// readBatchData reads the batch from the batch data kept by the l1 block sync and otherwise from its sequence
+// transaction
+func (r *Replayer) readBatchData(reader *hermez_db.HermezDbReader, batchNo, forkId uint64) (*batchData, error) {
+	kept, err := reader.GetL1BatchData(batchNo)
+	if err != nil {
+		return nil, err
+	}
+	if len(kept) > 0 {
+		decoded, err := l1_data.BreakDownL1DataByBatch(batchNo, forkId, reader)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode the l1 batch data of batch %d: %w", batchNo, err)
+		}
+		return &batchData{source: SourceL1BatchData, coinbase: decoded.Coinbase, blocks: decoded.DecodedData}, nil
+	}
+
+	if r.l1 == nil {
+		return nil, fmt.Errorf("%w: batch %d has no l1 batch data and there is no l1 to fetch it from", ErrNoL1Data, batchNo)
+	}
+	sequence, err := reader.GetSequenceByBatchNoOrHighest(batchNo)
+	if err != nil {
+		return nil, err
+	}
+	if sequence == nil {
+		return nil, fmt.Errorf("%w: batch %d is not sequenced yet", ErrNoL1Data, batchNo)
+	}
+
+	l1Tx, _, err := r.l1.GetTransaction(sequence.L1TxHash)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get sequence transaction %s: %w", sequence.L1TxHash, err)
+	}
+	calldata := l1Tx.GetData()
+	if len(calldata) < 4 {
+		return nil, fmt.Errorf("calldata of sequence transaction %s is too short", sequence.L1TxHash)
+	}
+	batches, coinbase, _, err := l1_data.DecodeL1BatchData(calldata, r.zkConfig.DAUrl)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode sequence transaction %s: %w", sequence.L1TxHash, err)
+	}
+
+	// the sequence is stored under its last batch
+	firstBatch := sequence.BatchNo + 1 - uint64(len(batches))
+	if batchNo < firstBatch || batchNo > sequence.BatchNo {
+		return nil, fmt.Errorf("sequence transaction %s has batches %d to %d, not %d", sequence.L1TxHash, firstBatch, sequence.BatchNo, batchNo)
+	}
+	blocks, err := zktx.DecodeBatchL2Blocks(batches[batchNo-firstBatch], forkId)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode batch %d of sequence transaction %s: %w", batchNo, sequence.L1TxHash, err)
+	}
+
+	return &batchData{source: SourceL1Transaction, l1TxHash: &sequence.L1TxHash, coinbase: coinbase, blocks: blocks}, nil
+}
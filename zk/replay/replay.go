@@ -0,0 +1,626 @@
+package replay
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+	"time"
+
+	"github.com/ledgerwatch/erigon-lib/chain"
+	"github.com/ledgerwatch/erigon-lib/common"
+	"github.com/ledgerwatch/erigon-lib/common/datadir"
+	"github.com/ledgerwatch/erigon-lib/common/hexutility"
+	"github.com/ledgerwatch/erigon-lib/kv"
+	"github.com/ledgerwatch/erigon-lib/kv/membatchwithdb"
+	libstate "github.com/ledgerwatch/erigon-lib/state"
+	"github.com/ledgerwatch/log/v3"
+
+	"github.com/ledgerwatch/erigon/consensus"
+	"github.com/ledgerwatch/erigon/core"
+	"github.com/ledgerwatch/erigon/core/rawdb"
+	"github.com/ledgerwatch/erigon/core/state"
+	"github.com/ledgerwatch/erigon/core/systemcontracts"
+	"github.com/ledgerwatch/erigon/core/types"
+	"github.com/ledgerwatch/erigon/core/vm"
+	"github.com/ledgerwatch/erigon/eth/ethconfig"
+	"github.com/ledgerwatch/erigon/eth/stagedsync"
+	"github.com/ledgerwatch/erigon/eth/stagedsync/stages"
+	"github.com/ledgerwatch/erigon/eth/tracers/logger"
+	db2 "github.com/ledgerwatch/erigon/smt/pkg/db"
+	"github.com/ledgerwatch/erigon/smt/pkg/smt"
+	"github.com/ledgerwatch/erigon/turbo/services"
+	"github.com/ledgerwatch/erigon/zk/hermez_db"
+	zkStages "github.com/ledgerwatch/erigon/zk/stages"
+	zkUtils "github.com/ledgerwatch/erigon/zk/utils"
+)
+
+var (
+	ErrUnsupportedForkId = errors.New("unsupported fork id")
+	ErrNoL1Data          = errors.New("no l1 data")
+)
+
+// maxRewindBlockCount limits how old a replayed batch can be, the state before it is rebuilt by unwinding the hashed
+// state and the SMT in memory
+const maxRewindBlockCount uint64 = 500_000
+
+// the values compared between the replayed and the stored blocks, in the order they are compared
+const (
+	FieldBlockCount        = "blockCount"
+	FieldTimestamp         = "timestamp"
+	FieldCoinbase          = "coinbase"
+	FieldTransactionCount  = "transactionCount"
+	FieldTransactionHash   = "transactionHash"
+	FieldExecution         = "execution"
+	FieldStatus            = "status"
+	FieldCumulativeGasUsed = "cumulativeGasUsed"
+	FieldLogs              = "logs"
+	FieldGasUsed           = "gasUsed"
+	FieldBlockInfoRoot     = "blockInfoRoot"
+	FieldStateRoot         = "stateRoot"
+)
+
+// Result is the outcome of replaying a batch from its L1 data
+type Result struct {
+	BatchNumber     uint64         `json:"batchNumber"`
+	ForkId          uint64         `json:"forkId"`
+	Source          string         `json:"source"`
+	L1TxHash        *common.Hash   `json:"l1TxHash,omitempty"`
+	OldStateRoot    common.Hash    `json:"oldStateRoot"`
+	NewStateRoot    common.Hash    `json:"newStateRoot"`
+	StoredStateRoot common.Hash    `json:"storedStateRoot"`
+	Blocks          []*BlockResult `json:"blocks"`
+	Match           bool           `json:"match"`
+	FirstMismatch   *Mismatch      `json:"firstMismatch,omitempty"`
+}
+
+// BlockResult is a block replayed without a mismatch
+type BlockResult struct {
+	Number        uint64      `json:"number"`
+	Timestamp     uint64      `json:"timestamp"`
+	Transactions  int         `json:"transactions"`
+	GasUsed       uint64      `json:"gasUsed"`
+	BlockInfoRoot common.Hash `json:"blockInfoRoot"`
+	StateRoot     common.Hash `json:"stateRoot"`
+}
+
+// Mismatch is the first value of the replay that differs from what the node stored.  The transactions of a
+// mismatching receipt, or all the transactions of a block whose gas or roots mismatch, are traced.
+type Mismatch struct {
+	Block    uint64       `json:"block"`
+	TxIndex  *int         `json:"txIndex,omitempty"`
+	TxHash   *common.Hash `json:"txHash,omitempty"`
+	Field    string       `json:"field"`
+	Replayed interface{}  `json:"replayed"`
+	Stored   interface{}  `json:"stored"`
+	Traces   []*TxTrace   `json:"traces,omitempty"`
+}
+
+// TxTrace is the struct logger output of a replayed transaction, the same as debug_traceTransaction returns
+type TxTrace struct {
+	TxIndex     int                   `json:"txIndex"`
+	TxHash      common.Hash           `json:"txHash"`
+	Gas         uint64                `json:"gas"`
+	Failed      bool                  `json:"failed"`
+	ReturnValue hexutility.Bytes      `json:"returnValue"`
+	StructLogs  []logger.StructLogRes `json:"structLogs"`
+}
+
+// Replayer executes batches again from the data they were sequenced with on the L1, on top of the state before them
+// and in an overlay that is thrown away, and compares every block and receipt with what the node stored
+type Replayer struct {
+	dirs        datadir.Dirs
+	historyV3   bool
+	agg         *libstate.Aggregator
+	blockReader services.FullBlockReader
+	chainCfg    *chain.Config
+	zkConfig    *ethconfig.Zk
+	engine      consensus.EngineReader
+	l1          L1TransactionReader
+}
+
+// NewReplayer returns a replayer, without an L1 it only replays the batches whose data the l1 block sync kept
+func NewReplayer(
+	dirs datadir.Dirs,
+	historyV3 bool,
+	agg *libstate.Aggregator,
+	blockReader services.FullBlockReader,
+	chainCfg *chain.Config,
+	zkConfig *ethconfig.Zk,
+	engine consensus.EngineReader,
+	l1 L1TransactionReader,
+) *Replayer {
+	return &Replayer{
+		dirs:        dirs,
+		historyV3:   historyV3,
+		agg:         agg,
+		blockReader: blockReader,
+		chainCfg:    chainCfg,
+		zkConfig:    zkConfig,
+		engine:      engine,
+		l1:          l1,
+	}
+}
+
+// ReplayBatch replays a batch and reports the first mismatch with what the node stored.  Only batches from fork 7
+// (etrog) onwards are supported, the blocks of older batches are not in their L1 data.
+func (r *Replayer) ReplayBatch(ctx context.Context, tx kv.Tx, batchNo uint64) (*Result, error) {
+	t := zkUtils.StartTimer("replay", "replaybatch")
+	defer t.LogTimer()
+
+	if batchNo == 0 {
+		return nil, errors.New("the genesis batch can't be replayed")
+	}
+	engine, ok := r.engine.(consensus.Engine)
+	if !ok {
+		return nil, fmt.Errorf("engine is not consensus.Engine")
+	}
+
+	reader := hermez_db.NewHermezDbReader(tx)
+	forkId, err := reader.GetForkId(batchNo)
+	if err != nil {
+		return nil, err
+	}
+	if forkId < uint64(chain.ForkID7Etrog) {
+		return nil, fmt.Errorf("%w: batch %d has fork id %d, batches are replayed from fork id %d", ErrUnsupportedForkId, batchNo, forkId, chain.ForkID7Etrog)
+	}
+
+	blockNos, err := reader.GetL2BlockNosByBatch(batchNo)
+	if err != nil {
+		return nil, err
+	}
+	if len(blockNos) == 0 {
+		return nil, fmt.Errorf("no blocks found for batch %d", batchNo)
+	}
+	prevBlockNo, found, err := reader.GetHighestBlockInBatch(batchNo - 1)
+	if err != nil {
+		return nil, err
+	}
+	if !found {
+		return nil, fmt.Errorf("no blocks found for batch %d", batchNo-1)
+	}
+
+	latestBlock, err := stages.GetStageProgress(tx, stages.Execution)
+	if err != nil {
+		return nil, err
+	}
+	if latestBlock < blockNos[len(blockNos)-1] {
+		return nil, fmt.Errorf("batch %d is not executed yet, it ends at block %d and the node executed to %d", batchNo, blockNos[len(blockNos)-1], latestBlock)
+	}
+	if latestBlock-prevBlockNo > maxRewindBlockCount {
+		return nil, fmt.Errorf("batch %d is too old, it must start within %d blocks of the head block number (currently %d)", batchNo, maxRewindBlockCount, latestBlock)
+	}
+
+	prevHeader := rawdb.ReadHeaderByNumber(tx, prevBlockNo)
+	if prevHeader == nil {
+		return nil, fmt.Errorf("failed to get header for block %d", prevBlockNo)
+	}
+	stored := make([]*types.Block, len(blockNos))
+	for i, blockNo := range blockNos {
+		if stored[i], err = rawdb.ReadBlockByNumber(tx, blockNo); err != nil {
+			return nil, err
+		}
+		if stored[i] == nil {
+			return nil, fmt.Errorf("block %d not found", blockNo)
+		}
+	}
+
+	data, err := r.readBatchData(reader, batchNo, forkId)
+	if err != nil {
+		return nil, err
+	}
+
+	batch := membatchwithdb.NewMemoryBatchWithSize(tx, r.dirs.Tmp, r.zkConfig.WitnessMemdbSize)
+	defer batch.Rollback()
+	if err = zkUtils.PopulateMemoryMutationTables(batch); err != nil {
+		return nil, err
+	}
+
+	if prevBlockNo < latestBlock {
+		unwindState := &stagedsync.UnwindState{UnwindPoint: prevBlockNo}
+		stageState := &stagedsync.StageState{BlockNumber: latestBlock}
+
+		hashStageCfg := stagedsync.StageHashStateCfg(nil, r.dirs, r.historyV3, r.agg)
+		if err := stagedsync.UnwindHashStateStage(unwindState, stageState, batch, hashStageCfg, ctx, log.New()); err != nil {
+			return nil, fmt.Errorf("unwind hash state: %w", err)
+		}
+
+		interHashStageCfg := zkStages.StageZkInterHashesCfg(nil, true, true, false, r.dirs.Tmp, r.blockReader, nil, r.historyV3, r.agg, nil)
+		if err = zkStages.UnwindZkIntermediateHashesStage(unwindState, stageState, batch, interHashStageCfg, ctx, true); err != nil {
+			return nil, fmt.Errorf("unwind intermediate hashes: %w", err)
+		}
+	}
+
+	tree := smt.NewSMT(db2.NewEriDb(batch), false)
+	if root := common.BigToHash(tree.LastRoot()); root != prevHeader.Root {
+		return nil, fmt.Errorf("the state before batch %d unwound to root %s, block %d has root %s", batchNo, root, prevBlockNo, prevHeader.Root)
+	}
+
+	plainState := state.NewPlainState(batch, prevBlockNo+1, systemcontracts.SystemContractCodeLookup[r.chainCfg.ChainName])
+	defer plainState.Close()
+
+	overlayReader := hermez_db.NewHermezDbReader(batch)
+	rp := &batchReplay{
+		Replayer:   r,
+		tx:         batch,
+		reader:     overlayReader,
+		engine:     engine,
+		tree:       tree,
+		batchState: newOverlayState(plainState),
+		hermezDb: &replayHermezDb{
+			ReadOnlyHermezDb:             overlayReader,
+			batchNo:                      batchNo,
+			blocks:                       make(map[uint64]*blockInputs),
+			effectiveGasPricePercentages: make(map[common.Hash]uint8),
+		},
+		chainReader: &chainReader{
+			ChainReaderImpl: stagedsync.NewChainReaderImpl(r.chainCfg, batch, r.blockReader, log.New()),
+			headers:         make(map[uint64]*types.Header),
+		},
+		result: &Result{
+			BatchNumber:     batchNo,
+			ForkId:          forkId,
+			Source:          data.source,
+			L1TxHash:        data.l1TxHash,
+			OldStateRoot:    prevHeader.Root,
+			NewStateRoot:    prevHeader.Root,
+			StoredStateRoot: stored[len(stored)-1].Root(),
+			Blocks:          []*BlockResult{},
+		},
+	}
+
+	start := time.Now()
+	if err = rp.replayBlocks(ctx, data, prevHeader, stored); err != nil {
+		return nil, err
+	}
+	rp.result.Match = rp.result.FirstMismatch == nil
+
+	if rp.result.Match {
+		log.Info("Replayed batch", "batch", batchNo, "source", data.source, "blocks", len(data.blocks), "root", rp.result.NewStateRoot, "taken", time.Since(start))
+	} else {
+		mismatch := rp.result.FirstMismatch
+		log.Warn("Replayed batch differs from the stored one", "batch", batchNo, "source", data.source, "block", mismatch.Block, "field", mismatch.Field, "taken", time.Since(start))
+	}
+
+	return rp.result, nil
+}
+
+// batchReplay is a batch being replayed on top of the overlay
+type batchReplay struct {
+	*Replayer
+
+	tx          kv.Tx
+	reader      *hermez_db.HermezDbReader
+	engine      consensus.Engine
+	tree        *smt.SMT
+	batchState  *overlayState
+	hermezDb    *replayHermezDb
+	chainReader *chainReader
+	result      *Result
+}
+
+// replayBlocks replays the blocks one by one and stops at the first mismatch
+func (rp *batchReplay) replayBlocks(ctx context.Context, data *batchData, prevHeader *types.Header, stored []*types.Block) error {
+	parent := prevHeader
+	for i, decoded := range data.blocks {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		number := parent.Number.Uint64() + 1
+		timestamp := parent.Time + uint64(decoded.DeltaTimestamp)
+		if i >= len(stored) {
+			rp.mismatch(&Mismatch{Block: number, Field: FieldBlockCount, Replayed: len(data.blocks), Stored: len(stored)})
+			return nil
+		}
+		storedBlock := stored[i]
+
+		// the inputs of the block as the L1 has them, the gas limit is not part of the batch data
+		header := &types.Header{
+			ParentHash: parent.Hash(),
+			Coinbase:   data.coinbase,
+			Difficulty: new(big.Int),
+			Number:     new(big.Int).SetUint64(number),
+			GasLimit:   storedBlock.GasLimit(),
+			Time:       timestamp,
+		}
+		if header.Time != storedBlock.Time() {
+			rp.mismatch(&Mismatch{Block: number, Field: FieldTimestamp, Replayed: header.Time, Stored: storedBlock.Time()})
+			return nil
+		}
+		if header.Coinbase != storedBlock.Coinbase() {
+			rp.mismatch(&Mismatch{Block: number, Field: FieldCoinbase, Replayed: header.Coinbase, Stored: storedBlock.Coinbase()})
+			return nil
+		}
+		storedTxs := storedBlock.Transactions()
+		if len(decoded.Transactions) != len(storedTxs) {
+			rp.mismatch(&Mismatch{Block: number, Field: FieldTransactionCount, Replayed: len(decoded.Transactions), Stored: len(storedTxs)})
+			return nil
+		}
+		for j, transaction := range decoded.Transactions {
+			if transaction.Hash() != storedTxs[j].Hash() {
+				rp.mismatch(txMismatch(number, j, transaction.Hash(), FieldTransactionHash, transaction.Hash(), storedTxs[j].Hash()))
+				return nil
+			}
+			rp.hermezDb.effectiveGasPricePercentages[transaction.Hash()] = decoded.EffectiveGasPricePercentages[j]
+		}
+
+		if err := rp.setBlockInputs(number, uint64(decoded.L1InfoTreeIndex)); err != nil {
+			return err
+		}
+
+		block := types.NewBlock(header, decoded.Transactions, nil, nil, nil)
+		blockState := newOverlayState(rp.batchState)
+		execResult, err := rp.execute(block, blockState, parent.Root, &vm.Config{}, nil)
+		if err != nil {
+			if ctxErr := ctx.Err(); ctxErr != nil {
+				return ctxErr
+			}
+			// the stored block executed, so the replay failing is a mismatch, e.g. a transaction with a wrong nonce
+			rp.mismatch(&Mismatch{Block: number, Field: FieldExecution, Replayed: err.Error()})
+			return nil
+		}
+
+		if storedReceipts := rawdb.ReadRawReceipts(rp.tx, number); len(storedReceipts) == len(execResult.Receipts) {
+			for j, receipt := range execResult.Receipts {
+				field, replayedValue, storedValue := compareReceipt(receipt, storedReceipts[j])
+				if field == "" {
+					continue
+				}
+				mismatch := txMismatch(number, j, receipt.TxHash, field, replayedValue, storedValue)
+				if mismatch.Traces, err = rp.trace(block, parent.Root, j); err != nil {
+					return err
+				}
+				rp.mismatch(mismatch)
+				return nil
+			}
+		}
+
+		var blockInfoRoot common.Hash
+		if execResult.BlockInfoTree != nil {
+			blockInfoRoot = *execResult.BlockInfoTree
+		}
+		storedBlockInfoRoot, err := rp.hermezDb.GetBlockInfoRoot(number)
+		if err != nil {
+			return err
+		}
+		root, err := blockState.applyTo(ctx, rp.tree)
+		if err != nil {
+			return err
+		}
+
+		var mismatch *Mismatch
+		switch {
+		case uint64(execResult.GasUsed) != storedBlock.GasUsed():
+			mismatch = &Mismatch{Block: number, Field: FieldGasUsed, Replayed: uint64(execResult.GasUsed), Stored: storedBlock.GasUsed()}
+		case storedBlockInfoRoot != (common.Hash{}) && blockInfoRoot != storedBlockInfoRoot:
+			mismatch = &Mismatch{Block: number, Field: FieldBlockInfoRoot, Replayed: blockInfoRoot, Stored: storedBlockInfoRoot}
+		case root != storedBlock.Root():
+			mismatch = &Mismatch{Block: number, Field: FieldStateRoot, Replayed: root, Stored: storedBlock.Root()}
+		}
+		if mismatch != nil {
+			if mismatch.Traces, err = rp.trace(block, parent.Root); err != nil {
+				return err
+			}
+			rp.mismatch(mismatch)
+			return nil
+		}
+
+		blockState.mergeInto(rp.batchState)
+		header.Root = root
+		rp.chainReader.headers[number] = header
+		rp.result.NewStateRoot = root
+		rp.result.Blocks = append(rp.result.Blocks, &BlockResult{
+			Number:        number,
+			Timestamp:     header.Time,
+			Transactions:  len(decoded.Transactions),
+			GasUsed:       uint64(execResult.GasUsed),
+			BlockInfoRoot: blockInfoRoot,
+			StateRoot:     root,
+		})
+		parent = header
+	}
+
+	if len(stored) > len(data.blocks) {
+		rp.mismatch(&Mismatch{Block: parent.Number.Uint64() + 1, Field: FieldBlockCount, Replayed: len(data.blocks), Stored: len(stored)})
+	}
+	return nil
+}
+
+func (rp *batchReplay) mismatch(mismatch *Mismatch) {
+	rp.result.FirstMismatch = mismatch
+}
+
+func txMismatch(blockNo uint64, txIndex int, txHash common.Hash, field string, replayed, stored interface{}) *Mismatch {
+	return &Mismatch{Block: blockNo, TxIndex: &txIndex, TxHash: &txHash, Field: field, Replayed: replayed, Stored: stored}
+}
+
+// setBlockInputs sets the global exit root and l1 block hash of the l1 info tree index the block uses.  Like the
+// sequencer the global exit root is only written to the contract if it doesn't know it yet.
+func (rp *batchReplay) setBlockInputs(blockNo, l1InfoTreeIndex uint64) error {
+	inputs := &blockInputs{l1InfoTreeIndex: l1InfoTreeIndex}
+	rp.hermezDb.blocks[blockNo] = inputs
+
+	// index 0 is a special case which has no global exit root
+	if l1InfoTreeIndex == 0 {
+		return nil
+	}
+	update, err := rp.reader.GetL1InfoTreeUpdate(l1InfoTreeIndex)
+	if err != nil {
+		return err
+	}
+	if update == nil {
+		return fmt.Errorf("block %d uses l1 info tree index %d which the node doesn't have", blockNo, l1InfoTreeIndex)
+	}
+	inputs.ger = update.GER
+	inputs.l1BlockHash = update.ParentHash
+	inputs.reusedL1InfoTreeIndex = state.New(rp.batchState).ReadGerManagerL1BlockHash(update.GER) != (common.Hash{})
+
+	return nil
+}
+
+func (rp *batchReplay) execute(
+	block *types.Block,
+	blockState *overlayState,
+	parentRoot common.Hash,
+	vmConfig *vm.Config,
+	getTracer func(txIndex int, txHash common.Hash) (vm.EVMLogger, error),
+) (*core.EphemeralExecResultZk, error) {
+	getHashFn := core.GetHashFn(block.Header(), rp.chainReader.GetHeader)
+	return core.ExecuteBlockEphemerallyZk(rp.chainCfg, vmConfig, getHashFn, rp.engine, block, blockState, blockState, rp.chainReader, getTracer, rp.hermezDb, &parentRoot)
+}
+
+// trace runs the block again on the state before it with a struct logger on the given transactions, or on all of them
+// if none are given
+func (rp *batchReplay) trace(block *types.Block, parentRoot common.Hash, txIndexes ...int) ([]*TxTrace, error) {
+	traced := make(map[int]bool, len(txIndexes))
+	for _, txIndex := range txIndexes {
+		traced[txIndex] = true
+	}
+
+	tracers := make(map[int]*logger.StructLogger)
+	getTracer := func(txIndex int, _ common.Hash) (vm.EVMLogger, error) {
+		if len(traced) > 0 && !traced[txIndex] {
+			// every transaction of a debug execution needs a tracer, this one stops at the first opcode
+			return logger.NewStructLogger(&logger.LogConfig{DisableMemory: true, DisableStack: true, DisableStorage: true, DisableReturnData: true, Limit: 1}), nil
+		}
+		tracer := logger.NewStructLogger(&logger.LogConfig{})
+		tracers[txIndex] = tracer
+		return tracer, nil
+	}
+
+	execResult, err := rp.execute(block, newOverlayState(rp.batchState), parentRoot, &vm.Config{Debug: true}, getTracer)
+	if err != nil {
+		return nil, fmt.Errorf("trace block %d: %w", block.NumberU64(), err)
+	}
+
+	var traces []*TxTrace
+	for txIndex, transaction := range block.Transactions() {
+		tracer, ok := tracers[txIndex]
+		if !ok {
+			continue
+		}
+		receipt := execResult.Receipts[txIndex]
+		traces = append(traces, &TxTrace{
+			TxIndex:     txIndex,
+			TxHash:      transaction.Hash(),
+			Gas:         receipt.GasUsed,
+			Failed:      receipt.Status == types.ReceiptStatusFailed,
+			ReturnValue: tracer.Output(),
+			StructLogs:  logger.FormatLogs(tracer.StructLogs()),
+		})
+	}
+	return traces, nil
+}
+
+// compareReceipt compares the consensus fields of the receipts, the only ones the node stores
+func compareReceipt(replayed, stored *types.Receipt) (field string, replayedValue, storedValue interface{}) {
+	switch {
+	case replayed.Status != stored.Status:
+		return FieldStatus, replayed.Status, stored.Status
+	case replayed.CumulativeGasUsed != stored.CumulativeGasUsed:
+		return FieldCumulativeGasUsed, replayed.CumulativeGasUsed, stored.CumulativeGasUsed
+	case !logsEqual(replayed.Logs, stored.Logs):
+		return FieldLogs, replayed.Logs, stored.Logs
+	}
+	return "", nil, nil
+}
+
+func logsEqual(a, b types.Logs) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i].Address != b[i].Address || !bytes.Equal(a[i].Data, b[i].Data) || len(a[i].Topics) != len(b[i].Topics) {
+			return false
+		}
+		for j := range a[i].Topics {
+			if a[i].Topics[j] != b[i].Topics[j] {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// blockInputs are the values the execution reads from the hermez tables for a block
+type blockInputs struct {
+	ger                   common.Hash
+	l1BlockHash           common.Hash
+	l1InfoTreeIndex       uint64
+	reusedL1InfoTreeIndex bool
+}
+
+// replayHermezDb answers the reads the execution makes about the replayed blocks from the L1 data instead of from
+// what the node stored for them
+type replayHermezDb struct {
+	state.ReadOnlyHermezDb
+
+	batchNo                      uint64
+	blocks                       map[uint64]*blockInputs
+	effectiveGasPricePercentages map[common.Hash]uint8
+}
+
+func (db *replayHermezDb) GetBatchNoByL2Block(l2BlockNo uint64) (uint64, error) {
+	if _, ok := db.blocks[l2BlockNo]; ok {
+		return db.batchNo, nil
+	}
+	return db.ReadOnlyHermezDb.GetBatchNoByL2Block(l2BlockNo)
+}
+
+func (db *replayHermezDb) GetBlockGlobalExitRoot(l2BlockNo uint64) (common.Hash, error) {
+	if inputs, ok := db.blocks[l2BlockNo]; ok {
+		return inputs.ger, nil
+	}
+	return db.ReadOnlyHermezDb.GetBlockGlobalExitRoot(l2BlockNo)
+}
+
+func (db *replayHermezDb) GetBlockL1BlockHash(l2BlockNo uint64) (common.Hash, error) {
+	if inputs, ok := db.blocks[l2BlockNo]; ok {
+		return inputs.l1BlockHash, nil
+	}
+	return db.ReadOnlyHermezDb.GetBlockL1BlockHash(l2BlockNo)
+}
+
+func (db *replayHermezDb) GetBlockL1InfoTreeIndex(blockNumber uint64) (uint64, error) {
+	if inputs, ok := db.blocks[blockNumber]; ok {
+		return inputs.l1InfoTreeIndex, nil
+	}
+	return db.ReadOnlyHermezDb.GetBlockL1InfoTreeIndex(blockNumber)
+}
+
+func (db *replayHermezDb) GetReusedL1InfoTreeIndex(blockNum uint64) (bool, error) {
+	if inputs, ok := db.blocks[blockNum]; ok {
+		return inputs.reusedL1InfoTreeIndex, nil
+	}
+	return db.ReadOnlyHermezDb.GetReusedL1InfoTreeIndex(blockNum)
+}
+
+func (db *replayHermezDb) GetEffectiveGasPricePercentage(txHash common.Hash) (uint8, error) {
+	if percentage, ok := db.effectiveGasPricePercentages[txHash]; ok {
+		return percentage, nil
+	}
+	return db.ReadOnlyHermezDb.GetEffectiveGasPricePercentage(txHash)
+}
+
+// chainReader serves the headers of the replayed blocks instead of the stored ones, their roots are the replayed roots
+type chainReader struct {
+	*stagedsync.ChainReaderImpl
+
+	headers map[uint64]*types.Header
+}
+
+func (cr *chainReader) GetHeader(hash common.Hash, number uint64) *types.Header {
+	if header, ok := cr.headers[number]; ok && header.Hash() == hash {
+		return header
+	}
+	return cr.ChainReaderImpl.GetHeader(hash, number)
+}
+
+func (cr *chainReader) GetHeaderByNumber(number uint64) *types.Header {
+	if header, ok := cr.headers[number]; ok {
+		return header
+	}
+	return cr.ChainReaderImpl.GetHeaderByNumber(number)
+}
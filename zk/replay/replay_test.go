@@ -0,0 +1,116 @@
+package replay
+
+import (
+	"context"
+	"math/big"
+	"testing"
+
+	"github.com/holiman/uint256"
+	"github.com/ledgerwatch/erigon-lib/common"
+	"github.com/ledgerwatch/erigon/core/types"
+	"github.com/ledgerwatch/erigon/core/types/accounts"
+	"github.com/ledgerwatch/erigon/smt/pkg/smt"
+	"github.com/stretchr/testify/require"
+)
+
+// emptyState is the state before any block, it has no accounts
+type emptyState struct{}
+
+func (emptyState) ReadAccountData(common.Address) (*accounts.Account, error) { return nil, nil }
+func (emptyState) ReadAccountStorage(common.Address, uint64, *common.Hash) ([]byte, error) {
+	return nil, nil
+}
+func (emptyState) ReadAccountCode(common.Address, uint64, common.Hash) ([]byte, error) {
+	return nil, nil
+}
+func (emptyState) ReadAccountCodeSize(common.Address, uint64, common.Hash) (int, error) {
+	return 0, nil
+}
+func (emptyState) ReadAccountIncarnation(common.Address) (uint64, error) { return 0, nil }
+
+func testAccount(balance, nonce uint64) *accounts.Account {
+	acc := accounts.NewAccount()
+	acc.Balance.SetUint64(balance)
+	acc.Nonce = nonce
+	return &acc
+}
+
+func TestOverlayStateLayers(t *testing.T) {
+	alice, bob := common.HexToAddress("0xa"), common.HexToAddress("0xb")
+	slot := common.HexToHash("0x1")
+
+	batchState := newOverlayState(emptyState{})
+	require.NoError(t, batchState.UpdateAccountData(alice, nil, testAccount(10, 0)))
+	require.NoError(t, batchState.UpdateAccountCode(bob, 1, common.Hash{}, []byte{0x60}))
+	require.NoError(t, batchState.WriteAccountStorage(bob, 1, &slot, nil, uint256.NewInt(7)))
+
+	// a block writes on top of the batch and deletes bob
+	blockState := newOverlayState(batchState)
+	require.NoError(t, blockState.UpdateAccountData(alice, nil, testAccount(5, 1)))
+	require.NoError(t, blockState.DeleteAccount(bob, nil))
+
+	acc, err := blockState.ReadAccountData(alice)
+	require.NoError(t, err)
+	require.Equal(t, uint64(1), acc.Nonce)
+	value, err := blockState.ReadAccountStorage(bob, 1, &slot)
+	require.NoError(t, err)
+	require.Nil(t, value)
+	code, err := blockState.ReadAccountCode(bob, 1, common.Hash{})
+	require.NoError(t, err)
+	require.Nil(t, code)
+
+	// the batch is untouched until the block is merged, so the block can run again
+	acc, err = batchState.ReadAccountData(alice)
+	require.NoError(t, err)
+	require.Equal(t, uint64(0), acc.Nonce)
+	value, err = batchState.ReadAccountStorage(bob, 1, &slot)
+	require.NoError(t, err)
+	require.Equal(t, []byte{7}, value)
+
+	blockState.mergeInto(batchState)
+	acc, err = batchState.ReadAccountData(bob)
+	require.NoError(t, err)
+	require.Nil(t, acc)
+	value, err = batchState.ReadAccountStorage(bob, 1, &slot)
+	require.NoError(t, err)
+	require.Nil(t, value)
+	acc, err = batchState.ReadAccountData(alice)
+	require.NoError(t, err)
+	require.Equal(t, uint64(1), acc.Nonce)
+}
+
+func TestOverlayStateApplyTo(t *testing.T) {
+	alice := common.HexToAddress("0xa")
+	ctx := context.Background()
+
+	tree := smt.NewSMT(nil, false)
+	blockState := newOverlayState(emptyState{})
+	require.NoError(t, blockState.UpdateAccountData(alice, nil, testAccount(10, 2)))
+	root, err := blockState.applyTo(ctx, tree)
+	require.NoError(t, err)
+
+	expected := smt.NewSMT(nil, false)
+	_, err = expected.SetAccountState(alice.String(), big.NewInt(10), big.NewInt(2))
+	require.NoError(t, err)
+	require.Equal(t, common.BigToHash(expected.LastRoot()), root)
+}
+
+func TestCompareReceipt(t *testing.T) {
+	receipt := func(status, gas uint64, data []byte) *types.Receipt {
+		return &types.Receipt{Status: status, CumulativeGasUsed: gas, Logs: types.Logs{{Address: common.HexToAddress("0xa"), Topics: []common.Hash{{1}}, Data: data}}}
+	}
+
+	field, _, _ := compareReceipt(receipt(1, 21000, []byte{1}), receipt(1, 21000, []byte{1}))
+	require.Empty(t, field)
+
+	field, replayed, stored := compareReceipt(receipt(0, 21000, []byte{1}), receipt(1, 21000, []byte{1}))
+	require.Equal(t, FieldStatus, field)
+	require.Equal(t, uint64(0), replayed)
+	require.Equal(t, uint64(1), stored)
+
+	field, _, _ = compareReceipt(receipt(1, 22000, []byte{1}), receipt(1, 21000, []byte{1}))
+	require.Equal(t, FieldCumulativeGasUsed, field)
+
+	field, _, _ = compareReceipt(receipt(1, 21000, []byte{2}), receipt(1, 21000, []byte{1}))
+	require.Equal(t, FieldLogs, field)
+}
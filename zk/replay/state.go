@@ -0,0 +1,193 @@
+package replay
+
+import (
+	"context"
+	"encoding/hex"
+	"fmt"
+
+	"github.com/holiman/uint256"
+	"github.com/ledgerwatch/erigon-lib/common"
+	"github.com/ledgerwatch/erigon/core/state"
+	"github.com/ledgerwatch/erigon/core/types/accounts"
+	"github.com/ledgerwatch/erigon/smt/pkg/smt"
+)
+
+// overlayState holds the state written by replayed blocks on top of a parent state, nothing reaches the database.
+// A batch is replayed with one layer per block on top of a layer for the whole batch, the layer of a block is merged
+// down once the block matches and dropped to run the block again with tracers when it doesn't.  The writes of a
+// single block are the changes the SMT takes to move the root on.
+type overlayState struct {
+	parent state.StateReader
+
+	// a nil account was deleted, the storage and code of a deleted account are gone from the parent
+	accounts map[common.Address]*accounts.Account
+	deleted  map[common.Address]bool
+	code     map[common.Address][]byte
+	storage  map[common.Address]map[common.Hash]uint256.Int
+}
+
+var _ state.StateReader = (*overlayState)(nil)
+var _ state.WriterWithChangeSets = (*overlayState)(nil)
+
+func newOverlayState(parent state.StateReader) *overlayState {
+	return &overlayState{
+		parent:   parent,
+		accounts: make(map[common.Address]*accounts.Account),
+		deleted:  make(map[common.Address]bool),
+		code:     make(map[common.Address][]byte),
+		storage:  make(map[common.Address]map[common.Hash]uint256.Int),
+	}
+}
+
+func (s *overlayState) ReadAccountData(address common.Address) (*accounts.Account, error) {
+	acc, ok := s.accounts[address]
+	if !ok {
+		return s.parent.ReadAccountData(address)
+	}
+	if acc == nil {
+		return nil, nil
+	}
+	var cpy accounts.Account
+	cpy.Copy(acc)
+	return &cpy, nil
+}
+
+func (s *overlayState) ReadAccountStorage(address common.Address, incarnation uint64, key *common.Hash) ([]byte, error) {
+	if value, ok := s.storage[address][*key]; ok {
+		return value.Bytes(), nil
+	}
+	if s.deleted[address] {
+		return nil, nil
+	}
+	return s.parent.ReadAccountStorage(address, incarnation, key)
+}
+
+func (s *overlayState) ReadAccountCode(address common.Address, incarnation uint64, codeHash common.Hash) ([]byte, error) {
+	if code, ok := s.code[address]; ok {
+		return code, nil
+	}
+	if s.deleted[address] {
+		return nil, nil
+	}
+	return s.parent.ReadAccountCode(address, incarnation, codeHash)
+}
+
+func (s *overlayState) ReadAccountCodeSize(address common.Address, incarnation uint64, codeHash common.Hash) (int, error) {
+	code, err := s.ReadAccountCode(address, incarnation, codeHash)
+	return len(code), err
+}
+
+func (s *overlayState) ReadAccountIncarnation(address common.Address) (uint64, error) {
+	if acc, ok := s.accounts[address]; ok {
+		if acc == nil {
+			return 0, nil
+		}
+		return acc.Incarnation, nil
+	}
+	return s.parent.ReadAccountIncarnation(address)
+}
+
+func (s *overlayState) UpdateAccountData(address common.Address, _, account *accounts.Account) error {
+	var cpy accounts.Account
+	cpy.Copy(account)
+	s.accounts[address] = &cpy
+	return nil
+}
+
+func (s *overlayState) UpdateAccountCode(address common.Address, _ uint64, _ common.Hash, code []byte) error {
+	s.code[address] = common.CopyBytes(code)
+	return nil
+}
+
+func (s *overlayState) DeleteAccount(address common.Address, _ *accounts.Account) error {
+	s.accounts[address] = nil
+	s.deleted[address] = true
+	delete(s.code, address)
+	delete(s.storage, address)
+	return nil
+}
+
+func (s *overlayState) WriteAccountStorage(address common.Address, _ uint64, key *common.Hash, _, value *uint256.Int) error {
+	if s.storage[address] == nil {
+		s.storage[address] = make(map[common.Hash]uint256.Int)
+	}
+	s.storage[address][*key] = *value
+	return nil
+}
+
+func (s *overlayState) CreateContract(common.Address) error {
+	return nil
+}
+
+// the changes are only kept in memory, there is no history to write
+
+func (s *overlayState) WriteChangeSets() error {
+	return nil
+}
+
+func (s *overlayState) WriteHistory() error {
+	return nil
+}
+
+// mergeInto moves the writes down to the layer below, which has to be the parent
+func (s *overlayState) mergeInto(below *overlayState) {
+	for address := range s.deleted {
+		below.deleted[address] = true
+		below.accounts[address] = nil
+		delete(below.code, address)
+		delete(below.storage, address)
+	}
+	for address, acc := range s.accounts {
+		below.accounts[address] = acc
+	}
+	for address, code := range s.code {
+		below.code[address] = code
+	}
+	for address, slots := range s.storage {
+		if below.storage[address] == nil {
+			below.storage[address] = make(map[common.Hash]uint256.Int, len(slots))
+		}
+		for key, value := range slots {
+			below.storage[address][key] = value
+		}
+	}
+}
+
+// applyTo sets the writes in the tree and returns the new root.  Like the interhashes stage the code of every changed
+// account is set again.
+func (s *overlayState) applyTo(ctx context.Context, tree *smt.SMT) (common.Hash, error) {
+	accChanges := make(map[common.Address]*accounts.Account, len(s.accounts))
+	codeChanges := make(map[common.Address]string)
+	storageChanges := make(map[common.Address]map[string]string, len(s.storage))
+
+	for address, acc := range s.accounts {
+		accChanges[address] = acc
+		if acc == nil {
+			continue
+		}
+		code, err := s.ReadAccountCode(address, acc.Incarnation, acc.CodeHash)
+		if err != nil {
+			return common.Hash{}, err
+		}
+		if len(code) > 0 {
+			codeChanges[address] = "0x" + hex.EncodeToString(code)
+		}
+	}
+	for address, code := range s.code {
+		if len(code) > 0 {
+			codeChanges[address] = "0x" + hex.EncodeToString(code)
+		}
+	}
+	for address, slots := range s.storage {
+		changes := make(map[string]string, len(slots))
+		for key, value := range slots {
+			changes[fmt.Sprintf("0x%032x", key)] = fmt.Sprintf("0x%032x", common.BytesToHash(value.Bytes()))
+		}
+		storageChanges[address] = changes
+	}
+
+	if _, _, err := tree.SetStorage(ctx, "[replay]", accChanges, codeChanges, storageChanges); err != nil {
+		return common.Hash{}, err
+	}
+	return common.BigToHash(tree.LastRoot()), nil
+}
@@ -0,0 +1,185 @@
+package rpc_ratelimit
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	lru "github.com/hashicorp/golang-lru/v2"
+	"github.com/ledgerwatch/erigon-lib/metrics"
+	"golang.org/x/time/rate"
+	"gopkg.in/yaml.v3"
+
+	"github.com/ledgerwatch/erigon/rpc"
+)
+
+const defaultMaxClients = 10_000
+
+// Limit is how many cost units a client can spend per second and at once.  A rate of 0 is unlimited.
+type Limit struct {
+	Rate  float64 `yaml:"rate"`
+	Burst int     `yaml:"burst"`
+}
+
+// Config is the rate limit of the RPC clients, read from a YAML file like:
+//
+//	rate: 50
+//	burst: 100
+//	defaultCost: 1
+//	methods:
+//	  zkevm_getBatchWitness: 100
+//	  zkevm_batchNumber: 0
+//	apiKeys:
+//	  some-secret-key: {rate: 500, burst: 1000}
+//	ips:
+//	  10.0.0.1: {rate: 0}
+//
+// Every client gets the default limit unless it sent a known API key or has an IP with a limit of its own, clients
+// sending an unknown API key are limited by their IP.  The IP is the one the connection comes from, forwarded headers
+// are not trusted, so all clients behind a proxy share its bucket unless they send API keys.  Calls cost the
+// defaultCost unless their method has its own cost, methods costing 0 are never limited.  An unset defaultCost is 0,
+// leaving every method not listed unlimited.  The calls of methods the node does not serve all count as "unknown",
+// which can be given a cost like any other method.
+type Config struct {
+	Limit       `yaml:",inline"`
+	DefaultCost int              `yaml:"defaultCost"`
+	Methods     map[string]int   `yaml:"methods"`
+	APIKeys     map[string]Limit `yaml:"apiKeys"`
+	IPs         map[string]Limit `yaml:"ips"`
+	// MaxClients is how many clients are tracked, the least recently seen ones start afresh when there are more
+	MaxClients int `yaml:"maxClients"`
+}
+
+// Load reads the config file and returns its limiter, nil if no file is given
+func Load(path string) (*Limiter, error) {
+	path = strings.TrimSpace(path)
+	if path == "" {
+		return nil, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var cfg Config
+	if err := yaml.Unmarshal(data, &cfg); err != nil {
+		return nil, fmt.Errorf("invalid rate limit config %s: %w", path, err)
+	}
+	return New(cfg)
+}
+
+func exceededCounter(method string) metrics.Counter {
+	return metrics.GetOrCreateCounter(fmt.Sprintf(`rpc_ratelimit_exceeded_total{method="%s"}`, method))
+}
+
+func spentCounter(method string) metrics.Counter {
+	return metrics.GetOrCreateCounter(fmt.Sprintf(`rpc_ratelimit_cost_total{method="%s"}`, method))
+}
+
+// Limiter is a token bucket per client, calls take as many tokens as their method costs
+type Limiter struct {
+	cfg     Config
+	clients *lru.Cache[string, *rate.Limiter]
+	now     func() time.Time
+}
+
+func New(cfg Config) (*Limiter, error) {
+	if cfg.DefaultCost < 0 {
+		return nil, fmt.Errorf("negative default cost %d", cfg.DefaultCost)
+	}
+	maxCost := cfg.DefaultCost
+	for method, cost := range cfg.Methods {
+		if cost < 0 {
+			return nil, fmt.Errorf("negative cost %d of %s", cost, method)
+		}
+		maxCost = max(maxCost, cost)
+	}
+
+	// a burst smaller than the costliest call would never let it through
+	check := func(who string, limit Limit) error {
+		if limit.Rate < 0 {
+			return fmt.Errorf("negative rate of %s", who)
+		}
+		if limit.Rate > 0 && limit.Burst < maxCost {
+			return fmt.Errorf("burst %d of %s is below the highest method cost %d", limit.Burst, who, maxCost)
+		}
+		return nil
+	}
+	if err := check("the default limit", cfg.Limit); err != nil {
+		return nil, err
+	}
+	for _, limit := range cfg.APIKeys {
+		if err := check("an API key", limit); err != nil {
+			return nil, err
+		}
+	}
+	for ip, limit := range cfg.IPs {
+		if err := check(ip, limit); err != nil {
+			return nil, err
+		}
+	}
+
+	if cfg.MaxClients <= 0 {
+		cfg.MaxClients = defaultMaxClients
+	}
+	clients, err := lru.New[string, *rate.Limiter](cfg.MaxClients)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Limiter{cfg: cfg, clients: clients, now: time.Now}, nil
+}
+
+func (l *Limiter) cost(method string) int {
+	if cost, ok := l.cfg.Methods[method]; ok {
+		return cost
+	}
+	return l.cfg.DefaultCost
+}
+
+// bucket returns the key and limit the client is counted against
+func (l *Limiter) bucket(client rpc.RateLimitClient) (string, Limit) {
+	if client.APIKey != "" {
+		if limit, ok := l.cfg.APIKeys[client.APIKey]; ok {
+			return "key:" + client.APIKey, limit
+		}
+	}
+	if limit, ok := l.cfg.IPs[client.IP]; ok {
+		return "ip:" + client.IP, limit
+	}
+	return "ip:" + client.IP, l.cfg.Limit
+}
+
+// Allow takes the cost of the method from the client's bucket, or returns how long the client has to wait if there
+// is not enough left in it
+func (l *Limiter) Allow(client rpc.RateLimitClient, method string) error {
+	cost := l.cost(method)
+	if cost == 0 {
+		return nil
+	}
+	key, limit := l.bucket(client)
+	if limit.Rate == 0 {
+		return nil
+	}
+
+	bucket, ok := l.clients.Get(key)
+	if !ok {
+		bucket = rate.NewLimiter(rate.Limit(limit.Rate), limit.Burst)
+		// another call of the client may have added it in the meantime
+		if existing, found, _ := l.clients.PeekOrAdd(key, bucket); found {
+			bucket = existing
+		}
+	}
+
+	now := l.now()
+	reservation := bucket.ReserveN(now, cost)
+	if delay := reservation.DelayFrom(now); delay > 0 {
+		reservation.CancelAt(now)
+		exceededCounter(method).Inc()
+		return &rpc.LimitExceededError{Method: method, RetryAfter: delay}
+	}
+	spentCounter(method).AddInt(cost)
+	return nil
+}
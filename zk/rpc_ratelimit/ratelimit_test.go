@@ -0,0 +1,77 @@
+package rpc_ratelimit
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/ledgerwatch/erigon/rpc"
+)
+
+func TestLimiter(t *testing.T) {
+	limiter, err := New(Config{
+		Limit:       Limit{Rate: 10, Burst: 20},
+		DefaultCost: 1,
+		Methods:     map[string]int{"zkevm_getBatchWitness": 20, "zkevm_batchNumber": 0},
+		APIKeys:     map[string]Limit{"partner": {Rate: 100, Burst: 200}},
+		IPs:         map[string]Limit{"10.0.0.1": {}},
+	})
+	require.NoError(t, err)
+	now := time.Unix(1_700_000_000, 0)
+	limiter.now = func() time.Time { return now }
+
+	client := rpc.RateLimitClient{IP: "1.2.3.4"}
+
+	t.Run("expensive call uses up the burst", func(t *testing.T) {
+		require.NoError(t, limiter.Allow(client, "zkevm_getBatchWitness"))
+
+		err := limiter.Allow(client, "eth_chainId")
+		var limitErr *rpc.LimitExceededError
+		require.True(t, errors.As(err, &limitErr))
+		require.Equal(t, "eth_chainId", limitErr.Method)
+		require.Equal(t, 100*time.Millisecond, limitErr.RetryAfter)
+	})
+
+	t.Run("free methods are never limited", func(t *testing.T) {
+		for i := 0; i < 100; i++ {
+			require.NoError(t, limiter.Allow(client, "zkevm_batchNumber"))
+		}
+	})
+
+	t.Run("bucket refills over time", func(t *testing.T) {
+		now = now.Add(time.Second)
+		for i := 0; i < 10; i++ {
+			require.NoError(t, limiter.Allow(client, "eth_chainId"))
+		}
+		require.Error(t, limiter.Allow(client, "eth_chainId"))
+	})
+
+	t.Run("clients have their own buckets", func(t *testing.T) {
+		require.NoError(t, limiter.Allow(rpc.RateLimitClient{IP: "5.6.7.8"}, "zkevm_getBatchWitness"))
+	})
+
+	t.Run("known api key gets its own limit, unknown one the ip's", func(t *testing.T) {
+		partner := rpc.RateLimitClient{APIKey: "partner", IP: "1.2.3.4"}
+		for i := 0; i < 10; i++ {
+			require.NoError(t, limiter.Allow(partner, "zkevm_getBatchWitness"))
+		}
+		require.Error(t, limiter.Allow(rpc.RateLimitClient{APIKey: "guess", IP: "1.2.3.4"}, "eth_chainId"))
+	})
+
+	t.Run("ip without rate is unlimited", func(t *testing.T) {
+		for i := 0; i < 100; i++ {
+			require.NoError(t, limiter.Allow(rpc.RateLimitClient{IP: "10.0.0.1"}, "zkevm_getBatchWitness"))
+		}
+	})
+}
+
+func TestBurstBelowCost(t *testing.T) {
+	_, err := New(Config{
+		Limit:       Limit{Rate: 10, Burst: 5},
+		DefaultCost: 1,
+		Methods:     map[string]int{"zkevm_getBatchWitness": 20},
+	})
+	require.Error(t, err)
+}
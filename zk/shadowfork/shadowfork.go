@@ -0,0 +1,393 @@
+package shadowfork
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/ledgerwatch/erigon-lib/common"
+	"github.com/ledgerwatch/log/v3"
+	"golang.org/x/sync/errgroup"
+
+	coretypes "github.com/ledgerwatch/erigon/core/types"
+	"github.com/ledgerwatch/erigon/eth/ethconfig"
+	"github.com/ledgerwatch/erigon/ethclient"
+	"github.com/ledgerwatch/erigon/zk/datastream/client"
+	"github.com/ledgerwatch/erigon/zk/datastream/types"
+	zktx "github.com/ledgerwatch/erigon/zk/tx"
+)
+
+const (
+	// StatusSuccess is a transaction executed successfully
+	StatusSuccess = "success"
+	// StatusReverted is a transaction included in a block whose execution reverted
+	StatusReverted = "reverted"
+	// StatusIncluded is a valid transaction of the source chain whose receipt is unknown
+	StatusIncluded = "included"
+	// StatusInvalid is a transaction that could not be added to a block
+	StatusInvalid = "invalid"
+	// StatusOverflow is a transaction that doesn't fit into an empty batch
+	StatusOverflow = "overflow"
+)
+
+// DefaultReportFile is the name of the report in the datadir when no report file is configured
+const DefaultReportFile = "shadow-fork.jsonl"
+
+// receiptFetchers is how many receipts of the source chain are fetched at once ahead of the replay of a batch
+const receiptFetchers = 16
+
+// Source is the datastream of a node of the source chain
+type Source interface {
+	GetL2BlockByNumber(blockNum uint64) (*types.FullL2Block, int, error)
+	GetLatestL2Block() (*types.FullL2Block, error)
+}
+
+// Receipts fetches the receipts of the transactions of the source chain
+type Receipts interface {
+	TransactionReceipt(ctx context.Context, txHash common.Hash) (*coretypes.Receipt, error)
+}
+
+// Outcome is the result of a transaction on one of the chains
+type Outcome struct {
+	ForkId   uint64         `json:"forkId"`
+	Status   string         `json:"status"`
+	GasUsed  *uint64        `json:"gasUsed,omitempty"`
+	Counters map[string]int `json:"counters,omitempty"`
+	Error    string         `json:"error,omitempty"`
+}
+
+// TxRecord is a line of the report comparing a transaction of the source chain with its replay on the fork
+type TxRecord struct {
+	Hash          common.Hash    `json:"hash"`
+	SourceBlock   uint64         `json:"sourceBlock"`
+	SourceBatch   uint64         `json:"sourceBatch"`
+	ForkBlock     uint64         `json:"forkBlock,omitempty"`
+	ForkBatch     uint64         `json:"forkBatch"`
+	Source        Outcome        `json:"source"`
+	Fork          Outcome        `json:"fork"`
+	Match         bool           `json:"match"`
+	GasDelta      *int64         `json:"gasDelta,omitempty"`
+	CounterDeltas map[string]int `json:"counterDeltas,omitempty"`
+}
+
+// Summary counts the replayed transactions since the start of the node
+type Summary struct {
+	Txs        uint64
+	Mismatches uint64
+	Invalid    uint64
+	Overflow   uint64
+}
+
+// ShadowFork feeds the transactions of a source chain to the sequencer and reports how their results differ
+type ShadowFork struct {
+	source     Source
+	receipts   Receipts
+	startBlock uint64
+	reportFile string
+	report     *os.File
+	pending    []*TxRecord
+	summary    Summary
+	fetch      *receiptsFetch
+}
+
+// receiptsFetch holds the receipts of the source chain fetched in the background for the batch being replayed
+type receiptsFetch struct {
+	done     chan struct{}
+	lock     sync.Mutex
+	receipts map[common.Hash]*coretypes.Receipt
+}
+
+// New returns a shadow fork replaying the source after startBlock. Receipts may be nil, the source outcome then only
+// says whether the transaction was valid.
+func New(source Source, receipts Receipts, startBlock uint64, reportFile string) *ShadowFork {
+	return &ShadowFork{
+		source:     source,
+		receipts:   receipts,
+		startBlock: startBlock,
+		reportFile: reportFile,
+	}
+}
+
+// NewFromZk returns a shadow fork reading the configured datastream and rpc of the source chain, or nil if the shadow
+// fork is not enabled
+func NewFromZk(zk *ethconfig.Zk, dataDir string) (*ShadowFork, error) {
+	if zk == nil || !zk.SequencerShadowFork {
+		return nil, nil
+	}
+
+	source := client.NewClient(context.Background(), zk.L2DataStreamerUrl, zk.DatastreamVersion, zk.L2DataStreamerTimeout, 0)
+
+	var receipts Receipts
+	if zk.L2RpcUrl != "" {
+		ec, err := ethclient.Dial(zk.L2RpcUrl)
+		if err != nil {
+			return nil, fmt.Errorf("failed to dial the rpc of the source chain %s: %w", zk.L2RpcUrl, err)
+		}
+		receipts = ec
+	}
+
+	reportFile := zk.SequencerShadowForkReport
+	if reportFile == "" {
+		reportFile = filepath.Join(dataDir, DefaultReportFile)
+	}
+
+	return New(source, receipts, zk.SequencerShadowForkStartBlock, reportFile), nil
+}
+
+// StartBlock is the block of the source chain the state of the fork was taken at
+func (s *ShadowFork) StartBlock() uint64 {
+	return s.startBlock
+}
+
+// Summary returns the counts of the replayed transactions
+func (s *ShadowFork) Summary() Summary {
+	return s.summary
+}
+
+// NextBatch returns the blocks after fromBlock that belong to the same batch of the source chain. It returns nothing
+// until the source chain has moved on to a later batch, so that only closed batches are replayed.
+func (s *ShadowFork) NextBatch(fromBlock uint64) ([]*types.FullL2Block, error) {
+	latest, err := s.source.GetLatestL2Block()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get the latest block of the source chain: %w", err)
+	}
+	if latest.L2BlockNumber <= fromBlock {
+		return nil, nil
+	}
+
+	first, err := s.getBlock(fromBlock + 1)
+	if err != nil {
+		return nil, err
+	}
+	if latest.BatchNumber <= first.BatchNumber {
+		return nil, nil
+	}
+
+	blocks := []*types.FullL2Block{first}
+	for blockNo := fromBlock + 2; blockNo <= latest.L2BlockNumber; blockNo++ {
+		block, err := s.getBlock(blockNo)
+		if err != nil {
+			return nil, err
+		}
+		if block.BatchNumber != first.BatchNumber {
+			break
+		}
+		blocks = append(blocks, block)
+	}
+
+	return blocks, nil
+}
+
+func (s *ShadowFork) getBlock(blockNo uint64) (*types.FullL2Block, error) {
+	block, errCode, err := s.source.GetL2BlockByNumber(blockNo)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get block %d of the source chain: %w", blockNo, err)
+	}
+	if errCode != types.CmdErrOK || block == nil {
+		return nil, fmt.Errorf("failed to get block %d of the source chain: error code %d", blockNo, errCode)
+	}
+	return block, nil
+}
+
+// FetchReceipts starts fetching the receipts of the valid transactions of the blocks in the background, so that the
+// replay of the batch doesn't wait on the rpc of the source chain for each of its transactions
+func (s *ShadowFork) FetchReceipts(ctx context.Context, blocks []*types.FullL2Block) {
+	s.fetch = nil
+	if s.receipts == nil {
+		return
+	}
+
+	var hashes []common.Hash
+	for _, block := range blocks {
+		for _, l2Tx := range block.L2Txs {
+			if !l2Tx.IsValid {
+				continue
+			}
+			// the replay reports the transactions it can't decode
+			tx, _, err := zktx.DecodeTx(l2Tx.Encoded, l2Tx.EffectiveGasPricePercentage, block.ForkId)
+			if err != nil {
+				continue
+			}
+			hashes = append(hashes, tx.Hash())
+		}
+	}
+
+	fetch := &receiptsFetch{done: make(chan struct{}), receipts: make(map[common.Hash]*coretypes.Receipt, len(hashes))}
+	s.fetch = fetch
+	go func() {
+		defer close(fetch.done)
+		g, gCtx := errgroup.WithContext(ctx)
+		g.SetLimit(receiptFetchers)
+		for _, hash := range hashes {
+			hash := hash
+			g.Go(func() error {
+				// a receipt that failed to be fetched is asked for again when its transaction is recorded
+				receipt, err := s.receipts.TransactionReceipt(gCtx, hash)
+				if err != nil || receipt == nil {
+					return nil
+				}
+				fetch.lock.Lock()
+				fetch.receipts[hash] = receipt
+				fetch.lock.Unlock()
+				return nil
+			})
+		}
+		_ = g.Wait()
+	}()
+}
+
+// sourceReceipt returns the receipt of a transaction of the source chain, fetched ahead by FetchReceipts if it could be
+func (s *ShadowFork) sourceReceipt(ctx context.Context, txHash common.Hash) (*coretypes.Receipt, error) {
+	if s.fetch != nil {
+		select {
+		case <-s.fetch.done:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+		if receipt, ok := s.fetch.receipts[txHash]; ok {
+			return receipt, nil
+		}
+	}
+	return s.receipts.TransactionReceipt(ctx, txHash)
+}
+
+// RecordTx completes the source outcome of the record from the source chain and compares it with the outcome on the
+// fork. The record is held until the block of the fork it belongs to is committed and Flush is called.
+func (s *ShadowFork) RecordTx(ctx context.Context, record *TxRecord) error {
+	if record.Source.Status == StatusIncluded && s.receipts != nil {
+		receipt, err := s.sourceReceipt(ctx, record.Hash)
+		if err != nil {
+			log.Warn("Failed to get the receipt of the source chain", "hash", record.Hash, "err", err)
+		} else if receipt != nil {
+			record.Source.Status = StatusSuccess
+			if receipt.Status == coretypes.ReceiptStatusFailed {
+				record.Source.Status = StatusReverted
+			}
+			gasUsed := receipt.GasUsed
+			record.Source.GasUsed = &gasUsed
+		}
+	}
+
+	compare(record)
+	s.pending = append(s.pending, record)
+
+	return nil
+}
+
+// Flush appends the held records to the report, it is called once their block is committed so that a restart doesn't
+// report the transactions it replays twice
+func (s *ShadowFork) Flush() error {
+	for len(s.pending) > 0 {
+		record := s.pending[0]
+		if err := s.write(record); err != nil {
+			return err
+		}
+		s.pending = s.pending[1:]
+
+		s.summary.Txs++
+		if !record.Match {
+			s.summary.Mismatches++
+		}
+		switch record.Fork.Status {
+		case StatusInvalid:
+			s.summary.Invalid++
+		case StatusOverflow:
+			s.summary.Overflow++
+		}
+	}
+
+	s.pending = nil
+	return nil
+}
+
+// Discard drops the held records of a block that was not committed, its transactions are replayed
+func (s *ShadowFork) Discard() {
+	s.pending = nil
+}
+
+// compare sets the match and the deltas of the record, a source transaction without receipt matches any
+// transaction included in a block of the fork
+func compare(record *TxRecord) {
+	source, fork := record.Source, record.Fork
+
+	switch source.Status {
+	case StatusIncluded:
+		record.Match = fork.Status == StatusSuccess || fork.Status == StatusReverted
+	default:
+		record.Match = source.Status == fork.Status
+	}
+
+	if source.GasUsed != nil && fork.GasUsed != nil {
+		delta := int64(*fork.GasUsed) - int64(*source.GasUsed)
+		record.GasDelta = &delta
+		if delta != 0 {
+			record.Match = false
+		}
+	}
+
+	if source.Counters != nil && fork.Counters != nil {
+		deltas := make(map[string]int)
+		for name, used := range fork.Counters {
+			if delta := used - source.Counters[name]; delta != 0 {
+				deltas[name] = delta
+			}
+		}
+		for name, used := range source.Counters {
+			if _, ok := fork.Counters[name]; !ok && used != 0 {
+				deltas[name] = -used
+			}
+		}
+		if len(deltas) > 0 {
+			record.CounterDeltas = deltas
+		}
+	}
+}
+
+func (s *ShadowFork) write(record *TxRecord) error {
+	if s.report == nil {
+		if err := os.MkdirAll(filepath.Dir(s.reportFile), 0755); err != nil {
+			return err
+		}
+		f, err := os.OpenFile(s.reportFile, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+		if err != nil {
+			return fmt.Errorf("failed to open the shadow fork report: %w", err)
+		}
+		s.report = f
+	}
+
+	line, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	if _, err = s.report.Write(append(line, '\n')); err != nil {
+		return fmt.Errorf("failed to write the shadow fork report: %w", err)
+	}
+	return nil
+}
+
+// LogSummary logs the counts of the replayed transactions
+func (s *ShadowFork) LogSummary(logPrefix string, sourceBlock uint64, elapsed time.Duration) {
+	log.Info(fmt.Sprintf("[%s] Shadow fork replayed the source chain", logPrefix),
+		"sourceBlock", sourceBlock,
+		"txs", s.summary.Txs,
+		"mismatches", s.summary.Mismatches,
+		"invalid", s.summary.Invalid,
+		"overflow", s.summary.Overflow,
+		"report", s.reportFile,
+		"elapsed", elapsed,
+	)
+}
+
+// Close closes the report
+func (s *ShadowFork) Close() error {
+	if s.report == nil {
+		return nil
+	}
+	err := s.report.Close()
+	s.report = nil
+	return err
+}
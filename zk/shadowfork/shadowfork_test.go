@@ -0,0 +1,216 @@
+package shadowfork
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/holiman/uint256"
+	"github.com/ledgerwatch/erigon-lib/common"
+	"github.com/stretchr/testify/require"
+
+	coretypes "github.com/ledgerwatch/erigon/core/types"
+	"github.com/ledgerwatch/erigon/zk/datastream/types"
+)
+
+// testSource is a source chain with the blocks 1-5 in batches 1, 1, 2, 2 and 3
+type testSource struct {
+	blocks []*types.FullL2Block
+}
+
+func newTestSource() *testSource {
+	s := &testSource{}
+	for i, batchNo := range []uint64{1, 1, 2, 2, 3} {
+		s.blocks = append(s.blocks, &types.FullL2Block{L2BlockNumber: uint64(i + 1), BatchNumber: batchNo})
+	}
+	return s
+}
+
+func (s *testSource) GetL2BlockByNumber(blockNum uint64) (*types.FullL2Block, int, error) {
+	if blockNum == 0 || blockNum > uint64(len(s.blocks)) {
+		return nil, -1, errors.New("not found")
+	}
+	return s.blocks[blockNum-1], types.CmdErrOK, nil
+}
+
+func (s *testSource) GetLatestL2Block() (*types.FullL2Block, error) {
+	return s.blocks[len(s.blocks)-1], nil
+}
+
+type testReceipts map[common.Hash]*coretypes.Receipt
+
+func (r testReceipts) TransactionReceipt(_ context.Context, txHash common.Hash) (*coretypes.Receipt, error) {
+	if receipt, ok := r[txHash]; ok {
+		return receipt, nil
+	}
+	return nil, errors.New("not found")
+}
+
+func blockNumbers(blocks []*types.FullL2Block) []uint64 {
+	numbers := make([]uint64, 0, len(blocks))
+	for _, block := range blocks {
+		numbers = append(numbers, block.L2BlockNumber)
+	}
+	return numbers
+}
+
+func TestNextBatch(t *testing.T) {
+	s := New(newTestSource(), nil, 0, "")
+
+	blocks, err := s.NextBatch(0)
+	require.NoError(t, err)
+	require.Equal(t, []uint64{1, 2}, blockNumbers(blocks))
+
+	// a start in the middle of a batch replays the rest of it
+	blocks, err = s.NextBatch(2)
+	require.NoError(t, err)
+	require.Equal(t, []uint64{3, 4}, blockNumbers(blocks))
+
+	// the last batch may still be open
+	blocks, err = s.NextBatch(4)
+	require.NoError(t, err)
+	require.Empty(t, blocks)
+
+	blocks, err = s.NextBatch(5)
+	require.NoError(t, err)
+	require.Empty(t, blocks)
+}
+
+func uint64Ptr(v uint64) *uint64 {
+	return &v
+}
+
+func TestRecordTx(t *testing.T) {
+	ctx := context.Background()
+	reportFile := filepath.Join(t.TempDir(), "report", DefaultReportFile)
+	receipts := testReceipts{
+		{1}: {Status: coretypes.ReceiptStatusSuccessful, GasUsed: 21000},
+		{2}: {Status: coretypes.ReceiptStatusFailed, GasUsed: 50000},
+		{3}: {Status: coretypes.ReceiptStatusSuccessful, GasUsed: 100000},
+	}
+	s := New(newTestSource(), receipts, 0, reportFile)
+	defer s.Close()
+
+	records := []*TxRecord{
+		{
+			Hash:   common.Hash{1},
+			Source: Outcome{ForkId: 9, Status: StatusIncluded, Counters: map[string]int{"S": 100, "B": 10}},
+			Fork:   Outcome{ForkId: 12, Status: StatusSuccess, GasUsed: uint64Ptr(21000), Counters: map[string]int{"S": 100, "B": 10}},
+		},
+		{
+			Hash:   common.Hash{2},
+			Source: Outcome{ForkId: 9, Status: StatusIncluded},
+			Fork:   Outcome{ForkId: 12, Status: StatusSuccess, GasUsed: uint64Ptr(50000)},
+		},
+		{
+			Hash:   common.Hash{3},
+			Source: Outcome{ForkId: 9, Status: StatusIncluded, Counters: map[string]int{"S": 100, "K": 1}},
+			Fork:   Outcome{ForkId: 12, Status: StatusSuccess, GasUsed: uint64Ptr(90000), Counters: map[string]int{"S": 120}},
+		},
+		{
+			Hash:   common.Hash{4},
+			Source: Outcome{ForkId: 9, Status: StatusIncluded},
+			Fork:   Outcome{ForkId: 12, Status: StatusOverflow},
+		},
+	}
+	// the records of a block that is not committed are dropped
+	require.NoError(t, s.RecordTx(ctx, &TxRecord{Hash: common.Hash{5}, Fork: Outcome{Status: StatusInvalid}}))
+	s.Discard()
+
+	for _, record := range records {
+		require.NoError(t, s.RecordTx(ctx, record))
+	}
+
+	// nothing is reported before the block is committed
+	require.Equal(t, Summary{}, s.Summary())
+	_, err := os.Stat(reportFile)
+	require.True(t, os.IsNotExist(err))
+	require.NoError(t, s.Flush())
+
+	require.True(t, records[0].Match)
+	require.Zero(t, *records[0].GasDelta)
+	require.Nil(t, records[0].CounterDeltas)
+
+	require.False(t, records[1].Match)
+	require.Equal(t, StatusReverted, records[1].Source.Status)
+
+	require.False(t, records[2].Match)
+	require.Equal(t, int64(-10000), *records[2].GasDelta)
+	require.Equal(t, map[string]int{"S": 20, "K": -1}, records[2].CounterDeltas)
+
+	// without a receipt any inclusion matches the source, but not an overflow
+	require.Equal(t, StatusIncluded, records[3].Source.Status)
+	require.False(t, records[3].Match)
+
+	require.Equal(t, Summary{Txs: 4, Mismatches: 3, Overflow: 1}, s.Summary())
+
+	f, err := os.Open(reportFile)
+	require.NoError(t, err)
+	defer f.Close()
+	var lines []TxRecord
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var record TxRecord
+		require.NoError(t, json.Unmarshal(scanner.Bytes(), &record))
+		lines = append(lines, record)
+	}
+	require.Len(t, lines, 4)
+	require.Equal(t, *records[2], lines[2])
+}
+
+// countingReceipts counts the receipts asked for, safe for the fetchers running in the background
+type countingReceipts struct {
+	testReceipts
+	lock  sync.Mutex
+	calls int
+}
+
+func (r *countingReceipts) TransactionReceipt(ctx context.Context, txHash common.Hash) (*coretypes.Receipt, error) {
+	r.lock.Lock()
+	r.calls++
+	r.lock.Unlock()
+	return r.testReceipts.TransactionReceipt(ctx, txHash)
+}
+
+func TestFetchReceipts(t *testing.T) {
+	ctx := context.Background()
+
+	block := &types.FullL2Block{L2BlockNumber: 1, BatchNumber: 1, ForkId: 4}
+	var hashes []common.Hash
+	for nonce := uint64(0); nonce < 3; nonce++ {
+		tx := coretypes.NewTransaction(nonce, common.Address{}, uint256.NewInt(0), 21000, uint256.NewInt(0), nil)
+		var encoded bytes.Buffer
+		require.NoError(t, tx.MarshalBinary(&encoded))
+		// the receipt of an invalid transaction is never asked for
+		block.L2Txs = append(block.L2Txs, types.L2TransactionProto{L2BlockNumber: 1, IsValid: nonce != 2, Encoded: encoded.Bytes()})
+		hashes = append(hashes, tx.Hash())
+	}
+
+	receipts := &countingReceipts{testReceipts: testReceipts{
+		hashes[0]: {Status: coretypes.ReceiptStatusSuccessful, GasUsed: 21000},
+		hashes[1]: {Status: coretypes.ReceiptStatusFailed, GasUsed: 21000},
+	}}
+	s := New(newTestSource(), receipts, 0, filepath.Join(t.TempDir(), DefaultReportFile))
+	defer s.Close()
+
+	s.FetchReceipts(ctx, []*types.FullL2Block{block})
+	first := &TxRecord{Hash: hashes[0], Source: Outcome{Status: StatusIncluded}, Fork: Outcome{Status: StatusSuccess}}
+	second := &TxRecord{Hash: hashes[1], Source: Outcome{Status: StatusIncluded}, Fork: Outcome{Status: StatusReverted}}
+	require.NoError(t, s.RecordTx(ctx, first))
+	require.NoError(t, s.RecordTx(ctx, second))
+	require.Equal(t, StatusSuccess, first.Source.Status)
+	require.Equal(t, StatusReverted, second.Source.Status)
+	require.Equal(t, 2, receipts.calls)
+
+	// a transaction the fetch doesn't know is asked for when it is recorded
+	other := &TxRecord{Hash: common.Hash{9}, Source: Outcome{Status: StatusIncluded}, Fork: Outcome{Status: StatusSuccess}}
+	require.NoError(t, s.RecordTx(ctx, other))
+	require.Equal(t, StatusIncluded, other.Source.Status)
+	require.Equal(t, 3, receipts.calls)
+}
@@ -648,19 +648,25 @@ func verifyLastHash(dbSmt *smt.SMT, expectedRootHash *common.Hash, checkRoot boo
 }
 
 func processAccount(db smt.DB, a *accounts.Account, as map[string]string, inc uint64, psr *state2.PlainStateReader, addr common.Address, keys []utils.NodeKey) ([]utils.NodeKey, error) {
-	// get the account balance and nonce
-	keys, err := insertAccountStateToKV(db, keys, addr.String(), a.Balance.ToBig(), new(big.Int).SetUint64(a.Nonce))
+	// store the contract bytecode
+	cc, err := psr.ReadAccountCode(addr, inc, a.CodeHash)
 	if err != nil {
 		return []utils.NodeKey{}, err
 	}
 
-	// store the contract bytecode
-	cc, err := psr.ReadAccountCode(addr, inc, a.CodeHash)
+	return InsertAccountToKV(db, keys, addr, a, cc, as)
+}
+
+// InsertAccountToKV writes the balance, nonce, bytecode and storage of an account to the smt db and returns the keys
+// with the account's keys appended, ready for a bulk build of the tree with GenerateFromKVBulk
+func InsertAccountToKV(db smt.DB, keys []utils.NodeKey, addr common.Address, a *accounts.Account, code []byte, storage map[string]string) ([]utils.NodeKey, error) {
+	// get the account balance and nonce
+	keys, err := insertAccountStateToKV(db, keys, addr.String(), a.Balance.ToBig(), new(big.Int).SetUint64(a.Nonce))
 	if err != nil {
 		return []utils.NodeKey{}, err
 	}
 
-	ach := hexutils.BytesToHex(cc)
+	ach := hexutils.BytesToHex(code)
 	if len(ach) > 0 {
 		hexcc := "0x" + ach
 		keys, err = insertContractBytecodeToKV(db, keys, addr.String(), hexcc)
@@ -669,9 +675,9 @@ func processAccount(db smt.DB, a *accounts.Account, as map[string]string, inc ui
 		}
 	}
 
-	if len(as) > 0 {
+	if len(storage) > 0 {
 		// store the account storage
-		keys, err = insertContractStorageToKV(db, keys, addr.String(), as)
+		keys, err = insertContractStorageToKV(db, keys, addr.String(), storage)
 		if err != nil {
 			return []utils.NodeKey{}, err
 		}
@@ -14,7 +14,9 @@ import (
 	"github.com/ledgerwatch/erigon/eth/stagedsync/stages"
 	"github.com/ledgerwatch/erigon/zk/contracts"
 	"github.com/ledgerwatch/erigon/zk/hermez_db"
+	"github.com/ledgerwatch/erigon/zk/l1_data"
 	"github.com/ledgerwatch/erigon/zk/l1infotree"
+	zktypes "github.com/ledgerwatch/erigon/zk/types"
 	"github.com/ledgerwatch/log/v3"
 )
 
@@ -60,6 +62,27 @@ func SpawnL1InfoTreeStage(
 	if err != nil {
 		return err
 	}
+
+	if cfg.zkCfg.UseL1SyncArchive() {
+		manifest, err := l1_data.ReadSequenceArchiveManifest(cfg.zkCfg.L1SyncArchive)
+		if err != nil {
+			return err
+		}
+		// without the updates in the archive the info tree is built from the L1 as usual, and so it is past the end of
+		// the archive
+		if manifest.L1InfoTreeUpdates != nil && progress <= manifest.ToL1Block {
+			if funcErr = syncL1InfoTreeFromArchive(logPrefix, tx, hermezDb, cfg, manifest, progress); funcErr != nil {
+				return funcErr
+			}
+			if freshTx {
+				if funcErr = tx.Commit(); funcErr != nil {
+					return funcErr
+				}
+			}
+			return nil
+		}
+	}
+
 	if progress == 0 {
 		progress = cfg.zkCfg.L1FirstBlock - 1
 	}
@@ -158,39 +181,12 @@ LOOP:
 					return funcErr
 				}
 
-				leafHash := l1infotree.HashLeafData(tmpUpdate.GER, tmpUpdate.ParentHash, tmpUpdate.Timestamp)
-				if tree.LeafExists(leafHash) {
-					log.Warn("Skipping log as L1 Info Tree leaf already exists", "hash", leafHash)
-					continue
-				}
-
-				if latestUpdate != nil {
-					tmpUpdate.Index = latestUpdate.Index + 1
-				} // if latestUpdate is nil then Index = 0 which is the default value so no need to set it
-				latestUpdate = tmpUpdate
-
-				newRoot, err := tree.AddLeaf(uint32(latestUpdate.Index), leafHash)
-				if err != nil {
-					funcErr = err
-					return funcErr
-				}
-				log.Debug("New L1 Index",
-					"index", latestUpdate.Index,
-					"root", newRoot.String(),
-					"mainnet", latestUpdate.MainnetExitRoot.String(),
-					"rollup", latestUpdate.RollupExitRoot.String(),
-					"ger", latestUpdate.GER.String(),
-					"parent", latestUpdate.ParentHash.String(),
-				)
-
-				if funcErr = HandleL1InfoTreeUpdate(hermezDb, latestUpdate); funcErr != nil {
+				var added bool
+				if latestUpdate, added, funcErr = addL1InfoTreeUpdate(hermezDb, tree, latestUpdate, tmpUpdate); funcErr != nil {
 					return funcErr
 				}
-				if funcErr = hermezDb.WriteL1InfoTreeLeaf(latestUpdate.Index, leafHash); funcErr != nil {
-					return funcErr
-				}
-				if funcErr = hermezDb.WriteL1InfoTreeRoot(common.BytesToHash(newRoot[:]), latestUpdate.Index); funcErr != nil {
-					return funcErr
+				if !added {
+					continue
 				}
 
 				processed++
@@ -219,6 +215,82 @@ LOOP:
 	return nil
 }
 
+// addL1InfoTreeUpdate adds the update to the tree as the next index after latestUpdate and stores the leaf, root and
+// update itself.  It returns the new latest update and false if the leaf was already in the tree.
+func addL1InfoTreeUpdate(hermezDb *hermez_db.HermezDb, tree *l1infotree.L1InfoTree, latestUpdate, update *zktypes.L1InfoTreeUpdate) (*zktypes.L1InfoTreeUpdate, bool, error) {
+	leafHash := l1infotree.HashLeafData(update.GER, update.ParentHash, update.Timestamp)
+	if tree.LeafExists(leafHash) {
+		log.Warn("Skipping log as L1 Info Tree leaf already exists", "hash", leafHash)
+		return latestUpdate, false, nil
+	}
+
+	if latestUpdate != nil {
+		update.Index = latestUpdate.Index + 1
+	} // if latestUpdate is nil then Index = 0 which is the default value so no need to set it
+
+	newRoot, err := tree.AddLeaf(uint32(update.Index), leafHash)
+	if err != nil {
+		return latestUpdate, false, err
+	}
+	log.Debug("New L1 Index",
+		"index", update.Index,
+		"root", newRoot.String(),
+		"mainnet", update.MainnetExitRoot.String(),
+		"rollup", update.RollupExitRoot.String(),
+		"ger", update.GER.String(),
+		"parent", update.ParentHash.String(),
+	)
+
+	if err = HandleL1InfoTreeUpdate(hermezDb, update); err != nil {
+		return latestUpdate, false, err
+	}
+	if err = hermezDb.WriteL1InfoTreeLeaf(update.Index, leafHash); err != nil {
+		return latestUpdate, false, err
+	}
+	if err = hermezDb.WriteL1InfoTreeRoot(common.BytesToHash(newRoot[:]), update.Index); err != nil {
+		return latestUpdate, false, err
+	}
+
+	return update, true, nil
+}
+
+// syncL1InfoTreeFromArchive builds the L1 info tree from the updates stored in a sequence archive instead of querying
+// the L1, used during an offline L1 recovery
+func syncL1InfoTreeFromArchive(logPrefix string, tx kv.RwTx, hermezDb *hermez_db.HermezDb, cfg L1InfoTreeCfg, manifest *l1_data.SequenceArchiveManifest, progress uint64) error {
+	archive, err := l1_data.OpenSequenceArchive(cfg.zkCfg.L1SyncArchive, cfg.zkCfg.L1ChainId, cfg.zkCfg.AddressRollup, cfg.zkCfg.L1RollupId)
+	if err != nil {
+		return err
+	}
+
+	latestUpdate, _, err := hermezDb.GetLatestL1InfoTreeUpdate()
+	if err != nil {
+		return err
+	}
+	tree, err := initialiseL1InfoTree(hermezDb)
+	if err != nil {
+		return err
+	}
+
+	processed := 0
+	for _, update := range archive.L1InfoTreeUpdates {
+		if update.BlockNumber < progress {
+			continue
+		}
+		tmpUpdate := update
+		var added bool
+		if latestUpdate, added, err = addL1InfoTreeUpdate(hermezDb, tree, latestUpdate, &tmpUpdate); err != nil {
+			return err
+		}
+		if added {
+			processed++
+		}
+	}
+
+	log.Info(fmt.Sprintf("[%s] Info tree updates imported from archive", logPrefix), "count", processed)
+
+	return stages.SaveStageProgress(tx, stages.L1InfoTree, manifest.ToL1Block+1)
+}
+
 func chunkLogs(slice []types.Log, chunkSize int) [][]types.Log {
 	var chunks [][]types.Log
 	for i := 0; i < len(slice); i += chunkSize {
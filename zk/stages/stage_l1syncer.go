@@ -133,6 +133,9 @@ func SpawnStageL1Syncer(
 	newVerificationsCount := 0
 	newSequencesCount := 0
 	highestWrittenL1BlockNo := uint64(0)
+
+	// the transitions are written once all logs are read so that a rollback can drop the pending ones
+	var transitions []*types.BatchTransition
 Loop:
 	for {
 		select {
@@ -155,12 +158,18 @@ Loop:
 					if info.L1BlockNo > highestWrittenL1BlockNo {
 						highestWrittenL1BlockNo = info.L1BlockNo
 					}
+					transitions = append(transitions, newBatchTransition(types.BatchStatusVirtual, info))
 					newSequencesCount++
 				case logRollbackBatches:
 					if err := hermezDb.RollbackSequences(info.BatchNo); err != nil {
 						funcErr = fmt.Errorf("failed to write rollback sequence, %w", err)
 						return funcErr
 					}
+					if err := hermezDb.DeleteBatchTransitionsAbove(types.BatchStatusVirtual, info.BatchNo); err != nil {
+						funcErr = fmt.Errorf("failed to roll back batch transitions, %w", err)
+						return funcErr
+					}
+					transitions = rollbackBatchTransitions(transitions, info.BatchNo)
 					if info.L1BlockNo > highestWrittenL1BlockNo {
 						highestWrittenL1BlockNo = info.L1BlockNo
 					}
@@ -181,6 +190,7 @@ Loop:
 					if info.L1BlockNo > highestWrittenL1BlockNo {
 						highestWrittenL1BlockNo = info.L1BlockNo
 					}
+					transitions = append(transitions, newBatchTransition(types.BatchStatusVerified, info))
 					newVerificationsCount++
 				case logIncompatible:
 					continue
@@ -198,6 +208,17 @@ Loop:
 		}
 	}
 
+	for _, transition := range transitions {
+		if err := hermezDb.WriteBatchTransition(transition); err != nil {
+			funcErr = fmt.Errorf("failed to write batch transitions, %w", err)
+			return funcErr
+		}
+	}
+	if err := finalizeBatchTransitions(cfg.syncer, hermezDb, logPrefix); err != nil {
+		funcErr = fmt.Errorf("failed to finalize batch transitions, %w", err)
+		return funcErr
+	}
+
 	latestCheckedBlock := cfg.syncer.GetLastCheckedL1Block()
 
 	lastCheckedL1BlockCounter.Set(float64(latestCheckedBlock))
@@ -310,6 +331,80 @@ func parseLogType(l1RollupId uint64, log *ethTypes.Log) (l1BatchInfo types.L1Bat
 	}, batchLogType
 }
 
+func newBatchTransition(status types.BatchStatus, info types.L1BatchInfo) *types.BatchTransition {
+	return &types.BatchTransition{
+		Status:    status,
+		BatchNo:   info.BatchNo,
+		L1BlockNo: info.L1BlockNo,
+		L1TxHash:  info.L1TxHash,
+	}
+}
+
+// rollbackBatchTransitions drops the pending virtual transitions of the batches above batchNo
+func rollbackBatchTransitions(transitions []*types.BatchTransition, batchNo uint64) []*types.BatchTransition {
+	kept := transitions[:0]
+	for _, transition := range transitions {
+		if transition.Status == types.BatchStatusVirtual && transition.BatchNo > batchNo {
+			continue
+		}
+		kept = append(kept, transition)
+	}
+	return kept
+}
+
+// finalizeBatchTransitions marks the batches whose verification is in a finalized l1 block as finalized
+func finalizeBatchTransitions(syncer IL1Syncer, hermezDb *hermez_db.HermezDb, logPrefix string) error {
+	latestVerified, err := hermezDb.GetLatestBatchTransition(types.BatchStatusVerified)
+	if err != nil || latestVerified == nil {
+		return err
+	}
+	latestFinalized, err := hermezDb.GetLatestBatchTransition(types.BatchStatusFinalized)
+	if err != nil {
+		return err
+	}
+	var finalizedBatchNo uint64
+	if latestFinalized != nil {
+		finalizedBatchNo = latestFinalized.BatchNo
+	}
+	if latestVerified.BatchNo <= finalizedBatchNo {
+		return nil
+	}
+
+	_, finalizedL1BlockNo, err := syncer.CheckL1BlockFinalized(latestVerified.L1BlockNo)
+	if err != nil {
+		// not every l1 supports the finalized tag, the batches stay verified
+		log.Warn(fmt.Sprintf("[%s] Failed to get the finalized L1 block", logPrefix), "err", err)
+		return nil
+	}
+
+	verified, err := hermezDb.GetBatchTransitionsFrom(types.BatchStatusVerified, finalizedBatchNo+1, 0)
+	if err != nil {
+		return err
+	}
+
+	finalized := 0
+	for _, v := range verified {
+		if v.L1BlockNo > finalizedL1BlockNo {
+			break
+		}
+		if err = hermezDb.WriteBatchTransition(&types.BatchTransition{
+			Status:    types.BatchStatusFinalized,
+			BatchNo:   v.BatchNo,
+			L1BlockNo: v.L1BlockNo,
+			L1TxHash:  v.L1TxHash,
+		}); err != nil {
+			return err
+		}
+		finalizedBatchNo = v.BatchNo
+		finalized++
+	}
+
+	if finalized > 0 {
+		log.Info(fmt.Sprintf("[%s] Batches finalized on L1", logPrefix), "batchNo", finalizedBatchNo, "l1BlockNo", finalizedL1BlockNo)
+	}
+	return nil
+}
+
 func UnwindL1SyncerStage(u *stagedsync.UnwindState, tx kv.RwTx, cfg L1SyncerCfg, ctx context.Context) (err error) {
 	// we want to keep L1 data during an unwind, as we only sync finalised data there should be
 	// no need to unwind here
@@ -15,6 +15,7 @@ import (
 	"github.com/ledgerwatch/erigon/eth/stagedsync"
 	"github.com/ledgerwatch/erigon/eth/stagedsync/stages"
 	"github.com/ledgerwatch/erigon/zk"
+	"github.com/ledgerwatch/erigon/zk/shadowfork"
 	zktx "github.com/ledgerwatch/erigon/zk/tx"
 	"github.com/ledgerwatch/erigon/zk/utils"
 )
@@ -55,6 +56,10 @@ func SpawnSequencingStage(
 		return nil
 	}
 
+	if cfg.shadowFork != nil {
+		return shadowFork(s, u, ctx, cfg, historyCfg, roTx)
+	}
+
 	return sequencingBatchStep(s, u, ctx, cfg, historyCfg, nil)
 }
 
@@ -171,6 +176,14 @@ func sequencingBatchStep(
 		return err
 	}
 
+	if cfg.feeOracle != nil && !batchState.isAnyRecovery() {
+		// the estimate uses the L1 gas price sampled in the background by the oracle, a failed estimate falls back to
+		// the previous one, or the static effective gas prices if there is none yet
+		if _, err := cfg.feeOracle.Estimate(sdb.hermezDb.HermezDbReader, batchState.batchNumber-1); err != nil {
+			log.Warn(fmt.Sprintf("[%s] Failed to estimate the dynamic gas price", logPrefix), "batch", batchState.batchNumber, "err", err)
+		}
+	}
+
 	if batchState.isL1Recovery() {
 		if cfg.zk.L1SyncStopBatch > 0 && batchState.batchNumber > cfg.zk.L1SyncStopBatch {
 			log.Info(fmt.Sprintf("[%s] L1 recovery has completed!", logPrefix), "batch", batchState.batchNumber)
@@ -257,7 +270,7 @@ func sequencingBatchStep(
 		// timer: evm + smt
 		t := utils.StartTimer("stage_sequence_execute", "evm", "smt")
 
-		infoTreeIndexProgress, l1TreeUpdate, l1TreeUpdateIndex, l1BlockHash, ger, shouldWriteGerToContract, err := prepareL1AndInfoTreeRelatedStuff(sdb, batchState, header.Time, cfg.zk.SequencerResequenceReuseL1InfoIndex)
+		infoTreeIndexProgress, l1TreeUpdate, l1TreeUpdateIndex, l1BlockHash, ger, shouldWriteGerToContract, err := prepareL1AndInfoTreeRelatedStuff(sdb, batchState, header.Time, cfg.zk.SequencerResequenceReuseL1InfoIndex && !batchState.isShadowFork())
 		if err != nil {
 			return err
 		}
@@ -341,16 +354,43 @@ func sequencingBatchStep(
 					txHash := transaction.Hash()
 					effectiveGas := batchState.blockState.getL1EffectiveGases(cfg, i)
 
+					// a shadow fork measures the counters before the transaction is added, the execution is reverted
+					var shadowRecord *shadowfork.TxRecord
+					if batchState.isShadowFork() {
+						shadowRecord = newShadowForkRecord(cfg, sdb, ibs, &blockContext, header, batchState, transaction, effectiveGas)
+					}
+
 					// The copying of this structure is intentional
 					backupDataSizeChecker := *blockDataSizeChecker
 					receipt, execResult, anyOverflow, err := attemptAddTransaction(cfg, sdb, ibs, batchCounters, &blockContext, header, transaction, effectiveGas, batchState.isL1Recovery(), batchState.forkId, l1TreeUpdateIndex, &backupDataSizeChecker)
+					if batchState.isShadowFork() {
+						action, errAction := shadowForkTxAction(ctx, cfg, batchState, shadowRecord, txHash, anyOverflow, err)
+						if errAction != nil {
+							return errAction
+						}
+						if anyOverflow == overflowCounters {
+							batchCounters.RemovePreviousTransactionCounters()
+						}
+
+						switch action {
+						case shadowForkSkipTx:
+							log.Info(fmt.Sprintf("[%s] skipping transaction %s of the source chain that cannot be added to a batch", logPrefix, txHash), "err", err)
+							continue
+						case shadowForkCloseBatch:
+							// keep the order of the source chain, the transaction starts the next batch
+							log.Info(fmt.Sprintf("[%s] closing batch due to overflow", logPrefix), "hash", txHash)
+							runLoopBlocks = false
+							break LOOP_TRANSACTIONS
+						}
+					}
+
 					if err != nil {
 						if batchState.isLimboRecovery() {
 							panic("limbo transaction has already been executed once so they must not fail while re-executing")
 						}
 
 						if batchState.isResequence() {
-							if cfg.zk.SequencerResequenceStrict {
+							if batchState.isStrictResequence(&cfg) {
 								return fmt.Errorf("strict mode enabled, but resequenced batch %d failed to add transaction %s: %v", batchState.batchNumber, txHash, err)
 							} else {
 								log.Warn(fmt.Sprintf("[%s] error adding transaction to batch during resequence: %v", logPrefix, err),
@@ -419,7 +459,7 @@ func sequencingBatchStep(
 							continue
 						}
 
-						if batchState.isResequence() && cfg.zk.SequencerResequenceStrict {
+						if batchState.isStrictResequence(&cfg) {
 							return fmt.Errorf("strict mode enabled, but resequenced batch %d overflowed counters on block %d", batchState.batchNumber, blockNumber)
 						}
 					case overflowGas:
@@ -435,6 +475,12 @@ func sequencingBatchStep(
 					if err == nil {
 						blockDataSizeChecker = &backupDataSizeChecker
 						batchState.onAddedTransaction(transaction, receipt, execResult, effectiveGas)
+
+						if batchState.isShadowFork() {
+							if errRecord := recordShadowForkTx(ctx, cfg, shadowRecord, shadowfork.StatusSuccess, blockNumber, receipt, nil); errRecord != nil {
+								return errRecord
+							}
+						}
 					}
 
 					// We will only update the processed index in resequence job if there isn't overflow
@@ -454,7 +500,7 @@ func sequencingBatchStep(
 						// We need to jump to the next block here if we are at the end of the current block
 						break LOOP_TRANSACTIONS
 					} else {
-						if cfg.zk.SequencerResequenceStrict {
+						if batchState.isStrictResequence(&cfg) {
 							return fmt.Errorf("strict mode enabled, but resequenced batch %d has transactions that overflowed counters or failed transactions", batchState.batchNumber)
 						}
 					}
@@ -503,12 +549,30 @@ func sequencingBatchStep(
 		// add a check to the verifier and also check for responses
 		batchState.onBuiltBlock(blockNumber)
 
+		if batchState.isShadowFork() {
+			if err = saveShadowForkProgress(sdb, batchState.resequenceBatchJob, blockNumber); err != nil {
+				return err
+			}
+		}
+
 		if !batchState.isL1Recovery() {
 			// commit block data here so it is accessible in other threads
 			if errCommitAndStart := sdb.CommitAndStart(); errCommitAndStart != nil {
 				return errCommitAndStart
 			}
 			defer sdb.tx.Rollback()
+
+			// the records of the shadow fork are only reported once their block is committed
+			if batchState.isShadowFork() {
+				if errFlush := cfg.shadowFork.Flush(); errFlush != nil {
+					return errFlush
+				}
+			}
+
+			// the batch only finishes with the stage loop run, so publish opened batches and fork changes per block
+			if errPublish := cfg.zkEvents.Publish(ctx); errPublish != nil {
+				log.Warn(fmt.Sprintf("[%s] Failed to publish zk events", logPrefix), "err", errPublish)
+			}
 		}
 
 		// do not use remote executor in l1recovery mode
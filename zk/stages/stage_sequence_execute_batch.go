@@ -110,6 +110,14 @@ func updateStreamAndCheckRollback(
 			continue
 		}
 
+		// stored with the writes of the sequencer so the report is kept when the batch is resequenced, a sequencer
+		// stopping below never commits it and only logs it
+		if divergence := verifierBundle.Response.Divergence; divergence != nil {
+			if err = verifier.WriteExecutorDivergence(batchContext.sdb.hermezDb, verifierBundle.Request.BatchNumber, divergence); err != nil {
+				return false, err
+			}
+		}
+
 		// The sequencer can goes to this point of the code only in L1Recovery mode or Default Mode.
 		// There is no way to get here in LimboRecoveryMode
 		// If we are here in L1RecoveryMode then let's stop everything by using an infinite loop because something is quite wrong
@@ -65,6 +65,12 @@ func PruneSequenceExecutionStage(s *stagedsync.PruneState, tx kv.RwTx, cfg Seque
 		}
 	}
 
+	if cfg.zk.Prune.Enabled() {
+		if err = stagedsync.PruneZkTables(ctx, tx, cfg.zk.Prune, s.ForwardProgress); err != nil {
+			return err
+		}
+	}
+
 	if err = s.Done(tx); err != nil {
 		return err
 	}
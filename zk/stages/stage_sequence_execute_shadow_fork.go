@@ -0,0 +1,250 @@
+package stages
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/ledgerwatch/erigon-lib/common"
+	"github.com/ledgerwatch/erigon-lib/kv"
+	"github.com/ledgerwatch/log/v3"
+
+	"github.com/ledgerwatch/erigon/core"
+	"github.com/ledgerwatch/erigon/core/state"
+	"github.com/ledgerwatch/erigon/core/types"
+	"github.com/ledgerwatch/erigon/core/vm"
+	"github.com/ledgerwatch/erigon/core/vm/evmtypes"
+	"github.com/ledgerwatch/erigon/eth/stagedsync"
+	"github.com/ledgerwatch/erigon/eth/stagedsync/stages"
+	"github.com/ledgerwatch/erigon/zk/hermez_db"
+	"github.com/ledgerwatch/erigon/zk/shadowfork"
+)
+
+// shadowFork replays the next closed batch of the source chain, the transactions of a batch are sequenced the same
+// as a resequenced batch but their failures and overflows are recorded rather than stopping the sequencer
+func shadowFork(
+	s *stagedsync.StageState,
+	u stagedsync.Unwinder,
+	ctx context.Context,
+	cfg SequenceBlockCfg,
+	historyCfg stagedsync.HistoryCfg,
+	roTx kv.Tx,
+) (err error) {
+	fromBlock, err := stages.GetStageProgress(roTx, stages.ShadowForkSourceBlock)
+	if err != nil {
+		return err
+	}
+	if fromBlock == 0 {
+		fromBlock = cfg.shadowFork.StartBlock()
+	}
+
+	blocks, err := cfg.shadowFork.NextBatch(fromBlock)
+	if err != nil {
+		return err
+	}
+	if len(blocks) == 0 {
+		log.Info(fmt.Sprintf("[%s] Waiting for the source chain to close a batch after block %d", s.LogPrefix(), fromBlock))
+		time.Sleep(cfg.zk.SequencerBatchSealTime)
+		return nil
+	}
+
+	// the records of a step that failed before its block was committed are replayed
+	cfg.shadowFork.Discard()
+	cfg.shadowFork.FetchReceipts(ctx, blocks)
+
+	start := time.Now()
+	batchJob := NewShadowForkBatchJob(blocks)
+	subBatchCount := 0
+	for batchJob.HasMoreBlockToProcess() {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		default:
+		}
+
+		if err = sequencingBatchStep(s, u, ctx, cfg, historyCfg, batchJob); err != nil {
+			return err
+		}
+
+		// the unwind rolls the source progress back with the blocks, the batch is read again after it
+		if u.IsUnwindSet() {
+			return nil
+		}
+
+		subBatchCount += 1
+	}
+
+	lastBlock := blocks[len(blocks)-1].L2BlockNumber
+	log.Info(fmt.Sprintf("[%s] Replayed source batch %d with %d batches", s.LogPrefix(), blocks[0].BatchNumber, subBatchCount), "blocks", fmt.Sprintf("%d-%d", blocks[0].L2BlockNumber, lastBlock))
+	cfg.shadowFork.LogSummary(s.LogPrefix(), lastBlock, time.Since(start))
+
+	return nil
+}
+
+// saveShadowForkProgress saves the last source block of the job whose transactions have all been replayed and keeps it
+// for the fork block, so that an unwind of the block goes back to it. A restart or an unwind replays the source block
+// it stopped in.
+func saveShadowForkProgress(sdb *stageDb, job *ResequenceBatchJob, forkBlock uint64) error {
+	sourceBlock, err := stages.GetStageProgress(sdb.tx, stages.ShadowForkSourceBlock)
+	if err != nil {
+		return err
+	}
+	if job.StartBlockIndex > 0 {
+		sourceBlock = job.batchToProcess[job.StartBlockIndex-1].L2BlockNumber
+		if err = stages.SaveStageProgress(sdb.tx, stages.ShadowForkSourceBlock, sourceBlock); err != nil {
+			return err
+		}
+	}
+	return sdb.hermezDb.WriteShadowForkSourceBlock(forkBlock, sourceBlock)
+}
+
+// unwindShadowForkProgress moves the source progress back to the source block kept for the unwind point, 0 if the
+// shadow fork started after it
+func unwindShadowForkProgress(u *stagedsync.UnwindState, s *stagedsync.StageState, tx kv.RwTx, hermezDb *hermez_db.HermezDb) error {
+	progress, err := stages.GetStageProgress(tx, stages.ShadowForkSourceBlock)
+	if err != nil || progress == 0 {
+		return err
+	}
+
+	sourceBlock, err := hermezDb.GetShadowForkSourceBlock(u.UnwindPoint)
+	if err != nil {
+		return err
+	}
+	if err = hermezDb.DeleteShadowForkSourceBlocks(u.UnwindPoint+1, s.BlockNumber); err != nil {
+		return err
+	}
+	return stages.SaveStageProgress(tx, stages.ShadowForkSourceBlock, sourceBlock)
+}
+
+type shadowForkAction int
+
+const (
+	// shadowForkAddTx keeps the transaction in the block
+	shadowForkAddTx shadowForkAction = iota
+	// shadowForkSkipTx moves on to the next transaction of the source chain
+	shadowForkSkipTx
+	// shadowForkCloseBatch leaves the transaction to start the next batch
+	shadowForkCloseBatch
+)
+
+// shadowForkTxAction decides what happens to a transaction of the source chain after it was attempted. A transaction
+// that overflows a batch with transactions starts the next batch to keep the order of the source chain, one that fails
+// or overflows an empty batch can never be added, it is recorded and skipped.
+func shadowForkTxAction(ctx context.Context, cfg SequenceBlockCfg, batchState *BatchState, record *shadowfork.TxRecord, txHash common.Hash, anyOverflow overflowType, txErr error) (shadowForkAction, error) {
+	switch {
+	case txErr != nil:
+		if err := recordShadowForkTx(ctx, cfg, record, shadowfork.StatusInvalid, 0, nil, txErr); err != nil {
+			return shadowForkSkipTx, err
+		}
+	case anyOverflow == overflowNone:
+		return shadowForkAddTx, nil
+	case batchState.hasAnyTransactionsInThisBatch:
+		return shadowForkCloseBatch, nil
+	default:
+		if err := recordShadowForkTx(ctx, cfg, record, shadowfork.StatusOverflow, 0, nil, nil); err != nil {
+			return shadowForkSkipTx, err
+		}
+	}
+
+	batchState.resequenceBatchJob.UpdateLastProcessedTx(txHash)
+	return shadowForkSkipTx, nil
+}
+
+// newShadowForkRecord starts the record of a transaction of the source chain with the counters it uses on the current
+// state with the rules of the source fork and of the fork
+func newShadowForkRecord(
+	cfg SequenceBlockCfg,
+	sdb *stageDb,
+	ibs *state.IntraBlockState,
+	blockContext *evmtypes.BlockContext,
+	header *types.Header,
+	batchState *BatchState,
+	transaction types.Transaction,
+	effectiveGas uint8,
+) *shadowfork.TxRecord {
+	block, sourceTx := batchState.resequenceBatchJob.sourceTransaction(transaction.Hash())
+	record := &shadowfork.TxRecord{
+		Hash:      transaction.Hash(),
+		ForkBatch: batchState.batchNumber,
+		Source:    shadowfork.Outcome{ForkId: block.ForkId, Status: shadowfork.StatusIncluded},
+		Fork:      shadowfork.Outcome{ForkId: batchState.forkId},
+	}
+	record.SourceBlock = block.L2BlockNumber
+	record.SourceBatch = block.BatchNumber
+	if sourceTx != nil && !sourceTx.IsValid {
+		record.Source.Status = shadowfork.StatusInvalid
+	}
+
+	forkCounters, err := measureTransactionCounters(cfg, sdb, ibs, blockContext, header, transaction, effectiveGas, batchState.forkId)
+	if err != nil {
+		log.Debug("Failed to measure the counters of a shadow fork transaction", "hash", transaction.Hash(), "forkId", batchState.forkId, "err", err)
+		return record
+	}
+	record.Fork.Counters = forkCounters
+
+	record.Source.Counters = forkCounters
+	if block.ForkId != batchState.forkId {
+		if record.Source.Counters, err = measureTransactionCounters(cfg, sdb, ibs, blockContext, header, transaction, effectiveGas, block.ForkId); err != nil {
+			log.Debug("Failed to measure the counters of a shadow fork transaction", "hash", transaction.Hash(), "forkId", block.ForkId, "err", err)
+		}
+	}
+
+	return record
+}
+
+// recordShadowForkTx completes the fork outcome of the record and reports it
+func recordShadowForkTx(ctx context.Context, cfg SequenceBlockCfg, record *shadowfork.TxRecord, status string, forkBlock uint64, receipt *types.Receipt, txErr error) error {
+	record.Fork.Status = status
+	record.ForkBlock = forkBlock
+	if receipt != nil {
+		gasUsed := receipt.GasUsed
+		record.Fork.GasUsed = &gasUsed
+		if receipt.Status == types.ReceiptStatusFailed {
+			record.Fork.Status = shadowfork.StatusReverted
+		}
+	}
+	if txErr != nil {
+		record.Fork.Error = txErr.Error()
+	}
+	return cfg.shadowFork.RecordTx(ctx, record)
+}
+
+// measureTransactionCounters executes the transaction the same as attemptAddTransaction with the counters of the fork
+// id and reverts it
+func measureTransactionCounters(
+	cfg SequenceBlockCfg,
+	sdb *stageDb,
+	ibs *state.IntraBlockState,
+	blockContext *evmtypes.BlockContext,
+	header *types.Header,
+	transaction types.Transaction,
+	effectiveGas uint8,
+	forkId uint64,
+) (map[string]int, error) {
+	// the counters are not checked for an overflow, only their usage is read
+	txCounters := vm.NewTransactionCounter(transaction, sdb.smt.GetDepth(), uint16(forkId), cfg.zk.VirtualCountersSmtReduction, false)
+	if err := txCounters.CalculateRlp(); err != nil {
+		return nil, err
+	}
+
+	vmConfig := *cfg.zkVmConfig
+	vmConfig.CounterCollector = txCounters.ExecutionCounters()
+
+	snapshot := ibs.Snapshot()
+	defer ibs.RevertToSnapshot(snapshot)
+	ibs.Init(transaction.Hash(), common.Hash{}, 0)
+
+	evm := vm.NewZkEVM(*blockContext, evmtypes.TxContext{}, ibs, cfg.chainConfig, vmConfig)
+	gasPool := new(core.GasPool).AddGas(transactionGasLimit)
+	gasUsed := header.GasUsed
+
+	_, execResult, err := core.ApplyTransaction_zkevm(cfg.chainConfig, cfg.engine, evm, gasPool, ibs, noop, header, transaction, &gasUsed, effectiveGas, false)
+	if err != nil {
+		return nil, err
+	}
+	if err = txCounters.ProcessTx(ibs, execResult.ReturnData); err != nil {
+		return nil, err
+	}
+
+	return txCounters.CombineCounters().UsedAsMap(), nil
+}
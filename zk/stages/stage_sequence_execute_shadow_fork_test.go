@@ -0,0 +1,162 @@
+package stages
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/holiman/uint256"
+	"github.com/ledgerwatch/erigon-lib/common"
+	"github.com/ledgerwatch/erigon-lib/kv/memdb"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ledgerwatch/erigon/core/types"
+	"github.com/ledgerwatch/erigon/eth/stagedsync"
+	"github.com/ledgerwatch/erigon/eth/stagedsync/stages"
+	dsTypes "github.com/ledgerwatch/erigon/zk/datastream/types"
+	"github.com/ledgerwatch/erigon/zk/hermez_db"
+	"github.com/ledgerwatch/erigon/zk/shadowfork"
+)
+
+// testTxDecoder decodes the first byte of an encoded source transaction as the nonce of a transfer
+func testTxDecoder(encodedTx []byte, gasPricePercentage uint8, forkID uint64) (types.Transaction, uint8, error) {
+	return types.NewTransaction(uint64(encodedTx[0]), common.Address{}, uint256.NewInt(0), 21000, uint256.NewInt(0), nil), gasPricePercentage, nil
+}
+
+func testSourceBlock(blockNumber uint64, nonces ...byte) *dsTypes.FullL2Block {
+	block := &dsTypes.FullL2Block{BatchNumber: 5, L2BlockNumber: blockNumber, ForkId: 9}
+	for _, nonce := range nonces {
+		block.L2Txs = append(block.L2Txs, dsTypes.L2TransactionProto{L2BlockNumber: blockNumber, IsValid: true, Encoded: []byte{nonce}})
+	}
+	return block
+}
+
+func testShadowForkRecord(batchState *BatchState, transaction types.Transaction) *shadowfork.TxRecord {
+	block, _ := batchState.resequenceBatchJob.sourceTransaction(transaction.Hash())
+	return &shadowfork.TxRecord{
+		Hash:        transaction.Hash(),
+		SourceBlock: block.L2BlockNumber,
+		SourceBatch: block.BatchNumber,
+		ForkBatch:   batchState.batchNumber,
+		Source:      shadowfork.Outcome{ForkId: block.ForkId, Status: shadowfork.StatusIncluded},
+		Fork:        shadowfork.Outcome{ForkId: batchState.forkId},
+	}
+}
+
+// TestShadowForkSequencing replays a source batch the way sequencingBatchStep does, a transaction overflowing a batch
+// with transactions starts the next batch, one that overflows the empty batch or is invalid is reported and skipped.
+// The progress of the source chain is unwound with the blocks of the fork.
+func TestShadowForkSequencing(t *testing.T) {
+	ctx := context.Background()
+	reportFile := filepath.Join(t.TempDir(), shadowfork.DefaultReportFile)
+	cfg := SequenceBlockCfg{shadowFork: shadowfork.New(nil, nil, 9, reportFile)}
+	defer cfg.shadowFork.Close()
+
+	sdb, err := newStageDb(ctx, memdb.NewTestDB(t))
+	require.NoError(t, err)
+	defer sdb.tx.Rollback()
+	require.NoError(t, hermez_db.CreateHermezBuckets(sdb.tx))
+	require.NoError(t, stages.SaveStageProgress(sdb.tx, stages.ShadowForkSourceBlock, 9))
+
+	job := NewShadowForkBatchJob([]*dsTypes.FullL2Block{testSourceBlock(10, 0, 1, 2), testSourceBlock(11, 3), testSourceBlock(12, 4)})
+	batchState := &BatchState{forkId: 12, batchNumber: 3, resequenceBatchJob: job}
+	require.True(t, batchState.isShadowFork())
+
+	txs, err := job.YieldNextBlockTransactions(testTxDecoder)
+	require.NoError(t, err)
+	require.Len(t, txs, 3)
+
+	// fork block 1 adds the first transaction, the invalid second one is skipped
+	action, err := shadowForkTxAction(ctx, cfg, batchState, testShadowForkRecord(batchState, txs[0]), txs[0].Hash(), overflowNone, nil)
+	require.NoError(t, err)
+	require.Equal(t, shadowForkAddTx, action)
+	batchState.hasAnyTransactionsInThisBatch = true
+	job.UpdateLastProcessedTx(txs[0].Hash())
+
+	invalid := errors.New("nonce too low")
+	action, err = shadowForkTxAction(ctx, cfg, batchState, testShadowForkRecord(batchState, txs[1]), txs[1].Hash(), overflowNone, invalid)
+	require.NoError(t, err)
+	require.Equal(t, shadowForkSkipTx, action)
+	require.Equal(t, 2, job.StartTxIndex)
+
+	// the third transaction overflows the batch with transactions, it starts the next batch without being reported
+	action, err = shadowForkTxAction(ctx, cfg, batchState, testShadowForkRecord(batchState, txs[2]), txs[2].Hash(), overflowCounters, nil)
+	require.NoError(t, err)
+	require.Equal(t, shadowForkCloseBatch, action)
+	require.Equal(t, 0, job.StartBlockIndex)
+	require.Equal(t, 2, job.StartTxIndex)
+
+	require.NoError(t, saveShadowForkProgress(sdb, job, 1))
+
+	// fork block 2 starts the next batch, the transaction overflows the empty batch and is skipped
+	batchState = &BatchState{forkId: 12, batchNumber: 4, resequenceBatchJob: job}
+	txs, err = job.YieldNextBlockTransactions(testTxDecoder)
+	require.NoError(t, err)
+	require.Len(t, txs, 1)
+	action, err = shadowForkTxAction(ctx, cfg, batchState, testShadowForkRecord(batchState, txs[0]), txs[0].Hash(), overflowGas, nil)
+	require.NoError(t, err)
+	require.Equal(t, shadowForkSkipTx, action)
+	require.Equal(t, 1, job.StartBlockIndex)
+
+	require.NoError(t, saveShadowForkProgress(sdb, job, 2))
+
+	// nothing is reported before the block is committed
+	require.Equal(t, shadowfork.Summary{}, cfg.shadowFork.Summary())
+	require.NoError(t, cfg.shadowFork.Flush())
+	require.Equal(t, shadowfork.Summary{Txs: 2, Mismatches: 2, Invalid: 1, Overflow: 1}, cfg.shadowFork.Summary())
+
+	f, err := os.Open(reportFile)
+	require.NoError(t, err)
+	defer f.Close()
+	var records []shadowfork.TxRecord
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var record shadowfork.TxRecord
+		require.NoError(t, json.Unmarshal(scanner.Bytes(), &record))
+		records = append(records, record)
+	}
+	require.Len(t, records, 2)
+	require.Equal(t, shadowfork.StatusInvalid, records[0].Fork.Status)
+	require.Equal(t, invalid.Error(), records[0].Fork.Error)
+	require.Equal(t, uint64(3), records[0].ForkBatch)
+	require.Equal(t, shadowfork.StatusOverflow, records[1].Fork.Status)
+	require.Equal(t, uint64(10), records[1].SourceBlock)
+	require.Equal(t, uint64(4), records[1].ForkBatch)
+
+	// fork block 3 replays the transaction of source block 11
+	txs, err = job.YieldNextBlockTransactions(testTxDecoder)
+	require.NoError(t, err)
+	action, err = shadowForkTxAction(ctx, cfg, batchState, testShadowForkRecord(batchState, txs[0]), txs[0].Hash(), overflowNone, nil)
+	require.NoError(t, err)
+	require.Equal(t, shadowForkAddTx, action)
+	job.UpdateLastProcessedTx(txs[0].Hash())
+	require.NoError(t, saveShadowForkProgress(sdb, job, 3))
+
+	progress, err := stages.GetStageProgress(sdb.tx, stages.ShadowForkSourceBlock)
+	require.NoError(t, err)
+	require.Equal(t, uint64(11), progress)
+
+	// unwinding fork block 3 replays source block 11, the sequencer keeps fork blocks 1 and 2
+	for forkBlock := uint64(0); forkBlock <= 3; forkBlock++ {
+		require.NoError(t, sdb.hermezDb.WriteBlockBatch(forkBlock, forkBlock))
+	}
+	require.NoError(t, UnwindSequenceExecutionStageDbWrites(ctx, &stagedsync.UnwindState{UnwindPoint: 2}, &stagedsync.StageState{BlockNumber: 3}, sdb.tx))
+	progress, err = stages.GetStageProgress(sdb.tx, stages.ShadowForkSourceBlock)
+	require.NoError(t, err)
+	require.Equal(t, uint64(10), progress)
+
+	// unwinding fork block 1 replays the whole source batch
+	require.NoError(t, UnwindSequenceExecutionStageDbWrites(ctx, &stagedsync.UnwindState{UnwindPoint: 0}, &stagedsync.StageState{BlockNumber: 2}, sdb.tx))
+	progress, err = stages.GetStageProgress(sdb.tx, stages.ShadowForkSourceBlock)
+	require.NoError(t, err)
+	require.Zero(t, progress)
+	for forkBlock := uint64(1); forkBlock <= 3; forkBlock++ {
+		sourceBlock, err := sdb.hermezDb.GetShadowForkSourceBlock(forkBlock)
+		require.NoError(t, err)
+		require.Zero(t, sourceBlock)
+	}
+}
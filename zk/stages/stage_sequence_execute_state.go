@@ -107,6 +107,16 @@ func (bs *BatchState) isResequence() bool {
 	return bs.resequenceBatchJob != nil
 }
 
+func (bs *BatchState) isShadowFork() bool {
+	return bs.isResequence() && bs.resequenceBatchJob.shadow
+}
+
+// isStrictResequence is true when a resequenced batch must come out the same as the original one, a shadow fork
+// is expected to differ from its source chain
+func (bs *BatchState) isStrictResequence(cfg *SequenceBlockCfg) bool {
+	return bs.isResequence() && !bs.isShadowFork() && cfg.zk.SequencerResequenceStrict
+}
+
 func (bs *BatchState) isAnyRecovery() bool {
 	return bs.isL1Recovery() || bs.isLimboRecovery() || bs.isResequence()
 }
@@ -285,6 +295,12 @@ func (bs *BlockState) getL1EffectiveGases(cfg SequenceBlockCfg, i int) uint8 {
 		return bs.blockL1RecoveryData.EffectiveGasPricePercentages[i]
 	}
 
+	if cfg.feeOracle != nil {
+		if estimate := cfg.feeOracle.Latest(); estimate != nil {
+			return estimate.EffectiveGasPricePercentage(bs.transactionsForInclusion[i])
+		}
+	}
+
 	return DeriveEffectiveGasPrice(cfg, bs.transactionsForInclusion[i])
 }
 
@@ -320,6 +336,7 @@ type ResequenceBatchJob struct {
 	StartBlockIndex int
 	StartTxIndex    int
 	txIndexMap      map[common.Hash]resequenceTxMetadata
+	shadow          bool
 }
 
 func NewResequenceBatchJob(batch []*dsTypes.FullL2Block) *ResequenceBatchJob {
@@ -331,6 +348,13 @@ func NewResequenceBatchJob(batch []*dsTypes.FullL2Block) *ResequenceBatchJob {
 	}
 }
 
+// NewShadowForkBatchJob returns a job replaying a batch of the source chain of a shadow fork
+func NewShadowForkBatchJob(batch []*dsTypes.FullL2Block) *ResequenceBatchJob {
+	job := NewResequenceBatchJob(batch)
+	job.shadow = true
+	return job
+}
+
 func (r *ResequenceBatchJob) HasMoreBlockToProcess() bool {
 	return r.StartBlockIndex < len(r.batchToProcess)
 }
@@ -366,6 +390,16 @@ func (r *ResequenceBatchJob) YieldNextBlockTransactions(decoder zktx.TxDecoder)
 	return blockTransactions, nil
 }
 
+// sourceTransaction returns the original block of a yielded transaction and the transaction as it was in the stream
+func (r *ResequenceBatchJob) sourceTransaction(h common.Hash) (*dsTypes.FullL2Block, *dsTypes.L2TransactionProto) {
+	idx, ok := r.txIndexMap[h]
+	if !ok {
+		return r.CurrentBlock(), nil
+	}
+	block := r.batchToProcess[idx.blockNum]
+	return block, &block.L2Txs[idx.txIndex]
+}
+
 func (r *ResequenceBatchJob) UpdateLastProcessedTx(h common.Hash) {
 	if idx, ok := r.txIndexMap[h]; ok {
 		block := r.batchToProcess[idx.blockNum]
@@ -138,6 +138,14 @@ func UnwindSequenceExecutionStageDbWrites(ctx context.Context, u *stagedsync.Unw
 	if err = hermezDb.DeleteBatchCounters(u.UnwindPoint+1, s.BlockNumber); err != nil {
 		return fmt.Errorf("truncate block batches error: %v", err)
 	}
+	// only seq, the report of the first unwound batch explains why it is resequenced so it is kept
+	if err = hermezDb.DeleteExecutorDivergences(fromBatch+1, toBatch); err != nil {
+		return fmt.Errorf("truncate executor divergences error: %v", err)
+	}
+	// only seq, a shadow fork replays the source blocks of the unwound blocks
+	if err = unwindShadowForkProgress(u, s, tx, hermezDb); err != nil {
+		return fmt.Errorf("unwind shadow fork progress error: %v", err)
+	}
 
 	return nil
 }
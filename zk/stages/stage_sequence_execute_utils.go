@@ -32,8 +32,11 @@ import (
 	"github.com/ledgerwatch/erigon/turbo/shards"
 	"github.com/ledgerwatch/erigon/turbo/stages/headerdownload"
 	"github.com/ledgerwatch/erigon/zk/datastream/server"
+	zkevents "github.com/ledgerwatch/erigon/zk/events"
+	"github.com/ledgerwatch/erigon/zk/fee_oracle"
 	"github.com/ledgerwatch/erigon/zk/hermez_db"
 	verifier "github.com/ledgerwatch/erigon/zk/legacy_executor_verifier"
+	"github.com/ledgerwatch/erigon/zk/shadowfork"
 	zktx "github.com/ledgerwatch/erigon/zk/tx"
 	"github.com/ledgerwatch/erigon/zk/txpool"
 	zktypes "github.com/ledgerwatch/erigon/zk/types"
@@ -84,6 +87,10 @@ type SequenceBlockCfg struct {
 
 	legacyVerifier *verifier.LegacyExecutorVerifier
 	yieldSize      uint16
+
+	feeOracle  *fee_oracle.Oracle
+	zkEvents   *zkevents.Feed
+	shadowFork *shadowfork.ShadowFork
 }
 
 func StageSequenceBlocksCfg(
@@ -105,6 +112,7 @@ func StageSequenceBlocksCfg(
 	syncCfg ethconfig.Sync,
 	agg *libstate.Aggregator,
 	stream *datastreamer.StreamServer,
+	datastreamServer *server.DataStreamServer,
 	zk *ethconfig.Zk,
 	miningConfig *params.MiningConfig,
 
@@ -112,6 +120,9 @@ func StageSequenceBlocksCfg(
 	txPoolDb kv.RwDB,
 	legacyVerifier *verifier.LegacyExecutorVerifier,
 	yieldSize uint16,
+	feeOracle *fee_oracle.Oracle,
+	zkEvents *zkevents.Feed,
+	shadowFork *shadowfork.ShadowFork,
 ) SequenceBlockCfg {
 
 	return SequenceBlockCfg{
@@ -132,13 +143,16 @@ func StageSequenceBlocksCfg(
 		syncCfg:          syncCfg,
 		agg:              agg,
 		stream:           stream,
-		datastreamServer: server.NewDataStreamServer(stream, chainConfig.ChainID.Uint64()),
+		datastreamServer: datastreamServer,
 		zk:               zk,
 		miningConfig:     miningConfig,
 		txPool:           txPool,
 		txPoolDb:         txPoolDb,
 		legacyVerifier:   legacyVerifier,
 		yieldSize:        yieldSize,
+		feeOracle:        feeOracle,
+		zkEvents:         zkEvents,
+		shadowFork:       shadowFork,
 	}
 }
 
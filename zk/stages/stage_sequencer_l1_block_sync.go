@@ -6,8 +6,7 @@ import (
 	"fmt"
 	"time"
 
-	"encoding/binary"
-
+	"github.com/ledgerwatch/erigon-lib/common"
 	"github.com/ledgerwatch/erigon-lib/kv"
 	"github.com/ledgerwatch/erigon/core/types"
 	"github.com/ledgerwatch/erigon/eth/ethconfig"
@@ -112,6 +111,22 @@ func SpawnSequencerL1BlockSyncStage(
 		l1BlockHeight = cfg.zkCfg.L1SyncStartBlock
 	}
 
+	// the L1 is followed as usual past the end of the archive
+	if cfg.zkCfg.UseL1SyncArchive() {
+		imported, err := syncFromSequenceArchive(logPrefix, tx, hermezDb, cfg, l1BlockHeight)
+		if err != nil {
+			return err
+		}
+		if imported {
+			if freshTx {
+				if funcErr = tx.Commit(); funcErr != nil {
+					return funcErr
+				}
+			}
+			return nil
+		}
+	}
+
 	if !cfg.syncer.IsSyncStarted() {
 		cfg.syncer.RunQueryBlocks(l1BlockHeight)
 		defer func() {
@@ -172,9 +187,6 @@ LOOP:
 					return funcErr
 				}
 
-				limitTimestampBytes := make([]byte, 8)
-				binary.BigEndian.PutUint64(limitTimestampBytes, limitTimestamp)
-
 				// here we find the first batch number that was sequenced by working backwards
 				// from the latest batch in the original event
 				initBatch := lastBatchSequenced - uint64(len(batches)-1)
@@ -189,11 +201,7 @@ LOOP:
 				// this is important because the batches are written in reverse order
 				for idx, batch := range batches {
 					b := initBatch + uint64(idx)
-					data := make([]byte, 20+32+8+len(batch))
-					copy(data, coinbase.Bytes())
-					copy(data[20:], l1InfoRoot)
-					copy(data[52:], limitTimestampBytes)
-					copy(data[60:], batch)
+					data := l1_data.EncodeL1BatchData(coinbase, common.BytesToHash(l1InfoRoot), limitTimestamp, batch)
 
 					if funcErr = hermezDb.WriteL1BatchData(b, data); funcErr != nil {
 						return funcErr
@@ -239,6 +247,56 @@ LOOP:
 	return nil
 }
 
+// syncFromSequenceArchive fills the L1 batch data from a pre-downloaded sequence archive rather than the L1 itself,
+// allowing a full recovery without access to an L1 node.  Progress is tracked the same way as the live sync using the
+// L1 block of the last imported sequence.  It returns false once the whole archive has been imported.
+func syncFromSequenceArchive(logPrefix string, tx kv.RwTx, hermezDb *hermez_db.HermezDb, cfg SequencerL1BlockSyncCfg, l1BlockHeight uint64) (bool, error) {
+	manifest, err := l1_data.ReadSequenceArchiveManifest(cfg.zkCfg.L1SyncArchive)
+	if err != nil {
+		return false, err
+	}
+
+	progress, err := stages.GetStageProgress(tx, stages.L1BlockSync)
+	if err != nil {
+		return false, err
+	}
+	if progress > 0 && progress >= manifest.ToL1Block {
+		// everything in the archive has already been imported
+		return false, nil
+	}
+
+	log.Info(fmt.Sprintf("[%s] Importing L1 sequences from archive", logPrefix),
+		"path", cfg.zkCfg.L1SyncArchive,
+		"from-l1-block", l1BlockHeight,
+		"archive-batches", fmt.Sprintf("%d-%d", manifest.FirstBatch, manifest.LastBatch),
+	)
+
+	archive, err := l1_data.OpenSequenceArchive(cfg.zkCfg.L1SyncArchive, cfg.zkCfg.L1ChainId, cfg.zkCfg.AddressRollup, cfg.zkCfg.L1RollupId)
+	if err != nil {
+		return false, err
+	}
+
+	result, err := l1_data.ImportSequenceArchive(hermezDb, archive, l1BlockHeight, cfg.zkCfg.L1SyncStopBatch, cfg.zkCfg.DAUrl)
+	if err != nil {
+		return false, err
+	}
+
+	log.Info(fmt.Sprintf("[%s] Imported L1 sequences from archive", logPrefix),
+		"sequences", result.Sequences,
+		"batches", result.Batches,
+		"highest-batch", result.HighestBatch,
+		"reached-stop-batch", result.ReachedStop,
+	)
+
+	// mark the whole archive as processed so it is not read again on the next stage loop, unless the import stopped
+	// early in which case a higher stop batch continues from the last imported sequence
+	reached := manifest.ToL1Block
+	if result.ReachedStop {
+		reached = result.HighestL1
+	}
+	return true, stages.SaveStageProgress(tx, stages.L1BlockSync, reached)
+}
+
 func haveAllBatchesInDb(highestBatch uint64, cfg SequencerL1BlockSyncCfg, hermezDb *hermez_db.HermezDb) (bool, error) {
 	hasEverything := true
 	for i := highestBatch; i <= cfg.zkCfg.L1SyncStopBatch; i++ {
@@ -17,6 +17,7 @@ import (
 
 	ethTypes "github.com/ledgerwatch/erigon/core/types"
 	"github.com/ledgerwatch/erigon/rpc"
+	"github.com/ledgerwatch/erigon/zk/contracts"
 )
 
 var (
@@ -33,6 +34,9 @@ const (
 	admin                           = "0xf851a440"
 	trustedSequencer                = "0xcfa8ed47"
 	sequencedBatchesMapSignature    = "0xb4d63f58"
+	rollupTypeCount                 = "0x1796a1ae"
+	rollupTypeMap                   = "0x65c0504d"
+	rollupIDToRollupData            = "0xf9c4c2ae"
 )
 
 type IEtherman interface {
@@ -541,6 +545,122 @@ func (s *L1Syncer) CallTrustedSequencer(ctx context.Context, addr *common.Addres
 	return s.callGetAddress(ctx, addr, trustedSequencer)
 }
 
+// RollupData is the part of the rollup manager's data of a rollup the fork schedule depends on
+type RollupData struct {
+	RollupContract    common.Address `json:"rollupContract"`
+	ChainId           uint64         `json:"chainId"`
+	ForkId            uint64         `json:"forkId"`
+	LastVerifiedBatch uint64         `json:"lastVerifiedBatch"`
+	RollupTypeId      uint64         `json:"rollupTypeId"`
+}
+
+// RollupType is a rollup type of the rollup manager, the genesis is the state root new rollups of the type start from
+type RollupType struct {
+	ForkId   uint64      `json:"forkId"`
+	Obsolete bool        `json:"obsolete"`
+	Genesis  common.Hash `json:"genesis"`
+}
+
+// RollupCreation is the CreateNewRollup event of a rollup
+type RollupCreation struct {
+	RollupTypeId    uint64         `json:"rollupTypeId"`
+	RollupContract  common.Address `json:"rollupContract"`
+	ChainId         uint64         `json:"chainId"`
+	GasTokenAddress common.Address `json:"gasTokenAddress"`
+	L1Block         uint64         `json:"l1Block"`
+	L1TxHash        common.Hash    `json:"l1TxHash"`
+	Timestamp       uint64         `json:"timestamp"`
+}
+
+func (s *L1Syncer) CallRollupTypeCount(ctx context.Context, addr *common.Address) (uint64, error) {
+	resp, err := s.callRollupManager(ctx, addr, rollupTypeCount, 1)
+	if err != nil {
+		return 0, err
+	}
+	return binary.BigEndian.Uint64(resp[24:32]), nil
+}
+
+// CallRollupType returns the fork id, whether it is obsolete and the genesis root of a rollup type
+func (s *L1Syncer) CallRollupType(ctx context.Context, addr *common.Address, rollupType uint64) (*RollupType, error) {
+	// consensusImplementation, verifier, forkID, rollupCompatibilityID, obsolete, genesis
+	resp, err := s.callRollupManager(ctx, addr, rollupTypeMap+fmt.Sprintf("%064x", rollupType), 6)
+	if err != nil {
+		return nil, err
+	}
+	return &RollupType{
+		ForkId:   binary.BigEndian.Uint64(resp[88:96]),
+		Obsolete: resp[159] != 0,
+		Genesis:  common.BytesToHash(resp[160:192]),
+	}, nil
+}
+
+// GetRollupCreation finds the creation of a rollup in the L1 block it was created in
+func (s *L1Syncer) GetRollupCreation(ctx context.Context, addr *common.Address, rollupId, l1Block uint64) (*RollupCreation, error) {
+	em := s.getNextEtherman()
+	logs, err := em.FilterLogs(ctx, ethereum.FilterQuery{
+		FromBlock: new(big.Int).SetUint64(l1Block),
+		ToBlock:   new(big.Int).SetUint64(l1Block),
+		Addresses: []common.Address{*addr},
+		Topics:    [][]common.Hash{{contracts.CreateNewRollupTopic}, {common.BigToHash(new(big.Int).SetUint64(rollupId))}},
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(logs) == 0 {
+		return nil, fmt.Errorf("rollup %d was not created in L1 block %d", rollupId, l1Block)
+	}
+	// rollupTypeID, rollupAddress, chainID, gasTokenAddress
+	data := logs[0].Data
+	if len(data) < 128 {
+		return nil, fmt.Errorf("CreateNewRollup log of %d bytes is too short", len(data))
+	}
+	header, err := em.HeaderByNumber(ctx, new(big.Int).SetUint64(l1Block))
+	if err != nil {
+		return nil, err
+	}
+	return &RollupCreation{
+		RollupTypeId:    binary.BigEndian.Uint64(data[24:32]),
+		RollupContract:  common.BytesToAddress(data[44:64]),
+		ChainId:         binary.BigEndian.Uint64(data[88:96]),
+		GasTokenAddress: common.BytesToAddress(data[108:128]),
+		L1Block:         l1Block,
+		L1TxHash:        logs[0].TxHash,
+		Timestamp:       header.Time,
+	}, nil
+}
+
+func (s *L1Syncer) CallRollupData(ctx context.Context, addr *common.Address, rollupId uint64) (*RollupData, error) {
+	// rollupContract, chainID, verifier, forkID, lastLocalExitRoot, lastBatchSequenced, lastVerifiedBatch,
+	// lastPendingState, lastPendingStateConsolidated, lastVerifiedBatchBeforeUpgrade, rollupTypeID, rollupCompatibilityID
+	resp, err := s.callRollupManager(ctx, addr, rollupIDToRollupData+fmt.Sprintf("%064x", rollupId), 12)
+	if err != nil {
+		return nil, err
+	}
+	return &RollupData{
+		RollupContract:    common.BytesToAddress(resp[12:32]),
+		ChainId:           binary.BigEndian.Uint64(resp[56:64]),
+		ForkId:            binary.BigEndian.Uint64(resp[120:128]),
+		LastVerifiedBatch: binary.BigEndian.Uint64(resp[216:224]),
+		RollupTypeId:      binary.BigEndian.Uint64(resp[344:352]),
+	}, nil
+}
+
+// callRollupManager calls a view of the rollup manager returning at least the given number of words
+func (s *L1Syncer) callRollupManager(ctx context.Context, addr *common.Address, data string, words int) ([]byte, error) {
+	em := s.getNextEtherman()
+	resp, err := em.CallContract(ctx, ethereum.CallMsg{
+		To:   addr,
+		Data: common.FromHex(data),
+	}, nil)
+	if err != nil {
+		return nil, err
+	}
+	if len(resp) < words*32 {
+		return nil, fmt.Errorf("response of %d bytes is too short for %d words", len(resp), words)
+	}
+	return resp, nil
+}
+
 func (s *L1Syncer) callGetAddress(ctx context.Context, addr *common.Address, data string) (common.Address, error) {
 	em := s.getNextEtherman()
 	resp, err := em.CallContract(ctx, ethereum.CallMsg{
@@ -0,0 +1,363 @@
+package tx_forwarder
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/ledgerwatch/erigon-lib/common"
+	"github.com/ledgerwatch/erigon-lib/common/hexutility"
+	"github.com/ledgerwatch/erigon/core/types"
+	"github.com/ledgerwatch/erigon/eth/ethconfig"
+	"github.com/ledgerwatch/erigon/zkevm/jsonrpc/client"
+	"github.com/ledgerwatch/log/v3"
+)
+
+const (
+	defaultQueueSize  = 1000
+	defaultBatchSize  = 50
+	defaultRetries    = 5
+	defaultBackoff    = time.Second
+	defaultPendingTTL = 10 * time.Minute
+
+	// the longest wait between two retries of a transaction, however many attempts it has had
+	maxBackoff = time.Minute
+	// the most forwarded transactions tracked as pending, above it transactions are still forwarded but not tracked
+	maxTracked = 100_000
+)
+
+var (
+	ErrQueueFull = errors.New("transaction forwarding queue is full")
+	// ErrQueued is returned when no upstream could be reached, the transaction is retried in the background but may
+	// never arrive
+	ErrQueued = errors.New("no upstream reachable, transaction queued for retry")
+)
+
+type Config struct {
+	// Upstreams are the rpcs transactions are forwarded to, the first answering one is used until it fails
+	Upstreams []string
+	// QueueSize is the most transactions waiting for a retry because no upstream could be reached
+	QueueSize int
+	// BatchSize is the most queued transactions sent to an upstream in one request
+	BatchSize int
+	// Retries is how many times a queued transaction is sent again before it is dropped
+	Retries int
+	// Backoff is the wait before the first retry, doubled with every further attempt
+	Backoff time.Duration
+	// PendingTTL is how long a forwarded transaction is returned as pending if it isn't seen in a block
+	PendingTTL time.Duration
+}
+
+// SendFunc sends raw transactions to an upstream.  The error is set when the upstream could not be reached and the
+// upstream's answer for each transaction otherwise, nil for the accepted ones.
+type SendFunc func(url string, encodedTxs [][]byte) ([]error, error)
+
+// job is a transaction waiting to be sent again
+type job struct {
+	hash     common.Hash
+	encoded  []byte
+	attempts int
+	next     time.Time
+}
+
+type pending struct {
+	txn   types.Transaction
+	since time.Time
+}
+
+// Forwarder sends the transactions of a node without a pool of its own to its upstreams.  A transaction is sent
+// straight away and the upstream's answer returned, if none of the upstreams can be reached the caller gets an error
+// and the transaction is queued and retried in batches with an exponential backoff.  Forwarded transactions are remembered until they are
+// seen in a block so the node can return them as pending in the meantime.
+type Forwarder struct {
+	cfg  Config
+	send SendFunc
+
+	// index of the upstream that answered last, tried first
+	preferred atomic.Int64
+
+	mu      sync.Mutex
+	queue   []*job
+	pending map[common.Hash]*pending
+
+	quit chan struct{}
+	done chan struct{}
+}
+
+func New(cfg Config, send SendFunc) *Forwarder {
+	if cfg.QueueSize <= 0 {
+		cfg.QueueSize = defaultQueueSize
+	}
+	if cfg.BatchSize <= 0 {
+		cfg.BatchSize = defaultBatchSize
+	}
+	if cfg.Retries <= 0 {
+		cfg.Retries = defaultRetries
+	}
+	if cfg.Backoff <= 0 {
+		cfg.Backoff = defaultBackoff
+	}
+	if cfg.PendingTTL <= 0 {
+		cfg.PendingTTL = defaultPendingTTL
+	}
+
+	f := &Forwarder{
+		cfg:     cfg,
+		send:    send,
+		pending: make(map[common.Hash]*pending),
+		quit:    make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+	go f.loop()
+	return f
+}
+
+// NewFromZk returns a forwarder to the pool manager(s) if set or the sequencer otherwise, nil if there is neither
+func NewFromZk(zk *ethconfig.Zk) *Forwarder {
+	if zk == nil {
+		return nil
+	}
+	var upstreams []string
+	for _, url := range strings.Split(zk.PoolManagerUrl, ",") {
+		if url = strings.TrimSpace(url); url != "" {
+			upstreams = append(upstreams, url)
+		}
+	}
+	if len(upstreams) == 0 && zk.L2RpcUrl != "" {
+		upstreams = []string{zk.L2RpcUrl}
+	}
+	if len(upstreams) == 0 {
+		return nil
+	}
+	return New(Config{
+		Upstreams:  upstreams,
+		QueueSize:  zk.TxForwardQueueSize,
+		BatchSize:  zk.TxForwardBatchSize,
+		Retries:    zk.TxForwardRetries,
+		Backoff:    zk.TxForwardBackoff,
+		PendingTTL: zk.TxForwardPendingTTL,
+	}, JSONRPCSend)
+}
+
+// JSONRPCSend sends the transactions with eth_sendRawTransaction, in a single batch request if there is more than one
+func JSONRPCSend(url string, encodedTxs [][]byte) ([]error, error) {
+	if len(encodedTxs) == 1 {
+		res, err := client.JSONRPCCall(url, "eth_sendRawTransaction", hexutility.Bytes(encodedTxs[0]))
+		if err != nil {
+			return nil, err
+		}
+		if res.Error != nil {
+			return []error{fmt.Errorf("RPC error response: %s", res.Error.Message)}, nil
+		}
+		return []error{nil}, nil
+	}
+
+	methods := make([]string, len(encodedTxs))
+	params := make([][]interface{}, len(encodedTxs))
+	for i, encoded := range encodedTxs {
+		methods[i] = "eth_sendRawTransaction"
+		params[i] = []interface{}{hexutility.Bytes(encoded)}
+	}
+	responses, err := client.JSONRPCBatchCall(url, methods, params...)
+	if err != nil {
+		return nil, err
+	}
+
+	// the responses of a batch can come in any order, the ids are the 1-based positions of the requests
+	errs := make([]error, len(encodedTxs))
+	answered := make([]bool, len(encodedTxs))
+	for _, res := range responses {
+		id, ok := res.ID.(float64)
+		if !ok || id < 1 || int(id) > len(encodedTxs) {
+			continue
+		}
+		answered[int(id)-1] = true
+		if res.Error != nil {
+			errs[int(id)-1] = fmt.Errorf("RPC error response: %s", res.Error.Message)
+		}
+	}
+	for i := range answered {
+		if !answered[i] {
+			errs[i] = errors.New("no response from upstream")
+		}
+	}
+	return errs, nil
+}
+
+// Forward sends the transaction upstream and returns the upstream's error if it was rejected.  If no upstream can be
+// reached it returns ErrQueued with the hash of the transaction queued for a retry, or ErrQueueFull.
+func (f *Forwarder) Forward(txn types.Transaction, encoded []byte) (common.Hash, error) {
+	hash := txn.Hash()
+
+	errs, err := f.sendUpstream([][]byte{encoded})
+	if err == nil {
+		if errs[0] != nil {
+			return common.Hash{}, errs[0]
+		}
+		f.mu.Lock()
+		f.track(hash, txn)
+		f.mu.Unlock()
+		return hash, nil
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if len(f.queue) >= f.cfg.QueueSize {
+		return common.Hash{}, fmt.Errorf("%w: %v", ErrQueueFull, err)
+	}
+	log.Warn("[tx-forwarder] No upstream reachable, queued transaction for retry", "hash", hash, "err", err)
+	f.queue = append(f.queue, &job{hash: hash, encoded: encoded, attempts: 1, next: time.Now().Add(f.backoff(1))})
+	f.track(hash, txn)
+	return hash, fmt.Errorf("%w: %v", ErrQueued, err)
+}
+
+// Pending returns the transaction if it was forwarded and not yet seen in a block, nil otherwise
+func (f *Forwarder) Pending(hash common.Hash) types.Transaction {
+	if f == nil {
+		return nil
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if p, ok := f.pending[hash]; ok {
+		return p.txn
+	}
+	return nil
+}
+
+// Forget stops tracking the transaction, i.e. once it is seen in a block
+func (f *Forwarder) Forget(hash common.Hash) {
+	if f == nil {
+		return
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	delete(f.pending, hash)
+}
+
+// Queued returns the number of transactions waiting for a retry
+func (f *Forwarder) Queued() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return len(f.queue)
+}
+
+func (f *Forwarder) Stop() {
+	close(f.quit)
+	<-f.done
+}
+
+// must be called with the lock held
+func (f *Forwarder) track(hash common.Hash, txn types.Transaction) {
+	if len(f.pending) >= maxTracked {
+		return
+	}
+	f.pending[hash] = &pending{txn: txn, since: time.Now()}
+}
+
+func (f *Forwarder) backoff(attempts int) time.Duration {
+	backoff := f.cfg.Backoff
+	for i := 1; i < attempts && backoff < maxBackoff; i++ {
+		backoff *= 2
+	}
+	return min(backoff, maxBackoff)
+}
+
+// sendUpstream tries the upstreams in turn starting with the preferred one until one of them can be reached
+func (f *Forwarder) sendUpstream(encoded [][]byte) ([]error, error) {
+	var lastErr error
+	preferred := int(f.preferred.Load())
+	for i := range f.cfg.Upstreams {
+		idx := (preferred + i) % len(f.cfg.Upstreams)
+		errs, err := f.send(f.cfg.Upstreams[idx], encoded)
+		if err == nil {
+			f.preferred.Store(int64(idx))
+			return errs, nil
+		}
+		log.Debug("[tx-forwarder] Upstream unreachable", "upstream", f.cfg.Upstreams[idx], "err", err)
+		lastErr = err
+	}
+	return nil, lastErr
+}
+
+func (f *Forwarder) loop() {
+	defer close(f.done)
+	ticker := time.NewTicker(min(f.cfg.Backoff, time.Second))
+	defer ticker.Stop()
+	for {
+		select {
+		case <-f.quit:
+			return
+		case <-ticker.C:
+		}
+		f.retry()
+		f.evictExpired()
+	}
+}
+
+// retry sends the queued transactions that are due in one batch
+func (f *Forwarder) retry() {
+	now := time.Now()
+
+	f.mu.Lock()
+	var due []*job
+	for _, j := range f.queue {
+		if !j.next.After(now) {
+			due = append(due, j)
+			if len(due) == f.cfg.BatchSize {
+				break
+			}
+		}
+	}
+	f.mu.Unlock()
+	if len(due) == 0 {
+		return
+	}
+
+	encoded := make([][]byte, len(due))
+	for i, j := range due {
+		encoded[i] = j.encoded
+	}
+	errs, err := f.sendUpstream(encoded)
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	finished := make(map[*job]struct{}, len(due))
+	for i, j := range due {
+		switch {
+		case err != nil && j.attempts < f.cfg.Retries:
+			j.attempts++
+			j.next = now.Add(f.backoff(j.attempts))
+			continue
+		case err != nil:
+			log.Warn("[tx-forwarder] Dropping transaction, no upstream reachable", "hash", j.hash, "attempts", j.attempts, "err", err)
+			delete(f.pending, j.hash)
+		case errs[i] != nil:
+			// the upstream has the final say, it may well have had the transaction from another node already
+			log.Warn("[tx-forwarder] Queued transaction rejected upstream", "hash", j.hash, "err", errs[i])
+			delete(f.pending, j.hash)
+		}
+		finished[j] = struct{}{}
+	}
+
+	queue := f.queue[:0]
+	for _, j := range f.queue {
+		if _, ok := finished[j]; !ok {
+			queue = append(queue, j)
+		}
+	}
+	f.queue = queue
+}
+
+func (f *Forwarder) evictExpired() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	expiry := time.Now().Add(-f.cfg.PendingTTL)
+	for hash, p := range f.pending {
+		if p.since.Before(expiry) {
+			delete(f.pending, hash)
+		}
+	}
+}
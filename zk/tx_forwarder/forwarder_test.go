@@ -0,0 +1,152 @@
+package tx_forwarder
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/holiman/uint256"
+	"github.com/ledgerwatch/erigon-lib/common"
+	"github.com/ledgerwatch/erigon/core/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var errUnreachable = errors.New("connection refused")
+
+// fakeUpstreams answers for every url with the errors set for it, recording what was sent where
+type fakeUpstreams struct {
+	mu       sync.Mutex
+	down     map[string]bool
+	rejected map[string]bool
+	sent     map[string][][]byte
+}
+
+func newFakeUpstreams() *fakeUpstreams {
+	return &fakeUpstreams{down: map[string]bool{}, rejected: map[string]bool{}, sent: map[string][][]byte{}}
+}
+
+func (u *fakeUpstreams) send(url string, encodedTxs [][]byte) ([]error, error) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	if u.down[url] {
+		return nil, errUnreachable
+	}
+	errs := make([]error, len(encodedTxs))
+	for i, encoded := range encodedTxs {
+		if u.rejected[string(encoded)] {
+			errs[i] = errors.New("RPC error response: nonce too low")
+			continue
+		}
+		u.sent[url] = append(u.sent[url], encoded)
+	}
+	return errs, nil
+}
+
+func (u *fakeUpstreams) setDown(url string, down bool) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	u.down[url] = down
+}
+
+func (u *fakeUpstreams) sentTo(url string) int {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	return len(u.sent[url])
+}
+
+func testTx(nonce uint64) (types.Transaction, []byte) {
+	txn := types.NewTransaction(nonce, common.Address{1}, uint256.NewInt(1), 21000, uint256.NewInt(1), nil)
+	return txn, []byte{byte(nonce)}
+}
+
+func TestForwarderFailover(t *testing.T) {
+	upstreams := newFakeUpstreams()
+	f := New(Config{Upstreams: []string{"a", "b"}}, upstreams.send)
+	defer f.Stop()
+
+	txn, encoded := testTx(1)
+	hash, err := f.Forward(txn, encoded)
+	require.NoError(t, err)
+	assert.Equal(t, txn.Hash(), hash)
+	assert.Equal(t, 1, upstreams.sentTo("a"))
+	assert.NotNil(t, f.Pending(hash))
+
+	// a fails so b is used, and stays preferred once a is back
+	upstreams.setDown("a", true)
+	txn, encoded = testTx(2)
+	_, err = f.Forward(txn, encoded)
+	require.NoError(t, err)
+	assert.Equal(t, 1, upstreams.sentTo("b"))
+
+	upstreams.setDown("a", false)
+	txn, encoded = testTx(3)
+	_, err = f.Forward(txn, encoded)
+	require.NoError(t, err)
+	assert.Equal(t, 2, upstreams.sentTo("b"))
+
+	f.Forget(hash)
+	assert.Nil(t, f.Pending(hash))
+}
+
+func TestForwarderRejected(t *testing.T) {
+	upstreams := newFakeUpstreams()
+	f := New(Config{Upstreams: []string{"a"}}, upstreams.send)
+	defer f.Stop()
+
+	txn, encoded := testTx(1)
+	upstreams.rejected[string(encoded)] = true
+	_, err := f.Forward(txn, encoded)
+	require.ErrorContains(t, err, "nonce too low")
+	assert.Nil(t, f.Pending(txn.Hash()))
+	assert.Zero(t, f.Queued())
+}
+
+func TestForwarderRetry(t *testing.T) {
+	upstreams := newFakeUpstreams()
+	upstreams.setDown("a", true)
+	f := New(Config{Upstreams: []string{"a"}, Backoff: 10 * time.Millisecond, Retries: 100}, upstreams.send)
+	defer f.Stop()
+
+	txn, encoded := testTx(1)
+	hash, err := f.Forward(txn, encoded)
+	require.ErrorIs(t, err, ErrQueued)
+	assert.Equal(t, txn.Hash(), hash)
+	assert.Equal(t, 1, f.Queued())
+	assert.NotNil(t, f.Pending(hash))
+
+	upstreams.setDown("a", false)
+	require.Eventually(t, func() bool { return upstreams.sentTo("a") == 1 }, 5*time.Second, 10*time.Millisecond)
+	assert.Zero(t, f.Queued())
+	assert.NotNil(t, f.Pending(hash))
+}
+
+func TestForwarderDropsAfterRetries(t *testing.T) {
+	upstreams := newFakeUpstreams()
+	upstreams.setDown("a", true)
+	f := New(Config{Upstreams: []string{"a"}, Backoff: time.Millisecond, Retries: 2}, upstreams.send)
+	defer f.Stop()
+
+	txn, encoded := testTx(1)
+	hash, err := f.Forward(txn, encoded)
+	require.ErrorIs(t, err, ErrQueued)
+	require.Eventually(t, func() bool { return f.Queued() == 0 }, 5*time.Second, time.Millisecond)
+	assert.Nil(t, f.Pending(hash))
+}
+
+func TestForwarderQueueFull(t *testing.T) {
+	upstreams := newFakeUpstreams()
+	upstreams.setDown("a", true)
+	f := New(Config{Upstreams: []string{"a"}, QueueSize: 1, Backoff: time.Hour}, upstreams.send)
+	defer f.Stop()
+
+	txn, encoded := testTx(1)
+	_, err := f.Forward(txn, encoded)
+	require.ErrorIs(t, err, ErrQueued)
+
+	txn, encoded = testTx(2)
+	_, err = f.Forward(txn, encoded)
+	require.ErrorIs(t, err, ErrQueueFull)
+	assert.Nil(t, f.Pending(txn.Hash()))
+}
@@ -26,6 +26,8 @@ const (
 	Allowlist          = "Allowlist"
 	BlockList          = "BlockList"
 	PolicyTransactions = "PolicyTransactions"
+	Sponsors           = "Sponsors"
+	SponsorUsage       = "SponsorUsage"
 )
 
 func (t ACLTable) String() string {
@@ -42,6 +44,10 @@ func ResolveACLTable(table string) (ACLTable, error) {
 		return BlockList, nil
 	case "policytransactions":
 		return PolicyTransactions, nil
+	case "sponsors":
+		return Sponsors, nil
+	case "sponsorusage":
+		return SponsorUsage, nil
 	default:
 		return "", errUnknownACLTable
 	}
@@ -92,6 +98,8 @@ var (
 		Allowlist,
 		BlockList,
 		PolicyTransactions,
+		Sponsors,
+		SponsorUsage,
 	}
 
 	ACLTablesCfg = kv.TableCfg{}
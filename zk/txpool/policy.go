@@ -664,3 +664,13 @@ func (p *TxPool) isActionAllowed(ctx context.Context, addr common.Address, polic
 		return hasPolicy, nil
 	}
 }
+
+// IsTransactionAllowed checks the acl for a transaction of sender before it reaches the pool, i.e. on a node that
+// forwards transactions rather than adding them to its own pool
+func (p *TxPool) IsTransactionAllowed(ctx context.Context, sender common.Address, creation bool) (bool, error) {
+	policy := SendTx
+	if creation {
+		policy = Deploy
+	}
+	return p.isActionAllowed(ctx, sender, policy)
+}
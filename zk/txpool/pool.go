@@ -147,6 +147,8 @@ const (
 	DiscardByLimbo                  DiscardReason = 27
 	SmartContractDeploymentDisabled DiscardReason = 28 // to == null not allowed, config set to block smart contract deployment
 	GasLimitTooHigh                 DiscardReason = 29 // gas limit is too high
+	NotSponsored                    DiscardReason = 30 // free transaction without a sponsorship paying for it
+	SponsoredNonceGap               DiscardReason = 31 // free transaction behind a nonce gap, it would hold its sponsor's budget
 )
 
 func (r DiscardReason) String() string {
@@ -211,6 +213,10 @@ func (r DiscardReason) String() string {
 		return "smart contract deployment disabled"
 	case GasLimitTooHigh:
 		return fmt.Sprintf("gas limit too high. Max: %d", transactionGasLimit)
+	case NotSponsored:
+		return "free transaction not sponsored or sponsor quota used up"
+	case SponsoredNonceGap:
+		return "free transaction nonce too high, sponsored transactions must be next in line"
 	default:
 		panic(fmt.Sprintf("discard reason: %d", r))
 	}
@@ -331,6 +337,12 @@ type TxPool struct {
 
 	// limbo specific fields where bad batch transactions identified by the executor go
 	limbo *Limbo
+
+	// gas limits of the sponsored free transactions held against their sponsors' budgets
+	sponsorHolds   map[string]sponsorHold // tx_hash => hold while the transaction is in the pool
+	sponsorHeld    map[string]uint64      // sponsor key => gas held for it
+	sponsorMined   map[string]sponsorHold // tx_hash => hold of a mined transaction until its sponsor is charged
+	sponsorCharges map[string]sponsorHold // tx_hash => charge of a mined transaction, refunded if it is unwound
 }
 
 func CreateTxPoolBuckets(tx kv.RwTx) error {
@@ -385,6 +397,10 @@ func New(newTxs chan types.Announcements, coreDB kv.RoDB, cfg txpoolcfg.Config,
 		flushMtx:                &sync.Mutex{},
 		aclDB:                   aclDB,
 		limbo:                   newLimbo(),
+		sponsorHolds:            map[string]sponsorHold{},
+		sponsorHeld:             map[string]uint64{},
+		sponsorMined:            map[string]sponsorHold{},
+		sponsorCharges:          map[string]sponsorHold{},
 	}, nil
 }
 
@@ -437,6 +453,7 @@ func (p *TxPool) OnNewBlock(ctx context.Context, stateChanges *remote.StateChang
 	}
 
 	p.addLimboToUnwindTxs(&unwindTxs)
+	p.unchargeSponsors(unwindTxs)
 
 	p.blockGasLimit.Store(stateChanges.BlockGasLimit)
 	if err := p.senders.onNewBlock(stateChanges, unwindTxs, minedTxs); err != nil {
@@ -467,6 +484,7 @@ func (p *TxPool) OnNewBlock(ctx context.Context, stateChanges *remote.StateChang
 	if err := removeMined(p.all, minedTxs.Txs, p.pending, p.baseFee, p.queued, p.discardLocked); err != nil {
 		return err
 	}
+	p.chargeMinedSponsors(ctx)
 
 	blockNum := p.lastSeenBlock.Load()
 
@@ -725,7 +743,8 @@ func (p *TxPool) validateTx(txn *types.TxSlot, isLocal bool, stateCache kvcache.
 	}
 
 	// Drop non-local transactions under our own minimal accepted gas price or tip
-	if !isLocal && uint256.NewInt(p.cfg.MinFeeCap).Cmp(&txn.FeeCap) == 1 {
+	// Free transactions needing a sponsor are let through here and held against its budget once in the pool
+	if !isLocal && !p.sponsorshipRequired(txn) && uint256.NewInt(p.cfg.MinFeeCap).Cmp(&txn.FeeCap) == 1 {
 		if txn.Traced {
 			log.Info(fmt.Sprintf("TX TRACING: validateTx underpriced idHash=%x local=%t, feeCap=%d, cfg.MinFeeCap=%d", txn.IDHash, isLocal, txn.FeeCap, p.cfg.MinFeeCap))
 		}
@@ -769,6 +788,11 @@ func (p *TxPool) validateTx(txn *types.TxSlot, isLocal bool, stateCache kvcache.
 		}
 		return NonceTooLow
 	}
+	// A sponsored transaction holds its sponsor's budget while in the pool, one behind a nonce gap could hold it
+	// without ever being mined
+	if p.sponsorshipRequired(txn) && txn.Nonce > senderNonce+uint64(p.all.count(txn.SenderID)) {
+		return SponsoredNonceGap
+	}
 	// Transactor should have enough funds to cover the costs
 	total := uint256.NewInt(txn.Gas)
 	total.Mul(total, &txn.FeeCap)
@@ -1041,8 +1065,15 @@ func (p *TxPool) addTxs(blockNum uint64, cacheView kvcache.CacheView, senders *s
 			}
 			continue
 		}
+		if p.sponsorshipRequired(txn) {
+			if reason := p.holdSponsor(txn, newTxs.Senders.AddressAt(i)); reason != Success {
+				discardReasons[i] = reason
+				continue
+			}
+		}
 		mt := newMetaTx(txn, newTxs.IsLocal[i], blockNum)
 		if reason := add(mt, &announcements); reason != NotSet {
+			p.settleSponsor(txn, reason)
 			discardReasons[i] = reason
 			continue
 		}
@@ -1234,6 +1265,7 @@ func (p *TxPool) addLocked(mt *metaTx, announcements *types.Announcements) Disca
 // Important: don't call it while iterating by all
 func (p *TxPool) discardLocked(mt *metaTx, reason DiscardReason) {
 	delete(p.byHash, string(mt.Tx.IDHash[:]))
+	p.settleSponsor(mt.Tx, reason)
 	p.deletedTxs = append(p.deletedTxs, mt)
 	p.all.delete(mt)
 	p.discardReasonsLRU.Add(string(mt.Tx.IDHash[:]), reason)
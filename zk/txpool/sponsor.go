@@ -0,0 +1,419 @@
+package txpool
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/ledgerwatch/erigon-lib/common"
+	"github.com/ledgerwatch/erigon-lib/common/length"
+	"github.com/ledgerwatch/erigon-lib/kv"
+	"github.com/ledgerwatch/erigon-lib/types"
+	"github.com/ledgerwatch/log/v3"
+)
+
+// SponsorKind is who a sponsorship pays the gas of free transactions for
+type SponsorKind byte
+
+const (
+	// SenderSponsor pays for the free transactions sent by an address
+	SenderSponsor SponsorKind = iota
+	// ContractSponsor pays for the free transactions calling a contract, whoever sends them
+	ContractSponsor
+)
+
+var sponsorKinds = []SponsorKind{SenderSponsor, ContractSponsor}
+
+var errUnknownSponsorKind = errors.New("unknown sponsor kind")
+
+func ResolveSponsorKind(kind string) (SponsorKind, error) {
+	switch strings.ToLower(kind) {
+	case "sender":
+		return SenderSponsor, nil
+	case "contract":
+		return ContractSponsor, nil
+	default:
+		return SenderSponsor, errUnknownSponsorKind
+	}
+}
+
+func (k SponsorKind) String() string {
+	switch k {
+	case SenderSponsor:
+		return "sender"
+	case ContractSponsor:
+		return "contract"
+	default:
+		return "unknown"
+	}
+}
+
+// Sponsorship lets free transactions of a sender or to a contract into the pool up to a daily gas budget
+type Sponsorship struct {
+	Kind    SponsorKind
+	Address common.Address
+	// DailyGasBudget is the total gas limit of the free transactions let in per UTC day
+	DailyGasBudget uint64
+	// Contracts limits a sender sponsorship to calls of these contracts, with none any call or deployment is sponsored
+	Contracts []common.Address
+}
+
+// SponsorQuota is a sponsorship with the gas charged for its mined transactions on a day and the gas held for the ones
+// still in the pool, both at the gas limit of the transactions
+type SponsorQuota struct {
+	Sponsorship
+	Day        time.Time
+	GasCharged uint64
+	GasHeld    uint64
+}
+
+func (q *SponsorQuota) Remaining() uint64 {
+	if q.GasCharged+q.GasHeld >= q.DailyGasBudget {
+		return 0
+	}
+	return q.DailyGasBudget - q.GasCharged - q.GasHeld
+}
+
+// allows checks whether the sponsorship pays for a transaction to the address
+func (s *Sponsorship) allows(to common.Address, creation bool) bool {
+	if s.Kind == ContractSponsor {
+		return !creation && to == s.Address
+	}
+	if len(s.Contracts) == 0 {
+		return true
+	}
+	if creation {
+		return false
+	}
+	for _, contract := range s.Contracts {
+		if contract == to {
+			return true
+		}
+	}
+	return false
+}
+
+func sponsorKey(kind SponsorKind, addr common.Address) []byte {
+	return append([]byte{byte(kind)}, addr.Bytes()...)
+}
+
+// sponsorship value: 8 bytes daily gas budget followed by 20 bytes per allowed contract
+func encodeSponsorship(s *Sponsorship) []byte {
+	value := make([]byte, 8, 8+len(s.Contracts)*length.Addr)
+	binary.BigEndian.PutUint64(value, s.DailyGasBudget)
+	for _, contract := range s.Contracts {
+		value = append(value, contract.Bytes()...)
+	}
+	return value
+}
+
+func decodeSponsorship(key, value []byte) (*Sponsorship, error) {
+	if len(key) != 1+length.Addr || len(value) < 8 || (len(value)-8)%length.Addr != 0 {
+		return nil, fmt.Errorf("invalid sponsorship, key length %d, value length %d", len(key), len(value))
+	}
+	s := &Sponsorship{
+		Kind:           SponsorKind(key[0]),
+		Address:        common.BytesToAddress(key[1:]),
+		DailyGasBudget: binary.BigEndian.Uint64(value),
+	}
+	for i := 8; i < len(value); i += length.Addr {
+		s.Contracts = append(s.Contracts, common.BytesToAddress(value[i:i+length.Addr]))
+	}
+	return s, nil
+}
+
+// sponsorDay is the number of the UTC day, the budgets start afresh every day
+func sponsorDay(t time.Time) uint64 {
+	return uint64(t.Unix()) / (24 * 60 * 60)
+}
+
+// sponsor usage value: 8 bytes day and 8 bytes gas charged on that day, the usage of a previous day counts as none
+func readSponsorUsage(tx kv.Tx, key []byte, day uint64) (uint64, error) {
+	value, err := tx.GetOne(SponsorUsage, key)
+	if err != nil {
+		return 0, err
+	}
+	if len(value) != 16 || binary.BigEndian.Uint64(value) != day {
+		return 0, nil
+	}
+	return binary.BigEndian.Uint64(value[8:]), nil
+}
+
+func writeSponsorUsage(tx kv.RwTx, key []byte, day, gasCharged uint64) error {
+	value := make([]byte, 16)
+	binary.BigEndian.PutUint64(value, day)
+	binary.BigEndian.PutUint64(value[8:], gasCharged)
+	return tx.Put(SponsorUsage, key, value)
+}
+
+// SetSponsorship adds or replaces the sponsorship of an address, the gas charged to it today stays counted
+func SetSponsorship(ctx context.Context, aclDB kv.RwDB, s Sponsorship) error {
+	if s.Kind != SenderSponsor && s.Kind != ContractSponsor {
+		return errUnknownSponsorKind
+	}
+	if s.Kind == ContractSponsor && len(s.Contracts) > 0 {
+		return errors.New("contracts can only limit a sender sponsorship")
+	}
+	return aclDB.Update(ctx, func(tx kv.RwTx) error {
+		return tx.Put(Sponsors, sponsorKey(s.Kind, s.Address), encodeSponsorship(&s))
+	})
+}
+
+// RemoveSponsorship removes the sponsorship of an address along with its usage
+func RemoveSponsorship(ctx context.Context, aclDB kv.RwDB, kind SponsorKind, addr common.Address) error {
+	return aclDB.Update(ctx, func(tx kv.RwTx) error {
+		key := sponsorKey(kind, addr)
+		if err := tx.Delete(Sponsors, key); err != nil {
+			return err
+		}
+		return tx.Delete(SponsorUsage, key)
+	})
+}
+
+// ListSponsorships returns all sponsorships, the sender ones first
+func ListSponsorships(ctx context.Context, aclDB kv.RoDB) ([]*Sponsorship, error) {
+	var sponsorships []*Sponsorship
+	err := aclDB.View(ctx, func(tx kv.Tx) error {
+		return tx.ForEach(Sponsors, nil, func(k, v []byte) error {
+			s, err := decodeSponsorship(k, v)
+			if err != nil {
+				return err
+			}
+			sponsorships = append(sponsorships, s)
+			return nil
+		})
+	})
+	return sponsorships, err
+}
+
+// GetSponsorQuotas returns the sponsorships of an address as a sender and as a contract with what is left of them at
+// the given time, empty if it has neither
+func GetSponsorQuotas(ctx context.Context, aclDB kv.RoDB, addr common.Address, now time.Time) ([]*SponsorQuota, error) {
+	day := sponsorDay(now)
+	var quotas []*SponsorQuota
+	err := aclDB.View(ctx, func(tx kv.Tx) error {
+		for _, kind := range sponsorKinds {
+			key := sponsorKey(kind, addr)
+			value, err := tx.GetOne(Sponsors, key)
+			if err != nil {
+				return err
+			}
+			if value == nil {
+				continue
+			}
+			s, err := decodeSponsorship(key, value)
+			if err != nil {
+				return err
+			}
+			charged, err := readSponsorUsage(tx, key, day)
+			if err != nil {
+				return err
+			}
+			quotas = append(quotas, &SponsorQuota{
+				Sponsorship: *s,
+				Day:         time.Unix(int64(day*24*60*60), 0).UTC(),
+				GasCharged:  charged,
+			})
+		}
+		return nil
+	})
+	return quotas, err
+}
+
+// findSponsor returns the key of a sponsorship with enough of its daily budget left for the gas limit of a free
+// transaction, on top of the gas held for the sponsored transactions already in the pool.  The sender's sponsorship
+// is used before the contract's, nil is returned if no sponsorship pays.
+func findSponsor(ctx context.Context, aclDB kv.RoDB, from, to common.Address, creation bool, gas uint64, held map[string]uint64, now time.Time) ([]byte, error) {
+	day := sponsorDay(now)
+	var found []byte
+	err := aclDB.View(ctx, func(tx kv.Tx) error {
+		candidates := [][]byte{sponsorKey(SenderSponsor, from)}
+		if !creation {
+			candidates = append(candidates, sponsorKey(ContractSponsor, to))
+		}
+		for _, key := range candidates {
+			value, err := tx.GetOne(Sponsors, key)
+			if err != nil {
+				return err
+			}
+			if value == nil {
+				continue
+			}
+			s, err := decodeSponsorship(key, value)
+			if err != nil {
+				return err
+			}
+			if !s.allows(to, creation) {
+				continue
+			}
+			used, err := readSponsorUsage(tx, key, day)
+			if err != nil {
+				return err
+			}
+			used += held[string(key)]
+			if used > s.DailyGasBudget || gas > s.DailyGasBudget-used {
+				continue
+			}
+			found = key
+			return nil
+		}
+		return nil
+	})
+	return found, err
+}
+
+// chargeSponsors adds the gas of the mined free transactions, keyed by sponsor, to the sponsors' usage of the day
+func chargeSponsors(ctx context.Context, aclDB kv.RwDB, charges map[string]uint64, day uint64) error {
+	return aclDB.Update(ctx, func(tx kv.RwTx) error {
+		for key, gas := range charges {
+			charged, err := readSponsorUsage(tx, []byte(key), day)
+			if err != nil {
+				return err
+			}
+			if err = writeSponsorUsage(tx, []byte(key), day, charged+gas); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// refundSponsor takes the gas of an unwound free transaction off its sponsor's usage of the day it was mined, the
+// usage of a previous day counts for nothing already
+func refundSponsor(ctx context.Context, aclDB kv.RwDB, key []byte, gas, day uint64) error {
+	return aclDB.Update(ctx, func(tx kv.RwTx) error {
+		used, err := readSponsorUsage(tx, key, day)
+		if err != nil {
+			return err
+		}
+		if used == 0 {
+			return nil
+		}
+		if gas > used {
+			gas = used
+		}
+		return writeSponsorUsage(tx, key, day, used-gas)
+	})
+}
+
+// sponsorshipRequired is true for the free transactions that need a sponsor, all of them are let in if free
+// transactions are allowed
+func (p *TxPool) sponsorshipRequired(txn *types.TxSlot) bool {
+	return p.ethCfg.Zk.GaslessSponsorship && !p.ethCfg.AllowFreeTransactions && txn.FeeCap.IsZero()
+}
+
+// sponsorHold is the gas limit of a free transaction set against the budget of the sponsorship paying for it
+type sponsorHold struct {
+	key string
+	gas uint64
+	day uint64 // the day a charged transaction was mined on
+}
+
+// holdSponsor sets the gas limit of a free transaction against its sponsor's budget while it waits in the pool, the
+// sponsor is only charged once the transaction is mined
+func (p *TxPool) holdSponsor(txn *types.TxSlot, from common.Address) DiscardReason {
+	key, err := findSponsor(context.TODO(), p.aclDB, from, txn.To, txn.Creation, txn.Gas, p.sponsorHeld, time.Now())
+	if err != nil {
+		log.Warn("[txpool] Failed to find the sponsor of a free transaction", "err", err)
+		return NotSponsored
+	}
+	if key == nil {
+		return NotSponsored
+	}
+	p.sponsorHolds[string(txn.IDHash[:])] = sponsorHold{key: string(key), gas: txn.Gas}
+	p.sponsorHeld[string(key)] += txn.Gas
+	return Success
+}
+
+// settleSponsor releases the hold of a free transaction leaving the pool, a mined one keeps it until its sponsor is
+// charged with the rest of the block
+func (p *TxPool) settleSponsor(txn *types.TxSlot, reason DiscardReason) {
+	id := string(txn.IDHash[:])
+	hold, ok := p.sponsorHolds[id]
+	if !ok {
+		return
+	}
+	delete(p.sponsorHolds, id)
+	if reason == Mined {
+		p.sponsorMined[id] = hold
+		return
+	}
+	p.releaseSponsorHold(hold)
+}
+
+func (p *TxPool) releaseSponsorHold(hold sponsorHold) {
+	p.sponsorHeld[hold.key] -= hold.gas
+	if p.sponsorHeld[hold.key] == 0 {
+		delete(p.sponsorHeld, hold.key)
+	}
+}
+
+// chargeMinedSponsors charges the sponsors of the free transactions mined in a block in a single write to the ACL.  If
+// the write fails the mined transactions stay held and the charge is tried again with the next block.
+func (p *TxPool) chargeMinedSponsors(ctx context.Context) {
+	if len(p.sponsorMined) == 0 {
+		return
+	}
+	day := sponsorDay(time.Now())
+	charges := make(map[string]uint64)
+	for _, hold := range p.sponsorMined {
+		charges[hold.key] += hold.gas
+	}
+	if err := chargeSponsors(ctx, p.aclDB, charges, day); err != nil {
+		log.Warn("[txpool] Failed to charge sponsors of mined transactions, retrying with the next block", "err", err)
+		return
+	}
+	for id, hold := range p.sponsorMined {
+		p.releaseSponsorHold(hold)
+		hold.day = day
+		p.sponsorCharges[id] = hold
+	}
+	p.sponsorMined = map[string]sponsorHold{}
+}
+
+// unchargeSponsors refunds the free transactions of unwound blocks and holds their gas again as they go back into
+// the pool.  The charges are kept until the day is over, a refund would change nothing after that.
+func (p *TxPool) unchargeSponsors(unwindTxs types.TxSlots) {
+	today := sponsorDay(time.Now())
+	for id, charge := range p.sponsorCharges {
+		if charge.day < today {
+			delete(p.sponsorCharges, id)
+		}
+	}
+	for _, txn := range unwindTxs.Txs {
+		id := string(txn.IDHash[:])
+		// mined but not charged yet, the transaction still holds its gas
+		if hold, ok := p.sponsorMined[id]; ok {
+			delete(p.sponsorMined, id)
+			p.sponsorHolds[id] = hold
+			continue
+		}
+		charge, ok := p.sponsorCharges[id]
+		if !ok {
+			continue
+		}
+		delete(p.sponsorCharges, id)
+		if err := refundSponsor(context.TODO(), p.aclDB, []byte(charge.key), charge.gas, charge.day); err != nil {
+			log.Warn("[txpool] Failed to refund the sponsor of an unwound transaction", "err", err)
+		}
+		p.sponsorHolds[id] = sponsorHold{key: charge.key, gas: charge.gas}
+		p.sponsorHeld[charge.key] += charge.gas
+	}
+}
+
+// SponsorQuotas returns the sponsorships of an address with what is left of them today
+func (p *TxPool) SponsorQuotas(ctx context.Context, addr common.Address) ([]*SponsorQuota, error) {
+	quotas, err := GetSponsorQuotas(ctx, p.aclDB, addr, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	for _, quota := range quotas {
+		quota.GasHeld = p.sponsorHeld[string(sponsorKey(quota.Kind, quota.Address))]
+	}
+	return quotas, nil
+}
@@ -0,0 +1,176 @@
+package txpool
+
+import (
+	"context"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/holiman/uint256"
+	"github.com/ledgerwatch/erigon-lib/common"
+	"github.com/ledgerwatch/erigon-lib/kv/kvcache"
+	"github.com/ledgerwatch/erigon-lib/txpool/txpoolcfg"
+	"github.com/ledgerwatch/erigon-lib/types"
+	"github.com/ledgerwatch/erigon/eth/ethconfig"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSponsorships(t *testing.T) {
+	db := newTestACLDB(t, "")
+	ctx := context.Background()
+
+	sender := common.HexToAddress("0x01")
+	dapp := common.HexToAddress("0x02")
+	other := common.HexToAddress("0x03")
+	now := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+
+	require.NoError(t, SetSponsorship(ctx, db, Sponsorship{Kind: SenderSponsor, Address: sender, DailyGasBudget: 50_000, Contracts: []common.Address{dapp}}))
+	require.NoError(t, SetSponsorship(ctx, db, Sponsorship{Kind: ContractSponsor, Address: dapp, DailyGasBudget: 30_000}))
+	require.Error(t, SetSponsorship(ctx, db, Sponsorship{Kind: ContractSponsor, Address: other, Contracts: []common.Address{dapp}}))
+
+	sponsorships, err := ListSponsorships(ctx, db)
+	require.NoError(t, err)
+	require.Len(t, sponsorships, 2)
+
+	charge := func(from, to common.Address, creation bool, gas uint64, at time.Time) bool {
+		key, err := findSponsor(ctx, db, from, to, creation, gas, nil, at)
+		require.NoError(t, err)
+		if key == nil {
+			return false
+		}
+		require.NoError(t, chargeSponsors(ctx, db, map[string]uint64{string(key): gas}, sponsorDay(at)))
+		return true
+	}
+
+	t.Run("sender sponsorship only pays for its contracts", func(t *testing.T) {
+		require.False(t, charge(sender, other, false, 21_000, now))
+		require.False(t, charge(sender, common.Address{}, true, 21_000, now))
+	})
+
+	t.Run("sender is charged before contract", func(t *testing.T) {
+		require.True(t, charge(sender, dapp, false, 40_000, now))
+
+		// the sender has 10k left so the contract pays
+		require.True(t, charge(sender, dapp, false, 25_000, now))
+
+		quotas, err := GetSponsorQuotas(ctx, db, dapp, now)
+		require.NoError(t, err)
+		require.Len(t, quotas, 1)
+		require.Equal(t, uint64(25_000), quotas[0].GasCharged)
+		require.Equal(t, uint64(5_000), quotas[0].Remaining())
+
+		// neither has enough left
+		require.False(t, charge(other, dapp, false, 21_000, now))
+	})
+
+	t.Run("held gas counts against the budget", func(t *testing.T) {
+		tomorrow := now.Add(24 * time.Hour)
+		held := map[string]uint64{string(sponsorKey(ContractSponsor, dapp)): 10_000}
+		key, err := findSponsor(ctx, db, other, dapp, false, 21_000, held, tomorrow)
+		require.NoError(t, err)
+		require.Nil(t, key)
+
+		key, err = findSponsor(ctx, db, other, dapp, false, 20_000, held, tomorrow)
+		require.NoError(t, err)
+		require.Equal(t, sponsorKey(ContractSponsor, dapp), key)
+	})
+
+	t.Run("refund gives the gas back", func(t *testing.T) {
+		key := sponsorKey(ContractSponsor, dapp)
+		require.NoError(t, refundSponsor(ctx, db, key, 20_000, sponsorDay(now)))
+		quotas, err := GetSponsorQuotas(ctx, db, dapp, now)
+		require.NoError(t, err)
+		require.Equal(t, uint64(5_000), quotas[0].GasCharged)
+
+		// a refund never takes more than was used
+		require.NoError(t, refundSponsor(ctx, db, key, 20_000, sponsorDay(now)))
+		quotas, err = GetSponsorQuotas(ctx, db, dapp, now)
+		require.NoError(t, err)
+		require.Zero(t, quotas[0].GasCharged)
+		require.NoError(t, chargeSponsors(ctx, db, map[string]uint64{string(key): 25_000}, sponsorDay(now)))
+	})
+
+	t.Run("budgets start afresh the next day", func(t *testing.T) {
+		tomorrow := now.Add(24 * time.Hour)
+		quotas, err := GetSponsorQuotas(ctx, db, sender, tomorrow)
+		require.NoError(t, err)
+		require.Len(t, quotas, 1)
+		require.Zero(t, quotas[0].GasCharged)
+		require.Equal(t, time.Date(2024, 6, 2, 0, 0, 0, 0, time.UTC), quotas[0].Day)
+
+		require.True(t, charge(other, dapp, false, 21_000, tomorrow))
+	})
+
+	t.Run("removed sponsorship pays for nothing", func(t *testing.T) {
+		require.NoError(t, RemoveSponsorship(ctx, db, ContractSponsor, dapp))
+		require.False(t, charge(other, dapp, false, 1, now.Add(48*time.Hour)))
+
+		quotas, err := GetSponsorQuotas(ctx, db, dapp, now)
+		require.NoError(t, err)
+		require.Empty(t, quotas)
+	})
+}
+
+// TestSponsorHolds checks that the pool only charges a sponsor for mined transactions and gives the gas back when a
+// transaction is dropped or unwound
+func TestSponsorHolds(t *testing.T) {
+	db := newTestACLDB(t, "")
+	ctx := context.Background()
+	dapp := common.HexToAddress("0x02")
+	require.NoError(t, SetSponsorship(ctx, db, Sponsorship{Kind: ContractSponsor, Address: dapp, DailyGasBudget: 50_000}))
+	key := string(sponsorKey(ContractSponsor, dapp))
+
+	p, err := New(make(chan types.Announcements), nil, txpoolcfg.DefaultConfig, &ethconfig.Defaults, kvcache.NewDummy(), *uint256.NewInt(1101), big.NewInt(0), big.NewInt(0), db)
+	require.NoError(t, err)
+
+	newTx := func(id byte) *types.TxSlot {
+		return &types.TxSlot{IDHash: common.Hash{id}, To: dapp, Gas: 21_000}
+	}
+	charged := func() uint64 {
+		quotas, err := GetSponsorQuotas(ctx, db, dapp, time.Now())
+		require.NoError(t, err)
+		return quotas[0].GasCharged
+	}
+
+	replaced, mined, third := newTx(1), newTx(2), newTx(3)
+	require.Equal(t, Success, p.holdSponsor(replaced, common.Address{}))
+	require.Equal(t, Success, p.holdSponsor(mined, common.Address{}))
+	require.Equal(t, NotSponsored, p.holdSponsor(third, common.Address{}))
+	require.Equal(t, uint64(42_000), p.sponsorHeld[key])
+	require.Zero(t, charged())
+
+	// a replaced transaction gives its gas back without charging the sponsor
+	p.settleSponsor(replaced, ReplacedByHigherTip)
+	require.Equal(t, uint64(21_000), p.sponsorHeld[key])
+	require.Zero(t, charged())
+	require.Equal(t, Success, p.holdSponsor(third, common.Address{}))
+
+	// a mined one stays held until the sponsors are charged for the block
+	p.settleSponsor(mined, Mined)
+	require.Equal(t, uint64(42_000), p.sponsorHeld[key])
+	require.Zero(t, charged())
+
+	// unwound before the charge it is simply held again
+	unwound := types.TxSlots{}
+	unwound.Append(mined, common.Address{}.Bytes(), false)
+	p.unchargeSponsors(unwound)
+	require.Empty(t, p.sponsorMined)
+	require.Equal(t, uint64(42_000), p.sponsorHeld[key])
+
+	p.settleSponsor(mined, Mined)
+	p.chargeMinedSponsors(ctx)
+	require.Empty(t, p.sponsorMined)
+	require.Equal(t, uint64(21_000), p.sponsorHeld[key])
+	require.Equal(t, uint64(21_000), charged())
+
+	// unwound after the charge it is refunded and held again, until it is dropped for good
+	p.unchargeSponsors(unwound)
+	require.Equal(t, uint64(42_000), p.sponsorHeld[key])
+	require.Zero(t, charged())
+
+	p.settleSponsor(mined, DiscardByLimbo)
+	p.settleSponsor(third, PendingPoolOverflow)
+	require.Empty(t, p.sponsorHeld)
+	require.Empty(t, p.sponsorHolds)
+	require.Zero(t, charged())
+}
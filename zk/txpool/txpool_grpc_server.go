@@ -242,7 +242,7 @@ func mapDiscardReasonToProto(reason DiscardReason) txpool_proto.ImportResult {
 		return txpool_proto.ImportResult_SUCCESS
 	case AlreadyKnown:
 		return txpool_proto.ImportResult_ALREADY_EXISTS
-	case UnderPriced, ReplaceUnderpriced, FeeTooLow:
+	case UnderPriced, ReplaceUnderpriced, FeeTooLow, NotSponsored:
 		return txpool_proto.ImportResult_FEE_TOO_LOW
 	case GasLimitTooHigh, InvalidSender, NegativeValue, OversizedData, InitCodeTooLarge, RLPTooLong, UnsupportedTx:
 		return txpool_proto.ImportResult_INVALID
@@ -30,6 +30,40 @@ type L1BatchInfo struct {
 	L1InfoRoot common.Hash
 }
 
+// BatchStatus is the furthest step of its lifecycle a batch reached, trusted batches are only known on the L2
+type BatchStatus byte
+
+const (
+	BatchStatusTrusted BatchStatus = iota
+	BatchStatusVirtual
+	BatchStatusVerified
+	BatchStatusFinalized
+)
+
+var batchStatusNames = map[BatchStatus]string{
+	BatchStatusTrusted:   "trusted",
+	BatchStatusVirtual:   "virtual",
+	BatchStatusVerified:  "verified",
+	BatchStatusFinalized: "finalized",
+}
+
+func (s BatchStatus) String() string {
+	if name, ok := batchStatusNames[s]; ok {
+		return name
+	}
+	return fmt.Sprintf("unknown(%d)", byte(s))
+}
+
+// BatchTransition is the move of the batches up to and including BatchNo to a new status on the L1.  A transition
+// covers all batches above the BatchNo of the previous transition to the same status.  Finalized transitions keep the
+// L1 block and tx hash of the verification that was finalized.
+type BatchTransition struct {
+	Status    BatchStatus
+	BatchNo   uint64
+	L1BlockNo uint64
+	L1TxHash  common.Hash
+}
+
 // Batch struct
 type Batch struct {
 	BatchNumber    uint64